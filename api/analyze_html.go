@@ -0,0 +1,424 @@
+package api
+
+// This file implements the HTML format for "AnalyzeMetafile". The metafile
+// is summarized into a smaller JSON object which is embedded in a page that
+// doesn't load anything else, so the page can be attached to a bug report or
+// opened straight from disk. Each output file gets a zoomable treemap where
+// input files are grouped by the package they came from, and selecting an
+// input file shows the chain of imports that caused it to be included.
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ije/esbuild-internal/helpers"
+	"github.com/ije/esbuild-internal/js_ast"
+)
+
+type analyzeHTMLGroup struct {
+	name      string
+	isPackage bool
+	size      int
+	files     metafileArray
+}
+
+func analyzeMetafileHTML(result js_ast.Expr) string {
+	sb := strings.Builder{}
+	sb.WriteString("{\"outputs\":[")
+
+	if outputs := getObjectPropertyObject(result, "outputs"); outputs != nil {
+		var entries metafileArray
+
+		// Scan over the "outputs" object the same way the text format does
+		for _, output := range outputs.Properties {
+			key := helpers.UTF16ToString(output.Key.Data.(*js_ast.EString).Value)
+			if strings.HasSuffix(key, ".map") {
+				continue
+			}
+			bytes := getObjectPropertyNumber(output.ValueOrNil, "bytes")
+			inputs := getObjectPropertyObject(output.ValueOrNil, "inputs")
+			if bytes == nil || inputs == nil {
+				continue
+			}
+			entry := metafileEntry{name: key, size: int(bytes.Value)}
+			if entryPoint := getObjectPropertyString(output.ValueOrNil, "entryPoint"); entryPoint != nil {
+				entry.entryPoint = helpers.UTF16ToString(entryPoint.Value)
+			}
+			for _, input := range inputs.Properties {
+				if bytesInOutput := getObjectPropertyNumber(input.ValueOrNil, "bytesInOutput"); bytesInOutput != nil && bytesInOutput.Value > 0 {
+					entry.entries = append(entry.entries, metafileEntry{
+						name: helpers.UTF16ToString(input.Key.Data.(*js_ast.EString).Value),
+						size: int(bytesInOutput.Value),
+					})
+				}
+			}
+			entries = append(entries, entry)
+		}
+
+		sort.Sort(entries)
+
+		for i, entry := range entries {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString("{\"path\":")
+			sb.Write(helpers.QuoteForJSON(entry.name, false))
+			sb.WriteString(",\"bytes\":")
+			sb.WriteString(strconv.Itoa(entry.size))
+			if entry.entryPoint != "" {
+				sb.WriteString(",\"entryPoint\":")
+				sb.Write(helpers.QuoteForJSON(entry.entryPoint, false))
+			}
+			sb.WriteString(",\"groups\":[")
+			for j, group := range groupInputsByPackage(entry.entries) {
+				if j > 0 {
+					sb.WriteByte(',')
+				}
+				sb.WriteString("{\"name\":")
+				sb.Write(helpers.QuoteForJSON(group.name, false))
+				if group.isPackage {
+					sb.WriteString(",\"isPackage\":true")
+				}
+				sb.WriteString(",\"bytes\":")
+				sb.WriteString(strconv.Itoa(group.size))
+				sb.WriteString(",\"files\":[")
+				for k, file := range group.files {
+					if k > 0 {
+						sb.WriteByte(',')
+					}
+					sb.WriteString("{\"path\":")
+					sb.Write(helpers.QuoteForJSON(file.name, false))
+					sb.WriteString(",\"bytes\":")
+					sb.WriteString(strconv.Itoa(file.size))
+					sb.WriteByte('}')
+				}
+				sb.WriteString("]}")
+			}
+			sb.WriteString("]}")
+		}
+	}
+
+	sb.WriteString("],\"importers\":[")
+
+	// Invert the import graph so the page can walk from any input file back
+	// toward an entry point. External imports are left out since they aren't
+	// input files. This is an array of pairs instead of an object because a
+	// path such as "__proto__" can't be a key in an object literal.
+	if inputs := getObjectPropertyObject(result, "inputs"); inputs != nil {
+		importersForPath := make(map[string][]string)
+		for _, prop := range inputs.Properties {
+			importer := helpers.UTF16ToString(prop.Key.Data.(*js_ast.EString).Value)
+			if imports := getObjectPropertyArray(prop.ValueOrNil, "imports"); imports != nil {
+				for _, item := range imports.Items {
+					if external, ok := getObjectProperty(item, "external").Data.(*js_ast.EBoolean); ok && external.Value {
+						continue
+					}
+					if path := getObjectPropertyString(item, "path"); path != nil {
+						imported := helpers.UTF16ToString(path.Value)
+						if importers := importersForPath[imported]; len(importers) == 0 || importers[len(importers)-1] != importer {
+							importersForPath[imported] = append(importers, importer)
+						}
+					}
+				}
+			}
+		}
+
+		paths := make([]string, 0, len(importersForPath))
+		for path := range importersForPath {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for i, path := range paths {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteByte('[')
+			sb.Write(helpers.QuoteForJSON(path, false))
+			sb.WriteString(",[")
+			for j, importer := range importersForPath[path] {
+				if j > 0 {
+					sb.WriteByte(',')
+				}
+				sb.Write(helpers.QuoteForJSON(importer, false))
+			}
+			sb.WriteString("]]")
+		}
+	}
+
+	sb.WriteString("]}")
+
+	// The data is embedded in a "<script>" tag, so it must not close that tag
+	data := helpers.EscapeClosingTag(sb.String(), "/script")
+	return analyzeHTMLPrefix + data + analyzeHTMLSuffix
+}
+
+// Input files from the same package are grouped together. Input files that
+// aren't inside a package all go into a single group for the project itself.
+func groupInputsByPackage(inputs metafileArray) []analyzeHTMLGroup {
+	var groups []analyzeHTMLGroup
+	groupIndex := make(map[string]int)
+
+	for _, input := range inputs {
+		name, isPackage := packageNameForInputPath(input.name)
+		index, ok := groupIndex[name]
+		if !ok {
+			index = len(groups)
+			groupIndex[name] = index
+			groups = append(groups, analyzeHTMLGroup{name: name, isPackage: isPackage})
+		}
+		group := &groups[index]
+		group.size += input.size
+		group.files = append(group.files, input)
+	}
+
+	for _, group := range groups {
+		sort.Sort(group.files)
+	}
+	sort.SliceStable(groups, func(i int, j int) bool {
+		gi := groups[i]
+		gj := groups[j]
+		return gi.size > gj.size || (gi.size == gj.size && gi.name < gj.name)
+	})
+	return groups
+}
+
+// This uses the innermost "node_modules" directory so that nested copies of
+// a package are attributed to that package instead of the outer one
+func packageNameForInputPath(path string) (string, bool) {
+	path = strings.ReplaceAll(path, "\\", "/")
+	i := strings.LastIndex(path, "node_modules/")
+	if i == -1 || (i > 0 && path[i-1] != '/' && path[i-1] != ':') {
+		return "(project)", false
+	}
+	rest := path[i+len("node_modules/"):]
+	slash := strings.IndexByte(rest, '/')
+	if slash == -1 {
+		return "(project)", false
+	}
+	if strings.HasPrefix(rest, "@") {
+		if next := strings.IndexByte(rest[slash+1:], '/'); next != -1 {
+			slash += 1 + next
+		} else {
+			return "(project)", false
+		}
+	}
+	return rest[:slash], true
+}
+
+const analyzeHTMLPrefix = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Bundle analysis</title>
+<style>
+* { box-sizing: border-box; }
+body { margin: 0; font: 13px/1.4 -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; color: #222; background: #f6f6f6; display: flex; flex-direction: column; height: 100vh; }
+header { display: flex; align-items: center; gap: 12px; padding: 8px 12px; background: #fff; border-bottom: 1px solid #ddd; }
+header select { font: inherit; padding: 2px 4px; }
+#crumbs a { color: #0366d6; cursor: pointer; text-decoration: none; }
+#crumbs a:hover { text-decoration: underline; }
+main { flex: 1; display: flex; min-height: 0; }
+#map { flex: 1; position: relative; margin: 8px; }
+.cell { position: absolute; overflow: hidden; border: 1px solid #fff; padding: 3px 5px; cursor: pointer; color: #fff; white-space: nowrap; text-overflow: ellipsis; }
+.cell:hover { filter: brightness(1.1); }
+.cell.selected { outline: 2px solid #222; outline-offset: -2px; }
+.cell .size { opacity: 0.8; font-size: 11px; }
+aside { width: 340px; overflow: auto; padding: 12px; background: #fff; border-left: 1px solid #ddd; }
+aside h2 { font-size: 14px; margin: 0 0 8px; }
+aside ol { padding-left: 20px; margin: 0; }
+aside li { word-break: break-all; margin-bottom: 4px; }
+.muted { color: #777; }
+</style>
+</head>
+<body>
+<header>
+<label>Output file <select id="outputs"></select></label>
+<span id="crumbs"></span>
+</header>
+<main>
+<div id="map"></div>
+<aside id="panel"><p class="muted">Click a package to zoom in. Click a file to see why it was included.</p></aside>
+</main>
+<script>
+var data = `
+
+const analyzeHTMLSuffix = `;
+(function () {
+  var outputsSelect = document.getElementById("outputs");
+  var crumbs = document.getElementById("crumbs");
+  var map = document.getElementById("map");
+  var panel = document.getElementById("panel");
+  var output = null, group = null, selected = null;
+
+  // Paths are used as keys, so these objects must not have a prototype
+  var importersForPath = Object.create(null);
+  data.importers.forEach(function (pair) {
+    importersForPath[pair[0]] = pair[1];
+  });
+
+  function formatBytes(n) {
+    if (n < 1024) return n + "b";
+    if (n < 1024 * 1024) return (n / 1024).toFixed(1) + "kb";
+    return (n / (1024 * 1024)).toFixed(1) + "mb";
+  }
+
+  function colorFor(name) {
+    var hash = 0;
+    for (var i = 0; i < name.length; i++) hash = (hash * 31 + name.charCodeAt(i)) | 0;
+    return "hsl(" + (((hash % 360) + 360) % 360) + ", 45%, 45%)";
+  }
+
+  function text(tag, value, className) {
+    var el = document.createElement(tag);
+    el.textContent = value;
+    if (className) el.className = className;
+    return el;
+  }
+
+  // This is the "squarified" treemap layout algorithm, which keeps cells as
+  // close to square as possible so their labels are easier to read
+  function squarify(items, x, y, w, h) {
+    var total = 0, rects = [];
+    items.forEach(function (item) { total += item.bytes; });
+    if (total <= 0) return rects;
+    var scale = (w * h) / total, row = [], i = 0;
+    function worst(row, side) {
+      var sum = 0, max = 0, min = Infinity;
+      row.forEach(function (item) {
+        var area = item.bytes * scale;
+        sum += area; max = Math.max(max, area); min = Math.min(min, area);
+      });
+      return Math.max((side * side * max) / (sum * sum), (sum * sum) / (side * side * min));
+    }
+    function layoutRow(row) {
+      var sum = 0;
+      row.forEach(function (item) { sum += item.bytes * scale; });
+      if (w >= h) {
+        var rowW = sum / h, cy = y;
+        row.forEach(function (item) {
+          var cellH = (item.bytes * scale) / rowW;
+          rects.push({ item: item, x: x, y: cy, w: rowW, h: cellH });
+          cy += cellH;
+        });
+        x += rowW; w -= rowW;
+      } else {
+        var rowH = sum / w, cx = x;
+        row.forEach(function (item) {
+          var cellW = (item.bytes * scale) / rowH;
+          rects.push({ item: item, x: cx, y: y, w: cellW, h: rowH });
+          cx += cellW;
+        });
+        y += rowH; h -= rowH;
+      }
+    }
+    while (i < items.length) {
+      var side = Math.min(w, h), next = row.concat([items[i]]);
+      if (row.length === 0 || worst(next, side) <= worst(row, side)) {
+        row = next; i++;
+      } else {
+        layoutRow(row); row = [];
+      }
+    }
+    if (row.length) layoutRow(row);
+    return rects;
+  }
+
+  // Find the shortest chain of importers from this file back to the entry
+  // point for the current output file (or to any file without importers)
+  function importChain(path) {
+    var parents = Object.create(null), queue = [path], found = null;
+    parents[path] = null;
+    while (queue.length) {
+      var current = queue.shift(), importers = importersForPath[current] || [];
+      if (current === output.entryPoint || (!output.entryPoint && importers.length === 0)) {
+        found = current;
+        break;
+      }
+      importers.forEach(function (importer) {
+        if (!(importer in parents)) {
+          parents[importer] = current;
+          queue.push(importer);
+        }
+      });
+    }
+    var chain = [];
+    for (var step = found; step !== null && step !== undefined; step = parents[step]) chain.push(step);
+    return chain.reverse();
+  }
+
+  function showFile(file) {
+    selected = file.path;
+    panel.innerHTML = "";
+    panel.appendChild(text("h2", file.path));
+    panel.appendChild(text("p", formatBytes(file.bytes) + " in " + output.path + " (" + (100 * file.bytes / output.bytes).toFixed(1) + "%)", "muted"));
+    var chain = importChain(file.path);
+    if (chain.length === 0) {
+      panel.appendChild(text("p", "No import chain was found for this file.", "muted"));
+    } else {
+      panel.appendChild(text("h2", "Imported by"));
+      var list = document.createElement("ol");
+      chain.forEach(function (path) { list.appendChild(text("li", path)); });
+      panel.appendChild(list);
+    }
+    render();
+  }
+
+  function render() {
+    crumbs.innerHTML = "";
+    var root = document.createElement("a");
+    root.textContent = output.path;
+    root.onclick = function () { group = null; render(); };
+    crumbs.appendChild(root);
+    if (group) crumbs.appendChild(document.createTextNode(" › " + group.name));
+
+    map.innerHTML = "";
+    var items = group ? group.files : output.groups;
+    var rects = squarify(items, 0, 0, map.clientWidth, map.clientHeight);
+    rects.forEach(function (rect) {
+      var item = rect.item, cell = document.createElement("div");
+      var label = group ? item.path : item.name;
+      if (group && group.isPackage) label = label.slice(label.lastIndexOf(group.name + "/") + group.name.length + 1);
+      cell.className = "cell" + (group && item.path === selected ? " selected" : "");
+      cell.style.left = rect.x + "px";
+      cell.style.top = rect.y + "px";
+      cell.style.width = rect.w + "px";
+      cell.style.height = rect.h + "px";
+      cell.style.background = colorFor(group ? group.name : item.name);
+      cell.title = (group ? item.path : item.name) + " – " + formatBytes(item.bytes);
+      cell.appendChild(text("div", label));
+      cell.appendChild(text("div", formatBytes(item.bytes), "size"));
+      cell.onclick = function () {
+        if (group) showFile(item);
+        else if (item.files.length === 1) { group = item; showFile(item.files[0]); }
+        else { group = item; render(); }
+      };
+      map.appendChild(cell);
+    });
+  }
+
+  data.outputs.forEach(function (o, i) {
+    var option = document.createElement("option");
+    option.value = i;
+    option.textContent = o.path + " (" + formatBytes(o.bytes) + ")";
+    outputsSelect.appendChild(option);
+  });
+  outputsSelect.onchange = function () {
+    output = data.outputs[outputsSelect.value];
+    group = null;
+    selected = null;
+    render();
+  };
+  window.onresize = render;
+  if (data.outputs.length) {
+    output = data.outputs[0];
+    render();
+  } else {
+    map.appendChild(text("p", "This metafile has no output files.", "muted"));
+  }
+})();
+</script>
+</body>
+</html>
+`
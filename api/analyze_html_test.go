@@ -0,0 +1,125 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ije/esbuild-internal/test"
+)
+
+func TestPackageNameForInputPath(t *testing.T) {
+	check := func(path string, expectedName string, expectedIsPackage bool) {
+		t.Helper()
+		name, isPackage := packageNameForInputPath(path)
+		test.AssertEqual(t, name, expectedName)
+		test.AssertEqual(t, isPackage, expectedIsPackage)
+	}
+
+	check("src/entry.js", "(project)", false)
+	check("node_modules/pkg/index.js", "pkg", true)
+	check("node_modules/pkg/lib/index.js", "pkg", true)
+	check("../node_modules/pkg/index.js", "pkg", true)
+	check("node_modules/@scope/pkg/index.js", "@scope/pkg", true)
+	check("node_modules/@scope/pkg/lib/index.js", "@scope/pkg", true)
+
+	// Nested copies belong to the innermost package
+	check("node_modules/outer/node_modules/inner/index.js", "inner", true)
+	check("node_modules/@scope/outer/node_modules/@scope/inner/index.js", "@scope/inner", true)
+	check("node_modules/@scope/outer/node_modules/inner/index.js", "inner", true)
+
+	// Windows paths
+	check("node_modules\\pkg\\index.js", "pkg", true)
+	check("node_modules\\@scope\\pkg\\index.js", "@scope/pkg", true)
+	check("C:\\project\\node_modules\\outer\\node_modules\\inner\\index.js", "inner", true)
+	check("C:node_modules\\pkg\\index.js", "pkg", true)
+
+	// These aren't inside a package
+	check("my_node_modules/pkg/index.js", "(project)", false)
+	check("node_modules/index.js", "(project)", false)
+	check("node_modules/@scope/index.js", "(project)", false)
+}
+
+func TestGroupInputsByPackage(t *testing.T) {
+	groups := groupInputsByPackage(metafileArray{
+		{name: "src/b.js", size: 10},
+		{name: "node_modules/small/index.js", size: 5},
+		{name: "node_modules/@scope/big/a.js", size: 20},
+		{name: "src/a.js", size: 10},
+		{name: "node_modules/@scope/big/b.js", size: 30},
+		{name: "node_modules/tie/index.js", size: 5},
+	})
+
+	// Groups are sorted by size and then by name, and so are the files in them
+	var names []string
+	for _, group := range groups {
+		var files []string
+		for _, file := range group.files {
+			files = append(files, file.name)
+		}
+		names = append(names, group.name+" "+strings.Join(files, ","))
+	}
+	test.AssertEqualWithDiff(t, strings.Join(names, "\n"), ""+
+		"@scope/big node_modules/@scope/big/b.js,node_modules/@scope/big/a.js\n"+
+		"(project) src/a.js,src/b.js\n"+
+		"small node_modules/small/index.js\n"+
+		"tie node_modules/tie/index.js")
+
+	test.AssertEqual(t, groups[0].size, 50)
+	test.AssertEqual(t, groups[0].isPackage, true)
+	test.AssertEqual(t, groups[1].size, 20)
+	test.AssertEqual(t, groups[1].isPackage, false)
+}
+
+func TestAnalyzeMetafileHTML(t *testing.T) {
+	metafile := `{
+		"inputs": {
+			"entry.js": {
+				"bytes": 100,
+				"imports": [
+					{ "path": "__proto__" },
+					{ "path": "a</script><b>.js" },
+					{ "path": "node_modules/@scope/pkg/index.js" },
+					{ "path": "fs", "external": true }
+				]
+			},
+			"a</script><b>.js": { "bytes": 20, "imports": [{ "path": "node_modules/@scope/pkg/index.js" }] },
+			"__proto__": { "bytes": 10, "imports": [] },
+			"node_modules/@scope/pkg/index.js": { "bytes": 30, "imports": [] }
+		},
+		"outputs": {
+			"out/entry.js.map": { "bytes": 500, "inputs": {} },
+			"out/entry.js": {
+				"bytes": 200,
+				"entryPoint": "entry.js",
+				"inputs": {
+					"entry.js": { "bytesInOutput": 50 },
+					"__proto__": { "bytesInOutput": 10 },
+					"a</script><b>.js": { "bytesInOutput": 20 },
+					"node_modules/@scope/pkg/index.js": { "bytesInOutput": 40 },
+					"unused.js": { "bytesInOutput": 0 }
+				}
+			}
+		}
+	}`
+
+	html := AnalyzeMetafile(metafile, AnalyzeMetafileOptions{Format: AnalyzeMetafileHTML})
+	if !strings.HasPrefix(html, analyzeHTMLPrefix) || !strings.HasSuffix(html, analyzeHTMLSuffix) {
+		t.Fatalf("Expected the data to be embedded in the page:\n%s", html)
+	}
+
+	// The "</script" in the path must not end the "<script>" tag early
+	data := html[len(analyzeHTMLPrefix) : len(html)-len(analyzeHTMLSuffix)]
+	test.AssertEqualWithDiff(t, data, `{"outputs":[`+
+		`{"path":"out/entry.js","bytes":200,"entryPoint":"entry.js","groups":[`+
+		`{"name":"(project)","bytes":80,"files":[{"path":"entry.js","bytes":50},{"path":"a<\/script><b>.js","bytes":20},{"path":"__proto__","bytes":10}]},`+
+		`{"name":"@scope/pkg","isPackage":true,"bytes":40,"files":[{"path":"node_modules/@scope/pkg/index.js","bytes":40}]}`+
+		`]}],"importers":[`+
+		`["__proto__",["entry.js"]],`+
+		`["a<\/script><b>.js",["entry.js"]],`+
+		`["node_modules/@scope/pkg/index.js",["entry.js","a<\/script><b>.js"]]`+
+		`]}`)
+
+	// Metafiles without any outputs still produce a page
+	html = AnalyzeMetafile("{}", AnalyzeMetafileOptions{Format: AnalyzeMetafileHTML})
+	test.AssertEqual(t, html, analyzeHTMLPrefix+`{"outputs":[],"importers":[]}`+analyzeHTMLSuffix)
+}
@@ -79,6 +79,8 @@ package api
 import (
 	"time"
 
+	"github.com/ije/esbuild-internal/css_ast"
+	"github.com/ije/esbuild-internal/js_ast"
 	"github.com/ije/esbuild-internal/logger"
 )
 
@@ -110,6 +112,15 @@ const (
 	LegalCommentsExternal
 )
 
+type Integrity uint8
+
+const (
+	IntegrityNone Integrity = iota
+	IntegritySHA256
+	IntegritySHA384
+	IntegritySHA512
+)
+
 type JSX uint8
 
 const (
@@ -150,6 +161,7 @@ const (
 	LoaderEmpty
 	LoaderFile
 	LoaderGlobalCSS
+	LoaderHTML
 	LoaderJS
 	LoaderJSON
 	LoaderJSX
@@ -175,6 +187,8 @@ const (
 	FormatIIFE
 	FormatCommonJS
 	FormatESModule
+	FormatUMD
+	FormatSystem
 )
 
 type Packages uint8
@@ -259,6 +273,13 @@ const (
 	DropDebugger
 )
 
+type Compress uint8
+
+const (
+	CompressGzip Compress = 1 << iota
+	CompressBrotli
+)
+
 type MangleQuoted uint8
 
 const (
@@ -349,6 +370,98 @@ type BuildOptions struct {
 	ChunkNames string // Documentation: https://esbuild.github.io/api/#chunk-names
 	AssetNames string // Documentation: https://esbuild.github.io/api/#asset-names
 
+	// Maps a chunk name to a list of path patterns. Modules matching one of the
+	// patterns (and their static dependencies) are grouped into a single chunk
+	// with that name when code splitting is enabled. Patterns are relative to
+	// the working directory and may contain one "*" wildcard, such as
+	// "node_modules/react*". Patterns that are bare package names such as
+	// "react" or "@mui/*" also match modules in that package's directory
+	// inside of any "node_modules" directory, including nested ones.
+	ManualChunks map[string][]string
+
+	// Maps an external import path to the name of the global variable that
+	// provides it when the "umd" format is loaded without a module system,
+	// such as "react" => "React" or "lodash/fp" => "_.fp". External import
+	// paths that aren't in this map use a name guessed from the path.
+	UMDGlobals map[string]string
+
+	// Enables hot module replacement when serving. Modules can use the
+	// "import.meta.hot" object to accept updates, to run cleanup code before
+	// being replaced, and to pass data to the next version of themselves. Changes
+	// that aren't accepted cause the page to reload. This requires bundling.
+	HMR bool
+
+	// Shared chunks smaller than this many bytes are merged into other shared
+	// chunks when code splitting is enabled. This means some entry points may
+	// load code they don't use in exchange for fewer chunks. Only chunks without
+	// side effects are merged this way.
+	MinChunkSize int
+
+	// Adds an "integrity" attribute to the script and stylesheet tags in HTML
+	// entry points with a hash of the referenced output file using the given
+	// algorithm. Any existing "integrity" attribute on those tags is replaced.
+	Integrity Integrity
+
+	// Size limits for output files that are checked after each build. Each
+	// budget that is exceeded is reported as an error with the message ID
+	// "budget-max-bytes" or "budget-max-gzip-bytes", which can be changed to a
+	// warning using "LogOverride".
+	Budgets []Budget
+
+	// Writes precompressed copies of each output file next to it with a ".gz"
+	// and/or ".br" extension, for servers that can serve precompressed files.
+	// These are only generated when "Write" is true, and are only kept if they
+	// are smaller than the original file (an existing copy from an earlier
+	// build is deleted otherwise). They are included in "OutputFiles" and in
+	// the metafile like any other output file.
+	Compress Compress
+
+	// Writes a "manifest.json" file to the output directory that maps each
+	// entry point to its final output file, using the same format as Vite's
+	// build manifest. Each entry also lists its CSS files, the chunks that it
+	// imports statically and dynamically, and the assets that it references.
+	// This is useful for server-side templates when output file names contain
+	// hashes. Shared chunks are keyed by their file name with a "_" prefix.
+	Manifest bool
+
+	// Parse results are saved to this directory and reused by later builds,
+	// including builds in other processes. Entries are keyed by the contents of
+	// each file, the parser options, and the version of esbuild, so entries that
+	// are out of date are never used. The directory is created if necessary.
+	CacheDir string
+
+	// These files are read from memory instead of from the file system, which
+	// is useful for bundling unsaved buffers or generated sources. Keys are file
+	// paths, which are relative to "AbsWorkingDir" if they aren't absolute. Use
+	// "BuildContext.UpdateFiles" to change these files between builds.
+	Files     map[string]string
+	FilesMode FilesMode
+
+	// Resolves import paths using a browser import map before checking the
+	// "node_modules" directory. Either provide the path to the JSON file or its
+	// contents. Relative paths in the import map are relative to the directory
+	// containing it (or to "AbsWorkingDir" for the raw contents). Addresses
+	// that are URLs are marked as external, and import paths with a null
+	// address fail to resolve.
+	ImportMap    string
+	ImportMapRaw string
+
+	// Bundles "http://" and "https://" imports from a local directory instead
+	// of marking them as external. The directory must contain a "lock.json"
+	// file that maps each URL to the hexadecimal SHA-256 hash of its contents,
+	// and each file must be stored in the directory using its hash as the file
+	// name. The network is never accessed, so the directory must be populated
+	// ahead of time. Relative imports inside these files are resolved against
+	// their URL.
+	URLVendorDir string
+
+	// Records why each input file was included in each JavaScript output file.
+	// Each input in an output's "inputs" object in the metafile gets an extra
+	// "includedBecause" object with the shortest import chain from an entry
+	// point, the symbols that the previous file in the chain uses, and the
+	// symbols that survived tree shaking. This requires "Metafile" to be true.
+	MetafileExplain bool
+
 	EntryPoints         []string     // Documentation: https://esbuild.github.io/api/#entry-points
 	EntryPointsAdvanced []EntryPoint // Documentation: https://esbuild.github.io/api/#entry-points
 
@@ -358,11 +471,36 @@ type BuildOptions struct {
 	Plugins        []Plugin      // Documentation: https://esbuild.github.io/plugins/
 }
 
+type FilesMode uint8
+
+const (
+	// In-memory files take precedence over files on the file system
+	FilesOverlay FilesMode = iota
+
+	// Only in-memory files are visible. Output files are also written to memory
+	// instead of to the file system.
+	FilesOnly
+)
+
 type EntryPoint struct {
 	InputPath  string
 	OutputPath string
 }
 
+type Budget struct {
+	// A glob pattern that is matched against output paths relative to the
+	// output directory, such as "**/*.js". Both "*" and "**" are supported.
+	Path string
+
+	MaxBytes     int // The maximum size in bytes, or 0 for no limit
+	MaxGzipBytes int // The maximum size in bytes after gzip compression, or 0 for no limit
+
+	// If true, the budget only applies to entry points and each entry point's
+	// size includes the chunks that it statically imports (directly or
+	// indirectly), since those are always loaded together
+	IncludeStaticImports bool
+}
+
 type StdinOptions struct {
 	Contents   string
 	ResolveDir string
@@ -399,7 +537,8 @@ func Build(options BuildOptions) BuildResult {
 	// Print a summary of the generated files to stderr. Except don't do
 	// this if the terminal is already being used for something else.
 	if ctx.args.logOptions.LogLevel <= logger.LevelInfo && !ctx.args.options.WriteToStdout {
-		printSummary(ctx.args.logOptions.Color, result.OutputFiles, start)
+		hasCompressedFiles := ctx.args.options.CompressGzip || ctx.args.options.CompressBrotli
+		printSummary(ctx.args.logOptions.Color, result.OutputFiles, hasCompressedFiles, start)
 	}
 
 	ctx.Dispose()
@@ -460,6 +599,11 @@ type TransformOptions struct {
 
 	Sourcefile string // Documentation: https://esbuild.github.io/api/#sourcefile
 	Loader     Loader // Documentation: https://esbuild.github.io/api/#loader
+
+	// An optional source map for the input, which is used instead of any
+	// "sourceMappingURL" comment in the input. Note that this is unrelated to
+	// "Sourcemap", which controls the source map that's generated.
+	InputSourceMap string
 }
 
 type TransformResult struct {
@@ -478,6 +622,40 @@ func Transform(input string, options TransformOptions) TransformResult {
 	return transformImpl(input, options)
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// Parse API
+
+type ParseOptions struct {
+	Color       StderrColor         // Documentation: https://esbuild.github.io/api/#color
+	LogLevel    LogLevel            // Documentation: https://esbuild.github.io/api/#log-level
+	LogLimit    int                 // Documentation: https://esbuild.github.io/api/#log-limit
+	LogOverride map[string]LogLevel // Documentation: https://esbuild.github.io/api/#log-override
+
+	Sourcefile string // Documentation: https://esbuild.github.io/api/#sourcefile
+	Loader     Loader // Only "js", "jsx", "ts", and "tsx" are supported
+}
+
+type ParseResult struct {
+	Errors   []Message
+	Warnings []Message
+
+	// This is the syntax tree as ESTree JSON, or nil if there were errors
+	AST []byte
+}
+
+// This parses JavaScript, JSX, or TypeScript and returns the syntax tree in
+// the ESTree format (https://github.com/estree/estree). JSX nodes follow the
+// JSX extension to ESTree and TypeScript nodes follow "typescript-estree".
+// Each node has "start", "end", "loc", and "range" properties where offsets
+// and columns are in UTF-16 code units, like in JavaScript strings.
+//
+// Only syntax errors are reported since the code isn't transformed. Note that
+// esbuild's TypeScript parser skips over types instead of parsing them, so
+// type annotations and type-only declarations are not present in the output.
+func Parse(input string, options ParseOptions) ParseResult {
+	return parseImpl(input, options)
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // Context API
 
@@ -512,9 +690,28 @@ type ServeResult struct {
 	Hosts []string
 }
 
+type WatchBackend uint8
+
+const (
+	// Use the operating system's file change notifications when they are
+	// available (currently inotify on Linux) and polling otherwise
+	WatchBackendDefault WatchBackend = iota
+
+	// Always detect changes by polling the file system
+	WatchBackendPolling
+
+	// Prefer the operating system's file change notifications. This falls back
+	// to polling on platforms where they aren't supported. This currently
+	// behaves the same as "WatchBackendDefault" on every platform, including
+	// Linux. It exists so that the default can change in the future without
+	// affecting builds that explicitly ask for the native backend.
+	WatchBackendNative
+)
+
 // Documentation: https://esbuild.github.io/api/#watch-arguments
 type WatchOptions struct {
-	Delay int // In milliseconds
+	Delay   int // In milliseconds
+	Backend WatchBackend
 }
 
 type BuildContext interface {
@@ -527,6 +724,11 @@ type BuildContext interface {
 	// Documentation: https://esbuild.github.io/api/#serve
 	Serve(options ServeOptions) (ServeResult, error)
 
+	// This changes the in-memory files from "BuildOptions.Files". A nil value
+	// removes a file. Watch mode will rebuild if an affected file was used. This
+	// returns an error if the context wasn't created with in-memory files.
+	UpdateFiles(files map[string]*string) error
+
 	Cancel()
 	Dispose()
 }
@@ -585,6 +787,25 @@ type PluginBuild struct {
 	// Documentation: https://esbuild.github.io/plugins/#on-load
 	OnLoad func(options OnLoadOptions, callback func(OnLoadArgs) (OnLoadResult, error))
 
+	// This is called with the syntax tree of each matching JavaScript or CSS
+	// file after it has been parsed but before its imports are resolved. The
+	// callback can mutate the syntax tree in place. Use "js_ast.Visitor" or
+	// "css_ast.Visitor" to walk the tree and "js_ast.AST.NewTopLevelSymbol" to
+	// declare new top-level symbols. Symbol uses, top-level declarations, and
+	// "require()" and "import()" records in new code are picked up
+	// automatically, but new import and export statements are not supported.
+	OnParse func(options OnParseOptions, callback func(OnParseArgs) (OnParseResult, error))
+
+	// This is called with the final code of each JavaScript and CSS output file
+	// before it's written. Returning new code replaces the output file, and the
+	// optional returned source map (which maps from the returned code to the
+	// code that was passed in) is composed into the final source map. Content
+	// hashes in output file names are recomputed from the returned code, so
+	// the paths passed to this callback are the names from before that and may
+	// change afterward. References to other output files in the returned code
+	// are updated to use the new names as long as their file names are kept.
+	OnRenderChunk func(callback func(OnRenderChunkArgs) (OnRenderChunkResult, error))
+
 	// Documentation: https://esbuild.github.io/plugins/#on-dispose
 	OnDispose func(callback func())
 }
@@ -638,6 +859,9 @@ type OnResolveArgs struct {
 	Kind       ResolveKind
 	PluginData interface{}
 	With       map[string]string
+
+	// This is used by process plugins to stop waiting for canceled builds
+	didCancel func() bool
 }
 
 // Documentation: https://esbuild.github.io/plugins/#on-resolve-results
@@ -671,6 +895,9 @@ type OnLoadArgs struct {
 	Suffix     string
 	PluginData interface{}
 	With       map[string]string
+
+	// This is used by process plugins to stop waiting for canceled builds
+	didCancel func() bool
 }
 
 // Documentation: https://esbuild.github.io/plugins/#on-load-results
@@ -685,10 +912,64 @@ type OnLoadResult struct {
 	Loader     Loader
 	PluginData interface{}
 
+	// An optional source map for "Contents", which is used instead of any
+	// "sourceMappingURL" comment in "Contents"
+	SourceMap string
+
+	WatchFiles []string
+	WatchDirs  []string
+}
+
+type OnParseOptions struct {
+	Filter    string
+	Namespace string
+}
+
+// Exactly one of "JS" and "CSS" is non-nil
+type OnParseArgs struct {
+	Path       string
+	Namespace  string
+	Suffix     string
+	PluginData interface{}
+	Loader     Loader
+	JS         *js_ast.AST
+	CSS        *css_ast.AST
+}
+
+type OnParseResult struct {
+	PluginName string
+
+	Errors   []Message
+	Warnings []Message
+
 	WatchFiles []string
 	WatchDirs  []string
 }
 
+type OnRenderChunkArgs struct {
+	Path       string // This may change after the callback returns if it contains a hash
+	EntryPoint string // Empty if this output file isn't for an entry point
+	Code       []byte
+	SourceMap  []byte // Nil if source maps are disabled
+	Imports    []OnRenderChunkImport
+	Exports    []string
+}
+
+type OnRenderChunkImport struct {
+	Path string
+	Kind ResolveKind
+}
+
+type OnRenderChunkResult struct {
+	PluginName string
+
+	Errors   []Message
+	Warnings []Message
+
+	Code      []byte // The code is left unchanged if this is nil
+	SourceMap []byte // The source map loses its mappings if this is nil but "Code" isn't
+}
+
 type ResolveKind uint8
 
 const (
@@ -701,8 +982,29 @@ const (
 	ResolveCSSImportRule
 	ResolveCSSComposesFrom
 	ResolveCSSURLToken
+	ResolveJSNewURL
+	ResolveJSNewWorker
 )
 
+////////////////////////////////////////////////////////////////////////////////
+// Process plugin API
+
+type ProcessPluginOptions struct {
+	Name    string
+	Command string
+	Args    []string
+	Env     []string // Added to the current environment
+	Dir     string
+}
+
+// This returns a plugin that runs in a separate process, which lets plugins
+// be written in other languages. The process is started during plugin setup
+// and stopped when the build context is disposed. It communicates using
+// JSON-RPC over stdin and stdout. See "plugin_process.go" for the protocol.
+func ProcessPlugin(options ProcessPluginOptions) Plugin {
+	return processPluginImpl(options)
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // FormatMessages API
 
@@ -726,12 +1028,53 @@ func FormatMessages(msgs []Message, opts FormatMessagesOptions) []string {
 ////////////////////////////////////////////////////////////////////////////////
 // AnalyzeMetafile API
 
+type AnalyzeMetafileFormat uint8
+
+const (
+	AnalyzeMetafileText AnalyzeMetafileFormat = iota
+	AnalyzeMetafileHTML
+)
+
 type AnalyzeMetafileOptions struct {
 	Color   bool
 	Verbose bool
+
+	// The HTML format generates a self-contained page with an interactive
+	// treemap for each output file instead of a text table. The "Color" and
+	// "Verbose" options are ignored in this case.
+	Format AnalyzeMetafileFormat
 }
 
 // Documentation: https://esbuild.github.io/api/#analyze
 func AnalyzeMetafile(metafile string, opts AnalyzeMetafileOptions) string {
 	return analyzeMetafileImpl(metafile, opts)
 }
+
+////////////////////////////////////////////////////////////////////////////////
+// DiffMetafiles API
+
+type DiffMetafilesFormat uint8
+
+const (
+	DiffMetafilesText DiffMetafilesFormat = iota
+	DiffMetafilesJSON
+)
+
+type DiffMetafilesOptions struct {
+	Color bool
+
+	// The JSON format is meant for tools such as CI bots. The "Color" option is
+	// ignored in this case.
+	Format DiffMetafilesFormat
+}
+
+// This compares the metafiles from two builds of the same project. Output
+// files are matched up by entry point, then by path, and then by which input
+// files they have in common (since the hashes in their names may differ). The
+// result lists the size changes for each output file and each input file, the
+// input files and packages that were added or removed, and the input files
+// that moved to a different output file. It's empty if either metafile can't
+// be parsed.
+func DiffMetafiles(oldMetafile string, newMetafile string, opts DiffMetafilesOptions) string {
+	return diffMetafilesImpl(oldMetafile, newMetafile, opts)
+}
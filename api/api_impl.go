@@ -1,7 +1,7 @@
 package api
 
 // This file implements most of the API. This includes the "Build", "Transform",
-// "FormatMessages", and "AnalyzeMetafile" functions.
+// "Parse", "FormatMessages", and "AnalyzeMetafile" functions.
 
 import (
 	"bytes"
@@ -128,6 +128,10 @@ func validateFormat(value Format) config.Format {
 		return config.FormatCommonJS
 	case FormatESModule:
 		return config.FormatESModule
+	case FormatUMD:
+		return config.FormatUMD
+	case FormatSystem:
+		return config.FormatSystem
 	default:
 		panic("Invalid format")
 	}
@@ -173,6 +177,21 @@ func validateLegalComments(value LegalComments, bundle bool) config.LegalComment
 	}
 }
 
+func validateIntegrity(value Integrity) config.Integrity {
+	switch value {
+	case IntegrityNone:
+		return config.IntegrityNone
+	case IntegritySHA256:
+		return config.IntegritySHA256
+	case IntegritySHA384:
+		return config.IntegritySHA384
+	case IntegritySHA512:
+		return config.IntegritySHA512
+	default:
+		panic("Invalid integrity")
+	}
+}
+
 func validateColor(value StderrColor) logger.UseColor {
 	switch value {
 	case ColorIfTerminal:
@@ -230,13 +249,14 @@ func validateExternalPackages(value Packages) bool {
 func validateTreeShaking(value TreeShaking, bundle bool, format Format) bool {
 	switch value {
 	case TreeShakingDefault:
-		// If we're in an IIFE then there's no way to concatenate additional code
-		// to the end of our output so we assume tree shaking is safe. And when
-		// bundling we assume that tree shaking is safe because if you want to add
-		// code to the bundle, you should be doing that by including it in the
-		// bundle instead of concatenating it afterward, so we also assume tree
-		// shaking is safe then. Otherwise we assume tree shaking is not safe.
-		return bundle || format == FormatIIFE
+		// If we're in an IIFE or a UMD wrapper then there's no way to concatenate
+		// additional code to the end of our output so we assume tree shaking is
+		// safe. And when bundling we assume that tree shaking is safe because if
+		// you want to add code to the bundle, you should be doing that by
+		// including it in the bundle instead of concatenating it afterward, so we
+		// also assume tree shaking is safe then. Otherwise we assume tree shaking
+		// is not safe.
+		return bundle || format == FormatIIFE || format == FormatUMD
 	case TreeShakingFalse:
 		return false
 	case TreeShakingTrue:
@@ -266,6 +286,8 @@ func validateLoader(value Loader) config.Loader {
 		return config.LoaderFile
 	case LoaderGlobalCSS:
 		return config.LoaderGlobalCSS
+	case LoaderHTML:
+		return config.LoaderHTML
 	case LoaderJS:
 		return config.LoaderJS
 	case LoaderJSON:
@@ -287,6 +309,27 @@ func validateLoader(value Loader) config.Loader {
 	}
 }
 
+func loaderToPublic(value config.Loader) Loader {
+	switch value {
+	case config.LoaderJS:
+		return LoaderJS
+	case config.LoaderJSX:
+		return LoaderJSX
+	case config.LoaderTS, config.LoaderTSNoAmbiguousLessThan:
+		return LoaderTS
+	case config.LoaderTSX:
+		return LoaderTSX
+	case config.LoaderCSS:
+		return LoaderCSS
+	case config.LoaderGlobalCSS:
+		return LoaderGlobalCSS
+	case config.LoaderLocalCSS:
+		return LoaderLocalCSS
+	default:
+		return LoaderNone
+	}
+}
+
 func extractPathStyle(absPaths AbsPaths, flag AbsPaths) logger.PathStyle {
 	if (absPaths & flag) != 0 {
 		return logger.AbsPath
@@ -412,6 +455,23 @@ func validateGlobalName(log logger.Log, text string, path string) []string {
 	return nil
 }
 
+func validateUMDGlobals(log logger.Log, globals map[string]string) map[string][]string {
+	if len(globals) == 0 {
+		return nil
+	}
+	result := make(map[string][]string, len(globals))
+	for path, name := range globals {
+		if name == "" {
+			log.AddError(nil, logger.Range{}, fmt.Sprintf("Invalid UMD global name for %q: %q", path, name))
+			continue
+		}
+		if parts := validateGlobalName(log, name, "(UMD global name)"); parts != nil {
+			result[path] = parts
+		}
+	}
+	return result
+}
+
 func validateRegex(log logger.Log, what string, value string) *regexp.Regexp {
 	if value == "" {
 		return nil
@@ -460,6 +520,97 @@ func validateExternals(log logger.Log, fs fs.FS, paths []string) config.External
 	return result
 }
 
+func validateManualChunks(log logger.Log, fs fs.FS, manualChunks map[string][]string) []config.ManualChunk {
+	if len(manualChunks) == 0 {
+		return nil
+	}
+
+	// Sort the chunk names for determinism
+	names := make([]string, 0, len(manualChunks))
+	for name := range manualChunks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]config.ManualChunk, 0, len(names))
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, "/\\") {
+			log.AddError(nil, logger.Range{}, fmt.Sprintf("Invalid manual chunk name: %q", name))
+			continue
+		}
+		chunk := config.ManualChunk{Name: name, Exact: make(map[string]bool), Packages: make(map[string]bool)}
+		for _, path := range manualChunks[name] {
+			if isManualChunkPackageName(path) {
+				if index := strings.IndexByte(path, '*'); index != -1 {
+					if !strings.ContainsRune(path[index+1:], '*') {
+						chunk.PackagePatterns = append(chunk.PackagePatterns, config.WildcardPattern{Prefix: path[:index], Suffix: path[index+1:]})
+					}
+				} else {
+					chunk.Packages[path] = true
+				}
+			}
+			absPath := validatePath(log, fs, path, "manual chunk path")
+			if absPath == "" {
+				continue
+			}
+			if index := strings.IndexByte(absPath, '*'); index != -1 {
+				if strings.ContainsRune(absPath[index+1:], '*') {
+					log.AddError(nil, logger.Range{}, fmt.Sprintf("Manual chunk path %q cannot have more than one \"*\" wildcard", path))
+				} else {
+					chunk.Patterns = append(chunk.Patterns, config.WildcardPattern{Prefix: absPath[:index], Suffix: absPath[index+1:]})
+				}
+			} else {
+				chunk.Exact[absPath] = true
+			}
+		}
+		result = append(result, chunk)
+	}
+	return result
+}
+
+// Manual chunk patterns such as "react" and "@mui/*" also match packages by
+// name. Paths that start with "." or "/" or that have more slashes than a
+// package name can have are only matched against file paths.
+func isManualChunkPackageName(path string) bool {
+	if path == "" || path[0] == '.' || path[0] == '/' || strings.ContainsAny(path, "\\:") {
+		return false
+	}
+	slashes := strings.Count(path, "/")
+	if path[0] == '@' {
+		return slashes == 1
+	}
+	return slashes == 0
+}
+
+func validateBudgets(log logger.Log, budgets []Budget) []config.Budget {
+	if len(budgets) == 0 {
+		return nil
+	}
+
+	result := make([]config.Budget, 0, len(budgets))
+	for _, budget := range budgets {
+		if budget.Path == "" {
+			log.AddError(nil, logger.Range{}, "Budgets must have a path")
+			continue
+		}
+		if budget.MaxBytes < 0 || budget.MaxGzipBytes < 0 {
+			log.AddError(nil, logger.Range{}, fmt.Sprintf("Invalid size limit for budget %q", budget.Path))
+			continue
+		}
+		if budget.MaxBytes == 0 && budget.MaxGzipBytes == 0 {
+			log.AddError(nil, logger.Range{}, fmt.Sprintf("Budget %q must have a size limit", budget.Path))
+			continue
+		}
+		result = append(result, config.Budget{
+			Pattern:              helpers.ParseGlobPattern(strings.ReplaceAll(budget.Path, "\\", "/")),
+			MaxBytes:             budget.MaxBytes,
+			MaxGzipBytes:         budget.MaxGzipBytes,
+			IncludeStaticImports: budget.IncludeStaticImports,
+		})
+	}
+	return result
+}
+
 func validateAlias(log logger.Log, fs fs.FS, alias map[string]string) map[string]string {
 	valid := make(map[string]string, len(alias))
 
@@ -710,6 +861,11 @@ func validateLogOverrides(input map[string]LogLevel) (output map[logger.MsgID]lo
 	return
 }
 
+// This is stored in the persistent build cache. It must be kept in sync with
+// "version.txt" since the cache entries are not compatible across versions
+// (there's a test that checks this).
+const esbuildVersion = "0.28.1"
+
 func validatePath(log logger.Log, fs fs.FS, relPath string, pathKind string) string {
 	if relPath == "" {
 		return ""
@@ -909,12 +1065,32 @@ func contextImpl(buildOpts BuildOptions) (*internalContext, []Message) {
 	// validation that we just did above.
 	caches := cache.MakeCacheSet()
 	log := logger.NewDeferLog(logger.DeferLogNoVerboseOrDebug, logOptions.Overrides)
-	onEndCallbacks, onDisposeCallbacks, finalizeBuildOptions := loadPlugins(&buildOpts, realFS, log, caches)
-	options, entryPoints := validateBuildOptions(buildOpts, log, realFS)
+
+	// Layer the in-memory files on top of the real file system. The real file
+	// system is kept as-is for the context since it's long-lived and must not
+	// cache the in-memory files.
+	var memoryFiles *fs.MemoryFiles
+	buildFS := realFS
+	if buildOpts.Files != nil || buildOpts.FilesMode == FilesOnly {
+		files := make(map[string]string, len(buildOpts.Files))
+		for path, contents := range buildOpts.Files {
+			if absPath := validatePath(log, realFS, path, "in-memory file path"); absPath != "" {
+				files[absPath] = contents
+			}
+		}
+		memoryFiles = fs.NewMemoryFiles(files)
+		buildFS = fs.MemoryFS(realFS, memoryFiles, buildOpts.FilesMode != FilesOnly)
+	}
+
+	onEndCallbacks, onDisposeCallbacks, finalizeBuildOptions := loadPlugins(&buildOpts, buildFS, log, caches)
+	options, entryPoints := validateBuildOptions(buildOpts, log, buildFS)
 	finalizeBuildOptions(&options)
 	if buildOpts.AbsWorkingDir != absWorkingDir {
 		panic("Mutating \"AbsWorkingDir\" is not allowed")
 	}
+	if cacheDir := validatePath(log, realFS, buildOpts.CacheDir, "cache directory"); cacheDir != "" {
+		caches.EnableDiskCache(cacheDir, esbuildVersion)
+	}
 
 	// If we have errors already, then refuse to build any further. This only
 	// happens when the build options themselves contain validation errors.
@@ -945,6 +1121,8 @@ func contextImpl(buildOpts BuildOptions) (*internalContext, []Message) {
 		mangleCache:        buildOpts.MangleCache,
 		absWorkingDir:      absWorkingDir,
 		write:              buildOpts.Write,
+		memoryFiles:        memoryFiles,
+		memoryOnly:         buildOpts.FilesMode == FilesOnly,
 	}
 
 	return &internalContext{
@@ -975,6 +1153,10 @@ type internalContext struct {
 	// between two sets of output files. That way we don't need to hold both
 	// sets of output files in memory at once to compute a diff.
 	latestHashes map[string]string
+
+	// This is the state of each module in the most recent successful build when
+	// hot module replacement is enabled. It's used to find the changed modules.
+	latestHotModules map[string]bundler.HotModule
 }
 
 func (ctx *internalContext) rebuild() rebuildState {
@@ -1001,6 +1183,7 @@ func (ctx *internalContext) rebuild() rebuildState {
 	watcher := ctx.watcher
 	handler := ctx.handler
 	oldHashes := ctx.latestHashes
+	oldHotModules := ctx.latestHotModules
 	args.options.CancelFlag = &build.cancel
 	ctx.mutex.Unlock()
 
@@ -1008,6 +1191,9 @@ func (ctx *internalContext) rebuild() rebuildState {
 	var newHashes map[string]string
 	build.state, newHashes = rebuildImpl(args, oldHashes)
 	if handler != nil {
+		if update := hotUpdateJSON(args, oldHotModules, build.state.hotModules); update != "" {
+			handler.broadcastHotUpdate(update)
+		}
 		handler.broadcastBuildResult(build.state.result, newHashes)
 	}
 	if watcher != nil {
@@ -1020,6 +1206,9 @@ func (ctx *internalContext) rebuild() rebuildState {
 	ctx.activeBuild = nil
 	ctx.recentBuild = recentBuild
 	ctx.latestHashes = newHashes
+	if build.state.hotModules != nil {
+		ctx.latestHotModules = build.state.hotModules
+	}
 	ctx.mutex.Unlock()
 
 	// Clear the recent build after it goes stale
@@ -1095,6 +1284,9 @@ func (ctx *internalContext) Watch(options WatchOptions) error {
 		},
 		delayInMS: time.Duration(options.Delay),
 	}
+	if options.Backend != WatchBackendPolling {
+		ctx.watcher.native = newNativeWatcher()
+	}
 
 	// All subsequent builds will be watch mode builds
 	ctx.args.options.WatchMode = true
@@ -1122,6 +1314,46 @@ func (ctx *internalContext) Watch(options WatchOptions) error {
 	return nil
 }
 
+func (ctx *internalContext) UpdateFiles(files map[string]*string) error {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+
+	// Ignore disposed contexts
+	if ctx.didDispose {
+		return errors.New("Cannot update files for a disposed context")
+	}
+
+	memoryFiles := ctx.args.memoryFiles
+	if memoryFiles == nil {
+		return errors.New("Cannot update files for a context without \"Files\"")
+	}
+
+	// Validate all paths first so that nothing is changed if there's an error
+	absPaths := make([]string, 0, len(files))
+	contents := make([]*string, 0, len(files))
+	for path, value := range files {
+		absPath, ok := ctx.realFS.Abs(path)
+		if !ok {
+			return fmt.Errorf("Invalid in-memory file path: %s", path)
+		}
+		absPaths = append(absPaths, absPath)
+		contents = append(contents, value)
+	}
+	for i, absPath := range absPaths {
+		if contents[i] != nil {
+			memoryFiles.Set(absPath, *contents[i])
+		} else {
+			memoryFiles.Remove(absPath)
+		}
+	}
+
+	// There are no file system events for in-memory files, so tell the watcher
+	if ctx.watcher != nil {
+		ctx.watcher.checkPathsSoon(absPaths)
+	}
+	return nil
+}
+
 func (ctx *internalContext) Cancel() {
 	ctx.mutex.Lock()
 
@@ -1191,29 +1423,51 @@ func prettyPrintByteCount(n int) string {
 	return size
 }
 
-func printSummary(color logger.UseColor, outputFiles []OutputFile, start time.Time) {
+func printSummary(color logger.UseColor, outputFiles []OutputFile, hasCompressedFiles bool, start time.Time) {
 	if len(outputFiles) == 0 {
 		return
 	}
 
-	var table logger.SummaryTable = make([]logger.SummaryTableEntry, len(outputFiles))
+	// Precompressed files are shown next to the file they were generated from
+	// instead of on separate rows
+	compressedSizes := make(map[string]string)
+	if hasCompressedFiles {
+		paths := make(map[string]bool, len(outputFiles))
+		for _, file := range outputFiles {
+			paths[file.Path] = true
+		}
+		for _, file := range outputFiles {
+			for _, ext := range []string{".gz", ".br"} {
+				if original := strings.TrimSuffix(file.Path, ext); original != file.Path && paths[original] {
+					compressedSizes[file.Path] = prettyPrintByteCount(len(file.Contents))
+				}
+			}
+		}
+	}
+
+	var table logger.SummaryTable = make([]logger.SummaryTableEntry, 0, len(outputFiles))
 
 	if cwd, err := os.Getwd(); err == nil {
 		if realFS, err := fs.RealFS(fs.RealFSOptions{AbsWorkingDir: cwd}); err == nil {
-			for i, file := range outputFiles {
+			for _, file := range outputFiles {
+				if _, ok := compressedSizes[file.Path]; ok {
+					continue
+				}
 				path, ok := realFS.Rel(realFS.Cwd(), file.Path)
 				if !ok {
 					path = file.Path
 				}
 				base := realFS.Base(path)
 				n := len(file.Contents)
-				table[i] = logger.SummaryTableEntry{
+				table = append(table, logger.SummaryTableEntry{
 					Dir:         path[:len(path)-len(base)],
 					Base:        base,
 					Size:        prettyPrintByteCount(n),
 					Bytes:       n,
 					IsSourceMap: strings.HasSuffix(base, ".map"),
-				}
+					GzipSize:    compressedSizes[file.Path+".gz"],
+					BrotliSize:  compressedSizes[file.Path+".br"],
+				})
 			}
 		}
 	}
@@ -1285,15 +1539,25 @@ func validateBuildOptions(
 		IgnoreDCEAnnotations:  buildOpts.IgnoreAnnotations,
 		TreeShaking:           validateTreeShaking(buildOpts.TreeShaking, buildOpts.Bundle, buildOpts.Format),
 		GlobalName:            validateGlobalName(log, buildOpts.GlobalName, "(global name)"),
+		UMDGlobals:            validateUMDGlobals(log, buildOpts.UMDGlobals),
 		CodeSplitting:         buildOpts.Splitting,
 		OutputFormat:          validateFormat(buildOpts.Format),
 		AbsOutputFile:         validatePath(log, realFS, buildOpts.Outfile, "outfile path"),
 		AbsOutputDir:          validatePath(log, realFS, buildOpts.Outdir, "outdir path"),
 		AbsOutputBase:         validatePath(log, realFS, buildOpts.Outbase, "outbase path"),
 		NeedsMetafile:         buildOpts.Metafile,
+		MetafileExplain:       buildOpts.Metafile && buildOpts.MetafileExplain,
 		EntryPathTemplate:     validatePathTemplate(buildOpts.EntryNames),
 		ChunkPathTemplate:     validatePathTemplate(buildOpts.ChunkNames),
 		AssetPathTemplate:     validatePathTemplate(buildOpts.AssetNames),
+		ManualChunks:          validateManualChunks(log, realFS, buildOpts.ManualChunks),
+		MinChunkSize:          buildOpts.MinChunkSize,
+		HotModuleReplacement:  buildOpts.HMR,
+		Integrity:             validateIntegrity(buildOpts.Integrity),
+		Budgets:               validateBudgets(log, buildOpts.Budgets),
+		CompressGzip:          buildOpts.Write && (buildOpts.Compress&CompressGzip) != 0,
+		CompressBrotli:        buildOpts.Write && (buildOpts.Compress&CompressBrotli) != 0,
+		NeedsManifest:         buildOpts.Manifest,
 		OutputExtensionJS:     outJS,
 		OutputExtensionCSS:    outCSS,
 		ExtensionToLoader:     validateLoaders(log, buildOpts.Loader),
@@ -1303,6 +1567,9 @@ func validateBuildOptions(
 		PackageAliases:        validateAlias(log, realFS, buildOpts.Alias),
 		TSConfigPath:          validatePath(log, realFS, buildOpts.Tsconfig, "tsconfig path"),
 		TSConfigRaw:           buildOpts.TsconfigRaw,
+		ImportMapPath:         validatePath(log, realFS, buildOpts.ImportMap, "import map path"),
+		ImportMapRaw:          buildOpts.ImportMapRaw,
+		URLVendorDir:          validatePath(log, realFS, buildOpts.URLVendorDir, "URL vendor directory"),
 		MainFields:            buildOpts.MainFields,
 		PublicPath:            buildOpts.PublicPath,
 		KeepNames:             buildOpts.KeepNames,
@@ -1373,6 +1640,12 @@ func validateBuildOptions(
 		if options.LegalComments.HasExternalFile() {
 			log.AddError(nil, logger.Range{}, "Cannot use linked or external legal comments without an output path")
 		}
+		if options.CompressGzip || options.CompressBrotli {
+			log.AddError(nil, logger.Range{}, "Cannot use \"compress\" without an output path")
+		}
+		if options.NeedsManifest {
+			log.AddError(nil, logger.Range{}, "Cannot use \"manifest\" without an output path")
+		}
 		for _, loader := range options.ExtensionToLoader {
 			if loader == config.LoaderFile {
 				log.AddError(nil, logger.Range{}, "Cannot use the \"file\" loader without an output path")
@@ -1397,6 +1670,9 @@ func validateBuildOptions(
 		if len(options.PackageAliases) > 0 {
 			log.AddError(nil, logger.Range{}, "Cannot use \"alias\" without \"bundle\"")
 		}
+		if options.HotModuleReplacement {
+			log.AddError(nil, logger.Range{}, "Cannot use \"hmr\" without \"bundle\"")
+		}
 	} else if options.OutputFormat == config.FormatPreserve {
 		// If the format isn't specified, set the default format using the platform
 		switch options.Platform {
@@ -1422,14 +1698,27 @@ func validateBuildOptions(
 	}
 
 	// Code splitting is experimental and currently only enabled for ES6 modules
-	if options.CodeSplitting && options.OutputFormat != config.FormatESModule {
-		log.AddError(nil, logger.Range{}, "Splitting currently only works with the \"esm\" format")
+	if options.CodeSplitting && !options.OutputFormat.IsESMCompatible() {
+		log.AddError(nil, logger.Range{}, "Splitting currently only works with the \"esm\" and \"system\" formats")
+	}
+
+	// These are only meaningful when there can be more than one chunk
+	if len(options.ManualChunks) > 0 && !options.CodeSplitting {
+		log.AddError(nil, logger.Range{}, "Cannot use \"manualChunks\" without \"splitting\"")
+	}
+	if options.MinChunkSize < 0 {
+		log.AddError(nil, logger.Range{}, fmt.Sprintf("Invalid minimum chunk size: %d", options.MinChunkSize))
+	} else if options.MinChunkSize > 0 && !options.CodeSplitting {
+		log.AddError(nil, logger.Range{}, "Cannot use \"minChunkSize\" without \"splitting\"")
 	}
 
 	// Code splitting is experimental and currently only enabled for ES6 modules
 	if options.TSConfigPath != "" && options.TSConfigRaw != "" {
 		log.AddError(nil, logger.Range{}, "Cannot provide \"tsconfig\" as both a raw string and a path")
 	}
+	if options.ImportMapPath != "" && options.ImportMapRaw != "" {
+		log.AddError(nil, logger.Range{}, "Cannot provide \"importMap\" as both a raw string and a path")
+	}
 
 	// If we aren't writing the output to the file system, then we can allow the
 	// output paths to be the same as the input paths. This helps when serving.
@@ -1456,12 +1745,26 @@ type rebuildArgs struct {
 	mangleCache        map[string]interface{}
 	absWorkingDir      string
 	write              bool
+
+	// This is non-nil if there are in-memory files
+	memoryFiles *fs.MemoryFiles
+	memoryOnly  bool
+}
+
+// This returns the file system for a single build, which includes the
+// in-memory files (if any) as they were when the build started
+func (args *rebuildArgs) buildFS(realFS fs.FS) fs.FS {
+	if args.memoryFiles != nil {
+		return fs.MemoryFS(realFS, args.memoryFiles, !args.memoryOnly)
+	}
+	return realFS
 }
 
 type rebuildState struct {
-	result    BuildResult
-	watchData fs.WatchData
-	options   config.Options
+	result     BuildResult
+	watchData  fs.WatchData
+	options    config.Options
+	hotModules map[string]bundler.HotModule
 }
 
 func rebuildImpl(args rebuildArgs, oldHashes map[string]string) (rebuildState, map[string]string) {
@@ -1481,10 +1784,12 @@ func rebuildImpl(args rebuildArgs, oldHashes map[string]string) (rebuildState, m
 		// This should already have been checked by the caller
 		panic(err.Error())
 	}
+	realFS = args.buildFS(realFS)
 
 	var result BuildResult
 	var watchData fs.WatchData
 	var toWriteToStdout []byte
+	var hotModules map[string]bundler.HotModule
 
 	var timer *helpers.Timer
 	if api_helpers.UseTimer {
@@ -1515,6 +1820,9 @@ func rebuildImpl(args rebuildArgs, oldHashes map[string]string) (rebuildState, m
 		// Stop now if there were errors
 		if !log.HasErrors() {
 			result.Metafile = metafile
+			if args.options.HotModuleReplacement {
+				hotModules = bundle.HotModules()
+			}
 		}
 	}
 
@@ -1554,6 +1862,16 @@ func rebuildImpl(args rebuildArgs, oldHashes map[string]string) (rebuildState, m
 				// Print this later on, at the end of the current function
 				toWriteToStdout = results[0].Contents
 			}
+		} else if args.memoryOnly {
+			// Write output files to memory when only in-memory files are visible
+			for absPath := range oldHashes {
+				if _, ok := newHashes[absPath]; !ok {
+					args.memoryFiles.Remove(absPath)
+				}
+			}
+			for _, result := range results {
+				args.memoryFiles.Set(result.AbsPath, string(result.Contents))
+			}
 		} else {
 			// Delete old files that are no longer relevant
 			var toDelete []string
@@ -1563,6 +1881,46 @@ func rebuildImpl(args rebuildArgs, oldHashes map[string]string) (rebuildState, m
 				}
 			}
 
+			// Precompressed copies are omitted when they aren't smaller than the
+			// original file, so also delete any copies left over from an earlier
+			// build (possibly in another process) to avoid serving stale contents
+			if args.options.CompressGzip || args.options.CompressBrotli {
+				var exts []string
+				if args.options.CompressGzip {
+					exts = append(exts, ".gz")
+				}
+				if args.options.CompressBrotli {
+					exts = append(exts, ".br")
+				}
+				isCompressedCopy := func(absPath string) bool {
+					for _, ext := range exts {
+						if strings.HasSuffix(absPath, ext) {
+							if _, ok := newHashes[strings.TrimSuffix(absPath, ext)]; ok {
+								return true
+							}
+						}
+					}
+					return false
+				}
+				for _, result := range results {
+					if isCompressedCopy(result.AbsPath) {
+						continue
+					}
+					for _, ext := range exts {
+						absPath := result.AbsPath + ext
+						if _, ok := newHashes[absPath]; ok {
+							continue
+						}
+						if _, ok := oldHashes[absPath]; ok {
+							continue // This is already in "toDelete"
+						}
+						if _, err := os.Stat(absPath); err == nil {
+							toDelete = append(toDelete, absPath)
+						}
+					}
+				}
+			}
+
 			// Process all file operations in parallel
 			waitGroup := sync.WaitGroup{}
 			waitGroup.Add(len(results) + len(toDelete))
@@ -1675,9 +2033,10 @@ func rebuildImpl(args rebuildArgs, oldHashes map[string]string) (rebuildState, m
 	}
 
 	return rebuildState{
-		result:    result,
-		options:   args.options,
-		watchData: watchData,
+		result:     result,
+		options:    args.options,
+		watchData:  watchData,
+		hotModules: hotModules,
 	}, newHashes
 }
 
@@ -1758,6 +2117,7 @@ func transformImpl(input string, transformOpts TransformOptions) TransformResult
 			Loader:     validateLoader(transformOpts.Loader),
 			Contents:   input,
 			SourceFile: transformOpts.Sourcefile,
+			SourceMap:  transformOpts.InputSourceMap,
 		},
 	}
 	validateKeepNames(log, &options)
@@ -1851,6 +2211,64 @@ func transformImpl(input string, transformOpts TransformOptions) TransformResult
 	}
 }
 
+////////////////////////////////////////////////////////////////////////////////
+// Parse API
+
+func parseImpl(input string, parseOpts ParseOptions) ParseResult {
+	log := logger.NewStderrLog(logger.OutputOptions{
+		IncludeSource: true,
+		MessageLimit:  parseOpts.LogLimit,
+		Color:         validateColor(parseOpts.Color),
+		LogLevel:      validateLogLevel(parseOpts.LogLevel),
+		Overrides:     validateLogOverrides(parseOpts.LogOverride),
+	})
+
+	// Apply default values
+	if parseOpts.Sourcefile == "" {
+		parseOpts.Sourcefile = "<stdin>"
+	}
+	if parseOpts.Loader == LoaderNone {
+		parseOpts.Loader = LoaderJS
+	}
+
+	// Only loaders that use the JavaScript parser can be used
+	options := config.Options{}
+	switch loader := validateLoader(parseOpts.Loader); loader {
+	case config.LoaderJS:
+	case config.LoaderJSX:
+		options.JSX.Parse = true
+	case config.LoaderTS, config.LoaderTSNoAmbiguousLessThan:
+		options.TS.Parse = true
+		options.TS.NoAmbiguousLessThan = loader == config.LoaderTSNoAmbiguousLessThan
+	case config.LoaderTSX:
+		options.TS.Parse = true
+		options.JSX.Parse = true
+	default:
+		log.AddError(nil, logger.Range{}, fmt.Sprintf("Cannot parse with the %q loader", config.LoaderToString[loader]))
+	}
+
+	var ast []byte
+	if !log.HasErrors() {
+		source := logger.Source{
+			KeyPath:     logger.Path{Text: parseOpts.Sourcefile},
+			PrettyPaths: logger.PrettyPaths{Abs: parseOpts.Sourcefile, Rel: parseOpts.Sourcefile},
+			Contents:    input,
+		}
+		var ok bool
+		ast, ok = js_parser.ParseESTree(log, source, js_parser.OptionsFromConfig(&options))
+		if !ok || log.HasErrors() {
+			ast = nil
+		}
+	}
+
+	msgs := log.Done()
+	return ParseResult{
+		Errors:   convertMessagesToPublic(logger.Error, msgs, logger.RelPath),
+		Warnings: convertMessagesToPublic(logger.Warning, msgs, logger.RelPath),
+		AST:      ast,
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // Plugin API
 
@@ -1896,6 +2314,10 @@ func importKindToResolveKind(kind ast.ImportKind) ResolveKind {
 		return ResolveCSSComposesFrom
 	case ast.ImportURL:
 		return ResolveCSSURLToken
+	case ast.ImportNewURL:
+		return ResolveJSNewURL
+	case ast.ImportNewWorker:
+		return ResolveJSNewWorker
 	default:
 		panic("Internal error")
 	}
@@ -1919,6 +2341,10 @@ func resolveKindToImportKind(kind ResolveKind) ast.ImportKind {
 		return ast.ImportComposesFrom
 	case ResolveCSSURLToken:
 		return ast.ImportURL
+	case ResolveJSNewURL:
+		return ast.ImportNewURL
+	case ResolveJSNewWorker:
+		return ast.ImportNewWorker
 	default:
 		panic("Internal error")
 	}
@@ -1944,6 +2370,7 @@ func (impl *pluginImpl) onResolve(options OnResolveOptions, callback func(OnReso
 				Kind:       importKindToResolveKind(args.Kind),
 				PluginData: args.PluginData,
 				With:       args.With.DecodeIntoMap(),
+				didCancel:  args.CancelFlag.DidCancel,
 			})
 			result.PluginName = response.PluginName
 			result.AbsWatchFiles = impl.validatePathsArray(response.WatchFiles, "watch file")
@@ -2019,6 +2446,7 @@ func (impl *pluginImpl) onLoad(options OnLoadOptions, callback func(OnLoadArgs)
 				PluginData: args.PluginData,
 				Suffix:     args.Path.IgnoredSuffix,
 				With:       args.Path.ImportAttributes.DecodeIntoMap(),
+				didCancel:  args.CancelFlag.DidCancel,
 			})
 			result.PluginName = response.PluginName
 			result.AbsWatchFiles = impl.validatePathsArray(response.WatchFiles, "watch file")
@@ -2030,6 +2458,7 @@ func (impl *pluginImpl) onLoad(options OnLoadOptions, callback func(OnLoadArgs)
 			}
 
 			result.Contents = response.Contents
+			result.SourceMap = response.SourceMap
 			result.Loader = validateLoader(response.Loader)
 			result.PluginData = response.PluginData
 			pathKind := fmt.Sprintf("resolve directory path for plugin %q", impl.plugin.Name)
@@ -2044,6 +2473,82 @@ func (impl *pluginImpl) onLoad(options OnLoadOptions, callback func(OnLoadArgs)
 	})
 }
 
+func (impl *pluginImpl) onParse(options OnParseOptions, callback func(OnParseArgs) (OnParseResult, error)) {
+	filter, err := config.CompileFilterForPlugin(impl.plugin.Name, "OnParse", options.Filter)
+	if filter == nil {
+		impl.log.AddError(nil, logger.Range{}, err.Error())
+		return
+	}
+
+	impl.plugin.OnParse = append(impl.plugin.OnParse, config.OnParse{
+		Filter:    filter,
+		Namespace: options.Namespace,
+		Callback: func(args config.OnParseArgs) (result config.OnParseResult) {
+			response, err := callback(OnParseArgs{
+				Path:       args.Path.Text,
+				Namespace:  args.Path.Namespace,
+				Suffix:     args.Path.IgnoredSuffix,
+				PluginData: args.PluginData,
+				Loader:     loaderToPublic(args.Loader),
+				JS:         args.JSAST,
+				CSS:        args.CSSAST,
+			})
+			result.PluginName = response.PluginName
+			result.AbsWatchFiles = impl.validatePathsArray(response.WatchFiles, "watch file")
+			result.AbsWatchDirs = impl.validatePathsArray(response.WatchDirs, "watch directory")
+
+			if err != nil {
+				result.ThrownError = err
+				return
+			}
+
+			// Convert log messages
+			result.Msgs = convertErrorsAndWarningsToInternal(response.Errors, response.Warnings)
+			return
+		},
+	})
+}
+
+func (impl *pluginImpl) onRenderChunk(callback func(OnRenderChunkArgs) (OnRenderChunkResult, error)) {
+	impl.plugin.OnRenderChunk = append(impl.plugin.OnRenderChunk, config.OnRenderChunk{
+		Name: impl.plugin.Name,
+		Callback: func(args config.OnRenderChunkArgs) (result config.OnRenderChunkResult) {
+			var entryPoint string
+			if args.EntryPoint != nil {
+				entryPoint = args.EntryPoint.Text
+			}
+			imports := make([]OnRenderChunkImport, len(args.Imports))
+			for i, item := range args.Imports {
+				imports[i] = OnRenderChunkImport{
+					Path: item.AbsPath,
+					Kind: importKindToResolveKind(item.Kind),
+				}
+			}
+			response, err := callback(OnRenderChunkArgs{
+				Path:       args.AbsPath,
+				EntryPoint: entryPoint,
+				Code:       args.Code,
+				SourceMap:  args.SourceMap,
+				Imports:    imports,
+				Exports:    args.Exports,
+			})
+			result.PluginName = response.PluginName
+
+			if err != nil {
+				result.ThrownError = err
+				return
+			}
+
+			result.Code = response.Code
+			result.SourceMap = response.SourceMap
+
+			// Convert log messages
+			result.Msgs = convertErrorsAndWarningsToInternal(response.Errors, response.Warnings)
+			return
+		},
+	})
+}
+
 func (impl *pluginImpl) validatePathsArray(pathsIn []string, name string) (pathsOut []string) {
 	if len(pathsIn) > 0 {
 		pathKind := fmt.Sprintf("%s path for plugin %q", name, impl.plugin.Name)
@@ -2127,6 +2632,7 @@ func loadPlugins(initialOptions *BuildOptions, fs fs.FS, log logger.Log, caches
 				kind,
 				absResolveDir,
 				options.PluginData,
+				optionsClone.CancelFlag,
 				optionsClone.LogPathStyle,
 			)
 			msgs := log.Done()
@@ -2177,6 +2683,8 @@ func loadPlugins(initialOptions *BuildOptions, fs fs.FS, log logger.Log, caches
 			OnDispose:      onDispose,
 			OnResolve:      impl.onResolve,
 			OnLoad:         impl.onLoad,
+			OnParse:        impl.onParse,
+			OnRenderChunk:  impl.onRenderChunk,
 		})
 
 		plugins = append(plugins, impl.plugin)
@@ -2213,10 +2721,11 @@ func formatMsgsImpl(msgs []Message, opts FormatMessagesOptions) []string {
 // AnalyzeMetafile API
 
 type metafileEntry struct {
-	name       string
-	entryPoint string
-	entries    []metafileEntry
-	size       int
+	name            string
+	entryPoint      string
+	includedBecause string
+	entries         []metafileEntry
+	size            int
 }
 
 // This type is just so we can use Go's native sort function
@@ -2262,11 +2771,47 @@ func getObjectPropertyArray(expr js_ast.Expr, key string) *js_ast.EArray {
 	return value
 }
 
+// This formats the "includedBecause" data from "MetafileExplain" like this:
+// "included because entry.js → a.js uses `foo`". The chain in the metafile
+// ends with the file itself, which is omitted here since it's implied.
+func describeInclusionReason(expr js_ast.Expr) string {
+	chainArray := getObjectPropertyArray(expr, "chain")
+	if chainArray == nil {
+		return ""
+	}
+	var chain []string
+	for _, item := range chainArray.Items {
+		if str, ok := item.Data.(*js_ast.EString); ok {
+			chain = append(chain, helpers.UTF16ToString(str.Value))
+		}
+	}
+	if len(chain) < 2 {
+		return "included because it's an entry point"
+	}
+	var uses []string
+	if usesArray := getObjectPropertyArray(expr, "uses"); usesArray != nil {
+		for _, item := range usesArray.Items {
+			if str, ok := item.Data.(*js_ast.EString); ok {
+				uses = append(uses, "`"+helpers.UTF16ToString(str.Value)+"`")
+			}
+		}
+	}
+	text := "included because " + strings.Join(chain[:len(chain)-1], " → ")
+	if len(uses) > 0 {
+		return text + " uses " + strings.Join(uses, ", ")
+	}
+	return text + " imports it for its side effects"
+}
+
 func analyzeMetafileImpl(metafile string, opts AnalyzeMetafileOptions) string {
 	log := logger.NewDeferLog(logger.DeferLogNoVerboseOrDebug, nil)
 	source := logger.Source{Contents: metafile}
 
 	if result, ok := js_parser.ParseJSON(log, source, js_parser.JSONOptions{}); ok {
+		if opts.Format == AnalyzeMetafileHTML {
+			return analyzeMetafileHTML(result)
+		}
+
 		if outputs := getObjectPropertyObject(result, "outputs"); outputs != nil {
 			var entries metafileArray
 			var entryPoints []string
@@ -2287,8 +2832,9 @@ func analyzeMetafileImpl(metafile string, opts AnalyzeMetafileOptions) string {
 							for _, input := range inputs.Properties {
 								if bytesInOutput := getObjectPropertyNumber(input.ValueOrNil, "bytesInOutput"); bytesInOutput != nil && bytesInOutput.Value > 0 {
 									children = append(children, metafileEntry{
-										name: helpers.UTF16ToString(input.Key.Data.(*js_ast.EString).Value),
-										size: int(bytesInOutput.Value),
+										name:            helpers.UTF16ToString(input.Key.Data.(*js_ast.EString).Value),
+										size:            int(bytesInOutput.Value),
+										includedBecause: describeInclusionReason(getObjectProperty(input.ValueOrNil, "includedBecause")),
 									})
 								}
 							}
@@ -2441,6 +2987,15 @@ func analyzeMetafileImpl(metafile string, opts AnalyzeMetafileOptions) string {
 						if j+1 == len(entry.entries) {
 							indent = "   "
 						}
+
+						// Prefer the reason recorded by the linker if there is one
+						if child.includedBecause != "" {
+							table = append(table, tableEntry{
+								first: fmt.Sprintf("%s%s └ %s%s", indent, colors.Dim, child.includedBecause, colors.Reset),
+							})
+							continue
+						}
+
 						data := graph[child.name]
 						depth := 0
 
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompressDeletesStaleCopies(t *testing.T) {
+	dir := makeFilesTestDir(t, map[string]string{
+		"big.js":          strings.Repeat("console.log('this should be compressed')\n", 100),
+		"small.js":        "x()",
+		"out/big.js.gz":   "stale",
+		"out/small.js.gz": "stale",
+		"out/small.js.br": "stale",
+	})
+	defer os.RemoveAll(dir)
+
+	result := Build(BuildOptions{
+		AbsWorkingDir: dir,
+		EntryPoints:   []string{"big.js", "small.js"},
+		Outdir:        "out",
+		Write:         true,
+		Compress:      CompressGzip | CompressBrotli,
+		LogLevel:      LogLevelSilent,
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %+v", result.Errors)
+	}
+
+	// Copies that are smaller than the original are overwritten
+	for _, name := range []string{"big.js.gz", "big.js.br"} {
+		contents, err := ioutil.ReadFile(filepath.Join(dir, "out", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) == "stale" {
+			t.Fatalf("Expected %q to be overwritten", name)
+		}
+	}
+
+	// Copies that aren't smaller than the original are deleted
+	for _, name := range []string{"small.js.gz", "small.js.br"} {
+		if _, err := os.Stat(filepath.Join(dir, "out", name)); !os.IsNotExist(err) {
+			t.Fatalf("Expected %q to be deleted", name)
+		}
+	}
+}
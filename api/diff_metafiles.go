@@ -0,0 +1,606 @@
+package api
+
+// This file implements "DiffMetafiles", which compares the metafiles from two
+// builds. Output file names usually contain content hashes, so output files
+// can't just be compared by name. Instead they are matched up by entry point
+// first, then by name, and then by how many bytes of input files they have in
+// common. Output files that don't match anything were added or removed.
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ije/esbuild-internal/helpers"
+	"github.com/ije/esbuild-internal/js_ast"
+	"github.com/ije/esbuild-internal/js_parser"
+	"github.com/ije/esbuild-internal/logger"
+)
+
+type diffOutput struct {
+	path       string
+	entryPoint string
+	inputs     map[string]int
+	bytes      int
+
+	// This is an index into the other metafile's outputs, or -1 if this output
+	// file was added or removed
+	match int
+}
+
+type diffSize struct {
+	name     string
+	oldBytes int
+	newBytes int
+	isOld    bool
+	isNew    bool
+}
+
+func (d diffSize) delta() int {
+	return d.newBytes - d.oldBytes
+}
+
+type diffOutputResult struct {
+	diffSize
+	oldPath string
+	inputs  []diffSize
+}
+
+type diffMove struct {
+	path string
+	from []string
+	to   []string
+}
+
+type metafileDiff struct {
+	total           diffSize
+	outputs         []diffOutputResult
+	inputs          []diffSize
+	addedInputs     []string
+	removedInputs   []string
+	addedPackages   []string
+	removedPackages []string
+	moves           []diffMove
+}
+
+func diffMetafilesImpl(oldMetafile string, newMetafile string, opts DiffMetafilesOptions) string {
+	oldOutputs, ok := parseMetafileForDiff(oldMetafile)
+	if !ok {
+		return ""
+	}
+	newOutputs, ok := parseMetafileForDiff(newMetafile)
+	if !ok {
+		return ""
+	}
+	diff := computeMetafileDiff(oldOutputs, newOutputs)
+	if opts.Format == DiffMetafilesJSON {
+		return diff.renderJSON()
+	}
+	var colors logger.Colors
+	if opts.Color {
+		colors = logger.TerminalColors
+	}
+	return diff.renderText(colors)
+}
+
+func parseMetafileForDiff(metafile string) ([]diffOutput, bool) {
+	log := logger.NewDeferLog(logger.DeferLogNoVerboseOrDebug, nil)
+	source := logger.Source{Contents: metafile}
+	result, ok := js_parser.ParseJSON(log, source, js_parser.JSONOptions{})
+	if !ok {
+		return nil, false
+	}
+	outputs := getObjectPropertyObject(result, "outputs")
+	if outputs == nil {
+		return nil, false
+	}
+
+	var list []diffOutput
+	for _, output := range outputs.Properties {
+		key := helpers.UTF16ToString(output.Key.Data.(*js_ast.EString).Value)
+		if strings.HasSuffix(key, ".map") {
+			continue
+		}
+		item := diffOutput{path: key, inputs: make(map[string]int), match: -1}
+		if bytes := getObjectPropertyNumber(output.ValueOrNil, "bytes"); bytes != nil {
+			item.bytes = int(bytes.Value)
+		}
+		if entryPoint := getObjectPropertyString(output.ValueOrNil, "entryPoint"); entryPoint != nil {
+			item.entryPoint = helpers.UTF16ToString(entryPoint.Value)
+		}
+		if inputs := getObjectPropertyObject(output.ValueOrNil, "inputs"); inputs != nil {
+			for _, input := range inputs.Properties {
+				if bytesInOutput := getObjectPropertyNumber(input.ValueOrNil, "bytesInOutput"); bytesInOutput != nil {
+					item.inputs[helpers.UTF16ToString(input.Key.Data.(*js_ast.EString).Value)] = int(bytesInOutput.Value)
+				}
+			}
+		}
+		list = append(list, item)
+	}
+	return list, true
+}
+
+func matchDiffOutputs(oldOutputs []diffOutput, newOutputs []diffOutput) {
+	link := func(oldIndex int, newIndex int) {
+		oldOutputs[oldIndex].match = newIndex
+		newOutputs[newIndex].match = oldIndex
+	}
+
+	// An entry point can have both a JavaScript and a CSS output file, so the
+	// file extension has to match too
+	canMatch := func(oldIndex int, newIndex int) bool {
+		return oldOutputs[oldIndex].match == -1 && newOutputs[newIndex].match == -1 &&
+			path.Ext(oldOutputs[oldIndex].path) == path.Ext(newOutputs[newIndex].path)
+	}
+
+	// Match by entry point first
+	for i := range newOutputs {
+		if newOutputs[i].entryPoint != "" {
+			for j := range oldOutputs {
+				if oldOutputs[j].entryPoint == newOutputs[i].entryPoint && canMatch(j, i) {
+					link(j, i)
+					break
+				}
+			}
+		}
+	}
+
+	// Then match by path
+	for i := range newOutputs {
+		for j := range oldOutputs {
+			if oldOutputs[j].path == newOutputs[i].path && canMatch(j, i) {
+				link(j, i)
+				break
+			}
+		}
+	}
+
+	// Then match the remaining output files (e.g. shared chunks) by the number
+	// of bytes from input files they have in common
+	for i := range newOutputs {
+		best := -1
+		bestOverlap := 0
+		for j := range oldOutputs {
+			if !canMatch(j, i) {
+				continue
+			}
+			overlap := 0
+			for input, newBytes := range newOutputs[i].inputs {
+				if oldBytes, ok := oldOutputs[j].inputs[input]; ok {
+					if oldBytes < newBytes {
+						overlap += oldBytes
+					} else {
+						overlap += newBytes
+					}
+				}
+			}
+			if overlap > bestOverlap {
+				best = j
+				bestOverlap = overlap
+			}
+		}
+		if best != -1 {
+			link(best, i)
+		}
+	}
+}
+
+func computeMetafileDiff(oldOutputs []diffOutput, newOutputs []diffOutput) (diff metafileDiff) {
+	matchDiffOutputs(oldOutputs, newOutputs)
+
+	// Compare each pair of output files
+	for _, output := range newOutputs {
+		result := diffOutputResult{diffSize: diffSize{name: output.path, newBytes: output.bytes, isNew: true}}
+		var oldInputs map[string]int
+		if output.match != -1 {
+			old := oldOutputs[output.match]
+			result.oldPath = old.path
+			result.oldBytes = old.bytes
+			result.isOld = true
+			oldInputs = old.inputs
+		}
+		result.inputs = diffInputSizes(oldInputs, output.inputs)
+		diff.outputs = append(diff.outputs, result)
+	}
+	for _, output := range oldOutputs {
+		if output.match == -1 {
+			diff.outputs = append(diff.outputs, diffOutputResult{
+				diffSize: diffSize{name: output.path, oldBytes: output.bytes, isOld: true},
+				oldPath:  output.path,
+				inputs:   diffInputSizes(output.inputs, nil),
+			})
+		}
+	}
+	sort.Slice(diff.outputs, func(i int, j int) bool {
+		return diffSizeLess(diff.outputs[i].diffSize, diff.outputs[j].diffSize)
+	})
+
+	// Compare the total size of each input file across all output files
+	oldTotals := make(map[string]int)
+	newTotals := make(map[string]int)
+	for _, output := range oldOutputs {
+		diff.total.oldBytes += output.bytes
+		for input, bytes := range output.inputs {
+			oldTotals[input] += bytes
+		}
+	}
+	for _, output := range newOutputs {
+		diff.total.newBytes += output.bytes
+		for input, bytes := range output.inputs {
+			newTotals[input] += bytes
+		}
+	}
+	diff.total.isOld = true
+	diff.total.isNew = true
+	diff.inputs = diffInputSizes(oldTotals, newTotals)
+	for _, input := range diff.inputs {
+		if !input.isOld {
+			diff.addedInputs = append(diff.addedInputs, input.name)
+		} else if !input.isNew {
+			diff.removedInputs = append(diff.removedInputs, input.name)
+		}
+	}
+	sort.Strings(diff.addedInputs)
+	sort.Strings(diff.removedInputs)
+
+	// Compare the sets of packages
+	oldPackages := packagesForInputs(oldTotals)
+	newPackages := packagesForInputs(newTotals)
+	for name := range newPackages {
+		if !oldPackages[name] {
+			diff.addedPackages = append(diff.addedPackages, name)
+		}
+	}
+	for name := range oldPackages {
+		if !newPackages[name] {
+			diff.removedPackages = append(diff.removedPackages, name)
+		}
+	}
+	sort.Strings(diff.addedPackages)
+	sort.Strings(diff.removedPackages)
+
+	// An input file moved if the output files it's in don't correspond to the
+	// output files it was in before
+	oldLocations := make(map[string][]int)
+	newLocations := make(map[string][]int)
+	for i, output := range oldOutputs {
+		for input := range output.inputs {
+			oldLocations[input] = append(oldLocations[input], i)
+		}
+	}
+	for i, output := range newOutputs {
+		for input := range output.inputs {
+			newLocations[input] = append(newLocations[input], i)
+		}
+	}
+	for input, oldIndices := range oldLocations {
+		newIndices, ok := newLocations[input]
+		if !ok {
+			continue
+		}
+		moved := len(oldIndices) != len(newIndices)
+		if !moved {
+			inNew := make(map[int]bool)
+			for _, i := range newIndices {
+				inNew[i] = true
+			}
+			for _, i := range oldIndices {
+				if match := oldOutputs[i].match; match == -1 || !inNew[match] {
+					moved = true
+					break
+				}
+			}
+		}
+		if moved {
+			move := diffMove{path: input}
+			for _, i := range oldIndices {
+				move.from = append(move.from, oldOutputs[i].path)
+			}
+			for _, i := range newIndices {
+				move.to = append(move.to, newOutputs[i].path)
+			}
+			sort.Strings(move.from)
+			sort.Strings(move.to)
+			diff.moves = append(diff.moves, move)
+		}
+	}
+	sort.Slice(diff.moves, func(i int, j int) bool {
+		return diff.moves[i].path < diff.moves[j].path
+	})
+	return
+}
+
+// This only returns input files that changed size, were added, or were removed
+func diffInputSizes(oldInputs map[string]int, newInputs map[string]int) (sizes []diffSize) {
+	for input, newBytes := range newInputs {
+		oldBytes, ok := oldInputs[input]
+		if !ok || oldBytes != newBytes {
+			sizes = append(sizes, diffSize{name: input, oldBytes: oldBytes, newBytes: newBytes, isOld: ok, isNew: true})
+		}
+	}
+	for input, oldBytes := range oldInputs {
+		if _, ok := newInputs[input]; !ok {
+			sizes = append(sizes, diffSize{name: input, oldBytes: oldBytes, isOld: true})
+		}
+	}
+	sort.Slice(sizes, func(i int, j int) bool {
+		return diffSizeLess(sizes[i], sizes[j])
+	})
+	return
+}
+
+// Sort by the size of the change with the largest changes first
+func diffSizeLess(a diffSize, b diffSize) bool {
+	da := a.delta()
+	db := b.delta()
+	if da < 0 {
+		da = -da
+	}
+	if db < 0 {
+		db = -db
+	}
+	return da > db || (da == db && a.name < b.name)
+}
+
+func packagesForInputs(inputs map[string]int) map[string]bool {
+	packages := make(map[string]bool)
+	for input := range inputs {
+		if name, ok := packageNameForInputPath(input); ok {
+			packages[name] = true
+		}
+	}
+	return packages
+}
+
+func prettyPrintByteDelta(n int) string {
+	if n == 0 {
+		return "0b"
+	}
+	if n < 0 {
+		return "-" + strings.TrimSuffix(prettyPrintByteCount(-n), " ")
+	}
+	return "+" + strings.TrimSuffix(prettyPrintByteCount(n), " ")
+}
+
+func (d diffSize) prettyPrintSizes() string {
+	oldText := "none"
+	newText := "none"
+	if d.isOld {
+		oldText = strings.TrimSuffix(prettyPrintByteCount(d.oldBytes), " ")
+	}
+	if d.isNew {
+		newText = strings.TrimSuffix(prettyPrintByteCount(d.newBytes), " ")
+	}
+	return oldText + " → " + newText
+}
+
+func (d diffSize) prettyPrintDelta() string {
+	text := prettyPrintByteDelta(d.delta())
+	if d.isOld && d.isNew && d.oldBytes > 0 && d.delta() != 0 {
+		text += fmt.Sprintf(" (%+.1f%%)", 100.0*float64(d.delta())/float64(d.oldBytes))
+	}
+	return text
+}
+
+func (diff metafileDiff) renderText(colors logger.Colors) string {
+	type tableEntry struct {
+		first      string
+		second     string
+		third      string
+		delta      int
+		isTopLevel bool
+	}
+
+	table := []tableEntry{{
+		first:      "Total",
+		second:     diff.total.prettyPrintSizes(),
+		third:      diff.total.prettyPrintDelta(),
+		delta:      diff.total.delta(),
+		isTopLevel: true,
+	}}
+
+	for _, output := range diff.outputs {
+		first := output.name
+		if output.isOld && output.isNew && output.oldPath != output.name {
+			first += " (was " + output.oldPath + ")"
+		}
+		table = append(table, tableEntry{
+			first:      first,
+			second:     output.prettyPrintSizes(),
+			third:      output.prettyPrintDelta(),
+			delta:      output.delta(),
+			isTopLevel: true,
+		})
+		for j, input := range output.inputs {
+			indent := " ├ "
+			if j+1 == len(output.inputs) {
+				indent = " └ "
+			}
+			table = append(table, tableEntry{
+				first:  indent + input.name,
+				second: input.prettyPrintSizes(),
+				third:  input.prettyPrintDelta(),
+				delta:  input.delta(),
+			})
+		}
+	}
+
+	maxFirstLen := 0
+	maxSecondLen := 0
+	for _, entry := range table {
+		if n := utf8.RuneCountInString(entry.first); maxFirstLen < n {
+			maxFirstLen = n
+		}
+		if n := utf8.RuneCountInString(entry.second); maxSecondLen < n {
+			maxSecondLen = n
+		}
+	}
+
+	sb := strings.Builder{}
+
+	// Render the columns now that we know the widths
+	for _, entry := range table {
+		prefix := "\n"
+		color := colors.Bold
+		if !entry.isTopLevel {
+			prefix = ""
+			color = ""
+		}
+		deltaColor := colors.Dim
+		if entry.delta > 0 {
+			deltaColor = colors.Red
+		} else if entry.delta < 0 {
+			deltaColor = colors.Green
+		}
+		sb.WriteString(fmt.Sprintf("%s  %s%s%s %s%s%s %s%s%s %s%s%s %s%s%s\n",
+			prefix,
+			color,
+			entry.first,
+			colors.Reset,
+			colors.Dim,
+			strings.Repeat("─", 1+maxFirstLen-utf8.RuneCountInString(entry.first)+maxSecondLen-utf8.RuneCountInString(entry.second)),
+			colors.Reset,
+			color,
+			entry.second,
+			colors.Reset,
+			colors.Dim,
+			"──",
+			colors.Reset,
+			deltaColor,
+			entry.third,
+			colors.Reset,
+		))
+	}
+
+	writeList := func(title string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		sb.WriteString(fmt.Sprintf("\n  %s%s%s\n", colors.Bold, title, colors.Reset))
+		for i, item := range items {
+			indent := " ├ "
+			if i+1 == len(items) {
+				indent = " └ "
+			}
+			sb.WriteString(fmt.Sprintf("  %s%s\n", indent, item))
+		}
+	}
+
+	writeList("Added packages", diff.addedPackages)
+	writeList("Removed packages", diff.removedPackages)
+	writeList("Added input files", diff.addedInputs)
+	writeList("Removed input files", diff.removedInputs)
+
+	var moves []string
+	for _, move := range diff.moves {
+		moves = append(moves, fmt.Sprintf("%s %s%s → %s%s", move.path, colors.Dim,
+			strings.Join(move.from, ", "), strings.Join(move.to, ", "), colors.Reset))
+	}
+	writeList("Moved input files", moves)
+
+	return sb.String()
+}
+
+func (diff metafileDiff) renderJSON() string {
+	sb := strings.Builder{}
+
+	quote := func(text string) string {
+		return string(helpers.QuoteForJSON(text, false))
+	}
+
+	writeStrings := func(items []string) {
+		sb.WriteByte('[')
+		for i, item := range items {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(quote(item))
+		}
+		sb.WriteByte(']')
+	}
+
+	writeSizes := func(d diffSize) {
+		oldBytes := "null"
+		newBytes := "null"
+		if d.isOld {
+			oldBytes = fmt.Sprintf("%d", d.oldBytes)
+		}
+		if d.isNew {
+			newBytes = fmt.Sprintf("%d", d.newBytes)
+		}
+		sb.WriteString(fmt.Sprintf("\"oldBytes\": %s, \"newBytes\": %s, \"delta\": %d", oldBytes, newBytes, d.delta()))
+	}
+
+	sb.WriteString("{\n  \"total\": {")
+	writeSizes(diff.total)
+	sb.WriteString("},\n  \"outputs\": [")
+	for i, output := range diff.outputs {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		oldPath := "null"
+		newPath := "null"
+		if output.isOld {
+			oldPath = quote(output.oldPath)
+		}
+		if output.isNew {
+			newPath = quote(output.name)
+		}
+		sb.WriteString(fmt.Sprintf("\n    {\n      \"old\": %s,\n      \"new\": %s,\n      ", oldPath, newPath))
+		writeSizes(output.diffSize)
+		sb.WriteString(",\n      \"inputs\": [")
+		for j, input := range output.inputs {
+			if j > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(fmt.Sprintf("\n        {\"path\": %s, ", quote(input.name)))
+			writeSizes(input)
+			sb.WriteByte('}')
+		}
+		if len(output.inputs) > 0 {
+			sb.WriteString("\n      ")
+		}
+		sb.WriteString("]\n    }")
+	}
+	if len(diff.outputs) > 0 {
+		sb.WriteString("\n  ")
+	}
+	sb.WriteString("],\n  \"inputs\": [")
+	for i, input := range diff.inputs {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(fmt.Sprintf("\n    {\"path\": %s, ", quote(input.name)))
+		writeSizes(input)
+		sb.WriteByte('}')
+	}
+	if len(diff.inputs) > 0 {
+		sb.WriteString("\n  ")
+	}
+	sb.WriteString("],\n  \"addedInputs\": ")
+	writeStrings(diff.addedInputs)
+	sb.WriteString(",\n  \"removedInputs\": ")
+	writeStrings(diff.removedInputs)
+	sb.WriteString(",\n  \"addedPackages\": ")
+	writeStrings(diff.addedPackages)
+	sb.WriteString(",\n  \"removedPackages\": ")
+	writeStrings(diff.removedPackages)
+	sb.WriteString(",\n  \"moves\": [")
+	for i, move := range diff.moves {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(fmt.Sprintf("\n    {\"path\": %s, \"from\": ", quote(move.path)))
+		writeStrings(move.from)
+		sb.WriteString(", \"to\": ")
+		writeStrings(move.to)
+		sb.WriteByte('}')
+	}
+	if len(diff.moves) > 0 {
+		sb.WriteString("\n  ")
+	}
+	sb.WriteString("]\n}\n")
+	return sb.String()
+}
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ije/esbuild-internal/test"
+)
+
+func TestMatchDiffOutputs(t *testing.T) {
+	output := func(path string, entryPoint string, inputs map[string]int) diffOutput {
+		return diffOutput{path: path, entryPoint: entryPoint, inputs: inputs, match: -1}
+	}
+
+	cases := []struct {
+		name     string
+		old      []diffOutput
+		new      []diffOutput
+		expected []int
+	}{
+		{
+			name:     "SamePath",
+			old:      []diffOutput{output("out/a.js", "", nil), output("out/b.js", "", nil)},
+			new:      []diffOutput{output("out/b.js", "", nil), output("out/a.js", "", nil)},
+			expected: []int{1, 0},
+		},
+		{
+			name:     "RenamedEntryPoint",
+			old:      []diffOutput{output("out/entry-OLDHASH.js", "entry.js", nil)},
+			new:      []diffOutput{output("out/entry-NEWHASH.js", "entry.js", nil)},
+			expected: []int{0},
+		},
+		{
+			// The JavaScript and CSS output files for an entry point share it
+			name: "EntryPointWithCSS",
+			old: []diffOutput{
+				output("out/entry-OLD1.css", "entry.js", nil),
+				output("out/entry-OLD2.js", "entry.js", nil),
+			},
+			new: []diffOutput{
+				output("out/entry-NEW2.js", "entry.js", nil),
+				output("out/entry-NEW1.css", "entry.js", nil),
+			},
+			expected: []int{1, 0},
+		},
+		{
+			name: "RenamedHashedChunk",
+			old: []diffOutput{
+				output("out/chunk-AAAA.js", "", map[string]int{"shared.js": 100, "util.js": 10}),
+				output("out/chunk-BBBB.js", "", map[string]int{"other.js": 50}),
+			},
+			new: []diffOutput{
+				output("out/chunk-CCCC.js", "", map[string]int{"other.js": 60}),
+				output("out/chunk-DDDD.js", "", map[string]int{"shared.js": 120, "util.js": 10}),
+			},
+			expected: []int{1, 0},
+		},
+		{
+			// The chunk that has the most bytes in common is the match even if
+			// another chunk has more input files in common
+			name: "SharedChunkMoved",
+			old: []diffOutput{
+				output("out/chunk-AAAA.js", "", map[string]int{"a.js": 10, "b.js": 10}),
+				output("out/chunk-BBBB.js", "", map[string]int{"big.js": 500, "a.js": 5}),
+			},
+			new: []diffOutput{
+				output("out/chunk-CCCC.js", "", map[string]int{"a.js": 10, "b.js": 10, "big.js": 500}),
+			},
+			expected: []int{1},
+		},
+		{
+			name: "NoOverlap",
+			old:  []diffOutput{output("out/chunk-AAAA.js", "", map[string]int{"a.js": 10})},
+			new: []diffOutput{
+				output("out/chunk-BBBB.js", "", map[string]int{"b.js": 10}),
+				output("out/chunk-CCCC.css", "", map[string]int{"a.js": 10}),
+			},
+			expected: []int{-1, -1},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			matchDiffOutputs(c.old, c.new)
+			var matches []int
+			for _, output := range c.new {
+				matches = append(matches, output.match)
+			}
+			test.AssertEqual(t, fmt.Sprint(matches), fmt.Sprint(c.expected))
+
+			// Matches must be symmetric
+			for i, output := range c.new {
+				if output.match != -1 {
+					test.AssertEqual(t, c.old[output.match].match, i)
+				}
+			}
+		})
+	}
+}
+
+func TestComputeMetafileDiff(t *testing.T) {
+	cases := []struct {
+		name            string
+		old             string
+		new             string
+		added           string
+		removed         string
+		addedPackages   string
+		removedPackages string
+		moves           string
+	}{
+		{
+			name: "Unchanged",
+			old:  `{"outputs": {"out/entry.js": {"bytes": 10, "entryPoint": "entry.js", "inputs": {"entry.js": {"bytesInOutput": 10}}}}}`,
+			new:  `{"outputs": {"out/entry.js": {"bytes": 10, "entryPoint": "entry.js", "inputs": {"entry.js": {"bytesInOutput": 10}}}}}`,
+		},
+		{
+			name: "ScopedPackages",
+			old: `{"outputs": {"out/entry.js": {"bytes": 30, "entryPoint": "entry.js", "inputs": {
+				"entry.js": {"bytesInOutput": 10},
+				"node_modules/@old/pkg/index.js": {"bytesInOutput": 10},
+				"node_modules/@old/pkg/node_modules/@old/dep/index.js": {"bytesInOutput": 10}
+			}}}}`,
+			new: `{"outputs": {"out/entry.js": {"bytes": 30, "entryPoint": "entry.js", "inputs": {
+				"entry.js": {"bytesInOutput": 10},
+				"node_modules/@old/pkg/index.js": {"bytesInOutput": 10},
+				"node_modules/@new/pkg/lib/index.js": {"bytesInOutput": 10}
+			}}}}`,
+			added:           "node_modules/@new/pkg/lib/index.js",
+			removed:         "node_modules/@old/pkg/node_modules/@old/dep/index.js",
+			addedPackages:   "@new/pkg",
+			removedPackages: "@old/dep",
+		},
+		{
+			// Changing the hash in a chunk's name isn't a move
+			name: "RenamedChunk",
+			old: `{"outputs": {
+				"out/entry.js": {"bytes": 10, "entryPoint": "entry.js", "inputs": {"entry.js": {"bytesInOutput": 10}}},
+				"out/chunk-AAAA.js": {"bytes": 10, "inputs": {"shared.js": {"bytesInOutput": 10}}}
+			}}`,
+			new: `{"outputs": {
+				"out/entry.js": {"bytes": 10, "entryPoint": "entry.js", "inputs": {"entry.js": {"bytesInOutput": 10}}},
+				"out/chunk-BBBB.js": {"bytes": 20, "inputs": {"shared.js": {"bytesInOutput": 20}}}
+			}}`,
+		},
+		{
+			name: "MovedIntoChunk",
+			old: `{"outputs": {
+				"out/a.js": {"bytes": 20, "entryPoint": "a.js", "inputs": {"a.js": {"bytesInOutput": 10}, "shared.js": {"bytesInOutput": 10}}},
+				"out/b.js": {"bytes": 10, "entryPoint": "b.js", "inputs": {"b.js": {"bytesInOutput": 10}}}
+			}}`,
+			new: `{"outputs": {
+				"out/a.js": {"bytes": 10, "entryPoint": "a.js", "inputs": {"a.js": {"bytesInOutput": 10}}},
+				"out/b.js": {"bytes": 10, "entryPoint": "b.js", "inputs": {"b.js": {"bytesInOutput": 10}}},
+				"out/chunk-AAAA.js": {"bytes": 10, "inputs": {"shared.js": {"bytesInOutput": 10}}}
+			}}`,
+			moves: "shared.js: out/a.js -> out/chunk-AAAA.js",
+		},
+		{
+			name: "DuplicatedIntoEntryPoints",
+			old: `{"outputs": {
+				"out/a.js": {"bytes": 20, "entryPoint": "a.js", "inputs": {"a.js": {"bytesInOutput": 10}, "shared.js": {"bytesInOutput": 10}}},
+				"out/b.js": {"bytes": 10, "entryPoint": "b.js", "inputs": {"b.js": {"bytesInOutput": 10}}}
+			}}`,
+			new: `{"outputs": {
+				"out/a.js": {"bytes": 20, "entryPoint": "a.js", "inputs": {"a.js": {"bytesInOutput": 10}, "shared.js": {"bytesInOutput": 10}}},
+				"out/b.js": {"bytes": 20, "entryPoint": "b.js", "inputs": {"b.js": {"bytesInOutput": 10}, "shared.js": {"bytesInOutput": 10}}}
+			}}`,
+			moves: "shared.js: out/a.js -> out/a.js, out/b.js",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			oldOutputs, ok := parseMetafileForDiff(c.old)
+			if !ok {
+				t.Fatal("Failed to parse the old metafile")
+			}
+			newOutputs, ok := parseMetafileForDiff(c.new)
+			if !ok {
+				t.Fatal("Failed to parse the new metafile")
+			}
+			diff := computeMetafileDiff(oldOutputs, newOutputs)
+			var moves []string
+			for _, move := range diff.moves {
+				moves = append(moves, move.path+": "+strings.Join(move.from, ", ")+" -> "+strings.Join(move.to, ", "))
+			}
+			test.AssertEqual(t, strings.Join(diff.addedInputs, "\n"), c.added)
+			test.AssertEqual(t, strings.Join(diff.removedInputs, "\n"), c.removed)
+			test.AssertEqual(t, strings.Join(diff.addedPackages, "\n"), c.addedPackages)
+			test.AssertEqual(t, strings.Join(diff.removedPackages, "\n"), c.removedPackages)
+			test.AssertEqual(t, strings.Join(moves, "\n"), c.moves)
+		})
+	}
+}
+
+const diffMetafilesTestOld = `{
+	"outputs": {
+		"out/entry-AAAA.js": {
+			"bytes": 1000,
+			"entryPoint": "entry.js",
+			"inputs": {
+				"entry.js": {"bytesInOutput": 400},
+				"shared.js": {"bytesInOutput": 100},
+				"node_modules/@scope/old/index.js": {"bytesInOutput": 500}
+			}
+		},
+		"out/entry-AAAA.js.map": {"bytes": 5000, "inputs": {}},
+		"out/removed.js": {"bytes": 50, "inputs": {"removed.js": {"bytesInOutput": 50}}}
+	}
+}`
+
+const diffMetafilesTestNew = `{
+	"outputs": {
+		"out/entry-BBBB.js": {
+			"bytes": 1100,
+			"entryPoint": "entry.js",
+			"inputs": {
+				"entry.js": {"bytesInOutput": 500},
+				"node_modules/@scope/new/index.js": {"bytesInOutput": 600}
+			}
+		},
+		"out/chunk-CCCC.js": {"bytes": 100, "inputs": {"shared.js": {"bytesInOutput": 100}}}
+	}
+}`
+
+func TestDiffMetafilesText(t *testing.T) {
+	text := DiffMetafiles(diffMetafilesTestOld, diffMetafilesTestNew, DiffMetafilesOptions{})
+	test.AssertEqualWithDiff(t, text, ""+
+		"\n  Total ───────────────────────────────────── 1.0kb → 1.2kb ── +150b (+14.3%)\n"+
+		"\n  out/chunk-CCCC.js ─────────────────────────── none → 100b ── +100b\n"+
+		"   └ shared.js ──────────────────────────────── none → 100b ── +100b\n"+
+		"\n  out/entry-BBBB.js (was out/entry-AAAA.js) ─ 1000b → 1.1kb ── +100b (+10.0%)\n"+
+		"   ├ node_modules/@scope/new/index.js ───────── none → 600b ── +600b\n"+
+		"   ├ node_modules/@scope/old/index.js ───────── 500b → none ── -500b\n"+
+		"   ├ entry.js ───────────────────────────────── 400b → 500b ── +100b (+25.0%)\n"+
+		"   └ shared.js ──────────────────────────────── 100b → none ── -100b\n"+
+		"\n  out/removed.js ─────────────────────────────── 50b → none ── -50b\n"+
+		"   └ removed.js ──────────────────────────────── 50b → none ── -50b\n"+
+		"\n  Added packages\n"+
+		"   └ @scope/new\n"+
+		"\n  Removed packages\n"+
+		"   └ @scope/old\n"+
+		"\n  Added input files\n"+
+		"   └ node_modules/@scope/new/index.js\n"+
+		"\n  Removed input files\n"+
+		"   ├ node_modules/@scope/old/index.js\n"+
+		"   └ removed.js\n"+
+		"\n  Moved input files\n"+
+		"   └ shared.js out/entry-AAAA.js → out/chunk-CCCC.js\n")
+}
+
+func TestDiffMetafilesJSON(t *testing.T) {
+	text := DiffMetafiles(diffMetafilesTestOld, diffMetafilesTestNew, DiffMetafilesOptions{Format: DiffMetafilesJSON})
+	test.AssertEqualWithDiff(t, text, `{
+  "total": {"oldBytes": 1050, "newBytes": 1200, "delta": 150},
+  "outputs": [
+    {
+      "old": null,
+      "new": "out/chunk-CCCC.js",
+      "oldBytes": null, "newBytes": 100, "delta": 100,
+      "inputs": [
+        {"path": "shared.js", "oldBytes": null, "newBytes": 100, "delta": 100}
+      ]
+    },
+    {
+      "old": "out/entry-AAAA.js",
+      "new": "out/entry-BBBB.js",
+      "oldBytes": 1000, "newBytes": 1100, "delta": 100,
+      "inputs": [
+        {"path": "node_modules/@scope/new/index.js", "oldBytes": null, "newBytes": 600, "delta": 600},
+        {"path": "node_modules/@scope/old/index.js", "oldBytes": 500, "newBytes": null, "delta": -500},
+        {"path": "entry.js", "oldBytes": 400, "newBytes": 500, "delta": 100},
+        {"path": "shared.js", "oldBytes": 100, "newBytes": null, "delta": -100}
+      ]
+    },
+    {
+      "old": "out/removed.js",
+      "new": null,
+      "oldBytes": 50, "newBytes": null, "delta": -50,
+      "inputs": [
+        {"path": "removed.js", "oldBytes": 50, "newBytes": null, "delta": -50}
+      ]
+    }
+  ],
+  "inputs": [
+    {"path": "node_modules/@scope/new/index.js", "oldBytes": null, "newBytes": 600, "delta": 600},
+    {"path": "node_modules/@scope/old/index.js", "oldBytes": 500, "newBytes": null, "delta": -500},
+    {"path": "entry.js", "oldBytes": 400, "newBytes": 500, "delta": 100},
+    {"path": "removed.js", "oldBytes": 50, "newBytes": null, "delta": -50}
+  ],
+  "addedInputs": ["node_modules/@scope/new/index.js"],
+  "removedInputs": ["node_modules/@scope/old/index.js", "removed.js"],
+  "addedPackages": ["@scope/new"],
+  "removedPackages": ["@scope/old"],
+  "moves": [
+    {"path": "shared.js", "from": ["out/entry-AAAA.js"], "to": ["out/chunk-CCCC.js"]}
+  ]
+}
+`)
+
+	// Nothing is produced if either metafile is invalid
+	test.AssertEqual(t, DiffMetafiles("{", diffMetafilesTestNew, DiffMetafilesOptions{Format: DiffMetafilesJSON}), "")
+	test.AssertEqual(t, DiffMetafiles(diffMetafilesTestOld, "[]", DiffMetafilesOptions{Format: DiffMetafilesJSON}), "")
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func makeFilesTestDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "esbuild-files")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Resolve symlinks (e.g. "/tmp" on macOS) so that paths can be compared
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+	for path, contents := range files {
+		absPath := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(absPath, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestBuildFilesOverlay(t *testing.T) {
+	dir := makeFilesTestDir(t, map[string]string{
+		"disk.js":   `export let disk = "from disk"`,
+		"shadow.js": `export let shadow = "shadowed on disk"`,
+	})
+	defer os.RemoveAll(dir)
+
+	result := Build(BuildOptions{
+		AbsWorkingDir: dir,
+		EntryPoints:   []string{"entry.js"},
+		Bundle:        true,
+		Outfile:       "out.js",
+		Files: map[string]string{
+			"entry.js":  `import {disk} from './disk'; import {shadow} from './shadow'; console.log(disk, shadow)`,
+			"shadow.js": `export let shadow = "from memory"`,
+		},
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %+v", result.Errors)
+	}
+	if len(result.OutputFiles) != 1 {
+		t.Fatalf("Expected one output file but got %d", len(result.OutputFiles))
+	}
+
+	// In-memory files take precedence, but files on disk are still visible
+	contents := string(result.OutputFiles[0].Contents)
+	for _, text := range []string{"from disk", "from memory"} {
+		if !strings.Contains(contents, text) {
+			t.Fatalf("Expected %q in the output:\n%s", text, contents)
+		}
+	}
+	if strings.Contains(contents, "shadowed on disk") {
+		t.Fatalf("Expected the in-memory file to be used instead:\n%s", contents)
+	}
+}
+
+func TestBuildFilesOnly(t *testing.T) {
+	dir := makeFilesTestDir(t, map[string]string{
+		"disk.js": `export let disk = "from disk"`,
+	})
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"entry.js":                      `import {pkg} from 'pkg'; console.log(pkg)`,
+		"node_modules/pkg/package.json": `{ "main": "main.js" }`,
+		"node_modules/pkg/main.js":      `export let pkg = "from memory package"`,
+	}
+	result := Build(BuildOptions{
+		AbsWorkingDir: dir,
+		EntryPoints:   []string{"entry.js"},
+		Bundle:        true,
+		Outfile:       "out.js",
+		Files:         files,
+		FilesMode:     FilesOnly,
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %+v", result.Errors)
+	}
+	if len(result.OutputFiles) != 1 {
+		t.Fatalf("Expected one output file but got %d", len(result.OutputFiles))
+	}
+	if contents := string(result.OutputFiles[0].Contents); !strings.Contains(contents, "from memory package") {
+		t.Fatalf("Unexpected output:\n%s", contents)
+	}
+
+	// Files on disk aren't visible
+	files["entry.js"] = `import {disk} from './disk'; console.log(disk)`
+	result = Build(BuildOptions{
+		AbsWorkingDir: dir,
+		EntryPoints:   []string{"entry.js"},
+		Bundle:        true,
+		Outfile:       "out.js",
+		Files:         files,
+		FilesMode:     FilesOnly,
+	})
+	if len(result.Errors) != 1 || result.Errors[0].Text != `Could not resolve "./disk"` {
+		t.Fatalf("Unexpected errors: %+v", result.Errors)
+	}
+}
+
+func TestBuildFilesOnlyWriteStaysInMemory(t *testing.T) {
+	dir := makeFilesTestDir(t, nil)
+	defer os.RemoveAll(dir)
+
+	ctx, ctxErr := Context(BuildOptions{
+		AbsWorkingDir: dir,
+		EntryPoints:   []string{"entry.js"},
+		Bundle:        true,
+		Outdir:        "out",
+		Write:         true,
+		Files:         map[string]string{"entry.js": `console.log("from memory")`},
+		FilesMode:     FilesOnly,
+	})
+	if ctxErr != nil {
+		t.Fatalf("Unexpected errors: %+v", ctxErr.Errors)
+	}
+	defer ctx.Dispose()
+
+	result := ctx.Rebuild()
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %+v", result.Errors)
+	}
+
+	// Nothing is written to the file system
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("Expected the directory to be empty but found %q", entries[0].Name())
+	}
+
+	// The output file is written to memory instead
+	contents, ok := ctx.(*internalContext).args.memoryFiles.Get(filepath.Join(dir, "out", "entry.js"))
+	if !ok || !strings.Contains(contents, "from memory") {
+		t.Fatalf("Expected the output file to be in memory: %q", contents)
+	}
+}
+
+func TestUpdateFilesWatchRebuild(t *testing.T) {
+	dir := makeFilesTestDir(t, nil)
+	defer os.RemoveAll(dir)
+
+	outputs := make(chan string, 16)
+	ctx, ctxErr := Context(BuildOptions{
+		AbsWorkingDir: dir,
+		EntryPoints:   []string{"entry.js"},
+		Bundle:        true,
+		Outfile:       "out.js",
+		Files:         map[string]string{"entry.js": `import {x} from './dep'; console.log(x)`, "dep.js": `export let x = "first"`},
+		FilesMode:     FilesOnly,
+		Plugins: []Plugin{{
+			Name: "on-end",
+			Setup: func(build PluginBuild) {
+				build.OnEnd(func(result *BuildResult) (OnEndResult, error) {
+					if len(result.OutputFiles) == 1 {
+						outputs <- string(result.OutputFiles[0].Contents)
+					} else {
+						outputs <- ""
+					}
+					return OnEndResult{}, nil
+				})
+			},
+		}},
+	})
+	if ctxErr != nil {
+		t.Fatalf("Unexpected errors: %+v", ctxErr.Errors)
+	}
+	defer ctx.Dispose()
+
+	waitForOutput := func(expected string) {
+		t.Helper()
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case output := <-outputs:
+				if strings.Contains(output, expected) {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("Expected a build containing %q", expected)
+			}
+		}
+	}
+
+	if err := ctx.Watch(WatchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForOutput("first")
+
+	// Changing a file that the build used must trigger a rebuild
+	second := `export let x = "second"`
+	if err := ctx.UpdateFiles(map[string]*string{"dep.js": &second}); err != nil {
+		t.Fatal(err)
+	}
+	waitForOutput("second")
+}
+
+func TestUpdateFilesWithoutFiles(t *testing.T) {
+	ctx, ctxErr := Context(BuildOptions{})
+	if ctxErr != nil {
+		t.Fatalf("Unexpected errors: %+v", ctxErr.Errors)
+	}
+	defer ctx.Dispose()
+
+	contents := ""
+	if err := ctx.UpdateFiles(map[string]*string{"entry.js": &contents}); err == nil {
+		t.Fatal("Expected an error for a context without in-memory files")
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+// This file implements the server side of hot module replacement. After each
+// successful rebuild, every JavaScript module whose contents changed is built
+// again on its own with its JavaScript dependencies left external. The code
+// is sent to the browser over the "/esbuild" event stream, where the runtime
+// evaluates it against the modules that are already running. If a module can't
+// be updated this way, the browser is told to reload the page instead.
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ije/esbuild-internal/bundler"
+	"github.com/ije/esbuild-internal/config"
+	"github.com/ije/esbuild-internal/fs"
+	"github.com/ije/esbuild-internal/helpers"
+	"github.com/ije/esbuild-internal/linker"
+	"github.com/ije/esbuild-internal/logger"
+)
+
+const hotUpdateReload = "{\"reload\":true}"
+
+// This returns the data for the "hmr" event, which looks like this:
+//
+//	{"updates":[{"id":"src/app.js","importers":["src/index.js"],"code":"..."}]}
+//
+// or "{"reload":true}" if the page must be reloaded. It returns an empty
+// string if there's nothing to update. CSS changes are not included here
+// since they are already reported by the "change" event.
+func hotUpdateJSON(args rebuildArgs, oldModules map[string]bundler.HotModule, newModules map[string]bundler.HotModule) string {
+	if oldModules == nil || newModules == nil {
+		return ""
+	}
+
+	var changed []string
+	for id, module := range newModules {
+		if old, ok := oldModules[id]; ok && old.Hash != module.Hash && !module.IsCSS {
+			changed = append(changed, id)
+		}
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+	sort.Strings(changed)
+
+	sb := strings.Builder{}
+	sb.WriteString("{\"updates\":[")
+	for i, id := range changed {
+		module := newModules[id]
+		if module.AbsPath == "" {
+			return hotUpdateReload
+		}
+		code, ok := buildHotUpdate(args, module.AbsPath)
+		if !ok {
+			return hotUpdateReload
+		}
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString("{\"id\":")
+		sb.Write(helpers.QuoteForJSON(id, false))
+		sb.WriteString(",\"importers\":[")
+		for j, importer := range module.Importers {
+			if j > 0 {
+				sb.WriteByte(',')
+			}
+			sb.Write(helpers.QuoteForJSON(importer, false))
+		}
+		sb.WriteString("],\"code\":")
+		sb.Write(helpers.QuoteForJSON(code, false))
+		sb.WriteByte('}')
+	}
+	sb.WriteString("]}")
+	return sb.String()
+}
+
+// This bundles a single module as a CommonJS module. Imports of other
+// JavaScript modules turn into "require()" calls that the runtime resolves
+// using the modules that are already running.
+func buildHotUpdate(args rebuildArgs, absPath string) (string, bool) {
+	options := args.options
+	options.HotUpdatePath = absPath
+	options.OutputFormat = config.FormatCommonJS
+	options.CodeSplitting = false
+	options.ManualChunks = nil
+	options.MinChunkSize = 0
+	options.NeedsMetafile = false
+	options.WriteToStdout = false
+	options.SourceMap = config.SourceMapNone
+	options.GlobalName = nil
+	options.JSBanner = ""
+	options.JSFooter = ""
+
+	// Don't run "onStart" callbacks again for each update since those are
+	// expected to run once per build, and "onEnd" callbacks aren't run here
+	options.Plugins = make([]config.Plugin, len(args.options.Plugins))
+	for i, plugin := range args.options.Plugins {
+		plugin.OnStart = nil
+		options.Plugins[i] = plugin
+	}
+
+	realFS, err := fs.RealFS(fs.RealFSOptions{AbsWorkingDir: args.absWorkingDir})
+	if err != nil {
+		return "", false
+	}
+	realFS = args.buildFS(realFS)
+	log := logger.NewDeferLog(logger.DeferLogNoVerboseOrDebug, nil)
+	entryPoints := []bundler.EntryPoint{{InputPath: absPath, InputPathInFileNamespace: true}}
+	bundle := bundler.ScanBundle(config.BuildCall, log, realFS, args.caches, entryPoints, options, nil)
+	if log.HasErrors() {
+		return "", false
+	}
+	results, _ := bundle.Compile(log, nil, nil, linker.Link)
+	if log.HasErrors() {
+		return "", false
+	}
+
+	for _, result := range results {
+		if result.AbsPath == options.AbsOutputFile || strings.HasSuffix(result.AbsPath, options.OutputExtensionJS) {
+			return string(result.Contents), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,551 @@
+package api
+
+// This file implements plugins that run in a separate process. The child
+// process is spawned during plugin setup and talks to us using JSON-RPC 2.0
+// over its stdin and stdout, with one JSON message per line. Anything the
+// child writes to stderr is passed through to our stderr.
+//
+// The host sends these requests to the child:
+//
+//	"setup"     {"name"}
+//	            -> {"onStart", "onEnd", "onResolve": [{"id", "filter", "namespace"}], "onLoad": [...]}
+//	"onStart"   {} -> {"errors", "warnings"}
+//	"onResolve" {"id", "path", "importer", "namespace", "resolveDir", "kind", "pluginData", "with"}
+//	            -> {"path", "external", "sideEffects", "namespace", "suffix", "pluginData", ...}
+//	"onLoad"    {"id", "path", "namespace", "suffix", "pluginData", "with"}
+//	            -> {"contents", "resolveDir", "loader", "pluginData", "sourceMap", ...}
+//	"onEnd"     {"errors", "warnings"} -> {"errors", "warnings"}
+//
+// The "id" in "onResolve" and "onLoad" requests is the id of the callback
+// that the child registered during setup. Results may also contain "errors",
+// "warnings", "watchFiles", and "watchDirs". A JSON-RPC error response is
+// treated like an error thrown by the callback.
+//
+// If the build is canceled while a request is pending, the host stops waiting
+// and sends the child a "$/cancelRequest" notification with the "id" of the
+// request. The child's eventual response to that request is ignored. The
+// host closes the child's stdin when the plugin is disposed, and the child is
+// expected to exit when that happens.
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+type processPlugin struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	exited  chan struct{}
+	mutex   sync.Mutex
+	pending map[int]chan processResponse
+	nextID  int
+	err     error
+
+	// This is separate from "mutex" so that a blocked write to the child can't
+	// prevent us from reading the child's responses
+	writeMutex sync.Mutex
+}
+
+type processRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      *int        `json:"id,omitempty"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type processResponse struct {
+	ID     *int            `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type processSetupResult struct {
+	OnStart   bool              `json:"onStart"`
+	OnEnd     bool              `json:"onEnd"`
+	OnResolve []processCallback `json:"onResolve"`
+	OnLoad    []processCallback `json:"onLoad"`
+}
+
+type processCallback struct {
+	ID        int    `json:"id"`
+	Filter    string `json:"filter"`
+	Namespace string `json:"namespace"`
+}
+
+type processLocation struct {
+	File       string `json:"file"`
+	Namespace  string `json:"namespace"`
+	Line       int    `json:"line"`
+	Column     int    `json:"column"`
+	Length     int    `json:"length"`
+	LineText   string `json:"lineText"`
+	Suggestion string `json:"suggestion"`
+}
+
+type processNote struct {
+	Text     string           `json:"text"`
+	Location *processLocation `json:"location"`
+}
+
+type processMessage struct {
+	ID       string           `json:"id"`
+	Text     string           `json:"text"`
+	Location *processLocation `json:"location"`
+	Notes    []processNote    `json:"notes"`
+}
+
+type processMessages struct {
+	Errors   []processMessage `json:"errors"`
+	Warnings []processMessage `json:"warnings"`
+}
+
+type processWatchPaths struct {
+	WatchFiles []string `json:"watchFiles"`
+	WatchDirs  []string `json:"watchDirs"`
+}
+
+type processOnResolveParams struct {
+	ID         int               `json:"id"`
+	Path       string            `json:"path"`
+	Importer   string            `json:"importer"`
+	Namespace  string            `json:"namespace"`
+	ResolveDir string            `json:"resolveDir"`
+	Kind       string            `json:"kind"`
+	PluginData json.RawMessage   `json:"pluginData,omitempty"`
+	With       map[string]string `json:"with,omitempty"`
+}
+
+type processOnResolveResult struct {
+	processMessages
+	processWatchPaths
+	Path        string          `json:"path"`
+	External    bool            `json:"external"`
+	SideEffects *bool           `json:"sideEffects"`
+	Namespace   string          `json:"namespace"`
+	Suffix      string          `json:"suffix"`
+	PluginData  json.RawMessage `json:"pluginData"`
+}
+
+type processOnLoadParams struct {
+	ID         int               `json:"id"`
+	Path       string            `json:"path"`
+	Namespace  string            `json:"namespace"`
+	Suffix     string            `json:"suffix"`
+	PluginData json.RawMessage   `json:"pluginData,omitempty"`
+	With       map[string]string `json:"with,omitempty"`
+}
+
+type processOnLoadResult struct {
+	processMessages
+	processWatchPaths
+	Contents   *string         `json:"contents"`
+	ResolveDir string          `json:"resolveDir"`
+	Loader     string          `json:"loader"`
+	PluginData json.RawMessage `json:"pluginData"`
+	SourceMap  string          `json:"sourceMap"`
+}
+
+func processPluginImpl(options ProcessPluginOptions) Plugin {
+	return Plugin{
+		Name: options.Name,
+		Setup: func(build PluginBuild) {
+			p, setup, err := startProcessPlugin(options)
+			if err != nil {
+				// Plugin setup can't fail, so report the error from every build instead
+				text := fmt.Sprintf("Failed to start plugin process %q: %s", options.Command, err.Error())
+				build.OnStart(func() (OnStartResult, error) {
+					return OnStartResult{Errors: []Message{{Text: text}}}, nil
+				})
+				return
+			}
+			build.OnDispose(p.dispose)
+
+			if setup.OnStart {
+				build.OnStart(func() (OnStartResult, error) {
+					var result processMessages
+					if err := p.call("onStart", struct{}{}, nil, &result); err != nil {
+						return OnStartResult{}, err
+					}
+					return OnStartResult{
+						Errors:   convertProcessMessages(result.Errors),
+						Warnings: convertProcessMessages(result.Warnings),
+					}, nil
+				})
+			}
+
+			for _, callback := range setup.OnResolve {
+				id := callback.ID
+				build.OnResolve(OnResolveOptions{Filter: callback.Filter, Namespace: callback.Namespace}, func(args OnResolveArgs) (OnResolveResult, error) {
+					var result processOnResolveResult
+					err := p.call("onResolve", processOnResolveParams{
+						ID:         id,
+						Path:       args.Path,
+						Importer:   args.Importer,
+						Namespace:  args.Namespace,
+						ResolveDir: args.ResolveDir,
+						Kind:       resolveKindToImportKind(args.Kind).StringForMetafile(),
+						PluginData: processPluginData(args.PluginData),
+						With:       args.With,
+					}, args.didCancel, &result)
+					if err != nil {
+						return OnResolveResult{}, err
+					}
+					sideEffects := SideEffectsTrue
+					if result.SideEffects != nil && !*result.SideEffects {
+						sideEffects = SideEffectsFalse
+					}
+					response := OnResolveResult{
+						Errors:      convertProcessMessages(result.Errors),
+						Warnings:    convertProcessMessages(result.Warnings),
+						Path:        result.Path,
+						External:    result.External,
+						SideEffects: sideEffects,
+						Namespace:   result.Namespace,
+						Suffix:      result.Suffix,
+						WatchFiles:  result.WatchFiles,
+						WatchDirs:   result.WatchDirs,
+					}
+					if result.PluginData != nil {
+						response.PluginData = result.PluginData
+					}
+					return response, nil
+				})
+			}
+
+			for _, callback := range setup.OnLoad {
+				id := callback.ID
+				build.OnLoad(OnLoadOptions{Filter: callback.Filter, Namespace: callback.Namespace}, func(args OnLoadArgs) (OnLoadResult, error) {
+					var result processOnLoadResult
+					err := p.call("onLoad", processOnLoadParams{
+						ID:         id,
+						Path:       args.Path,
+						Namespace:  args.Namespace,
+						Suffix:     args.Suffix,
+						PluginData: processPluginData(args.PluginData),
+						With:       args.With,
+					}, args.didCancel, &result)
+					if err != nil {
+						return OnLoadResult{}, err
+					}
+					loader := LoaderNone
+					if result.Loader != "" {
+						var ok bool
+						if loader, ok = processLoader(result.Loader); !ok {
+							return OnLoadResult{}, fmt.Errorf("Invalid loader %q returned from plugin process", result.Loader)
+						}
+					}
+					response := OnLoadResult{
+						Errors:     convertProcessMessages(result.Errors),
+						Warnings:   convertProcessMessages(result.Warnings),
+						Contents:   result.Contents,
+						ResolveDir: result.ResolveDir,
+						Loader:     loader,
+						SourceMap:  result.SourceMap,
+						WatchFiles: result.WatchFiles,
+						WatchDirs:  result.WatchDirs,
+					}
+					if result.PluginData != nil {
+						response.PluginData = result.PluginData
+					}
+					return response, nil
+				})
+			}
+
+			if setup.OnEnd {
+				build.OnEnd(func(buildResult *BuildResult) (OnEndResult, error) {
+					var result processMessages
+					if err := p.call("onEnd", processMessages{
+						Errors:   convertMessagesToProcess(buildResult.Errors),
+						Warnings: convertMessagesToProcess(buildResult.Warnings),
+					}, nil, &result); err != nil {
+						return OnEndResult{}, err
+					}
+					return OnEndResult{
+						Errors:   convertProcessMessages(result.Errors),
+						Warnings: convertProcessMessages(result.Warnings),
+					}, nil
+				})
+			}
+		},
+	}
+}
+
+func startProcessPlugin(options ProcessPluginOptions) (*processPlugin, processSetupResult, error) {
+	var setup processSetupResult
+	if options.Command == "" {
+		return nil, setup, errors.New("Missing command")
+	}
+
+	cmd := exec.Command(options.Command, options.Args...)
+	cmd.Dir = options.Dir
+	cmd.Stderr = os.Stderr
+	if options.Env != nil {
+		cmd.Env = append(os.Environ(), options.Env...)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, setup, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, setup, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, setup, err
+	}
+
+	p := &processPlugin{
+		cmd:     cmd,
+		stdin:   stdin,
+		exited:  make(chan struct{}),
+		pending: make(map[int]chan processResponse),
+	}
+	go p.readResponses(stdout)
+
+	if err := p.call("setup", struct {
+		Name string `json:"name"`
+	}{Name: options.Name}, nil, &setup); err != nil {
+		p.dispose()
+		return nil, setup, err
+	}
+	return p, setup, nil
+}
+
+func (p *processPlugin) readResponses(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, 1<<30)
+	for scanner.Scan() {
+		var response processResponse
+		if err := json.Unmarshal(scanner.Bytes(), &response); err != nil || response.ID == nil {
+			// Ignore anything that isn't a response, such as notifications
+			continue
+		}
+		p.mutex.Lock()
+		ch := p.pending[*response.ID]
+		delete(p.pending, *response.ID)
+		p.mutex.Unlock()
+		if ch != nil {
+			ch <- response
+		}
+	}
+
+	// Fail all pending and future requests once the child closes its stdout
+	p.mutex.Lock()
+	p.err = errors.New("The plugin process exited unexpectedly")
+	if err := scanner.Err(); err != nil {
+		p.err = fmt.Errorf("Failed to read from the plugin process: %s", err.Error())
+	}
+	for id, ch := range p.pending {
+		delete(p.pending, id)
+		close(ch)
+	}
+	p.mutex.Unlock()
+	p.cmd.Wait()
+	close(p.exited)
+}
+
+func (p *processPlugin) write(request processRequest) error {
+	bytes, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	bytes = append(bytes, '\n')
+
+	// Don't interleave concurrent messages
+	p.writeMutex.Lock()
+	defer p.writeMutex.Unlock()
+	_, err = p.stdin.Write(bytes)
+	return err
+}
+
+// This sends a request to the child and waits for the response. It stops
+// waiting and returns an error if the build is canceled in the meantime.
+func (p *processPlugin) call(method string, params interface{}, didCancel func() bool, result interface{}) error {
+	p.mutex.Lock()
+	if p.err != nil {
+		p.mutex.Unlock()
+		return p.err
+	}
+	id := p.nextID
+	p.nextID++
+	ch := make(chan processResponse, 1)
+	p.pending[id] = ch
+	p.mutex.Unlock()
+
+	if err := p.write(processRequest{JSONRPC: "2.0", ID: &id, Method: method, Params: params}); err != nil {
+		p.mutex.Lock()
+		delete(p.pending, id)
+		p.mutex.Unlock()
+		return err
+	}
+
+	var response processResponse
+	var ok bool
+	if didCancel == nil {
+		response, ok = <-ch
+	} else {
+		// There's no way to be notified of cancellation, so poll for it
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+	loop:
+		for {
+			select {
+			case response, ok = <-ch:
+				break loop
+			case <-ticker.C:
+				if didCancel() {
+					p.mutex.Lock()
+					delete(p.pending, id)
+					p.mutex.Unlock()
+					p.write(processRequest{JSONRPC: "2.0", Method: "$/cancelRequest", Params: struct {
+						ID int `json:"id"`
+					}{ID: id}})
+					return errors.New("The build was canceled")
+				}
+			}
+		}
+	}
+
+	if !ok {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		return p.err
+	}
+	if response.Error != nil {
+		return errors.New(response.Error.Message)
+	}
+	if len(response.Result) == 0 || string(response.Result) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("Invalid %q response from plugin process: %s", method, err.Error())
+	}
+	return nil
+}
+
+func (p *processPlugin) dispose() {
+	p.stdin.Close()
+
+	// Give the child a moment to exit on its own before killing it
+	select {
+	case <-p.exited:
+	case <-time.After(time.Second):
+		p.cmd.Process.Kill()
+		<-p.exited
+	}
+}
+
+// Only plugin data that came from the child is sent back to the child. Plugin
+// data from other plugins can't necessarily be serialized.
+func processPluginData(pluginData interface{}) json.RawMessage {
+	if data, ok := pluginData.(json.RawMessage); ok {
+		return data
+	}
+	return nil
+}
+
+// These use the same names as "config.LoaderToString"
+var processLoaders = map[string]Loader{
+	"base64":     LoaderBase64,
+	"binary":     LoaderBinary,
+	"copy":       LoaderCopy,
+	"css":        LoaderCSS,
+	"dataurl":    LoaderDataURL,
+	"default":    LoaderDefault,
+	"empty":      LoaderEmpty,
+	"file":       LoaderFile,
+	"global-css": LoaderGlobalCSS,
+	"html":       LoaderHTML,
+	"js":         LoaderJS,
+	"json":       LoaderJSON,
+	"jsx":        LoaderJSX,
+	"local-css":  LoaderLocalCSS,
+	"text":       LoaderText,
+	"ts":         LoaderTS,
+	"tsx":        LoaderTSX,
+}
+
+func processLoader(name string) (Loader, bool) {
+	loader, ok := processLoaders[name]
+	return loader, ok
+}
+
+func convertProcessLocation(loc *processLocation) *Location {
+	if loc == nil {
+		return nil
+	}
+	return &Location{
+		File:       loc.File,
+		Namespace:  loc.Namespace,
+		Line:       loc.Line,
+		Column:     loc.Column,
+		Length:     loc.Length,
+		LineText:   loc.LineText,
+		Suggestion: loc.Suggestion,
+	}
+}
+
+func convertProcessMessages(msgs []processMessage) []Message {
+	var result []Message
+	for _, msg := range msgs {
+		var notes []Note
+		for _, note := range msg.Notes {
+			notes = append(notes, Note{
+				Text:     note.Text,
+				Location: convertProcessLocation(note.Location),
+			})
+		}
+		result = append(result, Message{
+			ID:       msg.ID,
+			Text:     msg.Text,
+			Location: convertProcessLocation(msg.Location),
+			Notes:    notes,
+		})
+	}
+	return result
+}
+
+func convertLocationToProcess(loc *Location) *processLocation {
+	if loc == nil {
+		return nil
+	}
+	return &processLocation{
+		File:       loc.File,
+		Namespace:  loc.Namespace,
+		Line:       loc.Line,
+		Column:     loc.Column,
+		Length:     loc.Length,
+		LineText:   loc.LineText,
+		Suggestion: loc.Suggestion,
+	}
+}
+
+func convertMessagesToProcess(msgs []Message) []processMessage {
+	result := []processMessage{}
+	for _, msg := range msgs {
+		var notes []processNote
+		for _, note := range msg.Notes {
+			notes = append(notes, processNote{
+				Text:     note.Text,
+				Location: convertLocationToProcess(note.Location),
+			})
+		}
+		result = append(result, processMessage{
+			ID:       msg.ID,
+			Text:     msg.Text,
+			Location: convertLocationToProcess(msg.Location),
+			Notes:    notes,
+		})
+	}
+	return result
+}
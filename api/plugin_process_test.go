@@ -0,0 +1,248 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ije/esbuild-internal/config"
+)
+
+// This isn't a real test. The process plugin tests run the test binary again
+// with this environment variable set, and it then acts as the plugin process.
+const processPluginTestMode = "ESBUILD_TEST_PROCESS_PLUGIN"
+
+func TestProcessPluginHelper(t *testing.T) {
+	mode := os.Getenv(processPluginTestMode)
+	if mode == "" {
+		return
+	}
+
+	// Record every method we receive so the tests can check for notifications
+	logFile, err := os.OpenFile(os.Getenv(processPluginTestMode+"_LOG"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var request struct {
+			ID     *int            `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			os.Exit(1)
+		}
+		fmt.Fprintf(logFile, "%s %s\n", request.Method, request.Params)
+
+		var result interface{}
+		switch request.Method {
+		case "setup":
+			result = processSetupResult{
+				OnResolve: []processCallback{{ID: 0, Filter: "^virtual:"}},
+				OnLoad:    []processCallback{{ID: 1, Filter: ".*", Namespace: "virtual"}},
+			}
+
+		case "onResolve":
+			var params processOnResolveParams
+			json.Unmarshal(request.Params, &params)
+			result = processOnResolveResult{
+				Path:       strings.TrimPrefix(params.Path, "virtual:"),
+				Namespace:  "virtual",
+				PluginData: json.RawMessage(`{"importer":"` + params.Importer + `"}`),
+			}
+
+		case "onLoad":
+			var params processOnLoadParams
+			json.Unmarshal(request.Params, &params)
+			if params.Path == "hang" {
+				// Never respond so that the request has to be canceled
+				continue
+			}
+			if params.Path == "data.txt" {
+				// This checks a loader other than the JavaScript ones
+				contents := "some text"
+				result = processOnLoadResult{Contents: &contents, Loader: "text"}
+				break
+			}
+			contents := fmt.Sprintf("export default [%q, %s]", params.Path, params.PluginData)
+			result = processOnLoadResult{Contents: &contents, Loader: "js"}
+
+		default:
+			continue
+		}
+
+		bytes, _ := json.Marshal(struct {
+			JSONRPC string      `json:"jsonrpc"`
+			ID      *int        `json:"id"`
+			Result  interface{} `json:"result"`
+		}{JSONRPC: "2.0", ID: request.ID, Result: result})
+		os.Stdout.Write(append(bytes, '\n'))
+	}
+
+	// A well-behaved plugin exits when its stdin is closed
+	if mode == "ignore-close" {
+		time.Sleep(time.Hour)
+	}
+	os.Exit(0)
+}
+
+func startTestProcessPlugin(t *testing.T, mode string) (*processPlugin, string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "esbuild-process-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(dir, "log.txt")
+	options := ProcessPluginOptions{
+		Name:    "test",
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^TestProcessPluginHelper$"},
+		Env:     []string{processPluginTestMode + "=" + mode, processPluginTestMode + "_LOG=" + logPath},
+	}
+	p, setup, err := startProcessPlugin(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(setup.OnResolve) != 1 || len(setup.OnLoad) != 1 {
+		t.Fatalf("Unexpected setup result: %+v", setup)
+	}
+	return p, logPath
+}
+
+func TestProcessPluginBuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "esbuild-process-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	result := Build(BuildOptions{
+		EntryPoints: []string{"virtual:entry"},
+		Bundle:      true,
+		Format:      FormatESModule,
+		Write:       false,
+		Outfile:     filepath.Join(dir, "out.js"),
+		Plugins: []Plugin{ProcessPlugin(ProcessPluginOptions{
+			Name:    "test",
+			Command: os.Args[0],
+			Args:    []string{"-test.run=^TestProcessPluginHelper$"},
+			Env:     []string{processPluginTestMode + "=normal", processPluginTestMode + "_LOG=" + filepath.Join(dir, "log.txt")},
+		})},
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %+v", result.Errors)
+	}
+	if len(result.OutputFiles) != 1 {
+		t.Fatalf("Expected one output file but got %d", len(result.OutputFiles))
+	}
+
+	// The plugin data from "onResolve" must be passed back to "onLoad"
+	if contents := string(result.OutputFiles[0].Contents); !strings.Contains(contents, `["entry", { "importer": "" }]`) {
+		t.Fatalf("Unexpected output:\n%s", contents)
+	}
+}
+
+func TestProcessPluginTextLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "esbuild-process-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	result := Build(BuildOptions{
+		EntryPoints: []string{"virtual:data.txt"},
+		Bundle:      true,
+		Format:      FormatCommonJS,
+		Write:       false,
+		Outfile:     filepath.Join(dir, "out.js"),
+		Plugins: []Plugin{ProcessPlugin(ProcessPluginOptions{
+			Name:    "test",
+			Command: os.Args[0],
+			Args:    []string{"-test.run=^TestProcessPluginHelper$"},
+			Env:     []string{processPluginTestMode + "=normal", processPluginTestMode + "_LOG=" + filepath.Join(dir, "log.txt")},
+		})},
+	})
+	if len(result.Errors) > 0 {
+		t.Fatalf("Unexpected errors: %+v", result.Errors)
+	}
+	if len(result.OutputFiles) != 1 {
+		t.Fatalf("Expected one output file but got %d", len(result.OutputFiles))
+	}
+	if contents := string(result.OutputFiles[0].Contents); !strings.Contains(contents, `var data_default = "some text";`) {
+		t.Fatalf("Unexpected output:\n%s", contents)
+	}
+}
+
+func TestProcessLoaderNames(t *testing.T) {
+	for _, name := range config.LoaderToString {
+		loader, ok := processLoader(name)
+		if name == "none" {
+			if ok {
+				t.Fatalf("Expected %q to be an invalid loader", name)
+			}
+			continue
+		}
+		if !ok {
+			t.Fatalf("Expected %q to be a valid loader", name)
+		}
+		if text := config.LoaderToString[validateLoader(loader)]; text != name {
+			t.Fatalf("Expected %q to map to itself but got %q", name, text)
+		}
+	}
+}
+
+func TestProcessPluginCancel(t *testing.T) {
+	p, logPath := startTestProcessPlugin(t, "normal")
+	defer os.RemoveAll(filepath.Dir(logPath))
+	defer p.dispose()
+
+	var result processOnLoadResult
+	err := p.call("onLoad", processOnLoadParams{ID: 1, Path: "hang", Namespace: "virtual"}, func() bool { return true }, &result)
+	if err == nil || err.Error() != "The build was canceled" {
+		t.Fatalf("Expected the request to be canceled but got %v", err)
+	}
+
+	// The request above is the second one after "setup"
+	expected := `$/cancelRequest {"id":1}`
+	for start := time.Now(); ; {
+		contents, _ := ioutil.ReadFile(logPath)
+		if strings.Contains(string(contents), expected) {
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("Expected %q in the plugin log:\n%s", expected, contents)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Requests still work after a cancellation
+	if err := p.call("onLoad", processOnLoadParams{ID: 1, Path: "next", Namespace: "virtual"}, nil, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Contents == nil || *result.Contents != `export default ["next", null]` {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+}
+
+func TestProcessPluginDisposeKillsProcess(t *testing.T) {
+	p, logPath := startTestProcessPlugin(t, "ignore-close")
+	defer os.RemoveAll(filepath.Dir(logPath))
+
+	p.dispose()
+	select {
+	case <-p.exited:
+	default:
+		t.Fatal("Expected the plugin process to have exited")
+	}
+	if p.cmd.ProcessState == nil || p.cmd.ProcessState.Success() {
+		t.Fatalf("Expected the plugin process to have been killed: %v", p.cmd.ProcessState)
+	}
+}
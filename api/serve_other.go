@@ -562,6 +562,16 @@ func (h *apiHandler) broadcastBuildResult(result BuildResult, newHashes map[stri
 	h.mutex.Unlock()
 }
 
+// This sends the code for changed modules to the hot module replacement
+// runtime. See "hotUpdateJSON" for the format of the data.
+func (h *apiHandler) broadcastHotUpdate(json string) {
+	h.mutex.Lock()
+	for _, stream := range h.activeStreams {
+		stream <- serverSentEvent{event: "hmr", data: json}
+	}
+	h.mutex.Unlock()
+}
+
 // Handle enough of the range specification so that video playback works in Safari
 func parseRangeHeader(r string, contentLength int) (int, int, bool) {
 	if strings.HasPrefix(r, "bytes=") {
@@ -17,5 +17,8 @@ type apiHandler struct {
 func (*apiHandler) broadcastBuildResult(BuildResult, map[string]string) {
 }
 
+func (*apiHandler) broadcastHotUpdate(string) {
+}
+
 func (*apiHandler) stop() {
 }
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ije/esbuild-internal/logger"
+	"github.com/ije/esbuild-internal/test"
+)
+
+// Precompressed copies of output files are shown as extra columns in the
+// row for the original file instead of as separate rows
+func TestPrintSummaryCompressedColumns(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputFiles := []OutputFile{
+		{Path: filepath.Join(cwd, "out", "entry.js"), Contents: make([]byte, 4096)},
+		{Path: filepath.Join(cwd, "out", "entry.js.gz"), Contents: make([]byte, 1200)},
+		{Path: filepath.Join(cwd, "out", "entry.js.br"), Contents: make([]byte, 1000)},
+		{Path: filepath.Join(cwd, "out", "small.js"), Contents: make([]byte, 10)},
+	}
+
+	// Capture what's written to stderr
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = writer
+	printSummary(logger.ColorNever, outputFiles, true, time.Now())
+	os.Stderr = stderr
+	writer.Close()
+	output, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ignore the blank line at the start and the time taken at the end
+	text := strings.TrimPrefix(string(output), "\n")
+	if i := strings.Index(text, "\n\n"); i != -1 {
+		text = text[:i+1]
+	}
+	sep := string(filepath.Separator)
+	test.AssertEqualWithDiff(t, text, ""+
+		"  out"+sep+"entry.js  4.0kb  gzip 1.2kb  br 1000b \n"+
+		"  out"+sep+"small.js   10b                        \n")
+}
@@ -0,0 +1,19 @@
+package api
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// The persistent build cache is keyed by this version, so it must not drift
+// from the version of the code that's actually being built
+func TestVersionMatchesVersionTxt(t *testing.T) {
+	contents, err := ioutil.ReadFile("../version.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version := strings.TrimSpace(string(contents)); version != esbuildVersion {
+		t.Fatalf("Expected version %q from version.txt but got %q", version, esbuildVersion)
+	}
+}
@@ -21,11 +21,20 @@ package api
 // change's path goes on a short list of recently changed paths which are
 // checked on every scan, so further changes to recently changed files should
 // be noticed almost instantly.
+//
+// On platforms where it's supported (currently Linux via inotify), there is
+// also a native backend that is used by default. It waits for the operating
+// system to report activity in a watched directory instead of scanning, and
+// then runs the same dirty checks as the polling backend on the reported paths
+// to confirm that something actually changed. Polling remains the fallback
+// everywhere else, and for any directories that the native backend fails to
+// watch.
 
 import (
 	"fmt"
 	"math/rand"
 	"os"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -47,9 +56,25 @@ const minItemCountPerIter = 64
 // The maximum number of intervals before a change is detected
 const maxIntervalsBeforeUpdate = 20
 
+// This is implemented by platform-specific file change notification APIs
+type nativeWatcher interface {
+	// Replace the set of watched paths with the directories relevant to these
+	// paths. Paths that are files cause their parent directory to be watched.
+	// Paths that couldn't be watched are returned along with the first error.
+	watchPaths(paths map[string]func() string) (unwatched []string, err error)
+
+	// Wait up to the timeout for change notifications and return the paths that
+	// may have changed. If notifications were lost (e.g. due to a queue overflow)
+	// then "overflow" is true and every path should be checked.
+	readChangedPaths(timeout time.Duration) (paths []string, overflow bool)
+
+	close()
+}
+
 type watcher struct {
 	data              fs.WatchData
 	fs                fs.FS
+	native            nativeWatcher
 	rebuild           func() fs.WatchData
 	delayInMS         time.Duration
 	recentItems       []string
@@ -61,6 +86,46 @@ type watcher struct {
 	useColor          logger.UseColor
 	pathStyle         logger.PathStyle
 	stopWaitGroup     sync.WaitGroup
+
+	// The native backend may miss changes that happened between reading a file
+	// during a build and starting to watch its directory, so everything is
+	// checked once after each build
+	needsFullScan bool
+	// These paths are checked on the next iteration. This is used for changes
+	// that the operating system doesn't know about, such as to in-memory files.
+	pendingPaths []string
+	// These paths couldn't be watched by the native backend, so they are polled
+	// instead. This happens when the operating system's watch limit is reached.
+	unwatchedPaths     map[string]bool
+	didWarnAboutNative bool
+}
+
+func (w *watcher) checkPathsSoon(paths []string) {
+	defer w.mutex.Unlock()
+	w.mutex.Lock()
+	w.pendingPaths = append(w.pendingPaths, paths...)
+}
+
+// This must be called while holding the mutex
+func (w *watcher) tryToFindDirtyPendingPath() string {
+	paths := w.pendingPaths
+	w.pendingPaths = nil
+	for _, path := range paths {
+		// Also check all parent directories since the path may be in a new directory
+		for {
+			if isDirty := w.data.Paths[path]; isDirty != nil {
+				if dirtyPath := isDirty(); dirtyPath != "" {
+					return dirtyPath
+				}
+			}
+			dir := w.fs.Dir(path)
+			if dir == path {
+				break
+			}
+			path = dir
+		}
+	}
+	return ""
 }
 
 func (w *watcher) setWatchData(data fs.WatchData) {
@@ -81,6 +146,25 @@ func (w *watcher) setWatchData(data fs.WatchData) {
 	w.data = data
 	w.itemsToScan = w.itemsToScan[:0] // Reuse memory
 
+	if w.native != nil {
+		unwatched, err := w.native.watchPaths(data.Paths)
+		w.needsFullScan = true
+		w.unwatchedPaths = nil
+		if len(unwatched) > 0 {
+			w.unwatchedPaths = make(map[string]bool, len(unwatched))
+			for _, path := range unwatched {
+				w.unwatchedPaths[path] = true
+			}
+			if w.shouldLog && !w.didWarnAboutNative {
+				w.didWarnAboutNative = true
+				logger.PrintTextWithColor(os.Stderr, w.useColor, func(colors logger.Colors) string {
+					return fmt.Sprintf("%s[watch] %s (falling back to polling for %d paths)%s\n",
+						colors.Yellow, err.Error(), len(unwatched), colors.Reset)
+				})
+			}
+		}
+	}
+
 	// Remove any recent items that weren't a part of the latest build
 	end := 0
 	for _, path := range w.recentItems {
@@ -101,11 +185,18 @@ func (w *watcher) start() {
 		// messages instead of using esbuild's API.
 
 		for atomic.LoadInt32(&w.shouldStop) == 0 {
-			// Sleep for the watch interval
-			time.Sleep(watchIntervalSleep)
+			var absPath string
+			if w.native != nil {
+				// Wait for the operating system to tell us about changes
+				absPath = w.tryToFindDirtyPathFromNative()
+			} else {
+				// Sleep for the watch interval
+				time.Sleep(watchIntervalSleep)
+				absPath = w.tryToFindDirtyPath()
+			}
 
 			// Rebuild if we're dirty
-			if absPath := w.tryToFindDirtyPath(); absPath != "" {
+			if absPath != "" {
 				// Optionally wait before rebuilding
 				if w.delayInMS > 0 {
 					time.Sleep(w.delayInMS * time.Millisecond)
@@ -137,17 +228,77 @@ func (w *watcher) start() {
 func (w *watcher) stop() {
 	atomic.StoreInt32(&w.shouldStop, 1)
 	w.stopWaitGroup.Wait()
+	if w.native != nil {
+		w.native.close()
+	}
+}
+
+func (w *watcher) tryToFindDirtyPathFromNative() string {
+	// Block outside of the mutex so builds can update the watch data meanwhile
+	changedPaths, overflow := w.native.readChangedPaths(watchIntervalSleep)
+
+	defer w.mutex.Unlock()
+	w.mutex.Lock()
+
+	if dirtyPath := w.tryToFindDirtyPendingPath(); dirtyPath != "" {
+		return dirtyPath
+	}
+
+	// Check everything if we can't trust the notifications
+	if overflow || w.needsFullScan {
+		w.needsFullScan = false
+		paths := make([]string, 0, len(w.data.Paths))
+		for path := range w.data.Paths {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			if dirtyPath := w.data.Paths[path](); dirtyPath != "" {
+				return dirtyPath
+			}
+		}
+		return ""
+	}
+
+	// Otherwise only check the paths that were reported along with their parent
+	// directories, since creating or deleting a file changes the directory
+	for _, path := range changedPaths {
+		for _, candidate := range [2]string{path, w.fs.Dir(path)} {
+			if isDirty := w.data.Paths[candidate]; isDirty != nil {
+				if dirtyPath := isDirty(); dirtyPath != "" {
+					return dirtyPath
+				}
+			}
+		}
+	}
+
+	// Paths that the operating system isn't watching still have to be polled
+	if len(w.unwatchedPaths) > 0 {
+		return w.pollForDirtyPath()
+	}
+	return ""
 }
 
 func (w *watcher) tryToFindDirtyPath() string {
 	defer w.mutex.Unlock()
 	w.mutex.Lock()
 
+	if dirtyPath := w.tryToFindDirtyPendingPath(); dirtyPath != "" {
+		return dirtyPath
+	}
+	return w.pollForDirtyPath()
+}
+
+// This must be called while holding the mutex
+func (w *watcher) pollForDirtyPath() string {
 	// If we ran out of items to scan, fill the items back up in a random order
 	if len(w.itemsToScan) == 0 {
 		items := w.itemsToScan[:0] // Reuse memory
 		for path := range w.data.Paths {
-			items = append(items, path)
+			// Only poll the paths that the native backend isn't watching
+			if w.native == nil || w.unwatchedPaths[path] {
+				items = append(items, path)
+			}
 		}
 		rand.Seed(time.Now().UnixNano())
 		for i := int32(len(items) - 1); i > 0; i-- { // Fisher-Yates shuffle
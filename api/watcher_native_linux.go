@@ -0,0 +1,184 @@
+//go:build linux
+// +build linux
+
+package api
+
+// This file implements the native file watching backend using Linux's inotify
+// API. Directories are watched instead of individual files because many
+// editors save files by writing to a temporary file and then renaming it over
+// the original file, which would silently detach a watch on the original file.
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyWatchMask = unix.IN_ATTRIB |
+	unix.IN_CLOSE_WRITE |
+	unix.IN_CREATE |
+	unix.IN_DELETE |
+	unix.IN_DELETE_SELF |
+	unix.IN_MODIFY |
+	unix.IN_MOVE_SELF |
+	unix.IN_MOVED_FROM |
+	unix.IN_MOVED_TO |
+	unix.IN_ONLYDIR
+
+type inotifyWatcher struct {
+	mutex       sync.Mutex
+	fd          int
+	dirToWatch  map[string]int
+	watchToDir  map[int]string
+	knownNonDir map[string]bool
+	buffer      []byte
+}
+
+func newNativeWatcher() nativeWatcher {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		// Fall back to polling if inotify isn't available (e.g. we ran out of
+		// inotify instances, or we're running inside a restricted sandbox)
+		return nil
+	}
+	return &inotifyWatcher{
+		fd:          fd,
+		dirToWatch:  make(map[string]int),
+		watchToDir:  make(map[int]string),
+		knownNonDir: make(map[string]bool),
+		buffer:      make([]byte, 64*1024),
+	}
+}
+
+func (w *inotifyWatcher) watchPaths(paths map[string]func() string) (unwatched []string, err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// Watch each path if it's a directory, and also watch its parent directory
+	// so that files being created, deleted, or renamed are noticed
+	wanted := make(map[string]bool)
+	for path := range paths {
+		wanted[path] = true
+		wanted[filepath.Dir(path)] = true
+	}
+
+	// Stop watching directories that are no longer relevant
+	for dir, wd := range w.dirToWatch {
+		if !wanted[dir] {
+			unix.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.dirToWatch, dir)
+			delete(w.watchToDir, wd)
+		}
+	}
+	for path := range w.knownNonDir {
+		if !wanted[path] {
+			delete(w.knownNonDir, path)
+		}
+	}
+
+	// Start watching new directories. Adding a watch fails for paths that
+	// aren't directories (because of "IN_ONLYDIR") or that don't exist. Any
+	// missing directories will still be noticed by a watch on their parent.
+	// Other failures (e.g. "ENOSPC" when the inotify watch limit is reached or
+	// "EACCES") mean changes in that directory won't be reported.
+	failed := make(map[string]bool)
+	for dir := range wanted {
+		if _, ok := w.dirToWatch[dir]; ok || w.knownNonDir[dir] {
+			continue
+		}
+		wd, addErr := unix.InotifyAddWatch(w.fd, dir, inotifyWatchMask)
+		if addErr != nil {
+			if addErr == unix.ENOTDIR {
+				w.knownNonDir[dir] = true
+			} else if addErr != unix.ENOENT {
+				failed[dir] = true
+				if err == nil {
+					err = fmt.Errorf("Failed to watch %q: %s", dir, addErr.Error())
+				}
+			}
+			continue
+		}
+		delete(w.knownNonDir, dir)
+		w.dirToWatch[dir] = wd
+		w.watchToDir[wd] = dir
+	}
+
+	// These paths have to be polled instead
+	for path := range paths {
+		if failed[path] || failed[filepath.Dir(path)] {
+			unwatched = append(unwatched, path)
+		}
+	}
+	return
+}
+
+func (w *inotifyWatcher) readChangedPaths(timeout time.Duration) (paths []string, overflow bool) {
+	fds := []unix.PollFd{{Fd: int32(w.fd), Events: unix.POLLIN}}
+	if n, err := unix.Poll(fds, int(timeout/time.Millisecond)); err != nil || n == 0 {
+		return
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	seen := make(map[string]bool)
+
+	for {
+		n, err := unix.Read(w.fd, w.buffer)
+		if err != nil || n <= 0 {
+			// This is "EAGAIN" once all queued events have been read
+			break
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&w.buffer[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			offset = nameStart + int(event.Len)
+
+			if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+				overflow = true
+				continue
+			}
+			dir, ok := w.watchToDir[int(event.Wd)]
+			if !ok {
+				continue
+			}
+
+			// The kernel automatically removes the watch when the directory is
+			// deleted, so forget about it. It will be re-added after the rebuild
+			// if it still matters.
+			if event.Mask&unix.IN_IGNORED != 0 {
+				delete(w.dirToWatch, dir)
+				delete(w.watchToDir, int(event.Wd))
+			}
+
+			// The name is padded with null bytes
+			path := dir
+			if event.Len > 0 {
+				name := w.buffer[nameStart:offset]
+				for len(name) > 0 && name[len(name)-1] == 0 {
+					name = name[:len(name)-1]
+				}
+				path = filepath.Join(dir, string(name))
+			}
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+
+			// A file that changed may have been replaced by a directory, so try
+			// to watch it again next time
+			delete(w.knownNonDir, path)
+		}
+	}
+	return
+}
+
+func (w *inotifyWatcher) close() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	unix.Close(w.fd)
+}
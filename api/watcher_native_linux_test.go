@@ -0,0 +1,68 @@
+//go:build linux
+// +build linux
+
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ije/esbuild-internal/fs"
+)
+
+func TestNativeWatcherReportsEditedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "esbuild-watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "entry.js")
+	if err := ioutil.WriteFile(file, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	native := newNativeWatcher()
+	if native == nil {
+		t.Skip("inotify is not available")
+	}
+	realFS, err := fs.RealFS(fs.RealFSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &watcher{fs: realFS, native: native}
+	defer native.close()
+	w.setWatchData(fs.WatchData{Paths: map[string]func() string{
+		file: func() string {
+			if contents, err := ioutil.ReadFile(file); err != nil || string(contents) != "old" {
+				return file
+			}
+			return ""
+		},
+	}})
+	if len(w.unwatchedPaths) != 0 {
+		t.Fatalf("Expected every path to be watched: %v", w.unwatchedPaths)
+	}
+
+	// Nothing has changed yet (this does the full scan after a build)
+	if dirtyPath := w.tryToFindDirtyPathFromNative(); dirtyPath != "" {
+		t.Fatalf("Unexpected dirty path %q", dirtyPath)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for start := time.Now(); ; {
+		if dirtyPath := w.tryToFindDirtyPathFromNative(); dirtyPath != "" {
+			if dirtyPath != file {
+				t.Fatalf("Expected %q to be dirty but got %q", file, dirtyPath)
+			}
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatal("Expected the edited file to be reported as dirty")
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package api
+
+// There is no native file watching backend for this platform yet, so the
+// watcher always falls back to polling
+func newNativeWatcher() nativeWatcher {
+	return nil
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ije/esbuild-internal/fs"
+)
+
+// This native backend never reports any changes and fails to watch anything
+type failingNativeWatcher struct{}
+
+func (*failingNativeWatcher) watchPaths(paths map[string]func() string) (unwatched []string, err error) {
+	for path := range paths {
+		unwatched = append(unwatched, path)
+	}
+	return
+}
+
+func (*failingNativeWatcher) readChangedPaths(timeout time.Duration) (paths []string, overflow bool) {
+	return
+}
+
+func (*failingNativeWatcher) close() {
+}
+
+func TestWatcherPollsUnwatchedPaths(t *testing.T) {
+	dirty := ""
+	w := &watcher{fs: fs.MockFS(nil, fs.MockUnix, "/"), native: &failingNativeWatcher{}}
+	w.setWatchData(fs.WatchData{Paths: map[string]func() string{
+		"/entry.js": func() string { return dirty },
+	}})
+
+	// Nothing has changed yet (this does the full scan after a build)
+	if dirtyPath := w.tryToFindDirtyPathFromNative(); dirtyPath != "" {
+		t.Fatalf("Unexpected dirty path %q", dirtyPath)
+	}
+	if dirtyPath := w.tryToFindDirtyPathFromNative(); dirtyPath != "" {
+		t.Fatalf("Unexpected dirty path %q", dirtyPath)
+	}
+
+	// The change must be found even though the native backend didn't report it
+	dirty = "/entry.js"
+	if dirtyPath := w.tryToFindDirtyPathFromNative(); dirtyPath != "/entry.js" {
+		t.Fatalf("Expected %q to be dirty but got %q", "/entry.js", dirtyPath)
+	}
+}
@@ -38,6 +38,13 @@ const (
 
 	// A CSS "url(...)" token
 	ImportURL
+
+	// A JS "new URL('./file', import.meta.url)" expression
+	ImportNewURL
+
+	// A JS "new Worker(new URL('./file', import.meta.url))" expression. This
+	// also covers "new SharedWorker(...)".
+	ImportNewWorker
 )
 
 func (kind ImportKind) StringForMetafile() string {
@@ -56,6 +63,10 @@ func (kind ImportKind) StringForMetafile() string {
 		return "composes-from"
 	case ImportURL:
 		return "url-token"
+	case ImportNewURL:
+		return "new-url"
+	case ImportNewWorker:
+		return "new-worker"
 	case ImportEntryPoint:
 		return "entry-point"
 	default:
@@ -0,0 +1,340 @@
+// Package brotli implements a compressor for the Brotli format as described
+// in RFC 7932 (https://www.rfc-editor.org/rfc/rfc7932).
+//
+// This only implements the subset of the format that's needed to produce
+// reasonably small output quickly. Matches are found using a hash chain with
+// one step of lazy matching, and each meta-block uses a single prefix code
+// for each of the literal, command, and distance alphabets. The static
+// dictionary, block splitting, and context modeling are not used, so output
+// is somewhat larger than what the reference encoder generates at its higher
+// quality levels. There is no decompressor.
+package brotli
+
+import "encoding/binary"
+
+const (
+	windowBits  = 22
+	maxDistance = (1 << windowBits) - 16
+
+	// The input is split into meta-blocks of at most this many bytes. Each
+	// meta-block gets its own prefix codes, which lets the codes adapt to
+	// different kinds of data in different parts of the input.
+	maxMetaBlockLength = 1 << 20
+
+	hashBits       = 16
+	maxChainLength = 64
+	minMatchLength = 4
+	maxMatchLength = 1 << 16
+)
+
+// Encode returns the Brotli-compressed form of the given data
+func Encode(data []byte) []byte {
+	e := encoder{
+		data:         data,
+		head:         make([]int32, 1<<hashBits),
+		prev:         make([]int32, len(data)),
+		lastDistance: 4, // The initial value of the last distance in the ring buffer
+	}
+	for i := range e.head {
+		e.head[i] = -1
+	}
+
+	// Stream header: the window size
+	e.w.writeBits(1, 1)
+	e.w.writeBits(3, windowBits-17)
+
+	for start := 0; start < len(data); start += maxMetaBlockLength {
+		end := start + maxMetaBlockLength
+		if end > len(data) {
+			end = len(data)
+		}
+		e.writeMetaBlock(start, end)
+	}
+
+	// The stream ends with an empty meta-block with "ISLAST" set
+	e.w.writeBits(1, 1) // ISLAST
+	e.w.writeBits(1, 1) // ISLASTEMPTY
+	e.w.alignToByte()
+	return e.w.buf
+}
+
+type encoder struct {
+	w            bitWriter
+	data         []byte
+	head         []int32
+	prev         []int32
+	hashedUpTo   int
+	lastDistance int
+}
+
+// A command inserts some literals and then copies some bytes from earlier in
+// the data. The last command in a meta-block may not have a copy.
+type command struct {
+	insertLength int
+	copyLength   int
+	distance     int
+
+	insertCode   uint8
+	copyCode     uint8
+	commandCode  uint16
+	distanceCode uint16
+	distanceBits uint8
+	distanceRest uint32
+}
+
+func (e *encoder) writeMetaBlock(start int, end int) {
+	// Remember the state before this meta-block in case it ends up larger
+	// than the uncompressed data and must be written uncompressed instead
+	saved := e.w
+	savedLastDistance := e.lastDistance
+
+	commands := e.findCommands(start, end)
+
+	// Compute the histograms
+	var literalHistogram [256]uint32
+	var commandHistogram [numCommandCodes]uint32
+	var distanceHistogram [numDistanceCodes]uint32
+	pos := start
+	for i := range commands {
+		cmd := &commands[i]
+		for _, c := range e.data[pos : pos+cmd.insertLength] {
+			literalHistogram[c]++
+		}
+		pos += cmd.insertLength + cmd.copyLength
+		e.assignCodes(cmd)
+		commandHistogram[cmd.commandCode]++
+		if cmd.hasExplicitDistance() {
+			distanceHistogram[cmd.distanceCode]++
+		}
+	}
+
+	// Meta-block header
+	e.writeMetaBlockLength(end - start)
+	e.w.writeBits(1, 0) // ISUNCOMPRESSED
+	e.w.writeBits(1, 0) // NBLTYPESL - 1 = 0
+	e.w.writeBits(1, 0) // NBLTYPESI - 1 = 0
+	e.w.writeBits(1, 0) // NBLTYPESD - 1 = 0
+	e.w.writeBits(2, 0) // NPOSTFIX
+	e.w.writeBits(4, 0) // NDIRECT >> NPOSTFIX
+	e.w.writeBits(2, 0) // Context mode for the single literal block type
+	e.w.writeBits(1, 0) // NTREESL - 1 = 0
+	e.w.writeBits(1, 0) // NTREESD - 1 = 0
+
+	literalCode := e.w.writePrefixCode(literalHistogram[:], 8)
+	commandCode := e.w.writePrefixCode(commandHistogram[:], 10)
+	distanceCode := e.w.writePrefixCode(distanceHistogram[:], 6)
+
+	// Meta-block data
+	pos = start
+	for i := range commands {
+		cmd := &commands[i]
+		commandCode.writeSymbol(&e.w, int(cmd.commandCode))
+		insert := insertLengthCodes[cmd.insertCode]
+		e.w.writeBits(uint(insert.extraBits), uint64(cmd.insertLength-insert.base))
+		if cmd.copyLength > 0 {
+			copy := copyLengthCodes[cmd.copyCode]
+			e.w.writeBits(uint(copy.extraBits), uint64(cmd.copyLength-copy.base))
+		}
+		for _, c := range e.data[pos : pos+cmd.insertLength] {
+			literalCode.writeSymbol(&e.w, int(c))
+		}
+		pos += cmd.insertLength + cmd.copyLength
+		if cmd.hasExplicitDistance() {
+			distanceCode.writeSymbol(&e.w, int(cmd.distanceCode))
+			e.w.writeBits(uint(cmd.distanceBits), uint64(cmd.distanceRest))
+		}
+	}
+
+	// Fall back to an uncompressed meta-block if compression didn't help
+	if len(e.w.buf)-len(saved.buf) > end-start+8 {
+		e.w = saved
+		e.w.buf = e.w.buf[:len(saved.buf)]
+		e.lastDistance = savedLastDistance
+		e.writeMetaBlockLength(end - start)
+		e.w.writeBits(1, 1) // ISUNCOMPRESSED
+		e.w.alignToByte()
+		e.w.buf = append(e.w.buf, e.data[start:end]...)
+	}
+}
+
+func (e *encoder) writeMetaBlockLength(length int) {
+	e.w.writeBits(1, 0) // ISLAST
+	nibbles := uint(4)
+	for nibbles < 6 && (length-1)>>(4*nibbles) != 0 {
+		nibbles++
+	}
+	e.w.writeBits(2, uint64(nibbles-4))
+	e.w.writeBits(4*nibbles, uint64(length-1))
+}
+
+// This uses LZ77 to split the data between "start" and "end" into commands.
+// Copies may refer to data before "start" but may not extend past "end".
+func (e *encoder) findCommands(start int, end int) (commands []command) {
+	literalStart := start
+	pos := start
+	length, distance := e.findLongestMatch(pos, end)
+	for pos < end {
+		if length < minMatchLength {
+			pos++
+			length, distance = e.findLongestMatch(pos, end)
+			continue
+		}
+
+		// Lazy matching: skip this match if the next position has a longer one
+		if nextLength, nextDistance := e.findLongestMatch(pos+1, end); nextLength > length {
+			pos++
+			length, distance = nextLength, nextDistance
+			continue
+		}
+
+		commands = append(commands, command{
+			insertLength: pos - literalStart,
+			copyLength:   length,
+			distance:     distance,
+		})
+		pos += length
+		literalStart = pos
+		length, distance = e.findLongestMatch(pos, end)
+	}
+
+	// Any remaining literals go in a final command without a copy
+	if literalStart < end {
+		commands = append(commands, command{insertLength: end - literalStart})
+	}
+	return
+}
+
+func (e *encoder) hash(pos int) uint32 {
+	return (binary.LittleEndian.Uint32(e.data[pos:]) * 0x1E35A7BD) >> (32 - hashBits)
+}
+
+func (e *encoder) findLongestMatch(pos int, end int) (bestLength int, bestDistance int) {
+	if pos+minMatchLength > len(e.data) {
+		return
+	}
+
+	// Add all positions before this one to the hash chains
+	for e.hashedUpTo < pos {
+		if e.hashedUpTo+minMatchLength <= len(e.data) {
+			h := e.hash(e.hashedUpTo)
+			e.prev[e.hashedUpTo] = e.head[h]
+			e.head[h] = int32(e.hashedUpTo)
+		}
+		e.hashedUpTo++
+	}
+
+	maxLength := end - pos
+	if maxLength < minMatchLength {
+		return
+	}
+	if maxLength > maxMatchLength {
+		maxLength = maxMatchLength
+	}
+	candidate := int(e.head[e.hash(pos)])
+	for i := 0; i < maxChainLength && candidate >= 0 && pos-candidate <= maxDistance; i++ {
+		if e.data[candidate+bestLength] == e.data[pos+bestLength] {
+			length := 0
+			for length < maxLength && e.data[candidate+length] == e.data[pos+length] {
+				length++
+			}
+			if length > bestLength {
+				bestLength = length
+				bestDistance = pos - candidate
+				if length == maxLength {
+					break
+				}
+			}
+		}
+		candidate = int(e.prev[candidate])
+	}
+	return
+}
+
+// The command code combines the insert length code and the copy length code,
+// and also says whether the distance is the same as the last distance
+func (e *encoder) assignCodes(cmd *command) {
+	insertCode := lengthCodeIndex(insertLengthCodes[:], cmd.insertLength)
+	copyCode := 0 // The copy length is ignored for the final command
+	if cmd.copyLength > 0 {
+		copyCode = lengthCodeIndex(copyLengthCodes[:], cmd.copyLength)
+	}
+	cmd.insertCode = uint8(insertCode)
+	cmd.copyCode = uint8(copyCode)
+	bits64 := uint16((insertCode&7)<<3 | copyCode&7)
+
+	// Command codes below 128 use the last distance without a distance code
+	if insertCode < 8 && copyCode < 16 && (cmd.copyLength == 0 || cmd.distance == e.lastDistance) {
+		if copyCode < 8 {
+			cmd.commandCode = bits64
+		} else {
+			cmd.commandCode = bits64 | 64
+		}
+		cmd.distanceCode = 0
+		return
+	}
+	cmd.commandCode = commandCodeOffsets[insertCode>>3][copyCode>>3] | bits64
+	if cmd.copyLength == 0 {
+		return
+	}
+
+	if cmd.distance == e.lastDistance {
+		// Distance code 0 means the last distance
+		cmd.distanceCode = 0
+		cmd.distanceBits = 0
+		cmd.distanceRest = 0
+		return
+	}
+
+	// With "NPOSTFIX" and "NDIRECT" both set to 0, distance code 16 and above
+	// encode the distance as a prefix and some extra bits
+	x := uint32(cmd.distance + 3)
+	nbits := uint32(0)
+	for (x >> (nbits + 2)) != 0 {
+		nbits++
+	}
+	prefix := (x >> nbits) & 1
+	cmd.distanceCode = uint16(16 + 2*(nbits-1) + prefix)
+	cmd.distanceBits = uint8(nbits)
+	cmd.distanceRest = x - ((2 + prefix) << nbits)
+	e.lastDistance = cmd.distance
+}
+
+func (cmd *command) hasExplicitDistance() bool {
+	return cmd.copyLength > 0 && cmd.commandCode >= 128
+}
+
+const (
+	numCommandCodes  = 704
+	numDistanceCodes = 16 + 48
+)
+
+var commandCodeOffsets = [3][3]uint16{
+	{128, 192, 384},
+	{256, 320, 512},
+	{448, 576, 640},
+}
+
+type lengthCode struct {
+	base      int
+	extraBits uint8
+}
+
+var insertLengthCodes = [24]lengthCode{
+	{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}, {5, 0}, {6, 1}, {8, 1},
+	{10, 2}, {14, 2}, {18, 3}, {26, 3}, {34, 4}, {50, 4}, {66, 5}, {98, 5},
+	{130, 6}, {194, 7}, {322, 8}, {578, 9}, {1090, 10}, {2114, 12}, {6210, 14}, {22594, 24},
+}
+
+var copyLengthCodes = [24]lengthCode{
+	{2, 0}, {3, 0}, {4, 0}, {5, 0}, {6, 0}, {7, 0}, {8, 0}, {9, 0},
+	{10, 1}, {12, 1}, {14, 2}, {18, 2}, {22, 3}, {30, 3}, {38, 4}, {54, 4},
+	{70, 5}, {102, 5}, {134, 6}, {198, 7}, {326, 8}, {582, 9}, {1094, 10}, {2118, 24},
+}
+
+func lengthCodeIndex(codes []lengthCode, length int) int {
+	i := len(codes) - 1
+	for codes[i].base > length {
+		i--
+	}
+	return i
+}
@@ -0,0 +1,77 @@
+package brotli_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ije/esbuild-internal/brotli"
+	"github.com/ije/esbuild-internal/test"
+)
+
+// There's no decompressor in this package, so these tests compare against
+// outputs that have been checked to decompress to the original input using
+// the reference decoder. Larger outputs are compared using their SHA-256
+// hash. These values will need to be regenerated (and checked again) if the
+// encoder changes.
+
+func randomBytes(n int) []byte {
+	data := make([]byte, n)
+	x := uint32(2463534242)
+	for i := range data {
+		x ^= x << 13
+		x ^= x >> 17
+		x ^= x << 5
+		data[i] = byte(x)
+	}
+	return data
+}
+
+func codeLikeText(n int) []byte {
+	sb := strings.Builder{}
+	for i := 0; sb.Len() < n; i++ {
+		fmt.Fprintf(&sb, "export function f%d(x) { return x * %d + %q; }\n", i, i%97, strings.Repeat("ab", i%13))
+	}
+	return []byte(sb.String()[:n])
+}
+
+func expectEncoded(t *testing.T, data []byte, expected string) {
+	t.Helper()
+	test.AssertEqual(t, hex.EncodeToString(brotli.Encode(data)), expected)
+}
+
+func expectEncodedHash(t *testing.T, data []byte, expectedLength int, expectedHash string) {
+	t.Helper()
+	encoded := brotli.Encode(data)
+	hash := sha256.Sum256(encoded)
+	test.AssertEqual(t, len(encoded), expectedLength)
+	test.AssertEqual(t, hex.EncodeToString(hash[:]), expectedHash)
+}
+
+func TestEmpty(t *testing.T) {
+	expectEncoded(t, nil, "3b")
+	expectEncoded(t, []byte{}, "3b")
+}
+
+func TestShort(t *testing.T) {
+	expectEncoded(t, []byte("hello, world"), "8b058068656c6c6f2c20776f726c6403")
+}
+
+func TestLongRuns(t *testing.T) {
+	data := strings.Repeat("a", 100000) + strings.Repeat("b", 70000) + "c"
+	expectEncoded(t, []byte(data), "2b084c0100722c4c2c1f43e0b00220baf70075961f00baf7003b25014006")
+}
+
+func TestMultipleMetaBlocks(t *testing.T) {
+	// This is larger than the maximum meta-block length of 1mb
+	expectEncodedHash(t, codeLikeText(3<<20+12345), 279269,
+		"83afe99db2d7050dd7fa0a05f0ba92ba2e700d76eb634c418910b56b3a38c1a9")
+}
+
+func TestIncompressible(t *testing.T) {
+	// Incompressible data should only grow by a few bytes
+	expectEncodedHash(t, randomBytes(1<<20+777), 1049361,
+		"512711d3613f23886e6f4329f9d6e48b5d8f1aa09e303874943121565a960aee")
+}
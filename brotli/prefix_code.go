@@ -0,0 +1,327 @@
+package brotli
+
+import "sort"
+
+type bitWriter struct {
+	buf   []byte
+	bits  uint64
+	nbits uint
+}
+
+// Bits are packed starting with the least significant bit of each byte
+func (w *bitWriter) writeBits(n uint, value uint64) {
+	w.bits |= value << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *bitWriter) alignToByte() {
+	if w.nbits > 0 {
+		w.writeBits(8-w.nbits, 0)
+	}
+}
+
+type prefixCode struct {
+	depths []uint8
+	codes  []uint16
+}
+
+func (code prefixCode) writeSymbol(w *bitWriter, symbol int) {
+	w.writeBits(uint(code.depths[symbol]), uint64(code.codes[symbol]))
+}
+
+const maxCodeLength = 15
+
+// This is the order in which the code lengths of the code length alphabet
+// are stored, which puts the most likely ones first
+var codeLengthCodeOrder = [18]uint8{1, 2, 3, 4, 0, 5, 17, 6, 16, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// The code lengths of the code length alphabet are themselves stored using
+// this fixed prefix code
+var codeLengthCodeLengthBits = [6]uint8{0, 7, 3, 2, 1, 15}
+var codeLengthCodeLengthDepths = [6]uint8{2, 4, 3, 2, 2, 4}
+
+const (
+	repeatPreviousCodeLength = 16
+	repeatZeroCodeLength     = 17
+)
+
+// This writes a prefix code optimized for the given histogram and returns it
+// so the symbols can be written. Alphabets with at most four symbols in use
+// are written as a "simple" prefix code and the rest as a "complex" one.
+func (w *bitWriter) writePrefixCode(histogram []uint32, alphabetBits uint) prefixCode {
+	var symbols []int
+	for symbol, count := range histogram {
+		if count > 0 {
+			symbols = append(symbols, symbol)
+		}
+	}
+
+	// The decoder needs at least one symbol even if none will be used
+	if len(symbols) == 0 {
+		symbols = append(symbols, 0)
+	}
+
+	if len(symbols) <= 4 {
+		depths := make([]uint8, len(histogram))
+		if len(symbols) > 1 {
+			depths = buildHuffmanDepths(histogram, maxCodeLength)
+		}
+
+		// The symbols are stored in order of increasing code length, and the
+		// shape of the tree follows from the number of symbols (with an extra
+		// bit to pick between the two possible shapes for four symbols)
+		sort.SliceStable(symbols, func(i int, j int) bool { return depths[symbols[i]] < depths[symbols[j]] })
+		w.writeBits(2, 1) // HSKIP = 1 means a simple prefix code
+		w.writeBits(2, uint64(len(symbols)-1))
+		for _, symbol := range symbols {
+			w.writeBits(alphabetBits, uint64(symbol))
+		}
+		if len(symbols) == 4 {
+			if depths[symbols[0]] == 1 {
+				w.writeBits(1, 1)
+			} else {
+				w.writeBits(1, 0)
+			}
+		}
+		return prefixCode{depths: depths, codes: canonicalCodes(depths)}
+	}
+
+	depths := buildHuffmanDepths(histogram, maxCodeLength)
+	w.writeComplexPrefixCode(depths)
+	return prefixCode{depths: depths, codes: canonicalCodes(depths)}
+}
+
+func (w *bitWriter) writeComplexPrefixCode(depths []uint8) {
+	tree, extraBits := runLengthEncodeDepths(depths)
+
+	// Build a prefix code for the run-length encoded code lengths
+	var histogram [18]uint32
+	for _, symbol := range tree {
+		histogram[symbol]++
+	}
+	codeLengthDepths := buildHuffmanDepths(histogram[:], 5)
+	numCodes := 0
+	for _, depth := range codeLengthDepths {
+		if depth != 0 {
+			numCodes++
+		}
+	}
+
+	// Trailing zeros can be omitted because the decoder stops once the code is
+	// complete. But a code with a single symbol is never complete, so all of
+	// the code lengths must be written in that case.
+	codesToStore := len(codeLengthCodeOrder)
+	if numCodes > 1 {
+		for codesToStore > 0 && codeLengthDepths[codeLengthCodeOrder[codesToStore-1]] == 0 {
+			codesToStore--
+		}
+	}
+	w.writeBits(2, 0) // HSKIP = 0 means no code lengths are skipped
+	for _, symbol := range codeLengthCodeOrder[:codesToStore] {
+		depth := codeLengthDepths[symbol]
+		w.writeBits(uint(codeLengthCodeLengthDepths[depth]), uint64(codeLengthCodeLengthBits[depth]))
+	}
+
+	// A single symbol is written using zero bits
+	if numCodes == 1 {
+		for i := range codeLengthDepths {
+			codeLengthDepths[i] = 0
+		}
+	}
+	codes := canonicalCodes(codeLengthDepths)
+	for i, symbol := range tree {
+		w.writeBits(uint(codeLengthDepths[symbol]), uint64(codes[symbol]))
+		switch symbol {
+		case repeatPreviousCodeLength:
+			w.writeBits(2, uint64(extraBits[i]))
+		case repeatZeroCodeLength:
+			w.writeBits(3, uint64(extraBits[i]))
+		}
+	}
+}
+
+// This converts code lengths into symbols from the code length alphabet.
+// Symbols 0 to 15 are literal code lengths, 16 repeats the previous non-zero
+// code length, and 17 repeats zero. When a repeat symbol immediately follows
+// the same repeat symbol, the repeat counts are combined as digits of a
+// larger number instead of being added together.
+func runLengthEncodeDepths(depths []uint8) (tree []uint8, extraBits []uint8) {
+	// Trailing zeros can be omitted because the decoder stops once the code is
+	// complete
+	length := len(depths)
+	for length > 0 && depths[length-1] == 0 {
+		length--
+	}
+
+	previous := uint8(8) // The initial value of the previous non-zero code length
+	for i := 0; i < length; {
+		value := depths[i]
+		reps := 1
+		for i+reps < length && depths[i+reps] == value {
+			reps++
+		}
+		i += reps
+
+		if value == 0 {
+			if reps == 11 {
+				tree = append(tree, 0)
+				extraBits = append(extraBits, 0)
+				reps--
+			}
+			tree, extraBits = appendRepeats(tree, extraBits, 0, reps, repeatZeroCodeLength, 3)
+		} else {
+			if previous != value {
+				tree = append(tree, value)
+				extraBits = append(extraBits, 0)
+				reps--
+			}
+			if reps == 7 {
+				tree = append(tree, value)
+				extraBits = append(extraBits, 0)
+				reps--
+			}
+			tree, extraBits = appendRepeats(tree, extraBits, value, reps, repeatPreviousCodeLength, 2)
+			previous = value
+		}
+	}
+	return
+}
+
+func appendRepeats(tree []uint8, extraBits []uint8, value uint8, reps int, repeatSymbol uint8, bits uint) ([]uint8, []uint8) {
+	if reps < 3 {
+		for i := 0; i < reps; i++ {
+			tree = append(tree, value)
+			extraBits = append(extraBits, 0)
+		}
+		return tree, extraBits
+	}
+
+	// Write the repeat count in base 4 (or base 8 for zeros), most significant
+	// digit first
+	start := len(tree)
+	reps -= 3
+	mask := (1 << bits) - 1
+	for {
+		tree = append(tree, repeatSymbol)
+		extraBits = append(extraBits, uint8(reps&mask))
+		reps >>= bits
+		if reps == 0 {
+			break
+		}
+		reps--
+	}
+	for i, j := start, len(tree)-1; i < j; i, j = i+1, j-1 {
+		tree[i], tree[j] = tree[j], tree[i]
+		extraBits[i], extraBits[j] = extraBits[j], extraBits[i]
+	}
+	return tree, extraBits
+}
+
+type huffmanNode struct {
+	count  uint32
+	symbol int
+	left   int
+	right  int
+}
+
+// This returns the code length of each symbol in an optimal prefix code for
+// the histogram, with no code length longer than "limit". If the optimal code
+// is too deep, the counts of rare symbols are increased and it's rebuilt.
+func buildHuffmanDepths(histogram []uint32, limit uint8) []uint8 {
+	depths := make([]uint8, len(histogram))
+	for countMin := uint32(1); ; countMin *= 2 {
+		var nodes []huffmanNode
+		for symbol, count := range histogram {
+			if count > 0 {
+				if count < countMin {
+					count = countMin
+				}
+				nodes = append(nodes, huffmanNode{count: count, symbol: symbol, left: -1, right: -1})
+			}
+		}
+		if len(nodes) == 0 {
+			return depths
+		}
+		if len(nodes) == 1 {
+			depths[nodes[0].symbol] = 1
+			return depths
+		}
+		sort.SliceStable(nodes, func(i int, j int) bool { return nodes[i].count < nodes[j].count })
+
+		// Merge the two smallest nodes until there's only one left. Leaves are
+		// sorted and merged nodes are created in increasing order, so the two
+		// smallest nodes are always at the front of one of the two queues.
+		leaves := len(nodes)
+		nextLeaf := 0
+		nextMerged := leaves
+		takeSmallest := func() int {
+			if nextLeaf < leaves && (nextMerged >= len(nodes) || nodes[nextLeaf].count <= nodes[nextMerged].count) {
+				nextLeaf++
+				return nextLeaf - 1
+			}
+			nextMerged++
+			return nextMerged - 1
+		}
+		for len(nodes) < 2*leaves-1 {
+			left := takeSmallest()
+			right := takeSmallest()
+			nodes = append(nodes, huffmanNode{count: nodes[left].count + nodes[right].count, symbol: -1, left: left, right: right})
+		}
+
+		// Walk the tree to assign depths
+		maxDepth := uint8(0)
+		var visit func(index int, depth uint8)
+		visit = func(index int, depth uint8) {
+			if node := nodes[index]; node.symbol >= 0 {
+				depths[node.symbol] = depth
+				if depth > maxDepth {
+					maxDepth = depth
+				}
+			} else {
+				visit(node.left, depth+1)
+				visit(node.right, depth+1)
+			}
+		}
+		visit(len(nodes)-1, 0)
+		if maxDepth <= limit {
+			return depths
+		}
+	}
+}
+
+// Codes are assigned in order of increasing code length and then in order of
+// increasing symbol value. They are stored with the bits reversed because
+// prefix codes are read starting from the most significant bit.
+func canonicalCodes(depths []uint8) []uint16 {
+	var countPerDepth [maxCodeLength + 1]uint16
+	for _, depth := range depths {
+		if depth > 0 {
+			countPerDepth[depth]++
+		}
+	}
+	var nextCode [maxCodeLength + 1]uint16
+	code := uint16(0)
+	for depth := 1; depth <= maxCodeLength; depth++ {
+		code = (code + countPerDepth[depth-1]) << 1
+		nextCode[depth] = code
+	}
+	codes := make([]uint16, len(depths))
+	for symbol, depth := range depths {
+		if depth > 0 {
+			code := nextCode[depth]
+			nextCode[depth]++
+			reversed := uint16(0)
+			for i := uint8(0); i < depth; i++ {
+				reversed = (reversed << 1) | (code & 1)
+				code >>= 1
+			}
+			codes[symbol] = reversed
+		}
+	}
+	return codes
+}
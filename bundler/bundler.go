@@ -8,6 +8,7 @@ package bundler
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/base32"
 	"encoding/base64"
 	"fmt"
@@ -23,6 +24,7 @@ import (
 	"unicode/utf8"
 
 	"github.com/ije/esbuild-internal/ast"
+	"github.com/ije/esbuild-internal/brotli"
 	"github.com/ije/esbuild-internal/cache"
 	"github.com/ije/esbuild-internal/compat"
 	"github.com/ije/esbuild-internal/config"
@@ -30,6 +32,8 @@ import (
 	"github.com/ije/esbuild-internal/fs"
 	"github.com/ije/esbuild-internal/graph"
 	"github.com/ije/esbuild-internal/helpers"
+	"github.com/ije/esbuild-internal/html_ast"
+	"github.com/ije/esbuild-internal/html_parser"
 	"github.com/ije/esbuild-internal/js_ast"
 	"github.com/ije/esbuild-internal/js_lexer"
 	"github.com/ije/esbuild-internal/js_parser"
@@ -150,6 +154,7 @@ func parseFile(args parseArgs) {
 	var absResolveDir string
 	var pluginName string
 	var pluginData interface{}
+	var explicitSourceMap string
 
 	if stdin := args.options.Stdin; stdin != nil {
 		// Special-case stdin
@@ -159,9 +164,11 @@ func parseFile(args parseArgs) {
 			loader = config.LoaderJS
 		}
 		absResolveDir = args.options.Stdin.AbsResolveDir
+		explicitSourceMap = stdin.SourceMap
 	} else {
 		result, ok := runOnLoadPlugins(
 			args.options.Plugins,
+			args.res,
 			args.fs,
 			&args.caches.FSCache,
 			args.log,
@@ -169,6 +176,7 @@ func parseFile(args parseArgs) {
 			args.importSource,
 			args.importPathRange,
 			args.pluginData,
+			args.options.CancelFlag,
 			args.options.WatchMode,
 			args.options.LogPathStyle,
 		)
@@ -185,13 +193,26 @@ func parseFile(args parseArgs) {
 		absResolveDir = result.absResolveDir
 		pluginName = result.pluginName
 		pluginData = result.pluginData
+		explicitSourceMap = result.sourceMap
 	}
 
 	_, base, ext := logger.PlatformIndependentPathDirBaseExt(source.KeyPath.Text)
 
 	// The special "default" loader determines the loader from the file path
 	if loader == config.LoaderDefault {
-		loader = config.LoaderFromFileExtension(args.options.ExtensionToLoader, base+ext)
+		if source.KeyPath.Namespace == "vendor" {
+			// Use the path part of the URL, and assume JavaScript if there's no
+			// known extension since many CDNs omit the extension from module URLs
+			if parsed, err := url.Parse(source.KeyPath.Text); err == nil {
+				_, urlBase, urlExt := logger.PlatformIndependentPathDirBaseExt(parsed.Path)
+				loader = config.LoaderFromFileExtension(args.options.ExtensionToLoader, urlBase+urlExt)
+			}
+			if loader == config.LoaderDefault || loader == config.LoaderNone {
+				loader = config.LoaderJS
+			}
+		} else {
+			loader = config.LoaderFromFileExtension(args.options.ExtensionToLoader, base+ext)
+		}
 	}
 
 	// Reject unsupported import attributes when the loader isn't "copy" (since
@@ -263,9 +284,18 @@ func parseFile(args parseArgs) {
 		}
 	}()
 
+	// Syntax trees passed to "OnParse" plugins may be mutated, so they must not
+	// come from the parse cache (which is shared with subsequent builds)
+	parseJS := args.caches.JSCache.Parse
+	parseCSS := args.caches.CSSCache.Parse
+	if hasOnParsePlugins(args.options.Plugins, source.KeyPath) {
+		parseJS = js_parser.Parse
+		parseCSS = css_parser.Parse
+	}
+
 	switch loader {
 	case config.LoaderJS, config.LoaderEmpty:
-		ast, ok := args.caches.JSCache.Parse(args.log, source, js_parser.OptionsFromConfig(&args.options))
+		ast, ok := parseJS(args.log, source, js_parser.OptionsFromConfig(&args.options))
 		if len(ast.Parts) <= 1 { // Ignore the implicitly-generated namespace export part
 			result.file.inputFile.SideEffects.Kind = graph.NoSideEffects_EmptyAST
 		}
@@ -274,7 +304,7 @@ func parseFile(args parseArgs) {
 
 	case config.LoaderJSX:
 		args.options.JSX.Parse = true
-		ast, ok := args.caches.JSCache.Parse(args.log, source, js_parser.OptionsFromConfig(&args.options))
+		ast, ok := parseJS(args.log, source, js_parser.OptionsFromConfig(&args.options))
 		if len(ast.Parts) <= 1 { // Ignore the implicitly-generated namespace export part
 			result.file.inputFile.SideEffects.Kind = graph.NoSideEffects_EmptyAST
 		}
@@ -284,7 +314,7 @@ func parseFile(args parseArgs) {
 	case config.LoaderTS, config.LoaderTSNoAmbiguousLessThan:
 		args.options.TS.Parse = true
 		args.options.TS.NoAmbiguousLessThan = loader == config.LoaderTSNoAmbiguousLessThan
-		ast, ok := args.caches.JSCache.Parse(args.log, source, js_parser.OptionsFromConfig(&args.options))
+		ast, ok := parseJS(args.log, source, js_parser.OptionsFromConfig(&args.options))
 		if len(ast.Parts) <= 1 { // Ignore the implicitly-generated namespace export part
 			result.file.inputFile.SideEffects.Kind = graph.NoSideEffects_EmptyAST
 		}
@@ -294,7 +324,7 @@ func parseFile(args parseArgs) {
 	case config.LoaderTSX:
 		args.options.TS.Parse = true
 		args.options.JSX.Parse = true
-		ast, ok := args.caches.JSCache.Parse(args.log, source, js_parser.OptionsFromConfig(&args.options))
+		ast, ok := parseJS(args.log, source, js_parser.OptionsFromConfig(&args.options))
 		if len(ast.Parts) <= 1 { // Ignore the implicitly-generated namespace export part
 			result.file.inputFile.SideEffects.Kind = graph.NoSideEffects_EmptyAST
 		}
@@ -302,10 +332,21 @@ func parseFile(args parseArgs) {
 		result.ok = ok
 
 	case config.LoaderCSS, config.LoaderGlobalCSS, config.LoaderLocalCSS:
-		ast := args.caches.CSSCache.Parse(args.log, source, css_parser.OptionsFromConfig(loader, &args.options))
+		ast := parseCSS(args.log, source, css_parser.OptionsFromConfig(loader, &args.options))
 		result.file.inputFile.Repr = &graph.CSSRepr{AST: ast}
 		result.ok = true
 
+	case config.LoaderHTML:
+		if args.options.Mode != config.ModeBundle {
+			tracker := logger.MakeLineColumnTracker(args.importSource)
+			args.log.AddError(&tracker, args.importPathRange,
+				fmt.Sprintf("Cannot use the \"html\" loader without bundling: %s", source.PrettyPaths.Select(args.options.LogPathStyle)))
+			break
+		}
+		ast := html_parser.Parse(source)
+		result.file.inputFile.Repr = &graph.HTMLRepr{AST: ast}
+		result.ok = true
+
 	case config.LoaderJSON, config.LoaderWithTypeJSON:
 		expr, ok := args.caches.JSONCache.Parse(args.log, source, js_parser.JSONOptions{
 			UnsupportedJSFeatures: args.options.UnsupportedJSFeatures,
@@ -440,6 +481,21 @@ func parseFile(args parseArgs) {
 		args.log.AddError(&tracker, args.importPathRange, message)
 	}
 
+	// Let plugins transform the syntax tree before import records are scanned
+	if result.ok && !runOnParsePlugins(
+		args.options.Plugins,
+		args.fs,
+		&args.caches.FSCache,
+		args.log,
+		&result.file.inputFile,
+		args.importSource,
+		args.importPathRange,
+		pluginData,
+		args.sideEffects,
+	) {
+		result.ok = false
+	}
+
 	// Only continue now if parsing was successful
 	if result.ok {
 		// Run the resolver on the parse thread so it's not run on the main thread.
@@ -568,6 +624,7 @@ func parseFile(args parseArgs) {
 							record.Kind,
 							absResolveDir,
 							pluginData,
+							args.options.CancelFlag,
 							args.options.LogPathStyle,
 						)
 						if resolveResult != nil {
@@ -602,6 +659,16 @@ func parseFile(args parseArgs) {
 					// have been logged for nil entries if the previous instances had
 					// the "HandlesImportErrors" flag.
 					if entry.resolveResult == nil {
+						// The file referenced by a "new URL()" expression may be provided some
+						// other way at run-time, so leave the expression alone instead
+						if record.Kind == ast.ImportNewURL || record.Kind == ast.ImportNewWorker {
+							if !entry.didLogError {
+								args.log.AddID(logger.MsgID_Bundler_IgnoredNewURL, logger.Debug, &tracker, record.Range,
+									fmt.Sprintf("The path %q was left unchanged because it could not be resolved", record.Path.Text))
+							}
+							continue
+						}
+
 						// Failed imports inside a try/catch are silently turned into
 						// external imports instead of causing errors. This matches a common
 						// code pattern for conditionally importing a module with a graceful
@@ -626,6 +693,15 @@ func parseFile(args parseArgs) {
 						continue
 					}
 
+					// Also leave "new URL()" expressions alone if the file can't be loaded
+					if record.Kind == ast.ImportNewURL && !entry.resolveResult.PathPair.IsExternal {
+						if ext, ok := newURLHasNoLoader(&args.options, entry.resolveResult.PathPair.Primary); ok {
+							args.log.AddID(logger.MsgID_Bundler_IgnoredNewURL, logger.Debug, &tracker, record.Range,
+								fmt.Sprintf("The path %q was left unchanged because no loader is configured for %q files", record.Path.Text, ext))
+							continue
+						}
+					}
+
 					// Forbid bundling of imports with explicit phases
 					if record.Phase != ast.EvaluationPhase {
 						reportExplicitPhaseImport(args.log, &tracker, record.Range,
@@ -647,88 +723,105 @@ func parseFile(args parseArgs) {
 				sourceMapComment = repr.AST.SourceMapComment
 			}
 
-			if sourceMapComment.Text != "" {
-				tracker := logger.MakeLineColumnTracker(&source)
-
-				if path, contents := extractSourceMapFromComment(args.log, args.fs, &args.caches.FSCache,
-					&source, &tracker, sourceMapComment, absResolveDir, args.options.LogPathStyle); contents != nil {
-					prettyPaths := resolver.MakePrettyPaths(args.fs, path)
-					log := logger.NewDeferLog(logger.DeferLogNoVerboseOrDebug, args.log.Overrides)
-
-					sourceMap := js_parser.ParseSourceMap(log, logger.Source{
-						KeyPath:     path,
-						PrettyPaths: prettyPaths,
-						Contents:    *contents,
-					})
+			tracker := logger.MakeLineColumnTracker(&source)
+			var path logger.Path
+			var contents *string
+
+			// A source map that was passed explicitly (either from a plugin or
+			// from the API) takes precedence over a source map comment
+			if explicitSourceMap != "" {
+				path = source.KeyPath
+				path.IgnoredSuffix = "#sourceMappingURL"
+				contents = &explicitSourceMap
+			} else if sourceMapComment.Text != "" {
+				path, contents = extractSourceMapFromComment(args.log, args.fs, &args.caches.FSCache,
+					&source, &tracker, sourceMapComment, absResolveDir, args.options.LogPathStyle)
+			}
 
-					if msgs := log.Done(); len(msgs) > 0 {
-						var text string
-						if path.Namespace == "file" {
-							text = fmt.Sprintf("The source map %q was referenced by the file %q here:",
-								prettyPaths.Select(args.options.LogPathStyle),
-								args.prettyPaths.Select(args.options.LogPathStyle))
+			if contents != nil {
+				prettyPaths := resolver.MakePrettyPaths(args.fs, path)
+				log := logger.NewDeferLog(logger.DeferLogNoVerboseOrDebug, args.log.Overrides)
+
+				sourceMap := js_parser.ParseSourceMap(log, logger.Source{
+					KeyPath:     path,
+					PrettyPaths: prettyPaths,
+					Contents:    *contents,
+				})
+
+				if msgs := log.Done(); len(msgs) > 0 {
+					var note logger.MsgData
+					if explicitSourceMap != "" {
+						if pluginName != "" {
+							note.Text = fmt.Sprintf("This source map came from the plugin %q for the file %q",
+								pluginName, args.prettyPaths.Select(args.options.LogPathStyle))
 						} else {
-							text = fmt.Sprintf("This source map came from the file %q here:",
+							note.Text = fmt.Sprintf("This source map was provided for the file %q",
 								args.prettyPaths.Select(args.options.LogPathStyle))
 						}
-						note := tracker.MsgData(sourceMapComment.Range, text)
-						for _, msg := range msgs {
-							msg.Notes = append(msg.Notes, note)
-							args.log.AddMsg(msg)
-						}
+					} else if path.Namespace == "file" {
+						note = tracker.MsgData(sourceMapComment.Range, fmt.Sprintf("The source map %q was referenced by the file %q here:",
+							prettyPaths.Select(args.options.LogPathStyle),
+							args.prettyPaths.Select(args.options.LogPathStyle)))
+					} else {
+						note = tracker.MsgData(sourceMapComment.Range, fmt.Sprintf("This source map came from the file %q here:",
+							args.prettyPaths.Select(args.options.LogPathStyle)))
 					}
+					for _, msg := range msgs {
+						msg.Notes = append(msg.Notes, note)
+						args.log.AddMsg(msg)
+					}
+				}
 
-					// If "sourcesContent" entries aren't present, try filling them in
-					// using the file system. This includes both generating the entire
-					// "sourcesContent" array if it's absent as well as filling in
-					// individual null entries in the array if the array is present.
-					if sourceMap != nil && !args.options.ExcludeSourcesContent {
-						// Make sure "sourcesContent" is big enough
-						if len(sourceMap.SourcesContent) < len(sourceMap.Sources) {
-							slice := make([]sourcemap.SourceContent, len(sourceMap.Sources))
-							copy(slice, sourceMap.SourcesContent)
-							sourceMap.SourcesContent = slice
-						}
+				// If "sourcesContent" entries aren't present, try filling them in
+				// using the file system. This includes both generating the entire
+				// "sourcesContent" array if it's absent as well as filling in
+				// individual null entries in the array if the array is present.
+				if sourceMap != nil && !args.options.ExcludeSourcesContent {
+					// Make sure "sourcesContent" is big enough
+					if len(sourceMap.SourcesContent) < len(sourceMap.Sources) {
+						slice := make([]sourcemap.SourceContent, len(sourceMap.Sources))
+						copy(slice, sourceMap.SourcesContent)
+						sourceMap.SourcesContent = slice
+					}
 
-						for i, source := range sourceMap.Sources {
-							// Convert absolute paths to "file://" URLs, which is especially important
-							// for Windows where file paths don't look like URLs at all (they use "\"
-							// as a path separator and start with a "C:\" volume label instead of "/").
-							//
-							// The new source map specification (https://tc39.es/ecma426/) says that
-							// each source is "a string that is a (potentially relative) URL". So we
-							// should technically not be finding absolute paths here in the first place.
-							//
-							// However, for a long time source maps was poorly-specified. The old source
-							// map specification (https://sourcemaps.info/spec.html) only says "sources"
-							// is "a list of original sources used by the mappings entry" which could
-							// be anything, really.
-							//
-							// So it makes sense that software which predates the formal specification
-							// of source maps might fill in the sources array with absolute file paths
-							// instead of URLs. Here are some cases where that happened:
-							//
-							// - https://github.com/mozilla/source-map/issues/355
-							// - https://github.com/webpack/webpack/issues/8226
-							//
-							if path.Namespace == "file" && args.fs.IsAbs(source) {
-								source = helpers.FileURLFromFilePath(source).String()
-								sourceMap.Sources[i] = source
-							}
+					for i, source := range sourceMap.Sources {
+						// Convert absolute paths to "file://" URLs, which is especially important
+						// for Windows where file paths don't look like URLs at all (they use "\"
+						// as a path separator and start with a "C:\" volume label instead of "/").
+						//
+						// The new source map specification (https://tc39.es/ecma426/) says that
+						// each source is "a string that is a (potentially relative) URL". So we
+						// should technically not be finding absolute paths here in the first place.
+						//
+						// However, for a long time source maps was poorly-specified. The old source
+						// map specification (https://sourcemaps.info/spec.html) only says "sources"
+						// is "a list of original sources used by the mappings entry" which could
+						// be anything, really.
+						//
+						// So it makes sense that software which predates the formal specification
+						// of source maps might fill in the sources array with absolute file paths
+						// instead of URLs. Here are some cases where that happened:
+						//
+						// - https://github.com/mozilla/source-map/issues/355
+						// - https://github.com/webpack/webpack/issues/8226
+						//
+						if path.Namespace == "file" && args.fs.IsAbs(source) {
+							source = helpers.FileURLFromFilePath(source).String()
+							sourceMap.Sources[i] = source
+						}
 
-							// Attempt to fill in null entries using the file system
-							if sourceMap.SourcesContent[i].Value == nil {
-								if sourceURL, err := url.Parse(source); err == nil && helpers.IsFileURL(sourceURL) {
-									if contents, err, _ := args.caches.FSCache.ReadFile(args.fs, helpers.FilePathFromFileURL(args.fs, sourceURL)); err == nil {
-										sourceMap.SourcesContent[i].Value = helpers.StringToUTF16(contents)
-									}
+						// Attempt to fill in null entries using the file system
+						if sourceMap.SourcesContent[i].Value == nil {
+							if sourceURL, err := url.Parse(source); err == nil && helpers.IsFileURL(sourceURL) {
+								if contents, err, _ := args.caches.FSCache.ReadFile(args.fs, helpers.FilePathFromFileURL(args.fs, sourceURL)); err == nil {
+									sourceMap.SourcesContent[i].Value = helpers.StringToUTF16(contents)
 								}
 							}
 						}
 					}
-
-					result.file.inputFile.InputSourceMap = sourceMap
 				}
+
+				result.file.inputFile.InputSourceMap = sourceMap
 			}
 		}
 	}
@@ -1062,6 +1155,7 @@ func RunOnResolvePlugins(
 	kind ast.ImportKind,
 	absResolveDir string,
 	pluginData interface{},
+	cancelFlag *config.CancelFlag,
 	logPathStyle logger.PathStyle,
 ) (*resolver.ResolveResult, bool, resolver.DebugMeta) {
 	resolverArgs := config.OnResolveArgs{
@@ -1071,6 +1165,7 @@ func RunOnResolvePlugins(
 		PluginData: pluginData,
 		Importer:   importer,
 		With:       importAttributes,
+		CancelFlag: cancelFlag,
 	}
 	applyPath := logger.Path{
 		Text:      path,
@@ -1151,6 +1246,11 @@ func RunOnResolvePlugins(
 		}
 	}
 
+	// Relative imports inside of vendored URLs are relative to that URL
+	if importer.Namespace == "vendor" {
+		path = resolver.ResolveVendoredImportPath(importer.Text, path)
+	}
+
 	// Resolve relative to the resolve directory by default. All paths in the
 	// "file" namespace automatically have a resolve directory. Loader plugins
 	// can also configure a custom resolve directory for files in other namespaces.
@@ -1171,15 +1271,37 @@ func RunOnResolvePlugins(
 	return result, false, debug
 }
 
+// This returns the file extension if loading the path would fail because no
+// loader is configured for it. Plugins may still be able to load the path.
+func newURLHasNoLoader(options *config.Options, path logger.Path) (string, bool) {
+	if path.Namespace != "file" {
+		return "", false
+	}
+	for _, plugin := range options.Plugins {
+		for _, onLoad := range plugin.OnLoad {
+			if config.PluginAppliesToPath(path, onLoad.Filter, onLoad.Namespace) {
+				return "", false
+			}
+		}
+	}
+	_, base, ext := logger.PlatformIndependentPathDirBaseExt(path.Text)
+	if ext == "" || config.LoaderFromFileExtension(options.ExtensionToLoader, base+ext) != config.LoaderNone {
+		return "", false
+	}
+	return ext, true
+}
+
 type loaderPluginResult struct {
 	pluginData    interface{}
 	absResolveDir string
 	pluginName    string
+	sourceMap     string
 	loader        config.Loader
 }
 
 func runOnLoadPlugins(
 	plugins []config.Plugin,
+	res *resolver.Resolver,
 	fs fs.FS,
 	fsCache *cache.FSCache,
 	log logger.Log,
@@ -1187,12 +1309,14 @@ func runOnLoadPlugins(
 	importSource *logger.Source,
 	importPathRange logger.Range,
 	pluginData interface{},
+	cancelFlag *config.CancelFlag,
 	isWatchMode bool,
 	logPathStyle logger.PathStyle,
 ) (loaderPluginResult, bool) {
 	loaderArgs := config.OnLoadArgs{
 		Path:       source.KeyPath,
 		PluginData: pluginData,
+		CancelFlag: cancelFlag,
 	}
 	tracker := logger.MakeLineColumnTracker(importSource)
 
@@ -1249,6 +1373,7 @@ func runOnLoadPlugins(
 				absResolveDir: result.AbsResolveDir,
 				pluginName:    pluginName,
 				pluginData:    result.PluginData,
+				sourceMap:     result.SourceMap,
 			}, true
 		}
 	}
@@ -1280,6 +1405,19 @@ func runOnLoadPlugins(
 		}
 	}
 
+	// Vendored URLs are read from the vendor directory instead of the network
+	if source.KeyPath.Namespace == "vendor" {
+		if contents, ok, err := res.ReadVendoredURL(source.KeyPath.Text); ok {
+			if err != nil {
+				log.AddError(&tracker, importPathRange,
+					fmt.Sprintf("Could not load %q: %s", source.KeyPath.Text, err.Error()))
+				return loaderPluginResult{}, false
+			}
+			source.Contents = contents
+			return loaderPluginResult{loader: config.LoaderDefault}, true
+		}
+	}
+
 	// Native support for data URLs. This is supported natively by node:
 	// https://nodejs.org/docs/latest/api/esm.html#esm_data_imports
 	if source.KeyPath.Namespace == "dataurl" {
@@ -1308,6 +1446,189 @@ func runOnLoadPlugins(
 	return loaderPluginResult{loader: config.LoaderNone}, true
 }
 
+func hasOnParsePlugins(plugins []config.Plugin, path logger.Path) bool {
+	for _, plugin := range plugins {
+		for _, onParse := range plugin.OnParse {
+			if config.PluginAppliesToPath(path, onParse.Filter, onParse.Namespace) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func runOnParsePlugins(
+	plugins []config.Plugin,
+	fs fs.FS,
+	fsCache *cache.FSCache,
+	log logger.Log,
+	inputFile *graph.InputFile,
+	importSource *logger.Source,
+	importPathRange logger.Range,
+	pluginData interface{},
+	sideEffects graph.SideEffects,
+) bool {
+	parserArgs := config.OnParseArgs{
+		Path:       inputFile.Source.KeyPath,
+		PluginData: pluginData,
+		Loader:     inputFile.Loader,
+	}
+
+	// Only files that were parsed from source code are passed to plugins. Other
+	// loaders (e.g. "json" or "text") generate a syntax tree that is special-
+	// cased by the linker and isn't meant to be edited.
+	switch inputFile.Loader {
+	case config.LoaderJS, config.LoaderJSX, config.LoaderTS, config.LoaderTSNoAmbiguousLessThan, config.LoaderTSX:
+		parserArgs.JSAST = &inputFile.Repr.(*graph.JSRepr).AST
+	case config.LoaderCSS, config.LoaderGlobalCSS, config.LoaderLocalCSS:
+		parserArgs.CSSAST = &inputFile.Repr.(*graph.CSSRepr).AST
+	default:
+		return true
+	}
+
+	// Apply all matching parser plugins in order
+	didRunPlugin := false
+	for _, plugin := range plugins {
+		for _, onParse := range plugin.OnParse {
+			if !config.PluginAppliesToPath(inputFile.Source.KeyPath, onParse.Filter, onParse.Namespace) {
+				continue
+			}
+
+			result := onParse.Callback(parserArgs)
+			pluginName := result.PluginName
+			if pluginName == "" {
+				pluginName = plugin.Name
+			}
+			didLogError := logPluginMessages(fs, log, pluginName, result.Msgs, result.ThrownError, importSource, importPathRange)
+			didRunPlugin = true
+
+			// Plugins can also provide additional file system paths to watch
+			for _, file := range result.AbsWatchFiles {
+				fsCache.ReadFile(fs, file)
+			}
+			for _, dir := range result.AbsWatchDirs {
+				if entries, err, _ := fs.ReadDirectory(dir); err == nil {
+					entries.SortedKeys()
+				}
+			}
+
+			// Stop now if there was an error
+			if didLogError {
+				return false
+			}
+		}
+	}
+
+	// Plugins aren't expected to keep the metadata that the linker uses for
+	// tree shaking up to date, so fill in anything they may have added
+	if didRunPlugin && parserArgs.JSAST != nil {
+		tree := parserArgs.JSAST
+		updatePartsAfterOnParse(tree)
+		if len(tree.Parts) > 1 && inputFile.SideEffects.Kind == graph.NoSideEffects_EmptyAST {
+			inputFile.SideEffects = sideEffects
+		}
+	}
+	return true
+}
+
+// This only ever adds information. Symbol uses and import records that are no
+// longer present are left alone since over-approximating them is harmless (it
+// just means less code is removed by tree shaking).
+func updatePartsAfterOnParse(tree *js_ast.AST) {
+	sourceIndex := tree.ModuleRef.SourceIndex
+	astHelpers := js_ast.MakeHelperContext(func(ref ast.Ref) bool {
+		return tree.Symbols[ref.InnerIndex].Kind == ast.SymbolUnbound
+	})
+	if tree.TopLevelSymbolToPartsFromParser == nil {
+		tree.TopLevelSymbolToPartsFromParser = make(map[ast.Ref][]uint32)
+	}
+
+	for partIndex := range tree.Parts {
+		part := &tree.Parts[partIndex]
+
+		// Plugins may have added side effects to a part that had none before
+		if part.CanBeRemovedIfUnused && !astHelpers.StmtsCanBeRemovedIfUnused(part.Stmts, 0) {
+			part.CanBeRemovedIfUnused = false
+		}
+
+		// Record new top-level declarations
+		declared := make(map[ast.Ref]bool)
+		for _, item := range part.DeclaredSymbols {
+			declared[item.Ref] = true
+		}
+		declare := func(ref ast.Ref) {
+			if !declared[ref] {
+				declared[ref] = true
+				part.DeclaredSymbols = append(part.DeclaredSymbols, js_ast.DeclaredSymbol{Ref: ref, IsTopLevel: true})
+				tree.TopLevelSymbolToPartsFromParser[ref] = append(tree.TopLevelSymbolToPartsFromParser[ref], uint32(partIndex))
+			}
+		}
+		for _, stmt := range part.Stmts {
+			if s, ok := stmt.Data.(*js_ast.SExportDefault); ok {
+				stmt = s.Value
+			}
+			switch s := stmt.Data.(type) {
+			case *js_ast.SLocal:
+				js_ast.ForEachIdentifierBindingInDecls(s.Decls, func(loc logger.Loc, b *js_ast.BIdentifier) {
+					declare(b.Ref)
+				})
+			case *js_ast.SFunction:
+				if s.Fn.Name != nil {
+					declare(s.Fn.Name.Ref)
+				}
+			case *js_ast.SClass:
+				if s.Class.Name != nil {
+					declare(s.Class.Name.Ref)
+				}
+			}
+		}
+
+		// Record new symbol uses and import records
+		records := make(map[uint32]bool)
+		for _, index := range part.ImportRecordIndices {
+			records[index] = true
+		}
+		use := func(ref ast.Ref) {
+			if ref.SourceIndex != sourceIndex {
+				return
+			}
+			if _, ok := part.SymbolUses[ref]; !ok {
+				if part.SymbolUses == nil {
+					part.SymbolUses = make(map[ast.Ref]js_ast.SymbolUse)
+				}
+				part.SymbolUses[ref] = js_ast.SymbolUse{CountEstimate: 1}
+				tree.Symbols[ref.InnerIndex].UseCountEstimate++
+			}
+		}
+		record := func(index uint32) {
+			if !records[index] {
+				records[index] = true
+				part.ImportRecordIndices = append(part.ImportRecordIndices, index)
+			}
+		}
+		visitor := js_ast.Visitor{
+			EnterExpr: func(expr *js_ast.Expr) bool {
+				switch e := expr.Data.(type) {
+				case *js_ast.EIdentifier:
+					use(e.Ref)
+				case *js_ast.EImportIdentifier:
+					use(e.Ref)
+				case *js_ast.ERequireString:
+					record(e.ImportRecordIndex)
+				case *js_ast.ERequireResolveString:
+					record(e.ImportRecordIndex)
+				case *js_ast.EImportString:
+					record(e.ImportRecordIndex)
+				case *js_ast.EURLString:
+					record(e.ImportRecordIndex)
+				}
+				return true
+			},
+		}
+		visitor.VisitStmts(part.Stmts)
+	}
+}
+
 // Identify the path by its lowercase absolute path name with Windows-specific
 // slashes substituted for standard slashes. This should hopefully avoid path
 // issues on Windows where multiple different paths can refer to the same
@@ -1788,6 +2109,7 @@ func (s *scanner) preprocessInjectedFiles() {
 				ast.ImportEntryPoint,
 				injectAbsResolveDir,
 				nil,
+				s.options.CancelFlag,
 				s.options.LogPathStyle,
 			)
 			if resolveResult != nil {
@@ -1969,6 +2291,7 @@ func (s *scanner) addEntryPoints(entryPoints []EntryPoint) []graph.EntryPoint {
 				ast.ImportEntryPoint,
 				entryPointAbsResolveDir,
 				nil,
+				s.options.CancelFlag,
 				s.options.LogPathStyle,
 			)
 			if resolveResult != nil {
@@ -2213,7 +2536,12 @@ func (s *scanner) scanAllDependencies() {
 				}
 
 				path := resolveResult.PathPair.Primary
-				if !resolveResult.PathPair.IsExternal {
+				if s.isTakenFromRunningModules(path, resolveResult.PathPair.IsExternal) {
+					// Hot module replacement updates import other JavaScript modules from
+					// the modules that are already running instead of bundling them again
+					prettyPaths := resolver.MakePrettyPaths(s.fs, path)
+					record.Path = logger.Path{Text: prettyPaths.Select(s.options.CodePathStyle)}
+				} else if !resolveResult.PathPair.IsExternal {
 					// Handle a path within the bundle
 					sourceIndex := s.maybeParseFile(*resolveResult, resolver.MakePrettyPaths(s.fs, path),
 						&result.file.inputFile.Source, record.Range, with, inputKindNormal, nil)
@@ -2248,6 +2576,21 @@ func (s *scanner) scanAllDependencies() {
 	}
 }
 
+func (s *scanner) isTakenFromRunningModules(path logger.Path, isExternal bool) bool {
+	if s.options.HotUpdatePath == "" || isExternal || path.Namespace != "file" || path.Text == s.options.HotUpdatePath {
+		return false
+	}
+
+	// Only JavaScript modules are registered with the hot module replacement
+	// runtime. Everything else (e.g. CSS and JSON) is bundled into the update.
+	_, base, ext := logger.PlatformIndependentPathDirBaseExt(path.Text)
+	switch config.LoaderFromFileExtension(s.options.ExtensionToLoader, base+ext) {
+	case config.LoaderJS, config.LoaderJSX, config.LoaderTS, config.LoaderTSNoAmbiguousLessThan, config.LoaderTSX:
+		return true
+	}
+	return false
+}
+
 func (s *scanner) generateResultForGlobResolve(
 	sourceIndex uint32,
 	fakeSourcePath string,
@@ -2564,6 +2907,11 @@ func (s *scanner) processScannedFiles(entryPointMeta []graph.EntryPoint) []scann
 					}
 
 				case ast.ImportURL:
+					// References from HTML files are validated separately below
+					if _, ok := result.file.inputFile.Repr.(*graph.HTMLRepr); ok {
+						break
+					}
+
 					// Using a JavaScript or CSS file with CSS "url()" is not allowed
 					switch otherRepr := otherFile.inputFile.Repr.(type) {
 					case *graph.CSSRepr:
@@ -2586,6 +2934,66 @@ func (s *scanner) processScannedFiles(entryPointMeta []graph.EntryPoint) []scann
 									config.LoaderToString[otherFile.inputFile.Loader])}})
 						}
 					}
+
+				case ast.ImportNewURL:
+					// JavaScript and CSS files don't have a URL to substitute into a "new
+					// URL()" expression, so leave the expression alone in that case
+					switch otherRepr := otherFile.inputFile.Repr.(type) {
+					case *graph.CSSRepr:
+						s.log.AddIDWithNotes(logger.MsgID_Bundler_IgnoredNewURL, logger.Warning, &tracker, record.Range,
+							fmt.Sprintf("The path %q was left unchanged because it refers to a CSS file", record.Path.Text),
+							[]logger.MsgData{{Text: fmt.Sprintf(
+								"You can't use \"new URL()\" to reference a CSS file, and %q is a CSS file (it was loaded with the %q loader).",
+								otherFile.inputFile.Source.PrettyPaths.Select(s.options.LogPathStyle),
+								config.LoaderToString[otherFile.inputFile.Loader])}})
+						record.SourceIndex = ast.Index32{}
+						continue
+
+					case *graph.JSRepr:
+						if otherRepr.AST.URLForCSS == "" && otherFile.inputFile.Loader != config.LoaderEmpty {
+							s.log.AddIDWithNotes(logger.MsgID_Bundler_IgnoredNewURL, logger.Warning, &tracker, record.Range,
+								fmt.Sprintf("The path %q was left unchanged because it refers to a JavaScript file", record.Path.Text),
+								[]logger.MsgData{{Text: fmt.Sprintf(
+									"You can't use \"new URL()\" to reference the file %q because it was loaded with the %q loader, which doesn't provide a URL to embed in the resulting JavaScript. "+
+										"Use \"new Worker(new URL(...))\" instead if this file is meant to be run as a worker.",
+									otherFile.inputFile.Source.PrettyPaths.Select(s.options.LogPathStyle),
+									config.LoaderToString[otherFile.inputFile.Loader])}})
+							record.SourceIndex = ast.Index32{}
+							continue
+						}
+					}
+
+				case ast.ImportNewWorker:
+					// Workers must be JavaScript files since they become entry points
+					canBeWorker := false
+					switch otherRepr := otherFile.inputFile.Repr.(type) {
+					case *graph.JSRepr:
+						canBeWorker = otherRepr.AST.URLForCSS == ""
+					case *graph.HTMLRepr:
+						// HTML files are validated separately below
+						canBeWorker = true
+					}
+					if !canBeWorker {
+						s.log.AddErrorWithNotes(&tracker, record.Range,
+							fmt.Sprintf("Cannot use %q as a worker",
+								otherFile.inputFile.Source.PrettyPaths.Select(s.options.LogPathStyle)),
+							[]logger.MsgData{{Text: fmt.Sprintf(
+								"Workers must be JavaScript files, and %q was loaded with the %q loader.",
+								otherFile.inputFile.Source.PrettyPaths.Select(s.options.LogPathStyle),
+								config.LoaderToString[otherFile.inputFile.Loader])}})
+					}
+				}
+
+				// HTML files can't be imported since they can only be entry points
+				if _, ok := otherFile.inputFile.Repr.(*graph.HTMLRepr); ok {
+					if _, ok := result.file.inputFile.Repr.(*graph.HTMLRepr); !ok {
+						s.log.AddErrorWithNotes(&tracker, record.Range,
+							fmt.Sprintf("Cannot import %q",
+								otherFile.inputFile.Source.PrettyPaths.Select(s.options.LogPathStyle)),
+							[]logger.MsgData{{Text: fmt.Sprintf(
+								"The file %q was loaded with the \"html\" loader, and HTML files can only be used as entry points.",
+								otherFile.inputFile.Source.PrettyPaths.Select(s.options.LogPathStyle))}})
+					}
 				}
 
 				// If the imported file uses the "copy" loader, then move it from
@@ -2680,6 +3088,44 @@ func (s *scanner) processScannedFiles(entryPointMeta []graph.EntryPoint) []scann
 					}
 				}
 			}
+
+			// Validate that each reference in an HTML file targets the right kind of
+			// file. The checks above only know about the import record, not which
+			// tag and attribute the reference came from.
+			if repr, ok := result.file.inputFile.Repr.(*graph.HTMLRepr); ok {
+				for _, ref := range repr.AST.Refs {
+					record := &records[ref.ImportRecordIndex]
+					if !record.SourceIndex.IsValid() {
+						continue
+					}
+					otherFile := &s.results[record.SourceIndex.GetIndex()].file
+					var text string
+					switch ref.Kind {
+					case html_ast.RefScript:
+						if _, ok := otherFile.inputFile.Repr.(*graph.JSRepr); !ok {
+							text = "A \"<script>\" tag can only be used to reference a JavaScript file, and %q was loaded with the %q loader."
+						}
+
+					case html_ast.RefStylesheet:
+						if _, ok := otherFile.inputFile.Repr.(*graph.CSSRepr); !ok {
+							text = "A \"<link rel=\"stylesheet\">\" tag can only be used to reference a CSS file, and %q was loaded with the %q loader."
+						}
+
+					case html_ast.RefAsset:
+						if otherRepr, ok := otherFile.inputFile.Repr.(*graph.JSRepr); !ok || otherRepr.AST.URLForCSS == "" {
+							text = "You can't reference the file %q from HTML because it was loaded with the %q loader, which doesn't provide a URL to embed in the resulting HTML."
+						}
+					}
+					if text != "" {
+						s.log.AddErrorWithNotes(&tracker, record.Range,
+							fmt.Sprintf("Cannot use %q here",
+								otherFile.inputFile.Source.PrettyPaths.Select(s.options.LogPathStyle)),
+							[]logger.MsgData{{Text: fmt.Sprintf(text,
+								otherFile.inputFile.Source.PrettyPaths.Select(s.options.LogPathStyle),
+								config.LoaderToString[otherFile.inputFile.Loader])}})
+					}
+				}
+			}
 		}
 
 		// End the metadata chunk
@@ -2926,6 +3372,7 @@ func DefaultExtensionToLoaderMap() map[string]config.Loader {
 		".tsx":        config.LoaderTSX,
 		".css":        config.LoaderCSS,
 		".module.css": config.LoaderLocalCSS,
+		".html":       config.LoaderHTML,
 		".json":       config.LoaderJSON,
 		".txt":        config.LoaderText,
 	}
@@ -3084,6 +3531,21 @@ func (b *Bundle) Compile(log logger.Log, timer *helpers.Timer, mangleCache map[s
 		outputFiles = append(outputFiles, group...)
 	}
 
+	// Generate the manifest file if necessary. This is done after joining the
+	// results since each linking pass only knows about its own entry points.
+	if options.NeedsManifest {
+		timer.Begin("Generate manifest JSON")
+		outputFiles = append(outputFiles, b.generateManifestJSON(outputFiles, &options))
+		timer.End("Generate manifest JSON")
+	}
+
+	// Generate precompressed copies of the output files if requested
+	if options.CompressGzip || options.CompressBrotli {
+		timer.Begin("Compress output files")
+		outputFiles = compressOutputFiles(outputFiles, &options)
+		timer.End("Compress output files")
+	}
+
 	// Also generate the metadata file if necessary
 	var metafileJSON string
 	if options.NeedsMetafile {
@@ -3160,6 +3622,90 @@ func (b *Bundle) Compile(log logger.Log, timer *helpers.Timer, mangleCache map[s
 	return outputFiles, metafileJSON
 }
 
+func (b *Bundle) generateManifestJSON(outputFiles []graph.OutputFile, options *config.Options) graph.OutputFile {
+	var entries []string
+	for _, outputFile := range outputFiles {
+		if outputFile.JSONManifestChunk != "" {
+			entries = append(entries, outputFile.JSONManifestChunk)
+		}
+	}
+
+	// Sort the entries by key for determinism
+	sort.Strings(entries)
+
+	sb := strings.Builder{}
+	sb.WriteString("{")
+	for i, entry := range entries {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString("\n  ")
+		sb.WriteString(entry)
+	}
+	sb.WriteString("\n}\n")
+	contents := []byte(sb.String())
+
+	return graph.OutputFile{
+		AbsPath:  b.fs.Join(options.AbsOutputDir, "manifest.json"),
+		Contents: contents,
+		JSONMetadataChunk: fmt.Sprintf(
+			options.MetafileFormat.MaybeRemoveWhitespace("{\n      \"imports\": [],\n      \"exports\": [],\n      \"inputs\": {},\n      \"bytes\": %d\n    }"),
+			len(contents)),
+	}
+}
+
+// Each output file is followed by its compressed copies. Compressed copies
+// that aren't smaller than the original file are omitted since a server would
+// be better off serving the original file.
+func compressOutputFiles(outputFiles []graph.OutputFile, options *config.Options) []graph.OutputFile {
+	compressed := make([][]graph.OutputFile, len(outputFiles))
+	seen := make(map[string]bool)
+	waitGroup := sync.WaitGroup{}
+	for i, outputFile := range outputFiles {
+		// Don't compress the same file twice (can happen with the "file" loader)
+		if seen[outputFile.AbsPath] {
+			continue
+		}
+		seen[outputFile.AbsPath] = true
+
+		waitGroup.Add(1)
+		go func(i int, outputFile graph.OutputFile) {
+			defer waitGroup.Done()
+			var results []graph.OutputFile
+			addResult := func(ext string, contents []byte) {
+				if len(contents) < len(outputFile.Contents) {
+					results = append(results, graph.OutputFile{
+						AbsPath:  outputFile.AbsPath + ext,
+						Contents: contents,
+						JSONMetadataChunk: fmt.Sprintf(
+							options.MetafileFormat.MaybeRemoveWhitespace("{\n      \"imports\": [],\n      \"exports\": [],\n      \"inputs\": {},\n      \"bytes\": %d\n    }"),
+							len(contents)),
+					})
+				}
+			}
+			if options.CompressGzip {
+				var buffer bytes.Buffer
+				writer, _ := gzip.NewWriterLevel(&buffer, gzip.BestCompression)
+				writer.Write(outputFile.Contents)
+				writer.Close()
+				addResult(".gz", buffer.Bytes())
+			}
+			if options.CompressBrotli {
+				addResult(".br", brotli.Encode(outputFile.Contents))
+			}
+			compressed[i] = results
+		}(i, outputFile)
+	}
+	waitGroup.Wait()
+
+	results := make([]graph.OutputFile, 0, len(outputFiles)*3)
+	for i, outputFile := range outputFiles {
+		results = append(results, outputFile)
+		results = append(results, compressed[i]...)
+	}
+	return results
+}
+
 // Find all files reachable from all entry points. This order should be
 // deterministic given that the entry point order is deterministic, since the
 // returned order is the postorder of the graph traversal and import record
@@ -3203,6 +3749,75 @@ func findReachableFiles(files []graph.InputFile, entryPoints []graph.EntryPoint)
 	return order
 }
 
+// This describes a module for the hot module replacement implementation in
+// the development server. Modules are identified by the same paths that are
+// used for them in the generated code.
+type HotModule struct {
+	// This is empty if the module can't be updated separately (e.g. it's not in
+	// the "file" namespace or it's not a JavaScript module)
+	AbsPath string
+
+	Hash      uint64
+	Importers []string
+	IsCSS     bool
+}
+
+func (b *Bundle) HotModules() map[string]HotModule {
+	modules := make(map[string]HotModule)
+	idForFile := func(file *scannerFile) string {
+		return file.inputFile.Source.PrettyPaths.Select(b.options.CodePathStyle)
+	}
+
+	for i := range b.files {
+		file := &b.files[i]
+		source := &file.inputFile.Source
+		if source.Index == runtime.SourceIndex {
+			continue
+		}
+		hasher := xxhash.New()
+		hasher.Write([]byte(source.Contents))
+		module := HotModule{Hash: hasher.Sum64()}
+
+		switch repr := file.inputFile.Repr.(type) {
+		case *graph.JSRepr:
+			if source.KeyPath.Namespace == "file" && !repr.CSSSourceIndex.IsValid() {
+				module.AbsPath = source.KeyPath.Text
+			}
+		case *graph.CSSRepr:
+			module.IsCSS = true
+		}
+		id := idForFile(file)
+		module.Importers = modules[id].Importers
+		modules[id] = module
+
+		// Add this module as an importer of everything it imports
+		if records := file.inputFile.Repr.ImportRecords(); records != nil {
+			for _, record := range *records {
+				if record.SourceIndex.IsValid() {
+					otherID := idForFile(&b.files[record.SourceIndex.GetIndex()])
+					other := modules[otherID]
+					other.Importers = append(other.Importers, id)
+					modules[otherID] = other
+				}
+			}
+		}
+	}
+
+	// Make the importer lists deterministic and remove duplicates
+	for id, module := range modules {
+		sort.Strings(module.Importers)
+		importers := module.Importers[:0]
+		for i, importer := range module.Importers {
+			if i == 0 || importer != module.Importers[i-1] {
+				importers = append(importers, importer)
+			}
+		}
+		module.Importers = importers
+		modules[id] = module
+	}
+	return modules
+}
+
 // This is done in parallel with linking because linking is a mostly serial
 // phase and there are extra resources for parallelism. This could also be done
 // during parsing but that would slow down parsing and delay the start of the
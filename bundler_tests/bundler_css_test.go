@@ -1,10 +1,12 @@
 package bundler_tests
 
 import (
+	"regexp"
 	"testing"
 
 	"github.com/ije/esbuild-internal/compat"
 	"github.com/ije/esbuild-internal/config"
+	"github.com/ije/esbuild-internal/css_ast"
 )
 
 var css_suite = suite{
@@ -2651,3 +2653,45 @@ func TestCSSAssetPathsWithSpacesBundle(t *testing.T) {
 		},
 	})
 }
+
+func TestCSSOnParsePlugin(t *testing.T) {
+	css_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.css": `
+				@import "./shared.css";
+				a { color: red }
+				@media screen {
+					b { color: red }
+				}
+			`,
+			"/shared.css": `
+				c { color: red }
+			`,
+		},
+		entryPaths: []string{"/entry.css"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.css",
+			Plugins: []config.Plugin{{
+				Name: "plugin",
+				OnParse: []config.OnParse{
+					{
+						Filter: regexp.MustCompile("entry\\.css$"),
+						Callback: func(args config.OnParseArgs) config.OnParseResult {
+							visitor := css_ast.Visitor{
+								EnterRule: func(rule *css_ast.Rule) bool {
+									if decl, ok := rule.Data.(*css_ast.RDeclaration); ok && decl.KeyText == "color" {
+										decl.Value[0].Text = "blue"
+									}
+									return true
+								},
+							}
+							visitor.VisitAST(args.CSSAST)
+							return config.OnParseResult{}
+						},
+					},
+				},
+			}},
+		},
+	})
+}
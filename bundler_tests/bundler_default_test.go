@@ -1,16 +1,27 @@
 package bundler_tests
 
 import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
 	"regexp"
 	"strings"
 	"testing"
 
+	"github.com/ije/esbuild-internal/ast"
 	"github.com/ije/esbuild-internal/bundler"
+	"github.com/ije/esbuild-internal/cache"
 	"github.com/ije/esbuild-internal/compat"
 	"github.com/ije/esbuild-internal/config"
+	"github.com/ije/esbuild-internal/fs"
 	"github.com/ije/esbuild-internal/helpers"
 	"github.com/ije/esbuild-internal/js_ast"
+	"github.com/ije/esbuild-internal/linker"
 	"github.com/ije/esbuild-internal/logger"
+	"github.com/ije/esbuild-internal/test"
 )
 
 var default_suite = suite{
@@ -8419,6 +8430,142 @@ func TestMetafileImportWithTypeJSON(t *testing.T) {
 	})
 }
 
+func TestMetafileExplain(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/project/entry.js": `
+				import { used } from './lib'
+				import './side-effects'
+				import('./lazy').then(console.log)
+				console.log(used())
+			`,
+			"/project/lib.js": `
+				import { helper } from './helper'
+				export function used() { return helper }
+				export function unused() {}
+			`,
+			"/project/helper.js": `
+				export let helper = 1, other = 2
+			`,
+			"/project/side-effects.js": `
+				console.log('side effect')
+			`,
+			"/project/lazy.js": `
+				import { used } from './lib'
+				export default used
+			`,
+		},
+		entryPaths: []string{"/project/entry.js"},
+		options: config.Options{
+			Mode:            config.ModeBundle,
+			AbsOutputDir:    "/out",
+			NeedsMetafile:   true,
+			MetafileExplain: true,
+			CodeSplitting:   true,
+			OutputFormat:    config.FormatESModule,
+		},
+	})
+}
+
+func TestBudgets(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/project/a.js": `
+				import { shared } from './shared'
+				console.log('a', shared)
+			`,
+			"/project/b.js": `
+				import { shared } from './shared'
+				import('./lazy').then(console.log)
+				console.log('b', shared)
+			`,
+			"/project/shared.js": `
+				export let shared = 'this string is shared between both entry points'
+			`,
+			"/project/lazy.js": `
+				export default 'this string is only loaded on demand'
+			`,
+			"/project/style.css": `
+				a { color: red }
+			`,
+		},
+		entryPaths: []string{"/project/a.js", "/project/b.js", "/project/style.css"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputDir:  "/out",
+			CodeSplitting: true,
+			OutputFormat:  config.FormatESModule,
+			Budgets: []config.Budget{
+				{Pattern: helpers.ParseGlobPattern("chunk-*.js"), MaxBytes: 50},
+				{Pattern: helpers.ParseGlobPattern("**/*.css"), MaxBytes: 1000, MaxGzipBytes: 10},
+				{Pattern: helpers.ParseGlobPattern("**/*.js"), MaxBytes: 100, IncludeStaticImports: true},
+			},
+		},
+		expectedCompileLog: `ERROR: Output file "out/chunk-U7AXXP73.js" is 107 bytes, which exceeds the budget of 50 bytes for "chunk-*.js"
+ERROR: Output file "out/style.css" is 65 bytes when gzipped, which exceeds the budget of 10 bytes for "**/*.css"
+ERROR: Output file "out/a.js" and the files it imports are 198 bytes, which exceeds the budget of 100 bytes for "**/*.js"
+NOTE: The file "out/a.js" is 91 bytes
+NOTE: The file "out/chunk-U7AXXP73.js" is 107 bytes
+ERROR: Output file "out/b.js" and the files it imports are 246 bytes, which exceeds the budget of 100 bytes for "**/*.js"
+NOTE: The file "out/b.js" is 139 bytes
+NOTE: The file "out/chunk-U7AXXP73.js" is 107 bytes
+ERROR: Output file "out/lazy-7Z23FKJE.js" is 116 bytes, which exceeds the budget of 100 bytes for "**/*.js"
+`,
+	})
+}
+
+func TestManifest(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/project/src/a.js": `
+				import { shared } from './shared'
+				import './style.css'
+				import('./lazy').then(console.log)
+				console.log('a', shared)
+			`,
+			"/project/src/b.js": `
+				import { shared } from './shared'
+				console.log('b', shared)
+			`,
+			"/project/src/shared.js": `
+				import logo from './logo.png'
+				export let shared = logo
+			`,
+			"/project/src/lazy.js": `
+				export default 'lazy'
+			`,
+			"/project/src/style.css": `
+				a { background: url(./icon.svg) }
+			`,
+			"/project/src/other.css": `
+				b { color: red }
+			`,
+			"/project/src/logo.png": `logo`,
+			"/project/src/icon.svg": `icon`,
+		},
+		entryPaths:    []string{"/project/src/a.js", "/project/src/b.js", "/project/src/other.css"},
+		absWorkingDir: "/project",
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputDir:  "/project/out",
+			CodeSplitting: true,
+			OutputFormat:  config.FormatESModule,
+			NeedsManifest: true,
+			ExtensionToLoader: map[string]config.Loader{
+				".js":  config.LoaderJS,
+				".css": config.LoaderCSS,
+				".png": config.LoaderFile,
+				".svg": config.LoaderFile,
+			},
+			EntryPathTemplate: []config.PathTemplate{
+				// "[name]-[hash]"
+				{Data: "./", Placeholder: config.NamePlaceholder},
+				{Data: "-", Placeholder: config.HashPlaceholder},
+			},
+		},
+	})
+}
+
 func TestCommentPreservation(t *testing.T) {
 	default_suite.expectBundled(t, bundled{
 		files: map[string]string{
@@ -9433,3 +9580,987 @@ func TestBundleESMWithNestedVarIssue4348(t *testing.T) {
 		},
 	})
 }
+
+func TestUMDGlobalNameWithExternals(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import React from 'react'
+				import { render } from 'react-dom'
+				import * as pkg from '@scope/pkg'
+				import './foo'
+				export const x = React.name + render() + pkg.v
+				export default 123
+			`,
+			"/foo.js": `
+				require('react')
+				console.log('foo')
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatUMD,
+			GlobalName:    []string{"my", "lib"},
+			AbsOutputFile: "/out.js",
+			ExternalSettings: config.ExternalSettings{
+				PreResolve: config.ExternalMatchers{Exact: map[string]bool{
+					"react":      true,
+					"react-dom":  true,
+					"@scope/pkg": true,
+				}},
+			},
+		},
+	})
+}
+
+func TestUMDGlobalsOption(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import React from 'react'
+				import fp from 'lodash/fp'
+				import weird from 'weird'
+				import guessed from 'react-dom'
+				console.log(React, fp, weird, guessed)
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatUMD,
+			AbsOutputFile: "/out.js",
+			UMDGlobals: map[string][]string{
+				"react":     {"React"},
+				"lodash/fp": {"_", "fp"},
+				"weird":     {"this", "my-lib"},
+			},
+			ExternalSettings: config.ExternalSettings{
+				PreResolve: config.ExternalMatchers{Exact: map[string]bool{
+					"react":     true,
+					"lodash/fp": true,
+					"weird":     true,
+					"react-dom": true,
+				}},
+			},
+		},
+	})
+}
+
+func TestUMDCommonJSEntryPoint(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				const React = require('react')
+				module.exports = { name: React.name }
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:                  config.ModeBundle,
+			OutputFormat:          config.FormatUMD,
+			GlobalName:            []string{"this", "lib"},
+			AbsOutputFile:         "/out.js",
+			UnsupportedJSFeatures: compat.Arrow | compat.LogicalAssignment,
+			ExternalSettings: config.ExternalSettings{
+				PreResolve: config.ExternalMatchers{Exact: map[string]bool{
+					"react": true,
+				}},
+			},
+		},
+	})
+}
+
+func TestUMDNoGlobalNameMinify(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				export let foo = 123
+				console.log(foo)
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:              config.ModeBundle,
+			OutputFormat:      config.FormatUMD,
+			AbsOutputFile:     "/out.js",
+			MinifyWhitespace:  true,
+			MinifyIdentifiers: true,
+		},
+	})
+}
+
+func TestSystemFormatImportsAndExports(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import React from 'react'
+				import * as dom from 'react-dom'
+				import 'side-effect'
+				export * from 'star'
+				export * as ns from 'star-ns'
+				export {foo as bar} from 'named'
+				export let x = 1
+				export function setX(v) { x = v; [x] = [v] }
+				export function incX() { return x++ }
+				export default React.name + dom.version
+				console.log(import.meta.url, import('lazy'))
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatSystem,
+			AbsOutputFile: "/out.js",
+			ExternalSettings: config.ExternalSettings{
+				PreResolve: config.ExternalMatchers{Exact: map[string]bool{
+					"react":       true,
+					"react-dom":   true,
+					"side-effect": true,
+					"star":        true,
+					"star-ns":     true,
+					"named":       true,
+					"lazy":        true,
+				}},
+			},
+		},
+	})
+}
+
+func TestSystemFormatExportStarNameClash(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				export * from 'dep'
+				export function foo() { return 'local' }
+				export const bar = 1
+				const baz = 2
+				export { baz as "a-b", baz as "__proto__" }
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatSystem,
+			AbsOutputFile: "/out.js",
+			ExternalSettings: config.ExternalSettings{
+				PreResolve: config.ExternalMatchers{Exact: map[string]bool{
+					"dep": true,
+				}},
+			},
+		},
+	})
+}
+
+func TestSystemFormatExportStarNameClashMinify(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				export * from 'dep'
+				export function foo() { return 'local' }
+				export const bar = 1
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:             config.ModeBundle,
+			OutputFormat:     config.FormatSystem,
+			MinifyWhitespace: true,
+			AbsOutputFile:    "/out.js",
+			ExternalSettings: config.ExternalSettings{
+				PreResolve: config.ExternalMatchers{Exact: map[string]bool{
+					"dep": true,
+				}},
+			},
+		},
+	})
+}
+
+func TestSystemFormatHoistedFunctions(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import {helper} from './helper'
+				export class Foo { bar() { return helper() } }
+				export function make() { return new Foo }
+				export default function() { return make() }
+				export const count = 1
+			`,
+			"/helper.js": `
+				let calls = 0
+				export function helper() { return calls++ }
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatSystem,
+			AbsOutputFile: "/out.js",
+		},
+	})
+}
+
+func TestSystemFormatHoistedFunctionsNestedVar(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				if (Math.random() < 0.5) { var i = 1 }
+				export function last() { return i }
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeConvertFormat,
+			OutputFormat:  config.FormatSystem,
+			AbsOutputFile: "/out.js",
+		},
+	})
+}
+
+func TestSystemFormatHoistedFunctionsForVar(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				let total = 0
+				for (var i = 0; i < 3; i++) total += i
+				export function add(x) { return total + x }
+				export function lastIndex() { return i }
+				export function callsLastIndex() { return lastIndex() }
+				export default function () { return add(1) }
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeConvertFormat,
+			OutputFormat:  config.FormatSystem,
+			AbsOutputFile: "/out.js",
+		},
+	})
+}
+
+func TestSystemFormatHoistedFunctionsMinify(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				let x = 1
+				export function get() { return x }
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:              config.ModeBundle,
+			OutputFormat:      config.FormatSystem,
+			AbsOutputFile:     "/out.js",
+			MinifyWhitespace:  true,
+			MinifyIdentifiers: true,
+		},
+	})
+}
+
+func TestSystemFormatTopLevelAwait(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import {value} from './foo'
+				export let result = await value
+			`,
+			"/foo.js": `
+				export let value = Promise.resolve(123)
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatSystem,
+			AbsOutputFile: "/out.js",
+		},
+	})
+}
+
+func TestSystemFormatCommonJSEntryPointMinify(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				exports.foo = 123
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:              config.ModeBundle,
+			OutputFormat:      config.FormatSystem,
+			AbsOutputFile:     "/out.js",
+			MinifyWhitespace:  true,
+			MinifyIdentifiers: true,
+		},
+	})
+}
+
+func TestHotModuleReplacement(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import {render} from './app'
+				import lib from './lib.cjs'
+				render(lib)
+				if (import.meta.hot) import.meta.hot.accept('./app', app => app.render(lib))
+			`,
+			"/app.js": `
+				export let render = x => console.log(x)
+				import.meta.hot?.dispose(data => { data.last = render })
+			`,
+			"/lib.cjs": `
+				module.exports = 123
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:                 config.ModeBundle,
+			OutputFormat:         config.FormatIIFE,
+			AbsOutputFile:        "/out.js",
+			HotModuleReplacement: true,
+		},
+	})
+}
+
+func TestHotModuleReplacementUpdate(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/app.js": `
+				import {helper} from './helper'
+				import lib from './lib.cjs'
+				import data from './data.json'
+				export let render = () => console.log(helper, lib, data)
+				import.meta.hot.accept()
+			`,
+			"/src/helper.ts": `
+				export let helper: number = 1
+			`,
+			"/src/lib.cjs": `
+				module.exports = 123
+			`,
+			"/src/data.json": `
+				{ "value": 2 }
+			`,
+		},
+		entryPaths: []string{"/src/app.js"},
+		options: config.Options{
+			Mode:                 config.ModeBundle,
+			OutputFormat:         config.FormatCommonJS,
+			AbsOutputFile:        "/out.js",
+			HotModuleReplacement: true,
+			HotUpdatePath:        "/src/app.js",
+		},
+	})
+}
+
+func TestOnParsePlugin(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import {foo, bar} from './foo'
+				console.log(foo, bar, __VERSION__)
+			`,
+			"/foo.js": `
+				export let foo = 1
+				export let bar = 2
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+			Plugins: []config.Plugin{{
+				Name: "plugin",
+				OnParse: []config.OnParse{
+					{
+						Filter: regexp.MustCompile("entry\\.js$"),
+						Callback: func(args config.OnParseArgs) config.OnParseResult {
+							tree := args.JSAST
+							visitor := js_ast.Visitor{
+								ExitExpr: func(expr *js_ast.Expr) {
+									if id, ok := expr.Data.(*js_ast.EIdentifier); ok && tree.Symbols[id.Ref.InnerIndex].OriginalName == "__VERSION__" {
+										expr.Data = &js_ast.EString{Value: helpers.StringToUTF16("1.2.3")}
+									}
+								},
+							}
+							visitor.VisitAST(tree)
+							return config.OnParseResult{}
+						},
+					},
+					{
+						// Declare a new symbol whose name collides with an existing one and
+						// reference it from an existing declaration
+						Filter: regexp.MustCompile("foo\\.js$"),
+						Callback: func(args config.OnParseArgs) config.OnParseResult {
+							tree := args.JSAST
+							ref := tree.NewTopLevelSymbol(ast.SymbolHoisted, "bar")
+							for i := range tree.Parts {
+								part := &tree.Parts[i]
+								for j, stmt := range part.Stmts {
+									if local, ok := stmt.Data.(*js_ast.SLocal); ok && local.Decls[0].ValueOrNil.Data != nil {
+										if id := local.Decls[0].Binding.Data.(*js_ast.BIdentifier); tree.Symbols[id.Ref.InnerIndex].OriginalName == "foo" {
+											local.Decls[0].ValueOrNil = js_ast.Expr{Data: &js_ast.EIdentifier{Ref: ref}}
+											decl := js_ast.Stmt{Data: &js_ast.SLocal{Kind: js_ast.LocalVar, Decls: []js_ast.Decl{{
+												Binding:    js_ast.Binding{Data: &js_ast.BIdentifier{Ref: ref}},
+												ValueOrNil: js_ast.Expr{Data: &js_ast.EString{Value: helpers.StringToUTF16("generated")}},
+											}}}}
+											part.Stmts = append([]js_ast.Stmt{decl}, part.Stmts[j:]...)
+											return config.OnParseResult{}
+										}
+									}
+								}
+							}
+							return config.OnParseResult{}
+						},
+					},
+				},
+			}},
+		},
+	})
+}
+
+func TestOnParsePluginError(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				console.log(1)
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+			Plugins: []config.Plugin{{
+				Name: "plugin",
+				OnParse: []config.OnParse{
+					{
+						Filter: regexp.MustCompile("."),
+						Callback: func(args config.OnParseArgs) config.OnParseResult {
+							return config.OnParseResult{ThrownError: errors.New("Failed to transform")}
+						},
+					},
+				},
+			}},
+		},
+		expectedScanLog: `ERROR: Failed to transform
+`,
+	})
+}
+
+func TestOnRenderChunkPlugin(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/a.js": `
+				import {shared} from './shared'
+				export let a = shared + 1
+			`,
+			"/b.js": `
+				import {shared} from './shared'
+				console.log(shared)
+			`,
+			"/shared.js": `
+				export let shared = 123
+			`,
+		},
+		entryPaths: []string{"/a.js", "/b.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatESModule,
+			CodeSplitting: true,
+			AbsOutputDir:  "/out",
+			SourceMap:     config.SourceMapExternalWithoutComment,
+			Plugins: []config.Plugin{{
+				Name: "plugin",
+				OnRenderChunk: []config.OnRenderChunk{
+					{
+						// Add a comment line to the top and return a source map that maps
+						// the start of each following line to the start of the line before
+						Callback: func(args config.OnRenderChunkArgs) config.OnRenderChunkResult {
+							entryPoint := "none"
+							if args.EntryPoint != nil {
+								entryPoint = win2unix(args.EntryPoint.Text)
+							}
+							var imports []string
+							for _, item := range args.Imports {
+								imports = append(imports, win2unix(item.AbsPath))
+							}
+							banner := fmt.Sprintf("// entry: %s, imports: [%s], exports: [%s]\n",
+								entryPoint, strings.Join(imports, ", "), strings.Join(args.Exports, ", "))
+							mappings := ";AAAA" + strings.Repeat(";AACA", strings.Count(string(args.Code), "\n")-1)
+							return config.OnRenderChunkResult{
+								Code:      append([]byte(banner), args.Code...),
+								SourceMap: []byte(`{"version":3,"sources":["x"],"mappings":"` + mappings + `"}`),
+							}
+						},
+					},
+				},
+			}},
+		},
+	})
+}
+
+func TestOnRenderChunkPluginHash(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/a.js": `
+				import {shared} from './shared'
+				console.log(shared)
+			`,
+			"/b.js": `
+				import {shared} from './shared'
+				console.log(shared + 1)
+			`,
+			"/shared.js": `
+				export let shared = 123
+			`,
+		},
+		entryPaths: []string{"/a.js", "/b.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatESModule,
+			CodeSplitting: true,
+			AbsOutputDir:  "/out",
+			EntryPathTemplate: []config.PathTemplate{
+				{Data: "./", Placeholder: config.NamePlaceholder},
+				{Data: "-", Placeholder: config.HashPlaceholder},
+			},
+			Plugins: []config.Plugin{{
+				Name: "plugin",
+				OnRenderChunk: []config.OnRenderChunk{
+					{
+						// The hash of the shared chunk (and of the entry points that import
+						// it) must change to reflect the new code. The comment contains the
+						// name that the chunk had before the plugin ran, which is updated too.
+						Callback: func(args config.OnRenderChunkArgs) config.OnRenderChunkResult {
+							code := strings.Replace(string(args.Code), "123", "456", 1)
+							return config.OnRenderChunkResult{
+								Code: []byte(fmt.Sprintf("// name: %s\n%s", path.Base(win2unix(args.AbsPath)), code)),
+							}
+						},
+					},
+				},
+			}},
+		},
+	})
+}
+
+func TestOnRenderChunkPluginHashReformattedPath(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/a.js": `
+				import('./shared').then(ns => console.log(ns.shared))
+			`,
+			"/shared.js": `
+				export let shared = 123
+			`,
+		},
+		entryPaths: []string{"/a.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatESModule,
+			CodeSplitting: true,
+			AbsOutputDir:  "/out",
+			Plugins: []config.Plugin{{
+				Name: "plugin",
+				OnRenderChunk: []config.OnRenderChunk{
+					{
+						// The path to the shared chunk must still be updated after its
+						// hash changes even though it no longer starts with "./"
+						Callback: func(args config.OnRenderChunkArgs) config.OnRenderChunkResult {
+							code := strings.Replace(string(args.Code), "123", "456", 1)
+							code = strings.Replace(code, `import("./`, `import("/assets/`, -1)
+							return config.OnRenderChunkResult{Code: []byte(code)}
+						},
+					},
+				},
+			}},
+		},
+	})
+}
+
+func TestOnRenderChunkPluginWithoutSourceMap(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				console.log(123)
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:         config.ModeBundle,
+			OutputFormat: config.FormatESModule,
+			AbsOutputDir: "/out",
+			SourceMap:    config.SourceMapExternalWithoutComment,
+			Plugins: []config.Plugin{{
+				Name: "plugin",
+				OnRenderChunk: []config.OnRenderChunk{
+					{
+						// The old mappings would be off by one line after this
+						Callback: func(args config.OnRenderChunkArgs) config.OnRenderChunkResult {
+							return config.OnRenderChunkResult{
+								Code: append([]byte("// banner\n"), args.Code...),
+							}
+						},
+					},
+				},
+			}},
+		},
+		expectedCompileLog: `WARNING: The source map for "out/entry.js" has no mappings because the plugin "plugin" changed the code without returning a source map
+`,
+	})
+}
+
+// The compressed files are binary, so this checks the output files directly
+// instead of using a snapshot
+func TestCompressOutputFiles(t *testing.T) {
+	files := map[string]string{
+		"/entry.js": strings.Repeat("console.log('this should be compressed')\n", 100),
+		"/small.js": "x()",
+	}
+	options := config.Options{
+		Mode:                config.ModeBundle,
+		OutputFormat:        config.FormatESModule,
+		AbsOutputDir:        "/out",
+		ExtensionOrder:      []string{".js"},
+		TreeShaking:         true,
+		OmitRuntimeForTests: true,
+		CompressGzip:        true,
+		CompressBrotli:      true,
+	}
+	entryPoints := []bundler.EntryPoint{{InputPath: "/entry.js"}, {InputPath: "/small.js"}}
+	log := logger.NewDeferLog(logger.DeferLogNoVerboseOrDebug, nil)
+	bundle := bundler.ScanBundle(config.BuildCall, log, fs.MockFS(files, fs.MockUnix, "/"), cache.MakeCacheSet(), entryPoints, options, nil)
+	results, _ := bundle.Compile(log, nil, nil, linker.Link)
+	assertLog(t, log.Done(), "")
+
+	// Compressed copies that aren't smaller than the original are omitted
+	contents := make(map[string][]byte)
+	var paths []string
+	for _, result := range results {
+		contents[result.AbsPath] = result.Contents
+		paths = append(paths, result.AbsPath)
+	}
+	test.AssertEqual(t, strings.Join(paths, " "), "/out/entry.js /out/entry.js.gz /out/entry.js.br /out/small.js")
+
+	reader, err := gzip.NewReader(bytes.NewReader(contents["/out/entry.js.gz"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decompressed, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.AssertEqualWithDiff(t, string(decompressed), string(contents["/out/entry.js"]))
+	if len(contents["/out/entry.js.br"]) >= len(contents["/out/entry.js"]) {
+		t.Fatalf("Expected the brotli file to be smaller than the original file")
+	}
+}
+
+func TestNewWorker(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/entry.js": `
+				import { shared } from './shared'
+				const worker = new Worker(new URL('./worker.js', import.meta.url), { type: 'module' })
+				const sharedWorker = new SharedWorker(new URL('./worker.js', import.meta.url), { type: 'module' })
+				console.log(shared, worker, sharedWorker)
+			`,
+			"/src/worker.js": `
+				import { shared } from './shared'
+				self.onmessage = () => postMessage(shared)
+			`,
+			"/src/shared.js": `
+				export const shared = 123
+			`,
+		},
+		entryPaths: []string{"/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputDir:  "/out",
+			NeedsMetafile: true,
+		},
+	})
+}
+
+func TestNewWorkerCodeSplitting(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/entry.js": `
+				import { shared } from './shared'
+				const worker = new Worker(new URL('./worker.js', import.meta.url), { type: 'module' })
+				console.log(shared, worker)
+			`,
+			"/src/worker.js": `
+				import { shared } from './shared'
+				self.onmessage = () => postMessage(shared)
+			`,
+			"/src/shared.js": `
+				export const shared = 123
+			`,
+		},
+		entryPaths: []string{"/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputDir:  "/out",
+			CodeSplitting: true,
+		},
+	})
+}
+
+func TestNewWorkerNoBundle(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				new Worker(new URL('./worker.js', import.meta.url))
+				new URL('./logo.png', import.meta.url)
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeConvertFormat,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputFile: "/out.js",
+		},
+	})
+}
+
+func TestImportMap(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/project/src/entry.js": `
+				import react from 'react'
+				import debounce from 'lodash/debounce'
+				import { h } from 'preact'
+				import config from './config.js'
+				import legacy from './legacy/app.js'
+				import other from 'other'
+				console.log(react, debounce, h, config, legacy, other)
+			`,
+			"/project/src/config.js":                   `export default 'dev'`,
+			"/project/src/config.prod.js":              `export default 'prod'`,
+			"/project/src/legacy/app.js":               `import react from 'react'; export default react`,
+			"/project/vendor/react.js":                 `export default 'react'`,
+			"/project/vendor/react-legacy.js":          `export default 'react-legacy'`,
+			"/project/vendor/lodash/debounce.js":       `export default 'debounce'`,
+			"/project/node_modules/react/index.js":     `export default 'node_modules react'`,
+			"/project/node_modules/other/index.js":     `export default 'node_modules other'`,
+			"/project/node_modules/lodash/debounce.js": `export default 'node_modules debounce'`,
+			"/project/importmap.json": `{
+				"imports": {
+					"react": "./vendor/react.js",
+					"lodash/": "./vendor/lodash/",
+					"preact": "https://esm.sh/preact",
+					"./src/config.js": "./src/config.prod.js"
+				},
+				"scopes": {
+					"./src/legacy/": {
+						"react": "./vendor/react-legacy.js"
+					}
+				}
+			}`,
+		},
+		entryPaths: []string{"/project/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+			ImportMapPath: "/project/importmap.json",
+		},
+	})
+}
+
+func TestImportMapRaw(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import foo from 'foo'
+				import bar from 'bar/baz.js'
+				console.log(foo, bar)
+			`,
+			"/lib/foo.js":     `export default 'foo'`,
+			"/lib/bar/baz.js": `export default 'baz'`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+			ImportMapRaw:  `{ "imports": { "foo": "/lib/foo.js", "bar/": "/lib/bar/" } }`,
+		},
+	})
+}
+
+func TestImportMapMissingFile(t *testing.T) {
+	default_suite.expectBundledUnix(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import foo from 'foo'
+				console.log(foo)
+			`,
+			"/importmap.json": `{ "imports": { "foo": "./missing.js" } }`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+			ImportMapPath: "/importmap.json",
+		},
+		expectedScanLog: `entry.js: ERROR: Could not resolve "foo"
+importmap.json: NOTE: The import path "foo" was remapped to "/missing.js" by the import map here:
+NOTE: You can mark the path "foo" as external to exclude it from the bundle, which will remove this error and leave the unresolved path in the bundle.
+`,
+	})
+}
+
+func TestImportMapNull(t *testing.T) {
+	default_suite.expectBundledUnix(t, bundled{
+		files: map[string]string{
+			"/project/src/entry.js": `
+				import ok from 'lib/ok.js'
+				import secret from 'lib/secret.js'
+				import react from 'react'
+				import legacy from './legacy/app.js'
+				console.log(ok, secret, react, legacy)
+			`,
+			"/project/src/legacy/app.js":           `import react from 'react'; export default react`,
+			"/project/lib/ok.js":                   `export default 'ok'`,
+			"/project/lib/secret.js":               `export default 'secret'`,
+			"/project/vendor/react.js":             `export default 'react'`,
+			"/project/node_modules/react/index.js": `export default 'node_modules react'`,
+			"/project/importmap.json": `{
+				"imports": {
+					"lib/": "./lib/",
+					"lib/secret.js": null,
+					"react": "./vendor/react.js"
+				},
+				"scopes": {
+					"./src/legacy/": {
+						"react": null
+					}
+				}
+			}`,
+		},
+		entryPaths: []string{"/project/src/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+			ImportMapPath: "/project/importmap.json",
+		},
+		expectedScanLog: `project/src/entry.js: ERROR: Could not resolve "lib/secret.js"
+project/importmap.json: NOTE: The import path "lib/secret.js" is blocked by a null address in the import map here:
+NOTE: You can mark the path "lib/secret.js" as external to exclude it from the bundle, which will remove this error and leave the unresolved path in the bundle.
+project/src/legacy/app.js: ERROR: Could not resolve "react"
+project/importmap.json: NOTE: The import path "react" is blocked by a null address in the import map here:
+NOTE: You can mark the path "react" as external to exclude it from the bundle, which will remove this error and leave the unresolved path in the bundle.
+`,
+	})
+}
+
+func TestImportMapWarnings(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import foo from './foo.js'
+				console.log(foo)
+			`,
+			"/foo.js": `export default 'foo'`,
+			"/importmap.json": `{
+				"imports": {
+					"": "./foo.js",
+					"a": 123,
+					"b/": "./b",
+					"c": "c-package",
+					"d": null
+				},
+				"scopes": {
+					"bare": {}
+				}
+			}`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+			ImportMapPath: "/importmap.json",
+		},
+		expectedScanLog: `importmap.json: WARNING: Import map keys cannot be empty
+importmap.json: WARNING: The address for "a" must be a string
+importmap.json: WARNING: The address for "b/" must end with "/" because the key ends with "/"
+importmap.json: WARNING: The address "c-package" must be a relative path or a URL
+NOTE: You can use the "alias" feature to substitute one package for another.
+importmap.json: WARNING: The scope "bare" must be a relative path or a URL
+`,
+	})
+}
+
+func TestURLVendorDir(t *testing.T) {
+	default_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/project/entry.js": `
+				import main from 'https://cdn.example.com/lib/main.js'
+				import data from 'https://cdn.example.com/data.json?v=1'
+				console.log(main, data)
+			`,
+			"/project/importmap.json": `{ "imports": { "preact": "https://esm.sh/preact@10.19.0" } }`,
+			"/project/vendor/lock.json": `{
+				"https://esm.sh/preact@10.19.0": "00fe791c8410cdb70ddd253cb25c69617ad7d9044e97731d8714a5ef2a1cf29e",
+				"https://cdn.example.com/lib/main.js": "4b1d6970e080c33777d0207ac5073bd7c2311eb83346b93a30ee8e0b9eabc42d",
+				"https://cdn.example.com/lib/util.js": "dc7cdad3e0f857a0cebae0204577c76779fc99967604b46cbbb781ac71f69a64",
+				"https://cdn.example.com/shared/dep.mjs": "1fb506fc0bbab2135b2e220a45aad74cf270f76f21e92a1bb1e8c0adaeba65b7",
+				"https://cdn.example.com/data.json?v=1": "c3aa9744214caf6eb993d6f88f3f1dda3e4e60d59f712b6463c4ce2c4b00dfa1"
+			}`,
+			"/project/vendor/00fe791c8410cdb70ddd253cb25c69617ad7d9044e97731d8714a5ef2a1cf29e": `export default "preact"`,
+			"/project/vendor/4b1d6970e080c33777d0207ac5073bd7c2311eb83346b93a30ee8e0b9eabc42d": `import util from "./util.js"; import dep from "/shared/dep.mjs"; import preact from "preact"; export default [util, dep, preact]`,
+			"/project/vendor/dc7cdad3e0f857a0cebae0204577c76779fc99967604b46cbbb781ac71f69a64": `export default "util"`,
+			"/project/vendor/1fb506fc0bbab2135b2e220a45aad74cf270f76f21e92a1bb1e8c0adaeba65b7": `export default "dep"`,
+			"/project/vendor/c3aa9744214caf6eb993d6f88f3f1dda3e4e60d59f712b6463c4ce2c4b00dfa1": `{"version": 1}`,
+		},
+		entryPaths: []string{"/project/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+			ImportMapPath: "/project/importmap.json",
+			URLVendorDir:  "/project/vendor",
+		},
+	})
+}
+
+func TestURLVendorDirErrors(t *testing.T) {
+	default_suite.expectBundledUnix(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import a from 'https://example.com/unlisted.js'
+				import b from 'https://example.com/tampered.js'
+				import c from 'https://example.com/missing.js'
+				import d from 'https://example.com/external.js'
+				console.log(a, b, c, d)
+			`,
+			"/vendor/lock.json": `{
+				"https://example.com/tampered.js": "6412955dd369c34889b4ef3e2df76c17060909c95af474c798bd3114e16a06d0",
+				"https://example.com/missing.js": "7b0f91156ae05a1b2816925f6af2dd3ce6b4cc30c31c022f5bb75bd6824f51b7",
+				"./relative.js": "7b0f91156ae05a1b2816925f6af2dd3ce6b4cc30c31c022f5bb75bd6824f51b7",
+				"https://example.com/bad-hash.js": "sha256"
+			}`,
+			"/vendor/6412955dd369c34889b4ef3e2df76c17060909c95af474c798bd3114e16a06d0": `export default "tampered"`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputFile: "/out.js",
+			URLVendorDir:  "/vendor",
+			ExternalSettings: config.ExternalSettings{
+				PreResolve: config.ExternalMatchers{Exact: map[string]bool{
+					"https://example.com/external.js": true,
+				}},
+			},
+		},
+		expectedScanLog: `entry.js: ERROR: Could not resolve "https://example.com/unlisted.js"
+NOTE: The URL "https://example.com/unlisted.js" is not in the lockfile "vendor/lock.json". URLs must be downloaded into the vendor directory before they can be bundled.
+NOTE: You can mark the path "https://example.com/unlisted.js" as external to exclude it from the bundle, which will remove this error and leave the unresolved path in the bundle.
+entry.js: ERROR: Could not load "https://example.com/tampered.js": the vendored file "vendor/6412955dd369c34889b4ef3e2df76c17060909c95af474c798bd3114e16a06d0" has the hash ea1fcb9d9f8b555b0410682cf1f32a4c2ee81abaec4d41e0a85eef3e4386af83 but the lockfile expects 6412955dd369c34889b4ef3e2df76c17060909c95af474c798bd3114e16a06d0
+entry.js: ERROR: Could not load "https://example.com/missing.js": the vendored file "vendor/7b0f91156ae05a1b2816925f6af2dd3ce6b4cc30c31c022f5bb75bd6824f51b7" is missing
+vendor/lock.json: ERROR: The lockfile key "./relative.js" must be an "http://" or "https://" URL
+vendor/lock.json: ERROR: The hash for "https://example.com/bad-hash.js" must be a hexadecimal SHA-256 digest
+`,
+	})
+}
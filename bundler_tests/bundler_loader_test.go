@@ -1,6 +1,7 @@
 package bundler_tests
 
 import (
+	"regexp"
 	"testing"
 
 	"github.com/ije/esbuild-internal/bundler"
@@ -1964,3 +1965,322 @@ func TestLoaderDataURLHashSuffixIssue4370(t *testing.T) {
 		},
 	})
 }
+
+func TestLoaderHTML(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/index.html": `<!DOCTYPE html>
+<html>
+<head>
+  <link rel="icon" href="./favicon.png">
+  <link rel="stylesheet" href="style.css">
+  <script type="module" src="./main.js"></script>
+  <script type="module" src="https://example.com/external.js"></script>
+  <!-- <script type="module" src="./commented-out.js"></script> -->
+</head>
+<body>
+  <img src="./logo.png" srcset="./logo.png 1x, ./logo@2x.png 2x" alt="A &amp; B">
+  <script>document.write('<img src="./not-an-image.png">')</script>
+</body>
+</html>
+`,
+			"/src/style.css":   `body { background: url(./logo.png) }`,
+			"/src/main.js":     `import "./main.css"; import { name } from "./lib.js"; console.log(name)`,
+			"/src/main.css":    `.main { color: red }`,
+			"/src/lib.js":      `export let name = "lib"`,
+			"/src/favicon.png": `favicon`,
+			"/src/logo.png":    `logo`,
+			"/src/logo@2x.png": `logo@2x`,
+		},
+		entryPaths: []string{"/src/index.html"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			AbsOutputDir:  "/out",
+			NeedsMetafile: true,
+			ExtensionToLoader: map[string]config.Loader{
+				".html": config.LoaderHTML,
+				".js":   config.LoaderJS,
+				".css":  config.LoaderCSS,
+				".png":  config.LoaderFile,
+			},
+		},
+	})
+}
+
+func TestLoaderHTMLIntegrity(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/index.html": `<link rel="stylesheet" href="./style.css" integrity="sha256-stale" />
+<script type="module" src="./main.js"></script>
+`,
+			"/style.css": `body { color: red }`,
+			"/main.js":   `import "./main.css"; console.log("main")`,
+			"/main.css":  `.main { color: blue }`,
+		},
+		entryPaths: []string{"/index.html"},
+		options: config.Options{
+			Mode:         config.ModeBundle,
+			AbsOutputDir: "/out",
+			Integrity:    config.IntegritySHA384,
+			ExtensionToLoader: map[string]config.Loader{
+				".html": config.LoaderHTML,
+				".js":   config.LoaderJS,
+				".css":  config.LoaderCSS,
+			},
+		},
+	})
+}
+
+func TestLoaderHTMLSharedScriptWithSplitting(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/a.html":    `<script type="module" src="./a.js"></script><script type="module" src="./shared.js"></script>`,
+			"/b.html":    `<script type="module" src="./b.js"></script><script type="module" src="./shared.js"></script>`,
+			"/a.js":      `import { util } from "./util.js"; util("a")`,
+			"/b.js":      `import { util } from "./util.js"; util("b")`,
+			"/shared.js": `console.log("shared")`,
+			"/util.js":   `export function util(x) { console.log(x) }`,
+		},
+		entryPaths: []string{"/a.html", "/b.html"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			CodeSplitting: true,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputDir:  "/out",
+			ExtensionToLoader: map[string]config.Loader{
+				".html": config.LoaderHTML,
+				".js":   config.LoaderJS,
+			},
+		},
+	})
+}
+
+func TestLoaderHTMLErrors(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/index.html": `<script type="module" src="./style.css"></script>
+<link rel="stylesheet" href="./entry.js">
+<img src="./entry.js">
+<img src="./other.html">
+`,
+			"/entry.js":   `import "./other.html"`,
+			"/style.css":  `body { color: red }`,
+			"/other.html": ``,
+		},
+		entryPaths: []string{"/index.html", "/entry.js"},
+		options: config.Options{
+			Mode:         config.ModeBundle,
+			AbsOutputDir: "/out",
+			ExtensionToLoader: map[string]config.Loader{
+				".html": config.LoaderHTML,
+				".js":   config.LoaderJS,
+				".css":  config.LoaderCSS,
+			},
+		},
+		expectedScanLog: `entry.js: ERROR: Cannot import "other.html"
+NOTE: The file "other.html" was loaded with the "html" loader, and HTML files can only be used as entry points.
+index.html: ERROR: Cannot use "style.css" here
+NOTE: A "<script>" tag can only be used to reference a JavaScript file, and "style.css" was loaded with the "css" loader.
+index.html: ERROR: Cannot use "entry.js" here
+NOTE: A "<link rel="stylesheet">" tag can only be used to reference a CSS file, and "entry.js" was loaded with the "js" loader.
+index.html: ERROR: Cannot use "entry.js" here
+NOTE: You can't reference the file "entry.js" from HTML because it was loaded with the "js" loader, which doesn't provide a URL to embed in the resulting HTML.
+index.html: ERROR: Cannot use "other.html" here
+NOTE: You can't reference the file "other.html" from HTML because it was loaded with the "html" loader, which doesn't provide a URL to embed in the resulting HTML.
+`,
+	})
+}
+
+func TestLoaderHTMLWithoutBundle(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/index.html": `<script type="module" src="./main.js"></script>`,
+		},
+		entryPaths: []string{"/index.html"},
+		options: config.Options{
+			AbsOutputDir: "/out",
+			ExtensionToLoader: map[string]config.Loader{
+				".html": config.LoaderHTML,
+			},
+		},
+		expectedScanLog: `ERROR: Cannot use the "html" loader without bundling: index.html
+`,
+	})
+}
+
+func TestLoaderOnLoadSourceMap(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import './app.svelte'
+				import './style.scss'
+			`,
+			"/app.svelte": `<script>console.log("app")</script>`,
+			"/style.scss": `$color: red; a { color: $color }`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			SourceMap:     config.SourceMapExternalWithoutComment,
+			AbsOutputFile: "/out.js",
+			Plugins: []config.Plugin{{
+				Name: "plugin",
+				OnLoad: []config.OnLoad{
+					{
+						// The explicit source map should take precedence over the comment
+						Filter: regexp.MustCompile(`\.svelte$`),
+						Callback: func(args config.OnLoadArgs) config.OnLoadResult {
+							contents := "\n\nconsole.log(\"app\")\n//# sourceMappingURL=data:application/json,invalid\n"
+							return config.OnLoadResult{
+								Contents:  &contents,
+								Loader:    config.LoaderJS,
+								SourceMap: `{"version":3,"sources":["app.svelte"],"mappings":";;AAAQ"}`,
+							}
+						},
+					},
+					{
+						Filter: regexp.MustCompile(`\.scss$`),
+						Callback: func(args config.OnLoadArgs) config.OnLoadResult {
+							contents := "\na {\n  color: red;\n}\n"
+							return config.OnLoadResult{
+								Contents:  &contents,
+								Loader:    config.LoaderCSS,
+								SourceMap: `{"version":3,"sources":["style.scss"],"mappings":";AAAa;EAAI"}`,
+							}
+						},
+					},
+				},
+			}},
+		},
+	})
+}
+
+func TestLoaderOnLoadSourceMapInvalid(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				import './app.svelte'
+			`,
+			"/app.svelte": `<script>console.log("app")</script>`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			SourceMap:     config.SourceMapExternalWithoutComment,
+			AbsOutputFile: "/out.js",
+			Plugins: []config.Plugin{{
+				Name: "plugin",
+				OnLoad: []config.OnLoad{
+					{
+						Filter: regexp.MustCompile(`\.svelte$`),
+						Callback: func(args config.OnLoadArgs) config.OnLoadResult {
+							contents := "console.log(\"app\")\n"
+							return config.OnLoadResult{
+								Contents:  &contents,
+								Loader:    config.LoaderJS,
+								SourceMap: `{"version":3,"sources":["app.svelte"],"mappings":"!"}`,
+							}
+						},
+					},
+				},
+			}},
+		},
+		expectedScanLog: `app.svelte#sourceMappingURL: WARNING: Bad "mappings" data in source map at character 0: Missing generated column
+NOTE: This source map came from the plugin "plugin" for the file "app.svelte"
+`,
+	})
+}
+
+func TestLoaderFileNewURL(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/entry.js": `
+				const logo = new URL('./images/logo.png', import.meta.url)
+				const data = new URL('../data.txt', import.meta.url)
+				const copy = new URL('./font.woff2', import.meta.url)
+				const remote = new URL('https://example.com/logo.png', import.meta.url)
+				const dynamic = new URL(name, import.meta.url)
+				const shadowed = URL => new URL('./images/logo.png', import.meta.url)
+				console.log(logo, data, copy, remote, dynamic, shadowed)
+			`,
+			"/src/images/logo.png": "png",
+			"/data.txt":            "txt",
+			"/src/font.woff2":      "woff2",
+		},
+		entryPaths: []string{"/src/entry.js"},
+		options: config.Options{
+			Mode:         config.ModeBundle,
+			OutputFormat: config.FormatESModule,
+			AbsOutputDir: "/out",
+			ExtensionToLoader: map[string]config.Loader{
+				".js":    config.LoaderJS,
+				".png":   config.LoaderFile,
+				".txt":   config.LoaderDataURL,
+				".woff2": config.LoaderCopy,
+			},
+			NeedsMetafile: true,
+		},
+	})
+}
+
+func TestLoaderFileNewURLErrors(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				new Worker(new URL('./logo.png', import.meta.url))
+			`,
+			"/logo.png": "",
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:         config.ModeBundle,
+			OutputFormat: config.FormatESModule,
+			AbsOutputDir: "/out",
+			ExtensionToLoader: map[string]config.Loader{
+				".js":  config.LoaderJS,
+				".png": config.LoaderFile,
+			},
+		},
+		expectedScanLog: `entry.js: ERROR: Cannot use "logo.png" as a worker
+NOTE: Workers must be JavaScript files, and "logo.png" was loaded with the "file" loader.
+`,
+	})
+}
+
+func TestLoaderFileNewURLIgnored(t *testing.T) {
+	loader_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				console.log(
+					new URL('./code.js', import.meta.url),
+					new URL('./style.css', import.meta.url),
+					new URL('./missing.png', import.meta.url),
+					new URL('./logo.svg', import.meta.url),
+					new Worker(new URL('./missing-worker.js', import.meta.url)),
+				)
+			`,
+			"/code.js":   "",
+			"/style.css": "",
+			"/logo.svg":  "",
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:         config.ModeBundle,
+			OutputFormat: config.FormatESModule,
+			AbsOutputDir: "/out",
+			ExtensionToLoader: map[string]config.Loader{
+				".js":  config.LoaderJS,
+				".css": config.LoaderCSS,
+			},
+		},
+		debugLogs: true,
+		expectedScanLog: `entry.js: WARNING: The path "./code.js" was left unchanged because it refers to a JavaScript file
+NOTE: You can't use "new URL()" to reference the file "code.js" because it was loaded with the "js" loader, which doesn't provide a URL to embed in the resulting JavaScript. Use "new Worker(new URL(...))" instead if this file is meant to be run as a worker.
+entry.js: WARNING: The path "./style.css" was left unchanged because it refers to a CSS file
+NOTE: You can't use "new URL()" to reference a CSS file, and "style.css" is a CSS file (it was loaded with the "css" loader).
+entry.js: DEBUG: The path "./missing.png" was left unchanged because it could not be resolved
+entry.js: DEBUG: The path "./logo.svg" was left unchanged because no loader is configured for ".svg" files
+entry.js: DEBUG: The path "./missing-worker.js" was left unchanged because it could not be resolved
+`,
+	})
+}
@@ -903,17 +903,16 @@ func TestLowerAsyncES5(t *testing.T) {
 				import './fn-expr'
 				import './arrow-1'
 				import './arrow-2'
-				import './export-def-1'
-				import './export-def-2'
-				import './obj-method'
+				import foo from './export-def-1'
+				import bar from './export-def-2'
+				foo(bar)
 			`,
-			"/fn-stmt.js":      `async function foo() {}`,
-			"/fn-expr.js":      `(async function() {})`,
-			"/arrow-1.js":      `(async () => {})`,
-			"/arrow-2.js":      `(async x => {})`,
-			"/export-def-1.js": `export default async function foo() {}`,
-			"/export-def-2.js": `export default async function() {}`,
-			"/obj-method.js":   `({async foo() {}})`,
+			"/fn-stmt.js":      `async function foo() { await 1 } foo()`,
+			"/fn-expr.js":      `(async function() { await this })()`,
+			"/arrow-1.js":      `(async () => { await this })()`,
+			"/arrow-2.js":      `(async x => await x)()`,
+			"/export-def-1.js": `export default async function foo(x) { return await x }`,
+			"/export-def-2.js": `export default async function() { await arguments[0] }`,
 		},
 		entryPaths: []string{"/entry.js"},
 		options: config.Options{
@@ -921,17 +920,65 @@ func TestLowerAsyncES5(t *testing.T) {
 			UnsupportedJSFeatures: es(5),
 			AbsOutputFile:         "/out.js",
 		},
-		expectedScanLog: `arrow-1.js: ERROR: Transforming async functions to the configured target environment is not supported yet
-arrow-2.js: ERROR: Transforming async functions to the configured target environment is not supported yet
-export-def-1.js: ERROR: Transforming async functions to the configured target environment is not supported yet
-export-def-2.js: ERROR: Transforming async functions to the configured target environment is not supported yet
-fn-expr.js: ERROR: Transforming async functions to the configured target environment is not supported yet
-fn-stmt.js: ERROR: Transforming async functions to the configured target environment is not supported yet
-obj-method.js: ERROR: Transforming async functions to the configured target environment is not supported yet
+	})
+}
+
+func TestLowerAsyncMethodES5(t *testing.T) {
+	lower_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `({async foo() {}})`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:                  config.ModeBundle,
+			UnsupportedJSFeatures: es(5),
+			AbsOutputFile:         "/out.js",
+		},
+		expectedScanLog: `entry.js: ERROR: Transforming object literal extensions to the configured target environment is not supported yet
 `,
 	})
 }
 
+func TestLowerGeneratorES5(t *testing.T) {
+	lower_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/entry.js": `
+				function* range(n) {
+					for (var i = 0; i < n; i++) yield i
+				}
+				function* shadow() {
+					var x = yield
+					{
+						var fn = function () { return arguments }
+						yield [x, fn]
+					}
+				}
+				async function fetchAll(urls) {
+					var results = []
+					for (var i = 0; i < urls.length; i++) {
+						try {
+							results.push(await fetch(urls[i]))
+						} catch (e) {
+							results.push(null)
+						}
+					}
+					return results
+				}
+				async function* lines(stream) {
+					for await (var chunk of stream) yield* chunk.split('\n')
+				}
+				console.log(range, shadow, fetchAll, lines)
+			`,
+		},
+		entryPaths: []string{"/entry.js"},
+		options: config.Options{
+			Mode:                  config.ModeBundle,
+			UnsupportedJSFeatures: es(5),
+			AbsOutputFile:         "/out.js",
+		},
+	})
+}
+
 func TestLowerAsyncSuperES2017NoBundle(t *testing.T) {
 	lower_suite.expectBundled(t, bundled{
 		files: map[string]string{
@@ -597,3 +597,314 @@ func TestEdgeCaseIssue2793WithoutSplitting(t *testing.T) {
 		},
 	})
 }
+
+func TestSplittingSystemFormat(t *testing.T) {
+	splitting_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/a.js": `
+				import {count, inc} from "./shared.js"
+				export {count}
+				inc()
+				console.log(count)
+			`,
+			"/b.js": `
+				import {count} from "./shared.js"
+				await import('./a.js')
+				console.log(count)
+			`,
+			"/shared.js": `
+				export let count = 0
+				export function inc() { count++ }
+			`,
+		},
+		entryPaths: []string{"/a.js", "/b.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			CodeSplitting: true,
+			OutputFormat:  config.FormatSystem,
+			AbsOutputDir:  "/out",
+		},
+	})
+}
+
+func TestSplittingManualChunks(t *testing.T) {
+	splitting_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/a.js": `
+				import React from "react"
+				import {render} from "react-dom"
+				import {util} from "./util.js"
+				render(React.createElement("a"), util)
+			`,
+			"/src/b.js": `
+				import React from "react"
+				import {util} from "./util.js"
+				console.log(React, util)
+			`,
+			"/src/util.js": `export let util = 123`,
+			"/node_modules/react/index.js": `
+				import {assign} from "object-assign"
+				export default { createElement: assign }
+			`,
+			"/node_modules/react-dom/index.js":     `export function render(x, y) { console.log(x, y) }`,
+			"/node_modules/object-assign/index.js": `export let assign = Object.assign`,
+		},
+		entryPaths: []string{"/src/a.js", "/src/b.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			CodeSplitting: true,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputDir:  "/out",
+			NeedsMetafile: true,
+			ManualChunks: []config.ManualChunk{
+				{Name: "vendor", Patterns: []config.WildcardPattern{{Prefix: "/node_modules/react"}}},
+			},
+		},
+	})
+}
+
+func TestSplittingManualChunksPackageNames(t *testing.T) {
+	splitting_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/a.js": `
+				import {ui} from "ui-kit"
+				import {icon} from "@icons/core"
+				console.log(ui, icon)
+			`,
+			"/src/b.js": `
+				import {ui} from "ui-kit"
+				import {react} from "./react/index.js"
+				console.log(ui, react)
+			`,
+			"/src/react/index.js": `export let react = "not a package"`,
+			"/node_modules/ui-kit/index.js": `
+				import React from "react"
+				export let ui = React
+			`,
+			"/node_modules/ui-kit/node_modules/react/index.js": `export default { version: "nested" }`,
+			"/node_modules/@icons/core/index.js":               `export let icon = "icon"`,
+		},
+		entryPaths: []string{"/src/a.js", "/src/b.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			CodeSplitting: true,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputDir:  "/out",
+			ManualChunks: []config.ManualChunk{
+				{Name: "icons", PackagePatterns: []config.WildcardPattern{{Prefix: "@icons/"}}},
+				{Name: "react", Packages: map[string]bool{"react": true}},
+			},
+		},
+	})
+}
+
+func TestSplittingManualChunksExactPathAndChunkNames(t *testing.T) {
+	splitting_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/src/a.js": `
+				import {x} from "./lib/x.js"
+				import {y} from "./y.js"
+				console.log(x, y)
+			`,
+			"/src/b.js": `
+				import {y} from "./y.js"
+				import("./lib/z.js").then(console.log)
+			`,
+			"/src/lib/x.js": `export let x = 1`,
+			"/src/lib/z.js": `export let z = 3`,
+			"/src/y.js":     `export let y = 2`,
+		},
+		entryPaths: []string{"/src/a.js", "/src/b.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			CodeSplitting: true,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputDir:  "/out",
+			ChunkPathTemplate: []config.PathTemplate{
+				{Data: "./chunks/", Placeholder: config.NamePlaceholder},
+				{Data: "-", Placeholder: config.HashPlaceholder},
+			},
+			ManualChunks: []config.ManualChunk{
+				{Name: "lib", Exact: map[string]bool{"/src/lib": true}},
+				{Name: "shared", Exact: map[string]bool{"/src/y.js": true}},
+			},
+		},
+	})
+}
+
+func TestSplittingMinChunkSize(t *testing.T) {
+	splitting_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/a.js": `
+				import {ab} from "./ab.js"
+				import {abc} from "./abc.js"
+				console.log(ab, abc)
+			`,
+			"/b.js": `
+				import {ab} from "./ab.js"
+				import {bc} from "./bc.js"
+				import {abc} from "./abc.js"
+				console.log(ab, bc, abc)
+			`,
+			"/c.js": `
+				import {bc} from "./bc.js"
+				import {abc} from "./abc.js"
+				console.log(bc, abc)
+			`,
+			"/ab.js":  `export const ab = "ab"`,
+			"/bc.js":  `export const bc = "bc"`,
+			"/abc.js": `export function abc() { return "abc" }`,
+		},
+		entryPaths: []string{"/a.js", "/b.js", "/c.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			CodeSplitting: true,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputDir:  "/out",
+			NeedsMetafile: true,
+			MinChunkSize:  100,
+		},
+	})
+}
+
+// This is the same as the test above but without a minimum chunk size, which
+// shows the output files and their sizes before small chunks are merged
+func TestSplittingMinChunkSizeDisabled(t *testing.T) {
+	splitting_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/a.js": `
+				import {ab} from "./ab.js"
+				import {abc} from "./abc.js"
+				console.log(ab, abc)
+			`,
+			"/b.js": `
+				import {ab} from "./ab.js"
+				import {bc} from "./bc.js"
+				import {abc} from "./abc.js"
+				console.log(ab, bc, abc)
+			`,
+			"/c.js": `
+				import {bc} from "./bc.js"
+				import {abc} from "./abc.js"
+				console.log(bc, abc)
+			`,
+			"/ab.js":  `export const ab = "ab"`,
+			"/bc.js":  `export const bc = "bc"`,
+			"/abc.js": `export function abc() { return "abc" }`,
+		},
+		entryPaths: []string{"/a.js", "/b.js", "/c.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			CodeSplitting: true,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputDir:  "/out",
+			NeedsMetafile: true,
+		},
+	})
+}
+
+func TestSplittingMinChunkSizeMergeIntoSharedChunk(t *testing.T) {
+	splitting_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/a.js": `
+				import {ab} from "./ab.js"
+				import {abc} from "./abc.js"
+				console.log(ab, abc)
+			`,
+			"/b.js": `
+				import {ab} from "./ab.js"
+				import {bc} from "./bc.js"
+				import {abc} from "./abc.js"
+				console.log(ab, bc, abc)
+			`,
+			"/c.js": `
+				import {bc} from "./bc.js"
+				import {abc} from "./abc.js"
+				console.log(bc, abc)
+			`,
+			"/ab.js": `export const ab = "ab"`,
+			"/bc.js": `export const bc = "bc"`,
+			"/abc.js": `
+				export function abc() {
+					return ["this function is large enough", "to stay in its own chunk"].join(" ")
+				}
+			`,
+		},
+		entryPaths: []string{"/a.js", "/b.js", "/c.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			CodeSplitting: true,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputDir:  "/out",
+			NeedsMetafile: true,
+			MinChunkSize:  100,
+		},
+	})
+}
+
+func TestSplittingMinChunkSizeImportedBySharedChunk(t *testing.T) {
+	splitting_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/a.js": `
+				import {ab} from "./ab.js"
+				console.log(ab)
+			`,
+			"/b.js": `
+				import {ab} from "./ab.js"
+				console.log(ab)
+			`,
+			"/c.js": `
+				import {abc} from "./abc.js"
+				console.log(abc)
+			`,
+			"/ab.js": `
+				import {abc} from "./abc.js"
+				console.log("this chunk has side effects and is large enough to stay")
+				export const ab = abc + "ab"
+			`,
+			"/abc.js": `export const abc = "abc"`,
+		},
+		entryPaths: []string{"/a.js", "/b.js", "/c.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			CodeSplitting: true,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputDir:  "/out",
+			MinChunkSize:  100,
+		},
+	})
+}
+
+func TestSplittingMinChunkSizeSideEffects(t *testing.T) {
+	splitting_suite.expectBundled(t, bundled{
+		files: map[string]string{
+			"/a.js": `
+				import {ab} from "./ab.js"
+				import {abc} from "./abc.js"
+				console.log(ab, abc)
+			`,
+			"/b.js": `
+				import {ab} from "./ab.js"
+				import {abc} from "./abc.js"
+				console.log(ab, abc)
+			`,
+			"/c.js": `
+				import {abc} from "./abc.js"
+				console.log(abc)
+			`,
+			"/ab.js": `
+				console.log("side effect")
+				export const ab = "ab"
+			`,
+			"/abc.js": `export const abc = "abc"`,
+		},
+		entryPaths: []string{"/a.js", "/b.js", "/c.js"},
+		options: config.Options{
+			Mode:          config.ModeBundle,
+			CodeSplitting: true,
+			OutputFormat:  config.FormatESModule,
+			AbsOutputDir:  "/out",
+			MinChunkSize:  100,
+		},
+	})
+}
@@ -107,10 +107,33 @@ func (s *suite) expectBundled(t *testing.T, args bundled) {
 		}
 		args.options.ExternalSettings.PostResolve.Exact = replace
 
+		manualChunks := make([]config.ManualChunk, 0, len(args.options.ManualChunks))
+		for _, manualChunk := range args.options.ManualChunks {
+			exact := make(map[string]bool)
+			for k, v := range manualChunk.Exact {
+				exact[unix2win(k)] = v
+			}
+			patterns := make([]config.WildcardPattern, 0, len(manualChunk.Patterns))
+			for _, pattern := range manualChunk.Patterns {
+				patterns = append(patterns, config.WildcardPattern{Prefix: unix2win(pattern.Prefix), Suffix: unix2win(pattern.Suffix)})
+			}
+			manualChunks = append(manualChunks, config.ManualChunk{
+				Name:            manualChunk.Name,
+				Exact:           exact,
+				Patterns:        patterns,
+				Packages:        manualChunk.Packages,
+				PackagePatterns: manualChunk.PackagePatterns,
+			})
+		}
+		args.options.ManualChunks = manualChunks
+
 		args.options.AbsOutputFile = unix2win(args.options.AbsOutputFile)
 		args.options.AbsOutputBase = unix2win(args.options.AbsOutputBase)
 		args.options.AbsOutputDir = unix2win(args.options.AbsOutputDir)
 		args.options.TSConfigPath = unix2win(args.options.TSConfigPath)
+		args.options.ImportMapPath = unix2win(args.options.ImportMapPath)
+		args.options.URLVendorDir = unix2win(args.options.URLVendorDir)
+		args.options.HotUpdatePath = unix2win(args.options.HotUpdatePath)
 	}
 
 	s.__expectBundledImpl(t, args, fs.MockWindows)
@@ -5,6 +5,7 @@ import (
 
 	"github.com/ije/esbuild-internal/css_ast"
 	"github.com/ije/esbuild-internal/css_parser"
+	"github.com/ije/esbuild-internal/helpers"
 	"github.com/ije/esbuild-internal/js_ast"
 	"github.com/ije/esbuild-internal/js_parser"
 	"github.com/ije/esbuild-internal/logger"
@@ -82,6 +83,7 @@ func (c *CSSCache) Parse(log logger.Log, source logger.Source, options css_parse
 
 type JSONCache struct {
 	entries map[logger.Path]*jsonCacheEntry
+	disk    *DiskCache
 	mutex   sync.Mutex
 }
 
@@ -110,35 +112,70 @@ func (c *JSONCache) Parse(log logger.Log, source logger.Source, options js_parse
 	}
 
 	// Cache miss
-	tempLog := logger.NewDeferLog(logger.DeferLogAll, log.Overrides)
-	expr, ok := js_parser.ParseJSON(tempLog, source, options)
-	msgs := tempLog.Done()
-	for _, msg := range msgs {
+	entry = c.parseWithDiskCache(source, options, log.Overrides)
+	for _, msg := range entry.msgs {
 		log.AddMsg(msg)
 	}
 
-	// Create the cache entry
-	entry = &jsonCacheEntry{
-		source:  source,
-		options: options,
-		expr:    expr,
-		ok:      ok,
-		msgs:    msgs,
-	}
-
 	// Save for next time
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	c.entries[source.KeyPath] = entry
-	return expr, ok
+	return entry.expr, entry.ok
+}
+
+func (c *JSONCache) parseWithDiskCache(source logger.Source, options js_parser.JSONOptions, overrides map[logger.MsgID]logger.LogLevel) *jsonCacheEntry {
+	entry := &jsonCacheEntry{
+		source:  source,
+		options: options,
+	}
+
+	// Check the disk cache
+	var key string
+	if c.disk != nil {
+		w := helpers.BinaryWriter{}
+		w.WriteUvarint(uint64(options.UnsupportedJSFeatures))
+		w.WriteUint8(uint8(options.Flavor))
+		w.WriteString(options.ErrorSuffix)
+		w.WriteBool(options.IsForDefine)
+		key = c.disk.key("json", source, w.Bytes(), overrides)
+		if r := c.disk.read("json", key, source); r != nil {
+			entry.msgs = decodeMsgs(r)
+			entry.ok = r.ReadBool()
+			entry.expr = js_ast.DecodeExpr(r, source.Index)
+			if !r.Failed() && r.IsAtEnd() {
+				return entry
+			}
+		}
+	}
+
+	// Parse the file
+	tempLog := logger.NewDeferLog(logger.DeferLogAll, overrides)
+	entry.expr, entry.ok = js_parser.ParseJSON(tempLog, source, options)
+	entry.msgs = tempLog.Done()
+
+	// Save to the disk cache
+	if c.disk != nil {
+		w := helpers.BinaryWriter{}
+		c.disk.writeHeader(&w, source)
+		if encodeMsgs(&w, entry.msgs) {
+			w.WriteBool(entry.ok)
+			if js_ast.EncodeExpr(&w, entry.expr, source.Index) {
+				c.disk.write("json", key, w.Bytes())
+			}
+		}
+	}
+	return entry
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 // JS
 
 type JSCache struct {
-	entries map[logger.Path]*jsCacheEntry
-	mutex   sync.Mutex
+	entries            map[logger.Path]*jsCacheEntry
+	disk               *DiskCache
+	definesFingerprint js_parser.DefinesFingerprintCache
+	mutex              sync.Mutex
 }
 
 type jsCacheEntry struct {
@@ -166,25 +203,56 @@ func (c *JSCache) Parse(log logger.Log, source logger.Source, options js_parser.
 	}
 
 	// Cache miss
-	tempLog := logger.NewDeferLog(logger.DeferLogAll, log.Overrides)
-	ast, ok := js_parser.Parse(tempLog, source, options)
-	msgs := tempLog.Done()
-	for _, msg := range msgs {
+	entry = c.parseWithDiskCache(source, options, log.Overrides)
+	for _, msg := range entry.msgs {
 		log.AddMsg(msg)
 	}
 
-	// Create the cache entry
-	entry = &jsCacheEntry{
-		source:  source,
-		options: options,
-		ast:     ast,
-		ok:      ok,
-		msgs:    msgs,
-	}
-
 	// Save for next time
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	c.entries[source.KeyPath] = entry
-	return ast, ok
+	return entry.ast, entry.ok
+}
+
+func (c *JSCache) parseWithDiskCache(source logger.Source, options js_parser.Options, overrides map[logger.MsgID]logger.LogLevel) *jsCacheEntry {
+	entry := &jsCacheEntry{
+		source:  source,
+		options: options,
+	}
+
+	// Check the disk cache
+	var key string
+	if c.disk != nil {
+		w := helpers.BinaryWriter{}
+		if options.Fingerprint(&w, &c.definesFingerprint) {
+			key = c.disk.key("js", source, w.Bytes(), overrides)
+			if r := c.disk.read("js", key, source); r != nil {
+				entry.msgs = decodeMsgs(r)
+				entry.ok = r.ReadBool()
+				entry.ast = js_ast.DecodeAST(r, source.Index)
+				if !r.Failed() && r.IsAtEnd() {
+					return entry
+				}
+			}
+		}
+	}
+
+	// Parse the file
+	tempLog := logger.NewDeferLog(logger.DeferLogAll, overrides)
+	entry.ast, entry.ok = js_parser.Parse(tempLog, source, options)
+	entry.msgs = tempLog.Done()
+
+	// Save to the disk cache
+	if key != "" {
+		w := helpers.BinaryWriter{}
+		c.disk.writeHeader(&w, source)
+		if encodeMsgs(&w, entry.msgs) {
+			w.WriteBool(entry.ok)
+			if js_ast.EncodeAST(&w, entry.ast, source.Index) {
+				c.disk.write("js", key, w.Bytes())
+			}
+		}
+	}
+	return entry
 }
@@ -0,0 +1,208 @@
+package cache
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ije/esbuild-internal/helpers"
+	"github.com/ije/esbuild-internal/logger"
+	"github.com/ije/esbuild-internal/xxhash"
+)
+
+// This cache saves parse results to a directory on disk so that they can be
+// reused by later builds, including builds in other processes. The in-memory
+// caches only live as long as a single build context, which means a fresh
+// process (such as a CI run) would otherwise have to re-parse everything.
+//
+// Entries are keyed by a hash of the esbuild version, the cache format version,
+// the file path, the file contents, a fingerprint of the parser options, and
+// any log overrides. An
+// entry is never updated in place. If anything that affects the parse result
+// changes, the key changes too and the old entry is just never read again.
+//
+// This cache is best-effort. Failing to read or write an entry (because the
+// directory is read-only or the entry is corrupt, for example) is not an error
+// and just means the file is parsed again.
+//
+// Only the results of the JavaScript and JSON parsers are currently stored on
+// disk since CSS syntax trees don't have a binary encoding yet.
+
+// This must be incremented whenever the format of an entry changes, which
+// includes the binary encoding of syntax trees in "js_ast" and the results of
+// the JavaScript and JSON parsers. Entries are otherwise only invalidated when
+// the esbuild version changes, so a build from a newer commit of the same
+// version would reuse entries with stale syntax trees.
+const diskCacheFormatVersion = 1
+
+type DiskCache struct {
+	dir     string
+	version string
+}
+
+// This should be called before the build starts. The version should be the
+// version of esbuild, since the encoded data isn't compatible across versions.
+func (c *CacheSet) EnableDiskCache(dir string, version string) {
+	disk := &DiskCache{dir: dir, version: version}
+	c.JSONCache.disk = disk
+	c.JSCache.disk = disk
+}
+
+func (c *DiskCache) key(kind string, source logger.Source, fingerprint []byte, overrides map[logger.MsgID]logger.LogLevel) string {
+	w := helpers.BinaryWriter{}
+	w.WriteString(c.version)
+	w.WriteUvarint(diskCacheFormatVersion)
+	w.WriteString(kind)
+	w.WriteString(source.KeyPath.Text)
+	w.WriteString(source.KeyPath.Namespace)
+	w.WriteString(source.KeyPath.IgnoredSuffix)
+	w.WriteString(source.PrettyPaths.Abs)
+	w.WriteString(source.PrettyPaths.Rel)
+	w.WriteString(source.IdentifierName)
+	w.WriteString(string(fingerprint))
+
+	// Log overrides change the kinds of the stored messages
+	ids := make([]int, 0, len(overrides))
+	for id := range overrides {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		w.WriteUint8(uint8(id))
+		w.WriteUint8(uint8(overrides[logger.MsgID(id)]))
+	}
+	hash := xxhash.New()
+	hash.Write(w.Bytes())
+	hash.Write([]byte(source.Contents))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (c *DiskCache) entryPath(kind string, key string) string {
+	return filepath.Join(c.dir, kind, key[:2], key[2:])
+}
+
+// The returned reader is positioned after the entry header. This returns nil
+// if there is no usable entry.
+func (c *DiskCache) read(kind string, key string, source logger.Source) *helpers.BinaryReader {
+	bytes, err := ioutil.ReadFile(c.entryPath(kind, key))
+	if err != nil {
+		return nil
+	}
+
+	// Guard against hash collisions
+	r := helpers.NewBinaryReader(bytes)
+	if r.ReadString() != c.version || r.ReadUvarint() != diskCacheFormatVersion ||
+		r.ReadUvarint() != uint64(len(source.Contents)) || r.Failed() {
+		return nil
+	}
+	return r
+}
+
+func (c *DiskCache) writeHeader(w *helpers.BinaryWriter, source logger.Source) {
+	w.WriteString(c.version)
+	w.WriteUvarint(diskCacheFormatVersion)
+	w.WriteUvarint(uint64(len(source.Contents)))
+}
+
+func (c *DiskCache) write(kind string, key string, bytes []byte) {
+	path := c.entryPath(kind, key)
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+
+	// Write to a temporary file first and then rename it into place so that
+	// other processes using the same cache directory never see partial entries
+	file, err := ioutil.TempFile(dir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, err = file.Write(bytes)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+}
+
+// Log messages are stored with each entry because they must be reported again
+// when the entry is reused. Messages with plugin-specific data can't be stored.
+func encodeMsgs(w *helpers.BinaryWriter, msgs []logger.Msg) bool {
+	w.WriteUvarint(uint64(len(msgs)))
+	for _, msg := range msgs {
+		w.WriteUint8(uint8(msg.Kind))
+		w.WriteUint8(msg.ID)
+		w.WriteString(msg.PluginName)
+		if !encodeMsgData(w, msg.Data) {
+			return false
+		}
+		w.WriteUvarint(uint64(len(msg.Notes)))
+		for _, note := range msg.Notes {
+			if !encodeMsgData(w, note) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func encodeMsgData(w *helpers.BinaryWriter, data logger.MsgData) bool {
+	if data.UserDetail != nil {
+		return false
+	}
+	w.WriteString(data.Text)
+	w.WriteBool(data.DisableMaximumWidth)
+	w.WriteBool(data.Location != nil)
+	if loc := data.Location; loc != nil {
+		w.WriteString(loc.File.Abs)
+		w.WriteString(loc.File.Rel)
+		w.WriteString(loc.Namespace)
+		w.WriteString(loc.LineText)
+		w.WriteString(loc.Suggestion)
+		w.WriteUvarint(uint64(loc.Line))
+		w.WriteUvarint(uint64(loc.Column))
+		w.WriteUvarint(uint64(loc.Length))
+	}
+	return true
+}
+
+func decodeMsgs(r *helpers.BinaryReader) []logger.Msg {
+	msgs := make([]logger.Msg, r.ReadLength())
+	for i := range msgs {
+		msg := &msgs[i]
+		msg.Kind = logger.MsgKind(r.ReadUint8())
+		msg.ID = r.ReadUint8()
+		msg.PluginName = r.ReadString()
+		msg.Data = decodeMsgData(r)
+		if n := r.ReadLength(); n > 0 {
+			msg.Notes = make([]logger.MsgData, n)
+			for j := range msg.Notes {
+				msg.Notes[j] = decodeMsgData(r)
+			}
+		}
+	}
+	return msgs
+}
+
+func decodeMsgData(r *helpers.BinaryReader) (data logger.MsgData) {
+	data.Text = r.ReadString()
+	data.DisableMaximumWidth = r.ReadBool()
+	if r.ReadBool() {
+		data.Location = &logger.MsgLocation{}
+		data.Location.File.Abs = r.ReadString()
+		data.Location.File.Rel = r.ReadString()
+		data.Location.Namespace = r.ReadString()
+		data.Location.LineText = r.ReadString()
+		data.Location.Suggestion = r.ReadString()
+		data.Location.Line = int(r.ReadUvarint())
+		data.Location.Column = int(r.ReadUvarint())
+		data.Location.Length = int(r.ReadUvarint())
+	}
+	return
+}
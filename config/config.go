@@ -10,6 +10,7 @@ import (
 	"github.com/ije/esbuild-internal/ast"
 	"github.com/ije/esbuild-internal/compat"
 	"github.com/ije/esbuild-internal/css_ast"
+	"github.com/ije/esbuild-internal/helpers"
 	"github.com/ije/esbuild-internal/js_ast"
 	"github.com/ije/esbuild-internal/logger"
 )
@@ -181,6 +182,15 @@ func (lc LegalComments) HasExternalFile() bool {
 	return lc == LegalCommentsLinkedWithComment || lc == LegalCommentsExternalWithoutComment
 }
 
+type Integrity uint8
+
+const (
+	IntegrityNone Integrity = iota
+	IntegritySHA256
+	IntegritySHA384
+	IntegritySHA512
+)
+
 type Loader uint8
 
 const (
@@ -194,6 +204,7 @@ const (
 	LoaderEmpty
 	LoaderFile
 	LoaderGlobalCSS
+	LoaderHTML
 	LoaderJS
 	LoaderJSON
 	LoaderWithTypeJSON // Has a "with { type: 'json' }" attribute
@@ -216,6 +227,7 @@ var LoaderToString = []string{
 	"empty",
 	"file",
 	"global-css",
+	"html",
 	"js",
 	"json",
 	"json",
@@ -317,10 +329,55 @@ const (
 	//   export {...};
 	//
 	FormatESModule
+
+	// The UMD format looks like this:
+	//
+	//   (function(root, factory) {
+	//     if (typeof define === "function" && define.amd) define(["require", ...], factory);
+	//     else if (typeof module === "object" && module.exports) module.exports = factory(require);
+	//     else root.globalName = factory(function(id) { ... });
+	//   })(typeof self !== "undefined" ? self : this, function(require) {
+	//     ... bundled code ...
+	//     return exports;
+	//   });
+	//
+	// External imports become "require()" calls inside the factory function.
+	// The "require" function passed to the factory is AMD's local "require"
+	// (with the external imports listed as dependencies), CommonJS's "require",
+	// or a function that looks up global variables.
+	FormatUMD
+
+	// The SystemJS format looks like this:
+	//
+	//   System.register(["dep", "./chunk.js"], function(_export, _context) {
+	//     "use strict";
+	//     var foo, bar;
+	//     return {
+	//       setters: [function(_m) {
+	//         foo = _m.foo;
+	//       }, function(_m) {
+	//         bar = _m.bar;
+	//       }],
+	//       execute: function() {
+	//         ... bundled code ...
+	//         _export({...});
+	//       }
+	//     };
+	//   });
+	//
+	// This is generated from the same AST as the ES module format. The printer
+	// turns import and export statements into setters and "_export" calls.
+	FormatSystem
 )
 
 func (f Format) KeepESMImportExportSyntax() bool {
-	return f == FormatPreserve || f == FormatESModule
+	return f == FormatPreserve || f == FormatESModule || f == FormatSystem
+}
+
+// Returns true for formats that are able to express ES module semantics
+// such as live bindings, top-level await, and imports between chunks
+func (f Format) IsESMCompatible() bool {
+	return f == FormatESModule || f == FormatSystem
 }
 
 func (f Format) String() string {
@@ -331,6 +388,10 @@ func (f Format) String() string {
 		return "cjs"
 	case FormatESModule:
 		return "esm"
+	case FormatUMD:
+		return "umd"
+	case FormatSystem:
+		return "system"
 	}
 	return ""
 }
@@ -338,6 +399,7 @@ func (f Format) String() string {
 type StdinInfo struct {
 	Contents      string
 	SourceFile    string
+	SourceMap     string
 	AbsResolveDir string
 	Loader        Loader
 }
@@ -347,6 +409,25 @@ type WildcardPattern struct {
 	Suffix string
 }
 
+// Modules whose paths match one of these patterns are grouped into a chunk
+// with this name instead of the chunk derived from their entry points.
+// Modules inside a "node_modules" directory can also be matched by the name
+// of their package.
+type ManualChunk struct {
+	Name            string
+	Exact           map[string]bool
+	Patterns        []WildcardPattern
+	Packages        map[string]bool
+	PackagePatterns []WildcardPattern
+}
+
+type Budget struct {
+	Pattern              []helpers.GlobPart
+	MaxBytes             int
+	MaxGzipBytes         int
+	IncludeStaticImports bool
+}
+
 type ExternalMatchers struct {
 	Exact    map[string]bool
 	Patterns []WildcardPattern
@@ -442,8 +523,12 @@ type Options struct {
 	OutputExtensionJS  string
 	OutputExtensionCSS string
 	GlobalName         []string
+	UMDGlobals         map[string][]string
 	TSConfigPath       string
 	TSConfigRaw        string
+	ImportMapPath      string
+	ImportMapRaw       string
+	URLVendorDir       string
 	ExtensionToLoader  map[string]Loader
 
 	PublicPath      string
@@ -459,6 +544,27 @@ type Options struct {
 	EntryPathTemplate []PathTemplate
 	ChunkPathTemplate []PathTemplate
 	AssetPathTemplate []PathTemplate
+	ManualChunks      []ManualChunk
+
+	// Shared chunks with an estimated size below this many bytes are merged
+	// into other shared chunks when doing so has no observable side effects
+	MinChunkSize int
+
+	// If set, generated files referenced by HTML files are given an "integrity"
+	// attribute containing a hash of their contents using this algorithm
+	Integrity Integrity
+
+	// Output files are checked against these after linking
+	Budgets []Budget
+
+	// If set, precompressed copies of output files are generated with these
+	// formats and are written next to the original files
+	CompressGzip   bool
+	CompressBrotli bool
+
+	// If true, a Vite-style "manifest.json" file is generated in the output
+	// directory that maps entry points to their final output paths
+	NeedsManifest bool
 
 	Plugins    []Plugin
 	SourceRoot string
@@ -495,9 +601,22 @@ type Options struct {
 	// If true, make sure to generate a single file that can be written to stdout
 	WriteToStdout bool
 
+	// If true, every module registers its exports with a hot module replacement
+	// runtime and "import.meta.hot" is available to each module
+	HotModuleReplacement bool
+
+	// This is set when building the code for a hot module replacement update.
+	// Only the module with this path is bundled. All other modules are left
+	// external and are taken from the modules that are already running.
+	HotUpdatePath string
+
 	// Large bundles minify the metafile JSON to reduce its size
 	MetafileFormat MetafileFormat
 
+	// If true, each input file in the metafile's JavaScript outputs records why
+	// it was included (i.e. why it wasn't removed by tree shaking)
+	MetafileExplain bool
+
 	OmitRuntimeForTests    bool
 	OmitJSXRuntimeForTests bool
 	ASCIIOnly              bool
@@ -694,7 +813,7 @@ func SubstituteTemplate(template []PathTemplate, placeholders PathPlaceholders)
 }
 
 func ShouldCallRuntimeRequire(mode Mode, outputFormat Format) bool {
-	return mode == ModeBundle && outputFormat != FormatCommonJS
+	return mode == ModeBundle && outputFormat != FormatCommonJS && outputFormat != FormatUMD
 }
 
 type InjectedDefine struct {
@@ -778,6 +897,9 @@ type Plugin struct {
 	OnStart   []OnStart
 	OnResolve []OnResolve
 	OnLoad    []OnLoad
+	OnParse   []OnParse
+
+	OnRenderChunk []OnRenderChunk
 }
 
 type OnStart struct {
@@ -804,6 +926,7 @@ type OnResolveArgs struct {
 	Importer   logger.Path
 	Kind       ast.ImportKind
 	With       logger.ImportAttributes
+	CancelFlag *CancelFlag
 }
 
 type OnResolveResult struct {
@@ -831,12 +954,14 @@ type OnLoad struct {
 type OnLoadArgs struct {
 	PluginData interface{}
 	Path       logger.Path
+	CancelFlag *CancelFlag
 }
 
 type OnLoadResult struct {
 	PluginName string
 
 	Contents      *string
+	SourceMap     string
 	AbsResolveDir string
 	PluginData    interface{}
 
@@ -849,6 +974,69 @@ type OnLoadResult struct {
 	Loader Loader
 }
 
+type OnParse struct {
+	Filter    *regexp.Regexp
+	Callback  func(OnParseArgs) OnParseResult
+	Name      string
+	Namespace string
+}
+
+// Exactly one of "JSAST" and "CSSAST" is non-nil. Callbacks may mutate the
+// syntax tree in place. This happens before import records are resolved.
+type OnParseArgs struct {
+	PluginData interface{}
+	JSAST      *js_ast.AST
+	CSSAST     *css_ast.AST
+	Path       logger.Path
+	Loader     Loader
+}
+
+type OnParseResult struct {
+	PluginName string
+
+	Msgs        []logger.Msg
+	ThrownError error
+
+	AbsWatchFiles []string
+	AbsWatchDirs  []string
+}
+
+type OnRenderChunk struct {
+	Callback func(OnRenderChunkArgs) OnRenderChunkResult
+	Name     string
+}
+
+type OnRenderChunkArgs struct {
+	// This is nil if the chunk isn't for an entry point
+	EntryPoint *logger.Path
+
+	AbsPath string
+	Code    []byte
+
+	// This is nil if source maps are disabled
+	SourceMap []byte
+
+	Imports []OnRenderChunkImport
+	Exports []string
+}
+
+type OnRenderChunkImport struct {
+	AbsPath string
+	Kind    ast.ImportKind
+}
+
+type OnRenderChunkResult struct {
+	PluginName string
+
+	Msgs        []logger.Msg
+	ThrownError error
+
+	// The code is left unchanged if this is nil. The optional source map maps
+	// from the returned code to the code that was passed in.
+	Code      []byte
+	SourceMap []byte
+}
+
 func PrettyPrintTargetEnvironment(originalTargetEnv string, unsupportedJSFeatureOverridesMask compat.JSFeature) (where string) {
 	where = "the configured target environment"
 	overrides := ""
@@ -0,0 +1,56 @@
+package css_ast
+
+// This walks the rules of a stylesheet in source order, including rules nested
+// inside other rules. Each callback is optional. The callbacks are passed
+// pointers into the tree so that rules can be mutated or replaced in place.
+// Returning false from "EnterRule" skips the nested rules of that rule (the
+// matching "ExitRule" callback is still called).
+type Visitor struct {
+	EnterRule func(rule *Rule) bool
+	ExitRule  func(rule *Rule)
+}
+
+func (v *Visitor) VisitAST(tree *AST) {
+	v.VisitRules(tree.Rules)
+}
+
+func (v *Visitor) VisitRules(rules []Rule) {
+	for i := range rules {
+		v.VisitRule(&rules[i])
+	}
+}
+
+func (v *Visitor) VisitRule(rule *Rule) {
+	if rule.Data == nil {
+		return
+	}
+	if v.EnterRule == nil || v.EnterRule(rule) {
+		switch r := rule.Data.(type) {
+		case *RAtKeyframes:
+			for i := range r.Blocks {
+				v.VisitRules(r.Blocks[i].Rules)
+			}
+
+		case *RKnownAt:
+			v.VisitRules(r.Rules)
+
+		case *RSelector:
+			v.VisitRules(r.Rules)
+
+		case *RQualified:
+			v.VisitRules(r.Rules)
+
+		case *RAtLayer:
+			v.VisitRules(r.Rules)
+
+		case *RAtMedia:
+			v.VisitRules(r.Rules)
+
+		case *RAtScope:
+			v.VisitRules(r.Rules)
+		}
+	}
+	if v.ExitRule != nil {
+		v.ExitRule(rule)
+	}
+}
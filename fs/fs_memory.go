@@ -0,0 +1,415 @@
+package fs
+
+// This is a file system that reads files from memory. It's used to bundle
+// files that don't exist on disk, such as unsaved buffers in an editor or
+// generated sources on a server. The in-memory files are layered on top of
+// another file system. In overlay mode, files in memory take precedence over
+// files in the other file system but everything else is still visible. In
+// the other mode, only files in memory are visible and the other file system
+// is only used for path manipulation.
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// This is the set of in-memory files. It's shared between builds and can be
+// updated at any time. Each build sees a snapshot of the files as they were
+// when the build started. Paths must be absolute.
+type MemoryFiles struct {
+	mutex sync.Mutex
+	files map[string]string
+}
+
+func NewMemoryFiles(files map[string]string) *MemoryFiles {
+	clone := make(map[string]string, len(files))
+	for path, contents := range files {
+		clone[path] = contents
+	}
+	return &MemoryFiles{files: clone}
+}
+
+func (m *MemoryFiles) Get(path string) (string, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	contents, ok := m.files[path]
+	return contents, ok
+}
+
+func (m *MemoryFiles) Set(path string, contents string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.files[path] = contents
+}
+
+func (m *MemoryFiles) Remove(path string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.files, path)
+}
+
+func (m *MemoryFiles) snapshot() map[string]string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	clone := make(map[string]string, len(m.files))
+	for path, contents := range m.files {
+		clone[path] = contents
+	}
+	return clone
+}
+
+type memoryFile struct {
+	contents  string
+	isPresent bool
+}
+
+type memoryFS struct {
+	inner   FS
+	files   *MemoryFiles
+	overlay bool
+
+	// These are computed from a snapshot of the in-memory files
+	snapshot map[string]string
+	dirs     map[string]map[string]EntryKind
+
+	entriesMutex sync.Mutex
+	entries      map[string]entriesOrErr
+
+	// This stores data that will end up being returned by "WatchData()"
+	watchMutex sync.Mutex
+	watchFiles map[string]memoryFile
+	watchDirs  map[string]memoryDirWatch
+}
+
+type memoryDirWatch struct {
+	// This is nil if the directory couldn't be read
+	accessedEntries *accessedEntries
+
+	// This is used to forward accesses of entries that aren't in memory to the
+	// inner file system, which is responsible for watching those entries
+	innerEntries DirEntries
+}
+
+func MemoryFS(inner FS, files *MemoryFiles, overlay bool) FS {
+	snapshot := files.snapshot()
+	return &memoryFS{
+		inner:      inner,
+		files:      files,
+		overlay:    overlay,
+		snapshot:   snapshot,
+		dirs:       memoryDirs(inner, snapshot),
+		entries:    make(map[string]entriesOrErr),
+		watchFiles: make(map[string]memoryFile),
+		watchDirs:  make(map[string]memoryDirWatch),
+	}
+}
+
+// This returns a map of each directory to the kinds of its children
+func memoryDirs(fs FS, files map[string]string) map[string]map[string]EntryKind {
+	dirs := make(map[string]map[string]EntryKind)
+	for path := range files {
+		kind := FileEntry
+		for {
+			dir := fs.Dir(path)
+			if dir == path {
+				break
+			}
+			children := dirs[dir]
+			if children == nil {
+				children = make(map[string]EntryKind)
+				dirs[dir] = children
+			}
+			children[fs.Base(path)] = kind
+			kind = DirEntry
+			path = dir
+		}
+	}
+	return dirs
+}
+
+func (fs *memoryFS) ReadDirectory(dir string) (entries DirEntries, canonicalError error, originalError error) {
+	fs.entriesMutex.Lock()
+	defer fs.entriesMutex.Unlock()
+	if cached, ok := fs.entries[dir]; ok {
+		return cached.entries, cached.canonicalError, cached.originalError
+	}
+
+	children, isInMemory := fs.dirs[dir]
+	var innerEntries DirEntries
+	if fs.overlay {
+		innerEntries, canonicalError, originalError = fs.inner.ReadDirectory(dir)
+	} else {
+		canonicalError, originalError = syscall.ENOENT, syscall.ENOENT
+	}
+
+	if isInMemory || canonicalError == nil {
+		// Merge the in-memory entries on top of the entries from the inner file
+		// system. The entries are tracked separately for watch mode because the
+		// inner file system doesn't know about the in-memory entries.
+		entries = DirEntries{
+			dir:             dir,
+			data:            make(map[string]*Entry, len(innerEntries.data)+len(children)),
+			accessedEntries: &accessedEntries{wasPresent: make(map[string]bool)},
+		}
+		for key, entry := range innerEntries.data {
+			entries.data[key] = entry
+		}
+		for base, kind := range children {
+			entries.data[strings.ToLower(base)] = &Entry{dir: dir, base: base, kind: kind}
+		}
+		canonicalError, originalError = nil, nil
+	}
+
+	fs.watchMutex.Lock()
+	fs.watchDirs[dir] = memoryDirWatch{
+		accessedEntries: entries.accessedEntries,
+		innerEntries:    innerEntries,
+	}
+	fs.watchMutex.Unlock()
+
+	fs.entries[dir] = entriesOrErr{
+		entries:        entries,
+		canonicalError: canonicalError,
+		originalError:  originalError,
+	}
+	return entries, canonicalError, originalError
+}
+
+func (fs *memoryFS) ReadFile(path string) (contents string, canonicalError error, originalError error) {
+	contents, ok := fs.snapshot[path]
+
+	fs.watchMutex.Lock()
+	fs.watchFiles[path] = memoryFile{contents: contents, isPresent: ok}
+	fs.watchMutex.Unlock()
+
+	if ok {
+		return contents, nil, nil
+	}
+	if fs.overlay {
+		return fs.inner.ReadFile(path)
+	}
+	return "", syscall.ENOENT, syscall.ENOENT
+}
+
+func (fs *memoryFS) OpenFile(path string) (result OpenedFile, canonicalError error, originalError error) {
+	if contents, ok := fs.snapshot[path]; ok {
+		return &InMemoryOpenedFile{Contents: []byte(contents)}, nil, nil
+	}
+	if fs.overlay {
+		return fs.inner.OpenFile(path)
+	}
+	return nil, syscall.ENOENT, syscall.ENOENT
+}
+
+func (fs *memoryFS) ModKey(path string) (ModKey, error) {
+	// In-memory files have no modification time
+	if _, ok := fs.snapshot[path]; ok {
+		return ModKey{}, modKeyUnusable
+	}
+	if fs.overlay {
+		return fs.inner.ModKey(path)
+	}
+	return ModKey{}, syscall.ENOENT
+}
+
+func (fs *memoryFS) IsAbs(path string) bool {
+	return fs.inner.IsAbs(path)
+}
+
+func (fs *memoryFS) Abs(path string) (string, bool) {
+	return fs.inner.Abs(path)
+}
+
+func (fs *memoryFS) Dir(path string) string {
+	return fs.inner.Dir(path)
+}
+
+func (fs *memoryFS) Base(path string) string {
+	return fs.inner.Base(path)
+}
+
+func (fs *memoryFS) Ext(path string) string {
+	return fs.inner.Ext(path)
+}
+
+func (fs *memoryFS) Join(parts ...string) string {
+	return fs.inner.Join(parts...)
+}
+
+func (fs *memoryFS) Cwd() string {
+	return fs.inner.Cwd()
+}
+
+func (fs *memoryFS) Rel(base string, target string) (string, bool) {
+	return fs.inner.Rel(base, target)
+}
+
+func (fs *memoryFS) EvalSymlinks(path string) (string, bool) {
+	// In-memory files and directories can't be symlinks
+	if _, ok := fs.snapshot[path]; ok {
+		return path, true
+	}
+	if _, ok := fs.dirs[path]; ok {
+		return path, true
+	}
+	if fs.overlay {
+		return fs.inner.EvalSymlinks(path)
+	}
+	return "", false
+}
+
+func (fs *memoryFS) kind(dir string, base string) (symlink string, kind EntryKind) {
+	if children, ok := fs.dirs[dir]; ok {
+		if kind, ok := children[base]; ok {
+			return "", kind
+		}
+	}
+	if fs.overlay {
+		return fs.inner.kind(dir, base)
+	}
+	return "", 0
+}
+
+func (fs *memoryFS) WatchData() WatchData {
+	paths := make(map[string]func() string)
+	if fs.overlay {
+		paths = fs.inner.WatchData().Paths
+		if paths == nil {
+			paths = make(map[string]func() string)
+		}
+	}
+
+	// Combine our check with any check from the inner file system
+	add := func(path string, isDirty func() string) {
+		if innerIsDirty := paths[path]; innerIsDirty != nil {
+			paths[path] = func() string {
+				if dirtyPath := innerIsDirty(); dirtyPath != "" {
+					return dirtyPath
+				}
+				return isDirty()
+			}
+		} else {
+			paths[path] = isDirty
+		}
+	}
+
+	fs.watchMutex.Lock()
+	defer fs.watchMutex.Unlock()
+
+	for path, file := range fs.watchFiles {
+		// Each closure below needs its own copy of these loop variables
+		path := path
+		file := file
+
+		add(path, func() string {
+			if contents, ok := fs.files.Get(path); ok != file.isPresent || contents != file.contents {
+				return path
+			}
+			return ""
+		})
+	}
+
+	for dir, data := range fs.watchDirs {
+		// Each closure below needs its own copy of these loop variables
+		dir := dir
+		data := data
+		oldChildren := fs.dirs[dir]
+
+		if data.accessedEntries == nil {
+			add(dir, func() string {
+				if _, ok := fs.currentChildren(dir); ok {
+					return dir
+				}
+				return ""
+			})
+			continue
+		}
+
+		// Forward accesses of entries that aren't in memory to the inner file
+		// system so it can check whether those entries have changed on disk
+		data.accessedEntries.mutex.Lock()
+		if inner := data.innerEntries.accessedEntries; inner != nil {
+			inner.mutex.Lock()
+			for key := range data.accessedEntries.wasPresent {
+				_, ok := data.innerEntries.data[key]
+				inner.wasPresent[key] = ok
+			}
+			if data.accessedEntries.allEntries != nil {
+				keys := make([]string, 0, len(data.innerEntries.data))
+				for _, entry := range data.innerEntries.data {
+					keys = append(keys, entry.base)
+				}
+				sort.Strings(keys)
+				inner.allEntries = keys
+			}
+			inner.mutex.Unlock()
+		}
+		data.accessedEntries.mutex.Unlock()
+
+		// Check whether the in-memory entries that were accessed have changed
+		add(dir, func() string {
+			newChildren, _ := fs.currentChildren(dir)
+			data.accessedEntries.mutex.Lock()
+			defer data.accessedEntries.mutex.Unlock()
+			if data.accessedEntries.allEntries != nil {
+				if len(newChildren) != len(oldChildren) {
+					return dir
+				}
+				for base, kind := range oldChildren {
+					if newChildren[base] != kind {
+						return fs.Join(dir, base)
+					}
+				}
+			} else {
+				for key := range data.accessedEntries.wasPresent {
+					if memoryHasKey(oldChildren, key) != memoryHasKey(newChildren, key) {
+						return fs.Join(dir, key)
+					}
+				}
+			}
+			return ""
+		})
+	}
+
+	return WatchData{
+		Paths: paths,
+	}
+}
+
+// This returns the current children of an in-memory directory, which may be
+// different than the children in the snapshot for this build
+func (fs *memoryFS) currentChildren(dir string) (map[string]EntryKind, bool) {
+	fs.files.mutex.Lock()
+	defer fs.files.mutex.Unlock()
+	var children map[string]EntryKind
+	for path := range fs.files.files {
+		kind := FileEntry
+		for {
+			parent := fs.Dir(path)
+			if parent == path {
+				break
+			}
+			if parent == dir {
+				if children == nil {
+					children = make(map[string]EntryKind)
+				}
+				children[fs.Base(path)] = kind
+				break
+			}
+			kind = DirEntry
+			path = parent
+		}
+	}
+	return children, children != nil
+}
+
+func memoryHasKey(children map[string]EntryKind, key string) bool {
+	for base := range children {
+		if strings.ToLower(base) == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package fs
+
+import (
+	"testing"
+)
+
+func TestMemoryFSOverlay(t *testing.T) {
+	inner := MockFS(map[string]string{
+		"/src/index.js": "// disk index.js",
+		"/src/util.js":  "// disk util.js",
+	}, MockUnix, "/")
+	files := NewMemoryFiles(map[string]string{
+		"/src/util.js":     "// memory util.js",
+		"/src/gen/data.js": "// memory data.js",
+	})
+	fs := MemoryFS(inner, files, true)
+
+	// Files on disk are still visible
+	index, err, _ := fs.ReadFile("/src/index.js")
+	if err != nil || index != "// disk index.js" {
+		t.Fatalf("Incorrect contents for /src/index.js: %q", index)
+	}
+
+	// Files in memory take precedence
+	util, err, _ := fs.ReadFile("/src/util.js")
+	if err != nil || util != "// memory util.js" {
+		t.Fatalf("Incorrect contents for /src/util.js: %q", util)
+	}
+
+	// Directories contain entries from both
+	src, err, _ := fs.ReadDirectory("/src")
+	if err != nil {
+		t.Fatal("Expected to find /src")
+	}
+	indexEntry, _ := src.Get("index.js")
+	utilEntry, _ := src.Get("util.js")
+	genEntry, _ := src.Get("gen")
+	if len(src.data) != 3 ||
+		indexEntry == nil || indexEntry.Kind(fs) != FileEntry ||
+		utilEntry == nil || utilEntry.Kind(fs) != FileEntry ||
+		genEntry == nil || genEntry.Kind(fs) != DirEntry {
+		t.Fatalf("Incorrect contents for /src: %v", src)
+	}
+
+	// Directories that only exist in memory are visible
+	gen, err, _ := fs.ReadDirectory("/src/gen")
+	if err != nil {
+		t.Fatal("Expected to find /src/gen")
+	}
+	if dataEntry, _ := gen.Get("data.js"); len(gen.data) != 1 || dataEntry == nil || dataEntry.Kind(fs) != FileEntry {
+		t.Fatalf("Incorrect contents for /src/gen: %v", gen)
+	}
+
+	// Changes after the file system was created aren't visible
+	files.Set("/src/index.js", "// memory index.js")
+	index, err, _ = fs.ReadFile("/src/index.js")
+	if err != nil || index != "// disk index.js" {
+		t.Fatalf("Incorrect contents for /src/index.js: %q", index)
+	}
+}
+
+func TestMemoryFSOnly(t *testing.T) {
+	inner := MockFS(map[string]string{
+		"/src/index.js": "// disk index.js",
+	}, MockUnix, "/")
+	files := NewMemoryFiles(map[string]string{
+		"/src/util.js": "// memory util.js",
+	})
+	fs := MemoryFS(inner, files, false)
+
+	// Files on disk aren't visible
+	if _, err, _ := fs.ReadFile("/src/index.js"); err == nil {
+		t.Fatal("Unexpectedly found /src/index.js")
+	}
+	if _, err, _ := fs.ReadDirectory("/missing"); err == nil {
+		t.Fatal("Unexpectedly found /missing")
+	}
+	src, err, _ := fs.ReadDirectory("/src")
+	if err != nil {
+		t.Fatal("Expected to find /src")
+	}
+	if utilEntry, _ := src.Get("util.js"); len(src.data) != 1 || utilEntry == nil {
+		t.Fatalf("Incorrect contents for /src: %v", src)
+	}
+}
+
+func TestMemoryFSWatchData(t *testing.T) {
+	files := NewMemoryFiles(map[string]string{
+		"/src/index.js": "// index.js",
+	})
+	fs := MemoryFS(MockFS(nil, MockUnix, "/"), files, false)
+	fs.ReadFile("/src/index.js")
+	fs.ReadFile("/src/missing.js")
+	src, _, _ := fs.ReadDirectory("/src")
+	src.Get("other.js")
+	paths := fs.WatchData().Paths
+
+	isDirty := func(path string) string {
+		t.Helper()
+		check := paths[path]
+		if check == nil {
+			t.Fatalf("Expected %q to be watched", path)
+		}
+		return check()
+	}
+
+	if dirty := isDirty("/src/index.js") + isDirty("/src/missing.js") + isDirty("/src"); dirty != "" {
+		t.Fatalf("Unexpectedly dirty: %q", dirty)
+	}
+
+	// Unrelated files don't cause a rebuild
+	files.Set("/lib/unrelated.js", "")
+	if dirty := isDirty("/src"); dirty != "" {
+		t.Fatalf("Unexpectedly dirty: %q", dirty)
+	}
+
+	files.Set("/src/index.js", "// index.js changed")
+	if dirty := isDirty("/src/index.js"); dirty != "/src/index.js" {
+		t.Fatalf("Expected /src/index.js to be dirty, got %q", dirty)
+	}
+
+	files.Set("/src/missing.js", "")
+	if dirty := isDirty("/src/missing.js"); dirty != "/src/missing.js" {
+		t.Fatalf("Expected /src/missing.js to be dirty, got %q", dirty)
+	}
+
+	files.Set("/src/other.js", "")
+	if dirty := isDirty("/src"); dirty != "/src/other.js" {
+		t.Fatalf("Expected /src/other.js to be dirty, got %q", dirty)
+	}
+}
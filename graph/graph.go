@@ -200,6 +200,16 @@ func CloneLinkerGraph(
 					}
 				}
 
+				// Files referenced by "new Worker(new URL(...))" are always entry points
+				// since workers are loaded separately from the code that creates them
+				for _, record := range repr.AST.ImportRecords {
+					if record.SourceIndex.IsValid() && record.Kind == ast.ImportNewWorker {
+						dynamicImportEntryPointsMutex.Lock()
+						dynamicImportEntryPoints = append(dynamicImportEntryPoints, record.SourceIndex.GetIndex())
+						dynamicImportEntryPointsMutex.Unlock()
+					}
+				}
+
 				// Clone the import map
 				namedImports := make(map[ast.Ref]js_ast.NamedImport, len(repr.AST.NamedImports))
 				for k, v := range repr.AST.NamedImports {
@@ -245,6 +255,28 @@ func CloneLinkerGraph(
 
 				// Clone the import records
 				repr.AST.ImportRecords = append([]ast.ImportRecord{}, repr.AST.ImportRecords...)
+
+			case *HTMLRepr:
+				// Clone the representation
+				{
+					clone := *repr
+					repr = &clone
+					file.InputFile.Repr = repr
+				}
+
+				// Clone the import records
+				repr.AST.ImportRecords = append([]ast.ImportRecord{}, repr.AST.ImportRecords...)
+
+				// Scripts and stylesheets referenced by HTML files are always additional
+				// entry points, even when code splitting is disabled, since the HTML file
+				// needs to reference their output files by path
+				for _, record := range repr.AST.ImportRecords {
+					if record.SourceIndex.IsValid() && record.Kind == ast.ImportEntryPoint {
+						dynamicImportEntryPointsMutex.Lock()
+						dynamicImportEntryPoints = append(dynamicImportEntryPoints, record.SourceIndex.GetIndex())
+						dynamicImportEntryPointsMutex.Unlock()
+					}
+				}
 			}
 
 			// All files start off as far as possible from an entry point
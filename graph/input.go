@@ -11,6 +11,7 @@ import (
 	"github.com/ije/esbuild-internal/ast"
 	"github.com/ije/esbuild-internal/config"
 	"github.com/ije/esbuild-internal/css_ast"
+	"github.com/ije/esbuild-internal/html_ast"
 	"github.com/ije/esbuild-internal/js_ast"
 	"github.com/ije/esbuild-internal/logger"
 	"github.com/ije/esbuild-internal/resolver"
@@ -40,6 +41,11 @@ type OutputFile struct {
 	// fully assembled later.
 	JSONMetadataChunk string
 
+	// If "NeedsManifest" is present, this will be filled out with the entry for
+	// this file in the manifest in JSON format (including the key). Only chunks
+	// have manifest entries.
+	JSONManifestChunk string
+
 	AbsPath      string
 	Contents     []byte
 	IsExecutable bool
@@ -117,6 +123,14 @@ func (repr *CSSRepr) ImportRecords() *[]ast.ImportRecord {
 	return &repr.AST.ImportRecords
 }
 
+type HTMLRepr struct {
+	AST html_ast.AST
+}
+
+func (repr *HTMLRepr) ImportRecords() *[]ast.ImportRecord {
+	return &repr.AST.ImportRecords
+}
+
 type CopyRepr struct {
 	// The URL that replaces the contents of any import record paths for this file
 	URLForCode string
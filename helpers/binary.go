@@ -0,0 +1,205 @@
+package helpers
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// These are used to encode data that is written to disk and read back later,
+// such as entries in the persistent build cache. All integers are written as
+// variable-length integers since most of them are small.
+
+type BinaryWriter struct {
+	bytes []byte
+}
+
+func (w *BinaryWriter) Bytes() []byte {
+	return w.bytes
+}
+
+func (w *BinaryWriter) WriteUint8(value uint8) {
+	w.bytes = append(w.bytes, value)
+}
+
+func (w *BinaryWriter) WriteBool(value bool) {
+	if value {
+		w.bytes = append(w.bytes, 1)
+	} else {
+		w.bytes = append(w.bytes, 0)
+	}
+}
+
+func (w *BinaryWriter) WriteUvarint(value uint64) {
+	var buffer [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buffer[:], value)
+	w.bytes = append(w.bytes, buffer[:n]...)
+}
+
+func (w *BinaryWriter) WriteVarint(value int64) {
+	var buffer [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buffer[:], value)
+	w.bytes = append(w.bytes, buffer[:n]...)
+}
+
+func (w *BinaryWriter) WriteFloat64(value float64) {
+	var buffer [8]byte
+	binary.LittleEndian.PutUint64(buffer[:], math.Float64bits(value))
+	w.bytes = append(w.bytes, buffer[:]...)
+}
+
+func (w *BinaryWriter) WriteString(value string) {
+	w.WriteUvarint(uint64(len(value)))
+	w.bytes = append(w.bytes, value...)
+}
+
+// This distinguishes between a nil slice or map and an empty one, which can
+// have different meanings
+func (w *BinaryWriter) WriteNilableLength(length int, isNil bool) {
+	if isNil {
+		w.WriteUvarint(0)
+	} else {
+		w.WriteUvarint(uint64(length) + 1)
+	}
+}
+
+func (w *BinaryWriter) WriteUint16s(value []uint16) {
+	w.WriteNilableLength(len(value), value == nil)
+	for _, c := range value {
+		w.WriteUvarint(uint64(c))
+	}
+}
+
+// Reading never panics. Malformed data causes the reader to fail, after which
+// every read returns a zero value. Callers should check "Failed()" once at the
+// end instead of after each read.
+type BinaryReader struct {
+	bytes  []byte
+	failed bool
+}
+
+func NewBinaryReader(bytes []byte) *BinaryReader {
+	return &BinaryReader{bytes: bytes}
+}
+
+func (r *BinaryReader) Failed() bool {
+	return r.failed
+}
+
+// Call this after reading a value that is known to be invalid
+func (r *BinaryReader) Fail() {
+	r.failed = true
+	r.bytes = nil
+}
+
+func (r *BinaryReader) IsAtEnd() bool {
+	return len(r.bytes) == 0
+}
+
+func (r *BinaryReader) ReadUint8() uint8 {
+	if len(r.bytes) < 1 {
+		r.Fail()
+		return 0
+	}
+	value := r.bytes[0]
+	r.bytes = r.bytes[1:]
+	return value
+}
+
+func (r *BinaryReader) ReadBool() bool {
+	switch r.ReadUint8() {
+	case 0:
+		return false
+	case 1:
+		return true
+	}
+	r.Fail()
+	return false
+}
+
+func (r *BinaryReader) ReadUvarint() uint64 {
+	value, n := binary.Uvarint(r.bytes)
+	if n <= 0 {
+		r.Fail()
+		return 0
+	}
+	r.bytes = r.bytes[n:]
+	return value
+}
+
+func (r *BinaryReader) ReadVarint() int64 {
+	value, n := binary.Varint(r.bytes)
+	if n <= 0 {
+		r.Fail()
+		return 0
+	}
+	r.bytes = r.bytes[n:]
+	return value
+}
+
+func (r *BinaryReader) ReadFloat64() float64 {
+	if len(r.bytes) < 8 {
+		r.Fail()
+		return 0
+	}
+	value := math.Float64frombits(binary.LittleEndian.Uint64(r.bytes))
+	r.bytes = r.bytes[8:]
+	return value
+}
+
+// Reads a length and checks it against the remaining data, where each element
+// takes up at least one byte. This avoids allocating huge amounts of memory
+// when the data is corrupt.
+func (r *BinaryReader) ReadLength() int {
+	n := r.ReadUvarint()
+	if n > uint64(len(r.bytes)) {
+		r.Fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (r *BinaryReader) ReadNilableLength() (length int, isNil bool) {
+	n := r.ReadUvarint()
+	if n == 0 {
+		return 0, true
+	}
+	if n-1 > uint64(len(r.bytes)) {
+		r.Fail()
+		return 0, true
+	}
+	return int(n - 1), false
+}
+
+func (r *BinaryReader) ReadString() string {
+	n := r.ReadLength()
+	value := string(r.bytes[:n])
+	r.bytes = r.bytes[n:]
+	return value
+}
+
+func (r *BinaryReader) ReadUint16s() []uint16 {
+	n, isNil := r.ReadNilableLength()
+	if isNil {
+		return nil
+	}
+	value := make([]uint16, n)
+	for i := range value {
+		c := r.ReadUvarint()
+		if c > math.MaxUint16 {
+			r.Fail()
+			return nil
+		}
+		value[i] = uint16(c)
+	}
+	return value
+}
+
+// This is for values written using "WriteVarint" that must fit in 32 bits
+func (r *BinaryReader) ReadInt32() int32 {
+	value := r.ReadVarint()
+	if value < math.MinInt32 || value > math.MaxInt32 {
+		r.Fail()
+		return 0
+	}
+	return int32(value)
+}
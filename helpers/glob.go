@@ -56,3 +56,41 @@ func GlobPatternToString(pattern []GlobPart) string {
 	}
 	return sb.String()
 }
+
+// This uses "/" as the only path separator. A "**" path segment matches zero
+// or more path segments, so "**/*.js" matches both "a.js" and "a/b.js".
+func GlobPatternMatches(pattern []GlobPart, text string) bool {
+	part := pattern[0]
+	if !strings.HasPrefix(text, part.Prefix) {
+		return false
+	}
+	text = text[len(part.Prefix):]
+	rest := pattern[1:]
+
+	switch part.Wildcard {
+	case GlobAllExceptSlash:
+		for i := 0; i <= len(text); i++ {
+			if GlobPatternMatches(rest, text[i:]) {
+				return true
+			}
+			if i < len(text) && text[i] == '/' {
+				break
+			}
+		}
+		return false
+
+	case GlobAllIncludingSlash:
+		// Let "**/" match nothing at all instead of requiring a slash
+		if strings.HasPrefix(rest[0].Prefix, "/") && GlobPatternMatches(rest, "/"+text) {
+			return true
+		}
+		for i := 0; i <= len(text); i++ {
+			if GlobPatternMatches(rest, text[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return text == ""
+}
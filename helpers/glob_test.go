@@ -0,0 +1,39 @@
+package helpers_test
+
+import (
+	"testing"
+
+	"github.com/ije/esbuild-internal/helpers"
+)
+
+func TestGlobPatternMatches(t *testing.T) {
+	check := func(pattern string, text string, expected bool) {
+		t.Helper()
+		if helpers.GlobPatternMatches(helpers.ParseGlobPattern(pattern), text) != expected {
+			t.Fatalf("Expected %q matching %q to be %v", pattern, text, expected)
+		}
+	}
+
+	check("entry.js", "entry.js", true)
+	check("entry.js", "entry.jsx", false)
+	check("entry.js", "out/entry.js", false)
+
+	check("*.js", "entry.js", true)
+	check("*.js", ".js", true)
+	check("*.js", "entry.css", false)
+	check("*.js", "out/entry.js", false)
+	check("chunk-*.js", "chunk-ABC.js", true)
+	check("chunk-*.js", "chunk-ABC.js.map", false)
+	check("*/*.js", "out/entry.js", true)
+	check("*/*.js", "entry.js", false)
+
+	check("**/*.js", "entry.js", true)
+	check("**/*.js", "out/entry.js", true)
+	check("**/*.js", "a/b/c/entry.js", true)
+	check("**/*.js", "a/b/c/entry.css", false)
+	check("out/**/*.js", "out/entry.js", true)
+	check("out/**/*.js", "out/a/b/entry.js", true)
+	check("out/**/*.js", "other/entry.js", false)
+	check("out/**", "out/a/b", true)
+	check("**", "a/b/c", true)
+}
@@ -0,0 +1,58 @@
+package html_ast
+
+import (
+	"github.com/ije/esbuild-internal/ast"
+	"github.com/ije/esbuild-internal/logger"
+)
+
+// HTML files are not transformed. The only thing the bundler needs to know
+// about an HTML file is where it references other files so that those
+// references can be bundled and then rewritten to the final output paths.
+// Everything else in the file is copied to the output verbatim.
+//
+// So this AST is just a list of references into the original source text.
+// Each reference has a corresponding import record, and the linker splices
+// the final paths into the source at the recorded ranges.
+
+type AST struct {
+	ImportRecords []ast.ImportRecord
+
+	// These don't overlap, but multiple references may be in the same tag
+	Refs []Ref
+}
+
+type RefKind uint8
+
+const (
+	// A "<script type="module" src="...">" tag. The referenced file becomes an
+	// additional entry point and the reference is replaced by its output path.
+	RefScript RefKind = iota
+
+	// A "<link rel="stylesheet" href="...">" tag. The referenced file becomes an
+	// additional entry point and the reference is replaced by its output path.
+	RefStylesheet
+
+	// Anything else such as "<img src="...">" or "<link rel="icon" href="...">".
+	// The referenced file must use a loader that provides a URL (e.g. "file").
+	RefAsset
+)
+
+type Ref struct {
+	// The URL text in the source, not including any surrounding quotes
+	Range logger.Range
+
+	// The start of the "<" for the tag containing this reference
+	TagStart logger.Loc
+
+	// The location where additional attributes can be inserted into the tag,
+	// which is just after the last attribute
+	TagAttrsEnd logger.Loc
+
+	// The existing "integrity" attribute of the tag (including the preceding
+	// whitespace), if any. This is removed when integrity hashes are generated
+	// since the contents of the referenced file will have changed.
+	IntegrityRange logger.Range
+
+	ImportRecordIndex uint32
+	Kind              RefKind
+}
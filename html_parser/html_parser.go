@@ -0,0 +1,364 @@
+package html_parser
+
+import (
+	"html"
+	"strings"
+
+	"github.com/ije/esbuild-internal/ast"
+	"github.com/ije/esbuild-internal/html_ast"
+	"github.com/ije/esbuild-internal/logger"
+)
+
+// This is not a full HTML parser. It only tokenizes tags well enough to find
+// the attributes that reference other files. Malformed HTML is tolerated since
+// everything that isn't a reference is passed through to the output unchanged.
+
+type parser struct {
+	source logger.Source
+	tree   html_ast.AST
+}
+
+type attribute struct {
+	name string // This is lowercase
+
+	// The value with character references decoded
+	value string
+
+	// The raw value in the source, not including any surrounding quotes
+	valueRange logger.Range
+
+	// The whole attribute including any preceding whitespace
+	fullRange logger.Range
+
+	hasValue bool
+}
+
+type tag struct {
+	name       string // This is lowercase
+	attrs      []attribute
+	start      logger.Loc
+	attrsEnd   logger.Loc
+	isEndTag   bool
+	isComplete bool
+}
+
+func Parse(source logger.Source) html_ast.AST {
+	p := parser{source: source}
+	contents := source.Contents
+	i := 0
+
+	for {
+		lt := strings.IndexByte(contents[i:], '<')
+		if lt == -1 {
+			break
+		}
+		i += lt
+
+		switch {
+		case strings.HasPrefix(contents[i:], "<!--"):
+			// Skip over comments
+			if end := strings.Index(contents[i+4:], "-->"); end != -1 {
+				i += 4 + end + 3
+			} else {
+				i = len(contents)
+			}
+
+		case strings.HasPrefix(contents[i:], "<!"), strings.HasPrefix(contents[i:], "<?"):
+			// Skip over "<!DOCTYPE html>" and similar things
+			if end := strings.IndexByte(contents[i:], '>'); end != -1 {
+				i += end + 1
+			} else {
+				i = len(contents)
+			}
+
+		default:
+			t, next := p.parseTag(i)
+			if t == nil {
+				// This isn't a tag, so just skip over the "<"
+				i++
+				continue
+			}
+			i = next
+			if t.isEndTag || !t.isComplete {
+				continue
+			}
+			p.visitTag(t)
+
+			// The contents of these elements are text, not markup
+			switch t.name {
+			case "script", "style", "textarea", "title":
+				i = skipRawText(contents, i, t.name)
+			}
+		}
+	}
+
+	return p.tree
+}
+
+func isWhitespace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// Returns the index just after the end of the raw text, which is the start of
+// the matching end tag (or the end of the file if there is no end tag)
+func skipRawText(contents string, i int, name string) int {
+	for {
+		lt := strings.Index(contents[i:], "</")
+		if lt == -1 {
+			return len(contents)
+		}
+		i += lt
+		end := i + 2 + len(name)
+		if end <= len(contents) && strings.EqualFold(contents[i+2:end], name) &&
+			(end == len(contents) || isWhitespace(contents[end]) || contents[end] == '>' || contents[end] == '/') {
+			return i
+		}
+		i += 2
+	}
+}
+
+func (p *parser) parseTag(start int) (*tag, int) {
+	contents := p.source.Contents
+	i := start + 1
+	t := &tag{start: logger.Loc{Start: int32(start)}}
+
+	if i < len(contents) && contents[i] == '/' {
+		t.isEndTag = true
+		i++
+	}
+
+	// Tag names must start with an ASCII letter
+	if i >= len(contents) || !isASCIILetter(contents[i]) {
+		return nil, 0
+	}
+	nameStart := i
+	for i < len(contents) && !isWhitespace(contents[i]) && contents[i] != '/' && contents[i] != '>' {
+		i++
+	}
+	t.name = strings.ToLower(contents[nameStart:i])
+	t.attrsEnd = logger.Loc{Start: int32(i)}
+
+	for i < len(contents) {
+		attrStart := i
+
+		// Skip whitespace before the attribute
+		for i < len(contents) && (isWhitespace(contents[i]) || contents[i] == '/') {
+			if contents[i] == '/' && i+1 < len(contents) && contents[i+1] == '>' {
+				break
+			}
+			i++
+		}
+		if i >= len(contents) {
+			break
+		}
+		if c := contents[i]; c == '>' || (c == '/' && i+1 < len(contents) && contents[i+1] == '>') {
+			t.isComplete = true
+			if c == '/' {
+				i++
+			}
+			i++
+			break
+		}
+
+		// Parse the attribute name
+		nameStart := i
+		i++
+		for i < len(contents) && !isWhitespace(contents[i]) && contents[i] != '/' && contents[i] != '>' && contents[i] != '=' {
+			i++
+		}
+		attr := attribute{name: strings.ToLower(contents[nameStart:i])}
+
+		// Parse the optional attribute value
+		j := i
+		for j < len(contents) && isWhitespace(contents[j]) {
+			j++
+		}
+		if j < len(contents) && contents[j] == '=' {
+			j++
+			for j < len(contents) && isWhitespace(contents[j]) {
+				j++
+			}
+			attr.hasValue = true
+			if j < len(contents) && (contents[j] == '"' || contents[j] == '\'') {
+				quote := contents[j]
+				valueStart := j + 1
+				end := strings.IndexByte(contents[valueStart:], quote)
+				if end == -1 {
+					return t, len(contents)
+				}
+				attr.valueRange = logger.Range{Loc: logger.Loc{Start: int32(valueStart)}, Len: int32(end)}
+				i = valueStart + end + 1
+			} else {
+				valueStart := j
+				for j < len(contents) && !isWhitespace(contents[j]) && contents[j] != '>' {
+					j++
+				}
+				attr.valueRange = logger.Range{Loc: logger.Loc{Start: int32(valueStart)}, Len: int32(j - valueStart)}
+				i = j
+			}
+			attr.value = html.UnescapeString(p.source.TextForRange(attr.valueRange))
+		}
+
+		attr.fullRange = logger.Range{Loc: logger.Loc{Start: int32(attrStart)}, Len: int32(i - attrStart)}
+		t.attrs = append(t.attrs, attr)
+		t.attrsEnd = logger.Loc{Start: int32(i)}
+	}
+
+	return t, i
+}
+
+func (t *tag) attr(name string) *attribute {
+	for i := range t.attrs {
+		if attr := &t.attrs[i]; attr.name == name && attr.hasValue {
+			return attr
+		}
+	}
+	return nil
+}
+
+func (p *parser) visitTag(t *tag) {
+	switch t.name {
+	case "script":
+		if typ := t.attr("type"); typ != nil && strings.EqualFold(strings.TrimSpace(typ.value), "module") {
+			if src := t.attr("src"); src != nil {
+				p.addRef(t, src.valueRange, src.value, html_ast.RefScript)
+			}
+		}
+
+	case "link":
+		href := t.attr("href")
+		rel := t.attr("rel")
+		if href == nil || rel == nil {
+			return
+		}
+		for _, value := range strings.Fields(strings.ToLower(rel.value)) {
+			switch value {
+			case "stylesheet":
+				p.addRef(t, href.valueRange, href.value, html_ast.RefStylesheet)
+				return
+
+			case "icon", "apple-touch-icon", "manifest":
+				p.addRef(t, href.valueRange, href.value, html_ast.RefAsset)
+				return
+			}
+		}
+
+	case "img", "source", "audio", "video", "track", "embed", "input":
+		if t.name == "input" {
+			if typ := t.attr("type"); typ == nil || !strings.EqualFold(strings.TrimSpace(typ.value), "image") {
+				return
+			}
+		}
+		if src := t.attr("src"); src != nil {
+			p.addRef(t, src.valueRange, src.value, html_ast.RefAsset)
+		}
+		if t.name == "video" {
+			if poster := t.attr("poster"); poster != nil {
+				p.addRef(t, poster.valueRange, poster.value, html_ast.RefAsset)
+			}
+		}
+		if t.name == "img" || t.name == "source" {
+			if srcset := t.attr("srcset"); srcset != nil {
+				p.visitSrcset(t, srcset)
+			}
+		}
+	}
+}
+
+// Each candidate in a "srcset" attribute is a URL followed by an optional
+// descriptor such as "2x" or "100w", and candidates are separated by commas.
+// Character references are not handled here. A candidate containing one is
+// left alone since its range in the source doesn't match the decoded value.
+func (p *parser) visitSrcset(t *tag, srcset *attribute) {
+	raw := p.source.TextForRange(srcset.valueRange)
+	i := 0
+	for i < len(raw) {
+		for i < len(raw) && (isWhitespace(raw[i]) || raw[i] == ',') {
+			i++
+		}
+		start := i
+		for i < len(raw) && !isWhitespace(raw[i]) {
+			i++
+		}
+		end := i
+		for end > start && raw[end-1] == ',' {
+			end--
+		}
+		if url := raw[start:end]; url != "" && !strings.ContainsRune(url, '&') {
+			r := logger.Range{Loc: logger.Loc{Start: srcset.valueRange.Loc.Start + int32(start)}, Len: int32(end - start)}
+			p.addRef(t, r, url, html_ast.RefAsset)
+		}
+		if end < i {
+			continue
+		}
+
+		// Skip over the descriptor
+		for i < len(raw) && raw[i] != ',' {
+			i++
+		}
+	}
+}
+
+func (p *parser) addRef(t *tag, r logger.Range, url string, kind html_ast.RefKind) {
+	path, ok := importPathForURL(url)
+	if !ok {
+		return
+	}
+
+	importKind := ast.ImportURL
+	if kind != html_ast.RefAsset {
+		importKind = ast.ImportEntryPoint
+	}
+
+	ref := html_ast.Ref{
+		Range:             r,
+		TagStart:          t.start,
+		TagAttrsEnd:       t.attrsEnd,
+		ImportRecordIndex: uint32(len(p.tree.ImportRecords)),
+		Kind:              kind,
+	}
+	if integrity := t.attr("integrity"); integrity != nil && kind != html_ast.RefAsset {
+		ref.IntegrityRange = integrity.fullRange
+	}
+
+	p.tree.ImportRecords = append(p.tree.ImportRecords, ast.ImportRecord{
+		Range: r,
+		Path:  logger.Path{Text: path},
+		Kind:  importKind,
+	})
+	p.tree.Refs = append(p.tree.Refs, ref)
+}
+
+// Only relative URLs are bundled. Absolute URLs (including ones that start
+// with "/", which are relative to wherever the page ends up being served
+// from) and fragment-only URLs are left alone.
+func importPathForURL(url string) (string, bool) {
+	url = strings.TrimSpace(url)
+	if url == "" || url[0] == '#' || url[0] == '/' || url[0] == '?' {
+		return "", false
+	}
+
+	// Ignore URLs with a scheme such as "https:" or "data:"
+	for i := 0; i < len(url); i++ {
+		c := url[i]
+		if c == ':' {
+			if i > 0 {
+				return "", false
+			}
+			break
+		}
+		if !isASCIILetter(c) && (i == 0 || ((c < '0' || c > '9') && c != '+' && c != '-' && c != '.')) {
+			break
+		}
+	}
+
+	// URLs in HTML are always relative, unlike import paths in JavaScript
+	if !strings.HasPrefix(url, "./") && !strings.HasPrefix(url, "../") {
+		url = "./" + url
+	}
+	return url, true
+}
@@ -0,0 +1,88 @@
+package html_parser
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ije/esbuild-internal/html_ast"
+	"github.com/ije/esbuild-internal/test"
+)
+
+func expectRefs(t *testing.T, contents string, expected string) {
+	t.Helper()
+	t.Run(contents, func(t *testing.T) {
+		t.Helper()
+		source := test.SourceForTest(contents)
+		tree := Parse(source)
+		var sb strings.Builder
+		for _, ref := range tree.Refs {
+			var kind string
+			switch ref.Kind {
+			case html_ast.RefScript:
+				kind = "script"
+			case html_ast.RefStylesheet:
+				kind = "stylesheet"
+			case html_ast.RefAsset:
+				kind = "asset"
+			}
+			record := tree.ImportRecords[ref.ImportRecordIndex]
+			sb.WriteString(fmt.Sprintf("%s %s %q", kind, record.Path.Text, source.TextForRange(ref.Range)))
+			if ref.IntegrityRange.Len > 0 {
+				sb.WriteString(fmt.Sprintf(" integrity=%q", source.TextForRange(ref.IntegrityRange)))
+			}
+			sb.WriteString("\n")
+		}
+		test.AssertEqualWithDiff(t, sb.String(), expected)
+	})
+}
+
+func TestScript(t *testing.T) {
+	expectRefs(t, `<script type="module" src="./main.js"></script>`, "script ./main.js \"./main.js\"\n")
+	expectRefs(t, `<script type=module src=main.js></script>`, "script ./main.js \"main.js\"\n")
+	expectRefs(t, `<SCRIPT TYPE="Module" SRC='../main.js'></SCRIPT>`, "script ../main.js \"../main.js\"\n")
+	expectRefs(t, `<script type="module" src="./main.js" integrity="sha384-abc"></script>`,
+		"script ./main.js \"./main.js\" integrity=\" integrity=\\\"sha384-abc\\\"\"\n")
+
+	// Classic scripts and absolute URLs are left alone
+	expectRefs(t, `<script src="./main.js"></script>`, "")
+	expectRefs(t, `<script type="module" src="/main.js"></script>`, "")
+	expectRefs(t, `<script type="module" src="https://example.com/main.js"></script>`, "")
+	expectRefs(t, `<script type="module" src="//example.com/main.js"></script>`, "")
+	expectRefs(t, `<script type="module">import "./main.js"</script>`, "")
+}
+
+func TestLink(t *testing.T) {
+	expectRefs(t, `<link rel="stylesheet" href="./style.css">`, "stylesheet ./style.css \"./style.css\"\n")
+	expectRefs(t, `<link href="style.css" rel="STYLESHEET" />`, "stylesheet ./style.css \"style.css\"\n")
+	expectRefs(t, `<link rel="icon" href="./favicon.png" integrity="x">`, "asset ./favicon.png \"./favicon.png\"\n")
+	expectRefs(t, `<link rel="shortcut icon" href="./favicon.ico">`, "asset ./favicon.ico \"./favicon.ico\"\n")
+	expectRefs(t, `<link rel="manifest" href="./app.webmanifest">`, "asset ./app.webmanifest \"./app.webmanifest\"\n")
+	expectRefs(t, `<link rel="preconnect" href="./x">`, "")
+	expectRefs(t, `<link rel="stylesheet">`, "")
+}
+
+func TestAsset(t *testing.T) {
+	expectRefs(t, `<img src="./a.png">`, "asset ./a.png \"./a.png\"\n")
+	expectRefs(t, `<img src="a&amp;b.png">`, "asset ./a&b.png \"a&amp;b.png\"\n")
+	expectRefs(t, `<img src="data:image/png;base64,">`, "")
+	expectRefs(t, `<img src="#foo">`, "")
+	expectRefs(t, `<img src="">`, "")
+	expectRefs(t, `<video src="./a.mp4" poster="./a.png"></video>`, "asset ./a.mp4 \"./a.mp4\"\nasset ./a.png \"./a.png\"\n")
+	expectRefs(t, `<input type="image" src="./a.png">`, "asset ./a.png \"./a.png\"\n")
+	expectRefs(t, `<input type="text" src="./a.png">`, "")
+	expectRefs(t, `<img srcset="./a.png, ./b.png 2x,./c.png 100w">`,
+		"asset ./a.png \"./a.png\"\nasset ./b.png \"./b.png\"\nasset ./c.png \"./c.png\"\n")
+	expectRefs(t, `<img srcset="a.png 1x, https://example.com/b.png 2x">`, "asset ./a.png \"a.png\"\n")
+}
+
+func TestSkipped(t *testing.T) {
+	expectRefs(t, `<!-- <img src="./a.png"> --><img src="./b.png">`, "asset ./b.png \"./b.png\"\n")
+	expectRefs(t, `<!DOCTYPE html><img src="./a.png">`, "asset ./a.png \"./a.png\"\n")
+	expectRefs(t, `<script>let x = '<img src="./a.png">'</script><img src="./b.png">`, "asset ./b.png \"./b.png\"\n")
+	expectRefs(t, `<style>a::after { content: '<img src="./a.png">' }</style>`, "")
+	expectRefs(t, `<textarea><img src="./a.png"></textarea>`, "")
+	expectRefs(t, `a < b <img src="./a.png">`, "asset ./a.png \"./a.png\"\n")
+	expectRefs(t, `<img src="./a.png"`, "")
+	expectRefs(t, `<img src="./a.png`, "")
+}
@@ -492,6 +492,7 @@ func (*ERequireString) isExpr()        {}
 func (*ERequireResolveString) isExpr() {}
 func (*EImportString) isExpr()         {}
 func (*EImportCall) isExpr()           {}
+func (*EURLString) isExpr()            {}
 
 type EArray struct {
 	Items            []Expr
@@ -931,6 +932,13 @@ type EImportCall struct {
 	Phase         ast.ImportPhase
 }
 
+// This is the string argument in "new URL('./file', import.meta.url)". It's
+// printed as the path of the import record, which may be rewritten to the
+// path of an output file when bundling.
+type EURLString struct {
+	ImportRecordIndex uint32
+}
+
 type Stmt struct {
 	Data S
 	Loc  logger.Loc
@@ -0,0 +1,2594 @@
+package js_ast
+
+import (
+	"sort"
+
+	"github.com/ije/esbuild-internal/ast"
+	"github.com/ije/esbuild-internal/helpers"
+	"github.com/ije/esbuild-internal/logger"
+)
+
+// This is a binary encoding for syntax trees so that they can be written to
+// disk and read back later (by the persistent build cache, for example). It
+// only needs to round-trip within the same version of esbuild, so there is
+// no attempt at backward compatibility. Callers must store the version along
+// with the encoded data and discard the data if the version doesn't match.
+// Any change to the encoding must also increment "diskCacheFormatVersion" in
+// the "cache" package, since the esbuild version alone doesn't change often.
+//
+// Symbol references store the source index separately when it's the index
+// of the file being encoded. That way a syntax tree can be decoded for a
+// different source index than it was parsed with, which is necessary because
+// source indices are assigned in the order that files are discovered and can
+// change from build to build.
+//
+// Maps are written in sorted order so that the same syntax tree always has
+// the same encoding. Nil slices and maps are distinguished from empty ones
+// since some code relies on the difference.
+//
+// Encoding returns false if the syntax tree contains something that can't be
+// encoded. Decoding never panics. Check "Failed()" on the reader afterward
+// and don't use the result if decoding failed.
+
+type encoder struct {
+	w           *helpers.BinaryWriter
+	scopes      map[*Scope]uint32
+	sourceIndex uint32
+	ok          bool
+}
+
+type decoder struct {
+	r           *helpers.BinaryReader
+	scopes      []*Scope
+	parents     []uint32
+	sourceIndex uint32
+}
+
+func EncodeAST(w *helpers.BinaryWriter, tree AST, sourceIndex uint32) bool {
+	e := encoder{w: w, sourceIndex: sourceIndex, scopes: make(map[*Scope]uint32), ok: true}
+	e.ast(&tree)
+	return e.ok
+}
+
+func DecodeAST(r *helpers.BinaryReader, sourceIndex uint32) AST {
+	d := decoder{r: r, sourceIndex: sourceIndex}
+	return d.ast()
+}
+
+func EncodeExpr(w *helpers.BinaryWriter, expr Expr, sourceIndex uint32) bool {
+	e := encoder{w: w, sourceIndex: sourceIndex, ok: true}
+	e.expr(expr)
+	return e.ok
+}
+
+func DecodeExpr(r *helpers.BinaryReader, sourceIndex uint32) Expr {
+	d := decoder{r: r, sourceIndex: sourceIndex}
+	return d.expr()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// AST
+
+func (e *encoder) ast(tree *AST) {
+	w := e.w
+
+	// The module scope must come first so that parts can refer to its scopes
+	w.WriteBool(tree.ModuleScope != nil)
+	if tree.ModuleScope != nil {
+		e.numberScopes(tree.ModuleScope)
+		e.scope(tree.ModuleScope)
+	}
+
+	w.WriteBool(tree.ModuleTypeData.Source != nil)
+	if tree.ModuleTypeData.Source != nil {
+		e.source(tree.ModuleTypeData.Source)
+	}
+	e.rng(tree.ModuleTypeData.Range)
+	w.WriteUint8(uint8(tree.ModuleTypeData.Type))
+
+	w.WriteNilableLength(len(tree.Parts), tree.Parts == nil)
+	for i := range tree.Parts {
+		e.part(&tree.Parts[i])
+	}
+
+	w.WriteNilableLength(len(tree.Symbols), tree.Symbols == nil)
+	for i := range tree.Symbols {
+		e.symbol(&tree.Symbols[i])
+	}
+
+	w.WriteNilableLength(len(tree.ExprComments), tree.ExprComments == nil)
+	locs := make([]logger.Loc, 0, len(tree.ExprComments))
+	for loc := range tree.ExprComments {
+		locs = append(locs, loc)
+	}
+	sort.Slice(locs, func(i int, j int) bool { return locs[i].Start < locs[j].Start })
+	for _, loc := range locs {
+		e.loc(loc)
+		e.strings(tree.ExprComments[loc])
+	}
+
+	w.WriteBool(tree.CharFreq != nil)
+	if tree.CharFreq != nil {
+		for _, count := range tree.CharFreq {
+			w.WriteVarint(int64(count))
+		}
+	}
+
+	e.expr(tree.ManifestForYarnPnP)
+	w.WriteString(tree.Hashbang)
+	e.strings(tree.Directives)
+	w.WriteString(tree.URLForCSS)
+
+	w.WriteNilableLength(len(tree.TopLevelSymbolToPartsFromParser), tree.TopLevelSymbolToPartsFromParser == nil)
+	for _, ref := range sortedRefsForParts(tree.TopLevelSymbolToPartsFromParser) {
+		e.ref(ref)
+		e.uint32s(tree.TopLevelSymbolToPartsFromParser[ref])
+	}
+
+	w.WriteNilableLength(len(tree.TSEnums), tree.TSEnums == nil)
+	for _, ref := range sortedRefsForEnums(tree.TSEnums) {
+		values := tree.TSEnums[ref]
+		e.ref(ref)
+		w.WriteNilableLength(len(values), values == nil)
+		for _, name := range sortedStringKeysForEnum(values) {
+			value := values[name]
+			w.WriteString(name)
+			w.WriteUint16s(value.String)
+			w.WriteFloat64(value.Number)
+		}
+	}
+
+	w.WriteNilableLength(len(tree.ConstValues), tree.ConstValues == nil)
+	for _, ref := range sortedRefsForConstValues(tree.ConstValues) {
+		value := tree.ConstValues[ref]
+		e.ref(ref)
+		w.WriteFloat64(value.Number)
+		w.WriteUint16s(value.String)
+		w.WriteUint8(uint8(value.Kind))
+	}
+
+	w.WriteNilableLength(len(tree.MangledProps), tree.MangledProps == nil)
+	names := make([]string, 0, len(tree.MangledProps))
+	for name := range tree.MangledProps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w.WriteString(name)
+		e.ref(tree.MangledProps[name])
+	}
+
+	w.WriteNilableLength(len(tree.ReservedProps), tree.ReservedProps == nil)
+	names = names[:0]
+	for name := range tree.ReservedProps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w.WriteString(name)
+		w.WriteBool(tree.ReservedProps[name])
+	}
+
+	w.WriteNilableLength(len(tree.ImportRecords), tree.ImportRecords == nil)
+	for i := range tree.ImportRecords {
+		e.importRecord(&tree.ImportRecords[i])
+	}
+
+	w.WriteNilableLength(len(tree.NamedImports), tree.NamedImports == nil)
+	for _, ref := range sortedRefsForNamedImports(tree.NamedImports) {
+		namedImport := tree.NamedImports[ref]
+		e.ref(ref)
+		w.WriteString(namedImport.Alias)
+		e.uint32s(namedImport.LocalPartsWithUses)
+		e.loc(namedImport.AliasLoc)
+		e.ref(namedImport.NamespaceRef)
+		w.WriteUvarint(uint64(namedImport.ImportRecordIndex))
+		w.WriteBool(namedImport.AliasIsStar)
+		w.WriteBool(namedImport.IsExported)
+	}
+
+	w.WriteNilableLength(len(tree.NamedExports), tree.NamedExports == nil)
+	names = names[:0]
+	for name := range tree.NamedExports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		namedExport := tree.NamedExports[name]
+		w.WriteString(name)
+		e.ref(namedExport.Ref)
+		e.loc(namedExport.AliasLoc)
+	}
+
+	e.uint32s(tree.ExportStarImportRecords)
+	w.WriteString(tree.SourceMapComment.Text)
+	e.rng(tree.SourceMapComment.Range)
+	e.rng(tree.ExportKeyword)
+	e.rng(tree.TopLevelAwaitKeyword)
+	e.rng(tree.LiveTopLevelAwaitKeyword)
+	e.ref(tree.ExportsRef)
+	e.ref(tree.ModuleRef)
+	e.ref(tree.WrapperRef)
+	w.WriteVarint(int64(tree.ApproximateLineCount))
+	for _, count := range tree.NestedScopeSlotCounts {
+		w.WriteUvarint(uint64(count))
+	}
+	w.WriteBool(tree.HasLazyExport)
+	w.WriteBool(tree.UsesExportsRef)
+	w.WriteBool(tree.UsesModuleRef)
+	w.WriteUint8(uint8(tree.ExportsKind))
+}
+
+func (d *decoder) ast() (tree AST) {
+	r := d.r
+
+	if r.ReadBool() {
+		tree.ModuleScope = d.scope()
+		for i, parent := range d.parents {
+			if parent > uint32(len(d.scopes)) {
+				r.Fail()
+				return
+			}
+			if parent > 0 {
+				d.scopes[i].Parent = d.scopes[parent-1]
+			}
+		}
+	}
+
+	if r.ReadBool() {
+		tree.ModuleTypeData.Source = d.source()
+	}
+	tree.ModuleTypeData.Range = d.rng()
+	tree.ModuleTypeData.Type = ModuleType(r.ReadUint8())
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		tree.Parts = make([]Part, n)
+		for i := range tree.Parts {
+			d.part(&tree.Parts[i])
+		}
+	}
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		tree.Symbols = make([]ast.Symbol, n)
+		for i := range tree.Symbols {
+			d.symbol(&tree.Symbols[i])
+		}
+	}
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		tree.ExprComments = make(map[logger.Loc][]string, n)
+		for i := 0; i < n; i++ {
+			loc := d.loc()
+			tree.ExprComments[loc] = d.strings()
+		}
+	}
+
+	if r.ReadBool() {
+		tree.CharFreq = &ast.CharFreq{}
+		for i := range tree.CharFreq {
+			tree.CharFreq[i] = r.ReadInt32()
+		}
+	}
+
+	tree.ManifestForYarnPnP = d.expr()
+	tree.Hashbang = r.ReadString()
+	tree.Directives = d.strings()
+	tree.URLForCSS = r.ReadString()
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		tree.TopLevelSymbolToPartsFromParser = make(map[ast.Ref][]uint32, n)
+		for i := 0; i < n; i++ {
+			ref := d.ref()
+			tree.TopLevelSymbolToPartsFromParser[ref] = d.uint32s()
+		}
+	}
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		tree.TSEnums = make(map[ast.Ref]map[string]TSEnumValue, n)
+		for i := 0; i < n; i++ {
+			ref := d.ref()
+			var values map[string]TSEnumValue
+			if n, isNil := r.ReadNilableLength(); !isNil {
+				values = make(map[string]TSEnumValue, n)
+				for j := 0; j < n; j++ {
+					name := r.ReadString()
+					values[name] = TSEnumValue{String: r.ReadUint16s(), Number: r.ReadFloat64()}
+				}
+			}
+			tree.TSEnums[ref] = values
+		}
+	}
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		tree.ConstValues = make(map[ast.Ref]ConstValue, n)
+		for i := 0; i < n; i++ {
+			ref := d.ref()
+			tree.ConstValues[ref] = ConstValue{
+				Number: r.ReadFloat64(),
+				String: r.ReadUint16s(),
+				Kind:   ConstValueKind(r.ReadUint8()),
+			}
+		}
+	}
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		tree.MangledProps = make(map[string]ast.Ref, n)
+		for i := 0; i < n; i++ {
+			name := r.ReadString()
+			tree.MangledProps[name] = d.ref()
+		}
+	}
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		tree.ReservedProps = make(map[string]bool, n)
+		for i := 0; i < n; i++ {
+			name := r.ReadString()
+			tree.ReservedProps[name] = r.ReadBool()
+		}
+	}
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		tree.ImportRecords = make([]ast.ImportRecord, n)
+		for i := range tree.ImportRecords {
+			d.importRecord(&tree.ImportRecords[i])
+		}
+	}
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		tree.NamedImports = make(map[ast.Ref]NamedImport, n)
+		for i := 0; i < n; i++ {
+			ref := d.ref()
+			tree.NamedImports[ref] = NamedImport{
+				Alias:              r.ReadString(),
+				LocalPartsWithUses: d.uint32s(),
+				AliasLoc:           d.loc(),
+				NamespaceRef:       d.ref(),
+				ImportRecordIndex:  d.uint32(),
+				AliasIsStar:        r.ReadBool(),
+				IsExported:         r.ReadBool(),
+			}
+		}
+	}
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		tree.NamedExports = make(map[string]NamedExport, n)
+		for i := 0; i < n; i++ {
+			name := r.ReadString()
+			tree.NamedExports[name] = NamedExport{Ref: d.ref(), AliasLoc: d.loc()}
+		}
+	}
+
+	tree.ExportStarImportRecords = d.uint32s()
+	tree.SourceMapComment.Text = r.ReadString()
+	tree.SourceMapComment.Range = d.rng()
+	tree.ExportKeyword = d.rng()
+	tree.TopLevelAwaitKeyword = d.rng()
+	tree.LiveTopLevelAwaitKeyword = d.rng()
+	tree.ExportsRef = d.ref()
+	tree.ModuleRef = d.ref()
+	tree.WrapperRef = d.ref()
+	tree.ApproximateLineCount = r.ReadInt32()
+	for i := range tree.NestedScopeSlotCounts {
+		tree.NestedScopeSlotCounts[i] = d.uint32()
+	}
+	tree.HasLazyExport = r.ReadBool()
+	tree.UsesExportsRef = r.ReadBool()
+	tree.UsesModuleRef = r.ReadBool()
+	tree.ExportsKind = ExportsKind(r.ReadUint8())
+	return
+}
+
+func (e *encoder) part(part *Part) {
+	w := e.w
+	e.stmts(part.Stmts)
+
+	w.WriteNilableLength(len(part.Scopes), part.Scopes == nil)
+	for _, scope := range part.Scopes {
+		// Scopes in parts must be somewhere in the scope tree
+		index, ok := e.scopes[scope]
+		if !ok {
+			e.ok = false
+		}
+		w.WriteUvarint(uint64(index))
+	}
+
+	e.uint32s(part.ImportRecordIndices)
+
+	w.WriteNilableLength(len(part.DeclaredSymbols), part.DeclaredSymbols == nil)
+	for _, declared := range part.DeclaredSymbols {
+		e.ref(declared.Ref)
+		w.WriteBool(declared.IsTopLevel)
+	}
+
+	w.WriteNilableLength(len(part.SymbolUses), part.SymbolUses == nil)
+	for _, ref := range sortedRefsForSymbolUses(part.SymbolUses) {
+		e.ref(ref)
+		w.WriteUvarint(uint64(part.SymbolUses[ref].CountEstimate))
+	}
+
+	w.WriteNilableLength(len(part.SymbolCallUses), part.SymbolCallUses == nil)
+	for _, ref := range sortedRefsForSymbolCallUses(part.SymbolCallUses) {
+		use := part.SymbolCallUses[ref]
+		e.ref(ref)
+		w.WriteUvarint(uint64(use.CallCountEstimate))
+		w.WriteUvarint(uint64(use.SingleArgNonSpreadCallCountEstimate))
+	}
+
+	w.WriteNilableLength(len(part.ImportSymbolPropertyUses), part.ImportSymbolPropertyUses == nil)
+	for _, ref := range sortedRefsForPropertyUses(part.ImportSymbolPropertyUses) {
+		uses := part.ImportSymbolPropertyUses[ref]
+		e.ref(ref)
+		w.WriteNilableLength(len(uses), uses == nil)
+		names := make([]string, 0, len(uses))
+		for name := range uses {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			w.WriteString(name)
+			w.WriteUvarint(uint64(uses[name].CountEstimate))
+		}
+	}
+
+	w.WriteNilableLength(len(part.Dependencies), part.Dependencies == nil)
+	for _, dep := range part.Dependencies {
+		e.sourceIndexOf(dep.SourceIndex)
+		w.WriteUvarint(uint64(dep.PartIndex))
+	}
+
+	w.WriteBool(part.CanBeRemovedIfUnused)
+	w.WriteBool(part.ForceTreeShaking)
+	w.WriteBool(part.IsLive)
+}
+
+func (d *decoder) part(part *Part) {
+	r := d.r
+	part.Stmts = d.stmts()
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		part.Scopes = make([]*Scope, n)
+		for i := range part.Scopes {
+			index := r.ReadUvarint()
+			if index >= uint64(len(d.scopes)) {
+				r.Fail()
+				return
+			}
+			part.Scopes[i] = d.scopes[index]
+		}
+	}
+
+	part.ImportRecordIndices = d.uint32s()
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		part.DeclaredSymbols = make([]DeclaredSymbol, n)
+		for i := range part.DeclaredSymbols {
+			part.DeclaredSymbols[i] = DeclaredSymbol{Ref: d.ref(), IsTopLevel: r.ReadBool()}
+		}
+	}
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		part.SymbolUses = make(map[ast.Ref]SymbolUse, n)
+		for i := 0; i < n; i++ {
+			ref := d.ref()
+			part.SymbolUses[ref] = SymbolUse{CountEstimate: d.uint32()}
+		}
+	}
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		part.SymbolCallUses = make(map[ast.Ref]SymbolCallUse, n)
+		for i := 0; i < n; i++ {
+			ref := d.ref()
+			part.SymbolCallUses[ref] = SymbolCallUse{
+				CallCountEstimate:                   d.uint32(),
+				SingleArgNonSpreadCallCountEstimate: d.uint32(),
+			}
+		}
+	}
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		part.ImportSymbolPropertyUses = make(map[ast.Ref]map[string]SymbolUse, n)
+		for i := 0; i < n; i++ {
+			ref := d.ref()
+			var uses map[string]SymbolUse
+			if n, isNil := r.ReadNilableLength(); !isNil {
+				uses = make(map[string]SymbolUse, n)
+				for j := 0; j < n; j++ {
+					name := r.ReadString()
+					uses[name] = SymbolUse{CountEstimate: d.uint32()}
+				}
+			}
+			part.ImportSymbolPropertyUses[ref] = uses
+		}
+	}
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		part.Dependencies = make([]Dependency, n)
+		for i := range part.Dependencies {
+			part.Dependencies[i] = Dependency{SourceIndex: d.sourceIndexOf(), PartIndex: d.uint32()}
+		}
+	}
+
+	part.CanBeRemovedIfUnused = r.ReadBool()
+	part.ForceTreeShaking = r.ReadBool()
+	part.IsLive = r.ReadBool()
+}
+
+func (e *encoder) symbol(symbol *ast.Symbol) {
+	w := e.w
+	w.WriteBool(symbol.NamespaceAlias != nil)
+	if symbol.NamespaceAlias != nil {
+		w.WriteString(symbol.NamespaceAlias.Alias)
+		e.ref(symbol.NamespaceAlias.NamespaceRef)
+	}
+	w.WriteString(symbol.OriginalName)
+	e.ref(symbol.Link)
+	w.WriteUvarint(uint64(symbol.UseCountEstimate))
+	e.index32(symbol.ChunkIndex)
+	e.index32(symbol.NestedScopeSlot)
+	w.WriteUvarint(uint64(symbol.Flags))
+	w.WriteUint8(uint8(symbol.Kind))
+	w.WriteUint8(uint8(symbol.ImportItemStatus))
+}
+
+func (d *decoder) symbol(symbol *ast.Symbol) {
+	r := d.r
+	if r.ReadBool() {
+		symbol.NamespaceAlias = &ast.NamespaceAlias{Alias: r.ReadString(), NamespaceRef: d.ref()}
+	}
+	symbol.OriginalName = r.ReadString()
+	symbol.Link = d.ref()
+	symbol.UseCountEstimate = d.uint32()
+	symbol.ChunkIndex = d.index32()
+	symbol.NestedScopeSlot = d.index32()
+	symbol.Flags = ast.SymbolFlags(r.ReadUvarint())
+	symbol.Kind = ast.SymbolKind(r.ReadUint8())
+	symbol.ImportItemStatus = ast.ImportItemStatus(r.ReadUint8())
+}
+
+func (e *encoder) importRecord(record *ast.ImportRecord) {
+	w := e.w
+	w.WriteBool(record.AssertOrWith != nil)
+	if assertOrWith := record.AssertOrWith; assertOrWith != nil {
+		w.WriteNilableLength(len(assertOrWith.Entries), assertOrWith.Entries == nil)
+		for _, entry := range assertOrWith.Entries {
+			w.WriteUint16s(entry.Key)
+			w.WriteUint16s(entry.Value)
+			e.loc(entry.KeyLoc)
+			e.loc(entry.ValueLoc)
+			w.WriteBool(entry.PreferQuotedKey)
+		}
+		e.loc(assertOrWith.KeywordLoc)
+		e.loc(assertOrWith.InnerOpenBraceLoc)
+		e.loc(assertOrWith.InnerCloseBraceLoc)
+		e.loc(assertOrWith.OuterOpenBraceLoc)
+		e.loc(assertOrWith.OuterCloseBraceLoc)
+		w.WriteUint8(uint8(assertOrWith.Keyword))
+	}
+	w.WriteBool(record.GlobPattern != nil)
+	if glob := record.GlobPattern; glob != nil {
+		w.WriteNilableLength(len(glob.Parts), glob.Parts == nil)
+		for _, part := range glob.Parts {
+			w.WriteString(part.Prefix)
+			w.WriteUint8(uint8(part.Wildcard))
+		}
+		w.WriteString(glob.ExportAlias)
+		w.WriteUint8(uint8(glob.Kind))
+	}
+	e.path(record.Path)
+	e.rng(record.Range)
+	e.loc(record.ErrorHandlerLoc)
+	e.index32(record.SourceIndex)
+	e.index32(record.CopySourceIndex)
+	w.WriteUvarint(uint64(record.Flags))
+	w.WriteUint8(uint8(record.Phase))
+	w.WriteUint8(uint8(record.Kind))
+}
+
+func (d *decoder) importRecord(record *ast.ImportRecord) {
+	r := d.r
+	if r.ReadBool() {
+		assertOrWith := &ast.ImportAssertOrWith{}
+		if n, isNil := r.ReadNilableLength(); !isNil {
+			assertOrWith.Entries = make([]ast.AssertOrWithEntry, n)
+			for i := range assertOrWith.Entries {
+				assertOrWith.Entries[i] = ast.AssertOrWithEntry{
+					Key:             r.ReadUint16s(),
+					Value:           r.ReadUint16s(),
+					KeyLoc:          d.loc(),
+					ValueLoc:        d.loc(),
+					PreferQuotedKey: r.ReadBool(),
+				}
+			}
+		}
+		assertOrWith.KeywordLoc = d.loc()
+		assertOrWith.InnerOpenBraceLoc = d.loc()
+		assertOrWith.InnerCloseBraceLoc = d.loc()
+		assertOrWith.OuterOpenBraceLoc = d.loc()
+		assertOrWith.OuterCloseBraceLoc = d.loc()
+		assertOrWith.Keyword = ast.AssertOrWithKeyword(r.ReadUint8())
+		record.AssertOrWith = assertOrWith
+	}
+	if r.ReadBool() {
+		glob := &ast.GlobPattern{}
+		if n, isNil := r.ReadNilableLength(); !isNil {
+			glob.Parts = make([]helpers.GlobPart, n)
+			for i := range glob.Parts {
+				glob.Parts[i] = helpers.GlobPart{Prefix: r.ReadString(), Wildcard: helpers.GlobWildcard(r.ReadUint8())}
+			}
+		}
+		glob.ExportAlias = r.ReadString()
+		glob.Kind = ast.ImportKind(r.ReadUint8())
+		record.GlobPattern = glob
+	}
+	record.Path = d.path()
+	record.Range = d.rng()
+	record.ErrorHandlerLoc = d.loc()
+	record.SourceIndex = d.index32()
+	record.CopySourceIndex = d.index32()
+	record.Flags = ast.ImportRecordFlags(r.ReadUvarint())
+	record.Phase = ast.ImportPhase(r.ReadUint8())
+	record.Kind = ast.ImportKind(r.ReadUint8())
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Scopes
+
+// Scopes are numbered in tree order so that they can be referenced by index.
+// Note that the parent of a scope isn't necessarily the scope that it's a
+// child of, since lowering sometimes moves scopes around.
+func (e *encoder) numberScopes(scope *Scope) {
+	e.scopes[scope] = uint32(len(e.scopes))
+	for _, child := range scope.Children {
+		e.numberScopes(child)
+	}
+}
+
+func (e *encoder) scope(scope *Scope) {
+	w := e.w
+
+	if scope.Parent == nil {
+		w.WriteUvarint(0)
+	} else if index, ok := e.scopes[scope.Parent]; ok {
+		w.WriteUvarint(uint64(index) + 1)
+	} else {
+		w.WriteUvarint(0)
+		e.ok = false
+	}
+
+	w.WriteBool(scope.TSNamespace != nil)
+	if ns := scope.TSNamespace; ns != nil {
+		e.tsNamespaceMembers(ns.ExportedMembers)
+		w.WriteNilableLength(len(ns.LazilyGeneratedProperyAccesses), ns.LazilyGeneratedProperyAccesses == nil)
+		names := make([]string, 0, len(ns.LazilyGeneratedProperyAccesses))
+		for name := range ns.LazilyGeneratedProperyAccesses {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			w.WriteString(name)
+			e.ref(ns.LazilyGeneratedProperyAccesses[name])
+		}
+		e.ref(ns.ArgRef)
+		w.WriteBool(ns.IsEnumScope)
+	}
+
+	w.WriteNilableLength(len(scope.Members), scope.Members == nil)
+	names := make([]string, 0, len(scope.Members))
+	for name := range scope.Members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		member := scope.Members[name]
+		w.WriteString(name)
+		e.ref(member.Ref)
+		e.loc(member.Loc)
+	}
+
+	w.WriteNilableLength(len(scope.Replaced), scope.Replaced == nil)
+	for _, member := range scope.Replaced {
+		e.ref(member.Ref)
+		e.loc(member.Loc)
+	}
+
+	w.WriteNilableLength(len(scope.Generated), scope.Generated == nil)
+	for _, ref := range scope.Generated {
+		e.ref(ref)
+	}
+
+	e.loc(scope.UseStrictLoc)
+	e.locRef(scope.Label)
+	w.WriteBool(scope.LabelStmtIsLoop)
+	w.WriteBool(scope.ContainsDirectEval)
+	w.WriteBool(scope.ForbidArguments)
+	w.WriteBool(scope.IsAfterConstLocalPrefix)
+	w.WriteUint8(uint8(scope.StrictMode))
+	w.WriteUint8(uint8(scope.Kind))
+
+	w.WriteNilableLength(len(scope.Children), scope.Children == nil)
+	for _, child := range scope.Children {
+		e.scope(child)
+	}
+}
+
+func (d *decoder) scope() *Scope {
+	r := d.r
+	scope := &Scope{}
+	d.parents = append(d.parents, d.uint32())
+	d.scopes = append(d.scopes, scope)
+
+	if r.ReadBool() {
+		ns := &TSNamespaceScope{ExportedMembers: d.tsNamespaceMembers()}
+		if n, isNil := r.ReadNilableLength(); !isNil {
+			ns.LazilyGeneratedProperyAccesses = make(map[string]ast.Ref, n)
+			for i := 0; i < n; i++ {
+				name := r.ReadString()
+				ns.LazilyGeneratedProperyAccesses[name] = d.ref()
+			}
+		}
+		ns.ArgRef = d.ref()
+		ns.IsEnumScope = r.ReadBool()
+		scope.TSNamespace = ns
+	}
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		scope.Members = make(map[string]ScopeMember, n)
+		for i := 0; i < n; i++ {
+			name := r.ReadString()
+			scope.Members[name] = ScopeMember{Ref: d.ref(), Loc: d.loc()}
+		}
+	}
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		scope.Replaced = make([]ScopeMember, n)
+		for i := range scope.Replaced {
+			scope.Replaced[i] = ScopeMember{Ref: d.ref(), Loc: d.loc()}
+		}
+	}
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		scope.Generated = make([]ast.Ref, n)
+		for i := range scope.Generated {
+			scope.Generated[i] = d.ref()
+		}
+	}
+
+	scope.UseStrictLoc = d.loc()
+	scope.Label = d.locRef()
+	scope.LabelStmtIsLoop = r.ReadBool()
+	scope.ContainsDirectEval = r.ReadBool()
+	scope.ForbidArguments = r.ReadBool()
+	scope.IsAfterConstLocalPrefix = r.ReadBool()
+	scope.StrictMode = StrictModeKind(r.ReadUint8())
+	scope.Kind = ScopeKind(r.ReadUint8())
+
+	if n, isNil := r.ReadNilableLength(); !isNil {
+		scope.Children = make([]*Scope, n)
+		for i := range scope.Children {
+			scope.Children[i] = d.scope()
+		}
+	}
+	return scope
+}
+
+const (
+	tsNamespaceMemberNil uint8 = iota
+	tsNamespaceMemberProperty
+	tsNamespaceMemberNamespace
+	tsNamespaceMemberEnumNumber
+	tsNamespaceMemberEnumString
+)
+
+func (e *encoder) tsNamespaceMembers(members TSNamespaceMembers) {
+	w := e.w
+	w.WriteNilableLength(len(members), members == nil)
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		member := members[name]
+		w.WriteString(name)
+		switch data := member.Data.(type) {
+		case nil:
+			w.WriteUint8(tsNamespaceMemberNil)
+		case *TSNamespaceMemberProperty:
+			w.WriteUint8(tsNamespaceMemberProperty)
+		case *TSNamespaceMemberNamespace:
+			w.WriteUint8(tsNamespaceMemberNamespace)
+			e.tsNamespaceMembers(data.ExportedMembers)
+		case *TSNamespaceMemberEnumNumber:
+			w.WriteUint8(tsNamespaceMemberEnumNumber)
+			w.WriteFloat64(data.Value)
+		case *TSNamespaceMemberEnumString:
+			w.WriteUint8(tsNamespaceMemberEnumString)
+			w.WriteUint16s(data.Value)
+		default:
+			w.WriteUint8(tsNamespaceMemberNil)
+			e.ok = false
+		}
+		e.loc(member.Loc)
+		w.WriteBool(member.IsEnumValue)
+	}
+}
+
+func (d *decoder) tsNamespaceMembers() TSNamespaceMembers {
+	r := d.r
+	n, isNil := r.ReadNilableLength()
+	if isNil {
+		return nil
+	}
+	members := make(TSNamespaceMembers, n)
+	for i := 0; i < n; i++ {
+		name := r.ReadString()
+		var member TSNamespaceMember
+		switch r.ReadUint8() {
+		case tsNamespaceMemberNil:
+		case tsNamespaceMemberProperty:
+			member.Data = &TSNamespaceMemberProperty{}
+		case tsNamespaceMemberNamespace:
+			member.Data = &TSNamespaceMemberNamespace{ExportedMembers: d.tsNamespaceMembers()}
+		case tsNamespaceMemberEnumNumber:
+			member.Data = &TSNamespaceMemberEnumNumber{Value: r.ReadFloat64()}
+		case tsNamespaceMemberEnumString:
+			member.Data = &TSNamespaceMemberEnumString{Value: r.ReadUint16s()}
+		default:
+			r.Fail()
+		}
+		member.Loc = d.loc()
+		member.IsEnumValue = r.ReadBool()
+		members[name] = member
+	}
+	return members
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Expressions
+
+const (
+	exprTagNil uint8 = iota
+	exprTagArray
+	exprTagUnary
+	exprTagBinary
+	exprTagBoolean
+	exprTagSuper
+	exprTagNull
+	exprTagUndefined
+	exprTagThis
+	exprTagNew
+	exprTagNewTarget
+	exprTagImportMeta
+	exprTagCall
+	exprTagDot
+	exprTagIndex
+	exprTagArrow
+	exprTagFunction
+	exprTagClass
+	exprTagIdentifier
+	exprTagImportIdentifier
+	exprTagPrivateIdentifier
+	exprTagNameOfSymbol
+	exprTagJSXElement
+	exprTagJSXText
+	exprTagMissing
+	exprTagNumber
+	exprTagBigInt
+	exprTagObject
+	exprTagSpread
+	exprTagString
+	exprTagTemplate
+	exprTagRegExp
+	exprTagInlinedEnum
+	exprTagAnnotation
+	exprTagAwait
+	exprTagYield
+	exprTagIf
+	exprTagRequireString
+	exprTagRequireResolveString
+	exprTagImportString
+	exprTagImportCall
+	exprTagURLString
+)
+
+func (e *encoder) expr(expr Expr) {
+	w := e.w
+	if expr.Data == nil {
+		w.WriteUint8(exprTagNil)
+		e.loc(expr.Loc)
+		return
+	}
+
+	switch x := expr.Data.(type) {
+	case *EArray:
+		w.WriteUint8(exprTagArray)
+		e.loc(expr.Loc)
+		e.exprs(x.Items)
+		e.loc(x.CommaAfterSpread)
+		e.loc(x.CloseBracketLoc)
+		w.WriteBool(x.IsSingleLine)
+		w.WriteBool(x.IsParenthesized)
+
+	case *EUnary:
+		w.WriteUint8(exprTagUnary)
+		e.loc(expr.Loc)
+		e.expr(x.Value)
+		w.WriteUint8(uint8(x.Op))
+		w.WriteBool(x.WasOriginallyTypeofIdentifier)
+		w.WriteBool(x.WasOriginallyDeleteOfIdentifierOrPropertyAccess)
+
+	case *EBinary:
+		w.WriteUint8(exprTagBinary)
+		e.loc(expr.Loc)
+		e.expr(x.Left)
+		e.expr(x.Right)
+		w.WriteUint8(uint8(x.Op))
+
+	case *EBoolean:
+		w.WriteUint8(exprTagBoolean)
+		e.loc(expr.Loc)
+		w.WriteBool(x.Value)
+
+	case *ESuper:
+		w.WriteUint8(exprTagSuper)
+		e.loc(expr.Loc)
+
+	case *ENull:
+		w.WriteUint8(exprTagNull)
+		e.loc(expr.Loc)
+
+	case *EUndefined:
+		w.WriteUint8(exprTagUndefined)
+		e.loc(expr.Loc)
+
+	case *EThis:
+		w.WriteUint8(exprTagThis)
+		e.loc(expr.Loc)
+
+	case *ENew:
+		w.WriteUint8(exprTagNew)
+		e.loc(expr.Loc)
+		e.expr(x.Target)
+		e.exprs(x.Args)
+		e.loc(x.CloseParenLoc)
+		w.WriteBool(x.IsMultiLine)
+		w.WriteBool(x.CanBeUnwrappedIfUnused)
+
+	case *ENewTarget:
+		w.WriteUint8(exprTagNewTarget)
+		e.loc(expr.Loc)
+		e.rng(x.Range)
+
+	case *EImportMeta:
+		w.WriteUint8(exprTagImportMeta)
+		e.loc(expr.Loc)
+		w.WriteVarint(int64(x.RangeLen))
+
+	case *ECall:
+		w.WriteUint8(exprTagCall)
+		e.loc(expr.Loc)
+		e.expr(x.Target)
+		e.exprs(x.Args)
+		e.loc(x.CloseParenLoc)
+		w.WriteUint8(uint8(x.OptionalChain))
+		w.WriteUint8(uint8(x.Kind))
+		w.WriteBool(x.IsMultiLine)
+		w.WriteBool(x.CanBeUnwrappedIfUnused)
+
+	case *EDot:
+		w.WriteUint8(exprTagDot)
+		e.loc(expr.Loc)
+		e.expr(x.Target)
+		w.WriteString(x.Name)
+		e.loc(x.NameLoc)
+		w.WriteUint8(uint8(x.OptionalChain))
+		w.WriteBool(x.CanBeRemovedIfUnused)
+		w.WriteBool(x.CallCanBeUnwrappedIfUnused)
+		w.WriteBool(x.IsSymbolInstance)
+
+	case *EIndex:
+		w.WriteUint8(exprTagIndex)
+		e.loc(expr.Loc)
+		e.expr(x.Target)
+		e.expr(x.Index)
+		e.loc(x.CloseBracketLoc)
+		w.WriteUint8(uint8(x.OptionalChain))
+		w.WriteBool(x.CanBeRemovedIfUnused)
+		w.WriteBool(x.CallCanBeUnwrappedIfUnused)
+		w.WriteBool(x.IsSymbolInstance)
+
+	case *EArrow:
+		w.WriteUint8(exprTagArrow)
+		e.loc(expr.Loc)
+		e.args(x.Args)
+		e.fnBody(x.Body)
+		w.WriteBool(x.IsAsync)
+		w.WriteBool(x.HasRestArg)
+		w.WriteBool(x.PreferExpr)
+		w.WriteBool(x.IsParenthesized)
+		w.WriteBool(x.HasNoSideEffectsComment)
+
+	case *EFunction:
+		w.WriteUint8(exprTagFunction)
+		e.loc(expr.Loc)
+		e.fn(&x.Fn)
+		w.WriteBool(x.IsParenthesized)
+
+	case *EClass:
+		w.WriteUint8(exprTagClass)
+		e.loc(expr.Loc)
+		e.class(&x.Class)
+
+	case *EIdentifier:
+		w.WriteUint8(exprTagIdentifier)
+		e.loc(expr.Loc)
+		e.ref(x.Ref)
+		w.WriteBool(x.MustKeepDueToWithStmt)
+		w.WriteBool(x.CanBeRemovedIfUnused)
+		w.WriteBool(x.CallCanBeUnwrappedIfUnused)
+
+	case *EImportIdentifier:
+		w.WriteUint8(exprTagImportIdentifier)
+		e.loc(expr.Loc)
+		e.ref(x.Ref)
+		w.WriteBool(x.PreferQuotedKey)
+		w.WriteBool(x.WasOriginallyIdentifier)
+
+	case *EPrivateIdentifier:
+		w.WriteUint8(exprTagPrivateIdentifier)
+		e.loc(expr.Loc)
+		e.ref(x.Ref)
+
+	case *ENameOfSymbol:
+		w.WriteUint8(exprTagNameOfSymbol)
+		e.loc(expr.Loc)
+		e.ref(x.Ref)
+		w.WriteBool(x.HasPropertyKeyComment)
+
+	case *EJSXElement:
+		w.WriteUint8(exprTagJSXElement)
+		e.loc(expr.Loc)
+		e.expr(x.TagOrNil)
+		e.properties(x.Properties)
+		e.exprs(x.NullableChildren)
+		e.loc(x.CloseLoc)
+		w.WriteBool(x.IsTagSingleLine)
+
+	case *EJSXText:
+		w.WriteUint8(exprTagJSXText)
+		e.loc(expr.Loc)
+		w.WriteString(x.Raw)
+
+	case *EMissing:
+		w.WriteUint8(exprTagMissing)
+		e.loc(expr.Loc)
+
+	case *ENumber:
+		w.WriteUint8(exprTagNumber)
+		e.loc(expr.Loc)
+		w.WriteFloat64(x.Value)
+
+	case *EBigInt:
+		w.WriteUint8(exprTagBigInt)
+		e.loc(expr.Loc)
+		w.WriteString(x.Value)
+
+	case *EObject:
+		w.WriteUint8(exprTagObject)
+		e.loc(expr.Loc)
+		e.properties(x.Properties)
+		e.loc(x.CommaAfterSpread)
+		e.loc(x.CloseBraceLoc)
+		w.WriteBool(x.IsSingleLine)
+		w.WriteBool(x.IsParenthesized)
+
+	case *ESpread:
+		w.WriteUint8(exprTagSpread)
+		e.loc(expr.Loc)
+		e.expr(x.Value)
+
+	case *EString:
+		w.WriteUint8(exprTagString)
+		e.loc(expr.Loc)
+		w.WriteUint16s(x.Value)
+		e.loc(x.LegacyOctalLoc)
+		w.WriteBool(x.PreferTemplate)
+		w.WriteBool(x.HasPropertyKeyComment)
+		w.WriteBool(x.ContainsUniqueKey)
+
+	case *ETemplate:
+		w.WriteUint8(exprTagTemplate)
+		e.loc(expr.Loc)
+		e.expr(x.TagOrNil)
+		w.WriteString(x.HeadRaw)
+		w.WriteUint16s(x.HeadCooked)
+		w.WriteNilableLength(len(x.Parts), x.Parts == nil)
+		for _, part := range x.Parts {
+			e.expr(part.Value)
+			w.WriteString(part.TailRaw)
+			w.WriteUint16s(part.TailCooked)
+			e.loc(part.TailLoc)
+		}
+		e.loc(x.HeadLoc)
+		e.loc(x.LegacyOctalLoc)
+		w.WriteBool(x.CanBeUnwrappedIfUnused)
+		w.WriteBool(x.TagWasOriginallyPropertyAccess)
+
+	case *ERegExp:
+		w.WriteUint8(exprTagRegExp)
+		e.loc(expr.Loc)
+		w.WriteString(x.Value)
+
+	case *EInlinedEnum:
+		w.WriteUint8(exprTagInlinedEnum)
+		e.loc(expr.Loc)
+		e.expr(x.Value)
+		w.WriteString(x.Comment)
+
+	case *EAnnotation:
+		w.WriteUint8(exprTagAnnotation)
+		e.loc(expr.Loc)
+		e.expr(x.Value)
+		w.WriteUint8(uint8(x.Flags))
+
+	case *EAwait:
+		w.WriteUint8(exprTagAwait)
+		e.loc(expr.Loc)
+		e.expr(x.Value)
+
+	case *EYield:
+		w.WriteUint8(exprTagYield)
+		e.loc(expr.Loc)
+		e.expr(x.ValueOrNil)
+		w.WriteBool(x.IsStar)
+
+	case *EIf:
+		w.WriteUint8(exprTagIf)
+		e.loc(expr.Loc)
+		e.expr(x.Test)
+		e.expr(x.Yes)
+		e.expr(x.No)
+
+	case *ERequireString:
+		w.WriteUint8(exprTagRequireString)
+		e.loc(expr.Loc)
+		w.WriteUvarint(uint64(x.ImportRecordIndex))
+		e.loc(x.CloseParenLoc)
+
+	case *ERequireResolveString:
+		w.WriteUint8(exprTagRequireResolveString)
+		e.loc(expr.Loc)
+		w.WriteUvarint(uint64(x.ImportRecordIndex))
+		e.loc(x.CloseParenLoc)
+
+	case *EImportString:
+		w.WriteUint8(exprTagImportString)
+		e.loc(expr.Loc)
+		w.WriteUvarint(uint64(x.ImportRecordIndex))
+		e.loc(x.CloseParenLoc)
+
+	case *EImportCall:
+		w.WriteUint8(exprTagImportCall)
+		e.loc(expr.Loc)
+		e.expr(x.Expr)
+		e.expr(x.OptionsOrNil)
+		e.loc(x.CloseParenLoc)
+		w.WriteUint8(uint8(x.Phase))
+
+	case *EURLString:
+		w.WriteUint8(exprTagURLString)
+		e.loc(expr.Loc)
+		w.WriteUvarint(uint64(x.ImportRecordIndex))
+
+	default:
+		w.WriteUint8(exprTagNil)
+		e.ok = false
+	}
+}
+
+func (d *decoder) expr() Expr {
+	r := d.r
+	tag := r.ReadUint8()
+	loc := d.loc()
+	if tag == exprTagNil {
+		return Expr{Loc: loc}
+	}
+
+	switch tag {
+	case exprTagArray:
+		x := &EArray{Items: d.exprs()}
+		x.CommaAfterSpread = d.loc()
+		x.CloseBracketLoc = d.loc()
+		x.IsSingleLine = r.ReadBool()
+		x.IsParenthesized = r.ReadBool()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagUnary:
+		x := &EUnary{Value: d.expr()}
+		x.Op = OpCode(r.ReadUint8())
+		x.WasOriginallyTypeofIdentifier = r.ReadBool()
+		x.WasOriginallyDeleteOfIdentifierOrPropertyAccess = r.ReadBool()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagBinary:
+		x := &EBinary{Left: d.expr()}
+		x.Right = d.expr()
+		x.Op = OpCode(r.ReadUint8())
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagBoolean:
+		return Expr{Loc: loc, Data: &EBoolean{Value: r.ReadBool()}}
+
+	case exprTagSuper:
+		return Expr{Loc: loc, Data: ESuperShared}
+
+	case exprTagNull:
+		return Expr{Loc: loc, Data: ENullShared}
+
+	case exprTagUndefined:
+		return Expr{Loc: loc, Data: EUndefinedShared}
+
+	case exprTagThis:
+		return Expr{Loc: loc, Data: EThisShared}
+
+	case exprTagNew:
+		x := &ENew{Target: d.expr()}
+		x.Args = d.exprs()
+		x.CloseParenLoc = d.loc()
+		x.IsMultiLine = r.ReadBool()
+		x.CanBeUnwrappedIfUnused = r.ReadBool()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagNewTarget:
+		return Expr{Loc: loc, Data: &ENewTarget{Range: d.rng()}}
+
+	case exprTagImportMeta:
+		return Expr{Loc: loc, Data: &EImportMeta{RangeLen: r.ReadInt32()}}
+
+	case exprTagCall:
+		x := &ECall{Target: d.expr()}
+		x.Args = d.exprs()
+		x.CloseParenLoc = d.loc()
+		x.OptionalChain = OptionalChain(r.ReadUint8())
+		x.Kind = CallKind(r.ReadUint8())
+		x.IsMultiLine = r.ReadBool()
+		x.CanBeUnwrappedIfUnused = r.ReadBool()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagDot:
+		x := &EDot{Target: d.expr()}
+		x.Name = r.ReadString()
+		x.NameLoc = d.loc()
+		x.OptionalChain = OptionalChain(r.ReadUint8())
+		x.CanBeRemovedIfUnused = r.ReadBool()
+		x.CallCanBeUnwrappedIfUnused = r.ReadBool()
+		x.IsSymbolInstance = r.ReadBool()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagIndex:
+		x := &EIndex{Target: d.expr()}
+		x.Index = d.expr()
+		x.CloseBracketLoc = d.loc()
+		x.OptionalChain = OptionalChain(r.ReadUint8())
+		x.CanBeRemovedIfUnused = r.ReadBool()
+		x.CallCanBeUnwrappedIfUnused = r.ReadBool()
+		x.IsSymbolInstance = r.ReadBool()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagArrow:
+		x := &EArrow{Args: d.args()}
+		x.Body = d.fnBody()
+		x.IsAsync = r.ReadBool()
+		x.HasRestArg = r.ReadBool()
+		x.PreferExpr = r.ReadBool()
+		x.IsParenthesized = r.ReadBool()
+		x.HasNoSideEffectsComment = r.ReadBool()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagFunction:
+		x := &EFunction{}
+		d.fn(&x.Fn)
+		x.IsParenthesized = r.ReadBool()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagClass:
+		x := &EClass{}
+		d.class(&x.Class)
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagIdentifier:
+		x := &EIdentifier{Ref: d.ref()}
+		x.MustKeepDueToWithStmt = r.ReadBool()
+		x.CanBeRemovedIfUnused = r.ReadBool()
+		x.CallCanBeUnwrappedIfUnused = r.ReadBool()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagImportIdentifier:
+		x := &EImportIdentifier{Ref: d.ref()}
+		x.PreferQuotedKey = r.ReadBool()
+		x.WasOriginallyIdentifier = r.ReadBool()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagPrivateIdentifier:
+		return Expr{Loc: loc, Data: &EPrivateIdentifier{Ref: d.ref()}}
+
+	case exprTagNameOfSymbol:
+		x := &ENameOfSymbol{Ref: d.ref()}
+		x.HasPropertyKeyComment = r.ReadBool()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagJSXElement:
+		x := &EJSXElement{TagOrNil: d.expr()}
+		x.Properties = d.properties()
+		x.NullableChildren = d.exprs()
+		x.CloseLoc = d.loc()
+		x.IsTagSingleLine = r.ReadBool()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagJSXText:
+		return Expr{Loc: loc, Data: &EJSXText{Raw: r.ReadString()}}
+
+	case exprTagMissing:
+		return Expr{Loc: loc, Data: EMissingShared}
+
+	case exprTagNumber:
+		return Expr{Loc: loc, Data: &ENumber{Value: r.ReadFloat64()}}
+
+	case exprTagBigInt:
+		return Expr{Loc: loc, Data: &EBigInt{Value: r.ReadString()}}
+
+	case exprTagObject:
+		x := &EObject{Properties: d.properties()}
+		x.CommaAfterSpread = d.loc()
+		x.CloseBraceLoc = d.loc()
+		x.IsSingleLine = r.ReadBool()
+		x.IsParenthesized = r.ReadBool()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagSpread:
+		return Expr{Loc: loc, Data: &ESpread{Value: d.expr()}}
+
+	case exprTagString:
+		x := &EString{Value: r.ReadUint16s()}
+		x.LegacyOctalLoc = d.loc()
+		x.PreferTemplate = r.ReadBool()
+		x.HasPropertyKeyComment = r.ReadBool()
+		x.ContainsUniqueKey = r.ReadBool()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagTemplate:
+		x := &ETemplate{TagOrNil: d.expr()}
+		x.HeadRaw = r.ReadString()
+		x.HeadCooked = r.ReadUint16s()
+		if n, isNil := r.ReadNilableLength(); !isNil {
+			x.Parts = make([]TemplatePart, n)
+			for i := range x.Parts {
+				part := &x.Parts[i]
+				part.Value = d.expr()
+				part.TailRaw = r.ReadString()
+				part.TailCooked = r.ReadUint16s()
+				part.TailLoc = d.loc()
+			}
+		}
+		x.HeadLoc = d.loc()
+		x.LegacyOctalLoc = d.loc()
+		x.CanBeUnwrappedIfUnused = r.ReadBool()
+		x.TagWasOriginallyPropertyAccess = r.ReadBool()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagRegExp:
+		return Expr{Loc: loc, Data: &ERegExp{Value: r.ReadString()}}
+
+	case exprTagInlinedEnum:
+		x := &EInlinedEnum{Value: d.expr()}
+		x.Comment = r.ReadString()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagAnnotation:
+		x := &EAnnotation{Value: d.expr()}
+		x.Flags = AnnotationFlags(r.ReadUint8())
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagAwait:
+		return Expr{Loc: loc, Data: &EAwait{Value: d.expr()}}
+
+	case exprTagYield:
+		x := &EYield{ValueOrNil: d.expr()}
+		x.IsStar = r.ReadBool()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagIf:
+		x := &EIf{Test: d.expr()}
+		x.Yes = d.expr()
+		x.No = d.expr()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagRequireString:
+		x := &ERequireString{ImportRecordIndex: d.uint32()}
+		x.CloseParenLoc = d.loc()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagRequireResolveString:
+		x := &ERequireResolveString{ImportRecordIndex: d.uint32()}
+		x.CloseParenLoc = d.loc()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagImportString:
+		x := &EImportString{ImportRecordIndex: d.uint32()}
+		x.CloseParenLoc = d.loc()
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagImportCall:
+		x := &EImportCall{Expr: d.expr()}
+		x.OptionsOrNil = d.expr()
+		x.CloseParenLoc = d.loc()
+		x.Phase = ast.ImportPhase(r.ReadUint8())
+		return Expr{Loc: loc, Data: x}
+
+	case exprTagURLString:
+		return Expr{Loc: loc, Data: &EURLString{ImportRecordIndex: d.uint32()}}
+	}
+
+	r.Fail()
+	return Expr{}
+}
+
+func (e *encoder) exprs(exprs []Expr) {
+	e.w.WriteNilableLength(len(exprs), exprs == nil)
+	for _, expr := range exprs {
+		e.expr(expr)
+	}
+}
+
+func (d *decoder) exprs() []Expr {
+	n, isNil := d.r.ReadNilableLength()
+	if isNil {
+		return nil
+	}
+	exprs := make([]Expr, n)
+	for i := range exprs {
+		exprs[i] = d.expr()
+	}
+	return exprs
+}
+
+func (e *encoder) properties(properties []Property) {
+	w := e.w
+	w.WriteNilableLength(len(properties), properties == nil)
+	for i := range properties {
+		property := &properties[i]
+		w.WriteBool(property.ClassStaticBlock != nil)
+		if property.ClassStaticBlock != nil {
+			e.block(property.ClassStaticBlock.Block)
+			e.loc(property.ClassStaticBlock.Loc)
+		}
+		e.expr(property.Key)
+		e.expr(property.ValueOrNil)
+		e.expr(property.InitializerOrNil)
+		e.decorators(property.Decorators)
+		e.loc(property.Loc)
+		e.loc(property.CloseBracketLoc)
+		w.WriteUint8(uint8(property.Kind))
+		w.WriteUint8(uint8(property.Flags))
+	}
+}
+
+func (d *decoder) properties() []Property {
+	r := d.r
+	n, isNil := r.ReadNilableLength()
+	if isNil {
+		return nil
+	}
+	properties := make([]Property, n)
+	for i := range properties {
+		property := &properties[i]
+		if r.ReadBool() {
+			property.ClassStaticBlock = &ClassStaticBlock{Block: d.block()}
+			property.ClassStaticBlock.Loc = d.loc()
+		}
+		property.Key = d.expr()
+		property.ValueOrNil = d.expr()
+		property.InitializerOrNil = d.expr()
+		property.Decorators = d.decorators()
+		property.Loc = d.loc()
+		property.CloseBracketLoc = d.loc()
+		property.Kind = PropertyKind(r.ReadUint8())
+		property.Flags = PropertyFlags(r.ReadUint8())
+	}
+	return properties
+}
+
+func (e *encoder) decorators(decorators []Decorator) {
+	w := e.w
+	w.WriteNilableLength(len(decorators), decorators == nil)
+	for _, decorator := range decorators {
+		e.expr(decorator.Value)
+		e.loc(decorator.AtLoc)
+		w.WriteBool(decorator.OmitNewlineAfter)
+	}
+}
+
+func (d *decoder) decorators() []Decorator {
+	r := d.r
+	n, isNil := r.ReadNilableLength()
+	if isNil {
+		return nil
+	}
+	decorators := make([]Decorator, n)
+	for i := range decorators {
+		decorators[i] = Decorator{Value: d.expr(), AtLoc: d.loc(), OmitNewlineAfter: r.ReadBool()}
+	}
+	return decorators
+}
+
+func (e *encoder) args(args []Arg) {
+	w := e.w
+	w.WriteNilableLength(len(args), args == nil)
+	for _, arg := range args {
+		e.binding(arg.Binding)
+		e.expr(arg.DefaultOrNil)
+		e.decorators(arg.Decorators)
+		w.WriteBool(arg.IsTypeScriptCtorField)
+	}
+}
+
+func (d *decoder) args() []Arg {
+	r := d.r
+	n, isNil := r.ReadNilableLength()
+	if isNil {
+		return nil
+	}
+	args := make([]Arg, n)
+	for i := range args {
+		args[i] = Arg{Binding: d.binding(), DefaultOrNil: d.expr(), Decorators: d.decorators(), IsTypeScriptCtorField: r.ReadBool()}
+	}
+	return args
+}
+
+func (e *encoder) fn(fn *Fn) {
+	w := e.w
+	e.optionalLocRef(fn.Name)
+	e.args(fn.Args)
+	e.fnBody(fn.Body)
+	e.ref(fn.ArgumentsRef)
+	e.loc(fn.OpenParenLoc)
+	w.WriteBool(fn.IsAsync)
+	w.WriteBool(fn.IsGenerator)
+	w.WriteBool(fn.HasRestArg)
+	w.WriteBool(fn.HasIfScope)
+	w.WriteBool(fn.HasNoSideEffectsComment)
+	w.WriteBool(fn.IsUniqueFormalParameters)
+}
+
+func (d *decoder) fn(fn *Fn) {
+	r := d.r
+	fn.Name = d.optionalLocRef()
+	fn.Args = d.args()
+	fn.Body = d.fnBody()
+	fn.ArgumentsRef = d.ref()
+	fn.OpenParenLoc = d.loc()
+	fn.IsAsync = r.ReadBool()
+	fn.IsGenerator = r.ReadBool()
+	fn.HasRestArg = r.ReadBool()
+	fn.HasIfScope = r.ReadBool()
+	fn.HasNoSideEffectsComment = r.ReadBool()
+	fn.IsUniqueFormalParameters = r.ReadBool()
+}
+
+func (e *encoder) fnBody(body FnBody) {
+	e.block(body.Block)
+	e.loc(body.Loc)
+}
+
+func (d *decoder) fnBody() FnBody {
+	return FnBody{Block: d.block(), Loc: d.loc()}
+}
+
+func (e *encoder) class(class *Class) {
+	w := e.w
+	e.decorators(class.Decorators)
+	e.optionalLocRef(class.Name)
+	e.expr(class.ExtendsOrNil)
+	e.properties(class.Properties)
+	e.rng(class.ClassKeyword)
+	e.loc(class.BodyLoc)
+	e.loc(class.CloseBraceLoc)
+	w.WriteBool(class.ShouldLowerStandardDecorators)
+	w.WriteBool(class.UseDefineForClassFields)
+}
+
+func (d *decoder) class(class *Class) {
+	r := d.r
+	class.Decorators = d.decorators()
+	class.Name = d.optionalLocRef()
+	class.ExtendsOrNil = d.expr()
+	class.Properties = d.properties()
+	class.ClassKeyword = d.rng()
+	class.BodyLoc = d.loc()
+	class.CloseBraceLoc = d.loc()
+	class.ShouldLowerStandardDecorators = r.ReadBool()
+	class.UseDefineForClassFields = r.ReadBool()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Bindings
+
+const (
+	bindingTagNil uint8 = iota
+	bindingTagMissing
+	bindingTagIdentifier
+	bindingTagArray
+	bindingTagObject
+)
+
+func (e *encoder) binding(binding Binding) {
+	w := e.w
+	switch b := binding.Data.(type) {
+	case nil:
+		w.WriteUint8(bindingTagNil)
+		e.loc(binding.Loc)
+
+	case *BMissing:
+		w.WriteUint8(bindingTagMissing)
+		e.loc(binding.Loc)
+
+	case *BIdentifier:
+		w.WriteUint8(bindingTagIdentifier)
+		e.loc(binding.Loc)
+		e.ref(b.Ref)
+
+	case *BArray:
+		w.WriteUint8(bindingTagArray)
+		e.loc(binding.Loc)
+		w.WriteNilableLength(len(b.Items), b.Items == nil)
+		for _, item := range b.Items {
+			e.binding(item.Binding)
+			e.expr(item.DefaultValueOrNil)
+			e.loc(item.Loc)
+		}
+		e.loc(b.CloseBracketLoc)
+		w.WriteBool(b.HasSpread)
+		w.WriteBool(b.IsSingleLine)
+
+	case *BObject:
+		w.WriteUint8(bindingTagObject)
+		e.loc(binding.Loc)
+		w.WriteNilableLength(len(b.Properties), b.Properties == nil)
+		for _, property := range b.Properties {
+			e.expr(property.Key)
+			e.binding(property.Value)
+			e.expr(property.DefaultValueOrNil)
+			e.loc(property.Loc)
+			e.loc(property.CloseBracketLoc)
+			w.WriteBool(property.IsComputed)
+			w.WriteBool(property.IsSpread)
+			w.WriteBool(property.PreferQuotedKey)
+		}
+		e.loc(b.CloseBraceLoc)
+		w.WriteBool(b.IsSingleLine)
+
+	default:
+		w.WriteUint8(bindingTagNil)
+		e.ok = false
+	}
+}
+
+func (d *decoder) binding() Binding {
+	r := d.r
+	tag := r.ReadUint8()
+	loc := d.loc()
+	if tag == bindingTagNil {
+		return Binding{Loc: loc}
+	}
+
+	switch tag {
+	case bindingTagMissing:
+		return Binding{Loc: loc, Data: BMissingShared}
+
+	case bindingTagIdentifier:
+		return Binding{Loc: loc, Data: &BIdentifier{Ref: d.ref()}}
+
+	case bindingTagArray:
+		b := &BArray{}
+		if n, isNil := r.ReadNilableLength(); !isNil {
+			b.Items = make([]ArrayBinding, n)
+			for i := range b.Items {
+				b.Items[i] = ArrayBinding{Binding: d.binding(), DefaultValueOrNil: d.expr(), Loc: d.loc()}
+			}
+		}
+		b.CloseBracketLoc = d.loc()
+		b.HasSpread = r.ReadBool()
+		b.IsSingleLine = r.ReadBool()
+		return Binding{Loc: loc, Data: b}
+
+	case bindingTagObject:
+		b := &BObject{}
+		if n, isNil := r.ReadNilableLength(); !isNil {
+			b.Properties = make([]PropertyBinding, n)
+			for i := range b.Properties {
+				b.Properties[i] = PropertyBinding{
+					Key:               d.expr(),
+					Value:             d.binding(),
+					DefaultValueOrNil: d.expr(),
+					Loc:               d.loc(),
+					CloseBracketLoc:   d.loc(),
+					IsComputed:        r.ReadBool(),
+					IsSpread:          r.ReadBool(),
+					PreferQuotedKey:   r.ReadBool(),
+				}
+			}
+		}
+		b.CloseBraceLoc = d.loc()
+		b.IsSingleLine = r.ReadBool()
+		return Binding{Loc: loc, Data: b}
+	}
+
+	r.Fail()
+	return Binding{}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Statements
+
+const (
+	stmtTagNil uint8 = iota
+	stmtTagBlock
+	stmtTagComment
+	stmtTagDebugger
+	stmtTagDirective
+	stmtTagEmpty
+	stmtTagTypeScript
+	stmtTagExportClause
+	stmtTagExportFrom
+	stmtTagExportDefault
+	stmtTagExportStar
+	stmtTagExportEquals
+	stmtTagLazyExport
+	stmtTagExpr
+	stmtTagEnum
+	stmtTagNamespace
+	stmtTagFunction
+	stmtTagClass
+	stmtTagLabel
+	stmtTagIf
+	stmtTagFor
+	stmtTagForIn
+	stmtTagForOf
+	stmtTagDoWhile
+	stmtTagWhile
+	stmtTagWith
+	stmtTagTry
+	stmtTagSwitch
+	stmtTagImport
+	stmtTagReturn
+	stmtTagThrow
+	stmtTagLocal
+	stmtTagBreak
+	stmtTagContinue
+)
+
+func (e *encoder) stmt(stmt Stmt) {
+	w := e.w
+	if stmt.Data == nil {
+		w.WriteUint8(stmtTagNil)
+		e.loc(stmt.Loc)
+		return
+	}
+
+	switch s := stmt.Data.(type) {
+	case *SBlock:
+		w.WriteUint8(stmtTagBlock)
+		e.loc(stmt.Loc)
+		e.block(*s)
+
+	case *SComment:
+		w.WriteUint8(stmtTagComment)
+		e.loc(stmt.Loc)
+		w.WriteString(s.Text)
+		w.WriteBool(s.IsLegalComment)
+
+	case *SDebugger:
+		w.WriteUint8(stmtTagDebugger)
+		e.loc(stmt.Loc)
+
+	case *SDirective:
+		w.WriteUint8(stmtTagDirective)
+		e.loc(stmt.Loc)
+		w.WriteUint16s(s.Value)
+		e.loc(s.LegacyOctalLoc)
+
+	case *SEmpty:
+		w.WriteUint8(stmtTagEmpty)
+		e.loc(stmt.Loc)
+
+	case *STypeScript:
+		w.WriteUint8(stmtTagTypeScript)
+		e.loc(stmt.Loc)
+		w.WriteBool(s.WasDeclareClass)
+
+	case *SExportClause:
+		w.WriteUint8(stmtTagExportClause)
+		e.loc(stmt.Loc)
+		e.clauseItems(s.Items)
+		w.WriteBool(s.IsSingleLine)
+
+	case *SExportFrom:
+		w.WriteUint8(stmtTagExportFrom)
+		e.loc(stmt.Loc)
+		e.clauseItems(s.Items)
+		e.ref(s.NamespaceRef)
+		w.WriteUvarint(uint64(s.ImportRecordIndex))
+		w.WriteBool(s.IsSingleLine)
+
+	case *SExportDefault:
+		w.WriteUint8(stmtTagExportDefault)
+		e.loc(stmt.Loc)
+		e.stmt(s.Value)
+		e.locRef(s.DefaultName)
+
+	case *SExportStar:
+		w.WriteUint8(stmtTagExportStar)
+		e.loc(stmt.Loc)
+		w.WriteBool(s.Alias != nil)
+		if s.Alias != nil {
+			w.WriteString(s.Alias.OriginalName)
+			e.loc(s.Alias.Loc)
+		}
+		e.ref(s.NamespaceRef)
+		w.WriteUvarint(uint64(s.ImportRecordIndex))
+
+	case *SExportEquals:
+		w.WriteUint8(stmtTagExportEquals)
+		e.loc(stmt.Loc)
+		e.expr(s.Value)
+
+	case *SLazyExport:
+		w.WriteUint8(stmtTagLazyExport)
+		e.loc(stmt.Loc)
+		e.expr(s.Value)
+
+	case *SExpr:
+		w.WriteUint8(stmtTagExpr)
+		e.loc(stmt.Loc)
+		e.expr(s.Value)
+		w.WriteBool(s.IsFromClassOrFnThatCanBeRemovedIfUnused)
+
+	case *SEnum:
+		w.WriteUint8(stmtTagEnum)
+		e.loc(stmt.Loc)
+		w.WriteNilableLength(len(s.Values), s.Values == nil)
+		for _, value := range s.Values {
+			e.expr(value.ValueOrNil)
+			w.WriteUint16s(value.Name)
+			e.ref(value.Ref)
+			e.loc(value.Loc)
+		}
+		e.locRef(s.Name)
+		e.ref(s.Arg)
+		w.WriteBool(s.IsExport)
+
+	case *SNamespace:
+		w.WriteUint8(stmtTagNamespace)
+		e.loc(stmt.Loc)
+		e.stmts(s.Stmts)
+		e.locRef(s.Name)
+		e.ref(s.Arg)
+		w.WriteBool(s.IsExport)
+
+	case *SFunction:
+		w.WriteUint8(stmtTagFunction)
+		e.loc(stmt.Loc)
+		e.fn(&s.Fn)
+		w.WriteBool(s.IsExport)
+
+	case *SClass:
+		w.WriteUint8(stmtTagClass)
+		e.loc(stmt.Loc)
+		e.class(&s.Class)
+		w.WriteBool(s.IsExport)
+
+	case *SLabel:
+		w.WriteUint8(stmtTagLabel)
+		e.loc(stmt.Loc)
+		e.stmt(s.Stmt)
+		e.locRef(s.Name)
+		w.WriteBool(s.IsSingleLineStmt)
+
+	case *SIf:
+		w.WriteUint8(stmtTagIf)
+		e.loc(stmt.Loc)
+		e.expr(s.Test)
+		e.stmt(s.Yes)
+		e.stmt(s.NoOrNil)
+		w.WriteBool(s.IsSingleLineYes)
+		w.WriteBool(s.IsSingleLineNo)
+
+	case *SFor:
+		w.WriteUint8(stmtTagFor)
+		e.loc(stmt.Loc)
+		e.stmt(s.InitOrNil)
+		e.expr(s.TestOrNil)
+		e.expr(s.UpdateOrNil)
+		e.stmt(s.Body)
+		w.WriteBool(s.IsSingleLineBody)
+		w.WriteBool(s.IsLoweredForAwait)
+
+	case *SForIn:
+		w.WriteUint8(stmtTagForIn)
+		e.loc(stmt.Loc)
+		e.stmt(s.Init)
+		e.expr(s.Value)
+		e.stmt(s.Body)
+		w.WriteBool(s.IsSingleLineBody)
+
+	case *SForOf:
+		w.WriteUint8(stmtTagForOf)
+		e.loc(stmt.Loc)
+		e.stmt(s.Init)
+		e.expr(s.Value)
+		e.stmt(s.Body)
+		e.rng(s.Await)
+		w.WriteBool(s.IsSingleLineBody)
+
+	case *SDoWhile:
+		w.WriteUint8(stmtTagDoWhile)
+		e.loc(stmt.Loc)
+		e.stmt(s.Body)
+		e.expr(s.Test)
+
+	case *SWhile:
+		w.WriteUint8(stmtTagWhile)
+		e.loc(stmt.Loc)
+		e.expr(s.Test)
+		e.stmt(s.Body)
+		w.WriteBool(s.IsSingleLineBody)
+
+	case *SWith:
+		w.WriteUint8(stmtTagWith)
+		e.loc(stmt.Loc)
+		e.expr(s.Value)
+		e.stmt(s.Body)
+		e.loc(s.BodyLoc)
+		w.WriteBool(s.IsSingleLineBody)
+
+	case *STry:
+		w.WriteUint8(stmtTagTry)
+		e.loc(stmt.Loc)
+		w.WriteBool(s.Catch != nil)
+		if s.Catch != nil {
+			e.binding(s.Catch.BindingOrNil)
+			e.block(s.Catch.Block)
+			e.loc(s.Catch.Loc)
+			e.loc(s.Catch.BlockLoc)
+		}
+		w.WriteBool(s.Finally != nil)
+		if s.Finally != nil {
+			e.block(s.Finally.Block)
+			e.loc(s.Finally.Loc)
+		}
+		e.block(s.Block)
+		e.loc(s.BlockLoc)
+
+	case *SSwitch:
+		w.WriteUint8(stmtTagSwitch)
+		e.loc(stmt.Loc)
+		e.expr(s.Test)
+		w.WriteNilableLength(len(s.Cases), s.Cases == nil)
+		for _, c := range s.Cases {
+			e.expr(c.ValueOrNil)
+			e.stmts(c.Body)
+			e.loc(c.Loc)
+		}
+		e.loc(s.BodyLoc)
+		e.loc(s.CloseBraceLoc)
+
+	case *SImport:
+		w.WriteUint8(stmtTagImport)
+		e.loc(stmt.Loc)
+		e.optionalLocRef(s.DefaultName)
+		w.WriteBool(s.Items != nil)
+		if s.Items != nil {
+			e.clauseItems(*s.Items)
+		}
+		w.WriteBool(s.StarNameLoc != nil)
+		if s.StarNameLoc != nil {
+			e.loc(*s.StarNameLoc)
+		}
+		e.ref(s.NamespaceRef)
+		w.WriteUvarint(uint64(s.ImportRecordIndex))
+		w.WriteBool(s.IsSingleLine)
+
+	case *SReturn:
+		w.WriteUint8(stmtTagReturn)
+		e.loc(stmt.Loc)
+		e.expr(s.ValueOrNil)
+
+	case *SThrow:
+		w.WriteUint8(stmtTagThrow)
+		e.loc(stmt.Loc)
+		e.expr(s.Value)
+
+	case *SLocal:
+		w.WriteUint8(stmtTagLocal)
+		e.loc(stmt.Loc)
+		w.WriteNilableLength(len(s.Decls), s.Decls == nil)
+		for _, decl := range s.Decls {
+			e.binding(decl.Binding)
+			e.expr(decl.ValueOrNil)
+		}
+		w.WriteUint8(uint8(s.Kind))
+		w.WriteBool(s.IsExport)
+		w.WriteBool(s.WasTSImportEquals)
+
+	case *SBreak:
+		w.WriteUint8(stmtTagBreak)
+		e.loc(stmt.Loc)
+		e.optionalLocRef(s.Label)
+
+	case *SContinue:
+		w.WriteUint8(stmtTagContinue)
+		e.loc(stmt.Loc)
+		e.optionalLocRef(s.Label)
+
+	default:
+		w.WriteUint8(stmtTagNil)
+		e.ok = false
+	}
+}
+
+func (d *decoder) stmt() Stmt {
+	r := d.r
+	tag := r.ReadUint8()
+	loc := d.loc()
+	if tag == stmtTagNil {
+		return Stmt{Loc: loc}
+	}
+
+	switch tag {
+	case stmtTagBlock:
+		s := d.block()
+		return Stmt{Loc: loc, Data: &s}
+
+	case stmtTagComment:
+		s := &SComment{Text: r.ReadString()}
+		s.IsLegalComment = r.ReadBool()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagDebugger:
+		return Stmt{Loc: loc, Data: SDebuggerShared}
+
+	case stmtTagDirective:
+		s := &SDirective{Value: r.ReadUint16s()}
+		s.LegacyOctalLoc = d.loc()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagEmpty:
+		return Stmt{Loc: loc, Data: SEmptyShared}
+
+	case stmtTagTypeScript:
+		if r.ReadBool() {
+			return Stmt{Loc: loc, Data: STypeScriptSharedWasDeclareClass}
+		}
+		return Stmt{Loc: loc, Data: STypeScriptShared}
+
+	case stmtTagExportClause:
+		s := &SExportClause{Items: d.clauseItems()}
+		s.IsSingleLine = r.ReadBool()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagExportFrom:
+		s := &SExportFrom{Items: d.clauseItems()}
+		s.NamespaceRef = d.ref()
+		s.ImportRecordIndex = d.uint32()
+		s.IsSingleLine = r.ReadBool()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagExportDefault:
+		s := &SExportDefault{Value: d.stmt()}
+		s.DefaultName = d.locRef()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagExportStar:
+		s := &SExportStar{}
+		if r.ReadBool() {
+			s.Alias = &ExportStarAlias{OriginalName: r.ReadString(), Loc: d.loc()}
+		}
+		s.NamespaceRef = d.ref()
+		s.ImportRecordIndex = d.uint32()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagExportEquals:
+		return Stmt{Loc: loc, Data: &SExportEquals{Value: d.expr()}}
+
+	case stmtTagLazyExport:
+		return Stmt{Loc: loc, Data: &SLazyExport{Value: d.expr()}}
+
+	case stmtTagExpr:
+		s := &SExpr{Value: d.expr()}
+		s.IsFromClassOrFnThatCanBeRemovedIfUnused = r.ReadBool()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagEnum:
+		s := &SEnum{}
+		if n, isNil := r.ReadNilableLength(); !isNil {
+			s.Values = make([]EnumValue, n)
+			for i := range s.Values {
+				s.Values[i] = EnumValue{ValueOrNil: d.expr(), Name: r.ReadUint16s(), Ref: d.ref(), Loc: d.loc()}
+			}
+		}
+		s.Name = d.locRef()
+		s.Arg = d.ref()
+		s.IsExport = r.ReadBool()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagNamespace:
+		s := &SNamespace{Stmts: d.stmts()}
+		s.Name = d.locRef()
+		s.Arg = d.ref()
+		s.IsExport = r.ReadBool()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagFunction:
+		s := &SFunction{}
+		d.fn(&s.Fn)
+		s.IsExport = r.ReadBool()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagClass:
+		s := &SClass{}
+		d.class(&s.Class)
+		s.IsExport = r.ReadBool()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagLabel:
+		s := &SLabel{Stmt: d.stmt()}
+		s.Name = d.locRef()
+		s.IsSingleLineStmt = r.ReadBool()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagIf:
+		s := &SIf{Test: d.expr()}
+		s.Yes = d.stmt()
+		s.NoOrNil = d.stmt()
+		s.IsSingleLineYes = r.ReadBool()
+		s.IsSingleLineNo = r.ReadBool()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagFor:
+		s := &SFor{InitOrNil: d.stmt()}
+		s.TestOrNil = d.expr()
+		s.UpdateOrNil = d.expr()
+		s.Body = d.stmt()
+		s.IsSingleLineBody = r.ReadBool()
+		s.IsLoweredForAwait = r.ReadBool()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagForIn:
+		s := &SForIn{Init: d.stmt()}
+		s.Value = d.expr()
+		s.Body = d.stmt()
+		s.IsSingleLineBody = r.ReadBool()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagForOf:
+		s := &SForOf{Init: d.stmt()}
+		s.Value = d.expr()
+		s.Body = d.stmt()
+		s.Await = d.rng()
+		s.IsSingleLineBody = r.ReadBool()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagDoWhile:
+		s := &SDoWhile{Body: d.stmt()}
+		s.Test = d.expr()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagWhile:
+		s := &SWhile{Test: d.expr()}
+		s.Body = d.stmt()
+		s.IsSingleLineBody = r.ReadBool()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagWith:
+		s := &SWith{Value: d.expr()}
+		s.Body = d.stmt()
+		s.BodyLoc = d.loc()
+		s.IsSingleLineBody = r.ReadBool()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagTry:
+		s := &STry{}
+		if r.ReadBool() {
+			s.Catch = &Catch{BindingOrNil: d.binding(), Block: d.block(), Loc: d.loc(), BlockLoc: d.loc()}
+		}
+		if r.ReadBool() {
+			s.Finally = &Finally{Block: d.block(), Loc: d.loc()}
+		}
+		s.Block = d.block()
+		s.BlockLoc = d.loc()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagSwitch:
+		s := &SSwitch{Test: d.expr()}
+		if n, isNil := r.ReadNilableLength(); !isNil {
+			s.Cases = make([]Case, n)
+			for i := range s.Cases {
+				s.Cases[i] = Case{ValueOrNil: d.expr(), Body: d.stmts(), Loc: d.loc()}
+			}
+		}
+		s.BodyLoc = d.loc()
+		s.CloseBraceLoc = d.loc()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagImport:
+		s := &SImport{DefaultName: d.optionalLocRef()}
+		if r.ReadBool() {
+			items := d.clauseItems()
+			s.Items = &items
+		}
+		if r.ReadBool() {
+			starNameLoc := d.loc()
+			s.StarNameLoc = &starNameLoc
+		}
+		s.NamespaceRef = d.ref()
+		s.ImportRecordIndex = d.uint32()
+		s.IsSingleLine = r.ReadBool()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagReturn:
+		return Stmt{Loc: loc, Data: &SReturn{ValueOrNil: d.expr()}}
+
+	case stmtTagThrow:
+		return Stmt{Loc: loc, Data: &SThrow{Value: d.expr()}}
+
+	case stmtTagLocal:
+		s := &SLocal{}
+		if n, isNil := r.ReadNilableLength(); !isNil {
+			s.Decls = make([]Decl, n)
+			for i := range s.Decls {
+				s.Decls[i] = Decl{Binding: d.binding(), ValueOrNil: d.expr()}
+			}
+		}
+		s.Kind = LocalKind(r.ReadUint8())
+		s.IsExport = r.ReadBool()
+		s.WasTSImportEquals = r.ReadBool()
+		return Stmt{Loc: loc, Data: s}
+
+	case stmtTagBreak:
+		return Stmt{Loc: loc, Data: &SBreak{Label: d.optionalLocRef()}}
+
+	case stmtTagContinue:
+		return Stmt{Loc: loc, Data: &SContinue{Label: d.optionalLocRef()}}
+	}
+
+	r.Fail()
+	return Stmt{}
+}
+
+func (e *encoder) stmts(stmts []Stmt) {
+	e.w.WriteNilableLength(len(stmts), stmts == nil)
+	for _, stmt := range stmts {
+		e.stmt(stmt)
+	}
+}
+
+func (d *decoder) stmts() []Stmt {
+	n, isNil := d.r.ReadNilableLength()
+	if isNil {
+		return nil
+	}
+	stmts := make([]Stmt, n)
+	for i := range stmts {
+		stmts[i] = d.stmt()
+	}
+	return stmts
+}
+
+func (e *encoder) block(block SBlock) {
+	e.stmts(block.Stmts)
+	e.loc(block.CloseBraceLoc)
+}
+
+func (d *decoder) block() SBlock {
+	return SBlock{Stmts: d.stmts(), CloseBraceLoc: d.loc()}
+}
+
+func (e *encoder) clauseItems(items []ClauseItem) {
+	w := e.w
+	w.WriteNilableLength(len(items), items == nil)
+	for _, item := range items {
+		w.WriteString(item.Alias)
+		w.WriteString(item.OriginalName)
+		e.loc(item.AliasLoc)
+		e.locRef(item.Name)
+	}
+}
+
+func (d *decoder) clauseItems() []ClauseItem {
+	r := d.r
+	n, isNil := r.ReadNilableLength()
+	if isNil {
+		return nil
+	}
+	items := make([]ClauseItem, n)
+	for i := range items {
+		items[i] = ClauseItem{Alias: r.ReadString(), OriginalName: r.ReadString(), AliasLoc: d.loc(), Name: d.locRef()}
+	}
+	return items
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Primitives
+
+func (e *encoder) loc(loc logger.Loc) {
+	e.w.WriteVarint(int64(loc.Start))
+}
+
+func (d *decoder) loc() logger.Loc {
+	return logger.Loc{Start: d.r.ReadInt32()}
+}
+
+func (e *encoder) rng(r logger.Range) {
+	e.loc(r.Loc)
+	e.w.WriteVarint(int64(r.Len))
+}
+
+func (d *decoder) rng() logger.Range {
+	return logger.Range{Loc: d.loc(), Len: d.r.ReadInt32()}
+}
+
+func (d *decoder) uint32() uint32 {
+	value := d.r.ReadUvarint()
+	if value > 0xFFFFFFFF {
+		d.r.Fail()
+		return 0
+	}
+	return uint32(value)
+}
+
+func (e *encoder) uint32s(values []uint32) {
+	e.w.WriteNilableLength(len(values), values == nil)
+	for _, value := range values {
+		e.w.WriteUvarint(uint64(value))
+	}
+}
+
+func (d *decoder) uint32s() []uint32 {
+	n, isNil := d.r.ReadNilableLength()
+	if isNil {
+		return nil
+	}
+	values := make([]uint32, n)
+	for i := range values {
+		values[i] = d.uint32()
+	}
+	return values
+}
+
+func (e *encoder) strings(values []string) {
+	e.w.WriteNilableLength(len(values), values == nil)
+	for _, value := range values {
+		e.w.WriteString(value)
+	}
+}
+
+func (d *decoder) strings() []string {
+	n, isNil := d.r.ReadNilableLength()
+	if isNil {
+		return nil
+	}
+	values := make([]string, n)
+	for i := range values {
+		values[i] = d.r.ReadString()
+	}
+	return values
+}
+
+const (
+	refTagInvalid uint8 = iota
+	refTagSameSource
+	refTagOtherSource
+)
+
+func (e *encoder) ref(ref ast.Ref) {
+	w := e.w
+	if ref == ast.InvalidRef {
+		w.WriteUint8(refTagInvalid)
+		return
+	}
+	if ref.SourceIndex == e.sourceIndex {
+		w.WriteUint8(refTagSameSource)
+	} else {
+		w.WriteUint8(refTagOtherSource)
+		w.WriteUvarint(uint64(ref.SourceIndex))
+	}
+	w.WriteUvarint(uint64(ref.InnerIndex))
+}
+
+func (d *decoder) ref() ast.Ref {
+	switch d.r.ReadUint8() {
+	case refTagInvalid:
+		return ast.InvalidRef
+	case refTagSameSource:
+		return ast.Ref{SourceIndex: d.sourceIndex, InnerIndex: d.uint32()}
+	case refTagOtherSource:
+		return ast.Ref{SourceIndex: d.uint32(), InnerIndex: d.uint32()}
+	}
+	d.r.Fail()
+	return ast.InvalidRef
+}
+
+func (e *encoder) sourceIndexOf(sourceIndex uint32) {
+	e.ref(ast.Ref{SourceIndex: sourceIndex})
+}
+
+func (d *decoder) sourceIndexOf() uint32 {
+	return d.ref().SourceIndex
+}
+
+func (e *encoder) locRef(locRef ast.LocRef) {
+	e.loc(locRef.Loc)
+	e.ref(locRef.Ref)
+}
+
+func (d *decoder) locRef() ast.LocRef {
+	return ast.LocRef{Loc: d.loc(), Ref: d.ref()}
+}
+
+func (e *encoder) optionalLocRef(locRef *ast.LocRef) {
+	e.w.WriteBool(locRef != nil)
+	if locRef != nil {
+		e.locRef(*locRef)
+	}
+}
+
+func (d *decoder) optionalLocRef() *ast.LocRef {
+	if d.r.ReadBool() {
+		locRef := d.locRef()
+		return &locRef
+	}
+	return nil
+}
+
+func (e *encoder) index32(index ast.Index32) {
+	if index.IsValid() {
+		e.w.WriteUvarint(uint64(index.GetIndex()) + 1)
+	} else {
+		e.w.WriteUvarint(0)
+	}
+}
+
+func (d *decoder) index32() ast.Index32 {
+	if value := d.uint32(); value != 0 {
+		return ast.MakeIndex32(value - 1)
+	}
+	return ast.Index32{}
+}
+
+func (e *encoder) path(path logger.Path) {
+	w := e.w
+	w.WriteString(path.Text)
+	w.WriteString(path.Namespace)
+	w.WriteString(path.IgnoredSuffix)
+	attrs := path.ImportAttributes.DecodeIntoArray()
+	w.WriteUvarint(uint64(len(attrs)))
+	for _, attr := range attrs {
+		w.WriteString(attr.Key)
+		w.WriteString(attr.Value)
+	}
+	w.WriteUint8(uint8(path.Flags))
+}
+
+func (d *decoder) path() (path logger.Path) {
+	r := d.r
+	path.Text = r.ReadString()
+	path.Namespace = r.ReadString()
+	path.IgnoredSuffix = r.ReadString()
+	if n := r.ReadLength(); n > 0 {
+		attrs := make(map[string]string, n)
+		for i := 0; i < n; i++ {
+			key := r.ReadString()
+			attrs[key] = r.ReadString()
+		}
+		path.ImportAttributes = logger.EncodeImportAttributes(attrs)
+	}
+	path.Flags = logger.PathFlags(r.ReadUint8())
+	return
+}
+
+// The source index of this source is written as-is since it refers to some
+// other file, not the file being encoded
+func (e *encoder) source(source *logger.Source) {
+	w := e.w
+	w.WriteString(source.PrettyPaths.Abs)
+	w.WriteString(source.PrettyPaths.Rel)
+	w.WriteString(source.IdentifierName)
+	w.WriteString(source.Contents)
+	e.path(source.KeyPath)
+	w.WriteUvarint(uint64(source.Index))
+}
+
+func (d *decoder) source() *logger.Source {
+	r := d.r
+	source := &logger.Source{}
+	source.PrettyPaths.Abs = r.ReadString()
+	source.PrettyPaths.Rel = r.ReadString()
+	source.IdentifierName = r.ReadString()
+	source.Contents = r.ReadString()
+	source.KeyPath = d.path()
+	source.Index = d.uint32()
+	return source
+}
+
+func sortRefs(refs []ast.Ref) []ast.Ref {
+	sort.Slice(refs, func(i int, j int) bool {
+		a, b := refs[i], refs[j]
+		return a.SourceIndex < b.SourceIndex || (a.SourceIndex == b.SourceIndex && a.InnerIndex < b.InnerIndex)
+	})
+	return refs
+}
+
+func sortedRefsForParts(m map[ast.Ref][]uint32) []ast.Ref {
+	refs := make([]ast.Ref, 0, len(m))
+	for ref := range m {
+		refs = append(refs, ref)
+	}
+	return sortRefs(refs)
+}
+
+func sortedRefsForEnums(m map[ast.Ref]map[string]TSEnumValue) []ast.Ref {
+	refs := make([]ast.Ref, 0, len(m))
+	for ref := range m {
+		refs = append(refs, ref)
+	}
+	return sortRefs(refs)
+}
+
+func sortedRefsForConstValues(m map[ast.Ref]ConstValue) []ast.Ref {
+	refs := make([]ast.Ref, 0, len(m))
+	for ref := range m {
+		refs = append(refs, ref)
+	}
+	return sortRefs(refs)
+}
+
+func sortedRefsForNamedImports(m map[ast.Ref]NamedImport) []ast.Ref {
+	refs := make([]ast.Ref, 0, len(m))
+	for ref := range m {
+		refs = append(refs, ref)
+	}
+	return sortRefs(refs)
+}
+
+func sortedRefsForSymbolUses(m map[ast.Ref]SymbolUse) []ast.Ref {
+	refs := make([]ast.Ref, 0, len(m))
+	for ref := range m {
+		refs = append(refs, ref)
+	}
+	return sortRefs(refs)
+}
+
+func sortedRefsForSymbolCallUses(m map[ast.Ref]SymbolCallUse) []ast.Ref {
+	refs := make([]ast.Ref, 0, len(m))
+	for ref := range m {
+		refs = append(refs, ref)
+	}
+	return sortRefs(refs)
+}
+
+func sortedRefsForPropertyUses(m map[ast.Ref]map[string]SymbolUse) []ast.Ref {
+	refs := make([]ast.Ref, 0, len(m))
+	for ref := range m {
+		refs = append(refs, ref)
+	}
+	return sortRefs(refs)
+}
+
+func sortedStringKeysForEnum(m map[string]TSEnumValue) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,6 +1,15 @@
 package js_ast
 
-import "testing"
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/ije/esbuild-internal/ast"
+	"github.com/ije/esbuild-internal/helpers"
+	"github.com/ije/esbuild-internal/logger"
+)
 
 func assertEqual(t *testing.T, a interface{}, b interface{}) {
 	if a != b {
@@ -21,3 +30,338 @@ func TestGenerateNonUniqueNameFromPath(t *testing.T) {
 	assertEqual(t, GenerateNonUniqueNameFromPath("123_invalid_identifier.js"), "invalid_identifier")
 	assertEqual(t, GenerateNonUniqueNameFromPath("emoji 🍕 name.js"), "emoji_name")
 }
+
+func TestEncodeExpr(t *testing.T) {
+	loc := func(start int32) logger.Loc { return logger.Loc{Start: start} }
+	str := func(start int32, text string) Expr {
+		return Expr{Loc: loc(start), Data: &EString{Value: helpers.StringToUTF16(text)}}
+	}
+	expr := Expr{Loc: loc(0), Data: &EObject{
+		Properties: []Property{
+			{Loc: loc(1), Kind: PropertyField, Key: str(1, "a"), ValueOrNil: Expr{Loc: loc(5), Data: &ENumber{Value: -1.5}}},
+			{Loc: loc(10), Kind: PropertyField, Flags: PropertyIsComputed, Key: str(10, "__proto__"), ValueOrNil: Expr{Loc: loc(23), Data: ENullShared}},
+			{Loc: loc(29), Kind: PropertyField, Key: str(29, "\U0001F355"), ValueOrNil: Expr{Loc: loc(35), Data: &EArray{
+				Items: []Expr{
+					{Loc: loc(36), Data: &EBoolean{Value: true}},
+					{Loc: loc(42), Data: &EBigInt{Value: "123"}},
+					str(47, ""),
+					{Loc: loc(48), Data: &EIdentifier{Ref: ast.Ref{SourceIndex: 1, InnerIndex: 2}}},
+					{Loc: loc(49), Data: &EIdentifier{Ref: ast.Ref{SourceIndex: 3, InnerIndex: 4}}},
+				},
+				CloseBracketLoc: loc(50),
+				IsSingleLine:    true,
+			}}},
+		},
+		CloseBraceLoc: loc(51),
+	}}
+
+	w := helpers.BinaryWriter{}
+	if !EncodeExpr(&w, expr, 1) {
+		t.Fatal("Failed to encode")
+	}
+	bytes := w.Bytes()
+	r := helpers.NewBinaryReader(bytes)
+	decoded := DecodeExpr(r, 1)
+	if r.Failed() || !r.IsAtEnd() {
+		t.Fatal("Failed to decode")
+	}
+	if !reflect.DeepEqual(decoded, expr) {
+		t.Fatalf("%#v != %#v", decoded, expr)
+	}
+
+	// References to symbols in the encoded file should follow the source index
+	r = helpers.NewBinaryReader(bytes)
+	items := DecodeExpr(r, 7).Data.(*EObject).Properties[2].ValueOrNil.Data.(*EArray).Items
+	assertEqual(t, items[3].Data.(*EIdentifier).Ref, ast.Ref{SourceIndex: 7, InnerIndex: 2})
+	assertEqual(t, items[4].Data.(*EIdentifier).Ref, ast.Ref{SourceIndex: 3, InnerIndex: 4})
+
+	// Truncated data must fail instead of panicking
+	for i := 0; i < len(bytes); i++ {
+		r := helpers.NewBinaryReader(bytes[:i])
+		DecodeExpr(r, 1)
+		if !r.Failed() {
+			t.Fatalf("Decoding %d of %d bytes did not fail", i, len(bytes))
+		}
+	}
+}
+
+// This fills in every field of a value with something non-zero so that the
+// encoding can be checked for missing fields. Fields of interface type cycle
+// through all of the implementations so that every node type is used.
+type astFiller struct {
+	impls   map[reflect.Type][]reflect.Type
+	used    map[reflect.Type]bool
+	next    map[reflect.Type]int
+	random  *rand.Rand
+	counter uint64
+}
+
+func (f *astFiller) fill(v reflect.Value, depth int) {
+	f.counter++
+
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(f.counter%2 == 0)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// Use values that don't fit in a byte to catch truncation
+		v.SetInt(int64(f.counter*0x101) - 1000)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(f.counter * 0x10101)
+
+	case reflect.Float64:
+		v.SetFloat(float64(f.counter) + 0.5)
+
+	case reflect.String:
+		v.SetString(fmt.Sprintf("s%d", f.counter))
+
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			f.fill(v.Index(i), depth)
+		}
+
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			// Parents must be in the scope tree, so they are filled in later
+			if field := v.Field(i); field.CanSet() && v.Type().Field(i).Name != "Parent" {
+				f.fill(field, depth)
+			}
+		}
+
+	case reflect.Ptr:
+		if depth > 0 {
+			v.Set(reflect.New(v.Type().Elem()))
+			f.fill(v.Elem(), depth-1)
+		}
+
+	case reflect.Slice:
+		// Use a mix of nil, empty, and non-empty slices
+		if depth > 0 {
+			if n := f.random.Intn(5); n > 0 {
+				v.Set(reflect.MakeSlice(v.Type(), n-1, n-1))
+				for i := 0; i < n-1; i++ {
+					f.fill(v.Index(i), depth-1)
+				}
+			}
+		}
+
+	case reflect.Map:
+		if depth > 0 {
+			if n := f.random.Intn(5); n > 0 {
+				v.Set(reflect.MakeMap(v.Type()))
+				for i := 0; i < n-1; i++ {
+					key := reflect.New(v.Type().Key()).Elem()
+					value := reflect.New(v.Type().Elem()).Elem()
+					f.fill(key, depth-1)
+					f.fill(value, depth-1)
+					v.SetMapIndex(key, value)
+				}
+			}
+		}
+
+	case reflect.Interface:
+		if depth > 0 {
+			impls := f.impls[v.Type()]
+			i := f.next[v.Type()]
+			f.next[v.Type()] = (i + 1) % len(impls)
+			f.used[impls[i]] = true
+			impl := reflect.New(impls[i])
+			f.fill(impl.Elem(), depth-1)
+			v.Set(impl)
+		}
+
+	default:
+		panic("Unexpected kind " + v.Kind().String())
+	}
+}
+
+func TestEncodeAST(t *testing.T) {
+	f := astFiller{
+		impls: map[reflect.Type][]reflect.Type{
+			reflect.TypeOf((*E)(nil)).Elem(): {
+				reflect.TypeOf(EArray{}), reflect.TypeOf(EUnary{}), reflect.TypeOf(EBinary{}), reflect.TypeOf(EBoolean{}),
+				reflect.TypeOf(ESuper{}), reflect.TypeOf(ENull{}), reflect.TypeOf(EUndefined{}), reflect.TypeOf(EThis{}),
+				reflect.TypeOf(ENew{}), reflect.TypeOf(ENewTarget{}), reflect.TypeOf(EImportMeta{}), reflect.TypeOf(ECall{}),
+				reflect.TypeOf(EDot{}), reflect.TypeOf(EIndex{}), reflect.TypeOf(EArrow{}), reflect.TypeOf(EFunction{}),
+				reflect.TypeOf(EClass{}), reflect.TypeOf(EIdentifier{}), reflect.TypeOf(EImportIdentifier{}),
+				reflect.TypeOf(EPrivateIdentifier{}), reflect.TypeOf(ENameOfSymbol{}), reflect.TypeOf(EJSXElement{}),
+				reflect.TypeOf(EJSXText{}), reflect.TypeOf(EMissing{}), reflect.TypeOf(ENumber{}), reflect.TypeOf(EBigInt{}),
+				reflect.TypeOf(EObject{}), reflect.TypeOf(ESpread{}), reflect.TypeOf(EString{}), reflect.TypeOf(ETemplate{}),
+				reflect.TypeOf(ERegExp{}), reflect.TypeOf(EInlinedEnum{}), reflect.TypeOf(EAnnotation{}), reflect.TypeOf(EAwait{}),
+				reflect.TypeOf(EYield{}), reflect.TypeOf(EIf{}), reflect.TypeOf(ERequireString{}),
+				reflect.TypeOf(ERequireResolveString{}), reflect.TypeOf(EImportString{}), reflect.TypeOf(EImportCall{}),
+			},
+			reflect.TypeOf((*S)(nil)).Elem(): {
+				reflect.TypeOf(SBlock{}), reflect.TypeOf(SComment{}), reflect.TypeOf(SDebugger{}), reflect.TypeOf(SDirective{}),
+				reflect.TypeOf(SEmpty{}), reflect.TypeOf(STypeScript{}), reflect.TypeOf(SExportClause{}),
+				reflect.TypeOf(SExportFrom{}), reflect.TypeOf(SExportDefault{}), reflect.TypeOf(SExportStar{}),
+				reflect.TypeOf(SExportEquals{}), reflect.TypeOf(SLazyExport{}), reflect.TypeOf(SExpr{}), reflect.TypeOf(SEnum{}),
+				reflect.TypeOf(SNamespace{}), reflect.TypeOf(SFunction{}), reflect.TypeOf(SClass{}), reflect.TypeOf(SLabel{}),
+				reflect.TypeOf(SIf{}), reflect.TypeOf(SFor{}), reflect.TypeOf(SForIn{}), reflect.TypeOf(SForOf{}),
+				reflect.TypeOf(SDoWhile{}), reflect.TypeOf(SWhile{}), reflect.TypeOf(SWith{}), reflect.TypeOf(STry{}),
+				reflect.TypeOf(SSwitch{}), reflect.TypeOf(SImport{}), reflect.TypeOf(SReturn{}), reflect.TypeOf(SThrow{}),
+				reflect.TypeOf(SLocal{}), reflect.TypeOf(SBreak{}), reflect.TypeOf(SContinue{}),
+			},
+			reflect.TypeOf((*B)(nil)).Elem(): {
+				reflect.TypeOf(BMissing{}), reflect.TypeOf(BIdentifier{}), reflect.TypeOf(BArray{}), reflect.TypeOf(BObject{}),
+			},
+			reflect.TypeOf((*TSNamespaceMemberData)(nil)).Elem(): {
+				reflect.TypeOf(TSNamespaceMemberProperty{}), reflect.TypeOf(TSNamespaceMemberNamespace{}),
+				reflect.TypeOf(TSNamespaceMemberEnumNumber{}), reflect.TypeOf(TSNamespaceMemberEnumString{}),
+			},
+		},
+		next:   make(map[reflect.Type]int),
+		random: rand.New(rand.NewSource(1)),
+	}
+
+	// Keep trying until a single tree uses everything
+	var tree AST
+	complete := func() bool {
+		for _, impls := range f.impls {
+			for _, impl := range impls {
+				if !f.used[impl] {
+					return false
+				}
+			}
+		}
+		return len(tree.Parts) > 0 && tree.ModuleScope != nil && len(tree.ImportRecords) > 0 && len(tree.Symbols) > 0
+	}
+	for i := 0; i < 100 && !complete(); i++ {
+		f.used = make(map[reflect.Type]bool)
+		tree = AST{}
+		f.fill(reflect.ValueOf(&tree).Elem(), 10)
+	}
+	if !complete() {
+		t.Fatal("Failed to generate a tree that uses everything")
+	}
+
+	// Newer node types are added directly instead of being listed above, since
+	// changing the list above changes which of the random trees is complete
+	urlString := &EURLString{}
+	f.fill(reflect.ValueOf(urlString).Elem(), 1)
+	tree.Parts[0].Stmts = append(tree.Parts[0].Stmts, Stmt{Loc: logger.Loc{Start: 1}, Data: &SExpr{Value: Expr{Loc: logger.Loc{Start: 2}, Data: urlString}}})
+
+	// Fill in things that the reflection above can't handle
+	var scopes []*Scope
+	var visit func(*Scope)
+	visit = func(scope *Scope) {
+		scopes = append(scopes, scope)
+		children := scope.Children[:0]
+		for _, child := range scope.Children {
+			if child != nil {
+				child.Parent = scope
+				children = append(children, child)
+				visit(child)
+			}
+		}
+		if scope.Children != nil {
+			scope.Children = children
+		}
+	}
+	visit(tree.ModuleScope)
+	for i := range tree.Parts {
+		tree.Parts[i].Scopes = scopes
+	}
+	tree.Symbols[0].ChunkIndex = ast.MakeIndex32(1)
+	tree.Symbols[0].NestedScopeSlot = ast.MakeIndex32(0)
+	tree.ImportRecords[0].SourceIndex = ast.MakeIndex32(2)
+	tree.ImportRecords[0].Path.ImportAttributes = logger.EncodeImportAttributes(map[string]string{"type": "json", "a": "b"})
+
+	w := helpers.BinaryWriter{}
+	if !EncodeAST(&w, tree, 5) {
+		t.Fatal("Failed to encode")
+	}
+	r := helpers.NewBinaryReader(w.Bytes())
+	decoded := DecodeAST(r, 5)
+	if r.Failed() || !r.IsAtEnd() {
+		t.Fatal("Failed to decode")
+	}
+	if !reflect.DeepEqual(decoded, tree) {
+		t.Fatal("The decoded tree is different")
+	}
+
+	// The encoding should be deterministic
+	w2 := helpers.BinaryWriter{}
+	EncodeAST(&w2, decoded, 5)
+	if string(w2.Bytes()) != string(w.Bytes()) {
+		t.Fatal("The encoding is not deterministic")
+	}
+
+	// Scopes in parts must be part of the scope tree
+	tree.Parts[0].Scopes = []*Scope{{}}
+	if EncodeAST(&helpers.BinaryWriter{}, tree, 5) {
+		t.Fatal("Encoding should have failed")
+	}
+}
+
+func TestVisitor(t *testing.T) {
+	id := func(inner uint32) Expr { return Expr{Data: &EIdentifier{Ref: ast.Ref{InnerIndex: inner}}} }
+	num := func(value float64) Expr { return Expr{Data: &ENumber{Value: value}} }
+
+	// function f(a = id0) { return [id1, ...id2] } if (id3) { id4 + 1 }
+	ret := &SReturn{ValueOrNil: Expr{Data: &EArray{Items: []Expr{id(1), {Data: &ESpread{Value: id(2)}}}}}}
+	stmts := []Stmt{
+		{Data: &SFunction{Fn: Fn{
+			Args: []Arg{{Binding: Binding{Data: &BIdentifier{}}, DefaultOrNil: id(0)}},
+			Body: FnBody{Block: SBlock{Stmts: []Stmt{{Data: ret}}}},
+		}}},
+		{Data: &SIf{Test: id(3), Yes: Stmt{Data: &SBlock{Stmts: []Stmt{
+			{Data: &SExpr{Value: Expr{Data: &EBinary{Op: BinOpAdd, Left: id(4), Right: num(1)}}}},
+		}}}}},
+	}
+
+	// Identifiers are visited in source order
+	var order string
+	v := Visitor{
+		EnterExpr: func(expr *Expr) bool {
+			if e, ok := expr.Data.(*EIdentifier); ok {
+				order += fmt.Sprintf("<%d", e.Ref.InnerIndex)
+			}
+			return true
+		},
+		ExitExpr: func(expr *Expr) {
+			if e, ok := expr.Data.(*EIdentifier); ok {
+				order += fmt.Sprintf(">%d", e.Ref.InnerIndex)
+			}
+		},
+	}
+	v.VisitStmts(stmts)
+	assertEqual(t, order, "<0>0<1>1<2>2<3>3<4>4")
+
+	// Returning false skips children, and nodes can be replaced in place
+	order = ""
+	v = Visitor{
+		EnterStmt: func(stmt *Stmt) bool {
+			_, ok := stmt.Data.(*SFunction)
+			return !ok
+		},
+		EnterExpr: func(expr *Expr) bool {
+			if e, ok := expr.Data.(*EIdentifier); ok {
+				order += fmt.Sprintf("%d", e.Ref.InnerIndex)
+				*expr = num(float64(e.Ref.InnerIndex))
+			}
+			return true
+		},
+	}
+	v.VisitStmts(stmts)
+	assertEqual(t, order, "34")
+	assertEqual(t, stmts[1].Data.(*SIf).Test.Data.(*ENumber).Value, 3.0)
+	if _, ok := ret.ValueOrNil.Data.(*EArray).Items[0].Data.(*EIdentifier); !ok {
+		t.Fatal("Expected the function body to be skipped")
+	}
+}
+
+func TestNewTopLevelSymbol(t *testing.T) {
+	tree := AST{
+		ModuleRef:   ast.Ref{SourceIndex: 2, InnerIndex: 0},
+		Symbols:     []ast.Symbol{{OriginalName: "module"}},
+		ModuleScope: &Scope{},
+	}
+	ref := tree.NewTopLevelSymbol(ast.SymbolOther, "foo")
+	assertEqual(t, ref, ast.Ref{SourceIndex: 2, InnerIndex: 1})
+	assertEqual(t, tree.Symbols[1].OriginalName, "foo")
+	assertEqual(t, tree.Symbols[1].Link, ast.InvalidRef)
+	assertEqual(t, len(tree.ModuleScope.Generated), 1)
+	assertEqual(t, tree.ModuleScope.Generated[0], ref)
+}
@@ -0,0 +1,328 @@
+package js_ast
+
+import (
+	"github.com/ije/esbuild-internal/ast"
+)
+
+// This walks a syntax tree in source order. Each callback is optional. The
+// callbacks are passed pointers into the tree so that nodes can be mutated or
+// replaced in place. Returning false from an "Enter" callback skips the
+// children of that node (the matching "Exit" callback is still called).
+//
+// Children are visited after the "Enter" callback returns, so a callback that
+// replaces a node will cause the replacement's children to be visited instead.
+type Visitor struct {
+	EnterStmt    func(stmt *Stmt) bool
+	ExitStmt     func(stmt *Stmt)
+	EnterExpr    func(expr *Expr) bool
+	ExitExpr     func(expr *Expr)
+	EnterBinding func(binding *Binding) bool
+	ExitBinding  func(binding *Binding)
+}
+
+func (v *Visitor) VisitAST(tree *AST) {
+	for i := range tree.Parts {
+		v.VisitStmts(tree.Parts[i].Stmts)
+	}
+}
+
+func (v *Visitor) VisitStmts(stmts []Stmt) {
+	for i := range stmts {
+		v.VisitStmt(&stmts[i])
+	}
+}
+
+func (v *Visitor) VisitExprs(exprs []Expr) {
+	for i := range exprs {
+		v.VisitExpr(&exprs[i])
+	}
+}
+
+func (v *Visitor) VisitStmt(stmt *Stmt) {
+	if stmt.Data == nil {
+		return
+	}
+	if v.EnterStmt == nil || v.EnterStmt(stmt) {
+		v.visitStmtChildren(stmt)
+	}
+	if v.ExitStmt != nil {
+		v.ExitStmt(stmt)
+	}
+}
+
+func (v *Visitor) VisitExpr(expr *Expr) {
+	if expr.Data == nil {
+		return
+	}
+	if v.EnterExpr == nil || v.EnterExpr(expr) {
+		v.visitExprChildren(expr)
+	}
+	if v.ExitExpr != nil {
+		v.ExitExpr(expr)
+	}
+}
+
+func (v *Visitor) VisitBinding(binding *Binding) {
+	if binding.Data == nil {
+		return
+	}
+	if v.EnterBinding == nil || v.EnterBinding(binding) {
+		v.visitBindingChildren(binding)
+	}
+	if v.ExitBinding != nil {
+		v.ExitBinding(binding)
+	}
+}
+
+func (v *Visitor) visitStmtChildren(stmt *Stmt) {
+	switch s := stmt.Data.(type) {
+	case *SBlock:
+		v.VisitStmts(s.Stmts)
+
+	case *SExportDefault:
+		v.VisitStmt(&s.Value)
+
+	case *SExportEquals:
+		v.VisitExpr(&s.Value)
+
+	case *SLazyExport:
+		v.VisitExpr(&s.Value)
+
+	case *SExpr:
+		v.VisitExpr(&s.Value)
+
+	case *SEnum:
+		for i := range s.Values {
+			v.VisitExpr(&s.Values[i].ValueOrNil)
+		}
+
+	case *SNamespace:
+		v.VisitStmts(s.Stmts)
+
+	case *SFunction:
+		v.visitFn(&s.Fn)
+
+	case *SClass:
+		v.visitClass(&s.Class)
+
+	case *SLabel:
+		v.VisitStmt(&s.Stmt)
+
+	case *SIf:
+		v.VisitExpr(&s.Test)
+		v.VisitStmt(&s.Yes)
+		v.VisitStmt(&s.NoOrNil)
+
+	case *SFor:
+		v.VisitStmt(&s.InitOrNil)
+		v.VisitExpr(&s.TestOrNil)
+		v.VisitExpr(&s.UpdateOrNil)
+		v.VisitStmt(&s.Body)
+
+	case *SForIn:
+		v.VisitStmt(&s.Init)
+		v.VisitExpr(&s.Value)
+		v.VisitStmt(&s.Body)
+
+	case *SForOf:
+		v.VisitStmt(&s.Init)
+		v.VisitExpr(&s.Value)
+		v.VisitStmt(&s.Body)
+
+	case *SDoWhile:
+		v.VisitStmt(&s.Body)
+		v.VisitExpr(&s.Test)
+
+	case *SWhile:
+		v.VisitExpr(&s.Test)
+		v.VisitStmt(&s.Body)
+
+	case *SWith:
+		v.VisitExpr(&s.Value)
+		v.VisitStmt(&s.Body)
+
+	case *STry:
+		v.VisitStmts(s.Block.Stmts)
+		if s.Catch != nil {
+			v.VisitBinding(&s.Catch.BindingOrNil)
+			v.VisitStmts(s.Catch.Block.Stmts)
+		}
+		if s.Finally != nil {
+			v.VisitStmts(s.Finally.Block.Stmts)
+		}
+
+	case *SSwitch:
+		v.VisitExpr(&s.Test)
+		for i := range s.Cases {
+			c := &s.Cases[i]
+			v.VisitExpr(&c.ValueOrNil)
+			v.VisitStmts(c.Body)
+		}
+
+	case *SReturn:
+		v.VisitExpr(&s.ValueOrNil)
+
+	case *SThrow:
+		v.VisitExpr(&s.Value)
+
+	case *SLocal:
+		for i := range s.Decls {
+			decl := &s.Decls[i]
+			v.VisitBinding(&decl.Binding)
+			v.VisitExpr(&decl.ValueOrNil)
+		}
+	}
+}
+
+func (v *Visitor) visitExprChildren(expr *Expr) {
+	switch e := expr.Data.(type) {
+	case *EArray:
+		v.VisitExprs(e.Items)
+
+	case *EUnary:
+		v.VisitExpr(&e.Value)
+
+	case *EBinary:
+		v.VisitExpr(&e.Left)
+		v.VisitExpr(&e.Right)
+
+	case *ENew:
+		v.VisitExpr(&e.Target)
+		v.VisitExprs(e.Args)
+
+	case *ECall:
+		v.VisitExpr(&e.Target)
+		v.VisitExprs(e.Args)
+
+	case *EDot:
+		v.VisitExpr(&e.Target)
+
+	case *EIndex:
+		v.VisitExpr(&e.Target)
+		v.VisitExpr(&e.Index)
+
+	case *EArrow:
+		v.visitArgs(e.Args)
+		v.VisitStmts(e.Body.Block.Stmts)
+
+	case *EFunction:
+		v.visitFn(&e.Fn)
+
+	case *EClass:
+		v.visitClass(&e.Class)
+
+	case *EJSXElement:
+		v.VisitExpr(&e.TagOrNil)
+		v.visitProperties(e.Properties)
+		v.VisitExprs(e.NullableChildren)
+
+	case *EObject:
+		v.visitProperties(e.Properties)
+
+	case *ESpread:
+		v.VisitExpr(&e.Value)
+
+	case *ETemplate:
+		v.VisitExpr(&e.TagOrNil)
+		for i := range e.Parts {
+			v.VisitExpr(&e.Parts[i].Value)
+		}
+
+	case *EInlinedEnum:
+		v.VisitExpr(&e.Value)
+
+	case *EAnnotation:
+		v.VisitExpr(&e.Value)
+
+	case *EAwait:
+		v.VisitExpr(&e.Value)
+
+	case *EYield:
+		v.VisitExpr(&e.ValueOrNil)
+
+	case *EIf:
+		v.VisitExpr(&e.Test)
+		v.VisitExpr(&e.Yes)
+		v.VisitExpr(&e.No)
+
+	case *EImportCall:
+		v.VisitExpr(&e.Expr)
+		v.VisitExpr(&e.OptionsOrNil)
+	}
+}
+
+func (v *Visitor) visitBindingChildren(binding *Binding) {
+	switch b := binding.Data.(type) {
+	case *BArray:
+		for i := range b.Items {
+			item := &b.Items[i]
+			v.VisitBinding(&item.Binding)
+			v.VisitExpr(&item.DefaultValueOrNil)
+		}
+
+	case *BObject:
+		for i := range b.Properties {
+			property := &b.Properties[i]
+			v.VisitExpr(&property.Key)
+			v.VisitBinding(&property.Value)
+			v.VisitExpr(&property.DefaultValueOrNil)
+		}
+	}
+}
+
+func (v *Visitor) visitFn(fn *Fn) {
+	v.visitArgs(fn.Args)
+	v.VisitStmts(fn.Body.Block.Stmts)
+}
+
+func (v *Visitor) visitArgs(args []Arg) {
+	for i := range args {
+		arg := &args[i]
+		v.visitDecorators(arg.Decorators)
+		v.VisitBinding(&arg.Binding)
+		v.VisitExpr(&arg.DefaultOrNil)
+	}
+}
+
+func (v *Visitor) visitClass(class *Class) {
+	v.visitDecorators(class.Decorators)
+	v.VisitExpr(&class.ExtendsOrNil)
+	v.visitProperties(class.Properties)
+}
+
+func (v *Visitor) visitProperties(properties []Property) {
+	for i := range properties {
+		property := &properties[i]
+		if property.ClassStaticBlock != nil {
+			v.VisitStmts(property.ClassStaticBlock.Block.Stmts)
+			continue
+		}
+		v.visitDecorators(property.Decorators)
+		v.VisitExpr(&property.Key)
+		v.VisitExpr(&property.ValueOrNil)
+		v.VisitExpr(&property.InitializerOrNil)
+	}
+}
+
+func (v *Visitor) visitDecorators(decorators []Decorator) {
+	for i := range decorators {
+		v.VisitExpr(&decorators[i].Value)
+	}
+}
+
+// This adds a new symbol to the module scope and returns a reference to it.
+// The symbol is treated like a compiler-generated one, so it will be renamed
+// if its name collides with another symbol. It's meant for code that edits a
+// syntax tree after parsing (e.g. to declare a new top-level variable).
+func (tree *AST) NewTopLevelSymbol(kind ast.SymbolKind, name string) ast.Ref {
+	ref := ast.Ref{SourceIndex: tree.ModuleRef.SourceIndex, InnerIndex: uint32(len(tree.Symbols))}
+	tree.Symbols = append(tree.Symbols, ast.Symbol{
+		Kind:         kind,
+		OriginalName: name,
+		Link:         ast.InvalidRef,
+	})
+	if tree.ModuleScope != nil {
+		tree.ModuleScope.Generated = append(tree.ModuleScope.Generated, ref)
+	}
+	return ref
+}
@@ -268,6 +268,7 @@ type Lexer struct {
 	current                         int
 	start                           int
 	end                             int
+	prevTokenEnd                    int
 	ApproximateNewlineCount         int
 	CouldBeBadArrowInTSX            int
 	BadArrowInTSXRange              logger.Range
@@ -371,6 +372,13 @@ func (lexer *Lexer) Range() logger.Range {
 	return logger.Range{Loc: logger.Loc{Start: int32(lexer.start)}, Len: int32(lexer.end - lexer.start)}
 }
 
+// This is the end of the token before the current one. It's used to find the
+// end of syntax that doesn't end in a token with a stored location, such as a
+// TypeScript type annotation that has been stripped from the AST.
+func (lexer *Lexer) PrevTokenEnd() int32 {
+	return int32(lexer.prevTokenEnd)
+}
+
 func (lexer *Lexer) Raw() string {
 	return lexer.source.Contents[lexer.start:lexer.end]
 }
@@ -667,6 +675,9 @@ func RangeOfIdentifier(source logger.Source, loc logger.Loc) logger.Range {
 				i += width2
 			}
 		}
+
+		// The identifier extends to the end of the file
+		return logger.Range{Loc: loc, Len: int32(i)}
 	}
 
 	// When minifying, this identifier may have originally been a string
@@ -701,6 +712,7 @@ func (lexer *Lexer) ExpectJSXElementChild(token T) {
 
 func (lexer *Lexer) NextJSXElementChild() {
 	lexer.HasNewlineBefore = false
+	lexer.prevTokenEnd = lexer.end
 	originalStart := lexer.end
 
 	for {
@@ -818,6 +830,7 @@ func (lexer *Lexer) ExpectInsideJSXElement(token T) {
 
 func (lexer *Lexer) NextInsideJSXElement() {
 	lexer.HasNewlineBefore = false
+	lexer.prevTokenEnd = lexer.end
 
 	for {
 		lexer.start = lexer.end
@@ -998,6 +1011,7 @@ func (lexer *Lexer) NextInsideJSXElement() {
 
 func (lexer *Lexer) Next() {
 	lexer.HasNewlineBefore = lexer.end == 0
+	lexer.prevTokenEnd = lexer.end
 	lexer.HasCommentBefore = 0
 	lexer.PrevTokenWasAwaitKeyword = false
 	lexer.LegalCommentsBeforeToken = lexer.LegalCommentsBeforeToken[:0]
@@ -2092,6 +2106,11 @@ func (lexer *Lexer) ScanRegExp() {
 	}
 }
 
+// This decodes XML entities such as "&amp;" without changing any whitespace
+func DecodeJSXEntities(text string) []uint16 {
+	return decodeJSXEntities([]uint16{}, text)
+}
+
 func decodeJSXEntities(decoded []uint16, text string) []uint16 {
 	i := 0
 
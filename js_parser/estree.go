@@ -0,0 +1,2009 @@
+package js_parser
+
+// This file converts the syntax tree from the parse pass into ESTree JSON
+// (https://github.com/estree/estree). The visit pass is not run because it
+// binds symbols and transforms code, after which the tree would no longer
+// match the source text. JSX uses the node types from the JSX extension
+// (https://github.com/facebook/jsx/blob/main/AST.md) and TypeScript-specific
+// syntax with a run-time effect (enums, namespaces, "import x =" and
+// "export =") uses the node types from typescript-estree. The TypeScript
+// parser skips over types instead of storing them, so types are not present
+// in the output.
+//
+// The esbuild AST doesn't store where most nodes end, so the parser records
+// a few extra ranges while producing an ESTree AST (see "estreeRanges").
+// Everything else is derived from locations in the AST and the source text.
+//
+// Offsets in the output are in UTF-16 code units, lines are 1-based, and
+// columns are 0-based UTF-16 code units, which matches what JavaScript tools
+// that consume ESTree expect.
+
+import (
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ije/esbuild-internal/ast"
+	"github.com/ije/esbuild-internal/helpers"
+	"github.com/ije/esbuild-internal/js_ast"
+	"github.com/ije/esbuild-internal/js_lexer"
+	"github.com/ije/esbuild-internal/logger"
+)
+
+type estreeRanges struct {
+	// Expressions that were parsed on their own, including any surrounding
+	// parentheses and trailing TypeScript syntax such as "as T"
+	exprs map[js_ast.Expr]logger.Range
+
+	// Statements including any trailing semicolon
+	stmts map[js_ast.Stmt]logger.Range
+
+	// Class elements including decorators and any trailing semicolon
+	properties map[logger.Loc]logger.Range
+}
+
+func (r *estreeRanges) recordExpr(expr js_ast.Expr, outer logger.Range) {
+	// A parenthesized expression is recorded once for each set of parentheses
+	if old, ok := r.exprs[expr]; ok {
+		end := outer.End()
+		if old.End() > end {
+			end = old.End()
+		}
+		if old.Loc.Start < outer.Loc.Start {
+			outer.Loc = old.Loc
+		}
+		outer.Len = end - outer.Loc.Start
+	}
+	r.exprs[expr] = outer
+}
+
+func ParseESTree(log logger.Log, source logger.Source, options Options) (result []byte, ok bool) {
+	ok = true
+	defer func() {
+		r := recover()
+		if _, isLexerPanic := r.(js_lexer.LexerPanic); isLexerPanic {
+			result = nil
+			ok = false
+		} else if r != nil {
+			panic(r)
+		}
+	}()
+
+	// Keep JSX text verbatim instead of converting it into string literals
+	options.jsx.Preserve = true
+
+	p := newParser(log, source, js_lexer.NewLexer(log, source, options.ts), &options)
+	p.estree = &estreeRanges{
+		exprs:      make(map[js_ast.Expr]logger.Range),
+		stmts:      make(map[js_ast.Stmt]logger.Range),
+		properties: make(map[logger.Loc]logger.Range),
+	}
+
+	// Skip a leading hashbang comment
+	if p.lexer.Token == js_lexer.THashbang {
+		p.lexer.Next()
+	}
+
+	// Allow top-level await
+	p.fnOrArrowDataParse.await = allowExpr
+	p.fnOrArrowDataParse.isTopLevel = true
+
+	stmts := p.parseStmtsUpTo(js_lexer.TEndOfFile, parseStmtOpts{
+		isModuleScope:          true,
+		allowDirectivePrologue: true,
+	})
+
+	c := estreeConverter{p: p, text: source.Contents}
+	sourceType := "script"
+	if p.esmImportStatementKeyword.Len > 0 || p.esmExportKeyword.Len > 0 || p.esmImportMeta.Len > 0 || p.topLevelAwaitKeyword.Len > 0 {
+		sourceType = "module"
+	}
+	program := newESTreeNode("Program", 0, int32(len(source.Contents)),
+		estreeField{"body", c.stmts(stmts)},
+		estreeField{"sourceType", sourceType},
+	)
+	result = printESTree(program, source.Contents)
+	return
+}
+
+type estreeNode struct {
+	kind   string
+	fields []estreeField
+	start  int32
+	end    int32
+
+	// This includes parentheses and TypeScript syntax that isn't in the AST.
+	// Parent nodes use this range instead of the range above.
+	outerStart int32
+	outerEnd   int32
+}
+
+// Field values are one of: "*estreeNode", "[]*estreeNode", "[]estreeField",
+// "string", "bool", "estreeJSON", or nil. Nil nodes become null.
+type estreeField struct {
+	key   string
+	value interface{}
+}
+
+// This is for field values that are already JSON, such as numbers
+type estreeJSON string
+
+func newESTreeNode(kind string, start int32, end int32, fields ...estreeField) *estreeNode {
+	return &estreeNode{kind: kind, fields: fields, start: start, end: end, outerStart: start, outerEnd: end}
+}
+
+type estreeConverter struct {
+	p    *parser
+	text string
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Source text helpers
+
+func (c *estreeConverter) charAt(i int32) byte {
+	if i >= 0 && int(i) < len(c.text) {
+		return c.text[i]
+	}
+	return 0
+}
+
+// Returns the index of the first character at or after "i" that isn't
+// whitespace or part of a comment
+func (c *estreeConverter) skipTrivia(i int32) int32 {
+	text := c.text
+	for int(i) < len(text) {
+		switch text[i] {
+		case ' ', '\t', '\n', '\r', '\v', '\f':
+			i++
+			continue
+
+		case '/':
+			if int(i)+1 < len(text) {
+				if text[i+1] == '/' {
+					i += 2
+					for int(i) < len(text) && text[i] != '\n' && text[i] != '\r' {
+						i++
+					}
+					continue
+				}
+				if text[i+1] == '*' {
+					if end := strings.Index(text[i+2:], "*/"); end >= 0 {
+						i += int32(end) + 4
+						continue
+					}
+				}
+			}
+
+		default:
+			if text[i] >= 0x80 {
+				if r, width := utf8.DecodeRuneInString(text[i:]); js_ast.IsWhitespace(r) || r == '\u2028' || r == '\u2029' {
+					i += int32(width)
+					continue
+				}
+			}
+		}
+		return i
+	}
+	return i
+}
+
+// Returns the index after the last character before "i" that isn't
+// whitespace or part of a block comment
+func (c *estreeConverter) skipTriviaBackward(i int32) int32 {
+	text := c.text
+	for i > 0 {
+		switch text[i-1] {
+		case ' ', '\t', '\n', '\r', '\v', '\f':
+			i--
+			continue
+
+		case '/':
+			if i > 1 && text[i-2] == '*' {
+				if start := strings.LastIndex(text[:i-2], "/*"); start >= 0 {
+					i = int32(start)
+					continue
+				}
+			}
+
+		default:
+			if text[i-1] >= 0x80 {
+				if r, width := utf8.DecodeLastRuneInString(text[:i]); js_ast.IsWhitespace(r) || r == '\u2028' || r == '\u2029' {
+					i -= int32(width)
+					continue
+				}
+			}
+		}
+		return i
+	}
+	return i
+}
+
+// Numeric literals such as "1e+5" aren't handled by "RangeOfNumber"
+func (c *estreeConverter) numberEnd(start int32) int32 {
+	text := c.text
+	i := start
+	isHex := strings.HasPrefix(text[start:], "0x") || strings.HasPrefix(text[start:], "0X")
+	for int(i) < len(text) {
+		ch := text[i]
+		if (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch == '.' || ch == '_' {
+			i++
+		} else if (ch == '+' || ch == '-') && !isHex && i > start && (text[i-1] == 'e' || text[i-1] == 'E') {
+			i++
+		} else {
+			break
+		}
+	}
+	return i
+}
+
+// Returns the end of the template literal text starting at "i", which is
+// the index of either the closing "`" or the "${" of the next substitution
+func (c *estreeConverter) templateTextEnd(i int32) int32 {
+	text := c.text
+	for int(i) < len(text) {
+		switch text[i] {
+		case '\\':
+			i += 2
+			continue
+		case '`':
+			return i
+		case '$':
+			if int(i)+1 < len(text) && text[i+1] == '{' {
+				return i
+			}
+		}
+		i++
+	}
+	return i
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Leaf nodes
+
+func (c *estreeConverter) name(ref ast.Ref) string {
+	// References to names that haven't been bound yet are stored in the ref
+	if (ref.SourceIndex & 0x80000000) != 0 {
+		return c.p.loadNameFromRef(ref)
+	}
+	return c.p.symbols[ref.InnerIndex].OriginalName
+}
+
+func (c *estreeConverter) identifier(loc logger.Loc, name string) *estreeNode {
+	r := js_lexer.RangeOfIdentifier(c.p.source, loc)
+	return newESTreeNode("Identifier", r.Loc.Start, r.End(), estreeField{"name", name})
+}
+
+func (c *estreeConverter) privateIdentifier(loc logger.Loc, ref ast.Ref) *estreeNode {
+	r := js_lexer.RangeOfIdentifier(c.p.source, loc)
+	return newESTreeNode("PrivateIdentifier", r.Loc.Start, r.End(), estreeField{"name", strings.TrimPrefix(c.name(ref), "#")})
+}
+
+func (c *estreeConverter) stringLiteral(loc logger.Loc, value string) *estreeNode {
+	r := c.p.source.RangeOfString(loc)
+	return newESTreeNode("Literal", r.Loc.Start, r.End(),
+		estreeField{"value", value},
+		estreeField{"raw", c.p.source.TextForRange(r)},
+	)
+}
+
+// Module export names and some other names can be either identifiers or
+// string literals. The AST doesn't say which, so look at the source text.
+func (c *estreeConverter) identifierOrString(loc logger.Loc, name string) *estreeNode {
+	if ch := c.charAt(loc.Start); ch == '"' || ch == '\'' {
+		return c.stringLiteral(loc, name)
+	}
+	return c.identifier(loc, name)
+}
+
+func (c *estreeConverter) keyword(kind string, start int32, length int32) *estreeNode {
+	return newESTreeNode(kind, start, start+length)
+}
+
+func estreeNumber(value float64) estreeJSON {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return "null"
+	}
+	return estreeJSON(strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// ESTree represents BigInt values in decimal without the "n" suffix
+func estreeBigInt(value string) string {
+	if i, ok := new(big.Int).SetString(value, 0); ok {
+		return i.String()
+	}
+	return value
+}
+
+func (c *estreeConverter) moduleSource(record *ast.ImportRecord) *estreeNode {
+	return newESTreeNode("Literal", record.Range.Loc.Start, record.Range.End(),
+		estreeField{"value", record.Path.Text},
+		estreeField{"raw", c.p.source.TextForRange(record.Range)},
+	)
+}
+
+func (c *estreeConverter) importAttributes(record *ast.ImportRecord) []*estreeNode {
+	attributes := []*estreeNode{}
+	if record.AssertOrWith != nil {
+		for _, entry := range record.AssertOrWith.Entries {
+			key := c.identifierOrString(entry.KeyLoc, helpers.UTF16ToString(entry.Key))
+			value := c.stringLiteral(entry.ValueLoc, helpers.UTF16ToString(entry.Value))
+			attributes = append(attributes, newESTreeNode("ImportAttribute", key.start, value.end,
+				estreeField{"key", key},
+				estreeField{"value", value},
+			))
+		}
+	}
+	return attributes
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Statements
+
+func (c *estreeConverter) stmts(stmts []js_ast.Stmt) []*estreeNode {
+	nodes := make([]*estreeNode, 0, len(stmts))
+	for _, stmt := range stmts {
+		if n := c.stmt(stmt); n != nil {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// This is for statements that must be present, such as the body of a loop
+func (c *estreeConverter) requiredStmt(stmt js_ast.Stmt) *estreeNode {
+	if n := c.stmt(stmt); n != nil {
+		return n
+	}
+	r := c.p.estree.stmts[stmt]
+	return newESTreeNode("EmptyStatement", r.Loc.Start, r.End())
+}
+
+func (c *estreeConverter) blockStatement(loc logger.Loc, block js_ast.SBlock) *estreeNode {
+	return newESTreeNode("BlockStatement", loc.Start, block.CloseBraceLoc.Start+1,
+		estreeField{"body", c.stmts(block.Stmts)})
+}
+
+func (c *estreeConverter) stmt(stmt js_ast.Stmt) *estreeNode {
+	var n *estreeNode
+	start := stmt.Loc.Start
+	isExport := false
+
+	switch s := stmt.Data.(type) {
+	case *js_ast.SComment, *js_ast.STypeScript:
+		return nil
+
+	case *js_ast.SBlock:
+		n = c.blockStatement(stmt.Loc, *s)
+
+	case *js_ast.SEmpty:
+		n = newESTreeNode("EmptyStatement", start, start+1)
+
+	case *js_ast.SDebugger:
+		n = newESTreeNode("DebuggerStatement", start, start+int32(len("debugger")))
+
+	case *js_ast.SDirective:
+		literal := c.stringLiteral(stmt.Loc, helpers.UTF16ToString(s.Value))
+		raw := c.text[literal.start+1 : literal.end-1]
+		end := literal.end
+		if semicolon := c.skipTrivia(end); c.charAt(semicolon) == ';' {
+			end = semicolon + 1
+		}
+		n = newESTreeNode("ExpressionStatement", start, end,
+			estreeField{"expression", literal},
+			estreeField{"directive", raw},
+		)
+
+	case *js_ast.SExpr:
+		value := c.expr(s.Value)
+		n = newESTreeNode("ExpressionStatement", value.outerStart, value.outerEnd,
+			estreeField{"expression", value})
+
+	case *js_ast.SReturn:
+		var argument *estreeNode
+		end := start + int32(len("return"))
+		if s.ValueOrNil.Data != nil {
+			argument = c.expr(s.ValueOrNil)
+			end = argument.outerEnd
+		}
+		n = newESTreeNode("ReturnStatement", start, end, estreeField{"argument", argument})
+
+	case *js_ast.SThrow:
+		argument := c.expr(s.Value)
+		n = newESTreeNode("ThrowStatement", start, argument.outerEnd, estreeField{"argument", argument})
+
+	case *js_ast.SBreak:
+		n = c.jump("BreakStatement", start, len("break"), s.Label)
+
+	case *js_ast.SContinue:
+		n = c.jump("ContinueStatement", start, len("continue"), s.Label)
+
+	case *js_ast.SLabel:
+		label := c.identifier(s.Name.Loc, c.name(s.Name.Ref))
+		body := c.requiredStmt(s.Stmt)
+		n = newESTreeNode("LabeledStatement", start, body.end,
+			estreeField{"label", label},
+			estreeField{"body", body},
+		)
+
+	case *js_ast.SIf:
+		test := c.expr(s.Test)
+		consequent := c.requiredStmt(s.Yes)
+		end := consequent.end
+		var alternate *estreeNode
+		if s.NoOrNil.Data != nil {
+			alternate = c.requiredStmt(s.NoOrNil)
+			end = alternate.end
+		}
+		n = newESTreeNode("IfStatement", start, end,
+			estreeField{"test", test},
+			estreeField{"consequent", consequent},
+			estreeField{"alternate", alternate},
+		)
+
+	case *js_ast.SFor:
+		var init, test, update *estreeNode
+		if s.InitOrNil.Data != nil {
+			init = c.forInit(s.InitOrNil, false)
+		}
+		if s.TestOrNil.Data != nil {
+			test = c.expr(s.TestOrNil)
+		}
+		if s.UpdateOrNil.Data != nil {
+			update = c.expr(s.UpdateOrNil)
+		}
+		body := c.requiredStmt(s.Body)
+		n = newESTreeNode("ForStatement", start, body.end,
+			estreeField{"init", init},
+			estreeField{"test", test},
+			estreeField{"update", update},
+			estreeField{"body", body},
+		)
+
+	case *js_ast.SForIn:
+		left := c.forInit(s.Init, true)
+		right := c.expr(s.Value)
+		body := c.requiredStmt(s.Body)
+		n = newESTreeNode("ForInStatement", start, body.end,
+			estreeField{"left", left},
+			estreeField{"right", right},
+			estreeField{"body", body},
+		)
+
+	case *js_ast.SForOf:
+		left := c.forInit(s.Init, true)
+		right := c.expr(s.Value)
+		body := c.requiredStmt(s.Body)
+		n = newESTreeNode("ForOfStatement", start, body.end,
+			estreeField{"await", s.Await.Len > 0},
+			estreeField{"left", left},
+			estreeField{"right", right},
+			estreeField{"body", body},
+		)
+
+	case *js_ast.SWhile:
+		test := c.expr(s.Test)
+		body := c.requiredStmt(s.Body)
+		n = newESTreeNode("WhileStatement", start, body.end,
+			estreeField{"test", test},
+			estreeField{"body", body},
+		)
+
+	case *js_ast.SDoWhile:
+		body := c.requiredStmt(s.Body)
+		test := c.expr(s.Test)
+		end := c.skipTrivia(test.outerEnd)
+		if c.charAt(end) == ')' {
+			end++
+		}
+		n = newESTreeNode("DoWhileStatement", start, end,
+			estreeField{"body", body},
+			estreeField{"test", test},
+		)
+
+	case *js_ast.SWith:
+		object := c.expr(s.Value)
+		body := c.requiredStmt(s.Body)
+		n = newESTreeNode("WithStatement", start, body.end,
+			estreeField{"object", object},
+			estreeField{"body", body},
+		)
+
+	case *js_ast.STry:
+		block := c.blockStatement(s.BlockLoc, s.Block)
+		end := block.end
+		var handler, finalizer *estreeNode
+		if s.Catch != nil {
+			var param *estreeNode
+			if s.Catch.BindingOrNil.Data != nil {
+				param = c.binding(s.Catch.BindingOrNil)
+			}
+			body := c.blockStatement(s.Catch.BlockLoc, s.Catch.Block)
+			handler = newESTreeNode("CatchClause", s.Catch.Loc.Start, body.end,
+				estreeField{"param", param},
+				estreeField{"body", body},
+			)
+			end = handler.end
+		}
+		if s.Finally != nil {
+			blockLoc := logger.Loc{Start: c.skipTrivia(s.Finally.Loc.Start + int32(len("finally")))}
+			finalizer = c.blockStatement(blockLoc, s.Finally.Block)
+			end = finalizer.end
+		}
+		n = newESTreeNode("TryStatement", start, end,
+			estreeField{"block", block},
+			estreeField{"handler", handler},
+			estreeField{"finalizer", finalizer},
+		)
+
+	case *js_ast.SSwitch:
+		discriminant := c.expr(s.Test)
+		cases := make([]*estreeNode, 0, len(s.Cases))
+		for _, item := range s.Cases {
+			var test *estreeNode
+			var colon int32
+			if item.ValueOrNil.Data != nil {
+				test = c.expr(item.ValueOrNil)
+				colon = c.skipTrivia(test.outerEnd)
+			} else {
+				colon = c.skipTrivia(item.Loc.Start + int32(len("default")))
+			}
+			consequent := c.stmts(item.Body)
+			end := colon + 1
+			if len(consequent) > 0 {
+				end = consequent[len(consequent)-1].end
+			}
+			cases = append(cases, newESTreeNode("SwitchCase", item.Loc.Start, end,
+				estreeField{"test", test},
+				estreeField{"consequent", consequent},
+			))
+		}
+		n = newESTreeNode("SwitchStatement", start, s.CloseBraceLoc.Start+1,
+			estreeField{"discriminant", discriminant},
+			estreeField{"cases", cases},
+		)
+
+	case *js_ast.SLocal:
+		if s.WasTSImportEquals {
+			n = c.tsImportEquals(start, s)
+		} else {
+			n = c.variableDeclaration(start, s)
+		}
+		isExport = s.IsExport
+
+	case *js_ast.SFunction:
+		n = c.function("FunctionDeclaration", start, &s.Fn, true)
+		isExport = s.IsExport
+
+	case *js_ast.SClass:
+		n = c.class("ClassDeclaration", start, &s.Class)
+		isExport = s.IsExport
+
+	case *js_ast.SImport:
+		n = c.importDeclaration(start, s)
+
+	case *js_ast.SExportClause:
+		specifiers := make([]*estreeNode, 0, len(s.Items))
+		for _, item := range s.Items {
+			specifiers = append(specifiers, c.exportSpecifier(item))
+		}
+		n = newESTreeNode("ExportNamedDeclaration", start, start,
+			estreeField{"declaration", nil},
+			estreeField{"specifiers", specifiers},
+			estreeField{"source", nil},
+			estreeField{"attributes", []*estreeNode{}},
+		)
+
+	case *js_ast.SExportFrom:
+		record := &c.p.importRecords[s.ImportRecordIndex]
+		specifiers := make([]*estreeNode, 0, len(s.Items))
+		for _, item := range s.Items {
+			specifiers = append(specifiers, c.exportSpecifier(item))
+		}
+		n = newESTreeNode("ExportNamedDeclaration", start, record.Range.End(),
+			estreeField{"declaration", nil},
+			estreeField{"specifiers", specifiers},
+			estreeField{"source", c.moduleSource(record)},
+			estreeField{"attributes", c.importAttributes(record)},
+		)
+
+	case *js_ast.SExportStar:
+		record := &c.p.importRecords[s.ImportRecordIndex]
+		var exported *estreeNode
+		if s.Alias != nil {
+			exported = c.identifierOrString(s.Alias.Loc, s.Alias.OriginalName)
+		}
+		n = newESTreeNode("ExportAllDeclaration", start, record.Range.End(),
+			estreeField{"exported", exported},
+			estreeField{"source", c.moduleSource(record)},
+			estreeField{"attributes", c.importAttributes(record)},
+		)
+
+	case *js_ast.SExportDefault:
+		// The declaration starts after the "export default" keywords
+		var declaration *estreeNode
+		declarationStart := c.skipTrivia(c.skipTrivia(start+int32(len("export"))) + int32(len("default")))
+		switch value := s.Value.Data.(type) {
+		case *js_ast.SExpr:
+			declaration = c.expr(value.Value)
+		case *js_ast.SFunction:
+			declaration = c.function("FunctionDeclaration", declarationStart, &value.Fn, true)
+		case *js_ast.SClass:
+			declaration = c.class("ClassDeclaration", declarationStart, &value.Class)
+		default:
+			panic("Internal error")
+		}
+		n = newESTreeNode("ExportDefaultDeclaration", start, declaration.outerEnd,
+			estreeField{"declaration", declaration})
+
+	case *js_ast.SExportEquals:
+		expression := c.expr(s.Value)
+		n = newESTreeNode("TSExportAssignment", start, expression.outerEnd,
+			estreeField{"expression", expression})
+
+	case *js_ast.SEnum:
+		n = c.tsEnum(start, s)
+		isExport = s.IsExport
+
+	case *js_ast.SNamespace:
+		end := start
+		if r, ok := c.p.estree.stmts[stmt]; ok {
+			end = r.End()
+		}
+		kind := "namespace"
+		if strings.HasPrefix(c.text[start:], "module") {
+			kind = "module"
+		}
+		n = c.tsModule(start, end, kind, s)
+		isExport = s.IsExport
+
+	default:
+		panic("Internal error")
+	}
+
+	// Use the range recorded by the parser, which includes the semicolon
+	if r, ok := c.p.estree.stmts[stmt]; ok {
+		if isExport {
+			n.end = r.End()
+			n.outerEnd = n.end
+		} else {
+			n.start = r.Loc.Start
+			n.end = r.End()
+			n.outerStart = n.start
+			n.outerEnd = n.end
+		}
+	}
+
+	if isExport {
+		// Some declarations such as "export async function" start at "export"
+		if strings.HasPrefix(c.text[n.start:], "export") {
+			n.start = c.skipTrivia(n.start + int32(len("export")))
+			n.outerStart = n.start
+		}
+		exportStart := n.start
+		if r, ok := c.p.estree.stmts[stmt]; ok {
+			exportStart = r.Loc.Start
+		}
+		n = newESTreeNode("ExportNamedDeclaration", exportStart, n.end,
+			estreeField{"declaration", n},
+			estreeField{"specifiers", []*estreeNode{}},
+			estreeField{"source", nil},
+			estreeField{"attributes", []*estreeNode{}},
+		)
+	}
+	return n
+}
+
+func (c *estreeConverter) jump(kind string, start int32, length int, labelOrNil *ast.LocRef) *estreeNode {
+	var label *estreeNode
+	end := start + int32(length)
+	if labelOrNil != nil {
+		label = c.identifier(labelOrNil.Loc, c.name(labelOrNil.Ref))
+		end = label.end
+	}
+	return newESTreeNode(kind, start, end, estreeField{"label", label})
+}
+
+func (c *estreeConverter) forInit(init js_ast.Stmt, isPattern bool) *estreeNode {
+	switch s := init.Data.(type) {
+	case *js_ast.SLocal:
+		return c.variableDeclaration(init.Loc.Start, s)
+	case *js_ast.SExpr:
+		if isPattern {
+			return c.pattern(s.Value)
+		}
+		return c.expr(s.Value)
+	}
+	panic("Internal error")
+}
+
+func (c *estreeConverter) variableDeclaration(start int32, s *js_ast.SLocal) *estreeNode {
+	var kind string
+	switch s.Kind {
+	case js_ast.LocalVar:
+		kind = "var"
+	case js_ast.LocalLet:
+		kind = "let"
+	case js_ast.LocalConst:
+		kind = "const"
+	case js_ast.LocalUsing:
+		kind = "using"
+	case js_ast.LocalAwaitUsing:
+		kind = "await using"
+	}
+	end := start + int32(len(kind))
+	declarations := make([]*estreeNode, 0, len(s.Decls))
+	for _, decl := range s.Decls {
+		id := c.binding(decl.Binding)
+		var init *estreeNode
+		declEnd := id.end
+		if decl.ValueOrNil.Data != nil {
+			init = c.expr(decl.ValueOrNil)
+			declEnd = init.outerEnd
+		}
+		declarations = append(declarations, newESTreeNode("VariableDeclarator", id.start, declEnd,
+			estreeField{"id", id},
+			estreeField{"init", init},
+		))
+		end = declEnd
+	}
+	return newESTreeNode("VariableDeclaration", start, end,
+		estreeField{"declarations", declarations},
+		estreeField{"kind", kind},
+	)
+}
+
+func (c *estreeConverter) importDeclaration(start int32, s *js_ast.SImport) *estreeNode {
+	record := &c.p.importRecords[s.ImportRecordIndex]
+	specifiers := []*estreeNode{}
+
+	if s.DefaultName != nil {
+		local := c.identifier(s.DefaultName.Loc, c.name(s.DefaultName.Ref))
+		specifiers = append(specifiers, newESTreeNode("ImportDefaultSpecifier", local.start, local.end,
+			estreeField{"local", local}))
+	}
+
+	if s.StarNameLoc != nil {
+		// The "*" is before the "as" keyword, which is before the name
+		local := c.identifier(*s.StarNameLoc, c.name(s.NamespaceRef))
+		star := c.skipTriviaBackward(c.skipTriviaBackward(local.start)-int32(len("as"))) - 1
+		specifiers = append(specifiers, newESTreeNode("ImportNamespaceSpecifier", star, local.end,
+			estreeField{"local", local}))
+	}
+
+	if s.Items != nil {
+		for _, item := range *s.Items {
+			imported := c.identifierOrString(item.AliasLoc, item.Alias)
+			local := c.identifier(item.Name.Loc, c.name(item.Name.Ref))
+			specifiers = append(specifiers, newESTreeNode("ImportSpecifier", imported.start, local.end,
+				estreeField{"imported", imported},
+				estreeField{"local", local},
+			))
+		}
+	}
+
+	return newESTreeNode("ImportDeclaration", start, record.Range.End(),
+		estreeField{"specifiers", specifiers},
+		estreeField{"source", c.moduleSource(record)},
+		estreeField{"attributes", c.importAttributes(record)},
+	)
+}
+
+func (c *estreeConverter) exportSpecifier(item js_ast.ClauseItem) *estreeNode {
+	local := c.identifierOrString(item.Name.Loc, item.OriginalName)
+	exported := c.identifierOrString(item.AliasLoc, item.Alias)
+	return newESTreeNode("ExportSpecifier", local.start, exported.end,
+		estreeField{"local", local},
+		estreeField{"exported", exported},
+	)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// TypeScript statements
+
+func (c *estreeConverter) tsImportEquals(start int32, s *js_ast.SLocal) *estreeNode {
+	decl := s.Decls[0]
+	id := c.binding(decl.Binding)
+	var moduleReference *estreeNode
+	if call, ok := decl.ValueOrNil.Data.(*js_ast.ECall); ok && len(call.Args) == 1 {
+		// "import x = require('y')"
+		expression := c.expr(call.Args[0])
+		moduleReference = newESTreeNode("TSExternalModuleReference", decl.ValueOrNil.Loc.Start, c.skipTrivia(expression.outerEnd)+1,
+			estreeField{"expression", expression})
+	} else {
+		// "import x = y.z"
+		moduleReference = c.tsEntityName(decl.ValueOrNil)
+	}
+	return newESTreeNode("TSImportEqualsDeclaration", start, moduleReference.end,
+		estreeField{"id", id},
+		estreeField{"moduleReference", moduleReference},
+		estreeField{"importKind", "value"},
+	)
+}
+
+func (c *estreeConverter) tsEntityName(expr js_ast.Expr) *estreeNode {
+	if e, ok := expr.Data.(*js_ast.EDot); ok {
+		left := c.tsEntityName(e.Target)
+		right := c.identifier(e.NameLoc, e.Name)
+		return newESTreeNode("TSQualifiedName", left.start, right.end,
+			estreeField{"left", left},
+			estreeField{"right", right},
+		)
+	}
+	return c.expr(expr)
+}
+
+func (c *estreeConverter) tsEnum(start int32, s *js_ast.SEnum) *estreeNode {
+	id := c.identifier(s.Name.Loc, c.name(s.Name.Ref))
+	end := id.end
+	members := make([]*estreeNode, 0, len(s.Values))
+	for _, value := range s.Values {
+		memberID := c.identifierOrString(value.Loc, helpers.UTF16ToString(value.Name))
+		var initializer *estreeNode
+		memberEnd := memberID.end
+		if value.ValueOrNil.Data != nil {
+			initializer = c.expr(value.ValueOrNil)
+			memberEnd = initializer.outerEnd
+		}
+		members = append(members, newESTreeNode("TSEnumMember", memberID.start, memberEnd,
+			estreeField{"id", memberID},
+			estreeField{"initializer", initializer},
+		))
+		end = memberEnd
+	}
+	return newESTreeNode("TSEnumDeclaration", start, end,
+		estreeField{"id", id},
+		estreeField{"const", strings.HasPrefix(c.text[start:], "const")},
+		estreeField{"declare", false},
+		estreeField{"members", members},
+	)
+}
+
+func (c *estreeConverter) tsModule(start int32, end int32, kind string, s *js_ast.SNamespace) *estreeNode {
+	id := c.identifier(s.Name.Loc, c.name(s.Name.Ref))
+	var body *estreeNode
+	after := c.skipTrivia(id.end)
+
+	if c.charAt(after) == '.' && len(s.Stmts) == 1 {
+		// "namespace a.b {}" is stored as nested namespaces
+		if inner, ok := s.Stmts[0].Data.(*js_ast.SNamespace); ok {
+			body = c.tsModule(inner.Name.Loc.Start, end, kind, inner)
+		}
+	}
+
+	if body == nil {
+		body = newESTreeNode("TSModuleBlock", after, end,
+			estreeField{"body", c.stmts(s.Stmts)})
+	}
+
+	return newESTreeNode("TSModuleDeclaration", start, end,
+		estreeField{"id", id},
+		estreeField{"body", body},
+		estreeField{"kind", kind},
+		estreeField{"declare", false},
+	)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Functions and classes
+
+func (c *estreeConverter) function(kind string, start int32, fn *js_ast.Fn, includeName bool) *estreeNode {
+	var id *estreeNode
+	if includeName && fn.Name != nil {
+		id = c.identifier(fn.Name.Loc, c.name(fn.Name.Ref))
+	}
+	params := c.params(fn.Args, fn.HasRestArg)
+	body := c.blockStatement(fn.Body.Loc, fn.Body.Block)
+	return newESTreeNode(kind, start, body.end,
+		estreeField{"id", id},
+		estreeField{"expression", false},
+		estreeField{"generator", fn.IsGenerator},
+		estreeField{"async", fn.IsAsync},
+		estreeField{"params", params},
+		estreeField{"body", body},
+	)
+}
+
+func (c *estreeConverter) params(args []js_ast.Arg, hasRestArg bool) []*estreeNode {
+	params := make([]*estreeNode, 0, len(args))
+	for i, arg := range args {
+		param := c.binding(arg.Binding)
+		if arg.DefaultOrNil.Data != nil {
+			right := c.expr(arg.DefaultOrNil)
+			param = newESTreeNode("AssignmentPattern", param.start, right.outerEnd,
+				estreeField{"left", param},
+				estreeField{"right", right},
+			)
+		}
+		if hasRestArg && i+1 == len(args) {
+			dots := c.skipTriviaBackward(param.start) - int32(len("..."))
+			param = newESTreeNode("RestElement", dots, param.end, estreeField{"argument", param})
+		}
+		if len(arg.Decorators) > 0 {
+			param.fields = append(param.fields, estreeField{"decorators", c.decorators(arg.Decorators)})
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+func (c *estreeConverter) decorators(decorators []js_ast.Decorator) []*estreeNode {
+	nodes := make([]*estreeNode, 0, len(decorators))
+	for _, decorator := range decorators {
+		expression := c.expr(decorator.Value)
+		nodes = append(nodes, newESTreeNode("Decorator", decorator.AtLoc.Start, expression.outerEnd,
+			estreeField{"expression", expression}))
+	}
+	return nodes
+}
+
+func (c *estreeConverter) class(kind string, start int32, class *js_ast.Class) *estreeNode {
+	if len(class.Decorators) > 0 && class.Decorators[0].AtLoc.Start < start {
+		start = class.Decorators[0].AtLoc.Start
+	}
+	var id, superClass *estreeNode
+	if class.Name != nil {
+		id = c.identifier(class.Name.Loc, c.name(class.Name.Ref))
+	}
+	if class.ExtendsOrNil.Data != nil {
+		superClass = c.expr(class.ExtendsOrNil)
+	}
+	elements := make([]*estreeNode, 0, len(class.Properties))
+	for _, property := range class.Properties {
+		if element := c.classElement(property); element != nil {
+			elements = append(elements, element)
+		}
+	}
+	body := newESTreeNode("ClassBody", class.BodyLoc.Start, class.CloseBraceLoc.Start+1,
+		estreeField{"body", elements})
+	return newESTreeNode(kind, start, body.end,
+		estreeField{"id", id},
+		estreeField{"superClass", superClass},
+		estreeField{"body", body},
+		estreeField{"decorators", c.decorators(class.Decorators)},
+	)
+}
+
+func (c *estreeConverter) propertyKey(key js_ast.Expr, isComputed bool) *estreeNode {
+	if !isComputed {
+		switch k := key.Data.(type) {
+		case *js_ast.EString:
+			return c.identifierOrString(key.Loc, helpers.UTF16ToString(k.Value))
+		case *js_ast.ENameOfSymbol:
+			return c.identifierOrString(key.Loc, c.name(k.Ref))
+		case *js_ast.EPrivateIdentifier:
+			return c.privateIdentifier(key.Loc, k.Ref)
+		}
+	}
+	return c.expr(key)
+}
+
+func (c *estreeConverter) classElement(property js_ast.Property) *estreeNode {
+	var n *estreeNode
+
+	switch property.Kind {
+	case js_ast.PropertyDeclareOrAbstract:
+		// These are TypeScript types
+		return nil
+
+	case js_ast.PropertyClassStaticBlock:
+		block := property.ClassStaticBlock
+		n = newESTreeNode("StaticBlock", property.Loc.Start, block.Block.CloseBraceLoc.Start+1,
+			estreeField{"body", c.stmts(block.Block.Stmts)})
+
+	case js_ast.PropertyMethod, js_ast.PropertyGetter, js_ast.PropertySetter:
+		isComputed := property.Flags.Has(js_ast.PropertyIsComputed)
+		isStatic := property.Flags.Has(js_ast.PropertyIsStatic)
+		key := c.propertyKey(property.Key, isComputed)
+		fn := &property.ValueOrNil.Data.(*js_ast.EFunction).Fn
+		value := c.function("FunctionExpression", fn.OpenParenLoc.Start, fn, false)
+		kind := "method"
+		if property.Kind == js_ast.PropertyGetter {
+			kind = "get"
+		} else if property.Kind == js_ast.PropertySetter {
+			kind = "set"
+		} else if str, ok := property.Key.Data.(*js_ast.EString); ok && !isComputed && !isStatic && helpers.UTF16EqualsString(str.Value, "constructor") {
+			kind = "constructor"
+		}
+		n = newESTreeNode("MethodDefinition", property.Loc.Start, value.end,
+			estreeField{"key", key},
+			estreeField{"value", value},
+			estreeField{"kind", kind},
+			estreeField{"computed", isComputed},
+			estreeField{"static", isStatic},
+			estreeField{"decorators", c.decorators(property.Decorators)},
+		)
+
+	default:
+		isComputed := property.Flags.Has(js_ast.PropertyIsComputed)
+		key := c.propertyKey(property.Key, isComputed)
+		end := key.outerEnd
+		if isComputed {
+			end = property.CloseBracketLoc.Start + 1
+		}
+		var value *estreeNode
+		if property.InitializerOrNil.Data != nil {
+			value = c.expr(property.InitializerOrNil)
+			end = value.outerEnd
+		}
+		kind := "PropertyDefinition"
+		if property.Kind == js_ast.PropertyAutoAccessor {
+			kind = "AccessorProperty"
+		}
+		n = newESTreeNode(kind, property.Loc.Start, end,
+			estreeField{"key", key},
+			estreeField{"value", value},
+			estreeField{"computed", isComputed},
+			estreeField{"static", property.Flags.Has(js_ast.PropertyIsStatic)},
+			estreeField{"decorators", c.decorators(property.Decorators)},
+		)
+	}
+
+	if r, ok := c.p.estree.properties[property.Loc]; ok {
+		n.start = r.Loc.Start
+		n.end = r.End()
+		n.outerStart = n.start
+		n.outerEnd = n.end
+	}
+	return n
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Bindings and patterns
+
+func (c *estreeConverter) binding(binding js_ast.Binding) *estreeNode {
+	switch b := binding.Data.(type) {
+	case *js_ast.BMissing:
+		return nil
+
+	case *js_ast.BIdentifier:
+		return c.identifier(binding.Loc, c.name(b.Ref))
+
+	case *js_ast.BArray:
+		elements := make([]*estreeNode, 0, len(b.Items))
+		for i, item := range b.Items {
+			element := c.binding(item.Binding)
+			if element != nil && item.DefaultValueOrNil.Data != nil {
+				right := c.expr(item.DefaultValueOrNil)
+				element = newESTreeNode("AssignmentPattern", element.start, right.outerEnd,
+					estreeField{"left", element},
+					estreeField{"right", right},
+				)
+			}
+			if b.HasSpread && i+1 == len(b.Items) {
+				element = newESTreeNode("RestElement", item.Loc.Start, element.end, estreeField{"argument", element})
+			}
+			elements = append(elements, element)
+		}
+		return newESTreeNode("ArrayPattern", binding.Loc.Start, b.CloseBracketLoc.Start+1,
+			estreeField{"elements", elements})
+
+	case *js_ast.BObject:
+		properties := make([]*estreeNode, 0, len(b.Properties))
+		for _, property := range b.Properties {
+			value := c.binding(property.Value)
+			if property.IsSpread {
+				properties = append(properties, newESTreeNode("RestElement", property.Loc.Start, value.end,
+					estreeField{"argument", value}))
+				continue
+			}
+			key := c.propertyKey(property.Key, property.IsComputed)
+			_, isIdentifier := property.Value.Data.(*js_ast.BIdentifier)
+			_, isString := property.Key.Data.(*js_ast.EString)
+			isShorthand := !property.IsComputed && isString && isIdentifier && property.Value.Loc == property.Key.Loc
+			if property.DefaultValueOrNil.Data != nil {
+				right := c.expr(property.DefaultValueOrNil)
+				value = newESTreeNode("AssignmentPattern", value.start, right.outerEnd,
+					estreeField{"left", value},
+					estreeField{"right", right},
+				)
+			}
+			properties = append(properties, c.property(property.Loc.Start, value.end, key, value, "init", false, isShorthand, property.IsComputed))
+		}
+		return newESTreeNode("ObjectPattern", binding.Loc.Start, b.CloseBraceLoc.Start+1,
+			estreeField{"properties", properties})
+	}
+
+	panic("Internal error")
+}
+
+func (c *estreeConverter) property(start int32, end int32, key *estreeNode, value *estreeNode, kind string, isMethod bool, isShorthand bool, isComputed bool) *estreeNode {
+	return newESTreeNode("Property", start, end,
+		estreeField{"method", isMethod},
+		estreeField{"shorthand", isShorthand},
+		estreeField{"computed", isComputed},
+		estreeField{"key", key},
+		estreeField{"value", value},
+		estreeField{"kind", kind},
+	)
+}
+
+// Destructuring assignments are parsed as expressions
+func (c *estreeConverter) pattern(expr js_ast.Expr) *estreeNode {
+	var n *estreeNode
+
+	switch e := expr.Data.(type) {
+	case *js_ast.EArray:
+		elements := make([]*estreeNode, 0, len(e.Items))
+		for _, item := range e.Items {
+			var element *estreeNode
+			switch i := item.Data.(type) {
+			case *js_ast.EMissing:
+			case *js_ast.ESpread:
+				argument := c.pattern(i.Value)
+				element = newESTreeNode("RestElement", item.Loc.Start, argument.outerEnd, estreeField{"argument", argument})
+			default:
+				element = c.pattern(item)
+			}
+			elements = append(elements, element)
+		}
+		n = newESTreeNode("ArrayPattern", expr.Loc.Start, e.CloseBracketLoc.Start+1,
+			estreeField{"elements", elements})
+
+	case *js_ast.EObject:
+		properties := make([]*estreeNode, 0, len(e.Properties))
+		for _, property := range e.Properties {
+			if property.Kind == js_ast.PropertySpread {
+				argument := c.pattern(property.ValueOrNil)
+				properties = append(properties, newESTreeNode("RestElement", property.Loc.Start, argument.outerEnd,
+					estreeField{"argument", argument}))
+				continue
+			}
+			isComputed := property.Flags.Has(js_ast.PropertyIsComputed)
+			key := c.propertyKey(property.Key, isComputed)
+			value := c.pattern(property.ValueOrNil)
+			if property.InitializerOrNil.Data != nil {
+				right := c.expr(property.InitializerOrNil)
+				value = newESTreeNode("AssignmentPattern", value.outerStart, right.outerEnd,
+					estreeField{"left", value},
+					estreeField{"right", right},
+				)
+			}
+			properties = append(properties, c.property(property.Loc.Start, value.outerEnd, key, value, "init",
+				false, property.Flags.Has(js_ast.PropertyWasShorthand), isComputed))
+		}
+		n = newESTreeNode("ObjectPattern", expr.Loc.Start, e.CloseBraceLoc.Start+1,
+			estreeField{"properties", properties})
+
+	case *js_ast.EBinary:
+		if e.Op != js_ast.BinOpAssign {
+			return c.expr(expr)
+		}
+		left := c.pattern(e.Left)
+		right := c.expr(e.Right)
+		n = newESTreeNode("AssignmentPattern", left.outerStart, right.outerEnd,
+			estreeField{"left", left},
+			estreeField{"right", right},
+		)
+
+	default:
+		return c.expr(expr)
+	}
+
+	c.applyOuterRange(expr, n)
+	return n
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Expressions
+
+func (c *estreeConverter) applyOuterRange(expr js_ast.Expr, n *estreeNode) {
+	if r, ok := c.p.estree.exprs[expr]; ok {
+		if r.Loc.Start < n.outerStart {
+			n.outerStart = r.Loc.Start
+		}
+		if end := r.End(); end > n.outerEnd {
+			n.outerEnd = end
+		}
+	}
+}
+
+// Returns true if this expression was parsed on its own instead of as part of
+// its parent. Optional chains and comma operators don't continue across this.
+func (c *estreeConverter) isParsedSeparately(expr js_ast.Expr) bool {
+	_, ok := c.p.estree.exprs[expr]
+	return ok
+}
+
+func (c *estreeConverter) exprs(exprs []js_ast.Expr) []*estreeNode {
+	nodes := make([]*estreeNode, 0, len(exprs))
+	for _, expr := range exprs {
+		nodes = append(nodes, c.expr(expr))
+	}
+	return nodes
+}
+
+func (c *estreeConverter) expr(expr js_ast.Expr) *estreeNode {
+	return c.exprInChain(expr, false)
+}
+
+// The child of an optional chain node is part of the same chain if it's
+// also an optional chain node. The "ChainExpression" node goes around the
+// outermost node of the chain.
+func (c *estreeConverter) chainChild(expr js_ast.Expr, chain js_ast.OptionalChain) *estreeNode {
+	return c.exprInChain(expr, chain != js_ast.OptionalChainNone && !c.isParsedSeparately(expr))
+}
+
+func (c *estreeConverter) exprInChain(expr js_ast.Expr, isInChain bool) *estreeNode {
+	var n *estreeNode
+	start := expr.Loc.Start
+	chain := js_ast.OptionalChainNone
+
+	switch e := expr.Data.(type) {
+	case *js_ast.EArray:
+		elements := make([]*estreeNode, 0, len(e.Items))
+		for _, item := range e.Items {
+			if _, ok := item.Data.(*js_ast.EMissing); ok {
+				elements = append(elements, nil)
+			} else {
+				elements = append(elements, c.expr(item))
+			}
+		}
+		n = newESTreeNode("ArrayExpression", start, e.CloseBracketLoc.Start+1,
+			estreeField{"elements", elements})
+
+	case *js_ast.EObject:
+		properties := make([]*estreeNode, 0, len(e.Properties))
+		for _, property := range e.Properties {
+			properties = append(properties, c.objectProperty(property))
+		}
+		n = newESTreeNode("ObjectExpression", start, e.CloseBraceLoc.Start+1,
+			estreeField{"properties", properties})
+
+	case *js_ast.EUnary:
+		if e.Op.UnaryAssignTarget() == js_ast.AssignTargetUpdate {
+			argument := c.expr(e.Value)
+			isPrefix := e.Op.IsPrefix()
+			end := argument.outerEnd
+			if isPrefix {
+				start = expr.Loc.Start
+			} else {
+				start = argument.outerStart
+				end = c.skipTrivia(end) + 2
+			}
+			n = newESTreeNode("UpdateExpression", start, end,
+				estreeField{"operator", js_ast.OpTable[e.Op].Text},
+				estreeField{"prefix", isPrefix},
+				estreeField{"argument", argument},
+			)
+		} else {
+			argument := c.expr(e.Value)
+			n = newESTreeNode("UnaryExpression", start, argument.outerEnd,
+				estreeField{"operator", js_ast.OpTable[e.Op].Text},
+				estreeField{"prefix", true},
+				estreeField{"argument", argument},
+			)
+		}
+
+	case *js_ast.EBinary:
+		n = c.binary(expr, e)
+
+	case *js_ast.EBoolean:
+		raw := "false"
+		if e.Value {
+			raw = "true"
+		}
+		n = newESTreeNode("Literal", start, start+int32(len(raw)),
+			estreeField{"value", e.Value},
+			estreeField{"raw", raw},
+		)
+
+	case *js_ast.ENull:
+		n = newESTreeNode("Literal", start, start+int32(len("null")),
+			estreeField{"value", nil},
+			estreeField{"raw", "null"},
+		)
+
+	case *js_ast.EUndefined:
+		n = c.identifier(expr.Loc, "undefined")
+
+	case *js_ast.ESuper:
+		n = c.keyword("Super", start, int32(len("super")))
+
+	case *js_ast.EThis:
+		n = c.keyword("ThisExpression", start, int32(len("this")))
+
+	case *js_ast.ENewTarget:
+		end := e.Range.End()
+		n = newESTreeNode("MetaProperty", start, end,
+			estreeField{"meta", newESTreeNode("Identifier", start, start+int32(len("new")), estreeField{"name", "new"})},
+			estreeField{"property", newESTreeNode("Identifier", end-int32(len("target")), end, estreeField{"name", "target"})},
+		)
+
+	case *js_ast.EImportMeta:
+		end := start + e.RangeLen
+		n = newESTreeNode("MetaProperty", start, end,
+			estreeField{"meta", newESTreeNode("Identifier", start, start+int32(len("import")), estreeField{"name", "import"})},
+			estreeField{"property", newESTreeNode("Identifier", end-int32(len("meta")), end, estreeField{"name", "meta"})},
+		)
+
+	case *js_ast.ENew:
+		callee := c.expr(e.Target)
+		end := callee.outerEnd
+		if e.CloseParenLoc.Start >= end {
+			end = e.CloseParenLoc.Start + 1
+		}
+		n = newESTreeNode("NewExpression", start, end,
+			estreeField{"callee", callee},
+			estreeField{"arguments", c.exprs(e.Args)},
+		)
+
+	case *js_ast.ECall:
+		callee := c.chainChild(e.Target, e.OptionalChain)
+		chain = e.OptionalChain
+		n = newESTreeNode("CallExpression", callee.outerStart, e.CloseParenLoc.Start+1,
+			estreeField{"callee", callee},
+			estreeField{"arguments", c.exprs(e.Args)},
+			estreeField{"optional", e.OptionalChain == js_ast.OptionalChainStart},
+		)
+
+	case *js_ast.EDot:
+		object := c.chainChild(e.Target, e.OptionalChain)
+		property := c.identifier(e.NameLoc, e.Name)
+		chain = e.OptionalChain
+		n = newESTreeNode("MemberExpression", object.outerStart, property.end,
+			estreeField{"object", object},
+			estreeField{"property", property},
+			estreeField{"computed", false},
+			estreeField{"optional", e.OptionalChain == js_ast.OptionalChainStart},
+		)
+
+	case *js_ast.EIndex:
+		object := c.chainChild(e.Target, e.OptionalChain)
+		chain = e.OptionalChain
+		var property *estreeNode
+		var end int32
+		isComputed := true
+		if private, ok := e.Index.Data.(*js_ast.EPrivateIdentifier); ok {
+			property = c.privateIdentifier(e.Index.Loc, private.Ref)
+			end = property.end
+			isComputed = false
+		} else {
+			property = c.expr(e.Index)
+			end = e.CloseBracketLoc.Start + 1
+		}
+		n = newESTreeNode("MemberExpression", object.outerStart, end,
+			estreeField{"object", object},
+			estreeField{"property", property},
+			estreeField{"computed", isComputed},
+			estreeField{"optional", e.OptionalChain == js_ast.OptionalChainStart},
+		)
+
+	case *js_ast.EArrow:
+		params := c.params(e.Args, e.HasRestArg)
+		var body *estreeNode
+		var end int32
+		if e.PreferExpr {
+			body = c.expr(e.Body.Block.Stmts[0].Data.(*js_ast.SReturn).ValueOrNil)
+			end = body.outerEnd
+		} else {
+			body = c.blockStatement(e.Body.Loc, e.Body.Block)
+			end = body.end
+		}
+		n = newESTreeNode("ArrowFunctionExpression", start, end,
+			estreeField{"id", nil},
+			estreeField{"expression", e.PreferExpr},
+			estreeField{"generator", false},
+			estreeField{"async", e.IsAsync},
+			estreeField{"params", params},
+			estreeField{"body", body},
+		)
+
+	case *js_ast.EFunction:
+		n = c.function("FunctionExpression", start, &e.Fn, true)
+
+	case *js_ast.EClass:
+		n = c.class("ClassExpression", start, &e.Class)
+
+	case *js_ast.EIdentifier:
+		n = c.identifier(expr.Loc, c.name(e.Ref))
+
+	case *js_ast.EPrivateIdentifier:
+		n = c.privateIdentifier(expr.Loc, e.Ref)
+
+	case *js_ast.ENameOfSymbol:
+		n = c.identifierOrString(expr.Loc, c.name(e.Ref))
+
+	case *js_ast.EJSXElement:
+		n = c.jsxElement(expr.Loc, e)
+
+	case *js_ast.ENumber:
+		end := c.numberEnd(start)
+		n = newESTreeNode("Literal", start, end,
+			estreeField{"value", estreeNumber(e.Value)},
+			estreeField{"raw", c.text[start:end]},
+		)
+
+	case *js_ast.EBigInt:
+		end := c.numberEnd(start)
+		n = newESTreeNode("Literal", start, end,
+			estreeField{"value", nil},
+			estreeField{"raw", c.text[start:end]},
+			estreeField{"bigint", estreeBigInt(e.Value)},
+		)
+
+	case *js_ast.EString:
+		if c.charAt(start) == '`' {
+			end := c.templateTextEnd(start + 1)
+			quasi := c.templateElement(start+1, end, e.Value, true, false)
+			n = newESTreeNode("TemplateLiteral", start, end+1,
+				estreeField{"quasis", []*estreeNode{quasi}},
+				estreeField{"expressions", []*estreeNode{}},
+			)
+		} else {
+			n = c.stringLiteral(expr.Loc, helpers.UTF16ToString(e.Value))
+		}
+
+	case *js_ast.ETemplate:
+		n = c.template(e)
+		if e.TagOrNil.Data != nil {
+			tag := c.expr(e.TagOrNil)
+			n = newESTreeNode("TaggedTemplateExpression", tag.outerStart, n.end,
+				estreeField{"tag", tag},
+				estreeField{"quasi", n},
+			)
+		}
+
+	case *js_ast.ERegExp:
+		slash := strings.LastIndexByte(e.Value, '/')
+		n = newESTreeNode("Literal", start, start+int32(len(e.Value)),
+			estreeField{"value", nil},
+			estreeField{"raw", e.Value},
+			estreeField{"regex", []estreeField{
+				{"pattern", e.Value[1:slash]},
+				{"flags", e.Value[slash+1:]},
+			}},
+		)
+
+	case *js_ast.ESpread:
+		argument := c.expr(e.Value)
+		n = newESTreeNode("SpreadElement", start, argument.outerEnd, estreeField{"argument", argument})
+
+	case *js_ast.EAwait:
+		argument := c.expr(e.Value)
+		n = newESTreeNode("AwaitExpression", start, argument.outerEnd, estreeField{"argument", argument})
+
+	case *js_ast.EYield:
+		var argument *estreeNode
+		end := start + int32(len("yield"))
+		if e.ValueOrNil.Data != nil {
+			argument = c.expr(e.ValueOrNil)
+			end = argument.outerEnd
+		}
+		n = newESTreeNode("YieldExpression", start, end,
+			estreeField{"delegate", e.IsStar},
+			estreeField{"argument", argument},
+		)
+
+	case *js_ast.EIf:
+		test := c.expr(e.Test)
+		consequent := c.expr(e.Yes)
+		alternate := c.expr(e.No)
+		n = newESTreeNode("ConditionalExpression", test.outerStart, alternate.outerEnd,
+			estreeField{"test", test},
+			estreeField{"consequent", consequent},
+			estreeField{"alternate", alternate},
+		)
+
+	case *js_ast.EImportCall:
+		source := c.expr(e.Expr)
+		var options *estreeNode
+		if e.OptionsOrNil.Data != nil {
+			options = c.expr(e.OptionsOrNil)
+		}
+		n = newESTreeNode("ImportExpression", start, e.CloseParenLoc.Start+1,
+			estreeField{"source", source},
+			estreeField{"options", options},
+		)
+		switch e.Phase {
+		case ast.DeferPhase:
+			n.fields = append(n.fields, estreeField{"phase", "defer"})
+		case ast.SourcePhase:
+			n.fields = append(n.fields, estreeField{"phase", "source"})
+		}
+
+	case *js_ast.EAnnotation:
+		return c.exprInChain(e.Value, isInChain)
+
+	case *js_ast.EInlinedEnum:
+		return c.exprInChain(e.Value, isInChain)
+
+	default:
+		panic("Internal error")
+	}
+
+	if chain != js_ast.OptionalChainNone && !isInChain {
+		n = newESTreeNode("ChainExpression", n.start, n.end, estreeField{"expression", n})
+	}
+
+	c.applyOuterRange(expr, n)
+	return n
+}
+
+func (c *estreeConverter) binary(expr js_ast.Expr, e *js_ast.EBinary) *estreeNode {
+	switch {
+	case e.Op == js_ast.BinOpComma:
+		// Flatten "a, b, c" into a single sequence
+		var items []js_ast.Expr
+		for {
+			items = append(items, e.Right)
+			left, ok := e.Left.Data.(*js_ast.EBinary)
+			if !ok || left.Op != js_ast.BinOpComma || c.isParsedSeparately(e.Left) {
+				items = append(items, e.Left)
+				break
+			}
+			e = left
+		}
+		expressions := make([]*estreeNode, len(items))
+		for i, item := range items {
+			expressions[len(items)-1-i] = c.expr(item)
+		}
+		return newESTreeNode("SequenceExpression", expressions[0].outerStart, expressions[len(expressions)-1].outerEnd,
+			estreeField{"expressions", expressions})
+
+	case e.Op.BinaryAssignTarget() != js_ast.AssignTargetNone:
+		var left *estreeNode
+		if e.Op == js_ast.BinOpAssign {
+			left = c.pattern(e.Left)
+		} else {
+			left = c.expr(e.Left)
+		}
+		right := c.expr(e.Right)
+		return newESTreeNode("AssignmentExpression", left.outerStart, right.outerEnd,
+			estreeField{"operator", js_ast.OpTable[e.Op].Text},
+			estreeField{"left", left},
+			estreeField{"right", right},
+		)
+
+	default:
+		kind := "BinaryExpression"
+		switch e.Op {
+		case js_ast.BinOpLogicalAnd, js_ast.BinOpLogicalOr, js_ast.BinOpNullishCoalescing:
+			kind = "LogicalExpression"
+		}
+		left := c.expr(e.Left)
+		right := c.expr(e.Right)
+		return newESTreeNode(kind, left.outerStart, right.outerEnd,
+			estreeField{"left", left},
+			estreeField{"operator", js_ast.OpTable[e.Op].Text},
+			estreeField{"right", right},
+		)
+	}
+}
+
+func (c *estreeConverter) objectProperty(property js_ast.Property) *estreeNode {
+	start := property.Loc.Start
+	isComputed := property.Flags.Has(js_ast.PropertyIsComputed)
+
+	switch property.Kind {
+	case js_ast.PropertySpread:
+		argument := c.expr(property.ValueOrNil)
+		return newESTreeNode("SpreadElement", start, argument.outerEnd, estreeField{"argument", argument})
+
+	case js_ast.PropertyMethod, js_ast.PropertyGetter, js_ast.PropertySetter:
+		key := c.propertyKey(property.Key, isComputed)
+		fn := &property.ValueOrNil.Data.(*js_ast.EFunction).Fn
+		value := c.function("FunctionExpression", fn.OpenParenLoc.Start, fn, false)
+		kind := "init"
+		if property.Kind == js_ast.PropertyGetter {
+			kind = "get"
+		} else if property.Kind == js_ast.PropertySetter {
+			kind = "set"
+		}
+		return c.property(start, value.end, key, value, kind, property.Kind == js_ast.PropertyMethod, false, isComputed)
+	}
+
+	key := c.propertyKey(property.Key, isComputed)
+	value := c.expr(property.ValueOrNil)
+	if property.InitializerOrNil.Data != nil {
+		// This is only valid if the object is later turned into a pattern
+		right := c.expr(property.InitializerOrNil)
+		value = newESTreeNode("AssignmentPattern", value.outerStart, right.outerEnd,
+			estreeField{"left", value},
+			estreeField{"right", right},
+		)
+	}
+	return c.property(start, value.outerEnd, key, value, "init", false, property.Flags.Has(js_ast.PropertyWasShorthand), isComputed)
+}
+
+func (c *estreeConverter) template(e *js_ast.ETemplate) *estreeNode {
+	isTagged := e.TagOrNil.Data != nil
+	quasis := make([]*estreeNode, 0, len(e.Parts)+1)
+	expressions := make([]*estreeNode, 0, len(e.Parts))
+
+	start := e.HeadLoc.Start + 1
+	end := c.templateTextEnd(start)
+	quasis = append(quasis, c.templateElement(start, end, e.HeadCooked, len(e.Parts) == 0, isTagged))
+
+	for i, part := range e.Parts {
+		expressions = append(expressions, c.expr(part.Value))
+		start = part.TailLoc.Start + 1
+		end = c.templateTextEnd(start)
+		quasis = append(quasis, c.templateElement(start, end, part.TailCooked, i+1 == len(e.Parts), isTagged))
+	}
+
+	return newESTreeNode("TemplateLiteral", e.HeadLoc.Start, end+1,
+		estreeField{"quasis", quasis},
+		estreeField{"expressions", expressions},
+	)
+}
+
+func (c *estreeConverter) templateElement(start int32, end int32, cooked []uint16, isTail bool, isTagged bool) *estreeNode {
+	// Carriage returns are normalized to newlines in raw template text
+	raw := c.text[start:end]
+	if strings.IndexByte(raw, '\r') != -1 {
+		raw = strings.ReplaceAll(strings.ReplaceAll(raw, "\r\n", "\n"), "\r", "\n")
+	}
+
+	// Tagged templates can contain invalid escape sequences
+	var cookedValue interface{} = helpers.UTF16ToString(cooked)
+	if isTagged && cooked == nil && raw != "" {
+		cookedValue = nil
+	}
+
+	return newESTreeNode("TemplateElement", start, end,
+		estreeField{"value", []estreeField{
+			{"raw", raw},
+			{"cooked", cookedValue},
+		}},
+		estreeField{"tail", isTail},
+	)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// JSX
+
+func (c *estreeConverter) jsxElement(loc logger.Loc, e *js_ast.EJSXElement) *estreeNode {
+	isFragment := e.TagOrNil.Data == nil
+	cursor := c.skipTrivia(loc.Start + 1)
+
+	// Parse the opening element
+	var name *estreeNode
+	attributes := []*estreeNode{}
+	if !isFragment {
+		name = c.jsxName(cursor)
+		cursor = c.skipJSXTypeArguments(name.end)
+		for _, property := range e.Properties {
+			attribute := c.jsxAttribute(property, cursor)
+			attributes = append(attributes, attribute)
+			cursor = attribute.end
+		}
+	}
+	cursor = c.skipTrivia(cursor)
+	isSelfClosing := c.charAt(cursor) == '/'
+	if isSelfClosing {
+		cursor = c.skipTrivia(cursor + 1)
+	}
+	openingEnd := cursor + 1
+
+	// Text children are recovered from the gaps between the other children
+	// since text isn't stored when it's all whitespace
+	children := []*estreeNode{}
+	var closing *estreeNode
+	if !isSelfClosing {
+		cursor = openingEnd
+		for _, child := range e.NullableChildren {
+			var n *estreeNode
+			switch d := child.Data.(type) {
+			case *js_ast.EJSXText:
+				continue
+
+			case *js_ast.EJSXElement:
+				n = c.jsxElement(child.Loc, d)
+
+			case nil:
+				open := cursor + int32(strings.IndexByte(c.text[cursor:], '{'))
+				n = newESTreeNode("JSXExpressionContainer", open, child.Loc.Start+1,
+					estreeField{"expression", newESTreeNode("JSXEmptyExpression", open+1, child.Loc.Start)})
+
+			case *js_ast.ESpread:
+				open := cursor + int32(strings.IndexByte(c.text[cursor:], '{'))
+				expression := c.expr(d.Value)
+				n = newESTreeNode("JSXSpreadChild", open, c.skipTrivia(expression.outerEnd)+1,
+					estreeField{"expression", expression})
+
+			default:
+				open := cursor + int32(strings.IndexByte(c.text[cursor:], '{'))
+				expression := c.expr(child)
+				n = newESTreeNode("JSXExpressionContainer", open, c.skipTrivia(expression.outerEnd)+1,
+					estreeField{"expression", expression})
+			}
+			children = c.appendJSXText(children, cursor, n.start)
+			children = append(children, n)
+			cursor = n.end
+		}
+		children = c.appendJSXText(children, cursor, e.CloseLoc.Start)
+
+		// Parse the closing element
+		cursor = c.skipTrivia(c.skipTrivia(e.CloseLoc.Start+1) + 1)
+		if isFragment {
+			closing = newESTreeNode("JSXClosingFragment", e.CloseLoc.Start, cursor+1)
+		} else {
+			closingName := c.jsxName(cursor)
+			closing = newESTreeNode("JSXClosingElement", e.CloseLoc.Start, c.skipTrivia(closingName.end)+1,
+				estreeField{"name", closingName})
+		}
+	}
+
+	end := openingEnd
+	if closing != nil {
+		end = closing.end
+	}
+
+	if isFragment {
+		return newESTreeNode("JSXFragment", loc.Start, end,
+			estreeField{"openingFragment", newESTreeNode("JSXOpeningFragment", loc.Start, openingEnd)},
+			estreeField{"children", children},
+			estreeField{"closingFragment", closing},
+		)
+	}
+
+	return newESTreeNode("JSXElement", loc.Start, end,
+		estreeField{"openingElement", newESTreeNode("JSXOpeningElement", loc.Start, openingEnd,
+			estreeField{"name", name},
+			estreeField{"attributes", attributes},
+			estreeField{"selfClosing", isSelfClosing},
+		)},
+		estreeField{"children", children},
+		estreeField{"closingElement", closing},
+	)
+}
+
+func (c *estreeConverter) appendJSXText(children []*estreeNode, start int32, end int32) []*estreeNode {
+	if start < end {
+		raw := c.text[start:end]
+		children = append(children, newESTreeNode("JSXText", start, end,
+			estreeField{"value", helpers.UTF16ToString(js_lexer.DecodeJSXEntities(raw))},
+			estreeField{"raw", raw},
+		))
+	}
+	return children
+}
+
+// TypeScript allows type arguments after the tag name: "<Foo<T>>"
+func (c *estreeConverter) skipJSXTypeArguments(i int32) int32 {
+	next := c.skipTrivia(i)
+	if c.charAt(next) != '<' {
+		return i
+	}
+	depth := 0
+	for int(next) < len(c.text) {
+		switch c.text[next] {
+		case '<':
+			depth++
+		case '>':
+			if c.text[next-1] != '=' {
+				depth--
+			}
+		}
+		next++
+		if depth == 0 {
+			break
+		}
+	}
+	return next
+}
+
+func (c *estreeConverter) jsxIdentifier(start int32) *estreeNode {
+	i := start
+	for int(i) < len(c.text) {
+		r, width := utf8.DecodeRuneInString(c.text[i:])
+		if r != '-' && !js_ast.IsIdentifierContinue(r) {
+			break
+		}
+		i += int32(width)
+	}
+	return newESTreeNode("JSXIdentifier", start, i, estreeField{"name", c.text[start:i]})
+}
+
+func (c *estreeConverter) jsxName(start int32) *estreeNode {
+	n := c.jsxIdentifier(start)
+	after := c.skipTrivia(n.end)
+
+	if c.charAt(after) == ':' {
+		name := c.jsxIdentifier(c.skipTrivia(after + 1))
+		return newESTreeNode("JSXNamespacedName", n.start, name.end,
+			estreeField{"namespace", n},
+			estreeField{"name", name},
+		)
+	}
+
+	for c.charAt(after) == '.' {
+		property := c.jsxIdentifier(c.skipTrivia(after + 1))
+		n = newESTreeNode("JSXMemberExpression", n.start, property.end,
+			estreeField{"object", n},
+			estreeField{"property", property},
+		)
+		after = c.skipTrivia(property.end)
+	}
+	return n
+}
+
+func (c *estreeConverter) jsxAttribute(property js_ast.Property, cursor int32) *estreeNode {
+	if property.Kind == js_ast.PropertySpread {
+		open := cursor + int32(strings.IndexByte(c.text[cursor:], '{'))
+		argument := c.expr(property.ValueOrNil)
+		return newESTreeNode("JSXSpreadAttribute", open, c.skipTrivia(argument.outerEnd)+1,
+			estreeField{"argument", argument})
+	}
+
+	name := c.jsxName(property.Key.Loc.Start)
+	var value *estreeNode
+	switch v := property.ValueOrNil.Data.(type) {
+	case *js_ast.EJSXText:
+		// JSX strings don't have escape sequences, so just find the other quote
+		start := property.ValueOrNil.Loc.Start
+		end := start + 2 + int32(strings.IndexByte(c.text[start+1:], c.text[start]))
+		raw := c.text[start:end]
+		value = newESTreeNode("Literal", start, end,
+			estreeField{"value", helpers.UTF16ToString(js_lexer.DecodeJSXEntities(raw[1 : len(raw)-1]))},
+			estreeField{"raw", raw},
+		)
+
+	case *js_ast.EJSXElement:
+		if property.Flags.Has(js_ast.PropertyWasShorthand) {
+			value = c.jsxElement(property.ValueOrNil.Loc, v)
+		}
+	}
+
+	if value == nil && !property.Flags.Has(js_ast.PropertyWasShorthand) {
+		open := c.skipTrivia(c.skipTrivia(name.end) + 1)
+		expression := c.expr(property.ValueOrNil)
+		value = newESTreeNode("JSXExpressionContainer", open, c.skipTrivia(expression.outerEnd)+1,
+			estreeField{"expression", expression})
+	}
+
+	end := name.end
+	if value != nil {
+		end = value.end
+	}
+	return newESTreeNode("JSXAttribute", name.start, end,
+		estreeField{"name", name},
+		estreeField{"value", value},
+	)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// JSON output
+
+type estreePrinter struct {
+	js []byte
+
+	// The UTF-16 offset of each byte offset in the source text
+	utf16Offsets []int32
+
+	// The byte offset of the start of each line
+	lineStarts []int32
+}
+
+func printESTree(program *estreeNode, text string) []byte {
+	p := estreePrinter{
+		utf16Offsets: make([]int32, len(text)+1),
+		lineStarts:   []int32{0},
+	}
+
+	offset := int32(0)
+	for i, r := range text {
+		width := utf8.RuneLen(r)
+		if r == utf8.RuneError {
+			width = 1
+			if _, w := utf8.DecodeRuneInString(text[i:]); w > 0 {
+				width = w
+			}
+		}
+		for j := 0; j < width; j++ {
+			p.utf16Offsets[i+j] = offset
+		}
+		if r >= 0x10000 {
+			offset += 2
+		} else {
+			offset++
+		}
+		switch r {
+		case '\r':
+			if i+1 < len(text) && text[i+1] == '\n' {
+				break
+			}
+			p.lineStarts = append(p.lineStarts, int32(i+1))
+		case '\n', '\u2028', '\u2029':
+			p.lineStarts = append(p.lineStarts, int32(i+width))
+		}
+	}
+	p.utf16Offsets[len(text)] = offset
+
+	p.printNode(program)
+	return p.js
+}
+
+func (p *estreePrinter) printPosition(offset int32) {
+	line := sort.Search(len(p.lineStarts), func(i int) bool {
+		return p.lineStarts[i] > offset
+	})
+	column := p.utf16Offsets[offset] - p.utf16Offsets[p.lineStarts[line-1]]
+	p.js = append(p.js, "{\"line\":"...)
+	p.js = strconv.AppendInt(p.js, int64(line), 10)
+	p.js = append(p.js, ",\"column\":"...)
+	p.js = strconv.AppendInt(p.js, int64(column), 10)
+	p.js = append(p.js, '}')
+}
+
+func (p *estreePrinter) printNode(n *estreeNode) {
+	if n == nil {
+		p.js = append(p.js, "null"...)
+		return
+	}
+
+	start := p.utf16Offsets[n.start]
+	end := p.utf16Offsets[n.end]
+	p.js = append(p.js, "{\"type\":"...)
+	p.js = append(p.js, helpers.QuoteForJSON(n.kind, false)...)
+	p.js = append(p.js, ",\"start\":"...)
+	p.js = strconv.AppendInt(p.js, int64(start), 10)
+	p.js = append(p.js, ",\"end\":"...)
+	p.js = strconv.AppendInt(p.js, int64(end), 10)
+	p.js = append(p.js, ",\"loc\":{\"start\":"...)
+	p.printPosition(n.start)
+	p.js = append(p.js, ",\"end\":"...)
+	p.printPosition(n.end)
+	p.js = append(p.js, "},\"range\":["...)
+	p.js = strconv.AppendInt(p.js, int64(start), 10)
+	p.js = append(p.js, ',')
+	p.js = strconv.AppendInt(p.js, int64(end), 10)
+	p.js = append(p.js, ']')
+	for _, field := range n.fields {
+		p.js = append(p.js, ',')
+		p.printField(field)
+	}
+	p.js = append(p.js, '}')
+}
+
+func (p *estreePrinter) printField(field estreeField) {
+	p.js = append(p.js, helpers.QuoteForJSON(field.key, false)...)
+	p.js = append(p.js, ':')
+
+	switch v := field.value.(type) {
+	case nil:
+		p.js = append(p.js, "null"...)
+
+	case *estreeNode:
+		p.printNode(v)
+
+	case []*estreeNode:
+		p.js = append(p.js, '[')
+		for i, item := range v {
+			if i > 0 {
+				p.js = append(p.js, ',')
+			}
+			p.printNode(item)
+		}
+		p.js = append(p.js, ']')
+
+	case []estreeField:
+		p.js = append(p.js, '{')
+		for i, item := range v {
+			if i > 0 {
+				p.js = append(p.js, ',')
+			}
+			p.printField(item)
+		}
+		p.js = append(p.js, '}')
+
+	case string:
+		p.js = append(p.js, helpers.QuoteForJSON(v, false)...)
+
+	case bool:
+		if v {
+			p.js = append(p.js, "true"...)
+		} else {
+			p.js = append(p.js, "false"...)
+		}
+
+	case estreeJSON:
+		p.js = append(p.js, v...)
+
+	default:
+		panic("Internal error")
+	}
+}
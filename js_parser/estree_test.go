@@ -0,0 +1,705 @@
+package js_parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ije/esbuild-internal/config"
+	"github.com/ije/esbuild-internal/logger"
+	"github.com/ije/esbuild-internal/test"
+)
+
+func parseESTreeForTest(t *testing.T, contents string, options config.Options) []byte {
+	t.Helper()
+	log := logger.NewDeferLog(logger.DeferLogNoVerboseOrDebug, nil)
+	result, ok := ParseESTree(log, test.SourceForTest(contents), OptionsFromConfig(&options))
+	msgs := log.Done()
+	var text strings.Builder
+	for _, msg := range msgs {
+		text.WriteString(msg.String(logger.OutputOptions{}, logger.TerminalInfo{}))
+	}
+	test.AssertEqualWithDiff(t, text.String(), "")
+	if !ok {
+		t.Fatal("Parse error")
+	}
+	return result
+}
+
+// The JSON is summarized as one line per node so the tests are readable. The
+// "loc" and "range" properties are only checked by the tests for locations.
+func summarizeESTree(t *testing.T, js []byte) string {
+	t.Helper()
+	decoder := json.NewDecoder(strings.NewReader(string(js)))
+	decoder.UseNumber()
+	var sb strings.Builder
+
+	var parseValue func() interface{}
+	parseValue = func() interface{} {
+		token, err := decoder.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch token {
+		case json.Delim('{'):
+			var fields []estreeField
+			for decoder.More() {
+				key, _ := decoder.Token()
+				fields = append(fields, estreeField{key.(string), parseValue()})
+			}
+			decoder.Token()
+			return fields
+		case json.Delim('['):
+			items := []interface{}{}
+			for decoder.More() {
+				items = append(items, parseValue())
+			}
+			decoder.Token()
+			return items
+		}
+		return token
+	}
+
+	var compact func(value interface{}) string
+	compact = func(value interface{}) string {
+		switch v := value.(type) {
+		case []estreeField:
+			parts := make([]string, len(v))
+			for i, field := range v {
+				parts[i] = field.key + ":" + compact(field.value)
+			}
+			return "{" + strings.Join(parts, ",") + "}"
+		case []interface{}:
+			parts := make([]string, len(v))
+			for i, item := range v {
+				parts[i] = compact(item)
+			}
+			return "[" + strings.Join(parts, ",") + "]"
+		case string:
+			return strconv.Quote(v)
+		case nil:
+			return "null"
+		}
+		return fmt.Sprintf("%v", value)
+	}
+
+	isNode := func(value interface{}) bool {
+		fields, ok := value.([]estreeField)
+		return ok && len(fields) > 0 && fields[0].key == "type"
+	}
+
+	var printNode func(prefix string, fields []estreeField, indent string)
+	printNode = func(prefix string, fields []estreeField, indent string) {
+		var children []estreeField
+		sb.WriteString(indent + prefix)
+		for _, field := range fields {
+			switch field.key {
+			case "type":
+				sb.WriteString(field.value.(string))
+			case "start":
+				sb.WriteString(fmt.Sprintf(" [%v,", field.value))
+			case "end":
+				sb.WriteString(fmt.Sprintf("%v]", field.value))
+			case "loc", "range":
+			default:
+				if items, ok := field.value.([]interface{}); ok && len(items) > 0 {
+					children = append(children, field)
+				} else if isNode(field.value) {
+					children = append(children, field)
+				} else {
+					sb.WriteString(" " + field.key + "=" + compact(field.value))
+				}
+			}
+		}
+		sb.WriteString("\n")
+		for _, child := range children {
+			if items, ok := child.value.([]interface{}); ok {
+				for i, item := range items {
+					key := fmt.Sprintf("%s[%d]: ", child.key, i)
+					if isNode(item) {
+						printNode(key, item.([]estreeField), indent+"  ")
+					} else {
+						sb.WriteString(indent + "  " + key + compact(item) + "\n")
+					}
+				}
+			} else {
+				printNode(child.key+": ", child.value.([]estreeField), indent+"  ")
+			}
+		}
+	}
+
+	printNode("", parseValue().([]estreeField), "")
+	return sb.String()
+}
+
+func expectESTreeCommon(t *testing.T, contents string, expected string, options config.Options) {
+	t.Helper()
+	t.Run(contents, func(t *testing.T) {
+		t.Helper()
+		js := parseESTreeForTest(t, contents, options)
+		if !json.Valid(js) {
+			t.Fatalf("Invalid JSON: %s", js)
+		}
+		test.AssertEqualWithDiff(t, summarizeESTree(t, js), expected)
+	})
+}
+
+func expectESTree(t *testing.T, contents string, expected string) {
+	t.Helper()
+	expectESTreeCommon(t, contents, expected, config.Options{})
+}
+
+func expectESTreeTS(t *testing.T, contents string, expected string) {
+	t.Helper()
+	expectESTreeCommon(t, contents, expected, config.Options{
+		TS: config.TSOptions{
+			Parse: true,
+		},
+	})
+}
+
+func expectESTreeJSX(t *testing.T, contents string, expected string) {
+	t.Helper()
+	expectESTreeCommon(t, contents, expected, config.Options{
+		JSX: config.JSXOptions{
+			Parse: true,
+		},
+	})
+}
+
+func TestESTreeStatements(t *testing.T) {
+	expectESTree(t, "'use strict'; x", `Program [0,15] sourceType="script"
+  body[0]: ExpressionStatement [0,13] directive="use strict"
+    expression: Literal [0,12] value="use strict" raw="'use strict'"
+  body[1]: ExpressionStatement [14,15]
+    expression: Identifier [14,15] name="x"
+`)
+	expectESTree(t, "var a = 1, [b, , ...c] = d, { e: f = 2, ...g } = h;", `Program [0,51] sourceType="script"
+  body[0]: VariableDeclaration [0,51] kind="var"
+    declarations[0]: VariableDeclarator [4,9]
+      id: Identifier [4,5] name="a"
+      init: Literal [8,9] value=1 raw="1"
+    declarations[1]: VariableDeclarator [11,26]
+      id: ArrayPattern [11,22]
+        elements[0]: Identifier [12,13] name="b"
+        elements[1]: null
+        elements[2]: RestElement [17,21]
+          argument: Identifier [20,21] name="c"
+      init: Identifier [25,26] name="d"
+    declarations[2]: VariableDeclarator [28,50]
+      id: ObjectPattern [28,46]
+        properties[0]: Property [30,38] method=false shorthand=false computed=false kind="init"
+          key: Identifier [30,31] name="e"
+          value: AssignmentPattern [33,38]
+            left: Identifier [33,34] name="f"
+            right: Literal [37,38] value=2 raw="2"
+        properties[1]: RestElement [40,44]
+          argument: Identifier [43,44] name="g"
+      init: Identifier [49,50] name="h"
+`)
+	expectESTree(t, "for (let k in o) if (k) continue; else break", `Program [0,44] sourceType="script"
+  body[0]: ForInStatement [0,44]
+    left: VariableDeclaration [5,10] kind="let"
+      declarations[0]: VariableDeclarator [9,10] init=null
+        id: Identifier [9,10] name="k"
+    right: Identifier [14,15] name="o"
+    body: IfStatement [17,44]
+      test: Identifier [21,22] name="k"
+      consequent: ContinueStatement [24,33] label=null
+      alternate: BreakStatement [39,44] label=null
+`)
+	expectESTree(t, "for await (const v of it) {} for (;;) ;", `Program [0,39] sourceType="module"
+  body[0]: ForOfStatement [0,28] await=true
+    left: VariableDeclaration [11,18] kind="const"
+      declarations[0]: VariableDeclarator [17,18] init=null
+        id: Identifier [17,18] name="v"
+    right: Identifier [22,24] name="it"
+    body: BlockStatement [26,28] body=[]
+  body[1]: ForStatement [29,39] init=null test=null update=null
+    body: EmptyStatement [38,39]
+`)
+	expectESTree(t, "do x++; while (y)", `Program [0,17] sourceType="script"
+  body[0]: DoWhileStatement [0,17]
+    body: ExpressionStatement [3,7]
+      expression: UpdateExpression [3,6] operator="++" prefix=false
+        argument: Identifier [3,4] name="x"
+    test: Identifier [15,16] name="y"
+`)
+	expectESTree(t, "a: while (true) { break a }", `Program [0,27] sourceType="script"
+  body[0]: LabeledStatement [0,27]
+    label: Identifier [0,1] name="a"
+    body: WhileStatement [3,27]
+      test: Literal [10,14] value=true raw="true"
+      body: BlockStatement [16,27]
+        body[0]: BreakStatement [18,25]
+          label: Identifier [24,25] name="a"
+`)
+	expectESTree(t, "try { a() } catch ({ e }) {} finally { b() }", `Program [0,44] sourceType="script"
+  body[0]: TryStatement [0,44]
+    block: BlockStatement [4,11]
+      body[0]: ExpressionStatement [6,9]
+        expression: CallExpression [6,9] arguments=[] optional=false
+          callee: Identifier [6,7] name="a"
+    handler: CatchClause [12,28]
+      param: ObjectPattern [19,24]
+        properties[0]: Property [21,22] method=false shorthand=true computed=false kind="init"
+          key: Identifier [21,22] name="e"
+          value: Identifier [21,22] name="e"
+      body: BlockStatement [26,28] body=[]
+    finalizer: BlockStatement [37,44]
+      body[0]: ExpressionStatement [39,42]
+        expression: CallExpression [39,42] arguments=[] optional=false
+          callee: Identifier [39,40] name="b"
+`)
+	expectESTree(t, "switch (x) { case 1: f(); break; default: }", `Program [0,43] sourceType="script"
+  body[0]: SwitchStatement [0,43]
+    discriminant: Identifier [8,9] name="x"
+    cases[0]: SwitchCase [13,32]
+      test: Literal [18,19] value=1 raw="1"
+      consequent[0]: ExpressionStatement [21,25]
+        expression: CallExpression [21,24] arguments=[] optional=false
+          callee: Identifier [21,22] name="f"
+      consequent[1]: BreakStatement [26,32] label=null
+    cases[1]: SwitchCase [33,41] test=null consequent=[]
+`)
+	expectESTree(t, "function* f(a, b = 1, ...c) { yield* a; return }", `Program [0,48] sourceType="script"
+  body[0]: FunctionDeclaration [0,48] expression=false generator=true async=false
+    id: Identifier [10,11] name="f"
+    params[0]: Identifier [12,13] name="a"
+    params[1]: AssignmentPattern [15,20]
+      left: Identifier [15,16] name="b"
+      right: Literal [19,20] value=1 raw="1"
+    params[2]: RestElement [22,26]
+      argument: Identifier [25,26] name="c"
+    body: BlockStatement [28,48]
+      body[0]: ExpressionStatement [30,39]
+        expression: YieldExpression [30,38] delegate=true
+          argument: Identifier [37,38] name="a"
+      body[1]: ReturnStatement [40,46] argument=null
+`)
+	expectESTree(t, "class A extends (B) { static #p = 1; get v() { return this.#p } static {} constructor() { super() } }", `Program [0,101] sourceType="script"
+  body[0]: ClassDeclaration [0,101] decorators=[]
+    id: Identifier [6,7] name="A"
+    superClass: Identifier [17,18] name="B"
+    body: ClassBody [20,101]
+      body[0]: PropertyDefinition [22,36] computed=false static=true decorators=[]
+        key: PrivateIdentifier [29,31] name="p"
+        value: Literal [34,35] value=1 raw="1"
+      body[1]: MethodDefinition [37,63] kind="get" computed=false static=false decorators=[]
+        key: Identifier [41,42] name="v"
+        value: FunctionExpression [42,63] id=null expression=false generator=false async=false params=[]
+          body: BlockStatement [45,63]
+            body[0]: ReturnStatement [47,61]
+              argument: MemberExpression [54,61] computed=false optional=false
+                object: ThisExpression [54,58]
+                property: PrivateIdentifier [59,61] name="p"
+      body[2]: StaticBlock [64,73] body=[]
+      body[3]: MethodDefinition [74,99] kind="constructor" computed=false static=false decorators=[]
+        key: Identifier [74,85] name="constructor"
+        value: FunctionExpression [85,99] id=null expression=false generator=false async=false params=[]
+          body: BlockStatement [88,99]
+            body[0]: ExpressionStatement [90,97]
+              expression: CallExpression [90,97] arguments=[] optional=false
+                callee: Super [90,95]
+`)
+}
+
+func TestESTreeModules(t *testing.T) {
+	expectESTree(t, "import a, * as b from 'c'", `Program [0,25] sourceType="module"
+  body[0]: ImportDeclaration [0,25] attributes=[]
+    specifiers[0]: ImportDefaultSpecifier [7,8]
+      local: Identifier [7,8] name="a"
+    specifiers[1]: ImportNamespaceSpecifier [10,16]
+      local: Identifier [15,16] name="b"
+    source: Literal [22,25] value="c" raw="'c'"
+`)
+	expectESTree(t, "import { a as b, 'c d' as e } from 'f' with { type: 'json' }", `Program [0,60] sourceType="module"
+  body[0]: ImportDeclaration [0,60]
+    specifiers[0]: ImportSpecifier [9,15]
+      imported: Identifier [9,10] name="a"
+      local: Identifier [14,15] name="b"
+    specifiers[1]: ImportSpecifier [17,27]
+      imported: Literal [17,22] value="c d" raw="'c d'"
+      local: Identifier [26,27] name="e"
+    source: Literal [35,38] value="f" raw="'f'"
+    attributes[0]: ImportAttribute [46,58]
+      key: Identifier [46,50] name="type"
+      value: Literal [52,58] value="json" raw="'json'"
+`)
+	expectESTree(t, "export { a as default, b }; export * as c from 'd'", `Program [0,50] sourceType="module"
+  body[0]: ExportNamedDeclaration [0,27] declaration=null source=null attributes=[]
+    specifiers[0]: ExportSpecifier [9,21]
+      local: Identifier [9,10] name="a"
+      exported: Identifier [14,21] name="default"
+    specifiers[1]: ExportSpecifier [23,24]
+      local: Identifier [23,24] name="b"
+      exported: Identifier [23,24] name="b"
+  body[1]: ExportAllDeclaration [28,50] attributes=[]
+    exported: Identifier [40,41] name="c"
+    source: Literal [47,50] value="d" raw="'d'"
+`)
+	expectESTree(t, "export async function f() {} export default class {}", `Program [0,52] sourceType="module"
+  body[0]: ExportNamedDeclaration [0,28] specifiers=[] source=null attributes=[]
+    declaration: FunctionDeclaration [7,28] expression=false generator=false async=true params=[]
+      id: Identifier [22,23] name="f"
+      body: BlockStatement [26,28] body=[]
+  body[1]: ExportDefaultDeclaration [29,52]
+    declaration: ClassDeclaration [44,52] id=null superClass=null decorators=[]
+      body: ClassBody [50,52] body=[]
+`)
+	expectESTree(t, "export const a = 1; export default (1, 2);", `Program [0,42] sourceType="module"
+  body[0]: ExportNamedDeclaration [0,19] specifiers=[] source=null attributes=[]
+    declaration: VariableDeclaration [7,19] kind="const"
+      declarations[0]: VariableDeclarator [13,18]
+        id: Identifier [13,14] name="a"
+        init: Literal [17,18] value=1 raw="1"
+  body[1]: ExportDefaultDeclaration [20,42]
+    declaration: SequenceExpression [36,40]
+      expressions[0]: Literal [36,37] value=1 raw="1"
+      expressions[1]: Literal [39,40] value=2 raw="2"
+`)
+}
+
+func TestESTreeExpressions(t *testing.T) {
+	expectESTree(t, "a?.b.c(d)?.[e]; (a?.b).c", `Program [0,24] sourceType="script"
+  body[0]: ExpressionStatement [0,15]
+    expression: ChainExpression [0,14]
+      expression: MemberExpression [0,14] computed=true optional=true
+        object: CallExpression [0,9] optional=false
+          callee: MemberExpression [0,6] computed=false optional=false
+            object: MemberExpression [0,4] computed=false optional=true
+              object: Identifier [0,1] name="a"
+              property: Identifier [3,4] name="b"
+            property: Identifier [5,6] name="c"
+          arguments[0]: Identifier [7,8] name="d"
+        property: Identifier [12,13] name="e"
+  body[1]: ExpressionStatement [16,24]
+    expression: MemberExpression [16,24] computed=false optional=false
+      object: ChainExpression [17,21]
+        expression: MemberExpression [17,21] computed=false optional=true
+          object: Identifier [17,18] name="a"
+          property: Identifier [20,21] name="b"
+      property: Identifier [23,24] name="c"
+`)
+	expectESTree(t, "(a, b), c; a, (b, c)", `Program [0,20] sourceType="script"
+  body[0]: ExpressionStatement [0,10]
+    expression: SequenceExpression [0,9]
+      expressions[0]: SequenceExpression [1,5]
+        expressions[0]: Identifier [1,2] name="a"
+        expressions[1]: Identifier [4,5] name="b"
+      expressions[1]: Identifier [8,9] name="c"
+  body[1]: ExpressionStatement [11,20]
+    expression: SequenceExpression [11,20]
+      expressions[0]: Identifier [11,12] name="a"
+      expressions[1]: SequenceExpression [15,19]
+        expressions[0]: Identifier [15,16] name="b"
+        expressions[1]: Identifier [18,19] name="c"
+`)
+	expectESTree(t, "x ??= y || z && !w", `Program [0,18] sourceType="script"
+  body[0]: ExpressionStatement [0,18]
+    expression: AssignmentExpression [0,18] operator="??="
+      left: Identifier [0,1] name="x"
+      right: LogicalExpression [6,18] operator="||"
+        left: Identifier [6,7] name="y"
+        right: LogicalExpression [11,18] operator="&&"
+          left: Identifier [11,12] name="z"
+          right: UnaryExpression [16,18] operator="!" prefix=true
+            argument: Identifier [17,18] name="w"
+`)
+	expectESTree(t, "[a, b] = [b, a]; ({ a = 1, b: { c } } = d)", `Program [0,42] sourceType="script"
+  body[0]: ExpressionStatement [0,16]
+    expression: AssignmentExpression [0,15] operator="="
+      left: ArrayPattern [0,6]
+        elements[0]: Identifier [1,2] name="a"
+        elements[1]: Identifier [4,5] name="b"
+      right: ArrayExpression [9,15]
+        elements[0]: Identifier [10,11] name="b"
+        elements[1]: Identifier [13,14] name="a"
+  body[1]: ExpressionStatement [17,42]
+    expression: AssignmentExpression [18,41] operator="="
+      left: ObjectPattern [18,37]
+        properties[0]: Property [20,25] method=false shorthand=true computed=false kind="init"
+          key: Identifier [20,21] name="a"
+          value: AssignmentPattern [20,25]
+            left: Identifier [20,21] name="a"
+            right: Literal [24,25] value=1 raw="1"
+        properties[1]: Property [27,35] method=false shorthand=false computed=false kind="init"
+          key: Identifier [27,28] name="b"
+          value: ObjectPattern [30,35]
+            properties[0]: Property [32,33] method=false shorthand=true computed=false kind="init"
+              key: Identifier [32,33] name="c"
+              value: Identifier [32,33] name="c"
+      right: Identifier [40,41] name="d"
+`)
+	expectESTree(t, "({ a, b: 1, [c]: 2, get d() {}, set d(v) {}, async *m() {}, ...s })", `Program [0,67] sourceType="script"
+  body[0]: ExpressionStatement [0,67]
+    expression: ObjectExpression [1,66]
+      properties[0]: Property [3,4] method=false shorthand=true computed=false kind="init"
+        key: Identifier [3,4] name="a"
+        value: Identifier [3,4] name="a"
+      properties[1]: Property [6,10] method=false shorthand=false computed=false kind="init"
+        key: Identifier [6,7] name="b"
+        value: Literal [9,10] value=1 raw="1"
+      properties[2]: Property [12,18] method=false shorthand=false computed=true kind="init"
+        key: Identifier [13,14] name="c"
+        value: Literal [17,18] value=2 raw="2"
+      properties[3]: Property [20,30] method=false shorthand=false computed=false kind="get"
+        key: Identifier [24,25] name="d"
+        value: FunctionExpression [25,30] id=null expression=false generator=false async=false params=[]
+          body: BlockStatement [28,30] body=[]
+      properties[4]: Property [32,43] method=false shorthand=false computed=false kind="set"
+        key: Identifier [36,37] name="d"
+        value: FunctionExpression [37,43] id=null expression=false generator=false async=false
+          params[0]: Identifier [38,39] name="v"
+          body: BlockStatement [41,43] body=[]
+      properties[5]: Property [45,58] method=true shorthand=false computed=false kind="init"
+        key: Identifier [52,53] name="m"
+        value: FunctionExpression [53,58] id=null expression=false generator=true async=true params=[]
+          body: BlockStatement [56,58] body=[]
+      properties[6]: SpreadElement [60,64]
+        argument: Identifier [63,64] name="s"
+`)
+	expectESTree(t, "`a${b}c`; tag`\\u${d}`; `e`", `Program [0,26] sourceType="script"
+  body[0]: ExpressionStatement [0,9]
+    expression: TemplateLiteral [0,8]
+      quasis[0]: TemplateElement [1,2] value={raw:"a",cooked:"a"} tail=false
+      quasis[1]: TemplateElement [6,7] value={raw:"c",cooked:"c"} tail=true
+      expressions[0]: Identifier [4,5] name="b"
+  body[1]: ExpressionStatement [10,22]
+    expression: TaggedTemplateExpression [10,21]
+      tag: Identifier [10,13] name="tag"
+      quasi: TemplateLiteral [13,21]
+        quasis[0]: TemplateElement [14,16] value={raw:"\\u",cooked:null} tail=false
+        quasis[1]: TemplateElement [20,20] value={raw:"",cooked:""} tail=true
+        expressions[0]: Identifier [18,19] name="d"
+  body[2]: ExpressionStatement [23,26]
+    expression: TemplateLiteral [23,26] expressions=[]
+      quasis[0]: TemplateElement [24,25] value={raw:"e",cooked:"e"} tail=true
+`)
+	expectESTree(t, "/a/g; 1e+5; 0x10n; null; true", `Program [0,29] sourceType="script"
+  body[0]: ExpressionStatement [0,5]
+    expression: Literal [0,4] value=null raw="/a/g" regex={pattern:"a",flags:"g"}
+  body[1]: ExpressionStatement [6,11]
+    expression: Literal [6,10] value=100000 raw="1e+5"
+  body[2]: ExpressionStatement [12,18]
+    expression: Literal [12,17] value=null raw="0x10n" bigint="16"
+  body[3]: ExpressionStatement [19,24]
+    expression: Literal [19,23] value=null raw="null"
+  body[4]: ExpressionStatement [25,29]
+    expression: Literal [25,29] value=true raw="true"
+`)
+	expectESTree(t, "new A; new B(...c); new.target; import.meta.url; import('a', { with: {} })", `Program [0,74] sourceType="module"
+  body[0]: ExpressionStatement [0,6]
+    expression: NewExpression [0,5] arguments=[]
+      callee: Identifier [4,5] name="A"
+  body[1]: ExpressionStatement [7,19]
+    expression: NewExpression [7,18]
+      callee: Identifier [11,12] name="B"
+      arguments[0]: SpreadElement [13,17]
+        argument: Identifier [16,17] name="c"
+  body[2]: ExpressionStatement [20,31]
+    expression: MetaProperty [20,30]
+      meta: Identifier [20,23] name="new"
+      property: Identifier [24,30] name="target"
+  body[3]: ExpressionStatement [32,48]
+    expression: MemberExpression [32,47] computed=false optional=false
+      object: MetaProperty [32,43]
+        meta: Identifier [32,38] name="import"
+        property: Identifier [39,43] name="meta"
+      property: Identifier [44,47] name="url"
+  body[4]: ExpressionStatement [49,74]
+    expression: ImportExpression [49,74]
+      source: Literal [56,59] value="a" raw="'a'"
+      options: ObjectExpression [61,73]
+        properties[0]: Property [63,71] method=false shorthand=false computed=false kind="init"
+          key: Identifier [63,67] name="with"
+          value: ObjectExpression [69,71] properties=[]
+`)
+	expectESTree(t, "async x => ({}); (a, b) => { return a }", `Program [0,39] sourceType="script"
+  body[0]: ExpressionStatement [0,16]
+    expression: ArrowFunctionExpression [0,15] id=null expression=true generator=false async=true
+      params[0]: Identifier [6,7] name="x"
+      body: ObjectExpression [12,14] properties=[]
+  body[1]: ExpressionStatement [17,39]
+    expression: ArrowFunctionExpression [17,39] id=null expression=false generator=false async=false
+      params[0]: Identifier [18,19] name="a"
+      params[1]: Identifier [21,22] name="b"
+      body: BlockStatement [27,39]
+        body[0]: ReturnStatement [29,37]
+          argument: Identifier [36,37] name="a"
+`)
+	expectESTree(t, "a ? (b) : c++", `Program [0,13] sourceType="script"
+  body[0]: ExpressionStatement [0,13]
+    expression: ConditionalExpression [0,13]
+      test: Identifier [0,1] name="a"
+      consequent: Identifier [5,6] name="b"
+      alternate: UpdateExpression [10,13] operator="++" prefix=false
+        argument: Identifier [10,11] name="c"
+`)
+}
+
+func TestESTreeTypeScript(t *testing.T) {
+	expectESTreeTS(t, "let a: number = <any>b as unknown as C;", `Program [0,39] sourceType="script"
+  body[0]: VariableDeclaration [0,39] kind="let"
+    declarations[0]: VariableDeclarator [4,38]
+      id: Identifier [4,5] name="a"
+      init: Identifier [21,22] name="b"
+`)
+	expectESTreeTS(t, "function f<T>(this: W, a?: T, b: number = 2): void {}", `Program [0,53] sourceType="script"
+  body[0]: FunctionDeclaration [0,53] expression=false generator=false async=false
+    id: Identifier [9,10] name="f"
+    params[0]: Identifier [23,24] name="a"
+    params[1]: AssignmentPattern [30,43]
+      left: Identifier [30,31] name="b"
+      right: Literal [42,43] value=2 raw="2"
+    body: BlockStatement [51,53] body=[]
+`)
+	expectESTreeTS(t, "interface I {} type T = number; declare const d: T; x", `Program [0,53] sourceType="script"
+  body[0]: ExpressionStatement [52,53]
+    expression: Identifier [52,53] name="x"
+`)
+	expectESTreeTS(t, "import fs = require('fs'); export import Q = A.B.C", `Program [0,50] sourceType="module"
+  body[0]: TSImportEqualsDeclaration [0,26] importKind="value"
+    id: Identifier [7,9] name="fs"
+    moduleReference: TSExternalModuleReference [12,25]
+      expression: Literal [20,24] value="fs" raw="'fs'"
+  body[1]: ExportNamedDeclaration [27,50] specifiers=[] source=null attributes=[]
+    declaration: TSImportEqualsDeclaration [34,50] importKind="value"
+      id: Identifier [41,42] name="Q"
+      moduleReference: TSQualifiedName [45,50]
+        left: TSQualifiedName [45,48]
+          left: Identifier [45,46] name="A"
+          right: Identifier [47,48] name="B"
+        right: Identifier [49,50] name="C"
+`)
+	expectESTreeTS(t, "const enum E { A = 1, 'B' } export enum F { C }", `Program [0,47] sourceType="module"
+  body[0]: TSEnumDeclaration [0,27] const=true declare=false
+    id: Identifier [11,12] name="E"
+    members[0]: TSEnumMember [15,20]
+      id: Identifier [15,16] name="A"
+      initializer: Literal [19,20] value=1 raw="1"
+    members[1]: TSEnumMember [22,25] initializer=null
+      id: Literal [22,25] value="B" raw="'B'"
+  body[1]: ExportNamedDeclaration [28,47] specifiers=[] source=null attributes=[]
+    declaration: TSEnumDeclaration [35,47] const=false declare=false
+      id: Identifier [40,41] name="F"
+      members[0]: TSEnumMember [44,45] initializer=null
+        id: Identifier [44,45] name="C"
+`)
+	expectESTreeTS(t, "namespace A.B { export let x = 1 }", `Program [0,34] sourceType="script"
+  body[0]: TSModuleDeclaration [0,34] kind="namespace" declare=false
+    id: Identifier [10,11] name="A"
+    body: TSModuleDeclaration [12,34] kind="namespace" declare=false
+      id: Identifier [12,13] name="B"
+      body: TSModuleBlock [14,34]
+        body[0]: ExportNamedDeclaration [16,32] specifiers=[] source=null attributes=[]
+          declaration: VariableDeclaration [23,32] kind="let"
+            declarations[0]: VariableDeclarator [27,32]
+              id: Identifier [27,28] name="x"
+              init: Literal [31,32] value=1 raw="1"
+`)
+	expectESTreeTS(t, "export = foo", `Program [0,12] sourceType="script"
+  body[0]: TSExportAssignment [0,12]
+    expression: Identifier [9,12] name="foo"
+`)
+	expectESTreeTS(t, "abstract class C { @dec x = 1; declare y: string; abstract z(): void; accessor w = 2; m(): void; m() {} }", `Program [0,105] sourceType="script"
+  body[0]: ClassDeclaration [0,105] superClass=null decorators=[]
+    id: Identifier [15,16] name="C"
+    body: ClassBody [17,105]
+      body[0]: PropertyDefinition [19,30] computed=false static=false
+        key: Identifier [24,25] name="x"
+        value: Literal [28,29] value=1 raw="1"
+        decorators[0]: Decorator [19,23]
+          expression: Identifier [20,23] name="dec"
+      body[1]: AccessorProperty [70,85] computed=false static=false decorators=[]
+        key: Identifier [79,80] name="w"
+        value: Literal [83,84] value=2 raw="2"
+      body[2]: MethodDefinition [97,103] kind="method" computed=false static=false decorators=[]
+        key: Identifier [97,98] name="m"
+        value: FunctionExpression [98,103] id=null expression=false generator=false async=false params=[]
+          body: BlockStatement [101,103] body=[]
+`)
+}
+
+func TestESTreeJSX(t *testing.T) {
+	expectESTreeJSX(t, "<div a=\"b &amp; c\" d={1} e {...f}>text &lt; {g}{/* h */}<i.j /></div>", `Program [0,69] sourceType="script"
+  body[0]: ExpressionStatement [0,69]
+    expression: JSXElement [0,69]
+      openingElement: JSXOpeningElement [0,34] selfClosing=false
+        name: JSXIdentifier [1,4] name="div"
+        attributes[0]: JSXAttribute [5,18]
+          name: JSXIdentifier [5,6] name="a"
+          value: Literal [7,18] value="b & c" raw="\"b &amp; c\""
+        attributes[1]: JSXAttribute [19,24]
+          name: JSXIdentifier [19,20] name="d"
+          value: JSXExpressionContainer [21,24]
+            expression: Literal [22,23] value=1 raw="1"
+        attributes[2]: JSXAttribute [25,26] value=null
+          name: JSXIdentifier [25,26] name="e"
+        attributes[3]: JSXSpreadAttribute [27,33]
+          argument: Identifier [31,32] name="f"
+      children[0]: JSXText [34,44] value="text < " raw="text &lt; "
+      children[1]: JSXExpressionContainer [44,47]
+        expression: Identifier [45,46] name="g"
+      children[2]: JSXExpressionContainer [47,56]
+        expression: JSXEmptyExpression [48,55]
+      children[3]: JSXElement [56,63] children=[] closingElement=null
+        openingElement: JSXOpeningElement [56,63] attributes=[] selfClosing=true
+          name: JSXMemberExpression [57,60]
+            object: JSXIdentifier [57,58] name="i"
+            property: JSXIdentifier [59,60] name="j"
+      closingElement: JSXClosingElement [63,69]
+        name: JSXIdentifier [65,68] name="div"
+`)
+	expectESTreeJSX(t, "<>a {...b}</>", `Program [0,13] sourceType="script"
+  body[0]: ExpressionStatement [0,13]
+    expression: JSXFragment [0,13]
+      openingFragment: JSXOpeningFragment [0,2]
+      children[0]: JSXText [2,4] value="a " raw="a "
+      children[1]: JSXSpreadChild [4,10]
+        expression: Identifier [8,9] name="b"
+      closingFragment: JSXClosingFragment [10,13]
+`)
+	expectESTreeJSX(t, "<a:b c-d:e='f' g=<h/> />", `Program [0,24] sourceType="script"
+  body[0]: ExpressionStatement [0,24]
+    expression: JSXElement [0,24] children=[] closingElement=null
+      openingElement: JSXOpeningElement [0,24] selfClosing=true
+        name: JSXNamespacedName [1,4]
+          namespace: JSXIdentifier [1,2] name="a"
+          name: JSXIdentifier [3,4] name="b"
+        attributes[0]: JSXAttribute [5,14]
+          name: JSXNamespacedName [5,10]
+            namespace: JSXIdentifier [5,8] name="c-d"
+            name: JSXIdentifier [9,10] name="e"
+          value: Literal [11,14] value="f" raw="'f'"
+        attributes[1]: JSXAttribute [15,21]
+          name: JSXIdentifier [15,16] name="g"
+          value: JSXElement [17,21] children=[] closingElement=null
+            openingElement: JSXOpeningElement [17,21] attributes=[] selfClosing=true
+              name: JSXIdentifier [18,19] name="h"
+`)
+}
+
+func TestESTreeLocations(t *testing.T) {
+	expectESTreeLocations := func(contents string, expected string) {
+		t.Helper()
+		t.Run(contents, func(t *testing.T) {
+			t.Helper()
+			js := parseESTreeForTest(t, contents, config.Options{})
+			test.AssertEqualWithDiff(t, string(js), expected)
+		})
+	}
+
+	expectESTreeLocations("\"😀\";\r\nx\u2028y", `{"type":"Program","start":0,"end":10,"loc":{"start":{"line":1,"column":0},"end":{"line":3,"column":1}},"range":[0,10],"body":[{"type":"ExpressionStatement","start":0,"end":5,"loc":{"start":{"line":1,"column":0},"end":{"line":1,"column":5}},"range":[0,5],"expression":{"type":"Literal","start":0,"end":4,"loc":{"start":{"line":1,"column":0},"end":{"line":1,"column":4}},"range":[0,4],"value":"😀","raw":"\"😀\""},"directive":"😀"},{"type":"ExpressionStatement","start":7,"end":8,"loc":{"start":{"line":2,"column":0},"end":{"line":2,"column":1}},"range":[7,8],"expression":{"type":"Identifier","start":7,"end":8,"loc":{"start":{"line":2,"column":0},"end":{"line":2,"column":1}},"range":[7,8],"name":"x"}},{"type":"ExpressionStatement","start":9,"end":10,"loc":{"start":{"line":3,"column":0},"end":{"line":3,"column":1}},"range":[9,10],"expression":{"type":"Identifier","start":9,"end":10,"loc":{"start":{"line":3,"column":0},"end":{"line":3,"column":1}},"range":[9,10],"name":"y"}}],"sourceType":"script"}`)
+}
+
+func TestESTreeErrors(t *testing.T) {
+	log := logger.NewDeferLog(logger.DeferLogNoVerboseOrDebug, nil)
+	_, ok := ParseESTree(log, test.SourceForTest("let x = ("), OptionsFromConfig(&config.Options{}))
+	if ok {
+		t.Fatal("Expected a parse error")
+	}
+	test.AssertEqualWithDiff(t, len(log.Done()), 1)
+}
@@ -7,6 +7,7 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"unicode/utf8"
 
 	"github.com/ije/esbuild-internal/ast"
@@ -65,6 +66,9 @@ type parser struct {
 	scopesInOrderForEnum       map[logger.Loc][]scopeOrder
 	binaryExprStack            []binaryExprVisitor
 
+	// This is only present when the parser is producing an ESTree AST
+	estree *estreeRanges
+
 	// For strict mode handling
 	hoistedRefForSloppyModeBlockFn map[ast.Ref]ast.Ref
 
@@ -491,6 +495,7 @@ type optionsThatSupportStructuralEquality struct {
 	treeShaking            bool
 	dropDebugger           bool
 	mangleQuoted           bool
+	hotModuleReplacement   bool
 
 	// This is an internal-only option used for the implementation of Yarn PnP
 	decodeHydrateRuntimeStateYarnPnP bool
@@ -537,6 +542,7 @@ func OptionsFromConfig(options *config.Options) Options {
 			mangleQuoted:                      options.MangleQuoted,
 			logPathStyle:                      options.LogPathStyle,
 			codePathStyle:                     options.CodePathStyle,
+			hotModuleReplacement:              options.HotModuleReplacement,
 		},
 	}
 }
@@ -618,6 +624,203 @@ func jsxExprsEqual(a config.DefineExpr, b config.DefineExpr) bool {
 	return true
 }
 
+// Parse results can be saved to disk and reused by a later build, in which
+// case the "Equal" check above isn't possible. Instead this writes out all
+// options that can affect the parse result (including the log messages) so
+// that they can be hashed and made part of the cache key. This returns false
+// if the options can't be fingerprinted.
+//
+// Remember to update this when adding new options.
+func (o *Options) Fingerprint(w *helpers.BinaryWriter, definesCache *DefinesFingerprintCache) bool {
+	// Write out "optionsThatSupportStructuralEquality"
+	w.WriteString(o.originalTargetEnv)
+	w.WriteBool(o.moduleTypeData.Source != nil)
+	if source := o.moduleTypeData.Source; source != nil {
+		fingerprintSource(w, source)
+	}
+	w.WriteVarint(int64(o.moduleTypeData.Range.Loc.Start))
+	w.WriteVarint(int64(o.moduleTypeData.Range.Len))
+	w.WriteUint8(uint8(o.moduleTypeData.Type))
+	w.WriteUvarint(uint64(o.unsupportedJSFeatures))
+	w.WriteUvarint(uint64(o.unsupportedJSFeatureOverrides))
+	w.WriteUvarint(uint64(o.unsupportedJSFeatureOverridesMask))
+	w.WriteUint8(uint8(o.ts.Config.ExperimentalDecorators))
+	w.WriteUint8(uint8(o.ts.Config.ImportsNotUsedAsValues))
+	w.WriteUint8(uint8(o.ts.Config.PreserveValueImports))
+	w.WriteUint8(uint8(o.ts.Config.Target))
+	w.WriteUint8(uint8(o.ts.Config.UseDefineForClassFields))
+	w.WriteUint8(uint8(o.ts.Config.VerbatimModuleSyntax))
+	w.WriteBool(o.ts.Parse)
+	w.WriteBool(o.ts.NoAmbiguousLessThan)
+	w.WriteUint8(uint8(o.mode))
+	w.WriteUint8(uint8(o.platform))
+	w.WriteUint8(uint8(o.outputFormat))
+	w.WriteUint8(uint8(o.logPathStyle))
+	w.WriteUint8(uint8(o.codePathStyle))
+	w.WriteBool(o.asciiOnly)
+	w.WriteBool(o.keepNames)
+	w.WriteBool(o.minifySyntax)
+	w.WriteBool(o.minifyIdentifiers)
+	w.WriteBool(o.minifyWhitespace)
+	w.WriteBool(o.omitRuntimeForTests)
+	w.WriteBool(o.omitJSXRuntimeForTests)
+	w.WriteBool(o.ignoreDCEAnnotations)
+	w.WriteBool(o.treeShaking)
+	w.WriteBool(o.dropDebugger)
+	w.WriteBool(o.mangleQuoted)
+	w.WriteBool(o.hotModuleReplacement)
+	w.WriteBool(o.decodeHydrateRuntimeStateYarnPnP)
+
+	// Write out "tsAlwaysStrict"
+	w.WriteBool(o.tsAlwaysStrict != nil)
+	if o.tsAlwaysStrict != nil {
+		w.WriteString(o.tsAlwaysStrict.Name)
+		fingerprintSource(w, &o.tsAlwaysStrict.Source)
+		w.WriteVarint(int64(o.tsAlwaysStrict.Range.Loc.Start))
+		w.WriteVarint(int64(o.tsAlwaysStrict.Range.Len))
+		w.WriteBool(o.tsAlwaysStrict.Value)
+	}
+
+	// Write out "mangleProps" and "reserveProps"
+	for _, re := range [2]*regexp.Regexp{o.mangleProps, o.reserveProps} {
+		w.WriteBool(re != nil)
+		if re != nil {
+			w.WriteString(re.String())
+		}
+	}
+
+	// Write out "dropLabels"
+	w.WriteUvarint(uint64(len(o.dropLabels)))
+	for _, label := range o.dropLabels {
+		w.WriteString(label)
+	}
+
+	// Write out "injectedFiles"
+	w.WriteUvarint(uint64(len(o.injectedFiles)))
+	for _, file := range o.injectedFiles {
+		fingerprintSource(w, &file.Source)
+		w.WriteString(file.DefineName)
+		w.WriteBool(file.IsCopyLoader)
+		w.WriteUvarint(uint64(len(file.Exports)))
+		for _, export := range file.Exports {
+			w.WriteString(export.Alias)
+			w.WriteVarint(int64(export.Loc.Start))
+		}
+	}
+
+	// Write out "jsx"
+	if !fingerprintDefineExpr(w, &o.jsx.Factory) || !fingerprintDefineExpr(w, &o.jsx.Fragment) {
+		return false
+	}
+	w.WriteBool(o.jsx.Parse)
+	w.WriteBool(o.jsx.Preserve)
+	w.WriteBool(o.jsx.AutomaticRuntime)
+	w.WriteString(o.jsx.ImportSource)
+	w.WriteBool(o.jsx.Development)
+	w.WriteBool(o.jsx.SideEffects)
+
+	// Write out "defines"
+	bytes, ok := definesCache.fingerprint(o.defines)
+	w.WriteString(string(bytes))
+	return ok
+}
+
+// Fingerprinting the defines is relatively expensive since there are hundreds
+// of known globals. But every file in a build uses the same defines, so the
+// result for the most recent defines is remembered here.
+type DefinesFingerprintCache struct {
+	defines *config.ProcessedDefines
+	bytes   []byte
+	ok      bool
+	mutex   sync.Mutex
+}
+
+func (c *DefinesFingerprintCache) fingerprint(defines *config.ProcessedDefines) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.defines == defines && c.bytes != nil {
+		return c.bytes, c.ok
+	}
+
+	w := helpers.BinaryWriter{}
+	ok := true
+	w.WriteBool(defines != nil)
+	if defines != nil {
+		keys := make([]string, 0, len(defines.IdentifierDefines))
+		for key := range defines.IdentifierDefines {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		w.WriteUvarint(uint64(len(keys)))
+		for _, key := range keys {
+			define := defines.IdentifierDefines[key]
+			w.WriteString(key)
+			if !fingerprintDefineData(&w, &define) {
+				ok = false
+			}
+		}
+
+		keys = keys[:0]
+		for key := range defines.DotDefines {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		w.WriteUvarint(uint64(len(keys)))
+		for _, key := range keys {
+			list := defines.DotDefines[key]
+			w.WriteString(key)
+			w.WriteUvarint(uint64(len(list)))
+			for i := range list {
+				if !fingerprintDefineData(&w, &list[i]) {
+					ok = false
+				}
+			}
+		}
+	}
+
+	c.defines = defines
+	c.bytes = w.Bytes()
+	c.ok = ok
+	return c.bytes, c.ok
+}
+
+func fingerprintDefineData(w *helpers.BinaryWriter, define *config.DefineData) bool {
+	w.WriteUvarint(uint64(len(define.KeyParts)))
+	for _, part := range define.KeyParts {
+		w.WriteString(part)
+	}
+	w.WriteUint8(uint8(define.Flags))
+	w.WriteBool(define.DefineExpr != nil)
+	if define.DefineExpr != nil {
+		return fingerprintDefineExpr(w, define.DefineExpr)
+	}
+	return true
+}
+
+func fingerprintDefineExpr(w *helpers.BinaryWriter, expr *config.DefineExpr) bool {
+	w.WriteUvarint(uint64(len(expr.Parts)))
+	for _, part := range expr.Parts {
+		w.WriteString(part)
+	}
+	if expr.InjectedDefineIndex.IsValid() {
+		w.WriteUvarint(uint64(expr.InjectedDefineIndex.GetIndex()) + 1)
+	} else {
+		w.WriteUvarint(0)
+	}
+	return js_ast.EncodeExpr(w, js_ast.Expr{Data: expr.Constant}, 0)
+}
+
+func fingerprintSource(w *helpers.BinaryWriter, source *logger.Source) {
+	w.WriteString(source.KeyPath.Text)
+	w.WriteString(source.KeyPath.Namespace)
+	w.WriteString(source.KeyPath.IgnoredSuffix)
+	w.WriteString(source.PrettyPaths.Abs)
+	w.WriteString(source.PrettyPaths.Rel)
+	w.WriteString(source.IdentifierName)
+	w.WriteString(source.Contents)
+	w.WriteUvarint(uint64(source.Index))
+}
+
 type tempRef struct {
 	valueOrNil js_ast.Expr
 	ref        ast.Ref
@@ -2168,7 +2371,6 @@ type propertyOpts struct {
 	decoratorContext decoratorContextFlags
 
 	asyncRange     logger.Range
-	generatorRange logger.Range
 	tsDeclareRange logger.Range
 	classKeyword   logger.Range
 	isAsync        bool
@@ -2252,7 +2454,6 @@ func (p *parser) parseProperty(startLoc logger.Loc, kind js_ast.PropertyKind, op
 			p.lexer.Unexpected()
 		}
 		opts.isGenerator = true
-		opts.generatorRange = p.lexer.Range()
 		p.lexer.Next()
 		return p.parseProperty(startLoc, js_ast.PropertyMethod, opts, errors)
 
@@ -2577,14 +2778,6 @@ func (p *parser) parseProperty(startLoc logger.Loc, kind js_ast.PropertyKind, op
 			hasError = true
 		}
 
-		if opts.isAsync && p.markAsyncFn(opts.asyncRange, opts.isGenerator) {
-			hasError = true
-		}
-
-		if !hasError && opts.isGenerator && p.markSyntaxFeature(compat.Generator, opts.generatorRange) {
-			hasError = true
-		}
-
 		if !hasError && p.lexer.Token == js_lexer.TOpenParen && kind != js_ast.PropertyGetter && kind != js_ast.PropertySetter && p.markSyntaxFeature(compat.ObjectExtensions, p.lexer.Range()) {
 			hasError = true
 		}
@@ -3044,7 +3237,6 @@ func (p *parser) parseAsyncPrefixExpr(asyncRange logger.Range, level js_ast.L, f
 				}
 
 				if isArrowFn {
-					p.markAsyncFn(asyncRange, false)
 					ref := p.storeNameInRef(p.lexer.Identifier)
 					arg := js_ast.Arg{Binding: js_ast.Binding{Loc: p.lexer.Loc(), Data: &js_ast.BIdentifier{Ref: ref}}}
 					p.lexer.Next()
@@ -3091,14 +3283,7 @@ func (p *parser) parseAsyncPrefixExpr(asyncRange logger.Range, level js_ast.L, f
 func (p *parser) parseFnExpr(loc logger.Loc, isAsync bool, asyncRange logger.Range) js_ast.Expr {
 	p.lexer.Next()
 	isGenerator := p.lexer.Token == js_lexer.TAsterisk
-	hasError := false
-	if isAsync {
-		hasError = p.markAsyncFn(asyncRange, isGenerator)
-	}
 	if isGenerator {
-		if !hasError {
-			p.markSyntaxFeature(compat.Generator, p.lexer.Range())
-		}
 		p.lexer.Next()
 	}
 	var name *ast.LocRef
@@ -3226,6 +3411,7 @@ func (p *parser) parseParenExpr(loc logger.Loc, level js_ast.L, opts parenExprOp
 
 	// The parenthetical construct must end with a close parenthesis
 	p.lexer.Expect(js_lexer.TCloseParen)
+	parenRange := logger.Range{Loc: loc, Len: p.lexer.PrevTokenEnd() - loc.Start}
 
 	// Restore "in" operator status before we parse the arrow function body
 	p.allowIn = oldAllowIn
@@ -3244,10 +3430,6 @@ func (p *parser) parseParenExpr(loc logger.Loc, level js_ast.L, opts parenExprOp
 		var invalidLog invalidLog
 		args := []js_ast.Arg{}
 
-		if isAsync {
-			p.markAsyncFn(opts.asyncRange, false)
-		}
-
 		// First, try converting the expressions to bindings
 		for _, item := range items {
 			isSpread := false
@@ -3350,6 +3532,9 @@ func (p *parser) parseParenExpr(loc logger.Loc, level js_ast.L, opts parenExprOp
 		}
 		value := js_ast.JoinAllWithComma(items)
 		p.markExprAsParenthesized(value, loc, isAsync)
+		if p.estree != nil {
+			p.estree.recordExpr(value, parenRange)
+		}
 		return value
 	}
 
@@ -3539,6 +3724,9 @@ func (p *parser) parsePrefix(level js_ast.L, errors *deferredErrors, flags exprF
 			}
 
 			p.lexer.Expect(js_lexer.TCloseParen)
+			if p.estree != nil {
+				p.estree.recordExpr(value, logger.Range{Loc: loc, Len: p.lexer.PrevTokenEnd() - loc.Start})
+			}
 
 			p.allowIn = oldAllowIn
 			return value
@@ -4229,6 +4417,7 @@ func (p *parser) parseExprWithFlags(level js_ast.L, flags exprFlag) js_ast.Expr
 }
 
 func (p *parser) parseExprCommon(level js_ast.L, errors *deferredErrors, flags exprFlag) js_ast.Expr {
+	loc := p.lexer.Loc()
 	lexerCommentFlags := p.lexer.HasCommentBefore
 	expr := p.parsePrefix(level, errors, flags)
 
@@ -4257,7 +4446,12 @@ func (p *parser) parseExprCommon(level js_ast.L, errors *deferredErrors, flags e
 		}
 	}
 
-	return p.parseSuffix(expr, level, errors, flags)
+	expr = p.parseSuffix(expr, level, errors, flags)
+	if p.estree != nil {
+		// This includes syntax that isn't in the AST such as TypeScript casts
+		p.estree.recordExpr(expr, logger.Range{Loc: loc, Len: p.lexer.PrevTokenEnd() - loc.Start})
+	}
+	return expr
 }
 
 func (p *parser) parseSuffix(left js_ast.Expr, level js_ast.L, errors *deferredErrors, flags exprFlag) js_ast.Expr {
@@ -6522,6 +6716,9 @@ func (p *parser) parseClass(classKeyword logger.Range, name *ast.LocRef, classOp
 		// This property may turn out to be a type in TypeScript, which should be ignored
 		if property, ok := p.parseProperty(p.saveExprCommentsHere(), js_ast.PropertyField, opts, nil); ok {
 			properties = append(properties, property)
+			if p.estree != nil {
+				p.estree.properties[property.Loc] = logger.Range{Loc: firstDecoratorLoc, Len: p.lexer.PrevTokenEnd() - firstDecoratorLoc.Start}
+			}
 
 			// Forbid decorators on class constructors
 			if key, ok := property.Key.Data.(*js_ast.EString); ok && helpers.UTF16EqualsString(key.Value, "constructor") {
@@ -6725,14 +6922,7 @@ func (p *parser) maybeWarnAboutAssertKeyword(loc logger.Loc) {
 // This assumes the "function" token has already been parsed
 func (p *parser) parseFnStmt(loc logger.Loc, opts parseStmtOpts, isAsync bool, asyncRange logger.Range) js_ast.Stmt {
 	isGenerator := p.lexer.Token == js_lexer.TAsterisk
-	hasError := false
-	if isAsync {
-		hasError = p.markAsyncFn(asyncRange, isGenerator)
-	}
 	if isGenerator {
-		if !hasError {
-			p.markSyntaxFeature(compat.Generator, p.lexer.Range())
-		}
 		p.lexer.Next()
 	}
 
@@ -7059,6 +7249,19 @@ type parseStmtOpts struct {
 }
 
 func (p *parser) parseStmt(opts parseStmtOpts) js_ast.Stmt {
+	if p.estree == nil {
+		return p.parseStmtWithoutRange(opts)
+	}
+
+	// Statements don't store where they end, and trailing syntax such as
+	// semicolons and TypeScript type annotations isn't in the AST
+	loc := p.lexer.Loc()
+	stmt := p.parseStmtWithoutRange(opts)
+	p.estree.stmts[stmt] = logger.Range{Loc: loc, Len: p.lexer.PrevTokenEnd() - loc.Start}
+	return stmt
+}
+
+func (p *parser) parseStmtWithoutRange(opts parseStmtOpts) js_ast.Stmt {
 	loc := p.lexer.Loc()
 
 	if (p.lexer.HasCommentBefore & js_lexer.NoSideEffectsCommentBefore) != 0 {
@@ -7753,16 +7956,9 @@ func (p *parser) parseStmt(opts parseStmtOpts) js_ast.Stmt {
 				p.log.AddError(&p.tracker, awaitRange, "Cannot use \"await\" outside an async function")
 				awaitRange = logger.Range{}
 			} else {
-				didGenerateError := false
 				if p.fnOrArrowDataParse.isTopLevel {
 					p.topLevelAwaitKeyword = awaitRange
 				}
-				if !didGenerateError && p.options.unsupportedJSFeatures.Has(compat.AsyncAwait) && p.options.unsupportedJSFeatures.Has(compat.Generator) {
-					// If for-await loops aren't supported, then we only support lowering
-					// if either async/await or generators is supported. Otherwise we
-					// cannot lower for-await loops.
-					p.markSyntaxFeature(compat.ForAwait, awaitRange)
-				}
 			}
 			p.lexer.Next()
 		}
@@ -7830,7 +8026,10 @@ func (p *parser) parseStmt(opts parseStmtOpts) js_ast.Stmt {
 				}
 			}
 			p.forbidInitializers(decls, "of", false)
-			p.markSyntaxFeature(compat.ForOf, p.lexer.Range())
+			if awaitRange.Len == 0 {
+				// For-await loops don't need for-of loops when they are lowered
+				p.markSyntaxFeature(compat.ForOf, p.lexer.Range())
+			}
 			p.lexer.Next()
 			value := p.parseExpr(js_ast.LComma)
 			p.lexer.Expect(js_lexer.TCloseParen)
@@ -14280,6 +14479,16 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 			}
 		}
 
+		// Each module gets its own "import.meta.hot" object for hot module
+		// replacement. This must be checked before visiting "import.meta" since
+		// that may be replaced with an empty object in some output formats.
+		if p.options.hotModuleReplacement && e.Name == "hot" && in.assignTarget == js_ast.AssignTargetNone {
+			if _, ok := e.Target.Data.(*js_ast.EImportMeta); ok {
+				id := p.source.PrettyPaths.Select(p.options.codePathStyle)
+				return p.callRuntime(expr.Loc, "__hmrHot", []js_ast.Expr{{Loc: expr.Loc, Data: &js_ast.EString{Value: helpers.StringToUTF16(id)}}}), exprOut{}
+			}
+		}
+
 		// Track ".then().catch()" chains
 		if isCallTarget && p.thenCatchChain.nextTarget == e {
 			if e.Name == "catch" {
@@ -14782,7 +14991,7 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 		}
 
 		// "yield* x" turns into "yield* __yieldStar(x)" when lowering async generator functions
-		if e.IsStar && p.options.unsupportedJSFeatures.Has(compat.AsyncGenerator) && p.fnOrArrowDataVisit.isGenerator {
+		if e.IsStar && p.options.unsupportedJSFeatures.Has(compat.AsyncGenerator) && p.fnOrArrowDataVisit.isAsync && p.fnOrArrowDataVisit.isGenerator {
 			e.ValueOrNil = p.callRuntime(expr.Loc, "__yieldStar", []js_ast.Expr{e.ValueOrNil})
 		}
 
@@ -14900,12 +15109,13 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 				oldIsInStaticClassContext := p.fnOnlyDataVisit.isInStaticClassContext
 				oldInnerClassNameRef := p.fnOnlyDataVisit.innerClassNameRef
 
-				// If this is an async method and async methods are unsupported,
-				// generate a temporary variable in case this async method contains a
-				// "super" property reference. If that happens, the "super" expression
-				// must be lowered which will need a reference to this object literal.
-				if property.Kind == js_ast.PropertyMethod && p.options.unsupportedJSFeatures.Has(compat.AsyncAwait) {
-					if fn, ok := property.ValueOrNil.Data.(*js_ast.EFunction); ok && fn.Fn.IsAsync {
+				// If this is an async method or a generator method and those are
+				// unsupported, generate a temporary variable in case this method
+				// contains a "super" property reference. If that happens, the "super"
+				// expression must be lowered which will need a reference to this
+				// object literal.
+				if property.Kind == js_ast.PropertyMethod {
+					if fn, ok := property.ValueOrNil.Data.(*js_ast.EFunction); ok && p.fnMovesBodyWhenLowered(&fn.Fn) {
 						if innerClassNameRef == ast.InvalidRef {
 							innerClassNameRef = p.generateTempRef(tempRefNeedsDeclareMayBeCapturedInsideLoop, "")
 						}
@@ -15777,8 +15987,13 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 
 		e.Target = p.visitExpr(e.Target)
 		p.warnAboutImportNamespaceCall(e.Target, exprKindNew)
+		p.maybeRecordNewURL(e)
 
 		for i, arg := range e.Args {
+			// The path in "new URL('./file', import.meta.url)" has already been handled
+			if _, ok := arg.Data.(*js_ast.EURLString); ok {
+				continue
+			}
 			arg = p.visitExpr(arg)
 			if _, ok := arg.Data.(*js_ast.ESpread); ok {
 				hasSpread = true
@@ -15786,6 +16001,8 @@ func (p *parser) visitExprInOut(expr js_ast.Expr, in exprIn) (js_ast.Expr, exprO
 			e.Args[i] = arg
 		}
 
+		p.maybeMarkNewURLAsWorker(e)
+
 		// "new foo(1, ...[2, 3], 4)" => "new foo(1, 2, 3, 4)"
 		if p.options.minifySyntax && hasSpread {
 			e.Args = js_ast.InlineSpreadsOfArrayLiterals(e.Args)
@@ -16875,6 +17092,72 @@ func (p *parser) warnAboutImportNamespaceCall(target js_ast.Expr, kind importNam
 	}
 }
 
+// This recognizes "new URL('./file', import.meta.url)" expressions, which
+// reference a file relative to the current module. The path is turned into an
+// import record so that the bundler can substitute the path of the output file
+// instead. Only relative paths are handled since other URLs don't reference a
+// file next to the current module. This must be called after the target has
+// been visited but before the arguments have been visited.
+func (p *parser) maybeRecordNewURL(e *js_ast.ENew) {
+	if p.options.mode == config.ModePassThrough || p.isControlFlowDead || len(e.Args) != 2 {
+		return
+	}
+
+	// The target must be the global "URL" constructor
+	id, ok := e.Target.Data.(*js_ast.EIdentifier)
+	if !ok {
+		return
+	}
+	if symbol := p.symbols[id.Ref.InnerIndex]; symbol.Kind != ast.SymbolUnbound || symbol.OriginalName != "URL" {
+		return
+	}
+
+	// The base must be "import.meta.url"
+	dot, ok := e.Args[1].Data.(*js_ast.EDot)
+	if !ok || dot.Name != "url" || dot.OptionalChain != js_ast.OptionalChainNone {
+		return
+	}
+	if _, ok := dot.Target.Data.(*js_ast.EImportMeta); !ok {
+		return
+	}
+
+	// The path must be a relative path in a string literal
+	str, ok := e.Args[0].Data.(*js_ast.EString)
+	if !ok {
+		return
+	}
+	path := helpers.UTF16ToString(str.Value)
+	if !strings.HasPrefix(path, "./") && !strings.HasPrefix(path, "../") {
+		return
+	}
+
+	importRecordIndex := p.addImportRecord(ast.ImportNewURL, ast.EvaluationPhase, p.source.RangeOfString(e.Args[0].Loc), path, nil, 0)
+	p.importRecordsForCurrentPart = append(p.importRecordsForCurrentPart, importRecordIndex)
+	e.Args[0] = js_ast.Expr{Loc: e.Args[0].Loc, Data: &js_ast.EURLString{ImportRecordIndex: importRecordIndex}}
+}
+
+// This recognizes "new Worker(new URL('./file', import.meta.url))" expressions
+// (and the same for "SharedWorker"). The referenced file becomes an additional
+// entry point instead of an asset when bundling.
+func (p *parser) maybeMarkNewURLAsWorker(e *js_ast.ENew) {
+	if len(e.Args) == 0 {
+		return
+	}
+	id, ok := e.Target.Data.(*js_ast.EIdentifier)
+	if !ok {
+		return
+	}
+	if symbol := p.symbols[id.Ref.InnerIndex]; symbol.Kind != ast.SymbolUnbound ||
+		(symbol.OriginalName != "Worker" && symbol.OriginalName != "SharedWorker") {
+		return
+	}
+	if url, ok := e.Args[0].Data.(*js_ast.ENew); ok && len(url.Args) > 0 {
+		if str, ok := url.Args[0].Data.(*js_ast.EURLString); ok {
+			p.importRecords[str.ImportRecordIndex].Kind = ast.ImportNewWorker
+		}
+	}
+}
+
 func (p *parser) maybeMarkKnownGlobalConstructorAsPure(e *js_ast.ENew) {
 	if id, ok := e.Target.Data.(*js_ast.EIdentifier); ok {
 		if symbol := p.symbols[id.Ref.InnerIndex]; symbol.Kind == ast.SymbolUnbound {
@@ -17159,7 +17442,7 @@ func (p *parser) visitFn(fn *js_ast.Fn, scopeLoc logger.Loc, opts visitFnOpts) {
 		isAsync:                        fn.IsAsync,
 		isGenerator:                    fn.IsGenerator,
 		isDerivedClassCtor:             opts.isDerivedClassCtor,
-		shouldLowerSuperPropertyAccess: (fn.IsAsync && p.options.unsupportedJSFeatures.Has(compat.AsyncAwait)) || opts.isLoweredPrivateMethod,
+		shouldLowerSuperPropertyAccess: p.fnMovesBodyWhenLowered(fn) || opts.isLoweredPrivateMethod,
 	}
 	p.fnOnlyDataVisit = fnOnlyDataVisit{
 		isThisNested:       true,
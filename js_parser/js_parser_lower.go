@@ -63,18 +63,6 @@ func (p *parser) markSyntaxFeature(feature compat.JSFeature, r logger.Range) (di
 	case compat.Class:
 		name = "class syntax"
 
-	case compat.Generator:
-		name = "generator functions"
-
-	case compat.AsyncAwait:
-		name = "async functions"
-
-	case compat.AsyncGenerator:
-		name = "async generator functions"
-
-	case compat.ForAwait:
-		name = "for-await loops"
-
 	case compat.NestedRestBinding:
 		name = "non-identifier array rest patterns"
 
@@ -134,7 +122,7 @@ func (p *parser) isStrictMode() bool {
 }
 
 func (p *parser) isStrictModeOutputFormat() bool {
-	return p.options.outputFormat == config.FormatESModule
+	return p.options.outputFormat.IsESMCompatible()
 }
 
 type strictModeFeature uint8
@@ -235,20 +223,11 @@ func (p *parser) whyStrictMode(scope *js_ast.Scope) (where string, notes []logge
 	return
 }
 
-func (p *parser) markAsyncFn(asyncRange logger.Range, isGenerator bool) (didGenerateError bool) {
-	// Lowered async functions are implemented in terms of generators. So if
-	// generators aren't supported, async functions aren't supported either.
-	// But if generators are supported, then async functions are unconditionally
-	// supported because we can use generators to implement them.
-	if !p.options.unsupportedJSFeatures.Has(compat.Generator) {
-		return false
-	}
-
-	feature := compat.AsyncAwait
-	if isGenerator {
-		feature = compat.AsyncGenerator
-	}
-	return p.markSyntaxFeature(feature, asyncRange)
+// Lowering async functions and generator functions moves the function body
+// into a nested function, so "super" can no longer be used in the body
+func (p *parser) fnMovesBodyWhenLowered(fn *js_ast.Fn) bool {
+	return (fn.IsAsync && p.options.unsupportedJSFeatures.Has(compat.AsyncAwait)) ||
+		(fn.IsGenerator && p.options.unsupportedJSFeatures.Has(compat.Generator))
 }
 
 func (p *parser) captureThis() ast.Ref {
@@ -369,6 +348,13 @@ func (p *parser) lowerFunction(
 		}
 		bodyBlock.Stmts = nil
 
+		// The nested generator function must also be lowered if generator
+		// functions aren't supported
+		if p.options.unsupportedJSFeatures.Has(compat.Generator) {
+			fn.IsGenerator = false
+			p.lowerGeneratorBody(bodyLoc, &fn.Body.Block)
+		}
+
 		// Errors thrown during argument evaluation must reject the
 		// resulting promise, which needs more complex code to handle
 		couldThrowErrors := false
@@ -490,6 +476,12 @@ func (p *parser) lowerFunction(
 		})
 		bodyBlock.Stmts = []js_ast.Stmt{{Loc: bodyLoc, Data: &js_ast.SReturn{ValueOrNil: callAsync}}}
 	}
+
+	// Lower generator functions
+	if isGenerator != nil && *isGenerator && p.options.unsupportedJSFeatures.Has(compat.Generator) {
+		*isGenerator = false
+		p.lowerGeneratorBody(bodyLoc, bodyBlock)
+	}
 }
 
 func (p *parser) lowerOptionalChain(expr js_ast.Expr, in exprIn, childOut exprOut) (js_ast.Expr, exprOut) {
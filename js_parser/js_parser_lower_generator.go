@@ -0,0 +1,1528 @@
+// This file contains code for lowering generator functions to ES5. Generator
+// functions are converted into state machines that are driven by the
+// "__generate" runtime helper. Lowered async functions and async generator
+// functions are implemented in terms of generator functions, so this also
+// makes it possible to use those when targeting ES5.
+//
+// This code:
+//
+//   function* foo(x) {
+//     try {
+//       var y = yield x
+//     } finally {
+//       bar()
+//     }
+//     return y
+//   }
+//
+// is transformed into the following code:
+//
+//   function foo(x) {
+//     var y;
+//     return __generate(this, function (_) {
+//       switch (_.n) {
+//         case 0:
+//           _.t.push([, 2]);
+//           return [5, x, 1];
+//         case 1:
+//           y = _.v;
+//           return [3, 3];
+//         case 2:
+//           bar();
+//           return [4];
+//         case 3:
+//           return [2, y];
+//       }
+//     });
+//   }
+//
+// The state machine function is called with the current state each time the
+// generator resumes. It runs until it returns one of the following operations
+// back to the runtime helper:
+//
+//   [2, value]                 Return "value" after running "finally" blocks
+//   [3, label, depth]          Jump to "label" after running the "finally"
+//                              blocks of try statements deeper than "depth"
+//   [4]                        End of a "finally" block
+//   [5, value, label]          Yield "value" and resume at "label"
+//   [6, iterable, label]       Delegate to "iterable" and resume at "label"
+//
+// The state object has the label to resume at in "n", the value sent to the
+// generator (or the caught exception) in "v", and the stack of active try
+// statements in "t". Each try statement pushes "[catchLabel, finallyLabel]"
+// onto that stack when it's entered.
+
+package js_parser
+
+import (
+	"fmt"
+
+	"github.com/ije/esbuild-internal/ast"
+	"github.com/ije/esbuild-internal/config"
+	"github.com/ije/esbuild-internal/js_ast"
+	"github.com/ije/esbuild-internal/logger"
+)
+
+var generatorCompoundAssignOps = map[js_ast.OpCode]js_ast.OpCode{
+	js_ast.BinOpAddAssign:        js_ast.BinOpAdd,
+	js_ast.BinOpSubAssign:        js_ast.BinOpSub,
+	js_ast.BinOpMulAssign:        js_ast.BinOpMul,
+	js_ast.BinOpDivAssign:        js_ast.BinOpDiv,
+	js_ast.BinOpRemAssign:        js_ast.BinOpRem,
+	js_ast.BinOpPowAssign:        js_ast.BinOpPow,
+	js_ast.BinOpShlAssign:        js_ast.BinOpShl,
+	js_ast.BinOpShrAssign:        js_ast.BinOpShr,
+	js_ast.BinOpUShrAssign:       js_ast.BinOpUShr,
+	js_ast.BinOpBitwiseOrAssign:  js_ast.BinOpBitwiseOr,
+	js_ast.BinOpBitwiseAndAssign: js_ast.BinOpBitwiseAnd,
+	js_ast.BinOpBitwiseXorAssign: js_ast.BinOpBitwiseXor,
+}
+
+const (
+	generatorOpReturn     = 2
+	generatorOpJump       = 3
+	generatorOpEndFinally = 4
+	generatorOpYield      = 5
+	generatorOpYieldStar  = 6
+)
+
+type generatorLowering struct {
+	p *parser
+
+	// This is the parameter of the state machine function
+	stateRef ast.Ref
+
+	// If the function body uses "arguments", it must be captured outside of
+	// the state machine function since that introduces a new "arguments"
+	argumentsRef         ast.Ref
+	originalArgumentsRef ast.Ref
+
+	// Each entry is the body of a "case" clause in the state machine
+	cases [][]js_ast.Stmt
+
+	// Labels are allocated before they are placed. This maps each label to
+	// the "case" clause it was placed at. References to labels are number
+	// literals that are filled in once all labels have been placed.
+	labels    []int
+	labelUses []generatorLabelUse
+
+	targets       []generatorJumpTarget
+	hoistedRefs   []ast.Ref
+	hoistedRefSet map[ast.Ref]bool
+	hoistedFns    []js_ast.Stmt
+	tryDepth      int
+	isUnreachable bool
+}
+
+type generatorLabelUse struct {
+	number *js_ast.ENumber
+	label  int
+}
+
+// This represents a statement that "break" or "continue" can jump to
+type generatorJumpTarget struct {
+	labelRef      ast.Ref
+	breakLabel    int
+	continueLabel int
+	tryDepth      int
+
+	// Native targets are statements that were copied over into the state
+	// machine as-is because they don't contain any "yield" expressions. Jumps
+	// to these targets can also be left as-is.
+	isNative bool
+
+	isLoop   bool
+	isSwitch bool
+}
+
+// This replaces the body of a generator function with a call to the
+// "__generate" runtime helper. The caller is responsible for removing the
+// generator flag from the function itself.
+func (p *parser) lowerGeneratorBody(bodyLoc logger.Loc, bodyBlock *js_ast.SBlock) {
+	g := generatorLowering{
+		p:             p,
+		stateRef:      p.newSymbol(ast.SymbolOther, "_"),
+		argumentsRef:  ast.InvalidRef,
+		cases:         [][]js_ast.Stmt{nil},
+		hoistedRefSet: make(map[ast.Ref]bool),
+	}
+	p.currentScope.Generated = append(p.currentScope.Generated, g.stateRef)
+
+	// Directives must stay at the start of the original function body
+	stmts := bodyBlock.Stmts
+	var outerStmts []js_ast.Stmt
+	for len(stmts) > 0 {
+		if _, ok := stmts[0].Data.(*js_ast.SDirective); !ok {
+			break
+		}
+		outerStmts = append(outerStmts, stmts[0])
+		stmts = stmts[1:]
+	}
+
+	g.visitStmts(stmts)
+	machine := g.finish(bodyLoc)
+	g.captureArguments(machine)
+
+	// Hoisted declarations go in the original function body since they must
+	// persist across calls to the state machine function
+	outerStmts = append(outerStmts, g.hoistedFns...)
+	var decls []js_ast.Decl
+	if g.argumentsRef != ast.InvalidRef {
+		decls = append(decls, js_ast.Decl{
+			Binding:    js_ast.Binding{Loc: bodyLoc, Data: &js_ast.BIdentifier{Ref: g.argumentsRef}},
+			ValueOrNil: g.ident(bodyLoc, g.originalArgumentsRef),
+		})
+	}
+	for _, ref := range g.hoistedRefs {
+		decls = append(decls, js_ast.Decl{Binding: js_ast.Binding{Loc: bodyLoc, Data: &js_ast.BIdentifier{Ref: ref}}})
+	}
+	if len(decls) > 0 {
+		outerStmts = append(outerStmts, js_ast.Stmt{Loc: bodyLoc, Data: &js_ast.SLocal{Kind: js_ast.LocalVar, Decls: decls}})
+	}
+
+	// "function* foo() { stmts }" => "function foo() { return __generate(this, function (_) { stmts }) }"
+	outerStmts = append(outerStmts, js_ast.Stmt{Loc: bodyLoc, Data: &js_ast.SReturn{ValueOrNil: p.callRuntime(bodyLoc, "__generate", []js_ast.Expr{
+		{Loc: bodyLoc, Data: js_ast.EThisShared},
+		{Loc: bodyLoc, Data: &js_ast.EFunction{Fn: js_ast.Fn{
+			Args:         []js_ast.Arg{{Binding: js_ast.Binding{Loc: bodyLoc, Data: &js_ast.BIdentifier{Ref: g.stateRef}}}},
+			Body:         js_ast.FnBody{Loc: bodyLoc, Block: js_ast.SBlock{Stmts: machine, CloseBraceLoc: bodyBlock.CloseBraceLoc}},
+			ArgumentsRef: ast.InvalidRef,
+		}}},
+	})}})
+	bodyBlock.Stmts = outerStmts
+}
+
+// References to "arguments" inside the state machine function must refer to
+// the arguments of the original function instead
+func (g *generatorLowering) captureArguments(stmts []js_ast.Stmt) {
+	p := g.p
+	generatorWalkStmts(stmts, func(expr *js_ast.Expr) bool {
+		if id, ok := expr.Data.(*js_ast.EIdentifier); ok && p.symbols[id.Ref.InnerIndex].Kind == ast.SymbolArguments {
+			if g.argumentsRef == ast.InvalidRef {
+				g.argumentsRef = p.newSymbol(ast.SymbolOther, "_arguments")
+				g.originalArgumentsRef = id.Ref
+				p.currentScope.Generated = append(p.currentScope.Generated, g.argumentsRef)
+			}
+			p.ignoreUsage(id.Ref)
+			expr.Data = &js_ast.EIdentifier{Ref: g.argumentsRef}
+			p.recordUsage(g.argumentsRef)
+		}
+		return true
+	})
+}
+
+func (g *generatorLowering) finish(loc logger.Loc) []js_ast.Stmt {
+	// Determine which "case" clauses are jumped to
+	isReferenced := make([]bool, len(g.cases))
+	isReferenced[0] = true
+	for _, use := range g.labelUses {
+		isReferenced[g.labels[use.label]] = true
+	}
+
+	// Merge clauses that are never jumped to into the previous clause. If the
+	// previous clause doesn't fall through, the merged code is unreachable.
+	var merged [][]js_ast.Stmt
+	caseIndex := make([]int, len(g.cases))
+	for i, stmts := range g.cases {
+		if isReferenced[i] {
+			caseIndex[i] = len(merged)
+			merged = append(merged, stmts)
+		} else if last := len(merged) - 1; !generatorEndsWithJump(merged[last]) {
+			merged[last] = append(merged[last], stmts...)
+		}
+	}
+	for _, use := range g.labelUses {
+		use.number.Value = float64(caseIndex[g.labels[use.label]])
+	}
+
+	// Falling off the end of the function is an implicit return
+	if last := len(merged) - 1; !generatorEndsWithJump(merged[last]) {
+		merged[last] = append(merged[last], g.op(loc, generatorOpReturn))
+	}
+
+	// Avoid the "switch" statement if there's only one state
+	if len(merged) == 1 {
+		return merged[0]
+	}
+
+	cases := make([]js_ast.Case, len(merged))
+	for i, stmts := range merged {
+		cases[i] = js_ast.Case{
+			Loc:        loc,
+			ValueOrNil: js_ast.Expr{Loc: loc, Data: &js_ast.ENumber{Value: float64(i)}},
+			Body:       stmts,
+		}
+	}
+	return []js_ast.Stmt{{Loc: loc, Data: &js_ast.SSwitch{
+		Test:    g.state(loc, "n"),
+		Cases:   cases,
+		BodyLoc: loc,
+	}}}
+}
+
+func generatorEndsWithJump(stmts []js_ast.Stmt) bool {
+	if len(stmts) > 0 {
+		switch stmts[len(stmts)-1].Data.(type) {
+		case *js_ast.SReturn, *js_ast.SThrow:
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generatorLowering) newLabel() int {
+	label := len(g.labels)
+	g.labels = append(g.labels, -1)
+	return label
+}
+
+func (g *generatorLowering) markLabel(label int) {
+	if len(g.cases[len(g.cases)-1]) > 0 {
+		g.cases = append(g.cases, nil)
+	}
+	g.labels[label] = len(g.cases) - 1
+	g.isUnreachable = false
+}
+
+func (g *generatorLowering) labelExpr(loc logger.Loc, label int) js_ast.Expr {
+	number := &js_ast.ENumber{}
+	g.labelUses = append(g.labelUses, generatorLabelUse{number: number, label: label})
+	return js_ast.Expr{Loc: loc, Data: number}
+}
+
+func (g *generatorLowering) emit(stmt js_ast.Stmt) {
+	// Skip over code that comes after a jump until the next label
+	if g.isUnreachable {
+		return
+	}
+	last := len(g.cases) - 1
+	g.cases[last] = append(g.cases[last], stmt)
+	g.isUnreachable = generatorEndsWithJump(g.cases[last])
+}
+
+func (g *generatorLowering) emitExpr(expr js_ast.Expr) {
+	if !g.isStable(expr) && !g.isSentValue(expr) {
+		g.emit(js_ast.Stmt{Loc: expr.Loc, Data: &js_ast.SExpr{Value: expr}})
+	}
+}
+
+func (g *generatorLowering) op(loc logger.Loc, op int, args ...js_ast.Expr) js_ast.Stmt {
+	items := append([]js_ast.Expr{{Loc: loc, Data: &js_ast.ENumber{Value: float64(op)}}}, args...)
+	return js_ast.Stmt{Loc: loc, Data: &js_ast.SReturn{ValueOrNil: js_ast.Expr{Loc: loc, Data: &js_ast.EArray{Items: items, IsSingleLine: true}}}}
+}
+
+func (g *generatorLowering) jumpStmt(loc logger.Loc, label int, tryDepth int) js_ast.Stmt {
+	if tryDepth > 0 {
+		return g.op(loc, generatorOpJump, g.labelExpr(loc, label), js_ast.Expr{Loc: loc, Data: &js_ast.ENumber{Value: float64(tryDepth)}})
+	}
+	return g.op(loc, generatorOpJump, g.labelExpr(loc, label))
+}
+
+func (g *generatorLowering) jump(loc logger.Loc, label int) {
+	g.emit(g.jumpStmt(loc, label, g.tryDepth))
+}
+
+func (g *generatorLowering) jumpIf(test js_ast.Expr, label int) {
+	if boolean, sideEffects, ok := js_ast.ToBooleanWithSideEffects(test.Data); ok && sideEffects == js_ast.NoSideEffects {
+		if boolean {
+			g.jump(test.Loc, label)
+		}
+		return
+	}
+	g.emit(js_ast.Stmt{Loc: test.Loc, Data: &js_ast.SIf{Test: test, Yes: g.jumpStmt(test.Loc, label, g.tryDepth), IsSingleLineYes: true}})
+}
+
+func (g *generatorLowering) state(loc logger.Loc, name string) js_ast.Expr {
+	g.p.recordUsage(g.stateRef)
+	return js_ast.Expr{Loc: loc, Data: &js_ast.EDot{
+		Target:  js_ast.Expr{Loc: loc, Data: &js_ast.EIdentifier{Ref: g.stateRef}},
+		Name:    name,
+		NameLoc: loc,
+	}}
+}
+
+func (g *generatorLowering) isSentValue(expr js_ast.Expr) bool {
+	if dot, ok := expr.Data.(*js_ast.EDot); ok {
+		if id, ok := dot.Target.Data.(*js_ast.EIdentifier); ok && id.Ref == g.stateRef {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generatorLowering) ident(loc logger.Loc, ref ast.Ref) js_ast.Expr {
+	g.p.recordUsage(ref)
+	return js_ast.Expr{Loc: loc, Data: &js_ast.EIdentifier{Ref: ref}}
+}
+
+// Lexically-scoped declarations are hoisted into the function scope, so they
+// must also be renamed to avoid collisions with other hoisted declarations
+func (g *generatorLowering) hoist(ref ast.Ref, isLexical bool) {
+	if !g.hoistedRefSet[ref] {
+		g.hoistedRefSet[ref] = true
+		g.hoistedRefs = append(g.hoistedRefs, ref)
+		if isLexical {
+			g.p.currentScope.Generated = append(g.p.currentScope.Generated, ref)
+		}
+	}
+}
+
+func (g *generatorLowering) temp() ast.Ref {
+	ref := g.p.generateTempRef(tempRefNoDeclare, "")
+	g.hoist(ref, false)
+	return ref
+}
+
+// Returns true if evaluating this expression later instead of now is
+// guaranteed to produce the same value without any observable difference
+func (g *generatorLowering) isStable(expr js_ast.Expr) bool {
+	switch e := expr.Data.(type) {
+	case *js_ast.ENumber, *js_ast.EString, *js_ast.EBoolean, *js_ast.ENull, *js_ast.EUndefined,
+		*js_ast.EBigInt, *js_ast.EThis, *js_ast.EFunction, *js_ast.EArrow, *js_ast.EMissing:
+		return true
+
+	case *js_ast.EIdentifier:
+		symbol := &g.p.symbols[e.Ref.InnerIndex]
+		return symbol.Kind != ast.SymbolUnbound && !symbol.Flags.Has(ast.CouldPotentiallyBeMutated)
+	}
+	return false
+}
+
+// Stores the value in a temporary variable if it could change before it's used
+func (g *generatorLowering) spill(expr js_ast.Expr) js_ast.Expr {
+	if g.isStable(expr) {
+		return expr
+	}
+	ref := g.temp()
+	g.emitExpr(js_ast.Assign(g.ident(expr.Loc, ref), expr))
+	return g.ident(expr.Loc, ref)
+}
+
+// Returns a copy of an expression where all parts have already been spilled
+func (g *generatorLowering) clone(expr js_ast.Expr) js_ast.Expr {
+	switch e := expr.Data.(type) {
+	case *js_ast.EIdentifier:
+		return g.ident(expr.Loc, e.Ref)
+
+	case *js_ast.EDot:
+		clone := *e
+		clone.Target = g.clone(e.Target)
+		return js_ast.Expr{Loc: expr.Loc, Data: &clone}
+
+	case *js_ast.EIndex:
+		clone := *e
+		clone.Target = g.clone(e.Target)
+		clone.Index = g.clone(e.Index)
+		return js_ast.Expr{Loc: expr.Loc, Data: &clone}
+	}
+	return expr
+}
+
+func (g *generatorLowering) pushTarget(target generatorJumpTarget) {
+	target.tryDepth = g.tryDepth
+	g.targets = append(g.targets, target)
+}
+
+func (g *generatorLowering) popTarget() {
+	g.targets = g.targets[:len(g.targets)-1]
+}
+
+func (g *generatorLowering) findTarget(label *ast.LocRef, isContinue bool) *generatorJumpTarget {
+	for i := len(g.targets) - 1; i >= 0; i-- {
+		target := &g.targets[i]
+		if label != nil {
+			if target.labelRef == label.Ref {
+				return target
+			}
+		} else if target.isLoop || (!isContinue && target.isSwitch) {
+			return target
+		}
+	}
+	return nil
+}
+
+func (g *generatorLowering) unsupported(loc logger.Loc) {
+	p := g.p
+	where := config.PrettyPrintTargetEnvironment(p.options.originalTargetEnv, p.options.unsupportedJSFeatureOverridesMask)
+	p.log.AddError(&p.tracker, logger.Range{Loc: loc}, fmt.Sprintf(
+		"Transforming this use of \"yield\" to %s is not supported yet", where))
+}
+
+func (g *generatorLowering) visitStmts(stmts []js_ast.Stmt) {
+	for _, stmt := range stmts {
+		g.visitStmt(stmt)
+	}
+}
+
+func (g *generatorLowering) visitStmt(stmt js_ast.Stmt) {
+	// Declarations are always hoisted out of the state machine
+	switch s := stmt.Data.(type) {
+	case *js_ast.SLocal:
+		g.visitLocal(s)
+		return
+
+	case *js_ast.SFunction:
+		// Nested function declarations may have been block-scoped
+		g.p.currentScope.Generated = append(g.p.currentScope.Generated, s.Fn.Name.Ref)
+		g.hoistedFns = append(g.hoistedFns, stmt)
+		return
+
+	case *js_ast.SClass:
+		// "class Foo {}" => "Foo = class Foo {}"
+		g.hoist(s.Class.Name.Ref, true)
+		if generatorStmtHasYield(stmt) {
+			g.unsupported(stmt.Loc)
+		}
+		g.emitExpr(js_ast.Assign(g.ident(s.Class.Name.Loc, s.Class.Name.Ref), js_ast.Expr{Loc: stmt.Loc, Data: &js_ast.EClass{Class: s.Class}}))
+		return
+	}
+
+	// Everything else is copied over as-is unless it contains "yield"
+	if !generatorStmtHasYield(stmt) {
+		if stmt = g.copyStmt(stmt); stmt.Data != js_ast.SEmptyShared {
+			g.emit(stmt)
+		}
+		return
+	}
+
+	switch s := stmt.Data.(type) {
+	case *js_ast.SExpr:
+		g.emitExpr(g.visitExpr(s.Value))
+
+	case *js_ast.SBlock:
+		g.visitStmts(s.Stmts)
+
+	case *js_ast.SIf:
+		test := g.visitExpr(s.Test)
+		if !generatorStmtHasYield(s.Yes) && (s.NoOrNil.Data == nil || !generatorStmtHasYield(s.NoOrNil)) {
+			s.Test = test
+			s.Yes = g.copyStmt(s.Yes)
+			if s.NoOrNil.Data != nil {
+				s.NoOrNil = g.copyStmt(s.NoOrNil)
+			}
+			g.emit(stmt)
+			break
+		}
+		end := g.newLabel()
+		if s.NoOrNil.Data == nil {
+			g.jumpIf(js_ast.Not(test), end)
+			g.visitStmt(s.Yes)
+		} else {
+			no := g.newLabel()
+			g.jumpIf(js_ast.Not(test), no)
+			g.visitStmt(s.Yes)
+			g.jump(s.NoOrNil.Loc, end)
+			g.markLabel(no)
+			g.visitStmt(s.NoOrNil)
+		}
+		g.markLabel(end)
+
+	case *js_ast.SLabel:
+		switch s.Stmt.Data.(type) {
+		case *js_ast.SFor, *js_ast.SForIn, *js_ast.SForOf, *js_ast.SWhile, *js_ast.SDoWhile:
+			g.visitLoop(s.Stmt, s.Name.Ref)
+		default:
+			end := g.newLabel()
+			g.pushTarget(generatorJumpTarget{labelRef: s.Name.Ref, breakLabel: end})
+			g.visitStmt(s.Stmt)
+			g.popTarget()
+			g.markLabel(end)
+		}
+
+	case *js_ast.SFor, *js_ast.SForIn, *js_ast.SForOf, *js_ast.SWhile, *js_ast.SDoWhile:
+		g.visitLoop(stmt, ast.InvalidRef)
+
+	case *js_ast.SSwitch:
+		g.visitSwitch(s)
+
+	case *js_ast.STry:
+		g.visitTry(s)
+
+	case *js_ast.SReturn:
+		if s.ValueOrNil.Data == nil {
+			g.emit(g.op(stmt.Loc, generatorOpReturn))
+		} else {
+			g.emit(g.op(stmt.Loc, generatorOpReturn, g.visitExpr(s.ValueOrNil)))
+		}
+
+	case *js_ast.SThrow:
+		g.emit(js_ast.Stmt{Loc: stmt.Loc, Data: &js_ast.SThrow{Value: g.visitExpr(s.Value)}})
+
+	default:
+		g.unsupported(stmt.Loc)
+		g.emit(stmt)
+	}
+}
+
+func (g *generatorLowering) visitLocal(s *js_ast.SLocal) {
+	isLexical := s.Kind != js_ast.LocalVar
+	for _, decl := range s.Decls {
+		js_ast.ForEachIdentifierBinding(decl.Binding, func(loc logger.Loc, b *js_ast.BIdentifier) {
+			g.hoist(b.Ref, isLexical)
+		})
+		if decl.ValueOrNil.Data != nil {
+			target := js_ast.ConvertBindingToExpr(decl.Binding, g.ident)
+			g.emitExpr(g.visitExpr(js_ast.Assign(target, decl.ValueOrNil)))
+		} else if id, ok := decl.Binding.Data.(*js_ast.BIdentifier); ok && isLexical {
+			// "let x" must reset the variable each time it's evaluated (e.g. in a loop)
+			g.emitExpr(js_ast.Assign(g.ident(decl.Binding.Loc, id.Ref), js_ast.Expr{Loc: decl.Binding.Loc, Data: js_ast.EUndefinedShared}))
+		}
+	}
+}
+
+func (g *generatorLowering) visitLoop(stmt js_ast.Stmt, labelRef ast.Ref) {
+	loop := g.newLabel()
+	end := g.newLabel()
+
+	switch s := stmt.Data.(type) {
+	case *js_ast.SWhile:
+		g.markLabel(loop)
+		g.jumpIf(js_ast.Not(g.visitExpr(s.Test)), end)
+		g.pushTarget(generatorJumpTarget{labelRef: labelRef, breakLabel: end, continueLabel: loop, isLoop: true})
+		g.visitStmt(s.Body)
+		g.popTarget()
+		g.jump(stmt.Loc, loop)
+
+	case *js_ast.SDoWhile:
+		next := g.newLabel()
+		g.markLabel(loop)
+		g.pushTarget(generatorJumpTarget{labelRef: labelRef, breakLabel: end, continueLabel: next, isLoop: true})
+		g.visitStmt(s.Body)
+		g.popTarget()
+		g.markLabel(next)
+		g.jumpIf(g.visitExpr(s.Test), loop)
+
+	case *js_ast.SFor:
+		next := g.newLabel()
+		if s.InitOrNil.Data != nil {
+			g.visitStmt(s.InitOrNil)
+		}
+		g.markLabel(loop)
+		if s.TestOrNil.Data != nil {
+			g.jumpIf(js_ast.Not(g.visitExpr(s.TestOrNil)), end)
+		}
+		g.pushTarget(generatorJumpTarget{labelRef: labelRef, breakLabel: end, continueLabel: next, isLoop: true})
+		g.visitStmt(s.Body)
+		g.popTarget()
+		g.markLabel(next)
+		if s.UpdateOrNil.Data != nil {
+			g.emitExpr(g.visitExpr(s.UpdateOrNil))
+		}
+		g.jump(stmt.Loc, loop)
+
+	case *js_ast.SForIn:
+		// The keys are collected up front because the loop can't be suspended:
+		//
+		//   for (_a in _b = obj) _c.push(_a);
+		//   for (_d = 0; _d < _c.length; _d++) {
+		//     if (!((_a = _c[_d]) in _b)) continue;
+		//     x = _a;
+		//     ...
+		//   }
+		//
+		loc := stmt.Loc
+		next := g.newLabel()
+		key := g.temp()
+		keys := g.temp()
+		index := g.temp()
+		object := g.spill(g.visitExpr(s.Value))
+		if local, ok := s.Init.Data.(*js_ast.SLocal); ok && len(local.Decls) == 1 {
+			js_ast.ForEachIdentifierBinding(local.Decls[0].Binding, func(loc logger.Loc, b *js_ast.BIdentifier) {
+				g.hoist(b.Ref, local.Kind != js_ast.LocalVar)
+			})
+		}
+		g.emitExpr(js_ast.Assign(g.ident(loc, keys), js_ast.Expr{Loc: loc, Data: &js_ast.EArray{}}))
+		g.emit(js_ast.Stmt{Loc: loc, Data: &js_ast.SForIn{
+			Init:  js_ast.Stmt{Loc: loc, Data: &js_ast.SExpr{Value: g.ident(loc, key)}},
+			Value: g.clone(object),
+			Body: js_ast.Stmt{Loc: loc, Data: &js_ast.SExpr{Value: js_ast.Expr{Loc: loc, Data: &js_ast.ECall{
+				Target: js_ast.Expr{Loc: loc, Data: &js_ast.EDot{Target: g.ident(loc, keys), Name: "push", NameLoc: loc}},
+				Args:   []js_ast.Expr{g.ident(loc, key)},
+				Kind:   js_ast.TargetWasOriginallyPropertyAccess,
+			}}}},
+			IsSingleLineBody: true,
+		}})
+		g.emitExpr(js_ast.Assign(g.ident(loc, index), js_ast.Expr{Loc: loc, Data: &js_ast.ENumber{Value: 0}}))
+		g.markLabel(loop)
+		g.jumpIf(js_ast.Not(js_ast.Expr{Loc: loc, Data: &js_ast.EBinary{
+			Op:    js_ast.BinOpLt,
+			Left:  g.ident(loc, index),
+			Right: js_ast.Expr{Loc: loc, Data: &js_ast.EDot{Target: g.ident(loc, keys), Name: "length", NameLoc: loc}},
+		}}), end)
+		g.jumpIf(js_ast.Not(js_ast.Expr{Loc: loc, Data: &js_ast.EBinary{
+			Op: js_ast.BinOpIn,
+			Left: js_ast.Assign(g.ident(loc, key), js_ast.Expr{Loc: loc, Data: &js_ast.EIndex{
+				Target: g.ident(loc, keys),
+				Index:  g.ident(loc, index),
+			}}),
+			Right: g.clone(object),
+		}}), next)
+		var target js_ast.Expr
+		switch init := s.Init.Data.(type) {
+		case *js_ast.SLocal:
+			target = js_ast.ConvertBindingToExpr(init.Decls[0].Binding, g.ident)
+		case *js_ast.SExpr:
+			target = init.Value
+		}
+		g.emitExpr(g.visitExpr(js_ast.Assign(target, g.ident(loc, key))))
+		g.pushTarget(generatorJumpTarget{labelRef: labelRef, breakLabel: end, continueLabel: next, isLoop: true})
+		g.visitStmt(s.Body)
+		g.popTarget()
+		g.markLabel(next)
+		g.emitExpr(js_ast.Expr{Loc: loc, Data: &js_ast.EUnary{Op: js_ast.UnOpPostInc, Value: g.ident(loc, index)}})
+		g.jump(loc, loop)
+
+	case *js_ast.SForOf:
+		// Lower the for-of loop to a normal loop and then transform that instead
+		g.markLabel(loop)
+		lowered := g.lowerForOfLoop(stmt.Loc, s)
+		if labelRef != ast.InvalidRef {
+			try := lowered.Data.(*js_ast.STry)
+			try.Block.Stmts[0] = js_ast.Stmt{Loc: stmt.Loc, Data: &js_ast.SLabel{
+				Name: ast.LocRef{Loc: stmt.Loc, Ref: labelRef},
+				Stmt: try.Block.Stmts[0],
+			}}
+		}
+		g.visitStmt(lowered)
+	}
+
+	g.markLabel(end)
+}
+
+// This is similar to "lowerForAwaitLoop" except that it's only used when
+// for-of loops are supported but generator functions aren't:
+//
+//	try {
+//	  for (iter = __iterate(y), more = temp = error = void 0; more = !(temp = iter.next()).done; more = false) {
+//	    x = temp.value;
+//	    z();
+//	  }
+//	} catch (temp) {
+//	  error = [temp]
+//	} finally {
+//	  try {
+//	    more && (temp = iter.return) && temp.call(iter)
+//	  } finally {
+//	    if (error) throw error[0]
+//	  }
+//	}
+func (g *generatorLowering) lowerForOfLoop(loc logger.Loc, loop *js_ast.SForOf) js_ast.Stmt {
+	iterRef := g.temp()
+	moreRef := g.temp()
+	tempRef := g.temp()
+	errorRef := g.temp()
+	undefined := js_ast.Expr{Loc: loc, Data: js_ast.EUndefinedShared}
+	tempValue := js_ast.Expr{Loc: loc, Data: &js_ast.EDot{Target: g.ident(loc, tempRef), Name: "value", NameLoc: loc}}
+
+	var body []js_ast.Stmt
+	switch init := loop.Init.Data.(type) {
+	case *js_ast.SLocal:
+		if len(init.Decls) == 1 {
+			init.Decls[0].ValueOrNil = tempValue
+		}
+		body = append(body, loop.Init)
+	case *js_ast.SExpr:
+		body = append(body, js_ast.Stmt{Loc: loop.Init.Loc, Data: &js_ast.SExpr{Value: js_ast.Assign(init.Value, tempValue)}})
+	}
+	if block, ok := loop.Body.Data.(*js_ast.SBlock); ok {
+		body = append(body, block.Stmts...)
+	} else {
+		body = append(body, loop.Body)
+	}
+
+	return js_ast.Stmt{Loc: loc, Data: &js_ast.STry{
+		BlockLoc: loc,
+		Block: js_ast.SBlock{Stmts: []js_ast.Stmt{{Loc: loc, Data: &js_ast.SFor{
+			InitOrNil: js_ast.Stmt{Loc: loc, Data: &js_ast.SExpr{Value: js_ast.JoinWithComma(
+				js_ast.Assign(g.ident(loc, iterRef), g.p.callRuntime(loc, "__iterate", []js_ast.Expr{loop.Value})),
+				js_ast.Assign(g.ident(loc, moreRef), js_ast.Assign(g.ident(loc, tempRef), js_ast.Assign(g.ident(loc, errorRef), undefined))),
+			)}},
+			TestOrNil: js_ast.Assign(g.ident(loc, moreRef), js_ast.Not(js_ast.Expr{Loc: loc, Data: &js_ast.EDot{
+				Target: js_ast.Assign(g.ident(loc, tempRef), js_ast.Expr{Loc: loc, Data: &js_ast.ECall{
+					Target: js_ast.Expr{Loc: loc, Data: &js_ast.EDot{Target: g.ident(loc, iterRef), Name: "next", NameLoc: loc}},
+					Kind:   js_ast.TargetWasOriginallyPropertyAccess,
+				}}),
+				Name:    "done",
+				NameLoc: loc,
+			}})),
+			UpdateOrNil: js_ast.Assign(g.ident(loc, moreRef), js_ast.Expr{Loc: loc, Data: &js_ast.EBoolean{Value: false}}),
+			Body:        js_ast.Stmt{Loc: loop.Body.Loc, Data: &js_ast.SBlock{Stmts: body}},
+		}}}},
+		Catch: &js_ast.Catch{
+			Loc:          loc,
+			BindingOrNil: js_ast.Binding{Loc: loc, Data: &js_ast.BIdentifier{Ref: tempRef}},
+			Block: js_ast.SBlock{Stmts: []js_ast.Stmt{{Loc: loc, Data: &js_ast.SExpr{Value: js_ast.Assign(
+				g.ident(loc, errorRef),
+				js_ast.Expr{Loc: loc, Data: &js_ast.EArray{Items: []js_ast.Expr{g.ident(loc, tempRef)}, IsSingleLine: true}},
+			)}}}},
+		},
+		Finally: &js_ast.Finally{
+			Loc: loc,
+			Block: js_ast.SBlock{Stmts: []js_ast.Stmt{{Loc: loc, Data: &js_ast.STry{
+				BlockLoc: loc,
+				Block: js_ast.SBlock{Stmts: []js_ast.Stmt{{Loc: loc, Data: &js_ast.SExpr{Value: js_ast.Expr{Loc: loc, Data: &js_ast.EBinary{
+					Op: js_ast.BinOpLogicalAnd,
+					Left: js_ast.Expr{Loc: loc, Data: &js_ast.EBinary{
+						Op:    js_ast.BinOpLogicalAnd,
+						Left:  g.ident(loc, moreRef),
+						Right: js_ast.Assign(g.ident(loc, tempRef), js_ast.Expr{Loc: loc, Data: &js_ast.EDot{Target: g.ident(loc, iterRef), Name: "return", NameLoc: loc}}),
+					}},
+					Right: js_ast.Expr{Loc: loc, Data: &js_ast.ECall{
+						Target: js_ast.Expr{Loc: loc, Data: &js_ast.EDot{Target: g.ident(loc, tempRef), Name: "call", NameLoc: loc}},
+						Args:   []js_ast.Expr{g.ident(loc, iterRef)},
+						Kind:   js_ast.TargetWasOriginallyPropertyAccess,
+					}},
+				}}}}}},
+				Finally: &js_ast.Finally{
+					Loc: loc,
+					Block: js_ast.SBlock{Stmts: []js_ast.Stmt{{Loc: loc, Data: &js_ast.SIf{
+						Test: g.ident(loc, errorRef),
+						Yes: js_ast.Stmt{Loc: loc, Data: &js_ast.SThrow{Value: js_ast.Expr{Loc: loc, Data: &js_ast.EIndex{
+							Target: g.ident(loc, errorRef),
+							Index:  js_ast.Expr{Loc: loc, Data: &js_ast.ENumber{Value: 0}},
+						}}}},
+					}}}},
+				},
+			}}}},
+		},
+	}}
+}
+
+func (g *generatorLowering) visitSwitch(s *js_ast.SSwitch) {
+	// "switch (x) { case a: b; default: c }" => "_a = x; if (_a === a) goto b; goto c; b: ...; c: ..."
+	test := g.spill(g.visitExpr(s.Test))
+	end := g.newLabel()
+	labels := make([]int, len(s.Cases))
+	defaultLabel := end
+	for i, c := range s.Cases {
+		labels[i] = g.newLabel()
+		if c.ValueOrNil.Data == nil {
+			defaultLabel = labels[i]
+			continue
+		}
+		g.jumpIf(js_ast.Expr{Loc: c.Loc, Data: &js_ast.EBinary{
+			Op:    js_ast.BinOpStrictEq,
+			Left:  g.clone(test),
+			Right: g.visitExpr(c.ValueOrNil),
+		}}, labels[i])
+	}
+	g.jump(s.BodyLoc, defaultLabel)
+	g.pushTarget(generatorJumpTarget{breakLabel: end, isSwitch: true})
+	for i, c := range s.Cases {
+		g.markLabel(labels[i])
+		g.visitStmts(c.Body)
+	}
+	g.popTarget()
+	g.markLabel(end)
+}
+
+func (g *generatorLowering) visitTry(s *js_ast.STry) {
+	catchLabel := -1
+	finallyLabel := -1
+	end := g.newLabel()
+	loc := s.BlockLoc
+
+	// "_.t.push([catchLabel, finallyLabel])"
+	var items []js_ast.Expr
+	if s.Catch != nil {
+		catchLabel = g.newLabel()
+		items = append(items, g.labelExpr(s.Catch.Loc, catchLabel))
+	} else {
+		items = append(items, js_ast.Expr{Loc: loc, Data: js_ast.EMissingShared})
+	}
+	if s.Finally != nil {
+		finallyLabel = g.newLabel()
+		items = append(items, g.labelExpr(s.Finally.Loc, finallyLabel))
+	}
+	g.emitExpr(js_ast.Expr{Loc: loc, Data: &js_ast.ECall{
+		Target: js_ast.Expr{Loc: loc, Data: &js_ast.EDot{Target: g.state(loc, "t"), Name: "push", NameLoc: loc}},
+		Args:   []js_ast.Expr{{Loc: loc, Data: &js_ast.EArray{Items: items, IsSingleLine: true}}},
+		Kind:   js_ast.TargetWasOriginallyPropertyAccess,
+	}})
+
+	outerDepth := g.tryDepth
+	g.tryDepth++
+	g.visitStmts(s.Block.Stmts)
+	g.emit(g.jumpStmt(s.Block.CloseBraceLoc, end, outerDepth))
+
+	if s.Catch != nil {
+		g.markLabel(catchLabel)
+		if s.Catch.BindingOrNil.Data != nil {
+			js_ast.ForEachIdentifierBinding(s.Catch.BindingOrNil, func(loc logger.Loc, b *js_ast.BIdentifier) {
+				g.hoist(b.Ref, true)
+			})
+			target := js_ast.ConvertBindingToExpr(s.Catch.BindingOrNil, g.ident)
+			g.emitExpr(g.visitExpr(js_ast.Assign(target, g.state(s.Catch.Loc, "v"))))
+		}
+		g.visitStmts(s.Catch.Block.Stmts)
+		g.emit(g.jumpStmt(s.Catch.Block.CloseBraceLoc, end, outerDepth))
+	}
+
+	if s.Finally != nil {
+		g.markLabel(finallyLabel)
+		g.visitStmts(s.Finally.Block.Stmts)
+		g.emit(g.op(s.Finally.Block.CloseBraceLoc, generatorOpEndFinally))
+	}
+
+	g.tryDepth = outerDepth
+	g.markLabel(end)
+}
+
+// This copies over a statement that doesn't contain "yield". Variable
+// declarations are still hoisted and jumps still need to be converted.
+func (g *generatorLowering) copyStmt(stmt js_ast.Stmt) js_ast.Stmt {
+	switch s := stmt.Data.(type) {
+	case *js_ast.SBlock:
+		s.Stmts = g.copyStmts(s.Stmts)
+
+	case *js_ast.SLocal:
+		if s.Kind == js_ast.LocalVar {
+			return g.copyVar(stmt.Loc, s, false)
+		}
+
+	case *js_ast.SLabel:
+		g.pushTarget(generatorJumpTarget{labelRef: s.Name.Ref, isNative: true})
+		s.Stmt = g.copyStmt(s.Stmt)
+		g.popTarget()
+
+	case *js_ast.SIf:
+		s.Yes = g.copyStmt(s.Yes)
+		if s.NoOrNil.Data != nil {
+			s.NoOrNil = g.copyStmt(s.NoOrNil)
+		}
+
+	case *js_ast.SFor:
+		if local, ok := s.InitOrNil.Data.(*js_ast.SLocal); ok && local.Kind == js_ast.LocalVar {
+			if s.InitOrNil = g.copyVar(s.InitOrNil.Loc, local, false); s.InitOrNil.Data == js_ast.SEmptyShared {
+				s.InitOrNil = js_ast.Stmt{}
+			}
+		}
+		s.Body = g.copyLoopBody(s.Body)
+
+	case *js_ast.SForIn:
+		if local, ok := s.Init.Data.(*js_ast.SLocal); ok && local.Kind == js_ast.LocalVar {
+			s.Init = g.copyVar(s.Init.Loc, local, true)
+		}
+		s.Body = g.copyLoopBody(s.Body)
+
+	case *js_ast.SForOf:
+		if local, ok := s.Init.Data.(*js_ast.SLocal); ok && local.Kind == js_ast.LocalVar {
+			s.Init = g.copyVar(s.Init.Loc, local, true)
+		}
+		s.Body = g.copyLoopBody(s.Body)
+
+	case *js_ast.SWhile:
+		s.Body = g.copyLoopBody(s.Body)
+
+	case *js_ast.SDoWhile:
+		s.Body = g.copyLoopBody(s.Body)
+
+	case *js_ast.SWith:
+		s.Body = g.copyStmt(s.Body)
+
+	case *js_ast.STry:
+		s.Block.Stmts = g.copyStmts(s.Block.Stmts)
+		if s.Catch != nil {
+			s.Catch.Block.Stmts = g.copyStmts(s.Catch.Block.Stmts)
+		}
+		if s.Finally != nil {
+			s.Finally.Block.Stmts = g.copyStmts(s.Finally.Block.Stmts)
+		}
+
+	case *js_ast.SSwitch:
+		g.pushTarget(generatorJumpTarget{isNative: true, isSwitch: true})
+		for i := range s.Cases {
+			s.Cases[i].Body = g.copyStmts(s.Cases[i].Body)
+		}
+		g.popTarget()
+
+	case *js_ast.SReturn:
+		if s.ValueOrNil.Data == nil {
+			return g.op(stmt.Loc, generatorOpReturn)
+		}
+		return g.op(stmt.Loc, generatorOpReturn, s.ValueOrNil)
+
+	case *js_ast.SBreak:
+		if target := g.findTarget(s.Label, false); target != nil && !target.isNative {
+			return g.jumpStmt(stmt.Loc, target.breakLabel, target.tryDepth)
+		}
+
+	case *js_ast.SContinue:
+		if target := g.findTarget(s.Label, true); target != nil && !target.isNative {
+			return g.jumpStmt(stmt.Loc, target.continueLabel, target.tryDepth)
+		}
+	}
+
+	return stmt
+}
+
+func (g *generatorLowering) copyStmts(stmts []js_ast.Stmt) []js_ast.Stmt {
+	end := 0
+	for _, stmt := range stmts {
+		if stmt = g.copyStmt(stmt); stmt.Data != js_ast.SEmptyShared {
+			stmts[end] = stmt
+			end++
+		}
+	}
+	return stmts[:end]
+}
+
+func (g *generatorLowering) copyLoopBody(body js_ast.Stmt) js_ast.Stmt {
+	g.pushTarget(generatorJumpTarget{isNative: true, isLoop: true})
+	body = g.copyStmt(body)
+	g.popTarget()
+	return body
+}
+
+// "var a = 1, b" => "a = 1"
+func (g *generatorLowering) copyVar(loc logger.Loc, s *js_ast.SLocal, isLoopInit bool) js_ast.Stmt {
+	var value js_ast.Expr
+	for _, decl := range s.Decls {
+		js_ast.ForEachIdentifierBinding(decl.Binding, func(loc logger.Loc, b *js_ast.BIdentifier) {
+			g.hoist(b.Ref, false)
+		})
+		if isLoopInit {
+			// "for (var x in y)" => "for (x in y)"
+			value = js_ast.ConvertBindingToExpr(decl.Binding, g.ident)
+		} else if decl.ValueOrNil.Data != nil {
+			value = js_ast.JoinWithComma(value, js_ast.Assign(js_ast.ConvertBindingToExpr(decl.Binding, g.ident), decl.ValueOrNil))
+		}
+	}
+	if value.Data == nil {
+		return js_ast.Stmt{Loc: loc, Data: js_ast.SEmptyShared}
+	}
+	return js_ast.Stmt{Loc: loc, Data: &js_ast.SExpr{Value: value}}
+}
+
+// This returns an equivalent expression that doesn't contain "yield". Any
+// code that must be evaluated before a "yield" is emitted into the state
+// machine first, and values that are needed after a "yield" are stored in
+// temporary variables.
+func (g *generatorLowering) visitExpr(expr js_ast.Expr) js_ast.Expr {
+	if !generatorExprHasYield(expr) {
+		return expr
+	}
+	loc := expr.Loc
+
+	switch e := expr.Data.(type) {
+	case *js_ast.EYield:
+		op := generatorOpYield
+		if e.IsStar {
+			op = generatorOpYieldStar
+		}
+		value := js_ast.Expr{Loc: loc, Data: js_ast.EUndefinedShared}
+		if e.ValueOrNil.Data != nil {
+			value = g.visitExpr(e.ValueOrNil)
+		}
+		resume := g.newLabel()
+		g.emit(g.op(loc, op, value, g.labelExpr(loc, resume)))
+		g.markLabel(resume)
+		return g.state(loc, "v")
+
+	case *js_ast.EBinary:
+		switch {
+		case e.Op == js_ast.BinOpComma:
+			g.emitExpr(g.visitExpr(e.Left))
+			return g.visitExpr(e.Right)
+
+		case e.Op == js_ast.BinOpAssign:
+			e.Left = g.visitAssignTarget(e.Left, generatorExprHasYield(e.Right))
+			e.Right = g.visitExpr(e.Right)
+			return expr
+
+		case e.Op.IsShortCircuit():
+			if !generatorExprHasYield(e.Right) {
+				e.Left = g.visitExpr(e.Left)
+				return expr
+			}
+
+			// "a && (yield b)" => "_a = a; if (!_a) goto end; _a = yield b; end:"
+			// "a &&= yield b" => "_a = a; if (!_a) goto end; _a = a = yield b; end:"
+			var target js_ast.Expr
+			left := e.Left
+			if e.Op.BinaryAssignTarget() != js_ast.AssignTargetNone {
+				target = g.visitAssignTarget(e.Left, true)
+				left = g.clone(target)
+			}
+			temp := g.temp()
+			end := g.newLabel()
+			g.emitExpr(js_ast.Assign(g.ident(loc, temp), g.visitExpr(left)))
+			switch e.Op {
+			case js_ast.BinOpLogicalAnd, js_ast.BinOpLogicalAndAssign:
+				g.jumpIf(js_ast.Not(g.ident(loc, temp)), end)
+			case js_ast.BinOpLogicalOr, js_ast.BinOpLogicalOrAssign:
+				g.jumpIf(g.ident(loc, temp), end)
+			default:
+				g.jumpIf(js_ast.Expr{Loc: loc, Data: &js_ast.EBinary{
+					Op:    js_ast.BinOpLooseNe,
+					Left:  g.ident(loc, temp),
+					Right: js_ast.Expr{Loc: loc, Data: js_ast.ENullShared},
+				}}, end)
+			}
+			right := g.visitExpr(e.Right)
+			if target.Data != nil {
+				right = js_ast.Assign(target, right)
+			}
+			g.emitExpr(js_ast.Assign(g.ident(loc, temp), right))
+			g.markLabel(end)
+			return g.ident(loc, temp)
+
+		case e.Op.BinaryAssignTarget() == js_ast.AssignTargetUpdate:
+			hasYield := generatorExprHasYield(e.Right)
+			e.Left = g.visitAssignTarget(e.Left, hasYield)
+			if !hasYield {
+				return expr
+			}
+
+			// "a += yield b" => "_a = a; a = _a + (yield b)"
+			old := g.temp()
+			g.emitExpr(js_ast.Assign(g.ident(loc, old), g.clone(e.Left)))
+			return js_ast.Assign(e.Left, js_ast.Expr{Loc: loc, Data: &js_ast.EBinary{
+				Op:    generatorCompoundAssignOps[e.Op],
+				Left:  g.ident(loc, old),
+				Right: g.visitExpr(e.Right),
+			}})
+
+		default:
+			g.visitExprsInOrder(&e.Left, &e.Right)
+			return expr
+		}
+
+	case *js_ast.EIf:
+		if !generatorExprHasYield(e.Yes) && !generatorExprHasYield(e.No) {
+			e.Test = g.visitExpr(e.Test)
+			return expr
+		}
+
+		// "a ? yield b : c" => "if (!a) goto no; _a = yield b; goto end; no: _a = c; end:"
+		temp := g.temp()
+		no := g.newLabel()
+		end := g.newLabel()
+		g.jumpIf(js_ast.Not(g.visitExpr(e.Test)), no)
+		g.emitExpr(js_ast.Assign(g.ident(loc, temp), g.visitExpr(e.Yes)))
+		g.jump(loc, end)
+		g.markLabel(no)
+		g.emitExpr(js_ast.Assign(g.ident(loc, temp), g.visitExpr(e.No)))
+		g.markLabel(end)
+		return g.ident(loc, temp)
+
+	case *js_ast.ECall:
+		argsHaveYield := false
+		for _, arg := range e.Args {
+			if generatorExprHasYield(arg) {
+				argsHaveYield = true
+				break
+			}
+		}
+		if !argsHaveYield {
+			e.Target = g.visitExpr(e.Target)
+			return expr
+		}
+
+		// The value of "this" must be preserved for method calls:
+		//
+		//   "a.b(yield c)" => "_a = a; _b = _a.b; _b.call(_a, yield c)"
+		//
+		var this js_ast.Expr
+		switch target := e.Target.Data.(type) {
+		case *js_ast.EDot:
+			if target.OptionalChain == js_ast.OptionalChainNone {
+				if _, ok := target.Target.Data.(*js_ast.ESuper); ok {
+					this = js_ast.Expr{Loc: loc, Data: js_ast.EThisShared}
+				} else {
+					target.Target = g.spill(g.visitExpr(target.Target))
+					this = g.clone(target.Target)
+				}
+			}
+
+		case *js_ast.EIndex:
+			if target.OptionalChain == js_ast.OptionalChainNone {
+				if _, ok := target.Target.Data.(*js_ast.ESuper); ok {
+					this = js_ast.Expr{Loc: loc, Data: js_ast.EThisShared}
+					target.Index = g.spill(g.visitExpr(target.Index))
+				} else {
+					g.visitExprsInOrder(&target.Target, &target.Index)
+					target.Target = g.spill(target.Target)
+					target.Index = g.spill(target.Index)
+					this = g.clone(target.Target)
+				}
+			}
+		}
+		if this.Data != nil {
+			ref := g.temp()
+			g.emitExpr(js_ast.Assign(g.ident(loc, ref), e.Target))
+			e.Target = js_ast.Expr{Loc: loc, Data: &js_ast.EDot{Target: g.ident(loc, ref), Name: "call", NameLoc: loc}}
+			e.Args = append([]js_ast.Expr{this}, e.Args...)
+			e.Kind = js_ast.TargetWasOriginallyPropertyAccess
+			g.visitExprsInOrder(generatorExprPointers(e.Args[1:])...)
+		} else if e.Kind == js_ast.DirectEval {
+			g.visitExprsInOrder(generatorExprPointers(e.Args)...)
+		} else {
+			g.visitExprsInOrder(append([]*js_ast.Expr{&e.Target}, generatorExprPointers(e.Args)...)...)
+		}
+		return expr
+
+	case *js_ast.ENew:
+		g.visitExprsInOrder(append([]*js_ast.Expr{&e.Target}, generatorExprPointers(e.Args)...)...)
+		return expr
+
+	case *js_ast.EArray:
+		g.visitExprsInOrder(generatorExprPointers(e.Items)...)
+		return expr
+
+	case *js_ast.EObject:
+		var children []*js_ast.Expr
+		for i := range e.Properties {
+			property := &e.Properties[i]
+			if property.Flags.Has(js_ast.PropertyIsComputed) {
+				children = append(children, &property.Key)
+			}
+			if property.ValueOrNil.Data != nil {
+				children = append(children, &property.ValueOrNil)
+			}
+		}
+		g.visitExprsInOrder(children...)
+		return expr
+
+	case *js_ast.ETemplate:
+		var children []*js_ast.Expr
+		if e.TagOrNil.Data != nil {
+			children = append(children, &e.TagOrNil)
+		}
+		for i := range e.Parts {
+			children = append(children, &e.Parts[i].Value)
+		}
+		g.visitExprsInOrder(children...)
+		return expr
+
+	case *js_ast.EUnary:
+		e.Value = g.visitExpr(e.Value)
+		return expr
+
+	case *js_ast.EDot:
+		e.Target = g.visitExpr(e.Target)
+		return expr
+
+	case *js_ast.EIndex:
+		g.visitExprsInOrder(&e.Target, &e.Index)
+		return expr
+
+	case *js_ast.ESpread:
+		e.Value = g.visitExpr(e.Value)
+		return expr
+
+	case *js_ast.EAnnotation:
+		e.Value = g.visitExpr(e.Value)
+		return expr
+
+	case *js_ast.EImportCall:
+		if e.OptionsOrNil.Data != nil {
+			g.visitExprsInOrder(&e.Expr, &e.OptionsOrNil)
+		} else {
+			e.Expr = g.visitExpr(e.Expr)
+		}
+		return expr
+	}
+
+	g.unsupported(loc)
+	return expr
+}
+
+// This evaluates the object and the key of a property access that's being
+// assigned to. They are stored in temporary variables if the assigned value
+// contains a "yield" expression.
+func (g *generatorLowering) visitAssignTarget(target js_ast.Expr, shouldSpill bool) js_ast.Expr {
+	switch t := target.Data.(type) {
+	case *js_ast.EIdentifier:
+		return target
+
+	case *js_ast.EDot:
+		t.Target = g.visitExpr(t.Target)
+		if shouldSpill {
+			t.Target = g.spill(t.Target)
+		}
+		return target
+
+	case *js_ast.EIndex:
+		g.visitExprsInOrder(&t.Target, &t.Index)
+		if shouldSpill {
+			t.Target = g.spill(t.Target)
+			t.Index = g.spill(t.Index)
+		}
+		return target
+	}
+
+	// Destructuring patterns with "yield" in them aren't supported
+	if generatorExprHasYield(target) {
+		g.unsupported(target.Loc)
+	}
+	return target
+}
+
+// Expressions that are evaluated before the last expression containing a
+// "yield" must be stored in temporary variables to preserve evaluation order
+func (g *generatorLowering) visitExprsInOrder(children ...*js_ast.Expr) {
+	last := -1
+	for i, child := range children {
+		if generatorExprHasYield(*child) {
+			last = i
+		}
+	}
+	for i := 0; i <= last; i++ {
+		child := children[i]
+		if spread, ok := child.Data.(*js_ast.ESpread); ok {
+			child = &spread.Value
+		}
+		*child = g.visitExpr(*child)
+		if i < last {
+			*child = g.spill(*child)
+		}
+	}
+}
+
+func generatorExprPointers(exprs []js_ast.Expr) []*js_ast.Expr {
+	pointers := make([]*js_ast.Expr, len(exprs))
+	for i := range exprs {
+		pointers[i] = &exprs[i]
+	}
+	return pointers
+}
+
+func generatorExprHasYield(expr js_ast.Expr) bool {
+	found := false
+	generatorWalkExpr(&expr, func(expr *js_ast.Expr) bool {
+		if _, ok := expr.Data.(*js_ast.EYield); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+func generatorStmtHasYield(stmt js_ast.Stmt) bool {
+	found := false
+	generatorWalkStmt(&stmt, func(expr *js_ast.Expr) bool {
+		if _, ok := expr.Data.(*js_ast.EYield); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// These functions traverse all expressions that are evaluated in the context
+// of the current function. Nested functions are skipped since they have their
+// own "yield" and "arguments". Arrow functions are not skipped since they
+// share "arguments" with the current function. The callback can return false
+// to skip the children of an expression.
+func generatorWalkStmts(stmts []js_ast.Stmt, visit func(*js_ast.Expr) bool) {
+	for i := range stmts {
+		generatorWalkStmt(&stmts[i], visit)
+	}
+}
+
+func generatorWalkStmt(stmt *js_ast.Stmt, visit func(*js_ast.Expr) bool) {
+	switch s := stmt.Data.(type) {
+	case *js_ast.SBlock:
+		generatorWalkStmts(s.Stmts, visit)
+
+	case *js_ast.SExpr:
+		generatorWalkExpr(&s.Value, visit)
+
+	case *js_ast.SLocal:
+		for i := range s.Decls {
+			generatorWalkBinding(s.Decls[i].Binding, visit)
+			generatorWalkExpr(&s.Decls[i].ValueOrNil, visit)
+		}
+
+	case *js_ast.SClass:
+		generatorWalkClass(&s.Class, visit)
+
+	case *js_ast.SLabel:
+		generatorWalkStmt(&s.Stmt, visit)
+
+	case *js_ast.SIf:
+		generatorWalkExpr(&s.Test, visit)
+		generatorWalkStmt(&s.Yes, visit)
+		generatorWalkStmt(&s.NoOrNil, visit)
+
+	case *js_ast.SFor:
+		generatorWalkStmt(&s.InitOrNil, visit)
+		generatorWalkExpr(&s.TestOrNil, visit)
+		generatorWalkExpr(&s.UpdateOrNil, visit)
+		generatorWalkStmt(&s.Body, visit)
+
+	case *js_ast.SForIn:
+		generatorWalkStmt(&s.Init, visit)
+		generatorWalkExpr(&s.Value, visit)
+		generatorWalkStmt(&s.Body, visit)
+
+	case *js_ast.SForOf:
+		generatorWalkStmt(&s.Init, visit)
+		generatorWalkExpr(&s.Value, visit)
+		generatorWalkStmt(&s.Body, visit)
+
+	case *js_ast.SDoWhile:
+		generatorWalkStmt(&s.Body, visit)
+		generatorWalkExpr(&s.Test, visit)
+
+	case *js_ast.SWhile:
+		generatorWalkExpr(&s.Test, visit)
+		generatorWalkStmt(&s.Body, visit)
+
+	case *js_ast.SWith:
+		generatorWalkExpr(&s.Value, visit)
+		generatorWalkStmt(&s.Body, visit)
+
+	case *js_ast.STry:
+		generatorWalkStmts(s.Block.Stmts, visit)
+		if s.Catch != nil {
+			generatorWalkBinding(s.Catch.BindingOrNil, visit)
+			generatorWalkStmts(s.Catch.Block.Stmts, visit)
+		}
+		if s.Finally != nil {
+			generatorWalkStmts(s.Finally.Block.Stmts, visit)
+		}
+
+	case *js_ast.SSwitch:
+		generatorWalkExpr(&s.Test, visit)
+		for i := range s.Cases {
+			generatorWalkExpr(&s.Cases[i].ValueOrNil, visit)
+			generatorWalkStmts(s.Cases[i].Body, visit)
+		}
+
+	case *js_ast.SReturn:
+		generatorWalkExpr(&s.ValueOrNil, visit)
+
+	case *js_ast.SThrow:
+		generatorWalkExpr(&s.Value, visit)
+	}
+}
+
+func generatorWalkBinding(binding js_ast.Binding, visit func(*js_ast.Expr) bool) {
+	switch b := binding.Data.(type) {
+	case *js_ast.BArray:
+		for i := range b.Items {
+			generatorWalkBinding(b.Items[i].Binding, visit)
+			generatorWalkExpr(&b.Items[i].DefaultValueOrNil, visit)
+		}
+
+	case *js_ast.BObject:
+		for i := range b.Properties {
+			if b.Properties[i].IsComputed {
+				generatorWalkExpr(&b.Properties[i].Key, visit)
+			}
+			generatorWalkBinding(b.Properties[i].Value, visit)
+			generatorWalkExpr(&b.Properties[i].DefaultValueOrNil, visit)
+		}
+	}
+}
+
+func generatorWalkClass(class *js_ast.Class, visit func(*js_ast.Expr) bool) {
+	for i := range class.Decorators {
+		generatorWalkExpr(&class.Decorators[i].Value, visit)
+	}
+	generatorWalkExpr(&class.ExtendsOrNil, visit)
+	for i := range class.Properties {
+		property := &class.Properties[i]
+		for j := range property.Decorators {
+			generatorWalkExpr(&property.Decorators[j].Value, visit)
+		}
+		if property.Flags.Has(js_ast.PropertyIsComputed) {
+			generatorWalkExpr(&property.Key, visit)
+		}
+	}
+}
+
+func generatorWalkExprs(exprs []js_ast.Expr, visit func(*js_ast.Expr) bool) {
+	for i := range exprs {
+		generatorWalkExpr(&exprs[i], visit)
+	}
+}
+
+func generatorWalkExpr(expr *js_ast.Expr, visit func(*js_ast.Expr) bool) {
+	if expr.Data == nil || !visit(expr) {
+		return
+	}
+
+	switch e := expr.Data.(type) {
+	case *js_ast.EArray:
+		generatorWalkExprs(e.Items, visit)
+
+	case *js_ast.EUnary:
+		generatorWalkExpr(&e.Value, visit)
+
+	case *js_ast.EBinary:
+		generatorWalkExpr(&e.Left, visit)
+		generatorWalkExpr(&e.Right, visit)
+
+	case *js_ast.ENew:
+		generatorWalkExpr(&e.Target, visit)
+		generatorWalkExprs(e.Args, visit)
+
+	case *js_ast.ECall:
+		generatorWalkExpr(&e.Target, visit)
+		generatorWalkExprs(e.Args, visit)
+
+	case *js_ast.EDot:
+		generatorWalkExpr(&e.Target, visit)
+
+	case *js_ast.EIndex:
+		generatorWalkExpr(&e.Target, visit)
+		generatorWalkExpr(&e.Index, visit)
+
+	case *js_ast.EArrow:
+		for i := range e.Args {
+			generatorWalkBinding(e.Args[i].Binding, visit)
+			generatorWalkExpr(&e.Args[i].DefaultOrNil, visit)
+		}
+		generatorWalkStmts(e.Body.Block.Stmts, visit)
+
+	case *js_ast.EClass:
+		generatorWalkClass(&e.Class, visit)
+
+	case *js_ast.EObject:
+		for i := range e.Properties {
+			property := &e.Properties[i]
+			if property.Flags.Has(js_ast.PropertyIsComputed) {
+				generatorWalkExpr(&property.Key, visit)
+			}
+			generatorWalkExpr(&property.ValueOrNil, visit)
+			generatorWalkExpr(&property.InitializerOrNil, visit)
+		}
+
+	case *js_ast.EJSXElement:
+		generatorWalkExpr(&e.TagOrNil, visit)
+		for i := range e.Properties {
+			generatorWalkExpr(&e.Properties[i].ValueOrNil, visit)
+		}
+		generatorWalkExprs(e.NullableChildren, visit)
+
+	case *js_ast.ESpread:
+		generatorWalkExpr(&e.Value, visit)
+
+	case *js_ast.ETemplate:
+		generatorWalkExpr(&e.TagOrNil, visit)
+		for i := range e.Parts {
+			generatorWalkExpr(&e.Parts[i].Value, visit)
+		}
+
+	case *js_ast.EAnnotation:
+		generatorWalkExpr(&e.Value, visit)
+
+	case *js_ast.EAwait:
+		generatorWalkExpr(&e.Value, visit)
+
+	case *js_ast.EYield:
+		generatorWalkExpr(&e.ValueOrNil, visit)
+
+	case *js_ast.EIf:
+		generatorWalkExpr(&e.Test, visit)
+		generatorWalkExpr(&e.Yes, visit)
+		generatorWalkExpr(&e.No, visit)
+
+	case *js_ast.EImportCall:
+		generatorWalkExpr(&e.Expr, visit)
+		generatorWalkExpr(&e.OptionsOrNil, visit)
+	}
+}
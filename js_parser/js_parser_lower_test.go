@@ -788,12 +788,10 @@ func TestAsyncGeneratorFns(t *testing.T) {
 	expectParseErrorWithUnsupportedFeatures(t, compat.AsyncAwait, "(async function () {});", err)
 	expectParseErrorWithUnsupportedFeatures(t, compat.AsyncAwait, "({ async foo() {} });", err)
 
-	err = "<stdin>: ERROR: Transforming generator functions to the configured target environment is not supported yet\n"
 	expectParseErrorWithUnsupportedFeatures(t, compat.Generator, "function* gen() {}", err)
 	expectParseErrorWithUnsupportedFeatures(t, compat.Generator, "(function* () {});", err)
 	expectParseErrorWithUnsupportedFeatures(t, compat.Generator, "({ *foo() {} });", err)
 
-	err = "<stdin>: ERROR: Transforming async functions to the configured target environment is not supported yet\n"
 	expectParseErrorWithUnsupportedFeatures(t, compat.AsyncAwait|compat.Generator, "async function gen() {}", err)
 	expectParseErrorWithUnsupportedFeatures(t, compat.AsyncAwait|compat.Generator, "(async function () {});", err)
 	expectParseErrorWithUnsupportedFeatures(t, compat.AsyncAwait|compat.Generator, "({ async foo() {} });", err)
@@ -804,6 +802,317 @@ func TestAsyncGeneratorFns(t *testing.T) {
 	expectParseErrorWithUnsupportedFeatures(t, compat.AsyncGenerator, "({ async *foo() {} });", err)
 }
 
+func TestLowerGenerator(t *testing.T) {
+	expectPrintedWithUnsupportedFeatures(t, compat.Generator, "function* foo() { yield 1; yield* x }", `function foo() {
+  return __generate(this, function(_) {
+    switch (_.n) {
+      case 0:
+        return [5, 1, 1];
+      case 1:
+        return [6, x, 2];
+      case 2:
+        return [2];
+    }
+  });
+}
+`)
+	expectPrintedWithUnsupportedFeatures(t, compat.Generator, "function* foo(x) { var y = yield x; return y }", `function foo(x) {
+  var y;
+  return __generate(this, function(_) {
+    switch (_.n) {
+      case 0:
+        return [5, x, 1];
+      case 1:
+        y = _.v;
+        return [2, y];
+    }
+  });
+}
+`)
+	expectPrintedWithUnsupportedFeatures(t, compat.Generator, "function* foo() { 'use strict'; function bar() {} yield bar }", `function foo() {
+  "use strict";
+  function bar() {
+  }
+  return __generate(this, function(_) {
+    switch (_.n) {
+      case 0:
+        return [5, bar, 1];
+      case 1:
+        return [2];
+    }
+  });
+}
+`)
+	expectPrintedWithUnsupportedFeatures(t, compat.Generator, "function* foo() { if (a) yield b; else c() }", `function foo() {
+  return __generate(this, function(_) {
+    switch (_.n) {
+      case 0:
+        if (!a) return [3, 2];
+        return [5, b, 1];
+      case 1:
+        return [3, 3];
+      case 2:
+        c();
+      case 3:
+        return [2];
+    }
+  });
+}
+`)
+	expectPrintedWithUnsupportedFeatures(t, compat.Generator, "function* foo() { while (a) { if (b) break; if (c) continue; yield d } }", `function foo() {
+  return __generate(this, function(_) {
+    switch (_.n) {
+      case 0:
+        if (!a) return [3, 2];
+        if (b) return [3, 2];
+        if (c) return [3, 0];
+        return [5, d, 1];
+      case 1:
+        return [3, 0];
+      case 2:
+        return [2];
+    }
+  });
+}
+`)
+	expectPrintedWithUnsupportedFeatures(t, compat.Generator, "function* foo() { for (var i = 0; i < 3; i++) yield i }", `function foo() {
+  var i;
+  return __generate(this, function(_) {
+    switch (_.n) {
+      case 0:
+        i = 0;
+      case 1:
+        if (!(i < 3)) return [3, 3];
+        return [5, i, 2];
+      case 2:
+        i++;
+        return [3, 1];
+      case 3:
+        return [2];
+    }
+  });
+}
+`)
+	expectPrintedWithUnsupportedFeatures(t, compat.Generator, "function* foo() { for (var k in obj) yield k }", `function foo() {
+  var _a, _b, _c, _d, k;
+  return __generate(this, function(_) {
+    switch (_.n) {
+      case 0:
+        _d = obj;
+        _b = [];
+        for (_a in _d) _b.push(_a);
+        _c = 0;
+      case 1:
+        if (!(_c < _b.length)) return [3, 3];
+        if (!((_a = _b[_c]) in _d)) return [3, 2];
+        k = _a;
+        return [5, k, 2];
+      case 2:
+        _c++;
+        return [3, 1];
+      case 3:
+        return [2];
+    }
+  });
+}
+`)
+	expectPrintedWithUnsupportedFeatures(t, compat.Generator, "function* foo() { for (var x of y) yield x }", `function foo() {
+  var _a, _b, _c, _d, x;
+  return __generate(this, function(_) {
+    switch (_.n) {
+      case 0:
+        _.t.push([4, 5]);
+        _a = __iterate(y), _b = _c = _d = void 0;
+      case 1:
+        if (!(_b = !(_c = _a.next()).done)) return [3, 3, 1];
+        x = _c.value;
+        return [5, x, 2];
+      case 2:
+        _b = false;
+        return [3, 1, 1];
+      case 3:
+        return [3, 6];
+      case 4:
+        _c = _.v;
+        _d = [_c];
+        return [3, 6];
+      case 5:
+        try {
+          _b && (_c = _a.return) && _c.call(_a);
+        } finally {
+          if (_d)
+            throw _d[0];
+        }
+        return [4];
+      case 6:
+        return [2];
+    }
+  });
+}
+`)
+	expectPrintedWithUnsupportedFeatures(t, compat.Generator, "function* foo() { switch (a) { case 1: yield b; case 2: c(); break; default: d() } }", `function foo() {
+  var _a;
+  return __generate(this, function(_) {
+    switch (_.n) {
+      case 0:
+        _a = a;
+        if (_a === 1) return [3, 1];
+        if (_a === 2) return [3, 2];
+        return [3, 3];
+      case 1:
+        return [5, b, 2];
+      case 2:
+        c();
+        return [3, 4];
+      case 3:
+        d();
+      case 4:
+        return [2];
+    }
+  });
+}
+`)
+	expectPrintedWithUnsupportedFeatures(t, compat.Generator, "function* foo() { try { yield a } catch (e) { b(e) } finally { c() } }", `function foo() {
+  var e;
+  return __generate(this, function(_) {
+    switch (_.n) {
+      case 0:
+        _.t.push([2, 3]);
+        return [5, a, 1];
+      case 1:
+        return [3, 4];
+      case 2:
+        e = _.v;
+        b(e);
+        return [3, 4];
+      case 3:
+        c();
+        return [4];
+      case 4:
+        return [2];
+    }
+  });
+}
+`)
+	expectPrintedWithUnsupportedFeatures(t, compat.Generator, "function* foo() { a: { if (b) break a; yield c } }", `function foo() {
+  return __generate(this, function(_) {
+    switch (_.n) {
+      case 0:
+        if (b) return [3, 1];
+        return [5, c, 1];
+      case 1:
+        return [2];
+    }
+  });
+}
+`)
+	expectPrintedWithUnsupportedFeatures(t, compat.Generator, "function* foo() { a.b(c, yield d) }", `function foo() {
+  var _a, _b, _c;
+  return __generate(this, function(_) {
+    switch (_.n) {
+      case 0:
+        _a = a;
+        _b = _a.b;
+        _c = c;
+        return [5, d, 1];
+      case 1:
+        _b.call(_a, _c, _.v);
+        return [2];
+    }
+  });
+}
+`)
+	expectPrintedWithUnsupportedFeatures(t, compat.Generator, "function* foo() { x = a && (yield b) }", `function foo() {
+  var _a;
+  return __generate(this, function(_) {
+    switch (_.n) {
+      case 0:
+        _a = a;
+        if (!_a) return [3, 2];
+        return [5, b, 1];
+      case 1:
+        _a = _.v;
+      case 2:
+        x = _a;
+        return [2];
+    }
+  });
+}
+`)
+	expectPrintedWithUnsupportedFeatures(t, compat.Generator, "function* foo() { x.y += yield z }", `function foo() {
+  var _a, _b;
+  return __generate(this, function(_) {
+    switch (_.n) {
+      case 0:
+        _a = x;
+        _b = _a.y;
+        return [5, z, 1];
+      case 1:
+        _a.y = _b + _.v;
+        return [2];
+    }
+  });
+}
+`)
+	expectPrintedWithUnsupportedFeatures(t, compat.Generator, "function* foo() { x = a ? yield b : c }", `function foo() {
+  var _a;
+  return __generate(this, function(_) {
+    switch (_.n) {
+      case 0:
+        if (!a) return [3, 2];
+        return [5, b, 1];
+      case 1:
+        _a = _.v;
+        return [3, 3];
+      case 2:
+        _a = c;
+      case 3:
+        x = _a;
+        return [2];
+    }
+  });
+}
+`)
+	expectPrintedWithUnsupportedFeatures(t, compat.Generator, "function* foo() { yield arguments[0] }", `function foo() {
+  var _arguments = arguments;
+  return __generate(this, function(_) {
+    switch (_.n) {
+      case 0:
+        return [5, _arguments[0], 1];
+      case 1:
+        return [2];
+    }
+  });
+}
+`)
+	expectPrintedWithUnsupportedFeatures(t, compat.Generator|compat.AsyncAwait, "async function foo() { await a; try { await b } catch { c() } }", `function foo() {
+  return __async(this, null, function() {
+    return __generate(this, function(_) {
+      switch (_.n) {
+        case 0:
+          return [5, a, 1];
+        case 1:
+          _.t.push([3]);
+          return [5, b, 2];
+        case 2:
+          return [3, 4];
+        case 3:
+          c();
+          return [3, 4];
+        case 4:
+          return [2];
+      }
+    });
+  });
+}
+`)
+
+	expectParseErrorWithUnsupportedFeatures(t, compat.Generator, "function* foo() { with (a) yield b }",
+		"<stdin>: ERROR: Transforming this use of \"yield\" to the configured target environment is not supported yet\n")
+	expectParseErrorWithUnsupportedFeatures(t, compat.Generator, "function* foo() { x = class { [yield]() {} } }",
+		"<stdin>: ERROR: Transforming this use of \"yield\" to the configured target environment is not supported yet\n")
+}
+
 func TestForAwait(t *testing.T) {
 	err := ""
 	expectParseErrorWithUnsupportedFeatures(t, compat.AsyncAwait, "async function gen() { for await (x of y) ; }", err)
@@ -815,10 +1124,7 @@ func TestForAwait(t *testing.T) {
 	// This is ok because for-await can be lowered to yield
 	expectParseErrorWithUnsupportedFeatures(t, compat.ForAwait|compat.AsyncAwait, "async function gen() { for await (x of y) ; }", err)
 
-	// This is not ok because for-await can't be lowered
-	err =
-		"<stdin>: ERROR: Transforming async functions to the configured target environment is not supported yet\n" +
-			"<stdin>: ERROR: Transforming for-await loops to the configured target environment is not supported yet\n"
+	// This is ok because for-await can be lowered to a generator state machine
 	expectParseErrorWithUnsupportedFeatures(t, compat.ForAwait|compat.AsyncAwait|compat.Generator, "async function gen() { for await (x of y) ; }", err)
 
 	// Can't use for-await at the top-level without top-level await
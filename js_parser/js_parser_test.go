@@ -2,6 +2,7 @@ package js_parser
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -6567,18 +6568,15 @@ func TestES5(t *testing.T) {
 		"<stdin>: ERROR: Transforming let to the configured target environment is not supported yet\n")
 	expectPrintedTarget(t, 5, "async => foo;", "(function(async) {\n  return foo;\n});\n")
 	expectPrintedTarget(t, 5, "x => x;", "(function(x) {\n  return x;\n});\n")
-	expectParseErrorTarget(t, 5, "async () => foo;",
-		"<stdin>: ERROR: Transforming async functions to the configured target environment is not supported yet\n")
+	expectPrintedTarget(t, 5, "async () => foo;", "(function() {\n  return __async(null, null, function() {\n    return __generate(this, function(_) {\n      return [2, foo];\n    });\n  });\n});\n")
 	expectParseErrorTarget(t, 5, "class Foo {}",
 		"<stdin>: ERROR: Transforming class syntax to the configured target environment is not supported yet\n")
 	expectParseErrorTarget(t, 5, "(class {});",
 		"<stdin>: ERROR: Transforming class syntax to the configured target environment is not supported yet\n")
-	expectParseErrorTarget(t, 5, "function* gen() {}",
-		"<stdin>: ERROR: Transforming generator functions to the configured target environment is not supported yet\n")
-	expectParseErrorTarget(t, 5, "(function* () {});",
-		"<stdin>: ERROR: Transforming generator functions to the configured target environment is not supported yet\n")
+	expectPrintedTarget(t, 5, "function* gen() {}", "function gen() {\n  return __generate(this, function(_) {\n    return [2];\n  });\n}\n")
+	expectPrintedTarget(t, 5, "(function* () {});", "(function() {\n  return __generate(this, function(_) {\n    return [2];\n  });\n});\n")
 	expectParseErrorTarget(t, 5, "({ *foo() {} });",
-		"<stdin>: ERROR: Transforming generator functions to the configured target environment is not supported yet\n")
+		"<stdin>: ERROR: Transforming object literal extensions to the configured target environment is not supported yet\n")
 }
 
 func TestASCIIOnly(t *testing.T) {
@@ -6980,3 +6978,72 @@ func TestUsing(t *testing.T) {
 	expectPrintedMangle(t, "using x = null, y = z", "using x = null, y = z;\n")
 	expectPrintedMangle(t, "using x = z, y = undefined", "using x = z, y = void 0;\n")
 }
+
+func expectEncodeRoundTrip(t *testing.T, contents string, options config.Options) {
+	t.Helper()
+	t.Run(contents, func(t *testing.T) {
+		t.Helper()
+		log := logger.NewDeferLog(logger.DeferLogNoVerboseOrDebug, nil)
+		options.OmitRuntimeForTests = true
+		tree, ok := Parse(log, test.SourceForTest(contents), OptionsFromConfig(&options))
+		if !ok {
+			t.Fatal("Parse error")
+		}
+		w := helpers.BinaryWriter{}
+		if !js_ast.EncodeAST(&w, tree, 0) {
+			t.Fatal("Failed to encode")
+		}
+		r := helpers.NewBinaryReader(w.Bytes())
+		decoded := js_ast.DecodeAST(r, 0)
+		if r.Failed() || !r.IsAtEnd() {
+			t.Fatal("Failed to decode")
+		}
+		if !reflect.DeepEqual(decoded, tree) {
+			t.Fatal("The decoded tree is different")
+		}
+	})
+}
+
+func TestEncodeAST(t *testing.T) {
+	corpus := []string{
+		"#!/usr/bin/env node\n'use strict'; let x = 1, [y, , ...z] = a, {b, c: [d] = e, ...f} = g",
+		"function* foo(a = 1, {b}, ...c) { yield; yield* a; return new.target }",
+		"async function foo() { for await (let x of y) await x; label: for (;;) { break label; continue } }",
+		"class Foo extends Bar { static #x = 1; get y() { return super.y } static { this.z = 2 } accessor w; constructor() { super() } }",
+		"try { a() } catch { b() } finally { c() } try {} catch ({ d }) {} switch (x) { case 1: break; default: y }",
+		"x = a ? b?.c : d?.[e]?.(f); x ??= `a${b}c`; x = tag`\\u{41}${y}`; x = /re/g; x = 123n; x = 1.5e-7; x = -0",
+		"x = { a, b: c, [d]: e, ...f, get g() {}, set g(v) {}, h() {}, async *i() {}, __proto__: null }",
+		"with (x) { y } do x(); while (y); while (x) y(); for (x in y) ; if (x) y; else if (z) w; else ;",
+		"debugger; delete x.y; void 0; typeof x; !x; ~x; x++; --x; x **= 2; (x, y); import.meta.url",
+		"import a, { b as c, 'd e' as f } from 'g'; import * as h from 'i'; export { a, c as 'j k' }; export * from 'l'; export * as m from 'n'",
+		"import x from './x.json' with { type: 'json' }; export default function () {} import('a'); require('b'); require.resolve('c')",
+		"export default class {} export let a = 1; export function b() {} export class C {}",
+		"let x = () => {}, y = async x => x, z = (a, b = 1) => ({ a, b })",
+	}
+	ts := []string{
+		"enum Foo { A, B = 'b', C = A + 1 } namespace Bar { export let x = Foo.A; export namespace Baz { export const y = 1 } }",
+		"declare class X {} abstract class Y<T> implements Z { private x: number; constructor(public y: T, readonly z?: string) {} abstract foo(): void }",
+		"import x = require('x'); import y = Foo.Bar; export = x; let z = <T>(a: T): T => a as T satisfies unknown",
+		"@dec class Foo { @dec() method(@dec x) {} @dec prop = 1 }",
+		"const enum E { A = 1, B = A << 2 } type T = { a: string }; interface I {} let x = E.B!",
+	}
+	jsx := []string{
+		"let x = <div a='b' {...c} d={e}>text {f} <g.h /> <></></div>",
+	}
+	for _, contents := range corpus {
+		expectEncodeRoundTrip(t, contents, config.Options{})
+		expectEncodeRoundTrip(t, contents, config.Options{MinifySyntax: true, MinifyIdentifiers: true, TreeShaking: true})
+		expectEncodeRoundTrip(t, contents, config.Options{Mode: config.ModeBundle, OutputFormat: config.FormatESModule})
+		expectEncodeRoundTrip(t, contents, config.Options{UnsupportedJSFeatures: compat.UnsupportedJSFeatures(map[compat.Engine]compat.Semver{
+			compat.ES: {Parts: []int{2015}},
+		})})
+	}
+	for _, contents := range ts {
+		expectEncodeRoundTrip(t, contents, config.Options{TS: config.TSOptions{Parse: true}})
+		expectEncodeRoundTrip(t, contents, config.Options{TS: config.TSOptions{Parse: true}, MinifySyntax: true, Mode: config.ModeBundle})
+	}
+	for _, contents := range jsx {
+		expectEncodeRoundTrip(t, contents, config.Options{JSX: config.JSXOptions{Parse: true}})
+		expectEncodeRoundTrip(t, contents, config.Options{JSX: config.JSXOptions{Parse: true, Preserve: true}})
+	}
+}
@@ -285,6 +285,8 @@ type printer struct {
 	extractedLegalComments []string
 	js                     []byte
 	jsonMetadataImports    []string
+	externalRequires       []string
+	systemImports          []SystemImport
 	binaryExprStack        []binaryExprVisitor
 	options                Options
 	builder                sourcemap.ChunkBuilder
@@ -1460,11 +1462,13 @@ func (p *printer) printRequireOrImportExpr(importRecordIndex uint32, level js_as
 		kind := ast.ImportDynamic
 		if !p.options.UnsupportedFeatures.Has(compat.DynamicImport) {
 			p.printSpaceBeforeIdentifier()
-			switch phase {
-			case ast.DeferPhase:
+			switch {
+			case phase == ast.DeferPhase:
 				p.print("import.defer(")
-			case ast.SourcePhase:
+			case phase == ast.SourcePhase:
 				p.print("import.source(")
+			case p.options.OutputFormat == config.FormatSystem:
+				p.print("_context.import(")
 			default:
 				p.print("import(")
 			}
@@ -2000,6 +2004,7 @@ const (
 	isCallTargetOrTemplateTag
 	isPropertyAccessTarget
 	parentWasUnaryOrBinaryOrIfTest
+	didAlreadyUpdateLiveBinding
 )
 
 func (p *printer) printExpr(expr js_ast.Expr, level js_ast.L, flags printExprFlags) {
@@ -2060,7 +2065,11 @@ func (p *printer) printExpr(expr js_ast.Expr, level js_ast.L, flags printExprFla
 	case *js_ast.EImportMeta:
 		p.printSpaceBeforeIdentifier()
 		p.addSourceMapping(expr.Loc)
-		p.print("import.meta")
+		if p.options.OutputFormat == config.FormatSystem {
+			p.print("_context.meta")
+		} else {
+			p.print("import.meta")
+		}
 
 	case *js_ast.ENameOfSymbol:
 		name := p.mangledPropName(e.Ref)
@@ -2484,6 +2493,9 @@ func (p *printer) printExpr(expr js_ast.Expr, level js_ast.L, flags printExprFla
 			p.print(")")
 		}
 
+	case *js_ast.EURLString:
+		p.printPath(e.ImportRecordIndex, p.importRecords[e.ImportRecordIndex].Kind)
+
 	case *js_ast.EImportString:
 		p.addSourceMapping(expr.Loc)
 		p.printRequireOrImportExpr(e.ImportRecordIndex, level, flags, e.CloseParenLoc, p.importRecords[e.ImportRecordIndex].Phase)
@@ -3242,6 +3254,13 @@ func (p *printer) printExpr(expr js_ast.Expr, level js_ast.L, flags printExprFla
 		}
 
 	case *js_ast.EUnary:
+		if p.options.SystemExports != nil && (flags&didAlreadyUpdateLiveBinding) == 0 {
+			if aliases := p.systemLiveBindingAliases(e); aliases != nil {
+				p.printSystemLiveBinding(expr, aliases, level, flags)
+				break
+			}
+		}
+
 		entry := js_ast.OpTable[e.Op]
 		wrap := level >= entry.Level
 
@@ -3293,6 +3312,17 @@ func (p *printer) printExpr(expr js_ast.Expr, level js_ast.L, flags printExprFla
 		}
 
 	case *js_ast.EBinary:
+		if p.options.SystemExports != nil && (flags&didAlreadyUpdateLiveBinding) == 0 {
+			if aliases := p.systemLiveBindingAliases(e); aliases != nil {
+				p.printSystemLiveBinding(expr, aliases, level, flags)
+				break
+			}
+			if refs := p.systemDestructuringTargets(e, flags); refs != nil {
+				p.printSystemDestructuring(expr, refs, level)
+				break
+			}
+		}
+
 		// The handling of binary expressions is convoluted because we're using
 		// iteration on the heap instead of recursion on the call stack to avoid
 		// stack overflow for deeply-nested ASTs. See the comments for the similar
@@ -3316,7 +3346,8 @@ func (p *printer) printExpr(expr js_ast.Expr, level js_ast.L, flags printExprFla
 			leftBinary, ok := left.Data.(*js_ast.EBinary)
 
 			// Stop iterating if iteration doesn't apply to the left node
-			if !ok {
+			if !ok || (p.options.SystemExports != nil && (p.systemLiveBindingAliases(leftBinary) != nil ||
+				p.systemDestructuringTargets(leftBinary, v.leftFlags) != nil)) {
 				p.printExpr(left, v.leftLevel, v.leftFlags)
 				v.visitRightAndFinish(p)
 				break
@@ -3933,16 +3964,13 @@ func (p *printer) printPath(importRecordIndex uint32, importKind ast.ImportKind)
 	p.addSourceMapping(record.Range.Loc)
 	p.printQuotedUTF8(record.Path.Text, printQuotedNoWrap)
 
+	// The UMD wrapper passes external modules to the factory function
+	if importKind == ast.ImportRequire && p.options.OutputFormat == config.FormatUMD && !record.SourceIndex.IsValid() {
+		p.externalRequires = append(p.externalRequires, record.Path.Text)
+	}
+
 	if p.options.NeedsMetafile {
-		external := ""
-		if (record.Flags & ast.ShouldNotBeExternalInMetafile) == 0 {
-			external = p.options.MetafileFormat.MaybeRemoveWhitespace(",\n          \"external\": true")
-		}
-		p.jsonMetadataImports = append(p.jsonMetadataImports, fmt.Sprintf(
-			p.options.MetafileFormat.MaybeRemoveWhitespace("\n        {\n          \"path\": %s,\n          \"kind\": %s%s\n        }"),
-			helpers.QuoteForJSON(record.Path.Text, p.options.ASCIIOnly),
-			helpers.QuoteForJSON(importKind.StringForMetafile(), p.options.ASCIIOnly),
-			external))
+		p.addJSONMetadataImport(record, importKind)
 	}
 
 	if record.AssertOrWith != nil && importKind == ast.ImportStmt {
@@ -3964,6 +3992,318 @@ func (p *printer) printPath(importRecordIndex uint32, importKind ast.ImportKind)
 	}
 }
 
+func (p *printer) addJSONMetadataImport(record ast.ImportRecord, importKind ast.ImportKind) {
+	external := ""
+	if (record.Flags & ast.ShouldNotBeExternalInMetafile) == 0 {
+		external = p.options.MetafileFormat.MaybeRemoveWhitespace(",\n          \"external\": true")
+	}
+	p.jsonMetadataImports = append(p.jsonMetadataImports, fmt.Sprintf(
+		p.options.MetafileFormat.MaybeRemoveWhitespace("\n        {\n          \"path\": %s,\n          \"kind\": %s%s\n        }"),
+		helpers.QuoteForJSON(record.Path.Text, p.options.ASCIIOnly),
+		helpers.QuoteForJSON(importKind.StringForMetafile(), p.options.ASCIIOnly),
+		external))
+}
+
+func (p *printer) addSystemImportStmt(s *js_ast.SImport) {
+	var bindings []string
+	var setter []string
+
+	// "foo = _m.default"
+	if s.DefaultName != nil {
+		name := p.systemIdentifier(p.renamer.NameForSymbol(s.DefaultName.Ref))
+		bindings = append(bindings, name)
+		setter = append(setter, p.systemSetBinding(s.DefaultName.Ref, name, "_m.default"))
+	}
+
+	// "foo = _m.bar"
+	if s.Items != nil {
+		for _, item := range *s.Items {
+			name := p.systemIdentifier(p.renamer.NameForSymbol(item.Name.Ref))
+			bindings = append(bindings, name)
+			setter = append(setter, p.systemSetBinding(item.Name.Ref, name, p.systemPropertyAccess("_m", item.Alias)))
+		}
+	}
+
+	// "ns = _m"
+	if s.StarNameLoc != nil {
+		name := p.systemIdentifier(p.renamer.NameForSymbol(s.NamespaceRef))
+		bindings = append(bindings, name)
+		setter = append(setter, p.systemSetBinding(s.NamespaceRef, name, "_m"))
+	}
+
+	p.addSystemImport(s.ImportRecordIndex, bindings, setter)
+}
+
+// "_export({ foo: bar })"
+func (p *printer) printSystemExportClause(loc logger.Loc, s *js_ast.SExportClause) {
+	items := s.Items
+	if p.options.SystemHoistedFunctions != nil {
+		items = nil
+		for _, item := range s.Items {
+			if !p.options.SystemHoistedFunctions[ast.FollowSymbols(p.symbols, item.Name.Ref)] {
+				items = append(items, item)
+			}
+		}
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	p.addSourceMapping(loc)
+	p.printIndent()
+	p.printSpaceBeforeIdentifier()
+	p.print("_export({")
+
+	if !s.IsSingleLine {
+		p.options.Indent++
+	}
+
+	for i, item := range items {
+		if i != 0 {
+			p.print(",")
+		}
+
+		if p.options.LineLimit <= 0 || !p.printNewlinePastLineLimit() {
+			if s.IsSingleLine {
+				p.printSpace()
+			} else {
+				p.printNewline()
+				p.printIndent()
+			}
+		}
+
+		if item.Alias == "__proto__" {
+			// A "__proto__" key would set the prototype instead
+			p.print("[")
+			p.printQuotedUTF8(item.Alias, 0)
+			p.print("]")
+		} else if p.canPrintIdentifier(item.Alias) {
+			p.printSpaceBeforeIdentifier()
+			p.printIdentifier(item.Alias)
+		} else {
+			p.printQuotedUTF8(item.Alias, 0)
+		}
+		p.print(":")
+		p.printSpace()
+		name := p.renamer.NameForSymbol(item.Name.Ref)
+		p.addSourceMappingForName(item.Name.Loc, name, item.Name.Ref)
+		p.printIdentifier(name)
+	}
+
+	if !s.IsSingleLine {
+		p.options.Indent--
+		p.printNewline()
+		p.printIndent()
+	} else {
+		p.printSpace()
+	}
+
+	p.print("})")
+	p.printSemicolonAfterStatement()
+}
+
+// The "system" format doesn't have import statements. Instead, each imported
+// module is listed as a dependency of the "System.register" call along with a
+// setter function that is called with the module's namespace object whenever
+// one of its exports changes. The setter is given the namespace as "_m".
+func (p *printer) addSystemImport(importRecordIndex uint32, bindings []string, setter []string) {
+	record := p.importRecords[importRecordIndex]
+	if p.options.NeedsMetafile {
+		p.addJSONMetadataImport(record, ast.ImportStmt)
+	}
+	p.systemImports = append(p.systemImports, SystemImport{
+		Path:     record.Path.Text,
+		Bindings: bindings,
+		Setter:   setter,
+	})
+}
+
+func (p *printer) systemIdentifier(name string) string {
+	if p.options.ASCIIOnly {
+		return string(QuoteIdentifier(nil, name, p.options.UnsupportedFeatures))
+	}
+	return name
+}
+
+func (p *printer) systemPropertyAccess(target string, name string) string {
+	if p.canPrintIdentifier(name) {
+		return target + "." + p.systemIdentifier(name)
+	}
+	return fmt.Sprintf("%s[%s]", target, helpers.QuoteForJSON(name, p.options.ASCIIOnly))
+}
+
+// Imported bindings that are re-exported must also be passed to "_export"
+// when they change: "_export("foo", foo = _m.foo)"
+func (p *printer) systemSetBinding(ref ast.Ref, name string, value string) string {
+	text := name + " = " + value
+	if p.options.MinifyWhitespace {
+		text = name + "=" + value
+	}
+	for _, alias := range p.options.SystemExports[ast.FollowSymbols(p.symbols, ref)] {
+		text = p.systemExportCall(alias, text)
+	}
+	return text
+}
+
+func (p *printer) systemExportCall(alias string, value string) string {
+	if p.options.MinifyWhitespace {
+		return fmt.Sprintf("_export(%s,%s)", helpers.QuoteForJSON(alias, p.options.ASCIIOnly), value)
+	}
+	return fmt.Sprintf("_export(%s, %s)", helpers.QuoteForJSON(alias, p.options.ASCIIOnly), value)
+}
+
+// Assignments to exported top-level variables in the "system" format must also
+// call "_export" to update the value seen by importers (i.e. a live binding).
+// This returns the export aliases if the expression is such an assignment.
+func (p *printer) systemLiveBindingAliases(expr js_ast.E) []string {
+	var target js_ast.Expr
+	switch e := expr.(type) {
+	case *js_ast.EBinary:
+		if e.Op.BinaryAssignTarget() == js_ast.AssignTargetNone {
+			return nil
+		}
+		target = e.Left
+	case *js_ast.EUnary:
+		if e.Op.UnaryAssignTarget() == js_ast.AssignTargetNone {
+			return nil
+		}
+		target = e.Value
+	default:
+		return nil
+	}
+	if id, ok := target.Data.(*js_ast.EIdentifier); ok {
+		return p.options.SystemExports[ast.FollowSymbols(p.symbols, id.Ref)]
+	}
+	return nil
+}
+
+// Destructuring assignments to exported symbols are only handled when the
+// result is unused: "([a, b] = c, _export("a", a), _export("b", b))"
+func (p *printer) systemDestructuringTargets(e *js_ast.EBinary, flags printExprFlags) (refs []ast.Ref) {
+	if e.Op != js_ast.BinOpAssign || (flags&exprResultIsUnused) == 0 {
+		return nil
+	}
+	var visit func(target js_ast.Expr)
+	visit = func(target js_ast.Expr) {
+		switch t := target.Data.(type) {
+		case *js_ast.EIdentifier:
+			if ref := ast.FollowSymbols(p.symbols, t.Ref); p.options.SystemExports[ref] != nil {
+				refs = append(refs, ref)
+			}
+		case *js_ast.EArray:
+			for _, item := range t.Items {
+				visit(item)
+			}
+		case *js_ast.EObject:
+			for _, property := range t.Properties {
+				visit(property.ValueOrNil)
+			}
+		case *js_ast.ESpread:
+			visit(t.Value)
+		case *js_ast.EBinary:
+			if t.Op == js_ast.BinOpAssign {
+				visit(t.Left)
+			}
+		}
+	}
+	switch e.Left.Data.(type) {
+	case *js_ast.EArray, *js_ast.EObject:
+		visit(e.Left)
+	}
+	return
+}
+
+func (p *printer) printSystemDestructuring(expr js_ast.Expr, refs []ast.Ref, level js_ast.L) {
+	wrap := level >= js_ast.LComma
+	if wrap {
+		p.print("(")
+	}
+	p.printExpr(expr, js_ast.LComma, exprResultIsUnused|didAlreadyUpdateLiveBinding)
+	for _, ref := range refs {
+		for _, alias := range p.options.SystemExports[ref] {
+			p.print(",")
+			p.printSpace()
+			p.print("_export(")
+			p.printQuotedUTF8(alias, 0)
+			p.print(",")
+			p.printSpace()
+			p.printIdentifier(p.renamer.NameForSymbol(ref))
+			p.print(")")
+		}
+	}
+	if wrap {
+		p.print(")")
+	}
+}
+
+func (p *printer) printSystemLiveBinding(expr js_ast.Expr, aliases []string, level js_ast.L, flags printExprFlags) {
+	wrap := level >= js_ast.LNew || (flags&isNewTarget) != 0
+	unary, isUnary := expr.Data.(*js_ast.EUnary)
+
+	// A postfix update evaluates to the old value, so the new value must be
+	// computed separately if the result is used: "(_export("x", x + 1), x++)"
+	if isUnary && !unary.Op.IsPrefix() {
+		if (flags & exprResultIsUnused) != 0 {
+			// The result is unused, so just use the prefix form instead
+			op := js_ast.UnOpPreInc
+			if unary.Op == js_ast.UnOpPostDec {
+				op = js_ast.UnOpPreDec
+			}
+			expr = js_ast.Expr{Loc: expr.Loc, Data: &js_ast.EUnary{Op: op, Value: unary.Value}}
+		} else {
+			wrap = level >= js_ast.LComma
+			if wrap {
+				p.print("(")
+			}
+			for _, alias := range aliases {
+				p.printSpaceBeforeIdentifier()
+				p.print("_export(")
+				p.printQuotedUTF8(alias, 0)
+				p.print(",")
+				p.printSpace()
+			}
+			p.printExpr(unary.Value, js_ast.LAdd, 0)
+			p.printSpace()
+			if unary.Op == js_ast.UnOpPostInc {
+				p.print("+")
+			} else {
+				p.print("-")
+			}
+			p.printSpace()
+			p.print("1")
+			for range aliases {
+				p.print(")")
+			}
+			p.print(",")
+			p.printSpace()
+			p.printExpr(expr, js_ast.LComma, didAlreadyUpdateLiveBinding)
+			if wrap {
+				p.print(")")
+			}
+			return
+		}
+	}
+
+	// "_export("x", x = y)"
+	if wrap {
+		p.print("(")
+	}
+	for _, alias := range aliases {
+		p.printSpaceBeforeIdentifier()
+		p.print("_export(")
+		p.printQuotedUTF8(alias, 0)
+		p.print(",")
+		p.printSpace()
+	}
+	p.printExpr(expr, js_ast.LComma, didAlreadyUpdateLiveBinding)
+	for range aliases {
+		p.print(")")
+	}
+	if wrap {
+		p.print(")")
+	}
+}
+
 func (p *printer) printImportCallAssertOrWith(assertOrWith *ast.ImportAssertOrWith, outerIsMultiLine bool) {
 	// Omit import assertions/attributes if we know the "import()" syntax doesn't
 	// support a second argument (i.e. both import assertions and import
@@ -4197,6 +4537,17 @@ func (p *printer) printStmt(stmt js_ast.Stmt, flags printStmtFlags) {
 			p.printIndent()
 		}
 		p.printSpaceBeforeIdentifier()
+		if s2, ok := s.Value.Data.(*js_ast.SExpr); ok && p.options.OutputFormat == config.FormatSystem {
+			// "_export("default", value)"
+			p.print("_export(")
+			p.printQuotedUTF8("default", 0)
+			p.print(",")
+			p.printSpace()
+			p.printExpr(s2.Value, js_ast.LComma, 0)
+			p.print(")")
+			p.printSemicolonAfterStatement()
+			return
+		}
 		p.print("export default")
 		p.printSpace()
 
@@ -4245,6 +4596,18 @@ func (p *printer) printStmt(stmt js_ast.Stmt, flags printStmtFlags) {
 		}
 
 	case *js_ast.SExportStar:
+		if p.options.OutputFormat == config.FormatSystem {
+			if s.Alias != nil {
+				// "_export("ns", _m)"
+				p.addSystemImport(s.ImportRecordIndex, nil, []string{p.systemExportCall(s.Alias.OriginalName, "_m")})
+			} else {
+				// The linker generates this setter since it needs the export names of the chunk
+				p.addSystemImport(s.ImportRecordIndex, nil, nil)
+				p.systemImports[len(p.systemImports)-1].IsExportStar = true
+			}
+			break
+		}
+
 		p.addSourceMapping(stmt.Loc)
 		p.printIndent()
 		p.printSpaceBeforeIdentifier()
@@ -4265,6 +4628,11 @@ func (p *printer) printStmt(stmt js_ast.Stmt, flags printStmtFlags) {
 		p.printSemicolonAfterStatement()
 
 	case *js_ast.SExportClause:
+		if p.options.OutputFormat == config.FormatSystem {
+			p.printSystemExportClause(stmt.Loc, s)
+			break
+		}
+
 		p.addSourceMapping(stmt.Loc)
 		p.printIndent()
 		p.printSpaceBeforeIdentifier()
@@ -4312,6 +4680,15 @@ func (p *printer) printStmt(stmt js_ast.Stmt, flags printStmtFlags) {
 		p.printSemicolonAfterStatement()
 
 	case *js_ast.SExportFrom:
+		if p.options.OutputFormat == config.FormatSystem {
+			setter := make([]string, len(s.Items))
+			for i, item := range s.Items {
+				setter[i] = p.systemExportCall(item.Alias, p.systemPropertyAccess("_m", item.OriginalName))
+			}
+			p.addSystemImport(s.ImportRecordIndex, nil, setter)
+			break
+		}
+
 		p.addSourceMapping(stmt.Loc)
 		p.printIndent()
 		p.printSpaceBeforeIdentifier()
@@ -4708,6 +5085,11 @@ func (p *printer) printStmt(stmt js_ast.Stmt, flags printStmtFlags) {
 		p.needsSemicolon = false
 
 	case *js_ast.SImport:
+		if p.options.OutputFormat == config.FormatSystem {
+			p.addSystemImportStmt(s)
+			break
+		}
+
 		itemCount := 0
 
 		p.addSourceMapping(stmt.Loc)
@@ -4920,6 +5302,15 @@ type Options struct {
 	// Property mangling results go here
 	MangledProps map[ast.Ref]string
 
+	// For the "system" format, these are the export aliases of each exported
+	// top-level symbol. Assignments to these symbols also call "_export".
+	SystemExports map[ast.Ref][]string
+
+	// For the "system" format, these are the function declarations that were
+	// moved out of "execute" and exported before it runs. They are left out of
+	// the export clause at the end.
+	SystemHoistedFunctions map[ast.Ref]bool
+
 	// This will be present if the input file had a source map. In that case we
 	// want to map all the way back to the original input file(s).
 	InputSourceMap *sourcemap.SourceMap
@@ -4960,12 +5351,37 @@ type PrintResult struct {
 	ExtractedLegalComments []string
 	JSONMetadataImports    []string
 
+	// These are the paths of external modules passed to "require()" in the
+	// order they were printed. This is only filled in for the UMD format since
+	// the UMD wrapper needs to know about them ahead of time.
+	ExternalRequires []string
+
+	// For the "system" format, import and re-export statements are not printed.
+	// They are returned here instead so the linker can generate the dependency
+	// list and setter functions of the "System.register" call.
+	SystemImports []SystemImport
+
 	// This source map chunk just contains the VLQ-encoded offsets for the "JS"
 	// field above. It's not a full source map. The bundler will be joining many
 	// source map chunks together to form the final source map.
 	SourceMapChunk sourcemap.Chunk
 }
 
+type SystemImport struct {
+	Path string
+
+	// These top-level variables are assigned to by the setter
+	Bindings []string
+
+	// These are the statements inside the setter function. The module
+	// namespace object is available as "_m".
+	Setter []string
+
+	// This is an "export * from" statement. The setter must re-export every
+	// name except "default" and the names that the chunk exports itself.
+	IsExportStar bool
+}
+
 func Print(tree js_ast.AST, symbols ast.SymbolMap, r renamer.Renamer, options Options) PrintResult {
 	p := &printer{
 		symbols:       symbols,
@@ -5016,6 +5432,8 @@ func Print(tree js_ast.AST, symbols ast.SymbolMap, r renamer.Renamer, options Op
 		JS:                     p.js,
 		JSONMetadataImports:    p.jsonMetadataImports,
 		ExtractedLegalComments: p.extractedLegalComments,
+		ExternalRequires:       p.externalRequires,
+		SystemImports:          p.systemImports,
 	}
 	if options.SourceMap != config.SourceMapNone {
 		// This is expensive. Only do this if it's necessary.
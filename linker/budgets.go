@@ -0,0 +1,156 @@
+package linker
+
+// This file checks the final output files against the size budgets in the
+// build options. Budgets are checked after plugins have transformed each
+// chunk, so the sizes are the sizes of the files that are actually written.
+// Exceeding a budget is an error by default, but each kind of budget has a
+// message ID so that "LogOverride" can turn it into a warning instead.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strings"
+
+	"github.com/ije/esbuild-internal/ast"
+	"github.com/ije/esbuild-internal/config"
+	"github.com/ije/esbuild-internal/graph"
+	"github.com/ije/esbuild-internal/helpers"
+	"github.com/ije/esbuild-internal/logger"
+)
+
+func (c *linkerContext) checkBudgets(outputFiles []graph.OutputFile) {
+	if len(c.options.Budgets) == 0 {
+		return
+	}
+
+	c.timer.Begin("Check budgets")
+	defer c.timer.End("Check budgets")
+
+	chunkIndexForPath := make(map[string]uint32, len(c.chunks))
+	for chunkIndex, chunk := range c.chunks {
+		chunkIndexForPath[c.fs.Join(c.options.AbsOutputDir, chunk.finalRelPath)] = uint32(chunkIndex)
+	}
+	outputIndexForChunk := make([]int, len(c.chunks))
+	for outputIndex, outputFile := range outputFiles {
+		if chunkIndex, ok := chunkIndexForPath[outputFile.AbsPath]; ok {
+			outputIndexForChunk[chunkIndex] = outputIndex
+		}
+	}
+
+	// Compressing is expensive, so only do it once per file
+	gzipSizes := make(map[int]int)
+	gzipSize := func(outputIndex int) int {
+		size, ok := gzipSizes[outputIndex]
+		if !ok {
+			size = gzipSizeOf(outputFiles[outputIndex].Contents)
+			gzipSizes[outputIndex] = size
+		}
+		return size
+	}
+	rawSize := func(outputIndex int) int {
+		return len(outputFiles[outputIndex].Contents)
+	}
+
+	for _, budget := range c.options.Budgets {
+		for outputIndex, outputFile := range outputFiles {
+			relPath, ok := c.fs.Rel(c.options.AbsOutputDir, outputFile.AbsPath)
+			if !ok {
+				continue
+			}
+			if !helpers.GlobPatternMatches(budget.Pattern, strings.ReplaceAll(relPath, "\\", "/")) {
+				continue
+			}
+
+			outputIndices := []int{outputIndex}
+			if budget.IncludeStaticImports {
+				chunkIndex, ok := chunkIndexForPath[outputFile.AbsPath]
+				if !ok || !c.chunks[chunkIndex].isEntryPoint {
+					continue
+				}
+				for _, importedChunkIndex := range c.staticallyImportedChunks(chunkIndex) {
+					outputIndices = append(outputIndices, outputIndexForChunk[importedChunkIndex])
+				}
+			}
+
+			if budget.MaxBytes > 0 {
+				c.checkBudget(budget, logger.MsgID_Budget_MaxBytes, budget.MaxBytes, "", outputFiles, outputIndices, rawSize)
+			}
+			if budget.MaxGzipBytes > 0 {
+				c.checkBudget(budget, logger.MsgID_Budget_MaxGzipBytes, budget.MaxGzipBytes, " when gzipped", outputFiles, outputIndices, gzipSize)
+			}
+		}
+	}
+}
+
+func (c *linkerContext) checkBudget(
+	budget config.Budget,
+	id logger.MsgID,
+	maxBytes int,
+	suffix string,
+	outputFiles []graph.OutputFile,
+	outputIndices []int,
+	sizeOf func(outputIndex int) int,
+) {
+	total := 0
+	for _, outputIndex := range outputIndices {
+		total += sizeOf(outputIndex)
+	}
+	if total <= maxBytes {
+		return
+	}
+
+	pattern := helpers.GlobPatternToString(budget.Pattern)
+	var text string
+	var notes []logger.MsgData
+	if len(outputIndices) == 1 {
+		text = fmt.Sprintf("Output file %q is %d bytes%s, which exceeds the budget of %d bytes for %q",
+			c.prettyOutputPath(outputFiles[outputIndices[0]].AbsPath), total, suffix, maxBytes, pattern)
+	} else {
+		text = fmt.Sprintf("Output file %q and the files it imports are %d bytes%s, which exceeds the budget of %d bytes for %q",
+			c.prettyOutputPath(outputFiles[outputIndices[0]].AbsPath), total, suffix, maxBytes, pattern)
+		for _, outputIndex := range outputIndices {
+			notes = append(notes, logger.MsgData{Text: fmt.Sprintf("The file %q is %d bytes%s",
+				c.prettyOutputPath(outputFiles[outputIndex].AbsPath), sizeOf(outputIndex), suffix)})
+		}
+	}
+	c.log.AddIDWithNotes(id, logger.Error, nil, logger.Range{}, text, notes)
+}
+
+// This returns all chunks that are always loaded along with the given chunk
+// (i.e. everything it imports with a static import, directly or indirectly),
+// in breadth-first order. Dynamic imports are not included.
+func (c *linkerContext) staticallyImportedChunks(chunkIndex uint32) (result []uint32) {
+	visited := map[uint32]bool{chunkIndex: true}
+	queue := []uint32{chunkIndex}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, chunkImport := range c.chunks[current].crossChunkImports {
+			if chunkImport.importKind != ast.ImportStmt && chunkImport.importKind != ast.ImportAt {
+				continue
+			}
+			if !visited[chunkImport.chunkIndex] {
+				visited[chunkImport.chunkIndex] = true
+				queue = append(queue, chunkImport.chunkIndex)
+				result = append(result, chunkImport.chunkIndex)
+			}
+		}
+	}
+	return
+}
+
+func (c *linkerContext) prettyOutputPath(absPath string) string {
+	if relPath, ok := c.fs.Rel(c.fs.Cwd(), absPath); ok {
+		return strings.ReplaceAll(relPath, "\\", "/")
+	}
+	return absPath
+}
+
+func gzipSizeOf(contents []byte) int {
+	var buffer bytes.Buffer
+	writer, _ := gzip.NewWriterLevel(&buffer, gzip.BestCompression)
+	writer.Write(contents)
+	writer.Close()
+	return buffer.Len()
+}
@@ -0,0 +1,187 @@
+package linker
+
+// This file records why each input file ended up in a JavaScript output file,
+// which is written to the metafile when "MetafileExplain" is enabled. Tree
+// shaking only tracks whether each part is live, not what made it live, so
+// the explanation is reconstructed afterward from the live parts. The import
+// chain is the shortest path from an entry point through live parts and
+// import records, which may not be the path that tree shaking happened to
+// take first, but it's the easiest one for a person to follow.
+
+import (
+	"strings"
+
+	"github.com/ije/esbuild-internal/ast"
+	"github.com/ije/esbuild-internal/graph"
+	"github.com/ije/esbuild-internal/helpers"
+	"github.com/ije/esbuild-internal/js_ast"
+)
+
+type inclusionReason struct {
+	// This is the file that caused this file to be included. It's invalid for
+	// entry points.
+	parent ast.Index32
+}
+
+func (c *linkerContext) computeInclusionReasons(chunk *chunkInfo) map[uint32]inclusionReason {
+	reasons := make(map[uint32]inclusionReason)
+	var queue []uint32
+
+	// Start from the entry point for this chunk. Chunks that aren't for an entry
+	// point contain code shared between the entry points in their entry bits.
+	if chunk.isEntryPoint {
+		queue = append(queue, chunk.sourceIndex)
+	} else {
+		for i, entryPoint := range c.graph.EntryPoints() {
+			if chunk.entryBits.HasBit(uint(i)) {
+				queue = append(queue, entryPoint.SourceIndex)
+			}
+		}
+	}
+	for _, sourceIndex := range queue {
+		reasons[sourceIndex] = inclusionReason{}
+	}
+
+	visit := func(parent uint32, sourceIndex uint32) {
+		if _, ok := reasons[sourceIndex]; !ok && c.graph.Files[sourceIndex].IsLive {
+			reasons[sourceIndex] = inclusionReason{parent: ast.MakeIndex32(parent)}
+			queue = append(queue, sourceIndex)
+		}
+	}
+
+	// Do a breadth-first search so that each chain is as short as possible
+	for len(queue) > 0 {
+		sourceIndex := queue[0]
+		queue = queue[1:]
+		repr, ok := c.graph.Files[sourceIndex].InputFile.Repr.(*graph.JSRepr)
+		if !ok {
+			continue
+		}
+		for _, part := range repr.AST.Parts {
+			if !part.IsLive {
+				continue
+			}
+			for _, importRecordIndex := range part.ImportRecordIndices {
+				if record := &repr.AST.ImportRecords[importRecordIndex]; record.SourceIndex.IsValid() && !c.isExternalDynamicImport(record, sourceIndex) {
+					visit(sourceIndex, record.SourceIndex.GetIndex())
+				}
+			}
+			for _, dep := range part.Dependencies {
+				if dep.SourceIndex != sourceIndex {
+					visit(sourceIndex, dep.SourceIndex)
+				}
+			}
+		}
+	}
+
+	return reasons
+}
+
+// This returns the top-level symbols declared by the live parts of the target
+// file that are used by the live parts of the source file, in declaration
+// order. It's empty if the target file was only imported for its side effects.
+func (c *linkerContext) symbolsUsedByFile(sourceIndex uint32, targetIndex uint32) []string {
+	repr := c.graph.Files[sourceIndex].InputFile.Repr.(*graph.JSRepr)
+	usedParts := make(map[uint32]bool)
+	for _, part := range repr.AST.Parts {
+		if part.IsLive {
+			for _, dep := range part.Dependencies {
+				if dep.SourceIndex == targetIndex {
+					usedParts[dep.PartIndex] = true
+				}
+			}
+		}
+	}
+	if len(usedParts) == 0 {
+		return nil
+	}
+	targetRepr := c.graph.Files[targetIndex].InputFile.Repr.(*graph.JSRepr)
+	return c.topLevelSymbolsForParts(targetRepr, func(partIndex uint32) bool { return usedParts[partIndex] })
+}
+
+func (c *linkerContext) topLevelSymbolsForParts(repr *graph.JSRepr, includePart func(partIndex uint32) bool) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for partIndex, part := range repr.AST.Parts {
+		if !includePart(uint32(partIndex)) || isImportPart(part) {
+			continue
+		}
+		for _, declared := range part.DeclaredSymbols {
+			if !declared.IsTopLevel {
+				continue
+			}
+			if name := c.graph.Symbols.Get(declared.Ref).OriginalName; !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// Symbols declared by import statements are just references to symbols in
+// other files, so they aren't interesting here
+func isImportPart(part js_ast.Part) bool {
+	if len(part.Stmts) == 0 {
+		return false
+	}
+	for _, stmt := range part.Stmts {
+		switch stmt.Data.(type) {
+		case *js_ast.SImport, *js_ast.SExportFrom, *js_ast.SExportStar:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (c *linkerContext) generateInclusionReasonForFileJS(reasons map[uint32]inclusionReason, sourceIndex uint32) string {
+	reason, ok := reasons[sourceIndex]
+	if !ok {
+		return ""
+	}
+
+	// Walk up to the entry point and then reverse the chain
+	chain := []uint32{sourceIndex}
+	for reason.parent.IsValid() {
+		parent := reason.parent.GetIndex()
+		chain = append(chain, parent)
+		reason = reasons[parent]
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+
+	var uses []string
+	if len(chain) > 1 {
+		uses = c.symbolsUsedByFile(chain[len(chain)-2], sourceIndex)
+	}
+	repr := c.graph.Files[sourceIndex].InputFile.Repr.(*graph.JSRepr)
+	liveSymbols := c.topLevelSymbolsForParts(repr, func(partIndex uint32) bool { return repr.AST.Parts[partIndex].IsLive })
+
+	paths := make([]string, len(chain))
+	for i, chainIndex := range chain {
+		paths[i] = c.graph.Files[chainIndex].InputFile.Source.PrettyPaths.Select(c.options.MetafilePathStyle)
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(c.options.MetafileFormat.MaybeRemoveWhitespace(",\n          \"includedBecause\": {\n            \"chain\": "))
+	c.writeMetafileStringArray(&sb, paths)
+	sb.WriteString(c.options.MetafileFormat.MaybeRemoveWhitespace(",\n            \"uses\": "))
+	c.writeMetafileStringArray(&sb, uses)
+	sb.WriteString(c.options.MetafileFormat.MaybeRemoveWhitespace(",\n            \"liveSymbols\": "))
+	c.writeMetafileStringArray(&sb, liveSymbols)
+	sb.WriteString(c.options.MetafileFormat.MaybeRemoveWhitespace("\n          }"))
+	return sb.String()
+}
+
+func (c *linkerContext) writeMetafileStringArray(sb *strings.Builder, items []string) {
+	sb.WriteByte('[')
+	for i, item := range items {
+		if i > 0 {
+			sb.WriteString(c.options.MetafileFormat.MaybeRemoveWhitespace(", "))
+		}
+		sb.Write(helpers.QuoteForJSON(item, c.options.ASCIIOnly))
+	}
+	sb.WriteByte(']')
+}
@@ -9,6 +9,8 @@ package linker
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/base64"
 	"encoding/binary"
 	"fmt"
@@ -33,6 +35,7 @@ import (
 	"github.com/ije/esbuild-internal/helpers"
 	"github.com/ije/esbuild-internal/js_ast"
 	"github.com/ije/esbuild-internal/js_lexer"
+	"github.com/ije/esbuild-internal/js_parser"
 	"github.com/ije/esbuild-internal/js_printer"
 	"github.com/ije/esbuild-internal/logger"
 	"github.com/ije/esbuild-internal/renamer"
@@ -72,6 +75,15 @@ type linkerContext struct {
 	// We may need to refer to the "__esm" and/or "__commonJS" runtime symbols
 	cjsRuntimeRef ast.Ref
 	esmRuntimeRef ast.Ref
+
+	// This maps source indices to the name of the manual chunk they were forced
+	// into. Files not in this map are assigned to chunks using their entry bits.
+	manualChunkForFile map[uint32]string
+
+	// These files were copied into more than one entry point chunk when merging
+	// small chunks. Each copy has its own top-level symbols, so uses of them are
+	// never turned into cross-chunk imports.
+	duplicatedFiles map[uint32]bool
 }
 
 type partRange struct {
@@ -88,6 +100,10 @@ type chunkInfo struct {
 	filesWithPartsInChunk map[uint32]bool
 	entryBits             helpers.BitSet
 
+	// This is non-empty if this chunk was created for a manual chunk group. In
+	// that case "entryBits" is the union of the entry bits of all of its files.
+	manualChunkName string
+
 	// For code splitting
 	crossChunkImports []chunkImport
 
@@ -127,6 +143,10 @@ type chunkInfo struct {
 	isEntryPoint  bool
 
 	isExecutable bool
+
+	// This is the "integrity" attribute value for the final contents of this
+	// chunk. It's only computed when HTML files need it.
+	integrity string
 }
 
 type chunkImport struct {
@@ -140,6 +160,7 @@ const (
 	outputPieceNone outputPieceIndexKind = iota
 	outputPieceAssetIndex
 	outputPieceChunkIndex
+	outputPieceIntegrityIndex
 )
 
 // This is a chunk of source code followed by a reference to another chunk. For
@@ -171,8 +192,9 @@ type intermediateOutput struct {
 
 type chunkRepr interface{ isChunk() }
 
-func (*chunkReprJS) isChunk()  {}
-func (*chunkReprCSS) isChunk() {}
+func (*chunkReprJS) isChunk()   {}
+func (*chunkReprCSS) isChunk()  {}
+func (*chunkReprHTML) isChunk() {}
 
 type chunkReprJS struct {
 	filesInChunkInOrder []uint32
@@ -192,6 +214,8 @@ type chunkReprCSS struct {
 	importsInChunkInOrder []cssImportOrder
 }
 
+type chunkReprHTML struct{}
+
 type externalImportCSS struct {
 	path                   logger.Path
 	conditions             []css_ast.ImportConditions
@@ -286,8 +310,10 @@ func Link(
 			// Entry points with ES6 exports must generate an exports object when
 			// targeting non-ES6 formats. Note that the IIFE format only needs this
 			// when the global name is present, since that's the only way the exports
-			// can actually be observed externally.
+			// can actually be observed externally. The UMD format always needs this
+			// since the exports are returned from the factory function.
 			if repr.AST.ExportKeyword.Len > 0 && (options.OutputFormat == config.FormatCommonJS ||
+				options.OutputFormat == config.FormatUMD ||
 				(options.OutputFormat == config.FormatIIFE && len(options.GlobalName) > 0)) {
 				repr.AST.UsesExportsRef = true
 				repr.Meta.ForceIncludeExportsForEntryPoint = true
@@ -618,6 +644,8 @@ func (c *linkerContext) generateChunksInParallel(additionalFiles []graph.OutputF
 			go c.generateChunkJS(chunkIndex, &generateWaitGroup)
 		case *chunkReprCSS:
 			go c.generateChunkCSS(chunkIndex, &generateWaitGroup)
+		case *chunkReprHTML:
+			go c.generateChunkHTML(chunkIndex, &generateWaitGroup)
 		}
 	}
 	c.enforceNoCyclicChunkImports()
@@ -648,15 +676,40 @@ func (c *linkerContext) generateChunksInParallel(additionalFiles []graph.OutputF
 		}))
 	}
 
+	// Plugins may transform the final code for each chunk, which can change the
+	// content hashes computed above
+	var renderedChunks []renderedChunk
+	if c.hasOnRenderChunkPlugins() {
+		renderedChunks = c.renderChunksWithPlugins()
+	}
+
 	// Generate the final output files by joining file pieces together and
 	// substituting the temporary paths for the final paths. This substitution
 	// can be done in parallel for each chunk.
 	c.timer.Begin("Generate final output files")
 	var resultsWaitGroup sync.WaitGroup
+	var nonHTMLWaitGroup sync.WaitGroup
+	hasHTML := false
+	for _, chunk := range c.chunks {
+		if _, ok := chunk.chunkRepr.(*chunkReprHTML); ok {
+			hasHTML = true
+		} else {
+			nonHTMLWaitGroup.Add(1)
+		}
+	}
+	needsIntegrity := c.options.Integrity != config.IntegrityNone && hasHTML
 	results := make([][]graph.OutputFile, len(c.chunks))
 	resultsWaitGroup.Add(len(c.chunks))
 	for chunkIndex, chunk := range c.chunks {
 		go func(chunkIndex int, chunk chunkInfo) {
+			// HTML chunks must wait for all other chunks since they may contain
+			// "integrity" attributes, which are hashes of their final contents
+			if _, ok := chunk.chunkRepr.(*chunkReprHTML); ok {
+				nonHTMLWaitGroup.Wait()
+			} else {
+				defer nonHTMLWaitGroup.Done()
+			}
+
 			var outputFiles []graph.OutputFile
 
 			// Each file may optionally contain additional files to be copied to the
@@ -678,14 +731,21 @@ func (c *linkerContext) generateChunksInParallel(additionalFiles []graph.OutputF
 				}
 				commentPrefix = "/*"
 				commentSuffix = " */"
+
+			case *chunkReprHTML:
+				outputFiles = append(outputFiles, c.graph.Files[chunk.sourceIndex].InputFile.AdditionalFiles...)
 			}
 
-			// Path substitution for the chunk itself
 			finalRelDir := c.fs.Dir(chunk.finalRelPath)
-			outputContentsJoiner, outputSourceMapShifts := c.substituteFinalPaths(chunk.intermediateOutput,
-				func(finalRelPathForImport string) string {
-					return c.pathBetweenChunks(finalRelDir, finalRelPathForImport)
-				})
+			var outputContentsJoiner helpers.Joiner
+			var outputSourceMap []byte
+			if renderedChunks != nil && renderedChunks[chunkIndex].wasRendered {
+				// Plugins have already generated the code for this chunk
+				outputContentsJoiner.AddBytes(renderedChunks[chunkIndex].contents)
+				outputSourceMap = renderedChunks[chunkIndex].sourceMap
+			} else {
+				outputContentsJoiner, outputSourceMap = c.substituteFinalPathsForChunk(&chunk)
+			}
 
 			// Generate the optional legal comments file for this chunk
 			if len(chunk.externalLegalComments) > 0 {
@@ -711,9 +771,8 @@ func (c *linkerContext) generateChunksInParallel(additionalFiles []graph.OutputF
 				})
 			}
 
-			// Generate the optional source map for this chunk
-			if c.options.SourceMap != config.SourceMapNone && chunk.outputSourceMap.HasContent() {
-				outputSourceMap := chunk.outputSourceMap.Finalize(outputSourceMapShifts)
+			// Link the chunk to the optional source map
+			if outputSourceMap != nil {
 				finalRelPathForSourceMap := chunk.finalRelPath + ".map"
 
 				// Potentially write a trailing source map comment
@@ -753,6 +812,9 @@ func (c *linkerContext) generateChunksInParallel(additionalFiles []graph.OutputF
 
 			// Finalize the output contents
 			outputContents := outputContentsJoiner.Done()
+			if needsIntegrity {
+				c.chunks[chunkIndex].integrity = c.integrityForContents(outputContents)
+			}
 
 			// Path substitution for the JSON metadata
 			var jsonMetadataChunk string
@@ -765,11 +827,18 @@ func (c *linkerContext) generateChunksInParallel(additionalFiles []graph.OutputF
 				jsonMetadataChunk = string(jsonMetadataChunkBytes.Done())
 			}
 
+			// Generate the entry for this chunk in the manifest
+			var jsonManifestChunk string
+			if c.options.NeedsManifest {
+				jsonManifestChunk = c.generateManifestChunk(chunkIndex)
+			}
+
 			// Generate the output file for this chunk
 			outputFiles = append(outputFiles, graph.OutputFile{
 				AbsPath:           c.fs.Join(c.options.AbsOutputDir, chunk.finalRelPath),
 				Contents:          outputContents,
 				JSONMetadataChunk: jsonMetadataChunk,
+				JSONManifestChunk: jsonManifestChunk,
 				IsExecutable:      chunk.isExecutable,
 			})
 
@@ -790,9 +859,270 @@ func (c *linkerContext) generateChunksInParallel(additionalFiles []graph.OutputF
 	for _, result := range results {
 		outputFiles = append(outputFiles, result...)
 	}
+
+	c.checkBudgets(outputFiles)
 	return outputFiles
 }
 
+func (c *linkerContext) hasOnRenderChunkPlugins() bool {
+	for _, plugin := range c.options.Plugins {
+		if len(plugin.OnRenderChunk) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Path substitution for the chunk itself, along with the optional source map
+func (c *linkerContext) substituteFinalPathsForChunk(chunk *chunkInfo) (helpers.Joiner, []byte) {
+	finalRelDir := c.fs.Dir(chunk.finalRelPath)
+	outputContentsJoiner, outputSourceMapShifts := c.substituteFinalPaths(chunk.intermediateOutput,
+		func(finalRelPathForImport string) string {
+			return c.pathBetweenChunks(finalRelDir, finalRelPathForImport)
+		})
+
+	var outputSourceMap []byte
+	if c.options.SourceMap != config.SourceMapNone && chunk.outputSourceMap.HasContent() {
+		outputSourceMap = chunk.outputSourceMap.Finalize(outputSourceMapShifts)
+	}
+	return outputContentsJoiner, outputSourceMap
+}
+
+type renderedChunk struct {
+	contents    []byte
+	sourceMap   []byte
+	wasRendered bool
+}
+
+// Plugins see the code for each chunk with the final import paths already
+// substituted in, so they run after the content hashes have been computed.
+// The hashes are then recomputed from the transformed code of each chunk and
+// the chunks it imports, and the import paths that referenced the previous
+// hashes are updated to match. Hashes always have the same length so this
+// doesn't invalidate any source maps.
+func (c *linkerContext) renderChunksWithPlugins() []renderedChunk {
+	renderedChunks := make([]renderedChunk, len(c.chunks))
+	waitGroup := sync.WaitGroup{}
+	for chunkIndex := range c.chunks {
+		if _, ok := c.chunks[chunkIndex].chunkRepr.(*chunkReprHTML); ok {
+			continue
+		}
+		waitGroup.Add(1)
+		go func(chunkIndex int) {
+			chunk := &c.chunks[chunkIndex]
+			outputContentsJoiner, outputSourceMap := c.substituteFinalPathsForChunk(chunk)
+			contents, sourceMap := c.runOnRenderChunkPlugins(chunk, outputContentsJoiner.Done(), outputSourceMap)
+			renderedChunks[chunkIndex] = renderedChunk{
+				contents:    contents,
+				sourceMap:   sourceMap,
+				wasRendered: true,
+			}
+			waitGroup.Done()
+		}(chunkIndex)
+	}
+	waitGroup.Wait()
+
+	// Compute the new hashes. The previous final path is mixed in because its
+	// hash covers everything about the chunk that isn't in the rendered code.
+	oldRelPaths := make([]string, len(c.chunks))
+	for chunkIndex := range c.chunks {
+		oldRelPaths[chunkIndex] = c.chunks[chunkIndex].finalRelPath
+	}
+	visited := make([]uint32, len(c.chunks))
+	var finalBytes []byte
+	for chunkIndex := range c.chunks {
+		chunk := &c.chunks[chunkIndex]
+		if !config.HasPlaceholder(chunk.finalTemplate, config.HashPlaceholder) {
+			continue
+		}
+		hash := xxhash.New()
+		hashWriteLengthPrefixed(hash, []byte(oldRelPaths[chunkIndex]))
+		c.appendRenderedChunksForImportedChunks(hash, renderedChunks, uint32(chunkIndex), visited, ^uint32(chunkIndex))
+		finalBytes = hash.Sum(finalBytes[:0])
+		finalString := bundler.HashForFileName(finalBytes)
+		chunk.finalRelPath = config.TemplateToString(config.SubstituteTemplate(chunk.finalTemplate, config.PathPlaceholders{
+			Hash: &finalString,
+		}))
+	}
+
+	// Update the paths of other output files in the rendered code. Only the
+	// path segments containing the hash are replaced so that references are
+	// still updated if a plugin changed the rest of the path (e.g. by turning
+	// a relative path into an absolute URL). The hash has a fixed length, so
+	// this doesn't shift any source map columns.
+	var oldSegments [][]byte
+	var newSegments [][]byte
+	for chunkIndex, chunk := range c.chunks {
+		if oldRelPaths[chunkIndex] != chunk.finalRelPath {
+			oldSegment, newSegment := changedPathSegments(oldRelPaths[chunkIndex], chunk.finalRelPath)
+			oldSegments = append(oldSegments, []byte(oldSegment))
+			newSegments = append(newSegments, []byte(newSegment))
+		}
+	}
+	for chunkIndex := range c.chunks {
+		if renderedChunk := &renderedChunks[chunkIndex]; renderedChunk.wasRendered {
+			for i, oldSegment := range oldSegments {
+				renderedChunk.contents = bytes.ReplaceAll(renderedChunk.contents, oldSegment, newSegments[i])
+			}
+		}
+	}
+	return renderedChunks
+}
+
+// This trims the path segments that are the same in both paths. For example,
+// "assets/chunk-OLDHASH.js" and "assets/chunk-NEWHASH.js" become
+// "chunk-OLDHASH.js" and "chunk-NEWHASH.js".
+func changedPathSegments(oldPath string, newPath string) (string, string) {
+	oldParts := strings.Split(oldPath, "/")
+	newParts := strings.Split(newPath, "/")
+	if len(oldParts) != len(newParts) {
+		return oldPath, newPath
+	}
+	start, end := 0, len(oldParts)
+	for start < end && oldParts[start] == newParts[start] {
+		start++
+	}
+	for end > start && oldParts[end-1] == newParts[end-1] {
+		end--
+	}
+	return strings.Join(oldParts[start:end], "/"), strings.Join(newParts[start:end], "/")
+}
+
+func (c *linkerContext) appendRenderedChunksForImportedChunks(
+	hash hash.Hash,
+	renderedChunks []renderedChunk,
+	chunkIndex uint32,
+	visited []uint32,
+	visitedKey uint32,
+) {
+	// Only visit each chunk at most once since there may be import cycles
+	if visited[chunkIndex] == visitedKey {
+		return
+	}
+	visited[chunkIndex] = visitedKey
+
+	for _, chunkImport := range c.chunks[chunkIndex].crossChunkImports {
+		c.appendRenderedChunksForImportedChunks(hash, renderedChunks, chunkImport.chunkIndex, visited, visitedKey)
+	}
+	hashWriteLengthPrefixed(hash, renderedChunks[chunkIndex].contents)
+}
+
+func (c *linkerContext) runOnRenderChunkPlugins(
+	chunk *chunkInfo,
+	code []byte,
+	outputSourceMap []byte,
+) ([]byte, []byte) {
+	args := config.OnRenderChunkArgs{
+		AbsPath: c.fs.Join(c.options.AbsOutputDir, chunk.finalRelPath),
+		Code:    code,
+	}
+	if chunk.isEntryPoint {
+		args.EntryPoint = &c.graph.Files[chunk.sourceIndex].InputFile.Source.KeyPath
+	}
+	for _, chunkImport := range chunk.crossChunkImports {
+		args.Imports = append(args.Imports, config.OnRenderChunkImport{
+			AbsPath: c.fs.Join(c.options.AbsOutputDir, c.chunks[chunkImport.chunkIndex].finalRelPath),
+			Kind:    chunkImport.importKind,
+		})
+	}
+	if _, ok := chunk.chunkRepr.(*chunkReprJS); ok {
+		args.Exports = c.exportAliasesForChunkJS(chunk)
+	}
+
+	// The source map is split into the part before the mappings, the mappings
+	// themselves, and the part after the mappings. Only the mappings change.
+	var mappings []byte
+	if outputSourceMap != nil {
+		prefixLen := len(chunk.outputSourceMap.Prefix)
+		suffixLen := len(chunk.outputSourceMap.Suffix)
+		mappings = outputSourceMap[prefixLen : len(outputSourceMap)-suffixLen]
+	}
+
+	for _, plugin := range c.options.Plugins {
+		for _, onRenderChunk := range plugin.OnRenderChunk {
+			args.SourceMap = outputSourceMap
+			result := onRenderChunk.Callback(args)
+			pluginName := result.PluginName
+			if pluginName == "" {
+				pluginName = plugin.Name
+			}
+
+			// Report errors and warnings generated by the plugin
+			didLogError := false
+			for _, msg := range result.Msgs {
+				if msg.PluginName == "" {
+					msg.PluginName = pluginName
+				}
+				if msg.Kind == logger.Error {
+					didLogError = true
+				}
+				c.log.AddMsg(msg)
+			}
+			if result.ThrownError != nil {
+				didLogError = true
+				c.log.AddMsg(logger.Msg{
+					PluginName: pluginName,
+					Kind:       logger.Error,
+					Data: logger.MsgData{
+						Text:       result.ThrownError.Error(),
+						UserDetail: result.ThrownError,
+					},
+				})
+			}
+
+			// Keep the previous code if there was an error or nothing changed
+			if didLogError || result.Code == nil {
+				continue
+			}
+			args.Code = result.Code
+
+			// The existing mappings don't match the new code if the plugin didn't
+			// return a source map, so they are dropped instead of being wrong
+			if mappings != nil && result.SourceMap == nil {
+				if len(mappings) > 0 {
+					prettyPaths := resolver.MakePrettyPaths(c.fs, logger.Path{Text: args.AbsPath, Namespace: "file"})
+					c.log.AddMsgID(logger.MsgID_SourceMap_MissingSourceMap, logger.Msg{
+						PluginName: pluginName,
+						Kind:       logger.Warning,
+						Data: logger.MsgData{Text: fmt.Sprintf(
+							"The source map for %q has no mappings because the plugin %q changed the code without returning a source map",
+							prettyPaths.Select(c.options.LogPathStyle), pluginName)},
+					})
+				}
+				mappings = []byte{}
+				j := helpers.Joiner{}
+				j.AddBytes(chunk.outputSourceMap.Prefix)
+				j.AddBytes(chunk.outputSourceMap.Suffix)
+				outputSourceMap = j.Done()
+			}
+
+			// Remap the existing source map through the plugin's source map
+			if mappings != nil && result.SourceMap != nil {
+				log := logger.NewDeferLog(logger.DeferLogNoVerboseOrDebug, c.log.Overrides)
+				source := logger.Source{
+					KeyPath:     logger.Path{Text: args.AbsPath + ".map"},
+					PrettyPaths: logger.PrettyPaths{Abs: args.AbsPath + ".map", Rel: args.AbsPath + ".map"},
+					Contents:    string(result.SourceMap),
+				}
+				if sourceMap := js_parser.ParseSourceMap(log, source); sourceMap != nil {
+					mappings = sourcemap.ComposeMappings(sourceMap.Mappings, mappings)
+					j := helpers.Joiner{}
+					j.AddBytes(chunk.outputSourceMap.Prefix)
+					j.AddBytes(mappings)
+					j.AddBytes(chunk.outputSourceMap.Suffix)
+					outputSourceMap = j.Done()
+				}
+				for _, msg := range log.Done() {
+					msg.PluginName = pluginName
+					c.log.AddMsg(msg)
+				}
+			}
+		}
+	}
+
+	return args.Code, outputSourceMap
+}
+
 // Given a set of output pieces (i.e. a buffer already divided into the spans
 // between import paths), substitute the final import paths in and then join
 // everything into a single byte buffer.
@@ -842,6 +1172,14 @@ func (c *linkerContext) substituteFinalPaths(
 			shift.Before.AdvanceString(chunk.uniqueKey)
 			shift.After.AdvanceString(importPath)
 			shifts = append(shifts, shift)
+
+		case outputPieceIntegrityIndex:
+			chunk := c.chunks[piece.index]
+			j.AddString(chunk.integrity)
+			shift.Before.AdvanceString(chunk.uniqueKey) // The integrity key is the same length
+
+			shift.After.AdvanceString(chunk.integrity)
+			shifts = append(shifts, shift)
 		}
 	}
 
@@ -873,12 +1211,35 @@ func (c *linkerContext) accurateFinalByteCount(output intermediateOutput, chunkF
 			chunk := c.chunks[piece.index]
 			importPath := c.pathBetweenChunks(chunkFinalRelDir, chunk.finalRelPath)
 			count += len(importPath)
+
+		case outputPieceIntegrityIndex:
+			count += len(c.chunks[piece.index].integrity)
 		}
 	}
 
 	return count
 }
 
+func (c *linkerContext) integrityForContents(contents []byte) string {
+	var algorithm string
+	var sum []byte
+	switch c.options.Integrity {
+	case config.IntegritySHA256:
+		algorithm = "sha256"
+		hash := sha256.Sum256(contents)
+		sum = hash[:]
+	case config.IntegritySHA384:
+		algorithm = "sha384"
+		hash := sha512.Sum384(contents)
+		sum = hash[:]
+	case config.IntegritySHA512:
+		algorithm = "sha512"
+		hash := sha512.Sum512(contents)
+		sum = hash[:]
+	}
+	return algorithm + "-" + base64.StdEncoding.EncodeToString(sum)
+}
+
 func (c *linkerContext) pathBetweenChunks(fromRelDir string, toRelPath string) string {
 	// Join with the public path if it has been configured
 	if c.options.PublicPath != "" {
@@ -905,12 +1266,60 @@ func (c *linkerContext) pathBetweenChunks(fromRelDir string, toRelPath string) s
 	return relPath
 }
 
+// Without code splitting, a file may be included in more than one chunk. So
+// all chunks must be checked before any of the import records are rewritten.
+func (c *linkerContext) rewriteWorkerImportsWithoutCodeSplitting() {
+	var records []*ast.ImportRecord
+	for chunkIndex := range c.chunks {
+		chunk := &c.chunks[chunkIndex]
+		if _, ok := chunk.chunkRepr.(*chunkReprJS); !ok {
+			continue
+		}
+		seen := make(map[uint32]bool)
+		for sourceIndex := range chunk.filesWithPartsInChunk {
+			repr := c.graph.Files[sourceIndex].InputFile.Repr.(*graph.JSRepr)
+			for _, part := range repr.AST.Parts {
+				if !part.IsLive {
+					continue
+				}
+				for _, importRecordIndex := range part.ImportRecordIndices {
+					record := &repr.AST.ImportRecords[importRecordIndex]
+					if record.Kind != ast.ImportNewWorker || !record.SourceIndex.IsValid() || !c.isExternalDynamicImport(record, sourceIndex) {
+						continue
+					}
+					records = append(records, record)
+
+					// Make sure the hash of this chunk depends on the hash of the worker
+					if otherChunkIndex := c.graph.Files[record.SourceIndex.GetIndex()].EntryPointChunkIndex; !seen[otherChunkIndex] {
+						seen[otherChunkIndex] = true
+						chunk.crossChunkImports = append(chunk.crossChunkImports, chunkImport{
+							chunkIndex: otherChunkIndex,
+							importKind: ast.ImportDynamic,
+						})
+					}
+				}
+			}
+		}
+	}
+
+	for _, record := range records {
+		if record.SourceIndex.IsValid() {
+			otherChunkIndex := c.graph.Files[record.SourceIndex.GetIndex()].EntryPointChunkIndex
+			record.Path.Text = c.chunks[otherChunkIndex].uniqueKey
+			record.SourceIndex = ast.Index32{}
+			record.Flags |= ast.ShouldNotBeExternalInMetafile | ast.ContainsUniqueKey
+		}
+	}
+}
+
 func (c *linkerContext) computeCrossChunkDependencies() {
 	c.timer.Begin("Compute cross-chunk dependencies")
 	defer c.timer.End("Compute cross-chunk dependencies")
 
 	if !c.options.CodeSplitting {
-		// No need to compute cross-chunk dependencies if there can't be any
+		// No need to compute cross-chunk dependencies if there can't be any. But
+		// "new Worker()" expressions still need to reference the worker's chunk.
+		c.rewriteWorkerImportsWithoutCodeSplitting()
 		return
 	}
 
@@ -970,9 +1379,11 @@ func (c *linkerContext) computeCrossChunkDependencies() {
 						// the same name should already be marked as all being in a single
 						// chunk. In that case this will overwrite the same value below which
 						// is fine.
-						for _, declared := range part.DeclaredSymbols {
-							if declared.IsTopLevel {
-								c.graph.Symbols.Get(declared.Ref).ChunkIndex = ast.MakeIndex32(uint32(chunkIndex))
+						if !c.duplicatedFiles[sourceIndex] {
+							for _, declared := range part.DeclaredSymbols {
+								if declared.IsTopLevel {
+									c.graph.Symbols.Get(declared.Ref).ChunkIndex = ast.MakeIndex32(uint32(chunkIndex))
+								}
 							}
 						}
 
@@ -1128,7 +1539,7 @@ func (c *linkerContext) computeCrossChunkDependencies() {
 
 		chunkRepr.exportsToOtherChunks = make(map[ast.Ref]string)
 		switch c.options.OutputFormat {
-		case config.FormatESModule:
+		case config.FormatESModule, config.FormatSystem:
 			r := renamer.ExportRenamer{}
 			var items []js_ast.ClauseItem
 			for _, export := range c.sortedCrossChunkExportItems(chunkMetas[chunkIndex].exports) {
@@ -1166,7 +1577,7 @@ func (c *linkerContext) computeCrossChunkDependencies() {
 
 		for _, crossChunkImport := range c.sortedCrossChunkImports(chunkRepr.importsFromOtherChunks) {
 			switch c.options.OutputFormat {
-			case config.FormatESModule:
+			case config.FormatESModule, config.FormatSystem:
 				var items []js_ast.ClauseItem
 				for _, item := range crossChunkImport.sortedImportItems {
 					items = append(items, js_ast.ClauseItem{Name: ast.LocRef{Ref: item.ref}, Alias: item.exportAlias})
@@ -1371,6 +1782,42 @@ func (c *linkerContext) scanImportsAndExports() {
 
 			c.validateComposesFromProperties(file, repr)
 
+		case *graph.HTMLRepr:
+			// Inline URLs for assets into the HTML file. Scripts and stylesheets are
+			// left alone since they are separate entry points with their own chunks.
+			for importRecordIndex := range repr.AST.ImportRecords {
+				if record := &repr.AST.ImportRecords[importRecordIndex]; record.SourceIndex.IsValid() {
+					otherFile := &c.graph.Files[record.SourceIndex.GetIndex()]
+					if otherRepr, ok := otherFile.InputFile.Repr.(*graph.JSRepr); ok && record.Kind == ast.ImportURL {
+						record.Path.Text = otherRepr.AST.URLForCSS
+						record.Path.Namespace = ""
+						record.SourceIndex = ast.Index32{}
+						if otherFile.InputFile.Loader == config.LoaderEmpty {
+							record.Flags |= ast.WasLoadedWithEmptyLoader
+						} else {
+							record.Flags |= ast.ShouldNotBeExternalInMetafile
+						}
+						if strings.Contains(otherRepr.AST.URLForCSS, c.uniqueKeyPrefix) {
+							record.Flags |= ast.ContainsUniqueKey
+						}
+
+						// Copy the additional files to the output directory
+						additionalFiles = append(additionalFiles, otherFile.InputFile.AdditionalFiles...)
+					}
+				} else if record.CopySourceIndex.IsValid() {
+					otherFile := &c.graph.Files[record.CopySourceIndex.GetIndex()]
+					if otherRepr, ok := otherFile.InputFile.Repr.(*graph.CopyRepr); ok {
+						record.Path.Text = otherRepr.URLForCode
+						record.Path.Namespace = ""
+						record.CopySourceIndex = ast.Index32{}
+						record.Flags |= ast.ShouldNotBeExternalInMetafile | ast.ContainsUniqueKey
+
+						// Copy the additional files to the output directory
+						additionalFiles = append(additionalFiles, otherFile.InputFile.AdditionalFiles...)
+					}
+				}
+			}
+
 		case *graph.JSRepr:
 			for importRecordIndex := range repr.AST.ImportRecords {
 				record := &repr.AST.ImportRecords[importRecordIndex]
@@ -1394,6 +1841,23 @@ func (c *linkerContext) scanImportsAndExports() {
 				otherRepr := otherFile.InputFile.Repr.(*graph.JSRepr)
 
 				switch record.Kind {
+				case ast.ImportNewURL:
+					// Inline URLs for non-JS files into "new URL()" expressions
+					record.Path.Text = otherRepr.AST.URLForCSS
+					record.Path.Namespace = ""
+					record.SourceIndex = ast.Index32{}
+					if otherFile.InputFile.Loader == config.LoaderEmpty {
+						record.Flags |= ast.WasLoadedWithEmptyLoader
+					} else {
+						record.Flags |= ast.ShouldNotBeExternalInMetafile
+					}
+					if strings.Contains(otherRepr.AST.URLForCSS, c.uniqueKeyPrefix) {
+						record.Flags |= ast.ContainsUniqueKey
+					}
+
+					// Copy the additional files to the output directory
+					additionalFiles = append(additionalFiles, otherFile.InputFile.AdditionalFiles...)
+
 				case ast.ImportStmt:
 					// Importing using ES6 syntax from a file without any ES6 syntax
 					// causes that module to be considered CommonJS-style, even if it
@@ -1450,7 +1914,8 @@ func (c *linkerContext) scanImportsAndExports() {
 			// resulting wrapper won't be invoked by other files. An exception is made
 			// for entry point files in CommonJS format (or when in pass-through mode).
 			if repr.AST.ExportsKind == js_ast.ExportsCommonJS && (!file.IsEntryPoint() ||
-				c.options.OutputFormat == config.FormatIIFE || c.options.OutputFormat == config.FormatESModule) {
+				c.options.OutputFormat == config.FormatIIFE || c.options.OutputFormat.IsESMCompatible() ||
+				c.options.OutputFormat == config.FormatUMD) {
 				repr.Meta.Wrap = graph.WrapCJS
 			}
 		}
@@ -1768,7 +2233,7 @@ func (c *linkerContext) scanImportsAndExports() {
 		// Pre-generate symbols for re-exports CommonJS symbols in case they
 		// are necessary later. This is done now because the symbols map cannot be
 		// mutated later due to parallelism.
-		if file.IsEntryPoint() && c.options.OutputFormat == config.FormatESModule {
+		if file.IsEntryPoint() && c.options.OutputFormat.IsESMCompatible() {
 			copies := make([]ast.Ref, len(repr.Meta.SortedAndFilteredExportAliases))
 			for i, alias := range repr.Meta.SortedAndFilteredExportAliases {
 				copies[i] = c.graph.GenerateNewSymbol(sourceIndex, ast.SymbolOther, "export_"+alias)
@@ -1881,6 +2346,15 @@ func (c *linkerContext) scanImportsAndExports() {
 			}
 		}
 
+		// Register each module with the hot module replacement runtime. Updated
+		// modules are evaluated separately later on and import their dependencies
+		// from this registry. CommonJS modules can only be registered from inside
+		// their wrapper since that's where the "module" variable is.
+		if c.options.HotModuleReplacement && sourceIndex != runtime.SourceIndex &&
+			(repr.AST.ExportsKind != js_ast.ExportsCommonJS || repr.Meta.Wrap == graph.WrapCJS) {
+			c.generateHotModuleRegistration(sourceIndex)
+		}
+
 		// Encode import-specific constraints in the dependency graph
 		for partIndex, part := range repr.AST.Parts {
 			toESMUses := uint32(0)
@@ -1891,6 +2365,11 @@ func (c *linkerContext) scanImportsAndExports() {
 			for _, importRecordIndex := range part.ImportRecordIndices {
 				record := &repr.AST.ImportRecords[importRecordIndex]
 
+				// References from "new URL()" expressions don't import anything
+				if record.Kind == ast.ImportNewURL || record.Kind == ast.ImportNewWorker {
+					continue
+				}
+
 				// Don't follow external imports (this includes import() expressions)
 				if !record.SourceIndex.IsValid() || c.isExternalDynamicImport(record, sourceIndex) {
 					// This is an external import. Check if it will be a "require()" call.
@@ -2417,6 +2896,37 @@ func (c *linkerContext) createExportsForFile(sourceIndex uint32) {
 	}
 }
 
+// This generates "__hmrRegister(id, exports)" at the end of the module, or
+// "__hmrRegister(id, exports, module)" for CommonJS modules
+func (c *linkerContext) generateHotModuleRegistration(sourceIndex uint32) {
+	file := &c.graph.Files[sourceIndex]
+	repr := file.InputFile.Repr.(*graph.JSRepr)
+	runtimeRepr := c.graph.Files[runtime.SourceIndex].InputFile.Repr.(*graph.JSRepr)
+	registerRef := runtimeRepr.AST.NamedExports["__hmrRegister"].Ref
+	id := file.InputFile.Source.PrettyPaths.Select(c.options.CodePathStyle)
+	args := []js_ast.Expr{
+		{Data: &js_ast.EString{Value: helpers.StringToUTF16(id)}},
+		{Data: &js_ast.EIdentifier{Ref: repr.AST.ExportsRef}},
+	}
+	isCommonJS := repr.Meta.Wrap == graph.WrapCJS
+	if isCommonJS {
+		args = append(args, js_ast.Expr{Data: &js_ast.EIdentifier{Ref: repr.AST.ModuleRef}})
+	}
+
+	partIndex := c.graph.AddPartToFile(sourceIndex, js_ast.Part{
+		Stmts: []js_ast.Stmt{{Data: &js_ast.SExpr{Value: js_ast.Expr{Data: &js_ast.ECall{
+			Target: js_ast.Expr{Data: &js_ast.EIdentifier{Ref: registerRef}},
+			Args:   args,
+		}}}}},
+		CanBeRemovedIfUnused: false,
+	})
+	c.graph.GenerateSymbolImportAndUse(sourceIndex, partIndex, repr.AST.ExportsRef, 1, sourceIndex)
+	if isCommonJS {
+		c.graph.GenerateSymbolImportAndUse(sourceIndex, partIndex, repr.AST.ModuleRef, 1, sourceIndex)
+	}
+	c.graph.GenerateSymbolImportAndUse(sourceIndex, partIndex, registerRef, 1, runtime.SourceIndex)
+}
+
 func (c *linkerContext) createWrapperForFile(sourceIndex uint32) {
 	repr := c.graph.Files[sourceIndex].InputFile.Repr.(*graph.JSRepr)
 
@@ -3278,8 +3788,7 @@ func (c *linkerContext) markFileLiveForTreeShaking(sourceIndex uint32) {
 }
 
 func (c *linkerContext) isExternalDynamicImport(record *ast.ImportRecord, sourceIndex uint32) bool {
-	return c.options.CodeSplitting &&
-		record.Kind == ast.ImportDynamic &&
+	return (record.Kind == ast.ImportNewWorker || (c.options.CodeSplitting && record.Kind == ast.ImportDynamic)) &&
 		c.graph.Files[record.SourceIndex.GetIndex()].IsEntryPoint() &&
 		record.SourceIndex.GetIndex() != sourceIndex
 }
@@ -3873,6 +4382,7 @@ func (c *linkerContext) computeChunks() {
 
 	jsChunks := make(map[string]chunkInfo)
 	cssChunks := make(map[string]chunkInfo)
+	htmlChunks := make(map[string]chunkInfo)
 
 	// Create chunks for entry points
 	for i, entryPoint := range c.graph.EntryPoints() {
@@ -3936,13 +4446,45 @@ func (c *linkerContext) computeChunks() {
 				importsInChunkInOrder: order,
 			}
 			cssChunks[key] = chunk
+
+		case *graph.HTMLRepr:
+			chunk.filesWithPartsInChunk[entryPoint.SourceIndex] = true
+			chunk.chunkRepr = &chunkReprHTML{}
+			htmlChunks[key] = chunk
 		}
 	}
 
 	// Figure out which JS files are in which chunk
+	c.assignManualChunks()
+	manualChunks := make(map[string]chunkInfo)
 	for _, sourceIndex := range c.graph.ReachableFiles {
 		if file := &c.graph.Files[sourceIndex]; file.IsLive {
 			if _, ok := file.InputFile.Repr.(*graph.JSRepr); ok {
+				// Files in a manual chunk are grouped by name instead of by entry bits
+				if name, ok := c.manualChunkForFile[sourceIndex]; ok {
+					chunk, ok := manualChunks[name]
+					if !ok {
+						chunk.entryBits = helpers.NewBitSet(uint(len(c.graph.EntryPoints())))
+						chunk.manualChunkName = name
+						chunk.filesWithPartsInChunk = make(map[uint32]bool)
+						chunk.chunkRepr = &chunkReprJS{}
+						manualChunks[name] = chunk
+					}
+					chunk.entryBits.Union(file.EntryBits)
+					chunk.filesWithPartsInChunk[uint32(sourceIndex)] = true
+					continue
+				}
+
+				// Without code splitting, each entry point gets its own copy of every
+				// file it can reach. This can only happen with multiple entry points
+				// when some of them are generated (e.g. for "new Worker()") since
+				// user-specified entry points are linked separately in that case.
+				if !c.options.CodeSplitting {
+					if c.addFileToEachEntryPointChunk(jsChunks, file.EntryBits, uint32(sourceIndex)) {
+						continue
+					}
+				}
+
 				key := file.EntryBits.String()
 				chunk, ok := jsChunks[key]
 				if !ok {
@@ -3955,11 +4497,14 @@ func (c *linkerContext) computeChunks() {
 			}
 		}
 	}
+	if c.options.MinChunkSize > 0 {
+		c.mergeSmallChunks(jsChunks)
+	}
 
 	// Sort the chunks for determinism. This matters because we use chunk indices
 	// as sorting keys in a few places.
-	sortedChunks := make([]chunkInfo, 0, len(jsChunks)+len(cssChunks))
-	sortedKeys := make([]string, 0, len(jsChunks)+len(cssChunks))
+	sortedChunks := make([]chunkInfo, 0, len(jsChunks)+len(cssChunks)+len(htmlChunks))
+	sortedKeys := make([]string, 0, len(jsChunks)+len(cssChunks)+len(htmlChunks))
 	for key := range jsChunks {
 		sortedKeys = append(sortedKeys, key)
 	}
@@ -3972,6 +4517,11 @@ func (c *linkerContext) computeChunks() {
 		}
 		sortedChunks = append(sortedChunks, chunk)
 	}
+	for _, manualChunk := range c.options.ManualChunks {
+		if chunk, ok := manualChunks[manualChunk.Name]; ok {
+			sortedChunks = append(sortedChunks, chunk)
+		}
+	}
 	sortedKeys = sortedKeys[:0]
 	for key := range cssChunks {
 		sortedKeys = append(sortedKeys, key)
@@ -3984,6 +4534,14 @@ func (c *linkerContext) computeChunks() {
 		}
 		sortedChunks = append(sortedChunks, chunk)
 	}
+	sortedKeys = sortedKeys[:0]
+	for key := range htmlChunks {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+	for _, key := range sortedKeys {
+		sortedChunks = append(sortedChunks, htmlChunks[key])
+	}
 
 	// Map from the entry point file to its chunk. We will need this later if
 	// a file contains a dynamic import to this entry point, since we'll need
@@ -4005,6 +4563,37 @@ func (c *linkerContext) computeChunks() {
 		}
 	}
 
+	// HTML files reference the chunks for their scripts and stylesheets. This
+	// is done after the entry point chunks are known. JS entry points that
+	// import CSS also have their CSS chunk referenced.
+	for chunkIndex := range sortedChunks {
+		chunk := &sortedChunks[chunkIndex]
+		if _, ok := chunk.chunkRepr.(*chunkReprHTML); !ok {
+			continue
+		}
+		repr := c.graph.Files[chunk.sourceIndex].InputFile.Repr.(*graph.HTMLRepr)
+		seen := make(map[uint32]bool)
+		for _, record := range repr.AST.ImportRecords {
+			if !record.SourceIndex.IsValid() || record.Kind != ast.ImportEntryPoint {
+				continue
+			}
+			otherChunkIndex := c.graph.Files[record.SourceIndex.GetIndex()].EntryPointChunkIndex
+			otherChunkIndices := []uint32{otherChunkIndex}
+			if chunkRepr, ok := sortedChunks[otherChunkIndex].chunkRepr.(*chunkReprJS); ok && chunkRepr.hasCSSChunk {
+				otherChunkIndices = append(otherChunkIndices, chunkRepr.cssChunkIndex)
+			}
+			for _, otherChunkIndex := range otherChunkIndices {
+				if !seen[otherChunkIndex] {
+					seen[otherChunkIndex] = true
+					chunk.crossChunkImports = append(chunk.crossChunkImports, chunkImport{
+						chunkIndex: otherChunkIndex,
+						importKind: ast.ImportEntryPoint,
+					})
+				}
+			}
+		}
+	}
+
 	// Determine the order of JS files (and parts) within the chunk ahead of time
 	for _, chunk := range sortedChunks {
 		if chunkRepr, ok := chunk.chunkRepr.(*chunkReprJS); ok {
@@ -4028,6 +4617,8 @@ func (c *linkerContext) computeChunks() {
 			stdExt = c.options.OutputExtensionJS
 		case *chunkReprCSS:
 			stdExt = c.options.OutputExtensionCSS
+		case *chunkReprHTML:
+			stdExt = ".html"
 		}
 
 		// Compute the template substitutions
@@ -4073,6 +4664,11 @@ func (c *linkerContext) computeChunks() {
 			base = "chunk"
 			ext = stdExt
 			template = c.options.ChunkPathTemplate
+
+			// Manual chunks are named after their group
+			if chunk.manualChunkName != "" {
+				base = chunk.manualChunkName
+			}
 		}
 
 		// Determine the output path template
@@ -4088,21 +4684,408 @@ func (c *linkerContext) computeChunks() {
 	c.chunks = sortedChunks
 }
 
-type chunkOrder struct {
-	sourceIndex uint32
-	distance    uint32
-	tieBreaker  uint32
-}
+// This forces files that match a manual chunk pattern into that chunk. The
+// static dependencies of those files are pulled into the same chunk too, which
+// avoids a cycle between the manual chunk and the chunks that import it. Entry
+// points always stay in their own chunk.
+func (c *linkerContext) assignManualChunks() {
+	if len(c.options.ManualChunks) == 0 {
+		return
+	}
+	c.manualChunkForFile = make(map[uint32]string)
 
-// This type is just so we can use Go's native sort function
-type chunkOrderArray []chunkOrder
+	canBeInManualChunk := func(sourceIndex uint32) bool {
+		file := &c.graph.Files[sourceIndex]
+		_, isJS := file.InputFile.Repr.(*graph.JSRepr)
+		return isJS && file.IsLive && !file.IsEntryPoint() && sourceIndex != runtime.SourceIndex
+	}
 
-func (a chunkOrderArray) Len() int          { return len(a) }
-func (a chunkOrderArray) Swap(i int, j int) { a[i], a[j] = a[j], a[i] }
+	// Files that match a pattern directly take precedence over files that are
+	// only the dependency of a file that matches a pattern
+	var matchedFiles []uint32
+	for _, sourceIndex := range c.graph.ReachableFiles {
+		keyPath := c.graph.Files[sourceIndex].InputFile.Source.KeyPath
+		if keyPath.Namespace != "file" || !canBeInManualChunk(sourceIndex) {
+			continue
+		}
+		for _, manualChunk := range c.options.ManualChunks {
+			if manualChunkMatchesPath(manualChunk, keyPath.Text) {
+				c.manualChunkForFile[sourceIndex] = manualChunk.Name
+				matchedFiles = append(matchedFiles, sourceIndex)
+				break
+			}
+		}
+	}
 
-func (a chunkOrderArray) Less(i int, j int) bool {
-	ai := a[i]
-	aj := a[j]
+	var visit func(uint32, string)
+	visit = func(sourceIndex uint32, name string) {
+		repr := c.graph.Files[sourceIndex].InputFile.Repr.(*graph.JSRepr)
+		for _, record := range repr.AST.ImportRecords {
+			if !record.SourceIndex.IsValid() || (record.Kind != ast.ImportStmt && record.Kind != ast.ImportRequire) {
+				continue
+			}
+			otherSourceIndex := record.SourceIndex.GetIndex()
+			if _, ok := c.manualChunkForFile[otherSourceIndex]; !ok && canBeInManualChunk(otherSourceIndex) {
+				c.manualChunkForFile[otherSourceIndex] = name
+				visit(otherSourceIndex, name)
+			}
+		}
+	}
+	for _, sourceIndex := range matchedFiles {
+		visit(sourceIndex, c.manualChunkForFile[sourceIndex])
+	}
+}
+
+// This merges shared chunks that are smaller than the minimum chunk size into
+// other chunks. A small chunk can either be merged into another shared chunk
+// or copied into each entry point chunk that imports it. The merged chunk is
+// loaded by the union of the entry points of both chunks, so some entry points
+// may end up loading code that they don't use. Copying the chunk instead means
+// its code is downloaded once per entry point. Either is only done when the
+// extra code has no side effects, and the option with the fewest extra bytes is
+// preferred. Manual chunks are never merged. Chunk membership is only tracked
+// in "filesWithPartsInChunk" since the entry bits of a file are still needed
+// to know which entry points can reach it.
+func (c *linkerContext) mergeSmallChunks(jsChunks map[string]chunkInfo) {
+	entryPointCount := uint(len(c.graph.EntryPoints()))
+	countBits := func(bits helpers.BitSet) (count int) {
+		for i := uint(0); i < entryPointCount; i++ {
+			if bits.HasBit(i) {
+				count++
+			}
+		}
+		return
+	}
+
+	type chunkStats struct {
+		size    int
+		isPure  bool
+		entries int
+	}
+	stats := make(map[string]chunkStats)
+	isPureFile := make(map[uint32]bool)
+	fileSizes := make(map[uint32]int)
+	for key, chunk := range jsChunks {
+		if chunk.isEntryPoint {
+			continue
+		}
+		s := chunkStats{isPure: true, entries: countBits(chunk.entryBits)}
+		for sourceIndex := range chunk.filesWithPartsInChunk {
+			fileSizes[sourceIndex] = c.estimateLiveSizeOfFile(sourceIndex)
+			s.size += fileSizes[sourceIndex]
+			if !c.isFileFreeOfSideEffects(sourceIndex, isPureFile) {
+				s.isPure = false
+			}
+		}
+		stats[key] = s
+	}
+
+	// Copies of a chunk don't share their top-level symbols, so a chunk can only
+	// be copied if no other shared chunk uses them. Remember which shared chunk
+	// each file is in and which files import each file to check for this.
+	chunkKeyForFile := make(map[uint32]string)
+	for key := range stats {
+		for sourceIndex := range jsChunks[key].filesWithPartsInChunk {
+			chunkKeyForFile[sourceIndex] = key
+		}
+	}
+	importersOfFile := make(map[uint32][]uint32)
+	for _, sourceIndex := range c.graph.ReachableFiles {
+		if repr, ok := c.graph.Files[sourceIndex].InputFile.Repr.(*graph.JSRepr); ok && c.graph.Files[sourceIndex].IsLive {
+			for _, record := range repr.AST.ImportRecords {
+				if record.SourceIndex.IsValid() && record.Kind != ast.ImportDynamic && record.Kind != ast.ImportNewWorker {
+					otherIndex := record.SourceIndex.GetIndex()
+					importersOfFile[otherIndex] = append(importersOfFile[otherIndex], sourceIndex)
+				}
+			}
+		}
+	}
+	entryPointChunksForFile := func(sourceIndex uint32) (keys []string) {
+		for i := uint(0); i < entryPointCount; i++ {
+			if c.graph.Files[sourceIndex].EntryBits.HasBit(i) {
+				bits := helpers.NewBitSet(entryPointCount)
+				bits.SetBit(i)
+				keys = append(keys, bits.String())
+			}
+		}
+		return
+	}
+	canCopyIntoEntryPoints := func(key string) bool {
+		for sourceIndex := range jsChunks[key].filesWithPartsInChunk {
+			if sourceIndex == runtime.SourceIndex {
+				return false
+			}
+			for _, importer := range importersOfFile[sourceIndex] {
+				if _, ok := c.manualChunkForFile[importer]; ok {
+					return false
+				}
+				if otherKey, ok := chunkKeyForFile[importer]; ok && otherKey != key {
+					return false
+				}
+			}
+			for _, entryKey := range entryPointChunksForFile(sourceIndex) {
+				if entryChunk, ok := jsChunks[entryKey]; !ok || !entryChunk.isEntryPoint {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	// Each file is copied into the entry points that can reach it, which
+	// duplicates its code once for every entry point after the first one
+	copyCost := func(key string) (cost int) {
+		for sourceIndex := range jsChunks[key].filesWithPartsInChunk {
+			cost += (countBits(c.graph.Files[sourceIndex].EntryBits) - 1) * fileSizes[sourceIndex]
+		}
+		return
+	}
+
+	for {
+		// Visit chunks from smallest to largest for determinism
+		keys := make([]string, 0, len(stats))
+		for key := range stats {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := stats[keys[i]], stats[keys[j]]
+			if a.size != b.size {
+				return a.size < b.size
+			}
+			return keys[i] < keys[j]
+		})
+
+		didMerge := false
+		for _, smallKey := range keys {
+			small := stats[smallKey]
+			if small.size >= c.options.MinChunkSize {
+				break
+			}
+
+			// Find the chunk that results in the fewest bytes being loaded by entry
+			// points that didn't load them before
+			bestKey := ""
+			bestCost := 0
+			var bestBits helpers.BitSet
+			for _, otherKey := range keys {
+				if otherKey == smallKey {
+					continue
+				}
+				other := stats[otherKey]
+				bits := helpers.NewBitSet(entryPointCount)
+				bits.Union(jsChunks[smallKey].entryBits)
+				bits.Union(jsChunks[otherKey].entryBits)
+				count := countBits(bits)
+				if (count > small.entries && !small.isPure) || (count > other.entries && !other.isPure) {
+					continue
+				}
+				cost := (count-small.entries)*small.size + (count-other.entries)*other.size
+				if bestKey == "" || cost < bestCost {
+					bestKey = otherKey
+					bestCost = cost
+					bestBits = bits
+				}
+			}
+
+			// Copy the chunk into the entry points instead if that's cheaper
+			if small.isPure && (bestKey == "" || copyCost(smallKey) < bestCost) && canCopyIntoEntryPoints(smallKey) {
+				if c.duplicatedFiles == nil {
+					c.duplicatedFiles = make(map[uint32]bool)
+				}
+				for sourceIndex := range jsChunks[smallKey].filesWithPartsInChunk {
+					for _, entryKey := range entryPointChunksForFile(sourceIndex) {
+						jsChunks[entryKey].filesWithPartsInChunk[sourceIndex] = true
+					}
+					c.duplicatedFiles[sourceIndex] = true
+					delete(chunkKeyForFile, sourceIndex)
+				}
+				delete(jsChunks, smallKey)
+				delete(stats, smallKey)
+				didMerge = true
+				break
+			}
+			if bestKey == "" {
+				continue
+			}
+
+			// Move the files from both chunks (and from any existing chunk with the
+			// same entry points as the merged chunk) into a single chunk
+			mergedKey := bestBits.String()
+			merged := chunkInfo{
+				entryBits:             bestBits,
+				filesWithPartsInChunk: make(map[uint32]bool),
+				chunkRepr:             &chunkReprJS{},
+			}
+			mergedStats := chunkStats{isPure: true, entries: countBits(bestBits)}
+			for _, key := range []string{smallKey, bestKey, mergedKey} {
+				chunk, ok := jsChunks[key]
+				if !ok {
+					continue
+				}
+				for sourceIndex := range chunk.filesWithPartsInChunk {
+					merged.filesWithPartsInChunk[sourceIndex] = true
+					chunkKeyForFile[sourceIndex] = mergedKey
+				}
+				mergedStats.size += stats[key].size
+				mergedStats.isPure = mergedStats.isPure && stats[key].isPure
+				delete(jsChunks, key)
+				delete(stats, key)
+			}
+			jsChunks[mergedKey] = merged
+			stats[mergedKey] = mergedStats
+			didMerge = true
+			break
+		}
+		if !didMerge {
+			break
+		}
+	}
+}
+
+// This estimates the output size of a file using the source ranges of its live
+// parts. It's only used by the chunk merging heuristics so it's not exact.
+func (c *linkerContext) estimateLiveSizeOfFile(sourceIndex uint32) int {
+	file := &c.graph.Files[sourceIndex]
+	repr := file.InputFile.Repr.(*graph.JSRepr)
+	size := len(file.InputFile.Source.Contents)
+
+	// Wrapped files are all-or-nothing
+	if repr.Meta.Wrap != graph.WrapNone {
+		return size
+	}
+
+	type partStart struct {
+		start  int32
+		isLive bool
+	}
+	starts := make([]partStart, 0, len(repr.AST.Parts))
+	for _, part := range repr.AST.Parts {
+		if len(part.Stmts) > 0 {
+			starts = append(starts, partStart{start: part.Stmts[0].Loc.Start, isLive: part.IsLive})
+		}
+	}
+	sort.SliceStable(starts, func(i, j int) bool {
+		return starts[i].start < starts[j].start
+	})
+
+	liveSize := 0
+	for i, part := range starts {
+		if part.isLive {
+			end := int32(size)
+			if i+1 < len(starts) {
+				end = starts[i+1].start
+			}
+			if end > part.start {
+				liveSize += int(end - part.start)
+			}
+		}
+	}
+	return liveSize
+}
+
+// A file can be loaded by additional entry points without changing behavior if
+// evaluating it (and the files it imports) has no side effects. Wrapped files
+// are lazily-evaluated so they are always considered to be free of side effects.
+func (c *linkerContext) isFileFreeOfSideEffects(sourceIndex uint32, visited map[uint32]bool) bool {
+	if isPure, ok := visited[sourceIndex]; ok {
+		return isPure
+	}
+
+	// Assume import cycles are free of side effects until proven otherwise
+	visited[sourceIndex] = true
+	repr, ok := c.graph.Files[sourceIndex].InputFile.Repr.(*graph.JSRepr)
+	if !ok || repr.Meta.Wrap != graph.WrapNone {
+		return true
+	}
+
+	isPure := true
+	for _, part := range repr.AST.Parts {
+		if part.IsLive && !part.CanBeRemovedIfUnused {
+			isPure = false
+			break
+		}
+	}
+	if isPure {
+		for _, record := range repr.AST.ImportRecords {
+			if record.Kind == ast.ImportStmt && record.SourceIndex.IsValid() &&
+				c.graph.Files[record.SourceIndex.GetIndex()].IsLive &&
+				!c.isFileFreeOfSideEffects(record.SourceIndex.GetIndex(), visited) {
+				isPure = false
+				break
+			}
+		}
+	}
+	visited[sourceIndex] = isPure
+	return isPure
+}
+
+// A pattern matches a file if it matches the path of the file itself or the
+// path of any of its parent directories. Package patterns match if the file
+// is in a package with that name, which may be nested inside the
+// "node_modules" directory of another package.
+func manualChunkMatchesPath(manualChunk config.ManualChunk, path string) bool {
+	for end := len(path); end > 0; end = strings.LastIndexAny(path[:end], "/\\") {
+		dir := path[:end]
+		if manualChunk.Exact[dir] {
+			return true
+		}
+		for _, pattern := range manualChunk.Patterns {
+			if wildcardPatternMatches(pattern, dir) {
+				return true
+			}
+		}
+	}
+	if len(manualChunk.Packages) > 0 || len(manualChunk.PackagePatterns) > 0 {
+		for _, name := range packageNamesInPath(path) {
+			if manualChunk.Packages[name] {
+				return true
+			}
+			for _, pattern := range manualChunk.PackagePatterns {
+				if wildcardPatternMatches(pattern, name) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func wildcardPatternMatches(pattern config.WildcardPattern, text string) bool {
+	return len(text) >= len(pattern.Prefix)+len(pattern.Suffix) &&
+		strings.HasPrefix(text, pattern.Prefix) && strings.HasSuffix(text, pattern.Suffix)
+}
+
+// "/a/node_modules/@scope/b/node_modules/c/index.js" => ["@scope/b", "c"]
+func packageNamesInPath(path string) (names []string) {
+	parts := strings.FieldsFunc(path, func(c rune) bool { return c == '/' || c == '\\' })
+	for i := 0; i+1 < len(parts); i++ {
+		if parts[i] != "node_modules" {
+			continue
+		}
+		name := parts[i+1]
+		if strings.HasPrefix(name, "@") && i+2 < len(parts) {
+			name += "/" + parts[i+2]
+		}
+		names = append(names, name)
+	}
+	return
+}
+
+type chunkOrder struct {
+	sourceIndex uint32
+	distance    uint32
+	tieBreaker  uint32
+}
+
+// This type is just so we can use Go's native sort function
+type chunkOrderArray []chunkOrder
+
+func (a chunkOrderArray) Len() int          { return len(a) }
+func (a chunkOrderArray) Swap(i int, j int) { a[i], a[j] = a[j], a[i] }
+
+func (a chunkOrderArray) Less(i int, j int) bool {
+	ai := a[i]
+	aj := a[j]
 	return ai.distance < aj.distance || (ai.distance == aj.distance && ai.tieBreaker < aj.tieBreaker)
 }
 
@@ -4136,6 +5119,27 @@ func (c *linkerContext) shouldIncludePart(repr *graph.JSRepr, part js_ast.Part)
 	return true
 }
 
+// This returns false if any of the entry points don't have a JS chunk, in
+// which case the file should be assigned to a chunk using the normal approach
+func (c *linkerContext) addFileToEachEntryPointChunk(jsChunks map[string]chunkInfo, entryBits helpers.BitSet, sourceIndex uint32) bool {
+	var keys []string
+	for i := range c.graph.EntryPoints() {
+		if entryBits.HasBit(uint(i)) {
+			bits := helpers.NewBitSet(uint(len(c.graph.EntryPoints())))
+			bits.SetBit(uint(i))
+			key := bits.String()
+			if _, ok := jsChunks[key]; !ok {
+				return false
+			}
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		jsChunks[key].filesWithPartsInChunk[sourceIndex] = true
+	}
+	return len(keys) > 0
+}
+
 func (c *linkerContext) findImportedPartsInJSOrder(chunk *chunkInfo) (js []uint32, jsParts []partRange) {
 	sorted := make(chunkOrderArray, 0, len(chunk.filesWithPartsInChunk))
 
@@ -4169,7 +5173,14 @@ func (c *linkerContext) findImportedPartsInJSOrder(chunk *chunkInfo) (js []uint3
 		file := &c.graph.Files[sourceIndex]
 
 		if repr, ok := file.InputFile.Repr.(*graph.JSRepr); ok {
-			isFileInThisChunk := chunk.entryBits.Equals(file.EntryBits)
+			// Files are usually in the chunk with the same entry bits, but manual
+			// chunks and chunk merging can move them elsewhere
+			isFileInThisChunk := chunk.filesWithPartsInChunk[sourceIndex]
+
+			// Without code splitting, entry point chunks contain every file they can reach
+			if !c.options.CodeSplitting && chunk.isEntryPoint && file.EntryBits.HasBit(chunk.entryPointBit) {
+				isFileInThisChunk = true
+			}
 
 			// Wrapped files can't be split because they are all inside the wrapper
 			canFileBeSplit := repr.Meta.Wrap == graph.WrapNone
@@ -4635,6 +5646,9 @@ type stmtList struct {
 type compileResultJS struct {
 	js_printer.PrintResult
 
+	// For the "system" format, this is the code that goes before "execute"
+	systemDeclarations js_printer.PrintResult
+
 	sourceIndex uint32
 
 	// This is the line and column offset since the previous JavaScript string
@@ -4661,6 +5675,8 @@ func (c *linkerContext) generateCodeForFileInChunkJS(
 	toCommonJSRef ast.Ref,
 	toESMRef ast.Ref,
 	runtimeRequireRef ast.Ref,
+	systemExports map[ast.Ref][]string,
+	systemHoistedFunctions map[ast.Ref]bool,
 	result *compileResultJS,
 	dataForSourceMaps []bundler.DataForSourceMap,
 ) {
@@ -4943,8 +5959,10 @@ func (c *linkerContext) generateCodeForFileInChunkJS(
 
 	// Indent the file if everything is wrapped in an IIFE
 	indent := 0
-	if c.options.OutputFormat == config.FormatIIFE {
+	if c.options.OutputFormat == config.FormatIIFE || c.options.OutputFormat == config.FormatUMD {
 		indent++
+	} else if c.options.OutputFormat == config.FormatSystem {
+		indent += 3
 	}
 
 	// Convert the AST to JavaScript code
@@ -4969,16 +5987,34 @@ func (c *linkerContext) generateCodeForFileInChunkJS(
 		LineOffsetTables:             lineOffsetTables,
 		RequireOrImportMetaForSource: c.requireOrImportMetaForSource,
 		MangledProps:                 c.mangledProps,
+		SystemExports:                systemExports,
+		SystemHoistedFunctions:       systemHoistedFunctions,
 		NeedsMetafile:                c.options.NeedsMetafile,
 		MetafileFormat:               c.options.MetafileFormat,
 	}
 	tree := repr.AST
 	tree.Directives = nil // This is handled elsewhere
+
+	// Declarations moved out of "execute" are printed separately
+	var systemDeclarations js_printer.PrintResult
+	if systemHoistedFunctions != nil {
+		var declarations []js_ast.Stmt
+		stmts, declarations = hoistSystemDeclarations(stmts, c.graph.Symbols, systemHoistedFunctions)
+		if len(declarations) > 0 {
+			declarationOptions := printOptions
+			declarationOptions.Indent = 1
+			tree.Parts = []js_ast.Part{{Stmts: declarations}}
+			systemDeclarations = js_printer.Print(tree, c.graph.Symbols, r, declarationOptions)
+		}
+	}
+
 	tree.Parts = []js_ast.Part{{Stmts: stmts}}
 	*result = compileResultJS{
-		PrintResult: js_printer.Print(tree, c.graph.Symbols, r, printOptions),
-		sourceIndex: partRange.sourceIndex,
+		PrintResult:        js_printer.Print(tree, c.graph.Symbols, r, printOptions),
+		systemDeclarations: systemDeclarations,
+		sourceIndex:        partRange.sourceIndex,
 	}
+	result.JSONMetadataImports = append(result.JSONMetadataImports, systemDeclarations.JSONMetadataImports...)
 
 	if file.InputFile.Loader == config.LoaderFile {
 		result.JSONMetadataImports = append(result.JSONMetadataImports, fmt.Sprintf(
@@ -4994,6 +6030,7 @@ func (c *linkerContext) generateEntryPointTailJS(
 	toCommonJSRef ast.Ref,
 	toESMRef ast.Ref,
 	sourceIndex uint32,
+	systemHoistedFunctions map[ast.Ref]bool,
 ) (result compileResultJS) {
 	file := &c.graph.Files[sourceIndex]
 	repr := file.InputFile.Repr.(*graph.JSRepr)
@@ -5009,9 +6046,10 @@ func (c *linkerContext) generateEntryPointTailJS(
 			}}}})
 		}
 
-	case config.FormatIIFE:
+	case config.FormatIIFE, config.FormatUMD:
 		if repr.Meta.Wrap == graph.WrapCJS {
-			if len(c.options.GlobalName) > 0 {
+			// The UMD factory function always returns the exports
+			if len(c.options.GlobalName) > 0 || c.options.OutputFormat == config.FormatUMD {
 				// "return require_foo();"
 				stmts = append(stmts, js_ast.Stmt{Data: &js_ast.SReturn{ValueOrNil: js_ast.Expr{Data: &js_ast.ECall{
 					Target: js_ast.Expr{Data: &js_ast.EIdentifier{Ref: repr.AST.WrapperRef}},
@@ -5147,7 +6185,7 @@ func (c *linkerContext) generateEntryPointTailJS(
 			}
 		}
 
-	case config.FormatESModule:
+	case config.FormatESModule, config.FormatSystem:
 		if repr.Meta.Wrap == graph.WrapCJS {
 			// "export default require_foo();"
 			stmts = append(stmts, js_ast.Stmt{
@@ -5288,8 +6326,10 @@ func (c *linkerContext) generateEntryPointTailJS(
 
 	// Indent the file if everything is wrapped in an IIFE
 	indent := 0
-	if c.options.OutputFormat == config.FormatIIFE {
+	if c.options.OutputFormat == config.FormatIIFE || c.options.OutputFormat == config.FormatUMD {
 		indent++
+	} else if c.options.OutputFormat == config.FormatSystem {
+		indent += 3
 	}
 
 	// Convert the AST to JavaScript code
@@ -5307,6 +6347,7 @@ func (c *linkerContext) generateEntryPointTailJS(
 		UnsupportedFeatures:          c.options.UnsupportedJSFeatures,
 		RequireOrImportMetaForSource: c.requireOrImportMetaForSource,
 		MangledProps:                 c.mangledProps,
+		SystemHoistedFunctions:       systemHoistedFunctions,
 	}
 	result.PrintResult = js_printer.Print(tree, c.graph.Symbols, r, printOptions)
 	return
@@ -5347,6 +6388,15 @@ func (c *linkerContext) renameSymbolsInChunk(chunk *chunkInfo, filesInOrder []ui
 		reservedNames["require"] = 1
 		reservedNames["Promise"] = 1
 	}
+
+	// These are used by the "System.register" wrapper
+	if c.options.OutputFormat == config.FormatSystem {
+		reservedNames["_export"] = 1
+		reservedNames["_context"] = 1
+		reservedNames["_m"] = 1
+		reservedNames["_k"] = 1
+		reservedNames["_exportNames"] = 1
+	}
 	timer.End("Compute reserved names")
 
 	// Make sure imports get a chance to be renamed too
@@ -5591,6 +6641,15 @@ func (c *linkerContext) generateChunkJS(chunkIndex int, chunkWaitGroup *sync.Wai
 	// never change the "../" count.
 	chunkAbsDir := c.fs.Dir(c.fs.Join(c.options.AbsOutputDir, config.TemplateToString(chunk.finalTemplate)))
 
+	// Assignments to exported symbols need to update the exports of a SystemJS
+	// module, so the printer needs to know which symbols are exported
+	var systemExports map[ast.Ref][]string
+	var systemHoistedFunctions map[ast.Ref]bool
+	if c.options.OutputFormat == config.FormatSystem {
+		systemExports = c.systemExportsForChunk(chunk)
+		systemHoistedFunctions = c.systemHoistedFunctionsForChunk(chunkRepr)
+	}
+
 	// Generate JavaScript for each file in parallel
 	timer.Begin("Print JavaScript files")
 	waitGroup := sync.WaitGroup{}
@@ -5611,6 +6670,8 @@ func (c *linkerContext) generateChunkJS(chunkIndex int, chunkWaitGroup *sync.Wai
 			toCommonJSRef,
 			toESMRef,
 			runtimeRequireRef,
+			systemExports,
+			systemHoistedFunctions,
 			compileResult,
 			dataForSourceMaps,
 		)
@@ -5619,22 +6680,27 @@ func (c *linkerContext) generateChunkJS(chunkIndex int, chunkWaitGroup *sync.Wai
 	// Also generate the cross-chunk binding code
 	var crossChunkPrefix []byte
 	var crossChunkSuffix []byte
+	var crossChunkSystemImports []js_printer.SystemImport
 	var jsonMetadataImports []string
 	{
 		// Indent the file if everything is wrapped in an IIFE
 		indent := 0
-		if c.options.OutputFormat == config.FormatIIFE {
+		if c.options.OutputFormat == config.FormatIIFE || c.options.OutputFormat == config.FormatUMD {
 			indent++
+		} else if c.options.OutputFormat == config.FormatSystem {
+			indent += 3
 		}
 		printOptions := js_printer.Options{
-			Indent:            indent,
-			OutputFormat:      c.options.OutputFormat,
-			MinifyIdentifiers: c.options.MinifyIdentifiers,
-			MinifyWhitespace:  c.options.MinifyWhitespace,
-			MinifySyntax:      c.options.MinifySyntax,
-			LineLimit:         c.options.LineLimit,
-			NeedsMetafile:     c.options.NeedsMetafile,
-			MetafileFormat:    c.options.MetafileFormat,
+			Indent:                 indent,
+			OutputFormat:           c.options.OutputFormat,
+			MinifyIdentifiers:      c.options.MinifyIdentifiers,
+			MinifyWhitespace:       c.options.MinifyWhitespace,
+			MinifySyntax:           c.options.MinifySyntax,
+			LineLimit:              c.options.LineLimit,
+			SystemExports:          systemExports,
+			SystemHoistedFunctions: systemHoistedFunctions,
+			NeedsMetafile:          c.options.NeedsMetafile,
+			MetafileFormat:         c.options.MetafileFormat,
 		}
 		crossChunkImportRecords := make([]ast.ImportRecord, len(chunk.crossChunkImports))
 		for i, chunkImport := range chunk.crossChunkImports {
@@ -5649,6 +6715,7 @@ func (c *linkerContext) generateChunkJS(chunkIndex int, chunkWaitGroup *sync.Wai
 			Parts:         []js_ast.Part{{Stmts: chunkRepr.crossChunkPrefixStmts}},
 		}, c.graph.Symbols, r, printOptions)
 		crossChunkPrefix = crossChunkResult.JS
+		crossChunkSystemImports = crossChunkResult.SystemImports
 		jsonMetadataImports = crossChunkResult.JSONMetadataImports
 		crossChunkSuffix = js_printer.Print(js_ast.AST{
 			Parts: []js_ast.Part{{Stmts: chunkRepr.crossChunkSuffixStmts}},
@@ -5663,6 +6730,7 @@ func (c *linkerContext) generateChunkJS(chunkIndex int, chunkWaitGroup *sync.Wai
 			toCommonJSRef,
 			toESMRef,
 			chunk.sourceIndex,
+			systemHoistedFunctions,
 		)
 	}
 
@@ -5708,11 +6776,12 @@ func (c *linkerContext) generateChunkJS(chunkIndex int, chunkWaitGroup *sync.Wai
 	}
 
 	// Add the top-level directive if present (but omit "use strict" in ES
-	// modules because all ES modules are automatically in strict mode)
+	// modules because all ES modules are automatically in strict mode, and in
+	// SystemJS modules because the wrapper already has one)
 	if chunk.isEntryPoint {
 		repr := c.graph.Files[chunk.sourceIndex].InputFile.Repr.(*graph.JSRepr)
 		for _, directive := range repr.AST.Directives {
-			if directive != "use strict" || c.options.OutputFormat != config.FormatESModule {
+			if directive != "use strict" || !c.options.OutputFormat.IsESMCompatible() {
 				quoted := string(helpers.QuoteForJSON(directive, c.options.ASCIIOnly)) + ";" + newline
 				prevOffset.AdvanceString(quoted)
 				j.AddString(quoted)
@@ -5721,129 +6790,30 @@ func (c *linkerContext) generateChunkJS(chunkIndex int, chunkWaitGroup *sync.Wai
 		}
 	}
 
-	// Optionally wrap with an IIFE
-	if c.options.OutputFormat == config.FormatIIFE {
-		var text string
-		indent = "  "
-		if len(c.options.GlobalName) > 0 {
-			text = c.generateGlobalNamePrefix()
-		}
-		if c.options.UnsupportedJSFeatures.Has(compat.Arrow) {
-			text += "(function()" + space + "{" + newline
-		} else {
-			text += "(()" + space + "=>" + space + "{" + newline
-		}
-		prevOffset.AdvanceString(text)
-		j.AddString(text)
-		newlineBeforeComment = false
-	}
-
-	// Put the cross-chunk prefix inside the IIFE
-	if len(crossChunkPrefix) > 0 {
-		newlineBeforeComment = true
-		prevOffset.AdvanceBytes(crossChunkPrefix)
-		j.AddBytes(crossChunkPrefix)
-	}
-
-	// Start the metadata
-	jMeta := helpers.Joiner{}
+	// This is used to concatenate the generated JavaScript chunks together
+	var compileResultsForSourceMap []compileResultForSourceMap
+	var legalCommentList []legalCommentEntry
+	var metaOrder []uint32
+	var metaBytes map[uint32][][]byte
+	prevFileNameComment := uint32(0)
 	if c.options.NeedsMetafile {
-		// Print imports
-		isFirstMeta := true
-		jMeta.AddString(c.options.MetafileFormat.MaybeRemoveWhitespace("{\n      \"imports\": ["))
-		for _, json := range jsonMetadataImports {
-			if isFirstMeta {
-				isFirstMeta = false
-			} else {
-				jMeta.AddString(",")
-			}
-			jMeta.AddString(json)
+		metaOrder = make([]uint32, 0, len(compileResults))
+		metaBytes = make(map[uint32][][]byte, len(compileResults))
+	}
+	addCompileResult := func(compileResult compileResultJS) {
+		if len(compileResult.ExtractedLegalComments) > 0 {
+			legalCommentList = append(legalCommentList, legalCommentEntry{
+				sourceIndex: compileResult.sourceIndex,
+				comments:    compileResult.ExtractedLegalComments,
+			})
 		}
-		for _, compileResult := range compileResults {
-			for _, json := range compileResult.JSONMetadataImports {
-				if isFirstMeta {
-					isFirstMeta = false
-				} else {
-					jMeta.AddString(",")
-				}
-				jMeta.AddString(json)
-			}
-		}
-		if !isFirstMeta {
-			jMeta.AddString(c.options.MetafileFormat.MaybeRemoveWhitespace("\n      "))
-		}
-
-		// Print exports
-		jMeta.AddString(c.options.MetafileFormat.MaybeRemoveWhitespace("],\n      \"exports\": ["))
-		var aliases []string
-		if c.options.OutputFormat.KeepESMImportExportSyntax() {
-			if chunk.isEntryPoint {
-				if fileRepr := c.graph.Files[chunk.sourceIndex].InputFile.Repr.(*graph.JSRepr); fileRepr.Meta.Wrap == graph.WrapCJS {
-					aliases = []string{"default"}
-				} else {
-					resolvedExports := fileRepr.Meta.ResolvedExports
-					aliases = make([]string, 0, len(resolvedExports))
-					for alias := range resolvedExports {
-						aliases = append(aliases, alias)
-					}
-				}
-			} else {
-				aliases = make([]string, 0, len(chunkRepr.exportsToOtherChunks))
-				for _, alias := range chunkRepr.exportsToOtherChunks {
-					aliases = append(aliases, alias)
-				}
-			}
-		}
-		isFirstMeta = true
-		sort.Strings(aliases) // Sort for determinism
-		for _, alias := range aliases {
-			if isFirstMeta {
-				isFirstMeta = false
-			} else {
-				jMeta.AddString(",")
-			}
-			jMeta.AddString(fmt.Sprintf(
-				c.options.MetafileFormat.MaybeRemoveWhitespace("\n        %s"),
-				helpers.QuoteForJSON(alias, c.options.ASCIIOnly)))
-		}
-		if !isFirstMeta {
-			jMeta.AddString(c.options.MetafileFormat.MaybeRemoveWhitespace("\n      "))
-		}
-		jMeta.AddString(c.options.MetafileFormat.MaybeRemoveWhitespace("],\n"))
-		if chunk.isEntryPoint {
-			entryPoint := c.graph.Files[chunk.sourceIndex].InputFile.Source.PrettyPaths.Select(c.options.MetafilePathStyle)
-			jMeta.AddString(fmt.Sprintf(c.options.MetafileFormat.MaybeRemoveWhitespace("      \"entryPoint\": %s,\n"), helpers.QuoteForJSON(entryPoint, c.options.ASCIIOnly)))
-		}
-		if chunkRepr.hasCSSChunk {
-			jMeta.AddString(fmt.Sprintf(c.options.MetafileFormat.MaybeRemoveWhitespace("      \"cssBundle\": %s,\n"), helpers.QuoteForJSON(c.chunks[chunkRepr.cssChunkIndex].uniqueKey, c.options.ASCIIOnly)))
-		}
-		jMeta.AddString(c.options.MetafileFormat.MaybeRemoveWhitespace("      \"inputs\": {"))
-	}
-
-	// Concatenate the generated JavaScript chunks together
-	var compileResultsForSourceMap []compileResultForSourceMap
-	var legalCommentList []legalCommentEntry
-	var metaOrder []uint32
-	var metaBytes map[uint32][][]byte
-	prevFileNameComment := uint32(0)
-	if c.options.NeedsMetafile {
-		metaOrder = make([]uint32, 0, len(compileResults))
-		metaBytes = make(map[uint32][][]byte, len(compileResults))
-	}
-	for _, compileResult := range compileResults {
-		if len(compileResult.ExtractedLegalComments) > 0 {
-			legalCommentList = append(legalCommentList, legalCommentEntry{
-				sourceIndex: compileResult.sourceIndex,
-				comments:    compileResult.ExtractedLegalComments,
-			})
-		}
-
-		// Add a comment with the file path before the file contents
-		if c.options.Mode == config.ModeBundle && !c.options.MinifyWhitespace &&
-			prevFileNameComment != compileResult.sourceIndex && len(compileResult.JS) > 0 {
-			if newlineBeforeComment {
-				prevOffset.AdvanceString("\n")
-				j.AddString("\n")
+
+		// Add a comment with the file path before the file contents
+		if c.options.Mode == config.ModeBundle && !c.options.MinifyWhitespace &&
+			prevFileNameComment != compileResult.sourceIndex && len(compileResult.JS) > 0 {
+			if newlineBeforeComment {
+				prevOffset.AdvanceString("\n")
+				j.AddString("\n")
 			}
 
 			path := c.graph.Files[compileResult.sourceIndex].InputFile.Source.PrettyPaths.Select(c.options.CodePathStyle)
@@ -5914,6 +6884,152 @@ func (c *linkerContext) generateChunkJS(chunkIndex int, chunkWaitGroup *sync.Wai
 		}
 	}
 
+	// Optionally wrap with an IIFE
+	if c.options.OutputFormat == config.FormatIIFE {
+		var text string
+		indent = "  "
+		if len(c.options.GlobalName) > 0 {
+			text = c.generateGlobalNamePrefix()
+		}
+		if c.options.UnsupportedJSFeatures.Has(compat.Arrow) {
+			text += "(function()" + space + "{" + newline
+		} else {
+			text += "(()" + space + "=>" + space + "{" + newline
+		}
+		prevOffset.AdvanceString(text)
+		j.AddString(text)
+		newlineBeforeComment = false
+	}
+
+	// Optionally wrap with a UMD factory function
+	if c.options.OutputFormat == config.FormatUMD {
+		var externals []string
+		seen := make(map[string]bool)
+		for _, compileResult := range compileResults {
+			for _, path := range compileResult.ExternalRequires {
+				if !seen[path] {
+					seen[path] = true
+					externals = append(externals, path)
+				}
+			}
+		}
+		text := c.generateUMDPrefix(externals)
+		indent = "  "
+		prevOffset.AdvanceString(text)
+		j.AddString(text)
+		newlineBeforeComment = false
+	}
+
+	// Optionally wrap with "System.register"
+	if c.options.OutputFormat == config.FormatSystem {
+		imports := crossChunkSystemImports
+		for _, compileResult := range compileResults {
+			imports = append(imports, compileResult.SystemImports...)
+		}
+		isAsync := false
+		for _, sourceIndex := range chunkRepr.filesInChunkInOrder {
+			if repr, ok := c.graph.Files[sourceIndex].InputFile.Repr.(*graph.JSRepr); ok && repr.Meta.IsAsyncOrHasAsyncDependency {
+				isAsync = true
+				break
+			}
+		}
+		header, executePrefix := c.generateSystemPrefix(imports, c.systemExportNamesForChunk(chunk), isAsync)
+		indent = "  "
+		prevOffset.AdvanceString(header)
+		j.AddString(header)
+		newlineBeforeComment = false
+
+		// Declarations moved out of "execute" go before it
+		for _, compileResult := range compileResults {
+			if len(compileResult.systemDeclarations.JS) > 0 {
+				addCompileResult(compileResultJS{
+					PrintResult: compileResult.systemDeclarations,
+					sourceIndex: compileResult.sourceIndex,
+				})
+			}
+		}
+		if text := c.generateSystemHoistedExports(r, systemExports, systemHoistedFunctions); text != "" {
+			prevOffset.AdvanceString(text)
+			j.AddString(text)
+		}
+
+		indent = "      "
+		prevOffset.AdvanceString(executePrefix)
+		j.AddString(executePrefix)
+		newlineBeforeComment = false
+		prevFileNameComment = 0
+	}
+
+	// Put the cross-chunk prefix inside the IIFE
+	if len(crossChunkPrefix) > 0 {
+		newlineBeforeComment = true
+		prevOffset.AdvanceBytes(crossChunkPrefix)
+		j.AddBytes(crossChunkPrefix)
+	}
+
+	// Start the metadata
+	jMeta := helpers.Joiner{}
+	if c.options.NeedsMetafile {
+		// Print imports
+		isFirstMeta := true
+		jMeta.AddString(c.options.MetafileFormat.MaybeRemoveWhitespace("{\n      \"imports\": ["))
+		for _, json := range jsonMetadataImports {
+			if isFirstMeta {
+				isFirstMeta = false
+			} else {
+				jMeta.AddString(",")
+			}
+			jMeta.AddString(json)
+		}
+		for _, compileResult := range compileResults {
+			for _, json := range compileResult.JSONMetadataImports {
+				if isFirstMeta {
+					isFirstMeta = false
+				} else {
+					jMeta.AddString(",")
+				}
+				jMeta.AddString(json)
+			}
+		}
+		if !isFirstMeta {
+			jMeta.AddString(c.options.MetafileFormat.MaybeRemoveWhitespace("\n      "))
+		}
+
+		// Print exports
+		jMeta.AddString(c.options.MetafileFormat.MaybeRemoveWhitespace("],\n      \"exports\": ["))
+		isFirstMeta = true
+		for _, alias := range c.exportAliasesForChunkJS(chunk) {
+			if isFirstMeta {
+				isFirstMeta = false
+			} else {
+				jMeta.AddString(",")
+			}
+			jMeta.AddString(fmt.Sprintf(
+				c.options.MetafileFormat.MaybeRemoveWhitespace("\n        %s"),
+				helpers.QuoteForJSON(alias, c.options.ASCIIOnly)))
+		}
+		if !isFirstMeta {
+			jMeta.AddString(c.options.MetafileFormat.MaybeRemoveWhitespace("\n      "))
+		}
+		jMeta.AddString(c.options.MetafileFormat.MaybeRemoveWhitespace("],\n"))
+		if chunk.isEntryPoint {
+			entryPoint := c.graph.Files[chunk.sourceIndex].InputFile.Source.PrettyPaths.Select(c.options.MetafilePathStyle)
+			jMeta.AddString(fmt.Sprintf(c.options.MetafileFormat.MaybeRemoveWhitespace("      \"entryPoint\": %s,\n"), helpers.QuoteForJSON(entryPoint, c.options.ASCIIOnly)))
+		}
+		if chunk.manualChunkName != "" {
+			jMeta.AddString(fmt.Sprintf(c.options.MetafileFormat.MaybeRemoveWhitespace("      \"manualChunk\": %s,\n"), helpers.QuoteForJSON(chunk.manualChunkName, c.options.ASCIIOnly)))
+		}
+		if chunkRepr.hasCSSChunk {
+			jMeta.AddString(fmt.Sprintf(c.options.MetafileFormat.MaybeRemoveWhitespace("      \"cssBundle\": %s,\n"), helpers.QuoteForJSON(c.chunks[chunkRepr.cssChunkIndex].uniqueKey, c.options.ASCIIOnly)))
+		}
+		jMeta.AddString(c.options.MetafileFormat.MaybeRemoveWhitespace("      \"inputs\": {"))
+	}
+
+	// Concatenate the generated JavaScript chunks together
+	for _, compileResult := range compileResults {
+		addCompileResult(compileResult)
+	}
+
 	// Stick the entry point tail at the end of the file. Deliberately don't
 	// include any source mapping information for this because it's automatically
 	// generated and doesn't correspond to a location in the input file.
@@ -5932,6 +7048,20 @@ func (c *linkerContext) generateChunkJS(chunkIndex int, chunkWaitGroup *sync.Wai
 		j.AddString("})();" + newline)
 	}
 
+	// Optionally wrap with a UMD factory function
+	if c.options.OutputFormat == config.FormatUMD {
+		j.AddString("});" + newline)
+	}
+
+	// Optionally wrap with "System.register"
+	if c.options.OutputFormat == config.FormatSystem {
+		if c.options.MinifyWhitespace {
+			j.AddString("}}});")
+		} else {
+			j.AddString("    }\n  };\n});\n")
+		}
+	}
+
 	// Make sure the file ends with a newline
 	j.EnsureNewlineAtEnd()
 	slashTag := "/script"
@@ -5951,7 +7081,8 @@ func (c *linkerContext) generateChunkJS(chunkIndex int, chunkWaitGroup *sync.Wai
 
 	if c.options.SourceMap != config.SourceMapNone {
 		timer.Begin("Generate source map")
-		canHaveShifts := chunk.intermediateOutput.pieces != nil
+		// Plugins that transform the final code need the mappings to be split out
+		canHaveShifts := chunk.intermediateOutput.pieces != nil || c.hasOnRenderChunkPlugins()
 		chunk.outputSourceMap = c.generateSourceMapForChunk(compileResultsForSourceMap, chunkAbsDir, dataForSourceMaps, canHaveShifts)
 		timer.End("Generate source map")
 	}
@@ -5959,6 +7090,10 @@ func (c *linkerContext) generateChunkJS(chunkIndex int, chunkWaitGroup *sync.Wai
 	// End the metadata lazily. The final output size is not known until the
 	// final import paths are substituted into the output pieces generated below.
 	if c.options.NeedsMetafile {
+		var inclusionReasons map[uint32]inclusionReason
+		if c.options.MetafileExplain {
+			inclusionReasons = c.computeInclusionReasons(chunk)
+		}
 		pieces := make([][]intermediateOutput, len(metaOrder))
 		for i, sourceIndex := range metaOrder {
 			slices := metaBytes[sourceIndex]
@@ -5979,9 +7114,9 @@ func (c *linkerContext) generateChunkJS(chunkIndex int, chunkWaitGroup *sync.Wai
 					count += c.accurateFinalByteCount(output, finalRelDir)
 				}
 				jMeta.AddString(fmt.Sprintf(
-					c.options.MetafileFormat.MaybeRemoveWhitespace("\n        %s: {\n          \"bytesInOutput\": %d\n        %s}"),
+					c.options.MetafileFormat.MaybeRemoveWhitespace("\n        %s: {\n          \"bytesInOutput\": %d%s\n        %s}"),
 					helpers.QuoteForJSON(c.graph.Files[sourceIndex].InputFile.Source.PrettyPaths.Select(c.options.MetafilePathStyle), c.options.ASCIIOnly),
-					count, c.generateExtraDataForFileJS(sourceIndex)))
+					count, c.generateInclusionReasonForFileJS(inclusionReasons, sourceIndex), c.generateExtraDataForFileJS(sourceIndex)))
 			}
 			if len(metaOrder) > 0 {
 				jMeta.AddString(c.options.MetafileFormat.MaybeRemoveWhitespace("\n      "))
@@ -5996,6 +7131,32 @@ func (c *linkerContext) generateChunkJS(chunkIndex int, chunkWaitGroup *sync.Wai
 	chunkWaitGroup.Done()
 }
 
+// The returned aliases are sorted
+func (c *linkerContext) exportAliasesForChunkJS(chunk *chunkInfo) []string {
+	var aliases []string
+	if c.options.OutputFormat.KeepESMImportExportSyntax() {
+		if chunk.isEntryPoint {
+			if fileRepr := c.graph.Files[chunk.sourceIndex].InputFile.Repr.(*graph.JSRepr); fileRepr.Meta.Wrap == graph.WrapCJS {
+				aliases = []string{"default"}
+			} else {
+				resolvedExports := fileRepr.Meta.ResolvedExports
+				aliases = make([]string, 0, len(resolvedExports))
+				for alias := range resolvedExports {
+					aliases = append(aliases, alias)
+				}
+			}
+		} else {
+			chunkRepr := chunk.chunkRepr.(*chunkReprJS)
+			aliases = make([]string, 0, len(chunkRepr.exportsToOtherChunks))
+			for _, alias := range chunkRepr.exportsToOtherChunks {
+				aliases = append(aliases, alias)
+			}
+		}
+	}
+	sort.Strings(aliases) // Sort for determinism
+	return aliases
+}
+
 func (c *linkerContext) generateGlobalNamePrefix() string {
 	var text string
 	globalName := c.options.GlobalName
@@ -6075,6 +7236,571 @@ func (c *linkerContext) generateGlobalNamePrefix() string {
 	return text
 }
 
+// This generates the start of the UMD wrapper. The bundled code is placed in
+// a factory function that is either passed to AMD's "define", called with
+// CommonJS's "require", or called with a function that maps each external
+// import path to a global variable. The global variable name for an external
+// import path comes from the "UMDGlobals" option, and is otherwise guessed
+// from the path (e.g. "react-dom" => "reactDom").
+func (c *linkerContext) generateUMDPrefix(externals []string) string {
+	root := "root"
+	factory := "factory"
+	id := "id"
+	space := " "
+	newline := "\n"
+	indent := "  "
+	if c.options.MinifyIdentifiers {
+		root = "r"
+		factory = "f"
+		id = "i"
+	}
+	if c.options.MinifyWhitespace {
+		space = ""
+		newline = ""
+		indent = ""
+	}
+
+	fn := func(args string) string {
+		if c.options.UnsupportedJSFeatures.Has(compat.Arrow) {
+			return fmt.Sprintf("function(%s)%s{", args, space)
+		}
+		return fmt.Sprintf("(%s)%s=>%s{", args, space, space)
+	}
+
+	// "define(["require", "react"], factory)"
+	var deps strings.Builder
+	var lookup strings.Builder
+	requireArg := ""
+	if len(externals) > 0 {
+		requireArg = "require"
+		deps.WriteString("\"require\"")
+		for i, path := range externals {
+			quoted := helpers.QuoteForJSON(path, c.options.ASCIIOnly)
+			deps.WriteString(",")
+			deps.WriteString(space)
+			deps.Write(quoted)
+			if i > 0 {
+				lookup.WriteString(",")
+			}
+			globalName, ok := c.options.UMDGlobals[path]
+			if !ok {
+				globalName = []string{umdGlobalNameForPath(path)}
+			} else if globalName[0] == "this" {
+				globalName = globalName[1:]
+			}
+			access := root
+			for _, name := range globalName {
+				access += c.umdPropertyAccess(name)
+			}
+			lookup.WriteString(fmt.Sprintf("%s%s:%s%s", space, quoted, space, access))
+		}
+		lookup.WriteString(space)
+	}
+
+	// "root.a.b = factory(...)"
+	var assign string
+	if len(c.options.GlobalName) > 0 {
+		globalName := c.options.GlobalName
+		if globalName[0] == "this" {
+			globalName = globalName[1:]
+		}
+		prefix := root
+		for i, name := range globalName {
+			dotOrIndex := c.umdPropertyAccess(name)
+			if i == 0 {
+				prefix += dotOrIndex
+			} else if !c.options.UnsupportedJSFeatures.Has(compat.LogicalAssignment) {
+				prefix = fmt.Sprintf("(%s%s||=%s{})%s", prefix, space, space, dotOrIndex)
+			} else {
+				prefix = fmt.Sprintf("(%s%s=%s%s%s||%s{})%s", prefix, space, space, prefix, space, space, dotOrIndex)
+			}
+		}
+		if len(globalName) > 0 {
+			assign = fmt.Sprintf("%s%s=%s", prefix, space, space)
+		}
+	}
+
+	var globalArg string
+	if len(externals) > 0 {
+		globalArg = fmt.Sprintf("%s%sreturn%s{%s}[%s];%s}", fn(id), space, space, lookup.String(), id, space)
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("(%s%s", fn(root+","+space+factory), newline))
+	text.WriteString(fmt.Sprintf("%sif%s(typeof define%s===%s\"function\"%s&&%sdefine.amd)%sdefine([%s],%s%s);%s",
+		indent, space, space, space, space, space, space, deps.String(), space, factory, newline))
+	text.WriteString(fmt.Sprintf("%selse if%s(typeof module%s===%s\"object\"%s&&%smodule.exports)%smodule.exports%s=%s%s(%s);%s",
+		indent, space, space, space, space, space, space, space, space, factory, requireArg, newline))
+	text.WriteString(fmt.Sprintf("%selse %s%s(%s);%s", indent, assign, factory, globalArg, newline))
+	text.WriteString(fmt.Sprintf("})(typeof self%s!==%s\"undefined\"%s?%sself%s:%sthis,%s%s%s",
+		space, space, space, space, space, space, space, fn(requireArg), newline))
+	return text.String()
+}
+
+func (c *linkerContext) systemExportsForChunk(chunk *chunkInfo) map[ast.Ref][]string {
+	exports := make(map[ast.Ref][]string)
+	add := func(ref ast.Ref, alias string) {
+		ref = ast.FollowSymbols(c.graph.Symbols, ref)
+		exports[ref] = append(exports[ref], alias)
+	}
+
+	// This mirrors the export clause in "generateEntryPointTailJS"
+	if chunk.isEntryPoint {
+		if repr := c.graph.Files[chunk.sourceIndex].InputFile.Repr.(*graph.JSRepr); repr.Meta.Wrap != graph.WrapCJS {
+			for _, alias := range repr.Meta.SortedAndFilteredExportAliases {
+				export := repr.Meta.ResolvedExports[alias]
+				if importData, ok := c.graph.Files[export.SourceIndex].InputFile.Repr.(*graph.JSRepr).Meta.ImportsToBind[export.Ref]; ok {
+					export.Ref = importData.Ref
+				}
+				if c.graph.Symbols.Get(export.Ref).NamespaceAlias == nil {
+					add(export.Ref, alias)
+				}
+			}
+		}
+	}
+
+	for ref, alias := range chunk.chunkRepr.(*chunkReprJS).exportsToOtherChunks {
+		add(ref, alias)
+	}
+	return exports
+}
+
+// These are the names exported by the chunk itself. They take precedence over
+// names from "export * from" statements, which would otherwise overwrite them.
+func (c *linkerContext) systemExportNamesForChunk(chunk *chunkInfo) []string {
+	names := make(map[string]bool)
+	if chunk.isEntryPoint {
+		if repr := c.graph.Files[chunk.sourceIndex].InputFile.Repr.(*graph.JSRepr); repr.Meta.Wrap != graph.WrapCJS {
+			for _, alias := range repr.Meta.SortedAndFilteredExportAliases {
+				names[alias] = true
+			}
+		}
+	}
+	for _, alias := range chunk.chunkRepr.(*chunkReprJS).exportsToOtherChunks {
+		names[alias] = true
+	}
+
+	// "default" is never re-exported by "export * from" anyway
+	delete(names, "default")
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// SystemJS runs the body of the "System.register" callback before it runs
+// the "execute" function of any module. Function declarations are moved there
+// and exported early so that modules with circular imports can call each
+// other's functions while they are being evaluated, like they can with real
+// ES modules. The names of top-level variables have to be moved there too
+// since the functions may refer to them. "var" declarations that aren't at the
+// top level stay scoped to "execute", so functions that refer to them (either
+// directly or by calling another function that stays behind) aren't moved.
+// This returns the moved functions or nil if there are none.
+func (c *linkerContext) systemHoistedFunctionsForChunk(chunkRepr *chunkReprJS) map[ast.Ref]bool {
+	nestedVars := make(map[ast.Ref]bool)
+	functionUses := make(map[ast.Ref]map[ast.Ref]bool)
+	for _, sourceIndex := range chunkRepr.filesInChunkInOrder {
+		repr := c.graph.Files[sourceIndex].InputFile.Repr.(*graph.JSRepr)
+		topLevelVars := make(map[ast.Ref]bool)
+		for _, part := range repr.AST.Parts {
+			for _, stmt := range part.Stmts {
+				var name ast.Ref
+				switch s := stmt.Data.(type) {
+				case *js_ast.SLocal:
+					if s.Kind.IsUsing() {
+						return nil
+					}
+					js_ast.ForEachIdentifierBindingInDecls(s.Decls, func(loc logger.Loc, b *js_ast.BIdentifier) {
+						topLevelVars[b.Ref] = true
+					})
+					continue
+
+				case *js_ast.SFunction:
+					if s.Fn.Name == nil {
+						continue
+					}
+					name = s.Fn.Name.Ref
+
+				case *js_ast.SExportDefault:
+					if _, ok := s.Value.Data.(*js_ast.SFunction); !ok {
+						continue
+					}
+					name = s.DefaultName.Ref
+
+				default:
+					continue
+				}
+				if repr.Meta.Wrap == graph.WrapCJS {
+					continue
+				}
+
+				// Remember which symbols the function refers to
+				uses := make(map[ast.Ref]bool)
+				visitor := js_ast.Visitor{
+					EnterExpr: func(expr *js_ast.Expr) bool {
+						switch e := expr.Data.(type) {
+						case *js_ast.EIdentifier:
+							uses[ast.FollowSymbols(c.graph.Symbols, e.Ref)] = true
+						case *js_ast.EImportIdentifier:
+							uses[ast.FollowSymbols(c.graph.Symbols, e.Ref)] = true
+						}
+						return true
+					},
+				}
+				stmt := stmt
+				visitor.VisitStmt(&stmt)
+				functionUses[ast.FollowSymbols(c.graph.Symbols, name)] = uses
+			}
+		}
+		for _, member := range repr.AST.ModuleScope.Members {
+			if member.Ref != repr.AST.ExportsRef && member.Ref != repr.AST.ModuleRef &&
+				c.graph.Symbols.Get(member.Ref).Kind == ast.SymbolHoisted && !topLevelVars[member.Ref] {
+				nestedVars[ast.FollowSymbols(c.graph.Symbols, member.Ref)] = true
+			}
+		}
+	}
+
+	// Leave out functions that use nested variables, and then functions that
+	// call the functions that were left out until nothing changes
+	functions := make(map[ast.Ref]bool)
+	for ref := range functionUses {
+		functions[ref] = true
+	}
+	for changed := true; changed; {
+		changed = false
+		for ref, uses := range functionUses {
+			if !functions[ref] {
+				continue
+			}
+			for use := range uses {
+				if nestedVars[use] || (functionUses[use] != nil && !functions[use]) {
+					delete(functions, ref)
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	if len(functions) == 0 {
+		return nil
+	}
+	return functions
+}
+
+// This splits the top-level statements of a file into the statements that
+// stay in "execute" and the declarations that are moved out of it. Variable
+// and class declarations are converted to assignments.
+func hoistSystemDeclarations(
+	stmts []js_ast.Stmt,
+	symbols ast.SymbolMap,
+	functions map[ast.Ref]bool,
+) (execute []js_ast.Stmt, declarations []js_ast.Stmt) {
+	var decls []js_ast.Decl
+	for _, stmt := range stmts {
+		switch s := stmt.Data.(type) {
+		case *js_ast.SLocal:
+			// "var foo = 1" => "foo = 1"
+			wrapIdentifier := func(loc logger.Loc, ref ast.Ref) js_ast.Expr {
+				decls = append(decls, js_ast.Decl{Binding: js_ast.Binding{Loc: loc, Data: &js_ast.BIdentifier{Ref: ref}}})
+				return js_ast.Expr{Loc: loc, Data: &js_ast.EIdentifier{Ref: ref}}
+			}
+			var value js_ast.Expr
+			for _, decl := range s.Decls {
+				binding := js_ast.ConvertBindingToExpr(decl.Binding, wrapIdentifier)
+				if decl.ValueOrNil.Data != nil {
+					value = js_ast.JoinWithComma(value, js_ast.Assign(binding, decl.ValueOrNil))
+				}
+			}
+			if value.Data == nil {
+				continue
+			}
+			stmt = js_ast.Stmt{Loc: stmt.Loc, Data: &js_ast.SExpr{Value: value}}
+
+		case *js_ast.SClass:
+			// "class Foo {}" => "Foo = class Foo {}"
+			if s.Class.Name != nil {
+				ref := s.Class.Name.Ref
+				decls = append(decls, js_ast.Decl{Binding: js_ast.Binding{Loc: s.Class.Name.Loc, Data: &js_ast.BIdentifier{Ref: ref}}})
+				stmt = js_ast.Stmt{Loc: stmt.Loc, Data: &js_ast.SExpr{Value: js_ast.Assign(
+					js_ast.Expr{Loc: s.Class.Name.Loc, Data: &js_ast.EIdentifier{Ref: ref}},
+					js_ast.Expr{Loc: stmt.Loc, Data: &js_ast.EClass{Class: s.Class}},
+				)}}
+			}
+
+		case *js_ast.SFunction:
+			if s.Fn.Name == nil || functions[ast.FollowSymbols(symbols, s.Fn.Name.Ref)] {
+				declarations = append(declarations, stmt)
+				continue
+			}
+		}
+		execute = append(execute, stmt)
+	}
+
+	// "var foo, Foo;"
+	if len(decls) > 0 {
+		declarations = append([]js_ast.Stmt{{Data: &js_ast.SLocal{Decls: decls}}}, declarations...)
+	}
+	return
+}
+
+// This generates the start of the "System.register" wrapper. Each imported
+// module becomes a dependency with a setter function that assigns to the
+// imported bindings, and the bundled code goes in the "execute" function.
+// The header is everything before the declarations that are moved out of
+// "execute" and the execute prefix is everything after them.
+func (c *linkerContext) generateSystemPrefix(
+	imports []js_printer.SystemImport,
+	exportNames []string,
+	isAsync bool,
+) (header string, executePrefix string) {
+	// "for (var _k in _m) _k !== "default" && !_exportNames[_k] && _export(_k, _m[_k])"
+	var exportStar string
+	usesExportNames := false
+	if c.options.MinifyWhitespace {
+		exportStar = "for(var _k in _m)_k!==\"default\"&&_export(_k,_m[_k])"
+		if len(exportNames) > 0 {
+			exportStar = "for(var _k in _m)_k!==\"default\"&&!_exportNames[_k]&&_export(_k,_m[_k])"
+		}
+	} else {
+		exportStar = "for (var _k in _m) _k !== \"default\" && _export(_k, _m[_k])"
+		if len(exportNames) > 0 {
+			exportStar = "for (var _k in _m) _k !== \"default\" && !_exportNames[_k] && _export(_k, _m[_k])"
+		}
+	}
+
+	// Merge imports of the same path together
+	var paths []string
+	var bindings []string
+	setters := make(map[string][]string)
+	for _, imp := range imports {
+		setter, ok := setters[imp.Path]
+		if !ok {
+			paths = append(paths, imp.Path)
+		}
+		setter = append(setter, imp.Setter...)
+		if imp.IsExportStar {
+			setter = append(setter, exportStar)
+			usesExportNames = len(exportNames) > 0
+		}
+		setters[imp.Path] = setter
+		bindings = append(bindings, imp.Bindings...)
+	}
+
+	// "var _exportNames = { __proto__: null, foo: true }"
+	var exportNamesObject string
+	if usesExportNames {
+		sb := strings.Builder{}
+		if c.options.MinifyWhitespace {
+			sb.WriteString("{__proto__:null")
+		} else {
+			sb.WriteString("{ __proto__: null")
+		}
+		for _, name := range exportNames {
+			if c.options.MinifyWhitespace {
+				sb.WriteString(",")
+			} else {
+				sb.WriteString(", ")
+			}
+			if name == "__proto__" {
+				// A "__proto__" key would set the prototype instead
+				sb.WriteString("[\"__proto__\"]")
+			} else if js_printer.CanEscapeIdentifier(name, c.options.UnsupportedJSFeatures, c.options.ASCIIOnly) {
+				sb.WriteString(c.systemIdentifier(name))
+			} else {
+				sb.Write(helpers.QuoteForJSON(name, c.options.ASCIIOnly))
+			}
+			if c.options.MinifyWhitespace {
+				sb.WriteString(":!0")
+			} else {
+				sb.WriteString(": true")
+			}
+		}
+		if c.options.MinifyWhitespace {
+			sb.WriteString("}")
+		} else {
+			sb.WriteString(" }")
+		}
+		exportNamesObject = sb.String()
+	}
+
+	execute := "function()"
+	if isAsync {
+		execute = "async function()"
+	}
+
+	sb := strings.Builder{}
+	if c.options.MinifyWhitespace {
+		sb.WriteString("System.register([")
+		for i, path := range paths {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			sb.Write(helpers.QuoteForJSON(path, c.options.ASCIIOnly))
+		}
+		sb.WriteString("],function(_export,_context){\"use strict\";")
+		if len(bindings) > 0 {
+			sb.WriteString("var " + strings.Join(bindings, ",") + ";")
+		}
+		if exportNamesObject != "" {
+			sb.WriteString("var _exportNames=" + exportNamesObject + ";")
+		}
+		header = sb.String()
+		sb.Reset()
+		sb.WriteString("return{setters:[")
+		for i, path := range paths {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			if setter := setters[path]; len(setter) > 0 {
+				sb.WriteString("function(_m){" + strings.Join(setter, ";") + "}")
+			} else {
+				sb.WriteString("null")
+			}
+		}
+		sb.WriteString("],execute:" + execute + "{")
+		executePrefix = sb.String()
+		return
+	}
+
+	sb.WriteString("System.register([")
+	for i, path := range paths {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.Write(helpers.QuoteForJSON(path, c.options.ASCIIOnly))
+	}
+	sb.WriteString("], function(_export, _context) {\n  \"use strict\";\n")
+	if len(bindings) > 0 {
+		sb.WriteString("  var " + strings.Join(bindings, ", ") + ";\n")
+	}
+	if exportNamesObject != "" {
+		sb.WriteString("  var _exportNames = " + exportNamesObject + ";\n")
+	}
+	header = sb.String()
+	sb.Reset()
+	sb.WriteString("  return {\n    setters: [")
+	for i, path := range paths {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		if setter := setters[path]; len(setter) > 0 {
+			sb.WriteString("function(_m) {\n")
+			for _, stmt := range setter {
+				sb.WriteString("      " + stmt + ";\n")
+			}
+			sb.WriteString("    }")
+		} else {
+			sb.WriteString("null")
+		}
+	}
+	sb.WriteString("],\n    execute: " + execute + " {\n")
+	executePrefix = sb.String()
+	return
+}
+
+// This exports the function declarations that were moved out of "execute":
+// "_export({ foo: foo })"
+func (c *linkerContext) generateSystemHoistedExports(
+	r renamer.Renamer,
+	systemExports map[ast.Ref][]string,
+	systemHoistedFunctions map[ast.Ref]bool,
+) string {
+	type hoistedExport struct {
+		alias string
+		name  string
+	}
+	var exports []hoistedExport
+	for ref, aliases := range systemExports {
+		if systemHoistedFunctions[ref] {
+			for _, alias := range aliases {
+				exports = append(exports, hoistedExport{alias: alias, name: r.NameForSymbol(ref)})
+			}
+		}
+	}
+	if len(exports) == 0 {
+		return ""
+	}
+	sort.Slice(exports, func(i int, j int) bool { return exports[i].alias < exports[j].alias })
+
+	sb := strings.Builder{}
+	if c.options.MinifyWhitespace {
+		sb.WriteString("_export({")
+	} else {
+		sb.WriteString("  _export({")
+	}
+	for i, export := range exports {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		if !c.options.MinifyWhitespace {
+			sb.WriteString("\n    ")
+		}
+		if export.alias == "__proto__" {
+			// A "__proto__" key would set the prototype instead
+			sb.WriteString("[\"__proto__\"]")
+		} else if js_printer.CanEscapeIdentifier(export.alias, c.options.UnsupportedJSFeatures, c.options.ASCIIOnly) {
+			sb.WriteString(c.systemIdentifier(export.alias))
+		} else {
+			sb.Write(helpers.QuoteForJSON(export.alias, c.options.ASCIIOnly))
+		}
+		if c.options.MinifyWhitespace {
+			sb.WriteString(":" + c.systemIdentifier(export.name))
+		} else {
+			sb.WriteString(": " + c.systemIdentifier(export.name))
+		}
+	}
+	if c.options.MinifyWhitespace {
+		sb.WriteString("});")
+	} else {
+		sb.WriteString("\n  });\n")
+	}
+	return sb.String()
+}
+
+func (c *linkerContext) systemIdentifier(name string) string {
+	if c.options.ASCIIOnly {
+		return string(js_printer.QuoteIdentifier(nil, name, c.options.UnsupportedJSFeatures))
+	}
+	return name
+}
+
+func (c *linkerContext) umdPropertyAccess(name string) string {
+	if js_printer.CanEscapeIdentifier(name, c.options.UnsupportedJSFeatures, c.options.ASCIIOnly) {
+		if c.options.ASCIIOnly {
+			name = string(js_printer.QuoteIdentifier(nil, name, c.options.UnsupportedJSFeatures))
+		}
+		return "." + name
+	}
+	return fmt.Sprintf("[%s]", helpers.QuoteForJSON(name, c.options.ASCIIOnly))
+}
+
+// This guesses the name of the global variable for an external import path.
+// For example, "react-dom" becomes "reactDom" and "@scope/pkg" becomes
+// "scopePkg".
+func umdGlobalNameForPath(path string) string {
+	sb := strings.Builder{}
+	upper := false
+	for _, c := range strings.TrimPrefix(path, "@") {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '$' {
+			if upper && sb.Len() > 0 && c >= 'a' && c <= 'z' {
+				c += 'A' - 'a'
+			}
+			sb.WriteRune(c)
+			upper = false
+		} else {
+			upper = true
+		}
+	}
+	name := sb.String()
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
 type compileResultCSS struct {
 	css_printer.PrintResult
 
@@ -6429,7 +8155,8 @@ func (c *linkerContext) generateChunkCSS(chunkIndex int, chunkWaitGroup *sync.Wa
 
 	if c.options.SourceMap != config.SourceMapNone {
 		timer.Begin("Generate source map")
-		canHaveShifts := chunk.intermediateOutput.pieces != nil
+		// Plugins that transform the final code need the mappings to be split out
+		canHaveShifts := chunk.intermediateOutput.pieces != nil || c.hasOnRenderChunkPlugins()
 		chunk.outputSourceMap = c.generateSourceMapForChunk(compileResultsForSourceMap, chunkAbsDir, dataForSourceMaps, canHaveShifts)
 		timer.End("Generate source map")
 	}
@@ -6470,6 +8197,127 @@ func (c *linkerContext) generateChunkCSS(chunkIndex int, chunkWaitGroup *sync.Wa
 	chunkWaitGroup.Done()
 }
 
+// HTML files are not printed from an AST. Instead, the original source is
+// copied with the URLs for scripts, stylesheets, and assets replaced by the
+// unique keys for their output files. These are substituted with the final
+// paths later on, just like for the other kinds of chunks.
+func (c *linkerContext) generateChunkHTML(chunkIndex int, chunkWaitGroup *sync.WaitGroup) {
+	defer c.recoverInternalError(chunkWaitGroup, runtime.SourceIndex)
+
+	chunk := &c.chunks[chunkIndex]
+	file := &c.graph.Files[chunk.sourceIndex]
+	repr := file.InputFile.Repr.(*graph.HTMLRepr)
+	contents := file.InputFile.Source.Contents
+
+	// An insertion is an edit with an empty range
+	type htmlEdit struct {
+		text  string
+		start int32
+		end   int32
+	}
+	var edits []htmlEdit
+	var jsonMetadataImports []string
+
+	addImportToMetafile := func(path string, kind ast.ImportKind, isExternal bool) {
+		if c.options.NeedsMetafile {
+			external := ""
+			if isExternal {
+				external = c.options.MetafileFormat.MaybeRemoveWhitespace(",\n          \"external\": true")
+			}
+			jsonMetadataImports = append(jsonMetadataImports, fmt.Sprintf(
+				c.options.MetafileFormat.MaybeRemoveWhitespace("\n        {\n          \"path\": %s,\n          \"kind\": %s%s\n        }"),
+				helpers.QuoteForJSON(path, c.options.ASCIIOnly),
+				helpers.QuoteForJSON(kind.StringForMetafile(), c.options.ASCIIOnly),
+				external))
+		}
+	}
+
+	// The hash isn't known until the referenced chunk has been finalized, so
+	// a unique key for it is used in the meantime
+	integrityAttr := func(otherChunkIndex uint32) string {
+		if c.options.Integrity == config.IntegrityNone {
+			return ""
+		}
+		return fmt.Sprintf(" integrity=\"%sI%08d\"", c.uniqueKeyPrefix, otherChunkIndex)
+	}
+
+	for _, ref := range repr.AST.Refs {
+		record := &repr.AST.ImportRecords[ref.ImportRecordIndex]
+
+		if record.SourceIndex.IsValid() {
+			// Scripts and stylesheets reference the chunk for their entry point
+			otherChunkIndex := c.graph.Files[record.SourceIndex.GetIndex()].EntryPointChunkIndex
+			otherChunk := &c.chunks[otherChunkIndex]
+			edits = append(edits, htmlEdit{start: ref.Range.Loc.Start, end: ref.Range.End(), text: otherChunk.uniqueKey})
+			addImportToMetafile(otherChunk.uniqueKey, record.Kind, false)
+			if c.options.Integrity != config.IntegrityNone {
+				if ref.IntegrityRange.Len > 0 {
+					edits = append(edits, htmlEdit{start: ref.IntegrityRange.Loc.Start, end: ref.IntegrityRange.End()})
+				}
+				edits = append(edits, htmlEdit{start: ref.TagAttrsEnd.Start, end: ref.TagAttrsEnd.Start, text: integrityAttr(otherChunkIndex)})
+			}
+
+			// JS entry points that import CSS have a separate CSS chunk, which needs
+			// its own tag. It's inserted before the script tag so that the styles
+			// are loaded before the script runs.
+			if chunkRepr, ok := otherChunk.chunkRepr.(*chunkReprJS); ok && chunkRepr.hasCSSChunk {
+				cssChunk := &c.chunks[chunkRepr.cssChunkIndex]
+				edits = append(edits, htmlEdit{start: ref.TagStart.Start, end: ref.TagStart.Start, text: fmt.Sprintf(
+					"<link rel=\"stylesheet\" href=\"%s\"%s>", cssChunk.uniqueKey, integrityAttr(chunkRepr.cssChunkIndex))})
+				addImportToMetafile(cssChunk.uniqueKey, record.Kind, false)
+			}
+		} else if record.Flags.Has(ast.ShouldNotBeExternalInMetafile) || record.Flags.Has(ast.WasLoadedWithEmptyLoader) {
+			// The URLs for assets were already inlined into the import record
+			edits = append(edits, htmlEdit{start: ref.Range.Loc.Start, end: ref.Range.End(), text: record.Path.Text})
+			addImportToMetafile(record.Path.Text, record.Kind, false)
+		} else {
+			// Leave external references alone
+			addImportToMetafile(record.Path.Text, record.Kind, true)
+		}
+	}
+
+	// Apply the edits in order. Multiple edits at the same location are applied
+	// in the order they were generated.
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].start < edits[j].start
+	})
+	j := helpers.Joiner{}
+	end := int32(0)
+	for _, edit := range edits {
+		j.AddString(contents[end:edit.start])
+		j.AddString(edit.text)
+		end = edit.end
+	}
+	j.AddString(contents[end:])
+	chunk.intermediateOutput = c.breakJoinerIntoPieces(j)
+
+	// The output is a transformed copy of a single input file, so that input
+	// file is responsible for all of the bytes in the output
+	if c.options.NeedsMetafile {
+		chunk.jsonMetadataChunkCallback = func(finalOutputSize int) helpers.Joiner {
+			jMeta := helpers.Joiner{}
+			jMeta.AddString(c.options.MetafileFormat.MaybeRemoveWhitespace("{\n      \"imports\": ["))
+			for i, json := range jsonMetadataImports {
+				if i > 0 {
+					jMeta.AddString(",")
+				}
+				jMeta.AddString(json)
+			}
+			if len(jsonMetadataImports) > 0 {
+				jMeta.AddString(c.options.MetafileFormat.MaybeRemoveWhitespace("\n      "))
+			}
+			inputPath := helpers.QuoteForJSON(file.InputFile.Source.PrettyPaths.Select(c.options.MetafilePathStyle), c.options.ASCIIOnly)
+			jMeta.AddString(fmt.Sprintf(
+				c.options.MetafileFormat.MaybeRemoveWhitespace("],\n      \"entryPoint\": %s,\n      \"inputs\": {\n        %s: {\n          \"bytesInOutput\": %d\n        }\n      },\n      \"bytes\": %d\n    }"),
+				inputPath, inputPath, finalOutputSize, finalOutputSize))
+			return jMeta
+		}
+	}
+
+	c.generateIsolatedHashInParallel(chunk)
+	chunkWaitGroup.Done()
+}
+
 func wrapRulesWithConditions(
 	rules []css_ast.Rule, importRecords []ast.ImportRecord,
 	conditions []css_ast.ImportConditions, conditionImportRecords []ast.ImportRecord,
@@ -6719,6 +8567,10 @@ func (c *linkerContext) appendIsolatedHashesForImportedChunks(
 
 			// Mix in the hash for the relative path, which ends up as a JS string
 			hashWriteLengthPrefixed(hash, []byte(relPath))
+		} else if piece.kind == outputPieceIntegrityIndex {
+			// The hash of the referenced chunk is already included above, but the
+			// algorithm used for the "integrity" attribute isn't
+			hashWriteUint32(hash, uint32(c.options.Integrity))
 		}
 	}
 
@@ -6755,6 +8607,8 @@ func (c *linkerContext) breakOutputIntoPieces(output []byte) intermediateOutput
 					kind = outputPieceAssetIndex
 				case 'C':
 					kind = outputPieceChunkIndex
+				case 'I':
+					kind = outputPieceIntegrityIndex
 				}
 				for j := 1; j < 9; j++ {
 					c := output[start+j]
@@ -6774,7 +8628,7 @@ func (c *linkerContext) breakOutputIntoPieces(output []byte) intermediateOutput
 				boundary = -1
 			}
 
-		case outputPieceChunkIndex:
+		case outputPieceChunkIndex, outputPieceIntegrityIndex:
 			if index >= uint32(len(c.chunks)) {
 				boundary = -1
 			}
@@ -0,0 +1,147 @@
+package linker
+
+// This file generates the entries for the optional build manifest, which maps
+// entry points to their final output paths. The format matches the manifest
+// generated by Vite so that existing server-side integrations can read it.
+// Entry point chunks are keyed by the path of the entry point and all other
+// chunks are keyed by their file name with a "_" prefix. The bundler joins the
+// entries from each linking pass together into a single file.
+
+import (
+	"strings"
+
+	"github.com/ije/esbuild-internal/ast"
+	"github.com/ije/esbuild-internal/graph"
+	"github.com/ije/esbuild-internal/helpers"
+)
+
+// JS entry points that import CSS files generate two chunks, a JS chunk and a
+// CSS chunk. The CSS chunk doesn't get its own entry in the manifest. Instead
+// it's listed in the "css" array of the JS chunk.
+func (c *linkerContext) isSecondaryCSSChunk(chunk *chunkInfo) bool {
+	if _, ok := chunk.chunkRepr.(*chunkReprCSS); ok && chunk.isEntryPoint {
+		_, ok := c.graph.Files[chunk.sourceIndex].InputFile.Repr.(*graph.JSRepr)
+		return ok
+	}
+	return false
+}
+
+func (c *linkerContext) manifestKey(chunk *chunkInfo) string {
+	if chunk.isEntryPoint {
+		return c.graph.Files[chunk.sourceIndex].InputFile.Source.PrettyPaths.Select(c.options.MetafilePathStyle)
+	}
+	relPath := manifestPath(chunk.finalRelPath)
+	return "_" + relPath[strings.LastIndexByte(relPath, '/')+1:]
+}
+
+// Paths in the manifest are relative to the output directory and always use
+// forward slashes, since they are typically used to construct URLs
+func manifestPath(relPath string) string {
+	return strings.TrimPrefix(strings.ReplaceAll(relPath, "\\", "/"), "./")
+}
+
+func (c *linkerContext) generateManifestChunk(chunkIndex int) string {
+	chunk := &c.chunks[chunkIndex]
+	if c.isSecondaryCSSChunk(chunk) {
+		return ""
+	}
+
+	var imports []string
+	var dynamicImports []string
+	var css []string
+	var assets []string
+	seenAssets := make(map[string]bool)
+
+	addAssetsForFiles := func(sourceIndices []uint32) {
+		for _, sourceIndex := range sourceIndices {
+			for _, file := range c.graph.Files[sourceIndex].InputFile.AdditionalFiles {
+				if relPath, ok := c.fs.Rel(c.options.AbsOutputDir, file.AbsPath); ok {
+					if relPath = manifestPath(relPath); !seenAssets[relPath] {
+						seenAssets[relPath] = true
+						assets = append(assets, relPath)
+					}
+				}
+			}
+		}
+	}
+	addAssetsForChunk := func(chunk *chunkInfo) {
+		switch chunkRepr := chunk.chunkRepr.(type) {
+		case *chunkReprJS:
+			addAssetsForFiles(chunkRepr.filesInChunkInOrder)
+		case *chunkReprCSS:
+			for _, entry := range chunkRepr.importsInChunkInOrder {
+				if entry.kind == cssImportSourceIndex {
+					addAssetsForFiles([]uint32{entry.sourceIndex})
+				}
+			}
+		case *chunkReprHTML:
+			addAssetsForFiles([]uint32{chunk.sourceIndex})
+		}
+	}
+
+	if chunkRepr, ok := chunk.chunkRepr.(*chunkReprJS); ok && chunkRepr.hasCSSChunk {
+		cssChunk := &c.chunks[chunkRepr.cssChunkIndex]
+		css = append(css, manifestPath(cssChunk.finalRelPath))
+		addAssetsForChunk(chunk)
+		addAssetsForChunk(cssChunk)
+	} else {
+		addAssetsForChunk(chunk)
+	}
+
+	seenImports := make(map[uint32]bool)
+	for _, chunkImport := range chunk.crossChunkImports {
+		if seenImports[chunkImport.chunkIndex] {
+			continue
+		}
+		seenImports[chunkImport.chunkIndex] = true
+		otherChunk := &c.chunks[chunkImport.chunkIndex]
+		if c.isSecondaryCSSChunk(otherChunk) {
+			css = append(css, manifestPath(otherChunk.finalRelPath))
+			continue
+		}
+		switch chunkImport.importKind {
+		case ast.ImportDynamic, ast.ImportNewWorker:
+			dynamicImports = append(dynamicImports, c.manifestKey(otherChunk))
+		default:
+			imports = append(imports, c.manifestKey(otherChunk))
+		}
+	}
+
+	sb := strings.Builder{}
+	sb.Write(helpers.QuoteForJSON(c.manifestKey(chunk), c.options.ASCIIOnly))
+	sb.WriteString(": {\n    \"file\": ")
+	sb.Write(helpers.QuoteForJSON(manifestPath(chunk.finalRelPath), c.options.ASCIIOnly))
+	if chunk.isEntryPoint {
+		sb.WriteString(",\n    \"src\": ")
+		sb.Write(helpers.QuoteForJSON(c.manifestKey(chunk), c.options.ASCIIOnly))
+		if c.graph.Files[chunk.sourceIndex].IsUserSpecifiedEntryPoint() {
+			sb.WriteString(",\n    \"isEntry\": true")
+		} else {
+			sb.WriteString(",\n    \"isDynamicEntry\": true")
+		}
+	}
+	c.writeManifestArray(&sb, "imports", imports)
+	c.writeManifestArray(&sb, "dynamicImports", dynamicImports)
+	c.writeManifestArray(&sb, "css", css)
+	c.writeManifestArray(&sb, "assets", assets)
+	sb.WriteString("\n  }")
+	return sb.String()
+}
+
+// Empty arrays are omitted, which is what Vite does
+func (c *linkerContext) writeManifestArray(sb *strings.Builder, name string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	sb.WriteString(",\n    \"")
+	sb.WriteString(name)
+	sb.WriteString("\": [")
+	for i, item := range items {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString("\n      ")
+		sb.Write(helpers.QuoteForJSON(item, c.options.ASCIIOnly))
+	}
+	sb.WriteString("\n    ]")
+}
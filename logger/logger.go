@@ -952,6 +952,10 @@ type SummaryTableEntry struct {
 	Size        string
 	Bytes       int
 	IsSourceMap bool
+
+	// The sizes of the precompressed copies of this file, if any
+	GzipSize   string
+	BrotliSize string
 }
 
 // This type is just so we can use Go's native sort function
@@ -1021,6 +1025,8 @@ func PrintSummary(useColor UseColor, table SummaryTable, start *time.Time) {
 			hasSizeWarning := false
 			maxPath := 0
 			maxSize := 0
+			maxGzipSize := 0
+			maxBrotliSize := 0
 			for _, entry := range table {
 				path := len(entry.Dir) + len(entry.Base)
 				size := len(entry.Size) + spacingBetweenColumns
@@ -1030,6 +1036,12 @@ func PrintSummary(useColor UseColor, table SummaryTable, start *time.Time) {
 				if size > maxSize {
 					maxSize = size
 				}
+				if len(entry.GzipSize) > maxGzipSize {
+					maxGzipSize = len(entry.GzipSize)
+				}
+				if len(entry.BrotliSize) > maxBrotliSize {
+					maxBrotliSize = len(entry.BrotliSize)
+				}
 				if !entry.IsSourceMap && entry.Bytes >= sizeWarningThreshold {
 					hasSizeWarning = true
 				}
@@ -1041,6 +1053,16 @@ func PrintSummary(useColor UseColor, table SummaryTable, start *time.Time) {
 				layoutWidth = defaultTerminalWidth
 			}
 			layoutWidth -= 2 * len(margin)
+
+			// Add space for the sizes of precompressed files
+			compressedWidth := 0
+			if maxGzipSize > 0 {
+				compressedWidth += spacingBetweenColumns + len("gzip ") + maxGzipSize
+			}
+			if maxBrotliSize > 0 {
+				compressedWidth += spacingBetweenColumns + len("br ") + maxBrotliSize
+			}
+			layoutWidth -= compressedWidth
 			if hasSizeWarning {
 				// Add space for the warning icon
 				layoutWidth -= 2
@@ -1092,7 +1114,19 @@ func PrintSummary(useColor UseColor, table SummaryTable, start *time.Time) {
 					}
 				}
 
-				sb.WriteString(fmt.Sprintf("%s%s%s%s%s%s%s%s%s%s%s%s\n",
+				// Show the sizes of precompressed files in separate columns
+				compressed := ""
+				if maxGzipSize > 0 {
+					compressed += compressedSizeColumn("gzip", entry.GzipSize, maxGzipSize, spacingBetweenColumns)
+				}
+				if maxBrotliSize > 0 {
+					compressed += compressedSizeColumn("br", entry.BrotliSize, maxBrotliSize, spacingBetweenColumns)
+				}
+				if compressed != "" && sizeWarning == "" && hasSizeWarning && !isProbablyWindowsCommandPrompt {
+					compressed = "   " + compressed // Keep the columns aligned with rows that have a warning icon
+				}
+
+				sb.WriteString(fmt.Sprintf("%s%s%s%s%s%s%s%s%s%s%s%s%s%s%s\n",
 					margin,
 					colors.Dim,
 					dir,
@@ -1105,6 +1139,9 @@ func PrintSummary(useColor UseColor, table SummaryTable, start *time.Time) {
 					entry.Size,
 					sizeWarning,
 					colors.Reset,
+					colors.Dim,
+					compressed,
+					colors.Reset,
 				))
 			}
 
@@ -1140,6 +1177,13 @@ func PrintSummary(useColor UseColor, table SummaryTable, start *time.Time) {
 	})
 }
 
+func compressedSizeColumn(label string, size string, maxSize int, spacing int) string {
+	if size == "" {
+		return strings.Repeat(" ", spacing+len(label)+1+maxSize)
+	}
+	return fmt.Sprintf("%s%s %s%s", strings.Repeat(" ", spacing), label, strings.Repeat(" ", maxSize-len(size)), size)
+}
+
 type DeferLogKind uint8
 
 const (
@@ -64,6 +64,7 @@ const (
 	MsgID_Bundler_EmptyGlob
 	MsgID_Bundler_IgnoredBareImport
 	MsgID_Bundler_IgnoredDynamicImport
+	MsgID_Bundler_IgnoredNewURL
 	MsgID_Bundler_ImportIsUndefined
 	MsgID_Bundler_RequireResolveNotExternal
 
@@ -72,6 +73,13 @@ const (
 	MsgID_SourceMap_MissingSourceMap
 	MsgID_SourceMap_UnsupportedSourceMapComment
 
+	// Import maps
+	MsgID_ImportMap_InvalidImportMap
+
+	// Budgets
+	MsgID_Budget_MaxBytes
+	MsgID_Budget_MaxGzipBytes
+
 	// package.json
 	MsgID_PackageJSON_FIRST // Keep this first
 	MsgID_PackageJSON_DeadCondition
@@ -198,6 +206,8 @@ func StringToMsgIDs(str string, logLevel LogLevel, overrides map[MsgID]LogLevel)
 		overrides[MsgID_Bundler_IgnoredBareImport] = logLevel
 	case "ignored-dynamic-import":
 		overrides[MsgID_Bundler_IgnoredDynamicImport] = logLevel
+	case "ignored-new-url":
+		overrides[MsgID_Bundler_IgnoredNewURL] = logLevel
 	case "import-is-undefined":
 		overrides[MsgID_Bundler_ImportIsUndefined] = logLevel
 	case "require-resolve-not-external":
@@ -211,6 +221,16 @@ func StringToMsgIDs(str string, logLevel LogLevel, overrides map[MsgID]LogLevel)
 	case "unsupported-source-map-comment":
 		overrides[MsgID_SourceMap_UnsupportedSourceMapComment] = logLevel
 
+	// Import maps
+	case "invalid-import-map":
+		overrides[MsgID_ImportMap_InvalidImportMap] = logLevel
+
+	// Budgets
+	case "budget-max-bytes":
+		overrides[MsgID_Budget_MaxBytes] = logLevel
+	case "budget-max-gzip-bytes":
+		overrides[MsgID_Budget_MaxGzipBytes] = logLevel
+
 	case "package.json":
 		for i := MsgID_PackageJSON_FIRST; i <= MsgID_PackageJSON_LAST; i++ {
 			overrides[i] = logLevel
@@ -330,6 +350,8 @@ func MsgIDToString(id MsgID) string {
 		return "ignored-bare-import"
 	case MsgID_Bundler_IgnoredDynamicImport:
 		return "ignored-dynamic-import"
+	case MsgID_Bundler_IgnoredNewURL:
+		return "ignored-new-url"
 	case MsgID_Bundler_ImportIsUndefined:
 		return "import-is-undefined"
 	case MsgID_Bundler_RequireResolveNotExternal:
@@ -343,6 +365,16 @@ func MsgIDToString(id MsgID) string {
 	case MsgID_SourceMap_UnsupportedSourceMapComment:
 		return "unsupported-source-map-comment"
 
+	// Import maps
+	case MsgID_ImportMap_InvalidImportMap:
+		return "invalid-import-map"
+
+	// Budgets
+	case MsgID_Budget_MaxBytes:
+		return "budget-max-bytes"
+	case MsgID_Budget_MaxGzipBytes:
+		return "budget-max-gzip-bytes"
+
 	default:
 		if id >= MsgID_PackageJSON_FIRST && id <= MsgID_PackageJSON_LAST {
 			return "package.json"
@@ -0,0 +1,267 @@
+package resolver
+
+// This implements browser import maps, which let a JSON file control how
+// import paths are resolved. The specification is here:
+// https://html.spec.whatwg.org/multipage/webappapis.html#import-maps
+//
+// Import maps are written in terms of URLs but esbuild resolves file system
+// paths. So relative paths in the import map (both keys and addresses) are
+// relative to the directory containing the import map, and paths that start
+// with "/" are also relative to that directory (it's treated as the web root).
+// Scopes are matched against the directory containing the importing file.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ije/esbuild-internal/cache"
+	"github.com/ije/esbuild-internal/fs"
+	"github.com/ije/esbuild-internal/helpers"
+	"github.com/ije/esbuild-internal/js_ast"
+	"github.com/ije/esbuild-internal/js_lexer"
+	"github.com/ije/esbuild-internal/js_parser"
+	"github.com/ije/esbuild-internal/logger"
+)
+
+type importMap struct {
+	source  logger.Source
+	imports []importMapEntry
+
+	// These are sorted so that more specific scopes come first
+	scopes []importMapScope
+}
+
+type importMapScope struct {
+	prefix  string // An absolute path without a trailing slash
+	imports []importMapEntry
+}
+
+type importMapEntry struct {
+	// This is either a bare import path, a URL, or an absolute path. It doesn't
+	// have a trailing slash if "isPrefix" is true.
+	key      string
+	keyRange logger.Range
+	isPrefix bool
+
+	// This is either a URL or an absolute path. It doesn't have a trailing
+	// slash if "isPrefix" is true.
+	address string
+	isURL   bool
+
+	// This is true if the address is null, which means that import paths that
+	// match this entry fail to resolve
+	isBlocked bool
+}
+
+func parseImportMap(log logger.Log, fs fs.FS, jsonCache *cache.JSONCache, source logger.Source, baseDir string) *importMap {
+	json, ok := jsonCache.Parse(log, source, js_parser.JSONOptions{})
+	if !ok {
+		return nil
+	}
+
+	result := &importMap{source: source}
+	tracker := logger.MakeLineColumnTracker(&source)
+	if _, ok := json.Data.(*js_ast.EObject); !ok {
+		log.AddID(logger.MsgID_ImportMap_InvalidImportMap, logger.Warning, &tracker, logger.Range{Loc: json.Loc},
+			"The import map must be an object")
+		return result
+	}
+
+	if importsJSON, _, ok := getProperty(json, "imports"); ok {
+		result.imports = parseImportMapEntries(log, fs, &tracker, source, importsJSON, baseDir)
+	}
+
+	if scopesJSON, _, ok := getProperty(json, "scopes"); ok {
+		scopes, ok := scopesJSON.Data.(*js_ast.EObject)
+		if !ok {
+			log.AddID(logger.MsgID_ImportMap_InvalidImportMap, logger.Warning, &tracker, logger.Range{Loc: scopesJSON.Loc},
+				"The value for \"scopes\" must be an object")
+			return result
+		}
+		for _, property := range scopes.Properties {
+			keyStr, _ := property.Key.Data.(*js_ast.EString)
+			key := helpers.UTF16ToString(keyStr.Value)
+			if !isRelativeImportMapPath(key) {
+				// URL scopes can never match a file on the file system
+				if !isImportMapURL(key) {
+					log.AddID(logger.MsgID_ImportMap_InvalidImportMap, logger.Warning, &tracker, source.RangeOfString(property.Key.Loc),
+						fmt.Sprintf("The scope %q must be a relative path or a URL", key))
+				}
+				continue
+			}
+			result.scopes = append(result.scopes, importMapScope{
+				prefix:  fs.Join(baseDir, key),
+				imports: parseImportMapEntries(log, fs, &tracker, source, property.ValueOrNil, baseDir),
+			})
+		}
+		sort.SliceStable(result.scopes, func(i int, j int) bool {
+			return len(result.scopes[i].prefix) > len(result.scopes[j].prefix)
+		})
+	}
+
+	return result
+}
+
+func parseImportMapEntries(
+	log logger.Log,
+	fs fs.FS,
+	tracker *logger.LineColumnTracker,
+	source logger.Source,
+	json js_ast.Expr,
+	baseDir string,
+) (entries []importMapEntry) {
+	obj, ok := json.Data.(*js_ast.EObject)
+	if !ok {
+		log.AddID(logger.MsgID_ImportMap_InvalidImportMap, logger.Warning, tracker, logger.Range{Loc: json.Loc},
+			"The import map entries must be an object")
+		return
+	}
+
+	for _, property := range obj.Properties {
+		keyStr, _ := property.Key.Data.(*js_ast.EString)
+		key := helpers.UTF16ToString(keyStr.Value)
+		keyRange := source.RangeOfString(property.Key.Loc)
+		if key == "" {
+			log.AddID(logger.MsgID_ImportMap_InvalidImportMap, logger.Warning, tracker, keyRange,
+				"Import map keys cannot be empty")
+			continue
+		}
+
+		// Null addresses block the import path, including when a less specific
+		// key or a less specific scope would otherwise have matched
+		if _, ok := property.ValueOrNil.Data.(*js_ast.ENull); ok {
+			entry := importMapEntry{
+				key:       key,
+				keyRange:  keyRange,
+				isPrefix:  strings.HasSuffix(key, "/"),
+				isBlocked: true,
+			}
+			if isRelativeImportMapPath(key) {
+				entry.key = fs.Join(baseDir, key)
+			} else if entry.isPrefix {
+				entry.key = strings.TrimSuffix(key, "/")
+			}
+			entries = append(entries, entry)
+			continue
+		}
+		address, ok := getString(property.ValueOrNil)
+		if !ok {
+			log.AddID(logger.MsgID_ImportMap_InvalidImportMap, logger.Warning, tracker,
+				js_lexer.RangeOfIdentifier(source, property.ValueOrNil.Loc),
+				fmt.Sprintf("The address for %q must be a string", key))
+			continue
+		}
+		addressRange := source.RangeOfString(property.ValueOrNil.Loc)
+
+		entry := importMapEntry{
+			key:      key,
+			keyRange: keyRange,
+			isPrefix: strings.HasSuffix(key, "/"),
+			address:  address,
+			isURL:    isImportMapURL(address),
+		}
+
+		// Addresses for prefix keys must also be prefixes
+		if entry.isPrefix && !strings.HasSuffix(address, "/") {
+			log.AddID(logger.MsgID_ImportMap_InvalidImportMap, logger.Warning, tracker, addressRange,
+				fmt.Sprintf("The address for %q must end with \"/\" because the key ends with \"/\"", key))
+			continue
+		}
+
+		// Addresses must be URLs, which means bare import paths aren't allowed
+		if !entry.isURL && !isRelativeImportMapPath(address) {
+			log.AddIDWithNotes(logger.MsgID_ImportMap_InvalidImportMap, logger.Warning, tracker, addressRange,
+				fmt.Sprintf("The address %q must be a relative path or a URL", address),
+				[]logger.MsgData{{Text: "You can use the \"alias\" feature to substitute one package for another."}})
+			continue
+		}
+
+		// Relative paths are turned into absolute paths
+		if isRelativeImportMapPath(key) {
+			entry.key = fs.Join(baseDir, key)
+		} else if entry.isPrefix {
+			entry.key = strings.TrimSuffix(key, "/")
+		}
+		if !entry.isURL {
+			entry.address = fs.Join(baseDir, address)
+		} else if entry.isPrefix {
+			entry.address = strings.TrimSuffix(address, "/")
+		}
+
+		entries = append(entries, entry)
+	}
+
+	// Prefer longer keys over shorter ones
+	sort.SliceStable(entries, func(i int, j int) bool {
+		return len(entries[i].key) > len(entries[j].key)
+	})
+	return
+}
+
+func isRelativeImportMapPath(text string) bool {
+	return strings.HasPrefix(text, "./") || strings.HasPrefix(text, "../") || (strings.HasPrefix(text, "/") && !strings.HasPrefix(text, "//"))
+}
+
+// This returns true if the text starts with a URL scheme such as "https:" or
+// if it's a protocol-relative URL. Single-letter schemes are not considered
+// to be URLs because they are likely Windows drive letters.
+func isImportMapURL(text string) bool {
+	if strings.HasPrefix(text, "//") {
+		return true
+	}
+	for i, c := range text {
+		if c == ':' {
+			return i > 1
+		}
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (i == 0 || ((c < '0' || c > '9') && c != '+' && c != '-' && c != '.')) {
+			return false
+		}
+	}
+	return false
+}
+
+// This returns the new import path and the entry that matched, if any. The
+// import path must not be resolved if the entry is blocked.
+func (m *importMap) substitute(fs fs.FS, sourceDir string, importPath string) (string, *importMapEntry) {
+	// Relative paths are matched against keys by absolute path. Bare import
+	// paths and URLs are matched as-is.
+	specifier := importPath
+	if !IsPackagePath(importPath) && !fs.IsAbs(importPath) {
+		specifier = fs.Join(sourceDir, importPath)
+	}
+
+	for _, scope := range m.scopes {
+		if sourceDir == scope.prefix || isInsideImportMapPath(sourceDir, scope.prefix) {
+			if path, entry := scope.match(fs, specifier); entry != nil {
+				return path, entry
+			}
+		}
+	}
+	return importMapScope{imports: m.imports}.match(fs, specifier)
+}
+
+func (scope importMapScope) match(fs fs.FS, specifier string) (string, *importMapEntry) {
+	for i := range scope.imports {
+		entry := &scope.imports[i]
+		if !entry.isPrefix {
+			if specifier == entry.key {
+				return entry.address, entry
+			}
+		} else if isInsideImportMapPath(specifier, entry.key) {
+			if entry.isBlocked {
+				return "", entry
+			}
+			rest := specifier[len(entry.key)+1:]
+			if entry.isURL {
+				return entry.address + "/" + rest, entry
+			}
+			return fs.Join(entry.address, rest), entry
+		}
+	}
+	return "", nil
+}
+
+func isInsideImportMapPath(path string, prefix string) bool {
+	return strings.HasPrefix(path, prefix) && len(path) > len(prefix) && (path[len(prefix)] == '/' || path[len(prefix)] == '\\')
+}
@@ -165,6 +165,8 @@ type Resolver struct {
 	caches *cache.CacheSet
 
 	tsConfigOverride *TSConfigJSON
+	importMap        *importMap
+	urlVendor        *urlVendor
 
 	// These are sets that represent various conditions for the "exports" field
 	// in package.json.
@@ -355,6 +357,57 @@ func NewResolver(call config.APICall, fs fs.FS, log logger.Log, caches *cache.Ca
 		}
 	}
 
+	// Handle the import map when the resolver is created for the same reasons
+	// as the "tsconfig.json" override above
+	if options.ImportMapPath != "" {
+		contents, err, _ := caches.FSCache.ReadFile(fs, options.ImportMapPath)
+		keyPath := logger.Path{Text: options.ImportMapPath, Namespace: "file"}
+		prettyPaths := MakePrettyPaths(fs, keyPath)
+		if err == syscall.ENOENT {
+			log.AddError(nil, logger.Range{}, fmt.Sprintf("Cannot find import map file %q",
+				prettyPaths.Select(options.LogPathStyle)))
+		} else if err != nil {
+			log.AddError(nil, logger.Range{}, fmt.Sprintf("Cannot read file %q: %s",
+				prettyPaths.Select(options.LogPathStyle), err.Error()))
+		} else {
+			source := logger.Source{
+				KeyPath:     keyPath,
+				PrettyPaths: prettyPaths,
+				Contents:    contents,
+			}
+			res.importMap = parseImportMap(log, fs, &caches.JSONCache, source, fs.Dir(options.ImportMapPath))
+		}
+	} else if options.ImportMapRaw != "" {
+		source := logger.Source{
+			KeyPath:     logger.Path{Text: fs.Join(fs.Cwd(), "<importmap.json>"), Namespace: "file"},
+			PrettyPaths: logger.PrettyPaths{Abs: "<importmap.json>", Rel: "<importmap.json>"},
+			Contents:    options.ImportMapRaw,
+		}
+		res.importMap = parseImportMap(log, fs, &caches.JSONCache, source, fs.Cwd())
+	}
+
+	// Handle the lockfile for vendored URLs when the resolver is created too
+	if options.URLVendorDir != "" {
+		lockfilePath := fs.Join(options.URLVendorDir, "lock.json")
+		contents, err, _ := caches.FSCache.ReadFile(fs, lockfilePath)
+		keyPath := logger.Path{Text: lockfilePath, Namespace: "file"}
+		prettyPaths := MakePrettyPaths(fs, keyPath)
+		if err == syscall.ENOENT {
+			log.AddError(nil, logger.Range{}, fmt.Sprintf("Cannot find lockfile %q",
+				prettyPaths.Select(options.LogPathStyle)))
+		} else if err != nil {
+			log.AddError(nil, logger.Range{}, fmt.Sprintf("Cannot read file %q: %s",
+				prettyPaths.Select(options.LogPathStyle), err.Error()))
+		} else {
+			source := logger.Source{
+				KeyPath:     keyPath,
+				PrettyPaths: prettyPaths,
+				Contents:    contents,
+			}
+			res.urlVendor = parseURLVendorLockfile(log, &caches.JSONCache, source, options.URLVendorDir)
+		}
+	}
+
 	// Mutate the provided options by settings from "tsconfig.json" if present
 	if res.tsConfigOverride != nil {
 		options.TS.Config = res.tsConfigOverride.Settings
@@ -378,7 +431,44 @@ func (res *Resolver) Resolve(sourceDir string, importPath string, kind ast.Impor
 			importPath, sourceDir, kind.StringForMetafile())}
 	}
 
-	// Apply package alias substitutions first
+	// Apply import map substitutions first. These only apply to JavaScript
+	// imports since that's what import maps do in the browser.
+	if r.importMap != nil && kind != ast.ImportEntryPoint && !kind.IsFromCSS() {
+		if r.debugLogs != nil {
+			r.debugLogs.addNote("Checking for import map matches")
+		}
+		if newPath, entry := r.importMap.substitute(r.fs, sourceDir, importPath); entry != nil && entry.isBlocked {
+			if r.debugLogs != nil {
+				r.debugLogs.addNote(fmt.Sprintf("  Matched with import map key %q, which has a null address", entry.key))
+			}
+			tracker := logger.MakeLineColumnTracker(&r.importMap.source)
+			debugMeta.notes = append(debugMeta.notes, tracker.MsgData(entry.keyRange,
+				fmt.Sprintf("The import path %q is blocked by a null address in the import map here:", importPath)))
+			r.flushDebugLogs(flushDueToFailure)
+			return nil, debugMeta
+		} else if entry != nil {
+			if r.debugLogs != nil {
+				r.debugLogs.addNote(fmt.Sprintf("  Matched with import map key %q", entry.key))
+				r.debugLogs.addNote(fmt.Sprintf("  Modified import path from %q to %q", importPath, newPath))
+			}
+			tracker := logger.MakeLineColumnTracker(&r.importMap.source)
+			debugMeta.notes = append(debugMeta.notes, tracker.MsgData(entry.keyRange,
+				fmt.Sprintf("The import path %q was remapped to %q by the import map here:", importPath, newPath)))
+
+			// Addresses that are URLs are external unless they are vendored
+			if entry.isURL && (r.urlVendor == nil || !IsVendorableURL(newPath)) {
+				r.flushDebugLogs(flushDueToSuccess)
+				return &ResolveResult{
+					PathPair: PathPair{Primary: logger.Path{Text: newPath}, IsExternal: true},
+				}, debugMeta
+			}
+			importPath = newPath
+		} else if r.debugLogs != nil {
+			r.debugLogs.addNote("  Failed to find any import map matches")
+		}
+	}
+
+	// Apply package alias substitutions next
 	if r.options.PackageAliases != nil && IsPackagePath(importPath) {
 		if r.debugLogs != nil {
 			r.debugLogs.addNote("Checking for package alias matches")
@@ -430,6 +520,31 @@ func (res *Resolver) Resolve(sourceDir string, importPath string, kind ast.Impor
 		}
 	}
 
+	// Look up "http://" and "https://" URLs in the vendor directory if there is
+	// one. These are never external by default since the point of vendoring is
+	// to make the build self-contained. CSS "url()" tokens are left alone.
+	if r.urlVendor != nil && IsVendorableURL(importPath) && !kind.IsFromCSS() &&
+		!r.isExternal(r.options.ExternalSettings.PreResolve, importPath, kind) {
+		if r.debugLogs != nil {
+			r.debugLogs.addNote(fmt.Sprintf("Checking for %q in the lockfile", importPath))
+		}
+		if _, ok := r.urlVendor.hashes[trimURLFragment(importPath)]; !ok {
+			if r.debugLogs != nil {
+				r.debugLogs.addNote("  Failed to find this URL in the lockfile")
+			}
+			prettyPaths := r.urlVendor.lockfile.PrettyPaths
+			debugMeta.notes = append(debugMeta.notes, logger.MsgData{Text: fmt.Sprintf(
+				"The URL %q is not in the lockfile %q. URLs must be downloaded into the vendor directory before they can be bundled.",
+				importPath, prettyPaths.Select(r.options.LogPathStyle))})
+			r.flushDebugLogs(flushDueToFailure)
+			return nil, debugMeta
+		}
+		r.flushDebugLogs(flushDueToSuccess)
+		return &ResolveResult{
+			PathPair: PathPair{Primary: logger.Path{Text: importPath, Namespace: "vendor"}},
+		}, debugMeta
+	}
+
 	// Certain types of URLs default to being external for convenience
 	if isExplicitlyExternal := r.isExternal(r.options.ExternalSettings.PreResolve, importPath, kind); isExplicitlyExternal ||
 
@@ -2269,7 +2384,7 @@ func (r resolverQuery) loadPackageImports(importPath string, dirInfoPackageJSON
 	// The condition set is determined by the kind of import
 	conditions := r.esmConditionsDefault
 	switch r.kind {
-	case ast.ImportStmt, ast.ImportDynamic:
+	case ast.ImportStmt, ast.ImportDynamic, ast.ImportNewWorker:
 		conditions = r.esmConditionsImport
 	case ast.ImportRequire, ast.ImportRequireResolve:
 		conditions = r.esmConditionsRequire
@@ -2323,7 +2438,7 @@ func (r resolverQuery) esmResolveAlgorithm(
 	// The condition set is determined by the kind of import
 	conditions := r.esmConditionsDefault
 	switch r.kind {
-	case ast.ImportStmt, ast.ImportDynamic:
+	case ast.ImportStmt, ast.ImportDynamic, ast.ImportNewWorker:
 		conditions = r.esmConditionsImport
 	case ast.ImportRequire, ast.ImportRequireResolve:
 		conditions = r.esmConditionsRequire
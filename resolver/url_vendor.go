@@ -0,0 +1,137 @@
+package resolver
+
+// This implements hermetic builds for "http://" and "https://" imports. URLs
+// are not fetched over the network. Instead they are looked up in a lockfile
+// called "lock.json" in the vendor directory, which maps each URL to the
+// SHA-256 hash of its contents (in hexadecimal). The contents are stored in
+// the vendor directory in a file named after the hash. Populating the vendor
+// directory is done out-of-band by some other tool.
+//
+// Vendored modules live in the "vendor" namespace with the URL as the path.
+// Relative imports inside them are resolved against that URL, which is then
+// looked up in the lockfile again.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"syscall"
+
+	"github.com/ije/esbuild-internal/cache"
+	"github.com/ije/esbuild-internal/helpers"
+	"github.com/ije/esbuild-internal/js_ast"
+	"github.com/ije/esbuild-internal/js_lexer"
+	"github.com/ije/esbuild-internal/js_parser"
+	"github.com/ije/esbuild-internal/logger"
+)
+
+type urlVendor struct {
+	dir      string
+	lockfile logger.Source
+
+	// This maps each URL to the hexadecimal SHA-256 hash of its contents
+	hashes map[string]string
+}
+
+func parseURLVendorLockfile(log logger.Log, jsonCache *cache.JSONCache, source logger.Source, dir string) *urlVendor {
+	result := &urlVendor{dir: dir, lockfile: source, hashes: make(map[string]string)}
+	json, ok := jsonCache.Parse(log, source, js_parser.JSONOptions{})
+	if !ok {
+		return result
+	}
+
+	tracker := logger.MakeLineColumnTracker(&source)
+	obj, ok := json.Data.(*js_ast.EObject)
+	if !ok {
+		log.AddError(&tracker, logger.Range{Loc: json.Loc}, "The lockfile must be an object")
+		return result
+	}
+
+	for _, property := range obj.Properties {
+		keyStr, _ := property.Key.Data.(*js_ast.EString)
+		key := helpers.UTF16ToString(keyStr.Value)
+		if !IsVendorableURL(key) {
+			log.AddError(&tracker, source.RangeOfString(property.Key.Loc),
+				fmt.Sprintf("The lockfile key %q must be an \"http://\" or \"https://\" URL", key))
+			continue
+		}
+		hash, ok := getString(property.ValueOrNil)
+		if !ok || !isSHA256Hex(hash) {
+			log.AddError(&tracker, js_lexer.RangeOfIdentifier(source, property.ValueOrNil.Loc),
+				fmt.Sprintf("The hash for %q must be a hexadecimal SHA-256 digest", key))
+			continue
+		}
+		result.hashes[key] = strings.ToLower(hash)
+	}
+	return result
+}
+
+func isSHA256Hex(text string) bool {
+	if len(text) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(text)
+	return err == nil
+}
+
+func IsVendorableURL(text string) bool {
+	return strings.HasPrefix(text, "http://") || strings.HasPrefix(text, "https://")
+}
+
+// Imports inside of vendored modules are relative to the module's URL. This
+// returns the import path unchanged if it's not relative (e.g. a bare import
+// path that should be handled by an import map).
+func ResolveVendoredImportPath(importerURL string, importPath string) string {
+	if !strings.HasPrefix(importPath, "./") && !strings.HasPrefix(importPath, "../") && !strings.HasPrefix(importPath, "/") {
+		return importPath
+	}
+	base, err := url.Parse(importerURL)
+	if err != nil {
+		return importPath
+	}
+	ref, err := url.Parse(importPath)
+	if err != nil {
+		return importPath
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// Fragments are never sent to the server, so they don't affect the contents
+func trimURLFragment(text string) string {
+	if i := strings.IndexByte(text, '#'); i != -1 {
+		return text[:i]
+	}
+	return text
+}
+
+// This returns false if the URL isn't in the lockfile. Otherwise it reads the
+// vendored file and checks that its contents match the hash in the lockfile.
+func (res *Resolver) ReadVendoredURL(text string) (contents string, ok bool, err error) {
+	if res.urlVendor == nil {
+		return "", false, nil
+	}
+	hash, ok := res.urlVendor.hashes[trimURLFragment(text)]
+	if !ok {
+		return "", false, nil
+	}
+
+	path := res.fs.Join(res.urlVendor.dir, hash)
+	contents, err, _ = res.caches.FSCache.ReadFile(res.fs, path)
+	if err != nil {
+		if err == syscall.ENOENT {
+			prettyPaths := MakePrettyPaths(res.fs, logger.Path{Text: path, Namespace: "file"})
+			err = fmt.Errorf("the vendored file %q is missing", prettyPaths.Select(res.options.LogPathStyle))
+		}
+		return "", true, err
+	}
+
+	actual := sha256.Sum256([]byte(contents))
+	if actualHex := hex.EncodeToString(actual[:]); actualHex != hash {
+		prettyPaths := MakePrettyPaths(res.fs, logger.Path{Text: path, Namespace: "file"})
+		return "", true, fmt.Errorf("the vendored file %q has the hash %s but the lockfile expects %s",
+			prettyPaths.Select(res.options.LogPathStyle), actualHex, hash)
+	}
+	return contents, true, nil
+}
@@ -512,6 +512,87 @@ func Source(unsupportedJSFeatures compat.JSFeature) logger.Source {
 					method('return'),
 					it)
 
+		// These help for lowering generator functions
+		export var __generate = (__this, body) => {
+			var state = { n: 0, t: [] }, delegate, running, done, it = {}
+			var run = op => {
+				for (var entry, fn, x; ; ) {
+					// Forward to the iterator from "yield*" until it's done
+					if (delegate) {
+						try {
+							fn = delegate[op[0] ? op[0] > 1 ? 'return' : 'throw' : 'next']
+							if (fn || !op[0]) {
+								x = fn.call(delegate, op[1])
+								if (!(x instanceof Object)) __typeError('Object expected')
+								if (!x.done) return x
+								op = [op[0] > 1 ? 2 : 0, x.value]
+							} else if (op[0] < 2) {
+								(fn = delegate.return) && fn.call(delegate)
+								__typeError('The iterator does not provide a "throw" method')
+							}
+						} catch (e) {
+							op = [1, e]
+						}
+						delegate = 0
+					}
+
+					// Run the state machine until the next operation
+					if (!op[0]) {
+						state.v = op[1]
+						try {
+							op = body.call(__this, state)
+							if (op[0] > 4) {
+								state.n = op[2]
+								if (op[0] < 6) return { value: op[1], done: false }
+								delegate = __iterate(op[1])
+								op = [0]
+							}
+						} catch (e) {
+							op = [1, e]
+						}
+					}
+
+					// The end of a "finally" block resumes the pending operation
+					else if (op[0] > 3) op = state.t.pop()[3]
+
+					// Jumps that don't leave any "try" blocks are direct
+					else if (op[0] > 2 && state.t.length <= (op[2] | 0)) state.n = op[1], op = [0]
+
+					// Otherwise unwind to the innermost "catch" or "finally" block
+					else if (entry = state.t[state.t.length - 1]) {
+						if (op[0] < 2 && !entry[2] && entry[0]) entry[2] = 1, state.n = entry[0], op = [0, op[1]]
+						else if (entry[2] !== 2 && entry[1]) entry[2] = 2, entry[3] = op, state.n = entry[1], op = [0]
+						else state.t.pop()
+					}
+
+					else {
+						done = 1
+						if (op[0] < 2) throw op[1]
+						return { value: op[1], done: true }
+					}
+				}
+			}
+			var method = (k, key) => it[key] = x => {
+				if (running) __typeError('Generator is already running')
+				if (done) {
+					if (k === 1) throw x
+					return { value: k ? x : void 0, done: true }
+				}
+				try {
+					return running = 1, run([k, x])
+				} finally {
+					running = 0
+				}
+			}
+			if (typeof Symbol === 'function') it[Symbol.iterator] = () => it
+			return method(0, 'next'), method(1, 'throw'), method(2, 'return'), it
+		}
+		export var __iterate = (value, fn, i) => {
+			if (fn = typeof Symbol === 'function' && value[Symbol.iterator]) return fn.call(value)
+			if (typeof value.length !== 'number') __typeError('Object is not iterable')
+			return i = 0, { next: () => ({ value: value[i], done: i++ >= value.length }) }
+		}
+
 		// This is for the "binary" loader (custom code is ~2x faster than "atob")
 		export var __toBinaryNode = Uint8Array.fromBase64 || (base64 => new Uint8Array(Buffer.from(base64, 'base64')))
 		export var __toBinary = Uint8Array.fromBase64 || /* @__PURE__ */ (() => {
@@ -565,6 +646,96 @@ func Source(unsupportedJSFeatures compat.JSFeature) logger.Source {
 			}
 			return next()
 		}
+
+		// These are for hot module replacement. The state is stored on the global
+		// object because each update from the server is evaluated separately with
+		// its own copy of these helpers. ES modules are registered using their
+		// exports object and CommonJS modules are registered using "module".
+		var __hmrState = () => {
+			var g = typeof globalThis === 'object' ? globalThis : typeof window === 'object' ? window : self
+			var hmr = g.__esbuild_hmr
+			if (!hmr) {
+				hmr = g.__esbuild_hmr = { modules: {}, cjs: {}, hot: {}, data: {} }
+				if (typeof EventSource === 'function')
+					new EventSource('/esbuild').addEventListener('hmr', e => __hmrApply(hmr, JSON.parse(e.data)))
+			}
+			return hmr
+		}
+		var __hmrMatch = (importer, spec, id) => {
+			if (spec[0] === '.') {
+				var parts = importer.split('/').slice(0, -1)
+				spec.split('/').forEach(part => part === '..' ? parts.pop() : part !== '.' && parts.push(part))
+				spec = parts.join('/')
+			}
+			return id === spec || id.replace(/(\/index)?\.[^./]+$/, '') === spec
+		}
+		var __hmrApply = (hmr, payload) => {
+			var modules = hmr.modules, cjs = hmr.cjs, updates = payload.updates || [], accepted = [], reload = payload.reload
+			var exportsOf = id => id in cjs ? cjs[id].exports : modules[id]
+			var accept = (update, importer) => {
+				var hot = hmr.hot[importer || update.id], found
+				if (hot) hot.accepts.forEach(a => {
+					if (importer ? a.deps && a.deps.some(dep => __hmrMatch(importer, dep, update.id)) : !a.deps)
+						accepted.push([update, a, importer]), found = true
+				})
+				return found
+			}
+
+			// Each updated module must either accept itself or be accepted by all of
+			// its importers. Otherwise the page must be reloaded to pick up the change.
+			updates = updates.filter(update => update.id in modules || update.id in cjs)
+			updates.forEach(update => {
+				if (!accept(update)) {
+					var importers = update.importers.filter(importer => importer in modules || importer in cjs)
+					if (!importers.length || !importers.every(importer => accept(update, importer))) reload = true
+				}
+			})
+			if (reload) return location.reload()
+
+			// Dispose of the old version of each module and evaluate the new one
+			for (var i = 0; i < updates.length; i++) {
+				var id = updates[i].id, hot = hmr.hot[id], data = {}, old = modules[id], module = { exports: {} }
+				if (hot) hot.disposes.forEach(cb => cb(data))
+				hmr.data[id] = data
+				delete hmr.hot[id]
+				try {
+					new Function('require', 'module', 'exports', updates[i].code)(dep => {
+						if (dep in cjs) return cjs[dep].exports
+						if (dep in modules) return __toCommonJS(modules[dep])
+						throw new Error('Cannot find module "' + dep + '"')
+					}, module, module.exports)
+				} catch (e) {
+					console.error(e)
+					return location.reload()
+				}
+				if (id in cjs) cjs[id] = module
+				else if (modules[id] === old) return location.reload()
+			}
+
+			// Pass the new exports to the callbacks that accepted the update
+			accepted.forEach(item => {
+				var a = item[1], exports = exportsOf(item[0].id)
+				if (a.cb) a.cb(!a.deps || a.single ? exports : a.deps.map(dep => __hmrMatch(item[2], dep, item[0].id) ? exports : void 0))
+			})
+		}
+		export var __hmrRegister = (id, exports, module) => {
+			var hmr = __hmrState()
+			if (module) hmr.cjs[id] = module
+			else hmr.modules[id] = exports
+		}
+		export var __hmrHot = id => {
+			var hmr = __hmrState(), hot = hmr.hot[id], accepts, disposes
+			if (!hot) hot = hmr.hot[id] = {
+				data: hmr.data[id] || {},
+				accepts: accepts = [],
+				disposes: disposes = [],
+				accept: (deps, cb) => accepts.push(deps == null || typeof deps === 'function'
+					? { cb: deps } : { deps: [].concat(deps), single: typeof deps === 'string', cb: cb }),
+				dispose: cb => disposes.push(cb),
+				invalidate: () => location.reload(),
+			}
+			return hot
+		}
 	`
 
 	return logger.Source{
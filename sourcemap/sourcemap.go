@@ -845,3 +845,141 @@ func (b *ChunkBuilder) appendMappingWithoutRemapping(currentState SourceMapState
 	}
 	b.hasPrevState = true
 }
+
+// This is used when generated code is transformed again after the source map
+// for it has already been generated. The mappings in "outer" go from the
+// transformed code to the generated code and "inner" contains the encoded
+// mappings from the generated code to the original code. The result is the
+// encoded mappings from the transformed code to the original code, which
+// reference the same sources and names as "inner".
+func ComposeMappings(outer []Mapping, inner []byte) []byte {
+	innerMap := SourceMap{Mappings: decodeMappings(inner)}
+	composed := make([]Mapping, 0, len(outer))
+	for _, mapping := range outer {
+		// Generated code without a mapping stays without a mapping
+		found := innerMap.Find(mapping.OriginalLine, mapping.OriginalColumn)
+		if found == nil {
+			continue
+		}
+		if found.SourceIndex < 0 {
+			composed = append(composed, Mapping{
+				GeneratedLine:   mapping.GeneratedLine,
+				GeneratedColumn: mapping.GeneratedColumn,
+				SourceIndex:     -1,
+			})
+			continue
+		}
+
+		// Only keep the original name if the mapping is for the same token
+		var originalName ast.Index32
+		if found.GeneratedColumn == mapping.OriginalColumn {
+			originalName = found.OriginalName
+		}
+		composed = append(composed, Mapping{
+			GeneratedLine:   mapping.GeneratedLine,
+			GeneratedColumn: mapping.GeneratedColumn,
+			SourceIndex:     found.SourceIndex,
+			OriginalLine:    found.OriginalLine,
+			OriginalColumn:  found.OriginalColumn,
+			OriginalName:    originalName,
+		})
+	}
+	return encodeMappings(composed)
+}
+
+// This assumes the encoded mappings are valid, which is the case for mappings
+// generated by esbuild. Mappings without an original location are returned
+// with a source index of -1.
+func decodeMappings(encoded []byte) (mappings []Mapping) {
+	var generatedLine int
+	var generatedColumn int
+	var sourceIndex int
+	var originalLine int
+	var originalColumn int
+	var originalName int
+	current := 0
+
+	for current < len(encoded) {
+		switch encoded[current] {
+		case ';':
+			generatedLine++
+			generatedColumn = 0
+			current++
+			continue
+
+		case ',':
+			current++
+			continue
+		}
+
+		var delta int
+		delta, current = DecodeVLQ(encoded, current)
+		generatedColumn += delta
+		mapping := Mapping{
+			GeneratedLine:   int32(generatedLine),
+			GeneratedColumn: int32(generatedColumn),
+			SourceIndex:     -1,
+		}
+
+		// Read the optional original location
+		if current < len(encoded) && encoded[current] != ',' && encoded[current] != ';' {
+			delta, current = DecodeVLQ(encoded, current)
+			sourceIndex += delta
+			delta, current = DecodeVLQ(encoded, current)
+			originalLine += delta
+			delta, current = DecodeVLQ(encoded, current)
+			originalColumn += delta
+			mapping.SourceIndex = int32(sourceIndex)
+			mapping.OriginalLine = int32(originalLine)
+			mapping.OriginalColumn = int32(originalColumn)
+
+			// Read the optional original name
+			if current < len(encoded) && encoded[current] != ',' && encoded[current] != ';' {
+				delta, current = DecodeVLQ(encoded, current)
+				originalName += delta
+				mapping.OriginalName = ast.MakeIndex32(uint32(originalName))
+			}
+		}
+
+		mappings = append(mappings, mapping)
+	}
+
+	return
+}
+
+// The mappings must be sorted by generated position. Mappings with a negative
+// source index are encoded without an original location.
+func encodeMappings(mappings []Mapping) []byte {
+	var buffer []byte
+	var lastByte byte
+	prevState := SourceMapState{}
+
+	for _, mapping := range mappings {
+		// Handle line breaks in between this mapping and the previous one
+		for prevState.GeneratedLine < int(mapping.GeneratedLine) {
+			buffer = append(buffer, ';')
+			lastByte = ';'
+			prevState.GeneratedLine++
+			prevState.GeneratedColumn = 0
+		}
+
+		currentState := prevState
+		currentState.GeneratedColumn = int(mapping.GeneratedColumn)
+		omitSource := mapping.SourceIndex < 0
+		if !omitSource {
+			currentState.SourceIndex = int(mapping.SourceIndex)
+			currentState.OriginalLine = int(mapping.OriginalLine)
+			currentState.OriginalColumn = int(mapping.OriginalColumn)
+		}
+		currentState.HasOriginalName = !omitSource && mapping.OriginalName.IsValid()
+		if currentState.HasOriginalName {
+			currentState.OriginalName = int(mapping.OriginalName.GetIndex())
+		}
+
+		buffer, _ = appendMappingToBuffer(buffer, lastByte, prevState, currentState, omitSource)
+		lastByte = buffer[len(buffer)-1]
+		prevState = currentState
+	}
+
+	return buffer
+}